@@ -0,0 +1,304 @@
+package asm
+
+import (
+	"fmt"
+	"sort"
+)
+
+// BasicBlock is a sequence of instructions which is only entered at the
+// first and only left at the last instruction.
+type BasicBlock struct {
+	// ID is the index of the block in ControlFlowGraph.Blocks.
+	ID int
+	// Index of the first instruction of the block in the program.
+	Start int
+	// The instructions of the block.
+	Instructions Instructions
+	// IDs of blocks which may execute after this block.
+	Successors []int
+	// IDs of blocks which may execute before this block.
+	Predecessors []int
+}
+
+func (bb *BasicBlock) String() string {
+	return fmt.Sprintf("block %d (instructions %d-%d)", bb.ID, bb.Start, bb.Start+len(bb.Instructions)-1)
+}
+
+// ControlFlowGraph describes the possible paths of execution through a
+// program.
+//
+// bpf to bpf calls don't create edges. Instead, the target of each call
+// is the entry of a separate function.
+type ControlFlowGraph struct {
+	// Blocks ordered by their position in the program.
+	Blocks []*BasicBlock
+	// IDs of blocks at which a function starts. The first entry is the
+	// entry point of the program.
+	Entries []int
+
+	idom []int
+}
+
+// ControlFlowGraph splits a program into basic blocks.
+//
+// Jumps to labels are resolved as if the program was marshaled.
+func (insns Instructions) ControlFlowGraph() (*ControlFlowGraph, error) {
+	if len(insns) == 0 {
+		return nil, fmt.Errorf("can't build control flow graph: no instructions")
+	}
+
+	resolved, err := insns.resolveJumps()
+	if err != nil {
+		return nil, err
+	}
+
+	targets, err := resolved.branchTargets()
+	if err != nil {
+		return nil, err
+	}
+
+	// Find the first instruction of each block.
+	leaders := map[int]bool{0: true}
+	entries := map[int]bool{0: true}
+	for i, target := range targets {
+		leaders[target] = true
+		if resolved[i].IsFunctionCall() {
+			entries[target] = true
+			continue
+		}
+
+		if i+1 < len(resolved) {
+			leaders[i+1] = true
+		}
+	}
+	for i, ins := range resolved {
+		if ins.OpCode.Class() == JumpClass && ins.OpCode.JumpOp() == Exit && i+1 < len(resolved) {
+			leaders[i+1] = true
+		}
+	}
+
+	starts := make([]int, 0, len(leaders))
+	for start := range leaders {
+		starts = append(starts, start)
+	}
+	sort.Ints(starts)
+
+	cfg := &ControlFlowGraph{}
+	blockOf := make(map[int]int, len(starts))
+	for id, start := range starts {
+		end := len(resolved)
+		if id+1 < len(starts) {
+			end = starts[id+1]
+		}
+
+		blockOf[start] = id
+		cfg.Blocks = append(cfg.Blocks, &BasicBlock{
+			ID:           id,
+			Start:        start,
+			Instructions: resolved[start:end:end],
+		})
+
+		if entries[start] {
+			cfg.Entries = append(cfg.Entries, id)
+		}
+	}
+
+	addEdge := func(from *BasicBlock, to int) {
+		for _, succ := range from.Successors {
+			if succ == to {
+				return
+			}
+		}
+		from.Successors = append(from.Successors, to)
+		cfg.Blocks[to].Predecessors = append(cfg.Blocks[to].Predecessors, from.ID)
+	}
+
+	for _, bb := range cfg.Blocks {
+		last := bb.Start + len(bb.Instructions) - 1
+		ins := resolved[last]
+		next := bb.ID + 1
+
+		if ins.OpCode.Class() == JumpClass {
+			switch op := ins.OpCode.JumpOp(); op {
+			case Exit:
+				continue
+
+			case Ja:
+				addEdge(bb, blockOf[targets[last]])
+				continue
+
+			case Call:
+
+			default:
+				addEdge(bb, blockOf[targets[last]])
+			}
+		}
+
+		if next >= len(cfg.Blocks) {
+			return nil, fmt.Errorf("instruction %d: execution continues past the last instruction", last)
+		}
+		addEdge(bb, next)
+	}
+
+	cfg.idom, err = cfg.dominators()
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Block returns the block containing the instruction at index.
+//
+// Returns nil if index is out of bounds.
+func (cfg *ControlFlowGraph) Block(index int) *BasicBlock {
+	i := sort.Search(len(cfg.Blocks), func(i int) bool {
+		return cfg.Blocks[i].Start > index
+	})
+	if i == 0 {
+		return nil
+	}
+
+	bb := cfg.Blocks[i-1]
+	if index >= bb.Start+len(bb.Instructions) {
+		return nil
+	}
+	return bb
+}
+
+// ImmediateDominator returns the ID of the closest block which lies on
+// every path from the entry of the function to block id.
+//
+// Returns -1 for the entry blocks of functions and for unreachable blocks.
+func (cfg *ControlFlowGraph) ImmediateDominator(id int) int {
+	return cfg.idom[id]
+}
+
+// Dominates returns true if every path from the entry of the function
+// to block b passes through block a.
+//
+// Every reachable block dominates itself.
+func (cfg *ControlFlowGraph) Dominates(a, b int) bool {
+	if !cfg.Reachable(b) {
+		return false
+	}
+
+	for ; b != -1; b = cfg.idom[b] {
+		if b == a {
+			return true
+		}
+	}
+	return false
+}
+
+// Reachable returns true if a block can be reached from the entry of
+// a function.
+func (cfg *ControlFlowGraph) Reachable(id int) bool {
+	return cfg.idom[id] != -1 || cfg.isEntry(id)
+}
+
+func (cfg *ControlFlowGraph) isEntry(id int) bool {
+	for _, entry := range cfg.Entries {
+		if entry == id {
+			return true
+		}
+	}
+	return false
+}
+
+// dominators calculates the immediate dominator of each block.
+//
+// See "A Simple, Fast Dominance Algorithm" by Cooper, Harvey and Kennedy.
+func (cfg *ControlFlowGraph) dominators() ([]int, error) {
+	const undefined = -1
+
+	// Order the blocks in reverse post order, starting from each entry.
+	var (
+		postorder []int
+		owner     = make([]int, len(cfg.Blocks))
+		visit     func(int, int) error
+	)
+	for i := range owner {
+		owner[i] = undefined
+	}
+	visit = func(id, entry int) error {
+		owner[id] = entry
+		for _, succ := range cfg.Blocks[id].Successors {
+			switch owner[succ] {
+			case undefined:
+				if err := visit(succ, entry); err != nil {
+					return err
+				}
+			case entry:
+			default:
+				return fmt.Errorf("%s is part of multiple functions", cfg.Blocks[succ])
+			}
+		}
+		postorder = append(postorder, id)
+		return nil
+	}
+
+	idom := make([]int, len(cfg.Blocks))
+	for i := range idom {
+		idom[i] = undefined
+	}
+
+	for _, entry := range cfg.Entries {
+		if owner[entry] != undefined {
+			return nil, fmt.Errorf("%s is part of multiple functions", cfg.Blocks[entry])
+		}
+		if err := visit(entry, entry); err != nil {
+			return nil, err
+		}
+		idom[entry] = entry
+	}
+
+	index := make([]int, len(cfg.Blocks))
+	for i, id := range postorder {
+		index[id] = i
+	}
+
+	intersect := func(a, b int) int {
+		for a != b {
+			for index[a] < index[b] {
+				a = idom[a]
+			}
+			for index[b] < index[a] {
+				b = idom[b]
+			}
+		}
+		return a
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for i := len(postorder) - 1; i >= 0; i-- {
+			id := postorder[i]
+			if idom[id] == id {
+				continue
+			}
+
+			newIdom := undefined
+			for _, pred := range cfg.Blocks[id].Predecessors {
+				if idom[pred] == undefined {
+					continue
+				}
+				if newIdom == undefined {
+					newIdom = pred
+				} else {
+					newIdom = intersect(pred, newIdom)
+				}
+			}
+
+			if idom[id] != newIdom {
+				idom[id] = newIdom
+				changed = true
+			}
+		}
+	}
+
+	for _, entry := range cfg.Entries {
+		idom[entry] = undefined
+	}
+	return idom, nil
+}
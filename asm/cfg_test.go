@@ -0,0 +1,85 @@
+package asm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestControlFlowGraph(t *testing.T) {
+	insns := Instructions{
+		// block 0
+		Mov.Imm(R0, 0),
+		JEq.Imm(R1, 0, "else"),
+		// block 1
+		Mov.Imm(R0, 1),
+		Ja.Label("out"),
+		// block 2
+		Mov.Imm(R0, 2).Sym("else"),
+		Call.Label("fn"),
+		// block 3
+		Return().Sym("out"),
+		// block 4
+		Mov.Imm(R0, 3).Sym("fn"),
+		Return(),
+	}
+
+	cfg, err := insns.ControlFlowGraph()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(cfg.Blocks); n != 5 {
+		t.Fatalf("Expected 5 blocks, got %d", n)
+	}
+
+	if !reflect.DeepEqual(cfg.Entries, []int{0, 4}) {
+		t.Error("Unexpected entries:", cfg.Entries)
+	}
+
+	edges := [][]int{{2, 1}, {3}, {3}, nil, nil}
+	for i, want := range edges {
+		bb := cfg.Blocks[i]
+		if !reflect.DeepEqual(bb.Successors, want) {
+			t.Errorf("Block %d: expected successors %v, got %v", i, want, bb.Successors)
+		}
+	}
+
+	if preds := cfg.Blocks[3].Predecessors; !reflect.DeepEqual(preds, []int{1, 2}) {
+		t.Error("Unexpected predecessors of block 3:", preds)
+	}
+
+	idoms := []int{-1, 0, 0, 0, -1}
+	for i, want := range idoms {
+		if have := cfg.ImmediateDominator(i); have != want {
+			t.Errorf("Block %d: expected immediate dominator %d, got %d", i, want, have)
+		}
+	}
+
+	if !cfg.Dominates(0, 3) || cfg.Dominates(1, 3) || cfg.Dominates(0, 4) {
+		t.Error("Dominates returns wrong result")
+	}
+
+	if bb := cfg.Block(5); bb != cfg.Blocks[2] {
+		t.Error("Instruction 5 is in", bb)
+	}
+	if bb := cfg.Block(len(insns)); bb != nil {
+		t.Error("Out of bounds instruction is in", bb)
+	}
+}
+
+func TestControlFlowGraphUnreachable(t *testing.T) {
+	insns := Instructions{
+		Return(),
+		Mov.Imm(R0, 0),
+		Return(),
+	}
+
+	cfg, err := insns.ControlFlowGraph()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Reachable(1) {
+		t.Error("Block after exit is reachable")
+	}
+}
@@ -0,0 +1,300 @@
+package asm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StackSize is the size of the stack available to a BPF function in bytes.
+const StackSize = 512
+
+// Diagnostic is a problem with a program found by Check.
+type Diagnostic struct {
+	// Index of the offending instruction.
+	Index   int
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("instruction %d: %s", d.Index, d.Message)
+}
+
+// Diagnostics is returned by Check if a program is invalid.
+type Diagnostics []Diagnostic
+
+func (ds Diagnostics) Error() string {
+	lines := make([]string, 0, len(ds))
+	for _, d := range ds {
+		lines = append(lines, d.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// registers is a set of registers.
+type registers uint16
+
+func (rs registers) has(r Register) bool { return rs&(1<<r) != 0 }
+func (rs *registers) add(r Register)     { *rs |= 1 << r }
+
+const callerSaved registers = 1<<R1 | 1<<R2 | 1<<R3 | 1<<R4 | 1<<R5
+
+// Check performs best-effort static analysis of a program and returns
+// Diagnostics if it finds problems the kernel verifier would reject.
+//
+// The following is checked:
+//
+//   - opcodes are valid and jumps stay within the program
+//   - registers are written before they are read
+//   - accesses via the frame pointer stay within StackSize
+//   - the frame pointer isn't modified
+//   - every function can reach an exit and execution can't run past the
+//     last instruction
+//
+// A nil error doesn't mean that the kernel will accept the program.
+func (insns Instructions) Check() error {
+	if len(insns) == 0 {
+		return Diagnostics{{0, "program has no instructions"}}
+	}
+
+	var diags Diagnostics
+	report := func(i int, format string, args ...interface{}) {
+		diags = append(diags, Diagnostic{i, fmt.Sprintf(format, args...)})
+	}
+
+	insns.checkJumps(report)
+	insns.checkStack(report)
+	if len(diags) > 0 {
+		// The control flow graph can't be built if jumps are invalid.
+		return diags
+	}
+
+	cfg, err := insns.ControlFlowGraph()
+	if err != nil {
+		return fmt.Errorf("can't check program: %w", err)
+	}
+
+	cfg.checkExits(report)
+	cfg.checkRegisters(report)
+
+	if len(diags) > 0 {
+		return diags
+	}
+	return nil
+}
+
+func (insns Instructions) checkJumps(report func(int, string, ...interface{})) {
+	offsets := insns.rawOffsets()
+	valid := make(map[int64]bool, len(offsets))
+	symbols := make(map[string]bool)
+	for i, offset := range offsets {
+		valid[int64(offset)] = true
+		if sym := insns[i].Symbol; sym != "" {
+			symbols[sym] = true
+		}
+	}
+
+	last := len(insns) - 1
+	if op := insns[last].OpCode; op.Class() != JumpClass || (op.JumpOp() != Exit && op.JumpOp() != Ja) {
+		report(last, "execution continues past the last instruction")
+	}
+
+	for i, ins := range insns {
+		if ins.OpCode == InvalidOpCode {
+			report(i, "invalid opcode")
+			continue
+		}
+
+		if ins.OpCode.Class() != JumpClass {
+			continue
+		}
+
+		var delta int64
+		switch op := ins.OpCode.JumpOp(); {
+		case op == Exit:
+			continue
+
+		case op == Call && !ins.IsFunctionCall():
+			continue
+
+		case op == Call && ins.Constant == -1 && ins.Reference != "":
+			// Calls to other sections are resolved when loading.
+			continue
+
+		case op == Call:
+			delta = ins.Constant
+
+		case ins.isJumpToLabel():
+			if !symbols[ins.Reference] {
+				report(i, "jump to missing label %q", ins.Reference)
+			}
+			continue
+
+		default:
+			delta = int64(ins.Offset)
+		}
+
+		if target := int64(offsets[i]) + delta + 1; !valid[target] {
+			report(i, "branch target %d is outside of the program", delta)
+		}
+	}
+}
+
+func (insns Instructions) checkStack(report func(int, string, ...interface{})) {
+	for i, ins := range insns {
+		var base Register
+		switch ins.OpCode.Class() {
+		case LdXClass:
+			base = ins.Src
+		case StClass, StXClass:
+			base = ins.Dst
+		default:
+			continue
+		}
+
+		if ins.OpCode.Mode() != MemMode && ins.OpCode.Mode() != XAddMode {
+			continue
+		}
+
+		if base != RFP {
+			continue
+		}
+
+		off := int(ins.Offset)
+		size := ins.OpCode.Size().Sizeof()
+		if off < -StackSize || off+size > 0 {
+			report(i, "stack access of %d bytes at offset %d is outside of the %d byte stack", size, off, StackSize)
+		}
+	}
+}
+
+func (cfg *ControlFlowGraph) checkExits(report func(int, string, ...interface{})) {
+	exits := make(map[int]bool)
+	for _, bb := range cfg.Blocks {
+		last := bb.Instructions[len(bb.Instructions)-1]
+		if last.OpCode.Class() == JumpClass && last.OpCode.JumpOp() == Exit && cfg.Reachable(bb.ID) {
+			exits[cfg.entryOf(bb.ID)] = true
+		}
+	}
+
+	for _, entry := range cfg.Entries {
+		if !exits[entry] {
+			report(cfg.Blocks[entry].Start, "function never exits")
+		}
+	}
+}
+
+// entryOf returns the entry of the function containing a reachable block.
+func (cfg *ControlFlowGraph) entryOf(id int) int {
+	for cfg.idom[id] != -1 {
+		id = cfg.idom[id]
+	}
+	return id
+}
+
+// checkRegisters finds reads of registers which haven't been written on
+// any path leading to the instruction.
+//
+// Since the analysis doesn't know which paths are feasible it only reports
+// registers which are uninitialized on all paths.
+func (cfg *ControlFlowGraph) checkRegisters(report func(int, string, ...interface{})) {
+	in := make([]registers, len(cfg.Blocks))
+	for _, entry := range cfg.Entries {
+		// The context is passed in R1, function arguments in R1-R5.
+		in[entry] = 1<<R1 | 1<<RFP
+		if entry != 0 {
+			in[entry] |= callerSaved
+		}
+	}
+
+	nop := func(int, string, ...interface{}) {}
+	for changed := true; changed; {
+		changed = false
+		for _, bb := range cfg.Blocks {
+			out := bb.transferRegisters(in[bb.ID], nop)
+			for _, succ := range bb.Successors {
+				if merged := in[succ] | out; merged != in[succ] {
+					in[succ] = merged
+					changed = true
+				}
+			}
+		}
+	}
+
+	for _, bb := range cfg.Blocks {
+		if cfg.Reachable(bb.ID) {
+			bb.transferRegisters(in[bb.ID], report)
+		}
+	}
+}
+
+// transferRegisters returns the set of initialized registers after
+// executing the block.
+func (bb *BasicBlock) transferRegisters(init registers, report func(int, string, ...interface{})) registers {
+	for i, ins := range bb.Instructions {
+		index := bb.Start + i
+		read := func(r Register) {
+			if !init.has(r) {
+				report(index, "%s is read before it is written", r)
+			}
+		}
+		write := func(r Register) {
+			if r == RFP {
+				report(index, "frame pointer is read-only")
+			}
+			init.add(r)
+		}
+
+		op := ins.OpCode
+		switch op.Class() {
+		case LdClass:
+			switch op.Mode() {
+			case ImmMode:
+				write(ins.Dst)
+			case AbsMode, IndMode:
+				read(R6)
+				if op.Mode() == IndMode {
+					read(ins.Src)
+				}
+				init &^= callerSaved
+				write(R0)
+			}
+
+		case LdXClass:
+			read(ins.Src)
+			write(ins.Dst)
+
+		case StClass:
+			read(ins.Dst)
+
+		case StXClass:
+			read(ins.Dst)
+			read(ins.Src)
+
+		case ALUClass, ALU64Class:
+			if op.ALUOp() != Mov {
+				read(ins.Dst)
+			}
+			if op.Source() == RegSource && op.ALUOp() != Neg && op.ALUOp() != Swap {
+				read(ins.Src)
+			}
+			write(ins.Dst)
+
+		case JumpClass:
+			switch op.JumpOp() {
+			case Exit:
+				read(R0)
+			case Call:
+				init &^= callerSaved
+				init.add(R0)
+			case Ja:
+			default:
+				read(ins.Dst)
+				if op.Source() == RegSource {
+					read(ins.Src)
+				}
+			}
+		}
+	}
+
+	return init
+}
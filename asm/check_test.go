@@ -0,0 +1,135 @@
+package asm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	valid := Instructions{
+		Mov.Reg(R6, R1),
+		StoreImm(RFP, -8, 0, DWord),
+		Mov.Reg(R2, RFP),
+		Add.Imm(R2, -8),
+		LoadMapPtr(R1, 0),
+		FnMapLookupElem.Call(),
+		JEq.Imm(R0, 0, "out"),
+		LoadMem(R0, R0, 0, Word),
+		Call.Label("fn"),
+		Return().Sym("out"),
+		Mov.Reg(R0, R5).Sym("fn"),
+		Return(),
+	}
+
+	if err := valid.Check(); err != nil {
+		t.Fatal("Valid program fails check:", err)
+	}
+
+	for name, test := range map[string]struct {
+		insns Instructions
+		index int
+		msg   string
+	}{
+		"uninitialized register": {
+			Instructions{
+				Mov.Reg(R0, R2),
+				Return(),
+			}, 0, "r2 is read before",
+		},
+		"uninitialized return value": {
+			Instructions{
+				Return(),
+			}, 0, "r0 is read before",
+		},
+		"clobbered by call": {
+			Instructions{
+				Mov.Imm(R2, 0),
+				FnKtimeGetNs.Call(),
+				Mov.Reg(R0, R2),
+				Return(),
+			}, 2, "r2 is read before",
+		},
+		"stack underflow": {
+			Instructions{
+				StoreImm(RFP, -StackSize-8, 0, DWord),
+				Mov.Imm(R0, 0),
+				Return(),
+			}, 0, "outside of the 512 byte stack",
+		},
+		"stack overflow": {
+			Instructions{
+				LoadMem(R0, RFP, -2, Word),
+				Return(),
+			}, 0, "outside of the 512 byte stack",
+		},
+		"write to frame pointer": {
+			Instructions{
+				Add.Imm(RFP, 8),
+				Mov.Imm(R0, 0),
+				Return(),
+			}, 0, "frame pointer is read-only",
+		},
+		"jump outside of program": {
+			Instructions{
+				Mov.Imm(R0, 0),
+				{OpCode: JEq.Op(ImmSource), Dst: R0, Offset: 5},
+				Return(),
+			}, 1, "outside of the program",
+		},
+		"missing label": {
+			Instructions{
+				Mov.Imm(R0, 0),
+				Ja.Label("nowhere"),
+				Return(),
+			}, 1, "missing label",
+		},
+		"fall through": {
+			Instructions{
+				Mov.Imm(R0, 0),
+			}, 0, "continues past the last instruction",
+		},
+		"no exit": {
+			Instructions{
+				Mov.Imm(R0, 0).Sym("loop"),
+				Ja.Label("loop"),
+			}, 0, "never exits",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := test.insns.Check()
+			if err == nil {
+				t.Fatal("Check doesn't return an error")
+			}
+
+			var diags Diagnostics
+			if !errors.As(err, &diags) {
+				t.Fatal("Error is not Diagnostics:", err)
+			}
+
+			for _, diag := range diags {
+				if diag.Index == test.index && strings.Contains(diag.Message, test.msg) {
+					return
+				}
+			}
+			t.Errorf("Expected %q at instruction %d, got:\n%s", test.msg, test.index, diags)
+		})
+	}
+}
+
+func TestCheckMaybeInitialized(t *testing.T) {
+	// R2 is only initialized on one path. This is accepted since the
+	// other path may be infeasible.
+	insns := Instructions{
+		Mov.Imm(R0, 0),
+		JEq.Imm(R1, 0, "skip"),
+		Mov.Imm(R2, 1),
+		JEq.Imm(R2, 0, "out").Sym("skip"),
+		Mov.Reg(R0, R2),
+		Return().Sym("out"),
+	}
+
+	if err := insns.Check(); err != nil {
+		t.Fatal(err)
+	}
+}
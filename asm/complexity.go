@@ -0,0 +1,154 @@
+package asm
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// MaxBPFInstructions is the maximum size of a program in raw
+	// instructions on kernels before 5.2, and for unprivileged users.
+	MaxBPFInstructions = 4096
+	// MaxVerifiedInstructions is the maximum number of instructions the
+	// verifier processes before giving up, as of 5.2.
+	MaxVerifiedInstructions = 1000000
+)
+
+// Complexity is an estimate of the effort required to verify a program.
+type Complexity struct {
+	// Size of the program in raw instructions.
+	Instructions int
+	// Number of conditional jumps.
+	Branches int
+	// Number of instructions the verifier processes if it explores every
+	// path through the program. Calls to functions are counted once per
+	// call site.
+	//
+	// This is an upper bound: the verifier prunes paths which reach
+	// a state it has seen before, which usually makes the real number
+	// much smaller.
+	VerifiedInstructions uint64
+	// True if the program contains loops. Only a single iteration of each
+	// loop is counted.
+	Loops bool
+}
+
+// Warnings returns a description of each limit the program is close to
+// exceeding.
+func (c Complexity) Warnings() []string {
+	const threshold = 0.9
+
+	var warnings []string
+	if float64(c.Instructions) >= threshold*MaxBPFInstructions {
+		warnings = append(warnings, fmt.Sprintf("%d instructions is close to the limit of %d on older kernels", c.Instructions, MaxBPFInstructions))
+	}
+	if float64(c.VerifiedInstructions) >= threshold*MaxVerifiedInstructions {
+		warnings = append(warnings, fmt.Sprintf("up to %d verified instructions is close to the limit of %d", c.VerifiedInstructions, MaxVerifiedInstructions))
+	}
+	return warnings
+}
+
+func (c Complexity) String() string {
+	return fmt.Sprintf("%d instructions, %d branches, up to %d verified instructions", c.Instructions, c.Branches, c.VerifiedInstructions)
+}
+
+// Complexity estimates how hard it is for the verifier to check a program.
+//
+// Jumps to labels are resolved as if the program was marshaled.
+func (insns Instructions) Complexity() (Complexity, error) {
+	cfg, err := insns.ControlFlowGraph()
+	if err != nil {
+		return Complexity{}, err
+	}
+
+	resolved, err := insns.resolveJumps()
+	if err != nil {
+		return Complexity{}, err
+	}
+
+	targets, err := resolved.branchTargets()
+	if err != nil {
+		return Complexity{}, err
+	}
+
+	c := Complexity{Instructions: resolved.rawSize()}
+	for _, ins := range resolved {
+		op := ins.OpCode
+		if op.Class() == JumpClass && op.JumpOp() != Ja && op.JumpOp() != Call && op.JumpOp() != Exit {
+			c.Branches++
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+
+	var (
+		state = make([]int, len(cfg.Blocks))
+		cost  = make([]uint64, len(cfg.Blocks))
+		visit func(id int) error
+	)
+	visit = func(id int) error {
+		state[id] = visiting
+		bb := cfg.Blocks[id]
+
+		total := uint64(bb.Instructions.rawSize())
+		for i, ins := range bb.Instructions {
+			target, ok := targets[bb.Start+i]
+			if !ok || !ins.IsFunctionCall() {
+				continue
+			}
+
+			callee := cfg.Block(target).ID
+			switch state[callee] {
+			case unvisited:
+				if err := visit(callee); err != nil {
+					return err
+				}
+			case visiting:
+				return fmt.Errorf("instruction %d: recursive call", bb.Start+i)
+			}
+			total = saturatingAdd(total, cost[callee])
+		}
+
+		for _, succ := range bb.Successors {
+			if cfg.Dominates(succ, id) {
+				// Back edges are part of a loop.
+				c.Loops = true
+				continue
+			}
+
+			switch state[succ] {
+			case unvisited:
+				if err := visit(succ); err != nil {
+					return err
+				}
+			case visiting:
+				// An irreducible loop.
+				c.Loops = true
+				continue
+			}
+			total = saturatingAdd(total, cost[succ])
+		}
+
+		cost[id] = total
+		state[id] = done
+		return nil
+	}
+
+	if err := visit(cfg.Entries[0]); err != nil {
+		return Complexity{}, err
+	}
+
+	c.VerifiedInstructions = cost[cfg.Entries[0]]
+	return c, nil
+}
+
+func saturatingAdd(a, b uint64) uint64 {
+	if a > math.MaxUint64-b {
+		return math.MaxUint64
+	}
+	return a + b
+}
@@ -0,0 +1,97 @@
+package asm
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestComplexity(t *testing.T) {
+	insns := Instructions{
+		Mov.Imm(R0, 0),
+		JEq.Imm(R1, 0, "else"),
+		Call.Label("fn"),
+		Ja.Label("out"),
+		Call.Label("fn").Sym("else"),
+		Return().Sym("out"),
+		LoadImm(R0, 1, DWord).Sym("fn"),
+		Return(),
+	}
+
+	c, err := insns.Complexity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Instructions != 9 {
+		t.Error("Expected 9 instructions, got", c.Instructions)
+	}
+
+	if c.Branches != 1 {
+		t.Error("Expected 1 branch, got", c.Branches)
+	}
+
+	// Both branches share the exit and call fn, which is three instructions.
+	// 2 + (2 + 3 + 1) + (1 + 3 + 1)
+	if c.VerifiedInstructions != 13 {
+		t.Error("Expected 13 verified instructions, got", c.VerifiedInstructions)
+	}
+
+	if c.Loops {
+		t.Error("Program doesn't contain loops")
+	}
+
+	if w := c.Warnings(); len(w) != 0 {
+		t.Error("Unexpected warnings:", w)
+	}
+}
+
+func TestComplexityLoop(t *testing.T) {
+	insns := Instructions{
+		Mov.Imm(R0, 0),
+		Add.Imm(R0, 1).Sym("loop"),
+		JLT.Imm(R0, 10, "loop"),
+		Return(),
+	}
+
+	c, err := insns.Complexity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !c.Loops {
+		t.Error("Loop isn't detected")
+	}
+
+	if c.VerifiedInstructions != 4 {
+		t.Error("Expected 4 verified instructions, got", c.VerifiedInstructions)
+	}
+}
+
+func TestComplexityExponential(t *testing.T) {
+	var insns Instructions
+	for i := 0; i < 20; i++ {
+		label := fmt.Sprint("next", i)
+		insns = append(insns,
+			JEq.Imm(R1, int32(i), label),
+			Mov.Imm(R0, 0),
+			Mov.Imm(R2, 0).Sym(label),
+		)
+	}
+	insns = append(insns, Return())
+
+	c, err := insns.Complexity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.Warnings()) != 1 {
+		t.Error("Expected a warning about verified instructions, got", c.Warnings())
+	}
+}
+
+func TestComplexityWarnings(t *testing.T) {
+	c := Complexity{Instructions: MaxBPFInstructions}
+	if len(c.Warnings()) != 1 {
+		t.Error("Expected a warning about program size, got", c.Warnings())
+	}
+}
@@ -0,0 +1,377 @@
+package asm
+
+import (
+	"fmt"
+	"math"
+)
+
+type branchDecision uint8
+
+const (
+	branchUnknown branchDecision = iota
+	branchTaken
+	branchNotTaken
+)
+
+// EliminateDeadCode returns a copy of insns without unreachable instructions.
+//
+// Conditional jumps which compare a register to an immediate are decided
+// if the register is known to hold a constant, for example after calling
+// RewriteConstant. Jumps which are always taken are turned into unconditional
+// jumps, jumps which are never taken are removed.
+//
+// The first instruction is the entry point of the program. Functions are
+// only retained if they are the target of a reachable bpf to bpf call.
+// Calls to symbols which aren't part of insns are left untouched.
+func (insns Instructions) EliminateDeadCode() (Instructions, error) {
+	if len(insns) == 0 {
+		return nil, nil
+	}
+
+	resolved, err := insns.resolveJumps()
+	if err != nil {
+		return nil, err
+	}
+
+	targets, err := resolved.branchTargets()
+	if err != nil {
+		return nil, err
+	}
+
+	decisions, err := resolved.decideBranches(targets)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find all reachable instructions, starting from the entry point.
+	reachable := make([]bool, len(resolved))
+	pending := []int{0}
+	for len(pending) > 0 {
+		i := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if i >= len(resolved) {
+			return nil, fmt.Errorf("instruction %d: execution continues past the last instruction", i-1)
+		}
+
+		if reachable[i] {
+			continue
+		}
+		reachable[i] = true
+
+		ins := resolved[i]
+		if ins.OpCode.Class() != JumpClass {
+			pending = append(pending, i+1)
+			continue
+		}
+
+		target, hasTarget := targets[i]
+		switch op := ins.OpCode.JumpOp(); {
+		case op == Exit:
+		case op == Ja:
+			pending = append(pending, target)
+		case op == Call:
+			pending = append(pending, i+1)
+			if hasTarget {
+				pending = append(pending, target)
+			}
+		case decisions[i] == branchTaken:
+			pending = append(pending, target)
+		case decisions[i] == branchNotTaken:
+			pending = append(pending, i+1)
+		default:
+			pending = append(pending, i+1, target)
+		}
+	}
+
+	// Don't modify the caller's instructions.
+	resolved = append(Instructions(nil), resolved...)
+
+	keep := make([]bool, len(resolved))
+	for i := range resolved {
+		keep[i] = reachable[i] && decisions[i] != branchNotTaken
+
+		if !reachable[i] {
+			// Symbols of dead code are dropped.
+			resolved[i].Symbol = ""
+		}
+
+		if decisions[i] == branchTaken {
+			ins := &resolved[i]
+			ins.OpCode = Ja.Op(ImmSource)
+			ins.Dst, ins.Src, ins.Constant = R0, R0, 0
+		}
+	}
+
+	return resolved.compact(targets, keep)
+}
+
+// compact removes all instructions which aren't marked in keep and fixes up
+// the offsets of the remaining jumps and calls.
+//
+// Branches to a removed instruction continue at the next retained one, which
+// also inherits the symbol of the removed instruction.
+func (insns Instructions) compact(targets map[int]int, keep []bool) (Instructions, error) {
+	// next maps an instruction to the index of the first retained instruction
+	// at or after it in the output.
+	next := make([]int, len(insns)+1)
+	n := 0
+	for _, k := range keep {
+		if k {
+			n++
+		}
+	}
+	next[len(insns)] = n
+	for i := len(insns) - 1; i >= 0; i-- {
+		next[i] = next[i+1]
+		if keep[i] {
+			next[i]--
+		}
+	}
+
+	out := make(Instructions, 0, n)
+	var symbol string
+	for i, ins := range insns {
+		if !keep[i] {
+			if ins.Symbol != "" {
+				if symbol != "" {
+					return nil, fmt.Errorf("instruction %d: can't merge symbols %s and %s", i, symbol, ins.Symbol)
+				}
+				symbol = ins.Symbol
+			}
+			continue
+		}
+
+		if symbol != "" {
+			if ins.Symbol != "" {
+				return nil, fmt.Errorf("instruction %d: can't merge symbols %s and %s", i, symbol, ins.Symbol)
+			}
+			ins.Symbol = symbol
+			symbol = ""
+		}
+
+		out = append(out, ins)
+	}
+
+	if symbol != "" {
+		return nil, fmt.Errorf("symbol %s: no instruction left to attach to", symbol)
+	}
+
+	offsets := out.rawOffsets()
+	for i, ins := range insns {
+		target, ok := targets[i]
+		if !keep[i] || !ok {
+			continue
+		}
+
+		j := next[i]
+		if next[target] >= len(out) {
+			return nil, fmt.Errorf("instruction %d: branch target was removed", i)
+		}
+		delta := int64(offsets[next[target]]) - int64(offsets[j]) - 1
+
+		if ins.IsFunctionCall() {
+			if ins.Constant == -1 && ins.Reference != "" {
+				// Calls by name are resolved at load time.
+				continue
+			}
+			out[j].Constant = delta
+			continue
+		}
+
+		if delta < math.MinInt16 || delta > math.MaxInt16 {
+			return nil, fmt.Errorf("instruction %d: jump offset %d out of range", i, delta)
+		}
+		out[j].Offset = int16(delta)
+	}
+
+	return out, nil
+}
+
+// rawOffsets returns the offset of each instruction in raw instructions.
+func (insns Instructions) rawOffsets() []RawInstructionOffset {
+	offsets := make([]RawInstructionOffset, 0, len(insns))
+	iter := insns.Iterate()
+	for iter.Next() {
+		offsets = append(offsets, iter.Offset)
+	}
+	return offsets
+}
+
+// branchTargets returns the index of the target of each jump and
+// bpf to bpf call.
+//
+// Jumps to labels must be resolved before calling this function. Calls to
+// symbols which aren't part of insns don't have a target.
+func (insns Instructions) branchTargets() (map[int]int, error) {
+	offsets := insns.rawOffsets()
+	indices := make(map[RawInstructionOffset]int, len(insns))
+	symbols := make(map[string]int)
+	for i, offset := range offsets {
+		indices[offset] = i
+		if sym := insns[i].Symbol; sym != "" {
+			symbols[sym] = i
+		}
+	}
+
+	targets := make(map[int]int)
+	for i, ins := range insns {
+		if ins.OpCode.Class() != JumpClass {
+			continue
+		}
+
+		var delta int64
+		switch ins.OpCode.JumpOp() {
+		case Exit:
+			continue
+
+		case Call:
+			if !ins.IsFunctionCall() {
+				continue
+			}
+
+			if ins.Constant == -1 && ins.Reference != "" {
+				if target, ok := symbols[ins.Reference]; ok {
+					targets[i] = target
+				}
+				continue
+			}
+
+			delta = ins.Constant
+
+		default:
+			delta = int64(ins.Offset)
+		}
+
+		target, ok := indices[RawInstructionOffset(int64(offsets[i])+delta+1)]
+		if !ok || int64(offsets[i])+delta+1 < 0 {
+			return nil, fmt.Errorf("instruction %d: invalid branch offset %d", i, delta)
+		}
+		targets[i] = target
+	}
+
+	return targets, nil
+}
+
+// decideBranches figures out which conditional jumps compare a constant
+// to an immediate.
+//
+// Registers are only tracked within basic blocks.
+func (insns Instructions) decideBranches(targets map[int]int) ([]branchDecision, error) {
+	isTarget := make(map[int]bool, len(targets))
+	for _, target := range targets {
+		isTarget[target] = true
+	}
+
+	decisions := make([]branchDecision, len(insns))
+	known := make(map[Register]uint64)
+	clobberCallerSaved := func() {
+		for r := R0; r <= R5; r++ {
+			delete(known, r)
+		}
+	}
+
+	for i, ins := range insns {
+		if isTarget[i] {
+			known = make(map[Register]uint64)
+		}
+
+		op := ins.OpCode
+		switch op.Class() {
+		case LdClass:
+			if op.isDWordLoad() && ins.Src == R0 {
+				known[ins.Dst] = uint64(ins.Constant)
+			} else if op.isDWordLoad() {
+				delete(known, ins.Dst)
+			} else {
+				// Legacy packet access clobbers caller saved registers.
+				clobberCallerSaved()
+			}
+
+		case LdXClass:
+			delete(known, ins.Dst)
+
+		case ALUClass, ALU64Class:
+			value, ok := ins.Constant, op.Source() == ImmSource
+			if !ok {
+				var v uint64
+				v, ok = known[ins.Src]
+				value = int64(v)
+			}
+
+			if op.ALUOp() != Mov || !ok {
+				delete(known, ins.Dst)
+				break
+			}
+
+			if op.Class() == ALUClass {
+				known[ins.Dst] = uint64(uint32(value))
+			} else {
+				known[ins.Dst] = uint64(value)
+			}
+
+		case JumpClass:
+			switch jop := op.JumpOp(); jop {
+			case Call:
+				clobberCallerSaved()
+
+			case Exit, Ja:
+				known = make(map[Register]uint64)
+
+			default:
+				if op.Source() != ImmSource {
+					break
+				}
+
+				value, ok := known[ins.Dst]
+				if !ok {
+					break
+				}
+
+				taken, err := jop.eval(value, ins.Constant)
+				if err != nil {
+					return nil, fmt.Errorf("instruction %d: %w", i, err)
+				}
+
+				if taken {
+					decisions[i] = branchTaken
+				} else {
+					decisions[i] = branchNotTaken
+				}
+			}
+		}
+	}
+
+	return decisions, nil
+}
+
+// eval returns true if a conditional jump comparing dst to imm is taken.
+func (op JumpOp) eval(dst uint64, imm int64) (bool, error) {
+	src := uint64(imm)
+	switch op {
+	case JEq:
+		return dst == src, nil
+	case JNE:
+		return dst != src, nil
+	case JGT:
+		return dst > src, nil
+	case JGE:
+		return dst >= src, nil
+	case JLT:
+		return dst < src, nil
+	case JLE:
+		return dst <= src, nil
+	case JSet:
+		return dst&src != 0, nil
+	case JSGT:
+		return int64(dst) > imm, nil
+	case JSGE:
+		return int64(dst) >= imm, nil
+	case JSLT:
+		return int64(dst) < imm, nil
+	case JSLE:
+		return int64(dst) <= imm, nil
+	default:
+		return false, fmt.Errorf("can't evaluate %v", op)
+	}
+}
@@ -0,0 +1,122 @@
+package asm
+
+import (
+	"testing"
+)
+
+func TestEliminateDeadCode(t *testing.T) {
+	program := func() Instructions {
+		insns := Instructions{
+			LoadImm(R1, 0, DWord),
+			JEq.Imm(R1, 0, "skip"),
+			FnKtimeGetNs.Call(),
+			Mov.Imm(R0, 1),
+			Return(),
+			Mov.Imm(R0, 0).Sym("skip"),
+			Return(),
+		}
+		insns[0].Reference = "CONST"
+		return insns
+	}
+
+	t.Run("taken", func(t *testing.T) {
+		insns := program()
+		if err := insns.RewriteConstant("CONST", 0); err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := insns.EliminateDeadCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(out) != 4 {
+			t.Fatalf("Expected 4 instructions, got\n%v", out)
+		}
+		if out[1].OpCode.JumpOp() != Ja || out[1].Offset != 0 {
+			t.Errorf("Expected unconditional jump to next instruction, got %v", out[1])
+		}
+		if out[2].Symbol != "skip" {
+			t.Error("Jump target lost its symbol")
+		}
+	})
+
+	t.Run("not taken", func(t *testing.T) {
+		insns := program()
+		if err := insns.RewriteConstant("CONST", 1); err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := insns.EliminateDeadCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(out) != 4 {
+			t.Fatalf("Expected 4 instructions, got\n%v", out)
+		}
+		if out[1].OpCode.JumpOp() != Call {
+			t.Error("Expected call after removed jump, got", out[1])
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		insns := program()
+		insns[0].OpCode = LoadMemOp(DWord)
+
+		out, err := insns.EliminateDeadCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(out) != len(insns) {
+			t.Errorf("Removed instructions although jump isn't decided:\n%v", out)
+		}
+	})
+
+	t.Run("invalid jump", func(t *testing.T) {
+		insns := Instructions{
+			Mov.Imm(R0, 0),
+			{OpCode: OpCode(JumpClass).SetJumpOp(0xe0).SetSource(ImmSource), Dst: R0},
+			Return(),
+		}
+
+		if _, err := insns.EliminateDeadCode(); err == nil {
+			t.Error("No error for invalid jump")
+		}
+	})
+}
+
+func TestEliminateDeadCodeFunctions(t *testing.T) {
+	insns := Instructions{
+		Call.Label("used"),
+		Return(),
+		Mov.Imm(R0, 1).Sym("unused"),
+		Return(),
+		Mov.Imm(R0, 2).Sym("used"),
+		Ja.Label("out"),
+		Mov.Imm(R0, 3),
+		Return().Sym("out"),
+	}
+
+	out, err := insns.EliminateDeadCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out) != 5 {
+		t.Fatalf("Expected 5 instructions, got\n%v", out)
+	}
+
+	if out[2].Symbol != "used" {
+		t.Error("Expected used function to follow main program, got", out[2])
+	}
+
+	if out[3].Offset != 0 {
+		t.Error("Jump offset wasn't adjusted:", out[3])
+	}
+
+	if out[0].Constant != -1 {
+		t.Error("Call by label was modified:", out[0])
+	}
+}
@@ -0,0 +1,75 @@
+package asm
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Dot writes the control flow graph of the program in the Graphviz DOT
+// format to w.
+//
+// Each basic block is rendered as a node listing its instructions. Edges
+// of conditional jumps are labelled with the outcome of the comparison.
+//
+//    dot -Tsvg -o prog.svg < prog.dot
+func (insns Instructions) Dot(w io.Writer) error {
+	cfg, err := insns.ControlFlowGraph()
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	b.WriteString("digraph program {\n")
+	b.WriteString("\tnode [shape=box fontname=monospace];\n")
+
+	for _, bb := range cfg.Blocks {
+		var label strings.Builder
+		iter := bb.Instructions.Iterate()
+		for iter.Next() {
+			ins := iter.Ins
+			if ins.Symbol != "" {
+				fmt.Fprintf(&label, "%s:\\l", dotEscape(ins.Symbol))
+			}
+			fmt.Fprintf(&label, "  %d: %s\\l", bb.Start+iter.Index, dotEscape(fmt.Sprint(*ins)))
+		}
+
+		attrs := ""
+		if cfg.isEntry(bb.ID) {
+			attrs = " style=bold"
+		} else if !cfg.Reachable(bb.ID) {
+			attrs = " style=dashed"
+		}
+
+		fmt.Fprintf(&b, "\tb%d [label=\"%s\"%s];\n", bb.ID, label.String(), attrs)
+	}
+
+	for _, bb := range cfg.Blocks {
+		last := bb.Instructions[len(bb.Instructions)-1]
+		conditional := last.OpCode.Class() == JumpClass && len(bb.Successors) == 2
+
+		for _, succ := range bb.Successors {
+			if !conditional {
+				fmt.Fprintf(&b, "\tb%d -> b%d;\n", bb.ID, succ)
+				continue
+			}
+
+			label := "false"
+			if succ != bb.ID+1 {
+				label = "true"
+			}
+			fmt.Fprintf(&b, "\tb%d -> b%d [label=%s];\n", bb.ID, succ, label)
+		}
+	}
+
+	b.WriteString("}\n")
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func dotEscape(s string) string {
+	return dotEscaper.Replace(s)
+}
@@ -0,0 +1,34 @@
+package asm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInstructionsDot(t *testing.T) {
+	insns := Instructions{
+		JEq.Imm(R1, 0, "out"),
+		Mov.Imm(R0, 1),
+		Return().Sym("out"),
+	}
+
+	var b strings.Builder
+	if err := insns.Dot(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	dot := b.String()
+	t.Log(dot)
+
+	for _, want := range []string{
+		"digraph program {",
+		"b0 -> b2 [label=true];",
+		"b0 -> b1 [label=false];",
+		"b1 -> b2;",
+		"out:\\l",
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("Output doesn't contain %q", want)
+		}
+	}
+}
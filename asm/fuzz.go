@@ -0,0 +1,43 @@
+package asm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// roundTrip decodes data as bytecode and checks that encoding and
+// formatting the result is consistent. It's shared by the fuzzers for
+// go-fuzz and testing.F.
+//
+// Returns false if data isn't valid bytecode, and an error if the
+// instructions don't survive a round trip.
+func roundTrip(data []byte, bo binary.ByteOrder) (bool, error) {
+	var insns Instructions
+	if err := insns.Unmarshal(bytes.NewReader(data), bo); err != nil {
+		return false, nil
+	}
+
+	encoded, err := insns.AppendMarshal(nil, bo)
+	if err != nil {
+		return true, fmt.Errorf("can't encode decoded instructions: %w", err)
+	}
+	if !bytes.Equal(encoded, data) {
+		return true, fmt.Errorf("encoding doesn't match input:\n%x\n%x", data, encoded)
+	}
+
+	// Distinct opcodes must be formatted differently, otherwise the
+	// output of String is ambiguous.
+	opcodes := make(map[string]OpCode)
+	for _, ins := range insns {
+		_ = fmt.Sprint(ins)
+
+		str := ins.OpCode.String()
+		if other, ok := opcodes[str]; ok && other != ins.OpCode {
+			return true, fmt.Errorf("opcodes %#x and %#x are both formatted as %s", uint8(other), uint8(ins.OpCode), str)
+		}
+		opcodes[str] = ins.OpCode
+	}
+
+	return true, nil
+}
@@ -0,0 +1,32 @@
+// +build go1.18
+
+package asm
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func FuzzRoundTrip(f *testing.F) {
+	for _, insns := range []Instructions{
+		{Mov.Imm(R0, 0), Return()},
+		{LoadImm(R1, 0x1122334455667788, DWord), Mod.Imm(R1, 3), JSLE.Reg(R1, R2, "")},
+		{HostTo(BE, R0, Word), LoadMem(R0, R1, 4, Half), FnMapLookupElem.Call()},
+	} {
+		for _, bo := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			buf, err := insns.AppendMarshal(nil, bo)
+			if err != nil {
+				f.Fatal(err)
+			}
+			f.Add(buf)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, bo := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			if _, err := roundTrip(data, bo); err != nil {
+				t.Fatalf("%s: %s", bo, err)
+			}
+		}
+	})
+}
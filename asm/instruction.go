@@ -1,6 +1,7 @@
 package asm
 
 import (
+	"bytes"
 	"crypto/sha1"
 	"encoding/binary"
 	"encoding/hex"
@@ -10,6 +11,7 @@ import (
 	"math"
 	"strings"
 
+	"github.com/cilium/ebpf/internal"
 	"github.com/cilium/ebpf/internal/unix"
 )
 
@@ -49,6 +51,11 @@ func (ins *Instruction) Unmarshal(r io.Reader, bo binary.ByteOrder) (uint64, err
 		return 0, err
 	}
 
+	if bi.OpCode == InvalidOpCode {
+		// InvalidOpCode can't be encoded again.
+		return 0, errors.New("invalid opcode")
+	}
+
 	ins.OpCode = bi.OpCode
 	ins.Offset = bi.Offset
 	ins.Constant = int64(bi.Constant)
@@ -76,6 +83,24 @@ func (ins *Instruction) Unmarshal(r io.Reader, bo binary.ByteOrder) (uint64, err
 
 // Marshal encodes a BPF instruction.
 func (ins Instruction) Marshal(w io.Writer, bo binary.ByteOrder) (uint64, error) {
+	var buf [2 * InstructionSize]byte
+	n, err := ins.encode(buf[:], bo)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := w.Write(buf[:n]); err != nil {
+		return 0, err
+	}
+
+	return uint64(n), nil
+}
+
+// encode writes the instruction into buf, which must have room for
+// two raw instructions if the instruction is a 64 bit load.
+//
+// Returns the number of bytes written.
+func (ins Instruction) encode(buf []byte, bo binary.ByteOrder) (int, error) {
 	if ins.OpCode == InvalidOpCode {
 		return 0, errors.New("invalid opcode")
 	}
@@ -93,28 +118,18 @@ func (ins Instruction) Marshal(w io.Writer, bo binary.ByteOrder) (uint64, error)
 		return 0, fmt.Errorf("can't marshal registers: %s", err)
 	}
 
-	bpfi := bpfInstruction{
-		ins.OpCode,
-		regs,
-		ins.Offset,
-		cons,
-	}
-
-	if err := binary.Write(w, bo, &bpfi); err != nil {
-		return 0, err
-	}
+	buf[0] = byte(ins.OpCode)
+	buf[1] = byte(regs)
+	bo.PutUint16(buf[2:], uint16(ins.Offset))
+	bo.PutUint32(buf[4:], uint32(cons))
 
 	if !isDWordLoad {
 		return InstructionSize, nil
 	}
 
-	bpfi = bpfInstruction{
-		Constant: int32(ins.Constant >> 32),
-	}
-
-	if err := binary.Write(w, bo, &bpfi); err != nil {
-		return 0, err
-	}
+	second := buf[InstructionSize : 2*InstructionSize]
+	second[0], second[1], second[2], second[3] = 0, 0, 0, 0
+	bo.PutUint32(second[4:], uint32(ins.Constant>>32))
 
 	return 2 * InstructionSize, nil
 }
@@ -224,6 +239,8 @@ func (ins Instruction) Format(f fmt.State, c rune) {
 			fmt.Fprintf(f, "dst: %s src: %s off: %d imm: %d", ins.Dst, ins.Src, ins.Offset, ins.Constant)
 		case XAddMode:
 			fmt.Fprintf(f, "dst: %s src: %s", ins.Dst, ins.Src)
+		default:
+			fmt.Fprintf(f, "dst: %s src: %s off: %d imm: %d", ins.Dst, ins.Src, ins.Offset, ins.Constant)
 		}
 
 	case ALU64Class, ALUClass:
@@ -296,6 +313,52 @@ func (insns Instructions) RewriteMapPtr(symbol string, fd int) error {
 	return nil
 }
 
+// RewriteConstant rewrites all loads of a symbol to a constant value.
+//
+// This is a way to parameterize clang-compiled eBPF byte code at load
+// time. The constant must be accessed using a 64bit immediate load, for
+// example via the following macro:
+//
+//    #define LOAD_CONSTANT(param, var) asm("%0 = " param " ll" : "=r"(var))
+//
+//    int xdp() {
+//        bool my_constant;
+//        LOAD_CONSTANT("SYMBOL_NAME", my_constant);
+//
+//        if (my_constant) ...
+//
+// The symbol name you pick must be unique. Instructions are modified in
+// place and keep their reference to the symbol.
+//
+// Returns an error if an instruction referencing the symbol isn't a 64bit
+// immediate load, or if the symbol isn't used, see IsUnreferencedSymbol.
+func (insns Instructions) RewriteConstant(symbol string, value uint64) error {
+	if symbol == "" {
+		return errors.New("empty symbol")
+	}
+
+	found := false
+	for i := range insns {
+		ins := &insns[i]
+		if ins.Reference != symbol {
+			continue
+		}
+
+		if !ins.OpCode.isDWordLoad() || ins.Src != R0 {
+			return fmt.Errorf("symbol %s: instruction %d is not a load of a 64bit immediate", symbol, i)
+		}
+
+		ins.Constant = int64(value)
+		found = true
+	}
+
+	if !found {
+		return &unreferencedSymbolError{symbol}
+	}
+
+	return nil
+}
+
 // SymbolOffsets returns the set of symbols and their offset in
 // the instructions.
 func (insns Instructions) SymbolOffsets() (map[string]int, error) {
@@ -384,14 +447,198 @@ func (insns Instructions) Format(f fmt.State, c rune) {
 	}
 }
 
+// UnmarshalInstructions decodes a BPF program in the kernel format.
+//
+// It is the inverse of Instructions.Marshal.
+func UnmarshalInstructions(buf []byte, bo binary.ByteOrder) (Instructions, error) {
+	if len(buf)%InstructionSize != 0 {
+		return nil, fmt.Errorf("program length %d is not a multiple of %d", len(buf), InstructionSize)
+	}
+
+	var insns Instructions
+	if err := insns.Unmarshal(bytes.NewReader(buf), bo); err != nil {
+		return nil, err
+	}
+	return insns, nil
+}
+
+// Unmarshal decodes instructions from r until it returns io.EOF, appending
+// them to insns.
+func (insns *Instructions) Unmarshal(r io.Reader, bo binary.ByteOrder) error {
+	var offset uint64
+	for {
+		var ins Instruction
+		n, err := ins.Unmarshal(r, bo)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("offset %d: %w", offset, err)
+		}
+
+		*insns = append(*insns, ins)
+		offset += n
+	}
+}
+
 // Marshal encodes a BPF program into the kernel format.
+//
+// Jumps created with a label, which have an Offset of -1, are resolved
+// to the instruction with the matching Symbol. Returns an error if the
+// symbol is missing or too far away.
 func (insns Instructions) Marshal(w io.Writer, bo binary.ByteOrder) error {
+	buf, err := insns.AppendMarshal(nil, bo)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(buf)
+	return err
+}
+
+// AppendMarshal encodes a BPF program into the kernel format and appends
+// it to buf.
+//
+// The program is encoded in place, growing buf at most once. This avoids
+// intermediate allocations when marshaling large programs.
+func (insns Instructions) AppendMarshal(buf []byte, bo binary.ByteOrder) ([]byte, error) {
+	insns, err := insns.resolveJumps()
+	if err != nil {
+		return nil, err
+	}
+
+	return insns.appendMarshal(buf, bo, false)
+}
+
+// Size returns the size of the program in bytes when encoded in the
+// kernel format.
+func (insns Instructions) Size() int {
+	var size int
+	for _, ins := range insns {
+		size += ins.OpCode.rawInstructions() * InstructionSize
+	}
+	return size
+}
+
+// appendMarshal encodes insns without resolving jumps.
+//
+// If clearMapPtrs is true, constants of map loads are zeroed as the
+// kernel does when calculating the tag of a program.
+func (insns Instructions) appendMarshal(buf []byte, bo binary.ByteOrder, clearMapPtrs bool) ([]byte, error) {
+	offset := len(buf)
+	size := insns.Size()
+	if cap(buf)-offset < size {
+		grown := make([]byte, offset, offset+size)
+		copy(grown, buf)
+		buf = grown
+	}
+	buf = buf[:offset+size]
+
 	for i, ins := range insns {
-		_, err := ins.Marshal(w, bo)
+		if clearMapPtrs && ins.isLoadFromMap() {
+			ins.Constant = 0
+		}
+
+		n, err := ins.encode(buf[offset:], bo)
 		if err != nil {
-			return fmt.Errorf("instruction %d: %w", i, err)
+			return nil, fmt.Errorf("instruction %d: %w", i, err)
+		}
+		offset += n
+	}
+
+	return buf, nil
+}
+
+// isJumpToLabel returns true if the instruction is a jump whose offset
+// hasn't been resolved yet.
+func (ins Instruction) isJumpToLabel() bool {
+	if ins.OpCode.Class() != JumpClass || ins.Offset != -1 || ins.Reference == "" {
+		return false
+	}
+
+	op := ins.OpCode.JumpOp()
+	return op != Call && op != Exit
+}
+
+// resolveJumps returns a copy of insns with offsets of all jumps to labels
+// filled in.
+//
+// insns is returned unmodified if there are no jumps to resolve.
+func (insns Instructions) resolveJumps() (Instructions, error) {
+	var needed bool
+	for _, ins := range insns {
+		if ins.isJumpToLabel() {
+			needed = true
+			break
+		}
+	}
+
+	if !needed {
+		return insns, nil
+	}
+
+	resolved := make(Instructions, len(insns))
+	copy(resolved, insns)
+
+	if err := resolved.resolveReferences(false); err != nil {
+		return nil, err
+	}
+
+	return resolved, nil
+}
+
+// ResolveReferences sets the offset of jumps to labels and the constant
+// of bpf to bpf calls to the instruction with the matching Symbol. Jumps
+// are recognised by an Offset of -1, calls by a Constant of -1.
+//
+// insns is modified in place.
+func (insns Instructions) ResolveReferences() error {
+	return insns.resolveReferences(true)
+}
+
+func (insns Instructions) resolveReferences(calls bool) error {
+	symbols := make(map[string]RawInstructionOffset)
+	iter := insns.Iterate()
+	for iter.Next() {
+		if iter.Ins.Symbol == "" {
+			continue
+		}
+
+		if _, ok := symbols[iter.Ins.Symbol]; ok {
+			return fmt.Errorf("duplicate symbol %s", iter.Ins.Symbol)
 		}
+
+		symbols[iter.Ins.Symbol] = iter.Offset
 	}
+
+	iter = insns.Iterate()
+	for iter.Next() {
+		ins := iter.Ins
+
+		switch {
+		case calls && ins.IsFunctionCall() && ins.Constant == -1:
+			target, ok := symbols[ins.Reference]
+			if !ok {
+				return fmt.Errorf("instruction %d: reference to missing symbol %q", iter.Index, ins.Reference)
+			}
+
+			ins.Constant = int64(target) - int64(iter.Offset) - 1
+
+		case ins.isJumpToLabel():
+			target, ok := symbols[ins.Reference]
+			if !ok {
+				return fmt.Errorf("instruction %d: reference to missing symbol %q", iter.Index, ins.Reference)
+			}
+
+			offset := int64(target) - int64(iter.Offset) - 1
+			if offset < math.MinInt16 || offset > math.MaxInt16 {
+				return fmt.Errorf("instruction %d: jump to %q out of range", iter.Index, ins.Reference)
+			}
+
+			ins.Offset = int16(offset)
+		}
+	}
+
 	return nil
 }
 
@@ -401,17 +648,18 @@ func (insns Instructions) Marshal(w io.Writer, bo binary.ByteOrder) error {
 // to ProgramInfo.Tag to figure out whether a loaded program matches
 // certain instructions.
 func (insns Instructions) Tag(bo binary.ByteOrder) (string, error) {
-	h := sha1.New()
-	for i, ins := range insns {
-		if ins.isLoadFromMap() {
-			ins.Constant = 0
-		}
-		_, err := ins.Marshal(h, bo)
-		if err != nil {
-			return "", fmt.Errorf("instruction %d: %w", i, err)
-		}
+	insns, err := insns.resolveJumps()
+	if err != nil {
+		return "", err
+	}
+
+	buf, err := insns.appendMarshal(nil, bo, true)
+	if err != nil {
+		return "", err
 	}
-	return hex.EncodeToString(h.Sum(nil)[:unix.BPF_TAG_SIZE]), nil
+
+	h := sha1.Sum(buf)
+	return hex.EncodeToString(h[:unix.BPF_TAG_SIZE]), nil
 }
 
 // Iterate allows iterating a BPF program while keeping track of
@@ -458,26 +706,24 @@ type bpfInstruction struct {
 
 type bpfRegisters uint8
 
+// newBPFRegisters encodes dst and src. The order of the nibbles depends on
+// the byte order, since the kernel declares them as bitfields.
 func newBPFRegisters(dst, src Register, bo binary.ByteOrder) (bpfRegisters, error) {
-	switch bo {
-	case binary.LittleEndian:
-		return bpfRegisters((src << 4) | (dst & 0xF)), nil
-	case binary.BigEndian:
-		return bpfRegisters((dst << 4) | (src & 0xF)), nil
-	default:
-		return 0, fmt.Errorf("unrecognized ByteOrder %T", bo)
+	if dst > 0xf || src > 0xf {
+		return 0, fmt.Errorf("registers %s and %s don't fit into four bits", dst, src)
+	}
+
+	if internal.IsLittleEndian(bo) {
+		return bpfRegisters((src << 4) | dst), nil
 	}
+	return bpfRegisters((dst << 4) | src), nil
 }
 
 func (r bpfRegisters) Unmarshal(bo binary.ByteOrder) (dst, src Register, err error) {
-	switch bo {
-	case binary.LittleEndian:
+	if internal.IsLittleEndian(bo) {
 		return Register(r & 0xF), Register(r >> 4), nil
-	case binary.BigEndian:
-		return Register(r >> 4), Register(r & 0xf), nil
-	default:
-		return 0, 0, fmt.Errorf("unrecognized ByteOrder %T", bo)
 	}
+	return Register(r >> 4), Register(r & 0xf), nil
 }
 
 type unreferencedSymbolError struct {
@@ -0,0 +1,18 @@
+// +build gofuzz
+
+// Use with https://github.com/dvyukov/go-fuzz
+
+package asm
+
+import "github.com/cilium/ebpf/internal"
+
+func FuzzInstructions(data []byte) int {
+	valid, err := roundTrip(data, internal.NativeEndian)
+	if err != nil {
+		panic(err)
+	}
+	if !valid {
+		return 0
+	}
+	return 1
+}
@@ -7,7 +7,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math"
+	"reflect"
 	"testing"
+
+	"github.com/cilium/ebpf/internal/testutils"
 )
 
 var test64bitImmProg = []byte{
@@ -27,7 +30,7 @@ func TestRead64bitImmediate(t *testing.T) {
 	}
 
 	if c := ins.Constant; c != math.MinInt32-1 {
-		t.Errorf("Expected immediate to be %v, got %v", math.MinInt32-1, c)
+		t.Errorf("Expected immediate to be %v, got %v", int64(math.MinInt32-1), c)
 	}
 }
 
@@ -212,6 +215,78 @@ func TestReadSrcDst(t *testing.T) {
 	}
 }
 
+func TestMarshalByteOrders(t *testing.T) {
+	insns := Instructions{
+		LoadImm(R1, math.MinInt32-1, DWord),
+		Mov.Reg(R0, R1),
+		Return(),
+	}
+
+	for _, bo := range []binary.ByteOrder{
+		binary.LittleEndian,
+		binary.BigEndian,
+	} {
+		t.Run(bo.String(), func(t *testing.T) {
+			var want, have bytes.Buffer
+			if err := insns.Marshal(&want, bo); err != nil {
+				t.Fatal(err)
+			}
+			if err := insns.Marshal(&have, testutils.WrappedByteOrder{ByteOrder: bo}); err != nil {
+				t.Fatal("Can't marshal with wrapped byte order:", err)
+			}
+			if !bytes.Equal(want.Bytes(), have.Bytes()) {
+				t.Errorf("Wrapped byte order changes encoding:\n%s", hex.Dump(have.Bytes()))
+			}
+
+			var decoded Instructions
+			if err := decoded.Unmarshal(bytes.NewReader(want.Bytes()), testutils.WrappedByteOrder{ByteOrder: bo}); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decoded, insns) {
+				t.Errorf("Round trip doesn't preserve instructions:\n%s", decoded)
+			}
+		})
+	}
+}
+
+func TestMarshalLoadImm64(t *testing.T) {
+	// The constant is split into the immediates of two instructions, low
+	// half first. Registers share a byte whose nibbles are swapped on big
+	// endian.
+	ins := LoadImm(R1, 0x1122334455667788, DWord)
+	for _, test := range []struct {
+		bo   binary.ByteOrder
+		want []byte
+	}{
+		{binary.LittleEndian, []byte{
+			0x18, 0x01, 0x00, 0x00, 0x88, 0x77, 0x66, 0x55,
+			0x00, 0x00, 0x00, 0x00, 0x44, 0x33, 0x22, 0x11,
+		}},
+		{binary.BigEndian, []byte{
+			0x18, 0x10, 0x00, 0x00, 0x55, 0x66, 0x77, 0x88,
+			0x00, 0x00, 0x00, 0x00, 0x11, 0x22, 0x33, 0x44,
+		}},
+	} {
+		t.Run(fmt.Sprint(test.bo), func(t *testing.T) {
+			var buf bytes.Buffer
+			if _, err := ins.Marshal(&buf, test.bo); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), test.want) {
+				t.Fatalf("Expected\n%sgot\n%s", hex.Dump(test.want), hex.Dump(buf.Bytes()))
+			}
+
+			var have Instruction
+			if _, err := have.Unmarshal(bytes.NewReader(test.want), test.bo); err != nil {
+				t.Fatal(err)
+			}
+			if have.Constant != ins.Constant || have.Dst != R1 || have.Src != R0 {
+				t.Errorf("Round trip returns %v", have)
+			}
+		})
+	}
+}
+
 func TestInstructionIterator(t *testing.T) {
 	insns := Instructions{
 		LoadImm(R0, 0, Word),
@@ -237,3 +312,212 @@ func TestInstructionIterator(t *testing.T) {
 		}
 	}
 }
+
+func TestInstructionsResolveJumps(t *testing.T) {
+	insns := Instructions{
+		JEq.Imm(R1, 0, "exit"),
+		LoadImm(R0, 1, DWord),
+		Ja.Label("exit"),
+		Mov.Imm(R0, 0).Sym("exit"),
+		Return(),
+	}
+
+	var buf bytes.Buffer
+	if err := insns.Marshal(&buf, binary.LittleEndian); err != nil {
+		t.Fatal("Can't marshal:", err)
+	}
+
+	decoded, err := UnmarshalInstructions(buf.Bytes(), binary.LittleEndian)
+	if err != nil {
+		t.Fatal("Can't unmarshal:", err)
+	}
+
+	// The double wide load counts as two raw instructions.
+	if off := decoded[0].Offset; off != 3 {
+		t.Errorf("Expected conditional jump offset 3, got %d", off)
+	}
+	if off := decoded[2].Offset; off != 0 {
+		t.Errorf("Expected unconditional jump offset 0, got %d", off)
+	}
+	if insns[0].Offset != -1 {
+		t.Error("Marshal modifies instructions")
+	}
+
+	insns = Instructions{
+		Ja.Label("missing"),
+		Return(),
+	}
+	if err := insns.Marshal(ioutil.Discard, binary.LittleEndian); err == nil {
+		t.Error("Marshal accepts jump to missing label")
+	}
+}
+
+func TestInstructionsResolveReferences(t *testing.T) {
+	insns := Instructions{
+		Call.Label("fn"),
+		JEq.Imm(R0, 0, "exit"),
+		LoadImm(R0, 1, DWord),
+		Return().Sym("exit"),
+		Mov.Imm(R0, 0).Sym("fn"),
+		Return(),
+	}
+
+	if err := insns.ResolveReferences(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c := insns[0].Constant; c != 4 {
+		t.Errorf("Expected call constant 4, got %d", c)
+	}
+	if off := insns[1].Offset; off != 2 {
+		t.Errorf("Expected jump offset 2, got %d", off)
+	}
+
+	insns = Instructions{
+		Call.Label("missing"),
+		Return(),
+	}
+	if err := insns.ResolveReferences(); err == nil {
+		t.Error("ResolveReferences accepts call to missing symbol")
+	}
+}
+
+func TestUnmarshalInstructions(t *testing.T) {
+	insns := Instructions{
+		LoadImm(R0, math.MaxInt64, DWord),
+		Mov.Imm(R1, -1),
+		StoreMem(RFP, -8, R1, Word),
+		Return(),
+	}
+
+	for _, bo := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		var buf bytes.Buffer
+		if err := insns.Marshal(&buf, bo); err != nil {
+			t.Fatal("Can't marshal:", err)
+		}
+
+		have, err := UnmarshalInstructions(buf.Bytes(), bo)
+		if err != nil {
+			t.Fatal("Can't unmarshal:", err)
+		}
+
+		if !reflect.DeepEqual(have, insns) {
+			t.Errorf("Round trip with %v doesn't match:\n%v", bo, have)
+		}
+
+		if _, err := UnmarshalInstructions(buf.Bytes()[:buf.Len()-1], bo); err == nil {
+			t.Error("Accepted truncated program")
+		}
+
+		if _, err := UnmarshalInstructions(buf.Bytes()[:InstructionSize], bo); err == nil {
+			t.Error("Accepted program with missing second half of 64bit immediate")
+		}
+	}
+}
+
+func TestOpCodeStringUnique(t *testing.T) {
+	seen := make(map[string]OpCode)
+	for i := 0; i < int(InvalidOpCode); i++ {
+		op := OpCode(i)
+		str := op.String()
+		if other, ok := seen[str]; ok {
+			t.Errorf("%#x and %#x are both formatted as %s", uint8(other), i, str)
+		}
+		seen[str] = op
+	}
+
+	for _, test := range []struct {
+		ins  Instruction
+		want string
+	}{
+		{Mod.Imm(R1, 3), "ModImm dst: r1 imm: 3"},
+		{JSLE.Reg(R1, R2, ""), "JSLEReg dst: r1 off: -1 src: r2"},
+	} {
+		if have := fmt.Sprint(test.ins); have != test.want {
+			t.Errorf("Expected %q, got %q", test.want, have)
+		}
+	}
+}
+
+func TestInstructionsRewriteConstant(t *testing.T) {
+	insns := Instructions{
+		LoadImm(R0, 0, DWord),
+		Return(),
+	}
+	insns[0].Reference = "MY_CONST"
+
+	if err := insns.RewriteConstant("MY_CONST", math.MaxUint64); err != nil {
+		t.Fatal(err)
+	}
+
+	if insns[0].Constant != -1 {
+		t.Error("Constant not rewritten, have", insns[0].Constant)
+	}
+
+	if err := insns.RewriteConstant("OTHER", 1); !IsUnreferencedSymbol(err) {
+		t.Error("Expected unreferenced symbol error, got", err)
+	}
+
+	insns[1].Reference = "NOT_A_LOAD"
+	if err := insns.RewriteConstant("NOT_A_LOAD", 1); err == nil {
+		t.Error("Rewrote constant of non-load instruction")
+	}
+}
+
+func TestInstructionsAppendMarshal(t *testing.T) {
+	insns := Instructions{
+		LoadImm(R0, math.MinInt32-1, DWord),
+		Mov.Imm(R1, 2).Sym("foo"),
+		Return(),
+	}
+
+	for _, bo := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		var want bytes.Buffer
+		for _, ins := range insns {
+			if _, err := ins.Marshal(&want, bo); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		prefix := []byte{1, 2, 3}
+		have, err := insns.AppendMarshal(prefix, bo)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(have[:len(prefix)], prefix) {
+			t.Errorf("%v: prefix was overwritten: %v", bo, have[:len(prefix)])
+		}
+		if !bytes.Equal(have[len(prefix):], want.Bytes()) {
+			t.Errorf("%v: output doesn't match Instruction.Marshal:\n%s", bo, hex.Dump(have[len(prefix):]))
+		}
+		if size := insns.Size(); size != want.Len() {
+			t.Errorf("%v: Size returns %d instead of %d", bo, size, want.Len())
+		}
+	}
+
+	if _, err := (Instructions{{OpCode: InvalidOpCode}}).AppendMarshal(nil, binary.LittleEndian); err == nil {
+		t.Error("Marshaling an invalid opcode doesn't return an error")
+	}
+}
+
+func BenchmarkInstructionsMarshal(b *testing.B) {
+	insns := make(Instructions, 0, 4096)
+	for len(insns) < cap(insns)-2 {
+		insns = append(insns,
+			LoadImm(R1, 42, DWord),
+			Add.Imm(R0, 1),
+			JEq.Imm(R0, 0, "exit"),
+		)
+	}
+	insns = append(insns, Return().Sym("exit"))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := insns.AppendMarshal(nil, binary.LittleEndian); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -102,6 +102,7 @@ func (op OpCode) Size() Size {
 
 // Source returns the source for branch and ALU operations.
 func (op OpCode) Source() Source {
+	// Byte swaps use the source bit for their Endianness.
 	if op.Class().encoding() != jumpOrALU || op.ALUOp() == Swap {
 		return InvalidSource
 	}
@@ -110,7 +111,7 @@ func (op OpCode) Source() Source {
 
 // ALUOp returns the ALUOp.
 func (op OpCode) ALUOp() ALUOp {
-	if op.Class().encoding() != jumpOrALU {
+	if class := op.Class(); class != ALUClass && class != ALU64Class {
 		return InvalidALUOp
 	}
 	return ALUOp(op & aluMask)
@@ -126,7 +127,7 @@ func (op OpCode) Endianness() Endianness {
 
 // JumpOp returns the JumpOp.
 func (op OpCode) JumpOp() JumpOp {
-	if op.Class().encoding() != jumpOrALU {
+	if op.Class() != JumpClass {
 		return InvalidJumpOp
 	}
 	return JumpOp(op & jumpMask)
@@ -209,6 +210,9 @@ func (op OpCode) String() string {
 
 		if op.ALUOp() == Swap {
 			// Width for Endian is controlled by Constant
+			if class == ALU64Class {
+				f.WriteString("64")
+			}
 			f.WriteString(op.Endianness().String())
 		} else {
 			if class == ALUClass {
@@ -220,7 +224,9 @@ func (op OpCode) String() string {
 
 	case JumpClass:
 		f.WriteString(op.JumpOp().String())
-		if jop := op.JumpOp(); jop != Exit && jop != Call {
+		// Calls and exits don't have a source, so it's only shown if it
+		// is set.
+		if jop := op.JumpOp(); (jop != Exit && jop != Call) || op.Source() != ImmSource {
 			f.WriteString(strings.TrimSuffix(op.Source().String(), "Source"))
 		}
 
@@ -0,0 +1,245 @@
+package asm
+
+import (
+	"fmt"
+	"math"
+)
+
+// OptimizationStats describes the effect of Optimize.
+type OptimizationStats struct {
+	// Size of the program in raw instructions.
+	Before, After int
+}
+
+func (stats OptimizationStats) String() string {
+	return fmt.Sprintf("%d -> %d instructions", stats.Before, stats.After)
+}
+
+// Optimize returns a copy of insns with peephole optimizations applied.
+//
+// The following transformations are repeated until the program doesn't
+// shrink anymore:
+//
+//   - moving an immediate into a register followed by arithmetic with an
+//     immediate on the same register is folded into a single move
+//   - moving a register into itself and jumping to the next instruction
+//     are removed
+//
+// Unreachable instructions are not removed, see EliminateDeadCode.
+func (insns Instructions) Optimize() (Instructions, OptimizationStats, error) {
+	resolved, err := insns.resolveJumps()
+	if err != nil {
+		return nil, OptimizationStats{}, err
+	}
+
+	out := append(Instructions(nil), resolved...)
+	stats := OptimizationStats{Before: out.rawSize()}
+
+	for {
+		targets, err := out.branchTargets()
+		if err != nil {
+			return nil, OptimizationStats{}, err
+		}
+
+		isTarget := make(map[int]bool, len(targets))
+		for _, target := range targets {
+			isTarget[target] = true
+		}
+
+		keep := make([]bool, len(out))
+		for i := range keep {
+			keep[i] = true
+		}
+
+		changed := false
+		for i := range out {
+			if !keep[i] {
+				continue
+			}
+
+			ins := &out[i]
+			if ins.isNop() {
+				keep[i] = false
+				changed = true
+				continue
+			}
+
+			j := i + 1
+			if j >= len(out) || isTarget[j] || out[j].Symbol != "" {
+				continue
+			}
+
+			if ins.foldALU(out[j]) {
+				keep[j] = false
+				changed = true
+			}
+		}
+
+		if !changed {
+			break
+		}
+
+		out, err = out.compact(targets, keep)
+		if err != nil {
+			return nil, OptimizationStats{}, err
+		}
+	}
+
+	stats.After = out.rawSize()
+	return out, stats, nil
+}
+
+// rawSize returns the length of the program in raw instructions.
+func (insns Instructions) rawSize() int {
+	var n int
+	for _, ins := range insns {
+		n += ins.OpCode.rawInstructions()
+	}
+	return n
+}
+
+// isNop returns true if the instruction has no effect.
+func (ins *Instruction) isNop() bool {
+	op := ins.OpCode
+	switch {
+	case op == Mov.Op(RegSource):
+		// 32 bit moves zero the upper half of the register and are
+		// therefore not a no-op.
+		return ins.Dst == ins.Src
+
+	case op.Class() == JumpClass && op.JumpOp() == Ja:
+		return ins.Offset == 0
+
+	default:
+		return false
+	}
+}
+
+// foldALU folds an ALU operation with an immediate into a preceding move
+// of an immediate.
+//
+// Returns false if the instructions can't be folded.
+func (ins *Instruction) foldALU(next Instruction) bool {
+	op := ins.OpCode
+	if op.Class() != ALUClass && op.Class() != ALU64Class {
+		return false
+	}
+
+	if op.ALUOp() != Mov || op.Source() != ImmSource {
+		return false
+	}
+
+	if next.OpCode.Class() != op.Class() || next.OpCode.Source() != ImmSource || next.Dst != ins.Dst {
+		return false
+	}
+
+	if op.Class() == ALUClass {
+		result, ok := evalALU32(next.OpCode.ALUOp(), uint32(ins.Constant), uint32(next.Constant))
+		if !ok {
+			return false
+		}
+
+		ins.Constant = int64(int32(result))
+		return true
+	}
+
+	result, ok := evalALU64(next.OpCode.ALUOp(), uint64(ins.Constant), uint64(next.Constant))
+	if !ok || int64(result) < math.MinInt32 || int64(result) > math.MaxInt32 {
+		// The result doesn't fit into the immediate of a move.
+		return false
+	}
+
+	ins.Constant = int64(result)
+	return true
+}
+
+func evalALU64(op ALUOp, dst, imm uint64) (uint64, bool) {
+	if isShift(op) && imm >= 64 {
+		// The verifier rejects out of range shifts, don't hide them.
+		return 0, false
+	}
+
+	switch op {
+	case Add:
+		return dst + imm, true
+	case Sub:
+		return dst - imm, true
+	case Mul:
+		return dst * imm, true
+	case Div:
+		if imm == 0 {
+			return 0, false
+		}
+		return dst / imm, true
+	case Mod:
+		if imm == 0 {
+			return 0, false
+		}
+		return dst % imm, true
+	case Or:
+		return dst | imm, true
+	case And:
+		return dst & imm, true
+	case Xor:
+		return dst ^ imm, true
+	case LSh:
+		return dst << imm, true
+	case RSh:
+		return dst >> imm, true
+	case ArSh:
+		return uint64(int64(dst) >> imm), true
+	case Neg:
+		return -dst, true
+	case Mov:
+		return imm, true
+	default:
+		return 0, false
+	}
+}
+
+func evalALU32(op ALUOp, dst, imm uint32) (uint32, bool) {
+	if isShift(op) && imm >= 32 {
+		return 0, false
+	}
+
+	switch op {
+	case Add:
+		return dst + imm, true
+	case Sub:
+		return dst - imm, true
+	case Mul:
+		return dst * imm, true
+	case Div:
+		if imm == 0 {
+			return 0, false
+		}
+		return dst / imm, true
+	case Mod:
+		if imm == 0 {
+			return 0, false
+		}
+		return dst % imm, true
+	case Or:
+		return dst | imm, true
+	case And:
+		return dst & imm, true
+	case Xor:
+		return dst ^ imm, true
+	case LSh:
+		return dst << imm, true
+	case RSh:
+		return dst >> imm, true
+	case ArSh:
+		return uint32(int32(dst) >> imm), true
+	case Neg:
+		return -dst, true
+	case Mov:
+		return imm, true
+	default:
+		return 0, false
+	}
+}
+
+func isShift(op ALUOp) bool {
+	return op == LSh || op == RSh || op == ArSh
+}
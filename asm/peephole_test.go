@@ -0,0 +1,86 @@
+package asm
+
+import (
+	"testing"
+)
+
+func TestOptimize(t *testing.T) {
+	insns := Instructions{
+		Mov.Imm(R1, 2),
+		Mul.Imm(R1, 21),
+		Add.Imm(R1, -2),
+		Mov.Reg(R1, R1),
+		JEq.Imm(R1, 40, "out"),
+		Mov.Imm32(R0, -1),
+		RSh.Imm32(R0, 28),
+		Ja.Label("out"),
+		Return().Sym("out"),
+	}
+
+	out, stats, err := insns.Optimize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Instructions{
+		Mov.Imm(R1, 40),
+		JEq.Imm(R1, 40, "out"),
+		Mov.Imm32(R0, 0xf),
+		Return().Sym("out"),
+	}
+	want[1].Offset = 1
+
+	if len(out) != len(want) {
+		t.Fatalf("Expected\n%vgot\n%v", want, out)
+	}
+	for i := range want {
+		if out[i] != want[i] {
+			t.Errorf("Instruction %d: expected %v, got %v", i, want[i], out[i])
+		}
+	}
+
+	if stats.Before != 9 || stats.After != 4 {
+		t.Error("Unexpected stats:", stats)
+	}
+
+	if insns[0].Constant != 2 {
+		t.Error("Optimize modifies instructions")
+	}
+}
+
+func TestOptimizeJumpTarget(t *testing.T) {
+	insns := Instructions{
+		Mov.Imm(R0, 1),
+		JEq.Imm(R1, 0, "add"),
+		Mov.Imm(R0, 2),
+		Add.Imm(R0, 1).Sym("add"),
+		Return(),
+	}
+
+	out, _, err := insns.Optimize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out) != len(insns) {
+		t.Errorf("Folded instruction which is a jump target:\n%v", out)
+	}
+}
+
+func TestOptimizeShiftOutOfRange(t *testing.T) {
+	for _, insns := range []Instructions{
+		{Mov.Imm(R0, 1), LSh.Imm(R0, 64), Return()},
+		{Mov.Imm(R0, 1), RSh.Imm(R0, -1), Return()},
+		{Mov.Imm32(R0, 1), LSh.Imm32(R0, 32), Return()},
+		{Mov.Imm32(R0, -1), ArSh.Imm32(R0, 33), Return()},
+	} {
+		out, _, err := insns.Optimize()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(out) != len(insns) {
+			t.Errorf("Folded out of range shift:\n%v", out)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package ebpf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cilium/ebpf/internal"
+)
+
+// DefaultBPFFSPath is where the BPF filesystem is conventionally mounted.
+const DefaultBPFFSPath = internal.DefaultBPFFSPath
+
+// FindBPFFS returns the mount point of a BPF filesystem.
+//
+// DefaultBPFFSPath is preferred if the filesystem is mounted in multiple
+// places. Returns an error wrapping os.ErrNotExist if there is no mount.
+func FindBPFFS() (string, error) {
+	return internal.FindBPFFS()
+}
+
+// MountBPFFS mounts a BPF filesystem at path, creating the directory if
+// necessary. Doing so requires CAP_SYS_ADMIN.
+//
+// It is not an error if a BPF filesystem is already mounted at path.
+func MountBPFFS(path string) error {
+	return internal.MountBPFFS(path)
+}
+
+// MkdirPinPath creates a directory for an application to pin objects in.
+//
+// The directory is created below the BPF filesystem returned by FindBPFFS.
+// name may contain slashes to create nested directories. Returns the
+// absolute path of the directory.
+func MkdirPinPath(name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("pin directory name cannot be empty")
+	}
+
+	root, err := FindBPFFS()
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(root, name)
+	if !strings.HasPrefix(dir, root+string(filepath.Separator)) {
+		return "", fmt.Errorf("pin directory %s is outside of %s", name, root)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("create pin directory: %w", err)
+	}
+
+	return dir, nil
+}
+
+// CheckPinPath returns an error if an object can't be pinned at fileName.
+//
+// This is the case if the parent directory of fileName doesn't exist or isn't
+// on a BPF filesystem.
+func CheckPinPath(fileName string) error {
+	return internal.CheckBPFFSPath(fileName)
+}
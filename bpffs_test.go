@@ -0,0 +1,59 @@
+package ebpf
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckPinPath(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "ebpf-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := CheckPinPath(filepath.Join(tmp, "foo")); err == nil {
+		t.Error("Accepted path outside of bpffs")
+	}
+
+	if err := CheckPinPath(filepath.Join(tmp, "missing", "foo")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected error wrapping ErrNotExist for missing directory, got", err)
+	}
+
+	root, err := FindBPFFS()
+	if err != nil {
+		t.Skip("No bpffs mounted:", err)
+	}
+
+	if err := CheckPinPath(filepath.Join(root, "foo")); err != nil {
+		t.Error("Rejected path on bpffs:", err)
+	}
+}
+
+func TestMkdirPinPath(t *testing.T) {
+	if _, err := MkdirPinPath(""); err == nil {
+		t.Error("Accepted empty name")
+	}
+
+	root, err := FindBPFFS()
+	if err != nil {
+		t.Skip("No bpffs mounted:", err)
+	}
+
+	if _, err := MkdirPinPath("../foo"); err == nil {
+		t.Error("Accepted name outside of bpffs")
+	}
+
+	dir, err := MkdirPinPath("ebpf-test/nested")
+	if err != nil {
+		t.Fatal("Can't create pin directory:", err)
+	}
+	defer os.RemoveAll(filepath.Join(root, "ebpf-test"))
+
+	if err := CheckPinPath(filepath.Join(dir, "foo")); err != nil {
+		t.Error("Pin directory isn't usable:", err)
+	}
+}
@@ -0,0 +1,150 @@
+// Package btf allows inspecting types described by the BPF Type Format.
+//
+// BTF is embedded into ELF files produced by clang, and most recent kernels
+// expose the BTF of vmlinux. Types form a graph: a Struct refers to the
+// types of its Members, a Pointer to its Target and so on. The graph may
+// contain cycles.
+//
+// The canonical documentation lives in the Linux kernel repository and is
+// available at https://www.kernel.org/doc/html/latest/bpf/btf.html
+package btf
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/cilium/ebpf/internal/btf"
+)
+
+// Errors returned by the package.
+var (
+	ErrNotSupported = btf.ErrNotSupported
+	ErrNotFound     = btf.ErrNotFound
+)
+
+// Spec represents decoded BTF.
+type Spec = btf.Spec
+
+// Type represents a type described by BTF.
+//
+// Use a type switch to find out which of the types below a Type is.
+type Type = btf.Type
+
+// TypeID identifies a type in a BTF section.
+type TypeID = btf.TypeID
+
+// Name identifies a type. Anonymous types have an empty name.
+type Name = btf.Name
+
+// The types which make up the graph.
+type (
+	Void       = btf.Void
+	Int        = btf.Int
+	Pointer    = btf.Pointer
+	Array      = btf.Array
+	Struct     = btf.Struct
+	Union      = btf.Union
+	Member     = btf.Member
+	Enum       = btf.Enum
+	EnumValue  = btf.EnumValue
+	Fwd        = btf.Fwd
+	Typedef    = btf.Typedef
+	Volatile   = btf.Volatile
+	Const      = btf.Const
+	Restrict   = btf.Restrict
+	Func       = btf.Func
+	FuncProto  = btf.FuncProto
+	FuncParam  = btf.FuncParam
+	Var        = btf.Var
+	Datasec    = btf.Datasec
+	VarSecinfo = btf.VarSecinfo
+)
+
+// IntEncoding describes how to interpret the bits of an Int.
+type IntEncoding = btf.IntEncoding
+
+// Valid encodings of an Int.
+const (
+	Signed = btf.Signed
+	Char   = btf.Char
+	Bool   = btf.Bool
+)
+
+// FwdKind is the type of forward declaration.
+type FwdKind = btf.FwdKind
+
+// Valid types of forward declaration.
+const (
+	FwdStruct = btf.FwdStruct
+	FwdUnion  = btf.FwdUnion
+)
+
+// LoadSpecFromReader reads BTF sections from an ELF.
+//
+// Returns a nil Spec and no error if no BTF was present.
+func LoadSpecFromReader(rd io.ReaderAt) (*Spec, error) {
+	return btf.LoadSpecFromReader(rd)
+}
+
+// LoadRawSpec reads a blob of BTF data that isn't wrapped in an ELF file,
+// as found in /sys/kernel/btf/vmlinux.
+//
+// Use this to load BTF for kernels built without CONFIG_DEBUG_INFO_BTF,
+// and pass the result to ebpf.ProgramOptions.KernelTypes.
+func LoadRawSpec(rd io.ReadSeeker, bo binary.ByteOrder) (*Spec, error) {
+	return btf.LoadRawSpec(rd, bo)
+}
+
+// LoadKernelSpec returns the current kernel's BTF information.
+//
+// The result is cached and shared between callers, it mustn't be modified.
+//
+// Requires a >= 5.5 kernel with CONFIG_DEBUG_INFO_BTF enabled. Returns
+// ErrNotSupported if BTF is not enabled.
+func LoadKernelSpec() (*Spec, error) {
+	return btf.LoadKernelSpec()
+}
+
+// Sizeof returns the size of a type in bytes.
+//
+// Returns an error if the size can't be computed.
+func Sizeof(typ Type) (int, error) {
+	return btf.Sizeof(typ)
+}
+
+// Offsetof returns the offset of a member of a Struct or Union in bytes.
+//
+// Nested members are separated by dots. Members of anonymous structs and
+// unions can be found without naming them.
+func Offsetof(typ Type, member string) (int, error) {
+	return btf.Offsetof(typ, member)
+}
+
+// Decode interprets buf as a value of type typ, and stores the result in
+// the value pointed to by dst.
+//
+// buf is expected to be in native byte order, as produced by a BPF program
+// writing to a perf event array or a ring buffer. It may be longer than
+// the type.
+//
+// If dst points to an empty interface, the value is decoded as follows:
+//
+//   - Struct and Union: map[string]interface{} keyed by member name
+//   - Int: int64 if signed, uint64 if unsigned and bool if boolean
+//   - Enum: the name of the value as a string, or int64 if unknown
+//   - Pointer: uint64
+//   - Array of char: string up to the first NUL byte
+//   - other Array: []interface{}
+//
+// Otherwise dst may point to a Go type which matches the BTF. Members are
+// assigned to exported struct fields with the same name, ignoring case.
+// The name can be overridden with a `btf:"name"` tag, and a tag of "-"
+// skips a field. Members without a matching field are ignored. Enums
+// can be decoded into strings or integers, and char arrays into strings,
+// byte arrays or byte slices.
+//
+// Members of anonymous structs and unions are decoded as if they were
+// members of the enclosing type.
+func Decode(typ Type, buf []byte, dst interface{}) error {
+	return btf.Decode(typ, buf, dst)
+}
@@ -0,0 +1,56 @@
+package btf_test
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/cilium/ebpf/btf"
+)
+
+// Find the offset of a member of a kernel struct at runtime.
+func ExampleOffsetof() {
+	spec, err := btf.LoadKernelSpec()
+	if err != nil {
+		panic(err)
+	}
+
+	var sock btf.Struct
+	if err := spec.FindType("sock", &sock); err != nil {
+		panic(err)
+	}
+
+	offset, err := btf.Offsetof(&sock, "__sk_common.skc_family")
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println("skc_family is at offset", offset)
+}
+
+var elfBytes, sample []byte
+
+// Decode a record written by a BPF program into a Go struct.
+func ExampleDecode() {
+	// The BTF of the ELF contains the type of the record, for example
+	// struct event { u32 pid; char comm[16]; }.
+	spec, err := btf.LoadSpecFromReader(bytes.NewReader(elfBytes))
+	if err != nil {
+		panic(err)
+	}
+
+	var event btf.Struct
+	if err := spec.FindType("event", &event); err != nil {
+		panic(err)
+	}
+
+	// sample is read from a perf event array or a ring buffer.
+	var value struct {
+		PID  uint32
+		Comm string
+	}
+	if err := btf.Decode(&event, sample, &value); err != nil {
+		panic(err)
+	}
+
+	fmt.Println(value.PID, value.Comm)
+}
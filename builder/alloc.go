@@ -0,0 +1,162 @@
+package builder
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/cilium/ebpf/asm"
+)
+
+// calleeSaved are the registers preserved across helper calls. R0 to R5
+// are used as scratch registers when lowering statements.
+var calleeSaved = []asm.Register{asm.R6, asm.R7, asm.R8, asm.R9}
+
+// interval is the range of statements during which a register is live.
+type interval struct {
+	reg        *Reg
+	start, end int
+}
+
+// allocator assigns virtual registers to registers or stack slots using
+// linear scan.
+type allocator struct {
+	// pos is the number of the current statement, in program order.
+	pos       int
+	intervals map[*Reg]*interval
+	order     []*interval
+	loops     [][2]int
+	vars      []*Var
+
+	regs       map[*Reg]asm.Register
+	slots      map[*Reg]int16
+	varOffsets map[*Var]int16
+}
+
+func newAllocator() *allocator {
+	return &allocator{
+		intervals:  make(map[*Reg]*interval),
+		regs:       make(map[*Reg]asm.Register),
+		slots:      make(map[*Reg]int16),
+		varOffsets: make(map[*Var]int16),
+	}
+}
+
+// next advances to the next statement.
+func (a *allocator) next() {
+	a.pos++
+}
+
+// use records that the current statement uses v.
+func (a *allocator) use(v Value) {
+	switch v := v.(type) {
+	case *Reg:
+		if v == nil {
+			return
+		}
+
+		if iv := a.intervals[v]; iv != nil {
+			iv.end = a.pos
+			return
+		}
+
+		iv := &interval{v, a.pos, a.pos}
+		a.intervals[v] = iv
+		a.order = append(a.order, iv)
+
+	case varAddr:
+		if _, ok := a.varOffsets[v.v]; !ok {
+			a.varOffsets[v.v] = 0
+			a.vars = append(a.vars, v.v)
+		}
+	}
+}
+
+func (a *allocator) block(stmts []Stmt) {
+	for _, stmt := range stmts {
+		stmt.visit(a)
+	}
+}
+
+// loop records that statements from start to end may be executed
+// repeatedly.
+func (a *allocator) loop(start, end int) {
+	a.loops = append(a.loops, [2]int{start, end})
+}
+
+func (a *allocator) allocate() error {
+	// Registers which are live when entering a loop must be preserved
+	// until the end of the loop, since they may be used in the next
+	// iteration.
+	for _, loop := range a.loops {
+		for _, iv := range a.order {
+			if iv.start < loop[0] && iv.end >= loop[0] && iv.end < loop[1] {
+				iv.end = loop[1]
+			}
+		}
+	}
+
+	var stack int
+	for _, v := range a.vars {
+		if v.size <= 0 {
+			return fmt.Errorf("variable %s: invalid size %d", v, v.size)
+		}
+		stack += roundUp(v.size)
+		a.varOffsets[v] = int16(-stack)
+	}
+
+	spill := func(iv *interval) {
+		stack += 8
+		a.slots[iv.reg] = int16(-stack)
+	}
+
+	sorted := append([]*interval(nil), a.order...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].start < sorted[j].start
+	})
+
+	free := append([]asm.Register(nil), calleeSaved...)
+	var active []*interval
+	for _, iv := range sorted {
+		// Release registers of intervals which ended before this one.
+		remaining := active[:0]
+		for _, other := range active {
+			if other.end < iv.start {
+				free = append(free, a.regs[other.reg])
+				continue
+			}
+			remaining = append(remaining, other)
+		}
+		active = remaining
+
+		if len(free) > 0 {
+			sort.Slice(free, func(i, j int) bool { return free[i] < free[j] })
+			a.regs[iv.reg] = free[0]
+			free = free[1:]
+			active = append(active, iv)
+			continue
+		}
+
+		// Spill whichever interval ends last.
+		last := 0
+		for i, other := range active {
+			if other.end > active[last].end {
+				last = i
+			}
+		}
+
+		if victim := active[last]; victim.end > iv.end {
+			a.regs[iv.reg] = a.regs[victim.reg]
+			delete(a.regs, victim.reg)
+			spill(victim)
+			active[last] = iv
+		} else {
+			spill(iv)
+		}
+	}
+
+	if stack > asm.StackSize {
+		return fmt.Errorf("program needs %d bytes of stack, limit is %d", stack, asm.StackSize)
+	}
+
+	return nil
+}
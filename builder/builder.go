@@ -0,0 +1,253 @@
+// Package builder generates eBPF from a tree of statements.
+//
+// Programs are written in terms of virtual registers and stack variables,
+// which are assigned to registers and stack slots automatically:
+//
+//	ctx, length := builder.NewReg("ctx"), builder.NewReg("length")
+//	insns, err := builder.Compile(ctx,
+//		// __sk_buff->len
+//		builder.Load(length, ctx, 0, asm.Word),
+//		builder.If(builder.Gt(length, builder.Imm(1500))).
+//			Then(builder.Return(builder.Imm(0))),
+//		builder.Return(builder.Imm(-1)),
+//	)
+//
+// This is aimed at small programs and filters, use C and bpf2go for
+// anything larger.
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/cilium/ebpf/asm"
+)
+
+// Compile lowers statements to instructions.
+//
+// ctx holds the context of the program on entry, for example a pointer to
+// struct __sk_buff. It may be nil. Falling off the end of body returns
+// zero.
+func Compile(ctx *Reg, body ...Stmt) (asm.Instructions, error) {
+	a := newAllocator()
+	a.use(ctx)
+	a.block(body)
+	if err := a.allocate(); err != nil {
+		return nil, err
+	}
+
+	c := compiler{alloc: a}
+	for _, v := range a.vars {
+		off := a.varOffsets[v]
+		for i := 0; i < roundUp(v.size); i += 8 {
+			c.emit(asm.StoreImm(asm.R10, off+int16(i), 0, asm.DWord))
+		}
+	}
+
+	if ctx != nil {
+		dst := c.target(ctx, asm.R1)
+		if dst != asm.R1 {
+			c.emit(asm.Mov.Reg(dst, asm.R1))
+		}
+		c.commit(ctx, dst)
+	}
+
+	if !c.block(body) {
+		c.emit(
+			asm.Mov.Imm(asm.R0, 0),
+			asm.Return(),
+		)
+	}
+
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	// Offsets of jumps are in raw instructions, which differs from the
+	// index of instructions if there are 64 bit loads.
+	raw := make([]int, 0, len(c.insns)+1)
+	iter := c.insns.Iterate()
+	for iter.Next() {
+		raw = append(raw, int(iter.Offset))
+	}
+	raw = append(raw, c.insns.Size()/asm.InstructionSize)
+
+	for _, f := range c.fixups {
+		offset := raw[c.labels[f.label]] - raw[f.index] - 1
+		if offset > math.MaxInt16 || offset < math.MinInt16 {
+			return nil, errors.New("program is too large")
+		}
+		c.insns[f.index].Offset = int16(offset)
+	}
+
+	return c.insns, nil
+}
+
+// label is a position in the program which jumps may refer to before it
+// is known.
+type label int
+
+type compiler struct {
+	alloc *allocator
+	insns asm.Instructions
+	// labels holds the index of the instruction a label refers to.
+	labels []int
+	fixups []fixup
+	err    error
+}
+
+// fixup is a jump whose offset is only known once all instructions are
+// emitted.
+type fixup struct {
+	index int
+	label label
+}
+
+func (c *compiler) emit(insns ...asm.Instruction) {
+	c.insns = append(c.insns, insns...)
+}
+
+func (c *compiler) fail(err error) {
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+func (c *compiler) newLabel() label {
+	c.labels = append(c.labels, -1)
+	return label(len(c.labels) - 1)
+}
+
+// bind makes l refer to the next emitted instruction.
+func (c *compiler) bind(l label) {
+	c.labels[l] = len(c.insns)
+}
+
+// jump emits ins and arranges for it to jump to l.
+func (c *compiler) jump(ins asm.Instruction, l label) {
+	ins.Reference = ""
+	c.fixups = append(c.fixups, fixup{len(c.insns), l})
+	c.emit(ins)
+}
+
+// block lowers a list of statements. Returns true if the block always
+// ends the program.
+func (c *compiler) block(stmts []Stmt) bool {
+	for i, stmt := range stmts {
+		if stmt.lower(c) {
+			if i != len(stmts)-1 {
+				c.fail(fmt.Errorf("statement %d is unreachable", i+1))
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// branch jumps to miss if cond doesn't hold, and falls through otherwise.
+func (c *compiler) branch(cond Cond, miss label) {
+	switch cond.op {
+	case asm.Ja, asm.Call, asm.Exit, asm.InvalidJumpOp:
+		c.fail(fmt.Errorf("unsupported condition %s", cond.op))
+		return
+	}
+
+	jump := func(op asm.JumpOp) asm.Instruction {
+		a := c.value(cond.a, asm.R1)
+		if imm, ok := cond.b.(Imm); ok && fitsInt32(imm) {
+			return op.Imm(a, int32(imm), "")
+		}
+		return op.Reg(a, c.value(cond.b, asm.R2), "")
+	}
+
+	if inverted, ok := invertedJumps[cond.op]; ok {
+		c.jump(jump(inverted), miss)
+		return
+	}
+
+	hit := c.newLabel()
+	c.jump(jump(cond.op), hit)
+	c.jump(asm.Ja.Label(""), miss)
+	c.bind(hit)
+}
+
+// value returns a register holding v, using scratch if v isn't assigned
+// to a register already.
+func (c *compiler) value(v Value, scratch asm.Register) asm.Register {
+	switch v := v.(type) {
+	case *Reg:
+		if v == nil {
+			break
+		}
+
+		if reg, ok := c.alloc.regs[v]; ok {
+			return reg
+		}
+		c.emit(asm.LoadMem(scratch, asm.R10, c.alloc.slots[v], asm.DWord))
+		return scratch
+
+	case Imm:
+		if fitsInt32(v) {
+			c.emit(asm.Mov.Imm(scratch, int32(v)))
+		} else {
+			c.emit(asm.LoadImm(scratch, int64(v), asm.DWord))
+		}
+		return scratch
+
+	case varAddr:
+		c.emit(
+			asm.Mov.Reg(scratch, asm.R10),
+			asm.Add.Imm(scratch, int32(c.alloc.varOffsets[v.v])),
+		)
+		return scratch
+
+	case mapPtr:
+		ins := asm.LoadMapPtr(scratch, 0)
+		ins.Reference = string(v)
+		// Mark the pointer as not rewritten yet, like the ELF loader does.
+		_ = ins.RewriteMapPtr(-1)
+		c.emit(ins)
+		return scratch
+	}
+
+	c.fail(fmt.Errorf("invalid value %v", v))
+	return scratch
+}
+
+// load places v in reg.
+func (c *compiler) load(v Value, reg asm.Register) {
+	if src := c.value(v, reg); src != reg {
+		c.emit(asm.Mov.Reg(reg, src))
+	}
+}
+
+// target returns the register to write r to, which is scratch if r
+// is spilled. Call commit once the register is written.
+func (c *compiler) target(r *Reg, scratch asm.Register) asm.Register {
+	if r == nil {
+		c.fail(errors.New("missing register"))
+		return scratch
+	}
+
+	if reg, ok := c.alloc.regs[r]; ok {
+		return reg
+	}
+	return scratch
+}
+
+// commit writes reg back to the stack slot of r if it is spilled.
+func (c *compiler) commit(r *Reg, reg asm.Register) {
+	if slot, ok := c.alloc.slots[r]; ok {
+		c.emit(asm.StoreMem(asm.R10, slot, reg, asm.DWord))
+	}
+}
+
+func fitsInt32(imm Imm) bool {
+	return imm >= math.MinInt32 && imm <= math.MaxInt32
+}
+
+// roundUp rounds n up to a multiple of eight.
+func roundUp(n int) int {
+	return (n + 7) &^ 7
+}
@@ -0,0 +1,219 @@
+package builder
+
+import (
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal/testutils"
+)
+
+func TestCompile(t *testing.T) {
+	ctx := NewReg("ctx")
+	x, y := NewReg("x"), NewReg("y")
+
+	for name, test := range map[string]struct {
+		body []Stmt
+		want uint32
+	}{
+		"implicit return": {nil, 0},
+		"arithmetic": {[]Stmt{
+			Set(x, Imm(10)),
+			Add(x, Imm(5)),
+			Set(y, Imm(2)),
+			Mul(x, y),
+			Return(x),
+		}, 30},
+		"if": {[]Stmt{
+			Set(x, Imm(3)),
+			If(Eq(x, Imm(3))).Then(Set(x, Imm(1))),
+			If(Ne(x, Imm(1))).Then(Set(x, Imm(2))),
+			Return(x),
+		}, 1},
+		"if else": {[]Stmt{
+			Set(x, Imm(3)),
+			If(Gt(x, Imm(3))).
+				Then(Return(Imm(1))).
+				Else(Return(Imm(2))),
+		}, 2},
+		"nested if": {[]Stmt{
+			Set(x, Imm(-1)),
+			If(SLt(x, Imm(0))).Then(
+				If(Lt(x, Imm(0))).
+					Then(Return(Imm(1))),
+				Return(Imm(2)),
+			),
+		}, 2},
+		"bit test": {[]Stmt{
+			Set(x, Imm(6)),
+			If(Compare(asm.JSet, x, Imm(4))).
+				Then(Return(Imm(1))).
+				Else(Return(Imm(2))),
+		}, 1},
+		"64 bit immediate": {[]Stmt{
+			Set(x, Imm(1)),
+			If(Eq(x, Imm(1))).
+				Then(Set(y, Imm(1<<40))).
+				Else(Set(y, Imm(2<<40))),
+			If(Eq(y, Imm(1<<40))).Then(RSh(y, Imm(40))),
+			Return(y),
+		}, 1},
+		"context": {[]Stmt{
+			// __sk_buff->len, excluding the Ethernet header
+			Load(x, ctx, 0, asm.Word),
+			Return(x),
+		}, 50},
+		"stack variable": {[]Stmt{
+			Set(x, NewVar("buf", 12).Addr()),
+			Store(x, 8, Imm(21), asm.Word),
+			Load(y, x, 8, asm.Word),
+			Add(y, y),
+			Return(y),
+		}, 42},
+	} {
+		t.Run(name, func(t *testing.T) {
+			insns, err := Compile(ctx, test.body...)
+			if err != nil {
+				t.Fatal("Can't compile:", err)
+			}
+
+			if ret := mustRun(t, insns); ret != test.want {
+				t.Errorf("Expected %d, got %d\n%s", test.want, ret, insns)
+			}
+		})
+	}
+}
+
+func TestCompileLoop(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.3", "bounded loops")
+
+	sum := NewReg("sum")
+	outer, inner := Loop(3), Loop(10)
+	insns, err := Compile(nil,
+		Set(sum, Imm(0)),
+		outer.Do(
+			inner.Do(
+				Add(sum, inner.Index()),
+			),
+			Add(sum, outer.Index()),
+		),
+		Return(sum),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ret := mustRun(t, insns); ret != 3*45+3 {
+		t.Errorf("Expected %d, got %d", 3*45+3, ret)
+	}
+}
+
+func TestCompileSpill(t *testing.T) {
+	var regs []*Reg
+	var body []Stmt
+	for i := 0; i < 8; i++ {
+		r := NewReg("r")
+		regs = append(regs, r)
+		body = append(body, Set(r, Imm(int64(i+1))))
+	}
+
+	sum := NewReg("sum")
+	body = append(body, Set(sum, Imm(0)))
+	for _, r := range regs {
+		body = append(body, Add(sum, r))
+	}
+	body = append(body, Return(sum))
+
+	insns, err := Compile(nil, body...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ret := mustRun(t, insns); ret != 36 {
+		t.Errorf("Expected 36, got %d\n%s", ret, insns)
+	}
+}
+
+func TestCompileCall(t *testing.T) {
+	m, err := ebpf.NewMap(&ebpf.MapSpec{
+		Type:       ebpf.Array,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if err := m.Put(uint32(0), uint32(40)); err != nil {
+		t.Fatal(err)
+	}
+
+	key := NewVar("key", 4)
+	value, x := NewReg("value"), NewReg("x")
+	insns, err := Compile(nil,
+		// x must survive the helper call.
+		Set(x, Imm(2)),
+		Call(asm.FnMapLookupElem, value, MapPtr("map"), key.Addr()),
+		If(Eq(value, Imm(0))).Then(Return(Imm(0))),
+		Load(value, value, 0, asm.Word),
+		Add(value, x),
+		Return(value),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := insns.RewriteMapPtr("map", m.FD()); err != nil {
+		t.Fatal(err)
+	}
+
+	if ret := mustRun(t, insns); ret != 42 {
+		t.Errorf("Expected 42, got %d\n%s", ret, insns)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	x := NewReg("x")
+	for name, body := range map[string][]Stmt{
+		"unreachable":         {Return(Imm(0)), Set(x, Imm(1))},
+		"loop always returns": {Loop(2).Do(Return(Imm(0)))},
+		"invalid ALU op":      {ALU(asm.Neg, x, Imm(0))},
+		"invalid condition":   {If(Compare(asm.Exit, x, Imm(0)))},
+		"too many arguments":  {Call(asm.FnTracePrintk, nil, Imm(0), Imm(0), Imm(0), Imm(0), Imm(0), Imm(0))},
+		"missing register":    {Set(nil, Imm(0))},
+		"missing value":       {Return(nil)},
+		"stack too large":     {Set(x, NewVar("huge", 513).Addr())},
+		"empty variable":      {Set(x, NewVar("empty", 0).Addr())},
+		"negative variable":   {Set(x, NewVar("negative", -8).Addr())},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Compile(nil, body...); err == nil {
+				t.Error("Compile doesn't return an error")
+			}
+		})
+	}
+}
+
+func mustRun(t *testing.T, insns asm.Instructions) uint32 {
+	t.Helper()
+
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Type:         ebpf.SocketFilter,
+		Instructions: insns,
+		License:      "MIT",
+	})
+	if err != nil {
+		t.Fatalf("Can't load program: %s\n%s", err, insns)
+	}
+	defer prog.Close()
+
+	ret, _, err := prog.Test(make([]byte, 64))
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ret
+}
@@ -0,0 +1,327 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cilium/ebpf/asm"
+)
+
+// Stmt is a statement of a program.
+type Stmt interface {
+	// visit reports the registers and variables used by the statement
+	// to the allocator, including those of nested statements.
+	visit(a *allocator)
+	// lower emits instructions for the statement. Returns true if the
+	// statement always ends the program.
+	lower(c *compiler) bool
+}
+
+type set struct {
+	dst *Reg
+	src Value
+}
+
+// Set assigns src to dst.
+func Set(dst *Reg, src Value) Stmt {
+	return set{dst, src}
+}
+
+func (s set) visit(a *allocator) {
+	a.next()
+	a.use(s.src)
+	a.use(s.dst)
+}
+
+func (s set) lower(c *compiler) bool {
+	dst := c.target(s.dst, asm.R0)
+	c.load(s.src, dst)
+	c.commit(s.dst, dst)
+	return false
+}
+
+type alu struct {
+	op  asm.ALUOp
+	dst *Reg
+	src Value
+}
+
+// ALU computes dst = dst op src using 64 bit arithmetic.
+//
+// Prefer Add, Sub and friends.
+func ALU(op asm.ALUOp, dst *Reg, src Value) Stmt {
+	return alu{op, dst, src}
+}
+
+// Add computes dst += src.
+func Add(dst *Reg, src Value) Stmt { return alu{asm.Add, dst, src} }
+
+// Sub computes dst -= src.
+func Sub(dst *Reg, src Value) Stmt { return alu{asm.Sub, dst, src} }
+
+// Mul computes dst *= src.
+func Mul(dst *Reg, src Value) Stmt { return alu{asm.Mul, dst, src} }
+
+// Div computes dst /= src, treating both as unsigned.
+func Div(dst *Reg, src Value) Stmt { return alu{asm.Div, dst, src} }
+
+// Mod computes dst %= src, treating both as unsigned.
+func Mod(dst *Reg, src Value) Stmt { return alu{asm.Mod, dst, src} }
+
+// And computes dst &= src.
+func And(dst *Reg, src Value) Stmt { return alu{asm.And, dst, src} }
+
+// Or computes dst |= src.
+func Or(dst *Reg, src Value) Stmt { return alu{asm.Or, dst, src} }
+
+// Xor computes dst ^= src.
+func Xor(dst *Reg, src Value) Stmt { return alu{asm.Xor, dst, src} }
+
+// LSh computes dst <<= src.
+func LSh(dst *Reg, src Value) Stmt { return alu{asm.LSh, dst, src} }
+
+// RSh computes dst >>= src, filling with zeroes.
+func RSh(dst *Reg, src Value) Stmt { return alu{asm.RSh, dst, src} }
+
+func (s alu) visit(a *allocator) {
+	a.next()
+	a.use(s.src)
+	a.use(s.dst)
+}
+
+func (s alu) lower(c *compiler) bool {
+	switch s.op {
+	case asm.Neg, asm.Mov, asm.Swap, asm.InvalidALUOp:
+		c.fail(fmt.Errorf("unsupported ALU operation %s", s.op))
+		return false
+	}
+
+	dst := c.value(s.dst, asm.R0)
+	if imm, ok := s.src.(Imm); ok && fitsInt32(imm) {
+		c.emit(s.op.Imm(dst, int32(imm)))
+	} else {
+		c.emit(s.op.Reg(dst, c.value(s.src, asm.R1)))
+	}
+	c.commit(s.dst, dst)
+	return false
+}
+
+type load struct {
+	dst  *Reg
+	base Value
+	off  int16
+	size asm.Size
+}
+
+// Load reads size bytes at base + off into dst.
+func Load(dst *Reg, base Value, off int16, size asm.Size) Stmt {
+	return load{dst, base, off, size}
+}
+
+func (s load) visit(a *allocator) {
+	a.next()
+	a.use(s.base)
+	a.use(s.dst)
+}
+
+func (s load) lower(c *compiler) bool {
+	base := c.value(s.base, asm.R1)
+	dst := c.target(s.dst, asm.R0)
+	c.emit(asm.LoadMem(dst, base, s.off, s.size))
+	c.commit(s.dst, dst)
+	return false
+}
+
+type store struct {
+	base Value
+	off  int16
+	src  Value
+	size asm.Size
+}
+
+// Store writes the lower size bytes of src to base + off.
+func Store(base Value, off int16, src Value, size asm.Size) Stmt {
+	return store{base, off, src, size}
+}
+
+func (s store) visit(a *allocator) {
+	a.next()
+	a.use(s.base)
+	a.use(s.src)
+}
+
+func (s store) lower(c *compiler) bool {
+	base := c.value(s.base, asm.R1)
+	if imm, ok := s.src.(Imm); ok && fitsInt32(imm) {
+		c.emit(asm.StoreImm(base, s.off, int64(imm), s.size))
+	} else {
+		c.emit(asm.StoreMem(base, s.off, c.value(s.src, asm.R2), s.size))
+	}
+	return false
+}
+
+type call struct {
+	fn   asm.BuiltinFunc
+	ret  *Reg
+	args []Value
+}
+
+// Call invokes a helper with up to five arguments, and stores the result
+// in ret if it isn't nil.
+func Call(fn asm.BuiltinFunc, ret *Reg, args ...Value) Stmt {
+	return call{fn, ret, args}
+}
+
+func (s call) visit(a *allocator) {
+	a.next()
+	for _, arg := range s.args {
+		a.use(arg)
+	}
+	a.use(s.ret)
+}
+
+func (s call) lower(c *compiler) bool {
+	if len(s.args) > 5 {
+		c.fail(fmt.Errorf("call %s: too many arguments", s.fn))
+		return false
+	}
+
+	for i, arg := range s.args {
+		c.load(arg, asm.R1+asm.Register(i))
+	}
+	c.emit(s.fn.Call())
+
+	if s.ret != nil {
+		ret := c.target(s.ret, asm.R0)
+		if ret != asm.R0 {
+			c.emit(asm.Mov.Reg(ret, asm.R0))
+		}
+		c.commit(s.ret, ret)
+	}
+	return false
+}
+
+type ret struct {
+	v Value
+}
+
+// Return ends the program with v as the return value.
+func Return(v Value) Stmt {
+	return ret{v}
+}
+
+func (s ret) visit(a *allocator) {
+	a.next()
+	a.use(s.v)
+}
+
+func (s ret) lower(c *compiler) bool {
+	c.load(s.v, asm.R0)
+	c.emit(asm.Return())
+	return true
+}
+
+// IfStmt executes statements depending on a condition.
+type IfStmt struct {
+	cond   Cond
+	then   []Stmt
+	orElse []Stmt
+}
+
+// If creates a conditional statement. Use Then and Else to add
+// statements to it.
+func If(cond Cond) *IfStmt {
+	return &IfStmt{cond: cond}
+}
+
+// Then adds statements executed if the condition holds.
+func (s *IfStmt) Then(stmts ...Stmt) *IfStmt {
+	s.then = append(s.then, stmts...)
+	return s
+}
+
+// Else adds statements executed if the condition doesn't hold.
+func (s *IfStmt) Else(stmts ...Stmt) *IfStmt {
+	s.orElse = append(s.orElse, stmts...)
+	return s
+}
+
+func (s *IfStmt) visit(a *allocator) {
+	a.next()
+	a.use(s.cond.a)
+	a.use(s.cond.b)
+	a.block(s.then)
+	a.block(s.orElse)
+}
+
+func (s *IfStmt) lower(c *compiler) bool {
+	orElse, end := c.newLabel(), c.newLabel()
+
+	c.branch(s.cond, orElse)
+	thenReturns := c.block(s.then)
+	if len(s.orElse) == 0 {
+		c.bind(orElse)
+		c.bind(end)
+		return false
+	}
+
+	if !thenReturns {
+		c.jump(asm.Ja.Label(""), end)
+	}
+
+	c.bind(orElse)
+	elseReturns := c.block(s.orElse)
+	c.bind(end)
+	return thenReturns && elseReturns
+}
+
+// LoopStmt executes statements a fixed number of times.
+//
+// Loops require at least Linux 5.3.
+type LoopStmt struct {
+	n     Imm
+	index *Reg
+	body  []Stmt
+}
+
+// Loop creates a loop with n iterations. Use Do to add statements to it.
+func Loop(n uint32) *LoopStmt {
+	return &LoopStmt{n: Imm(n), index: NewReg("index")}
+}
+
+// Do adds statements to the body of the loop.
+func (s *LoopStmt) Do(stmts ...Stmt) *LoopStmt {
+	s.body = append(s.body, stmts...)
+	return s
+}
+
+// Index returns the register holding the number of the current iteration,
+// starting at zero. It mustn't be modified.
+func (s *LoopStmt) Index() *Reg {
+	return s.index
+}
+
+func (s *LoopStmt) visit(a *allocator) {
+	a.next()
+	start := a.pos
+	a.use(s.index)
+	a.block(s.body)
+	a.next()
+	a.use(s.index)
+	a.loop(start, a.pos)
+}
+
+func (s *LoopStmt) lower(c *compiler) bool {
+	top, end := c.newLabel(), c.newLabel()
+
+	set{s.index, Imm(0)}.lower(c)
+	c.bind(top)
+	c.branch(Lt(s.index, s.n), end)
+	if c.block(s.body) {
+		c.fail(errors.New("loop body always returns"))
+	}
+	alu{asm.Add, s.index, Imm(1)}.lower(c)
+	c.jump(asm.Ja.Label(""), top)
+	c.bind(end)
+	return false
+}
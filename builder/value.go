@@ -0,0 +1,135 @@
+package builder
+
+import (
+	"github.com/cilium/ebpf/asm"
+)
+
+// Value is an operand of a statement.
+//
+// It is either an Imm, a *Reg, the address of a Var or a map pointer.
+type Value interface {
+	value()
+}
+
+// Imm is a constant.
+type Imm int64
+
+func (Imm) value() {}
+
+// Reg is a virtual register.
+//
+// Registers are assigned to R6 to R9 automatically, and spilled to the
+// stack if more than four are in use at the same time. They are preserved
+// across helper calls.
+type Reg struct {
+	name string
+}
+
+// NewReg creates a new virtual register. The name is used in error
+// messages.
+func NewReg(name string) *Reg {
+	return &Reg{name}
+}
+
+func (r *Reg) String() string {
+	return r.name
+}
+
+func (*Reg) value() {}
+
+// Var is a buffer on the stack, for example for the key of a map lookup.
+//
+// Variables are zeroed at the start of the program. Access them using
+// Load and Store with Addr as the base.
+type Var struct {
+	name string
+	size int
+}
+
+// NewVar allocates size bytes on the stack. The size is rounded up to a
+// multiple of eight bytes. Compile returns an error if size isn't positive.
+func NewVar(name string, size int) *Var {
+	return &Var{name, size}
+}
+
+func (v *Var) String() string {
+	return v.name
+}
+
+// Addr returns a pointer to the variable.
+func (v *Var) Addr() Value {
+	return varAddr{v}
+}
+
+type varAddr struct {
+	v *Var
+}
+
+func (varAddr) value() {}
+
+// MapPtr is a pointer to the map with the given name. It's resolved when
+// loading the program as part of a CollectionSpec.
+func MapPtr(name string) Value {
+	return mapPtr(name)
+}
+
+type mapPtr string
+
+func (mapPtr) value() {}
+
+// Cond compares two values, see If.
+type Cond struct {
+	op   asm.JumpOp
+	a, b Value
+}
+
+// Compare returns a condition which holds if op would jump.
+//
+// Prefer Eq, Ne and friends.
+func Compare(op asm.JumpOp, a, b Value) Cond {
+	return Cond{op, a, b}
+}
+
+// Eq holds if a == b.
+func Eq(a, b Value) Cond { return Cond{asm.JEq, a, b} }
+
+// Ne holds if a != b.
+func Ne(a, b Value) Cond { return Cond{asm.JNE, a, b} }
+
+// Gt holds if a > b, treating both as unsigned.
+func Gt(a, b Value) Cond { return Cond{asm.JGT, a, b} }
+
+// Ge holds if a >= b, treating both as unsigned.
+func Ge(a, b Value) Cond { return Cond{asm.JGE, a, b} }
+
+// Lt holds if a < b, treating both as unsigned.
+func Lt(a, b Value) Cond { return Cond{asm.JLT, a, b} }
+
+// Le holds if a <= b, treating both as unsigned.
+func Le(a, b Value) Cond { return Cond{asm.JLE, a, b} }
+
+// SGt holds if a > b, treating both as signed.
+func SGt(a, b Value) Cond { return Cond{asm.JSGT, a, b} }
+
+// SGe holds if a >= b, treating both as signed.
+func SGe(a, b Value) Cond { return Cond{asm.JSGE, a, b} }
+
+// SLt holds if a < b, treating both as signed.
+func SLt(a, b Value) Cond { return Cond{asm.JSLT, a, b} }
+
+// SLe holds if a <= b, treating both as signed.
+func SLe(a, b Value) Cond { return Cond{asm.JSLE, a, b} }
+
+// invertedJumps maps jumps to their negation.
+var invertedJumps = map[asm.JumpOp]asm.JumpOp{
+	asm.JEq:  asm.JNE,
+	asm.JNE:  asm.JEq,
+	asm.JGT:  asm.JLE,
+	asm.JLE:  asm.JGT,
+	asm.JGE:  asm.JLT,
+	asm.JLT:  asm.JGE,
+	asm.JSGT: asm.JSLE,
+	asm.JSLE: asm.JSGT,
+	asm.JSGE: asm.JSLT,
+	asm.JSLT: asm.JSGE,
+}
@@ -0,0 +1,506 @@
+package cbpf
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/cilium/ebpf/asm"
+)
+
+// Registers of converted programs, the same as used by the kernel when
+// converting socket filters.
+const (
+	regA   = asm.R0
+	regX   = asm.R7
+	regCtx = asm.R6
+	// regTmp is clobbered by packet loads, so its value mustn't be live
+	// across them.
+	regTmp = asm.R2
+)
+
+// Ancillary data loaded from negative offsets, see SKF_AD_* in
+// <linux/filter.h>.
+const (
+	skfAdOff            = -0x1000
+	skfAdProtocol       = 0
+	skfAdPktType        = 4
+	skfAdIfindex        = 8
+	skfAdMark           = 20
+	skfAdQueue          = 24
+	skfAdRxHash         = 32
+	skfAdCPU            = 36
+	skfAdALUXorX        = 40
+	skfAdVLANTag        = 44
+	skfAdVLANTagPresent = 48
+	skfAdRandom         = 56
+	skfAdVLANTPID       = 60
+)
+
+// Offsets of fields in struct __sk_buff.
+const (
+	skbLen          = 0
+	skbPktType      = 4
+	skbMark         = 8
+	skbQueueMapping = 12
+	skbProtocol     = 16
+	skbVLANPresent  = 20
+	skbVLANTCI      = 24
+	skbVLANProto    = 28
+	skbIfindex      = 40
+	skbHash         = 68
+)
+
+// Convert translates a classic BPF filter into eBPF instructions for a
+// SocketFilter program.
+//
+// The result mirrors the kernel's own conversion of socket filters: A and
+// X live in R0 and R7, the context is kept in R6 and scratch memory is on
+// the stack. Packet loads use LoadAbs and LoadInd, which end the program
+// with a return value of zero if they are out of bounds, like in classic
+// BPF. Of the ancillary loads at SKF_AD_OFF, only those with an equivalent
+// in struct __sk_buff or a helper are supported.
+//
+// The filter is validated like the kernel does for classic BPF: jumps must
+// stay in bounds and the last instruction must return.
+func Convert(filter []Instruction) (asm.Instructions, error) {
+	if len(filter) == 0 {
+		return nil, errors.New("empty filter")
+	}
+	if len(filter) > maxInstructions {
+		return nil, fmt.Errorf("filter has %d instructions, the maximum is %d", len(filter), maxInstructions)
+	}
+
+	last := filter[len(filter)-1]
+	if last.class() != retClass || last.Op&0x18 == retX {
+		return nil, errors.New("last instruction must return K or A")
+	}
+
+	c := converter{
+		filter: filter,
+		starts: make([]int, len(filter)),
+	}
+
+	c.emit(
+		asm.Mov.Reg(regCtx, asm.R1),
+		asm.Mov.Imm32(regA, 0),
+		asm.Mov.Imm32(regX, 0),
+	)
+
+	// The verifier rejects reads from uninitialised stack, while
+	// classic BPF scratch memory starts out zeroed.
+	var scratch [memWords]bool
+	for _, ins := range filter {
+		if ins.usesScratch() && ins.K < memWords {
+			scratch[ins.K] = true
+		}
+	}
+	for k, used := range scratch {
+		if used {
+			c.emit(asm.StoreImm(asm.RFP, scratchOffset(uint32(k)), 0, asm.Word))
+		}
+	}
+
+	reachable, err := reachability(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, ins := range filter {
+		c.starts[i] = len(c.insns)
+		fixups := len(c.fixups)
+		if err := c.convert(i, ins); err != nil {
+			return nil, fmt.Errorf("instruction %d: %w", i, err)
+		}
+
+		if !reachable[i] {
+			// The verifier rejects unreachable instructions.
+			c.insns = c.insns[:c.starts[i]]
+			c.fixups = c.fixups[:fixups]
+		}
+	}
+
+	for _, f := range c.fixups {
+		offset := c.starts[f.target] - f.index - 1
+		if offset > math.MaxInt16 {
+			return nil, fmt.Errorf("instruction %d: jump out of range", f.target)
+		}
+		c.insns[f.index].Offset = int16(offset)
+	}
+
+	return c.insns, nil
+}
+
+// reachability returns which instructions of a filter can be executed.
+//
+// Classic BPF only allows forward jumps, so a single pass is enough.
+func reachability(filter []Instruction) ([]bool, error) {
+	reachable := make([]bool, len(filter))
+	reachable[0] = true
+
+	mark := func(i int, skip uint32) error {
+		target := uint64(i) + 1 + uint64(skip)
+		if target >= uint64(len(filter)) {
+			return fmt.Errorf("instruction %d: jump to %d is out of bounds", i, target)
+		}
+		reachable[target] = true
+		return nil
+	}
+
+	for i, ins := range filter {
+		if !reachable[i] {
+			continue
+		}
+
+		var err error
+		switch {
+		case ins.class() == retClass:
+		case ins.class() == asm.JumpClass && ins.opCode().JumpOp() == asm.Ja:
+			err = mark(i, ins.K)
+		case ins.class() == asm.JumpClass:
+			if err = mark(i, uint32(ins.Jt)); err == nil {
+				err = mark(i, uint32(ins.Jf))
+			}
+		default:
+			err = mark(i, 0)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return reachable, nil
+}
+
+// scratchOffset returns the offset of M[k] from the frame pointer.
+func scratchOffset(k uint32) int16 {
+	return -int16(memWords-k) * 4
+}
+
+func (ins Instruction) usesScratch() bool {
+	switch ins.class() {
+	case asm.LdClass, asm.LdXClass:
+		return ins.opCode().Mode() == asm.MemMode
+	case asm.StClass, asm.StXClass:
+		return true
+	default:
+		return false
+	}
+}
+
+type converter struct {
+	filter []Instruction
+	insns  asm.Instructions
+	// starts is the index of the first eBPF instruction of each
+	// classic instruction.
+	starts []int
+	fixups []fixup
+}
+
+// fixup is a jump whose offset is only known once all instructions
+// are converted.
+type fixup struct {
+	// index of the eBPF jump.
+	index int
+	// target is the index of the classic instruction to jump to.
+	target int
+}
+
+func (c *converter) emit(insns ...asm.Instruction) {
+	c.insns = append(c.insns, insns...)
+}
+
+// jump emits ins and arranges for it to jump to the classic instruction
+// at target.
+func (c *converter) jump(ins asm.Instruction, target int) {
+	ins.Reference = ""
+	c.fixups = append(c.fixups, fixup{len(c.insns), target})
+	c.emit(ins)
+}
+
+func (c *converter) target(i int, skip uint32) (int, error) {
+	target := uint64(i) + 1 + uint64(skip)
+	if target >= uint64(len(c.filter)) {
+		return 0, fmt.Errorf("jump to %d is out of bounds", target)
+	}
+	return int(target), nil
+}
+
+func (c *converter) convert(i int, ins Instruction) error {
+	if ins.Op > math.MaxUint8 {
+		return fmt.Errorf("invalid opcode %#x", ins.Op)
+	}
+
+	switch ins.class() {
+	case asm.LdClass:
+		return c.load(regA, ins)
+
+	case asm.LdXClass:
+		return c.load(regX, ins)
+
+	case asm.StClass, asm.StXClass:
+		if ins.Op&^uint16(asm.StXClass) != 0 {
+			return fmt.Errorf("invalid store opcode %#x", ins.Op)
+		}
+		if ins.K >= memWords {
+			return fmt.Errorf("scratch memory index %d is out of bounds", ins.K)
+		}
+		src := regA
+		if ins.class() == asm.StXClass {
+			src = regX
+		}
+		c.emit(asm.StoreMem(asm.RFP, scratchOffset(ins.K), src, asm.Word))
+		return nil
+
+	case asm.ALUClass:
+		return c.alu(ins)
+
+	case asm.JumpClass:
+		return c.branch(i, ins)
+
+	case retClass:
+		switch ins.Op &^ uint16(retClass) {
+		case retK:
+			c.emit(asm.Mov.Imm32(regA, int32(ins.K)))
+		case retA:
+		case retX:
+			c.emit(asm.Mov.Reg32(regA, regX))
+		default:
+			return fmt.Errorf("invalid return opcode %#x", ins.Op)
+		}
+		c.emit(asm.Return())
+		return nil
+
+	case miscClass:
+		switch ins.Op &^ uint16(miscClass) {
+		case miscTAX:
+			c.emit(asm.Mov.Reg32(regX, regA))
+		case miscTXA:
+			c.emit(asm.Mov.Reg32(regA, regX))
+		default:
+			return fmt.Errorf("invalid misc opcode %#x", ins.Op)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("invalid opcode %#x", ins.Op)
+	}
+}
+
+func (c *converter) load(dst asm.Register, ins Instruction) error {
+	op := ins.opCode()
+	size := op.Size()
+	if size == asm.DWord {
+		return fmt.Errorf("invalid load size in opcode %#x", ins.Op)
+	}
+
+	mode := op.Mode()
+	if dst == regX && (mode == asm.AbsMode || mode == asm.IndMode) {
+		return fmt.Errorf("invalid load mode in opcode %#x", ins.Op)
+	}
+	if mode != asm.AbsMode && mode != asm.IndMode && mode != mshMode && size != asm.Word {
+		return fmt.Errorf("invalid load size in opcode %#x", ins.Op)
+	}
+
+	switch mode {
+	case asm.ImmMode:
+		c.emit(asm.Mov.Imm32(dst, int32(ins.K)))
+
+	case asm.AbsMode:
+		if offset := int32(ins.K); offset >= skfAdOff && offset < 0 {
+			return c.ancillary(offset - skfAdOff)
+		}
+		c.emit(asm.LoadAbs(int32(ins.K), size))
+
+	case asm.IndMode:
+		c.emit(asm.LoadInd(regA, regX, int32(ins.K), size))
+
+	case asm.MemMode:
+		if ins.K >= memWords {
+			return fmt.Errorf("scratch memory index %d is out of bounds", ins.K)
+		}
+		c.emit(asm.LoadMem(dst, asm.RFP, scratchOffset(ins.K), asm.Word))
+
+	case lenMode:
+		c.emit(asm.LoadMem(dst, regCtx, skbLen, asm.Word))
+
+	case mshMode:
+		if dst != regX || size != asm.Byte {
+			return fmt.Errorf("invalid load opcode %#x", ins.Op)
+		}
+
+		// X = 4 * (P[k] & 0xf), while preserving A. X is overwritten
+		// anyway, so it holds A during the packet load.
+		c.emit(
+			asm.Mov.Reg(regX, regA),
+			asm.LoadAbs(int32(ins.K), asm.Byte),
+			asm.And.Imm32(regA, 0xf),
+			asm.LSh.Imm32(regA, 2),
+			asm.Mov.Reg(regTmp, regX),
+			asm.Mov.Reg(regX, regA),
+			asm.Mov.Reg(regA, regTmp),
+		)
+
+	default:
+		return fmt.Errorf("invalid load mode in opcode %#x", ins.Op)
+	}
+
+	return nil
+}
+
+func (c *converter) ancillary(offset int32) error {
+	field := func(offset int16) {
+		c.emit(asm.LoadMem(regA, regCtx, offset, asm.Word))
+	}
+
+	switch offset {
+	case skfAdProtocol:
+		// Classic BPF returns the protocol in host byte order.
+		field(skbProtocol)
+		c.emit(asm.HostTo(asm.BE, regA, asm.Half))
+	case skfAdPktType:
+		field(skbPktType)
+	case skfAdIfindex:
+		field(skbIfindex)
+	case skfAdMark:
+		field(skbMark)
+	case skfAdQueue:
+		field(skbQueueMapping)
+	case skfAdRxHash:
+		field(skbHash)
+	case skfAdVLANTag:
+		field(skbVLANTCI)
+	case skfAdVLANTagPresent:
+		field(skbVLANPresent)
+	case skfAdVLANTPID:
+		field(skbVLANProto)
+		c.emit(asm.HostTo(asm.BE, regA, asm.Half))
+	case skfAdCPU:
+		c.emit(asm.FnGetSmpProcessorId.Call())
+	case skfAdRandom:
+		c.emit(asm.FnGetPrandomU32.Call())
+	case skfAdALUXorX:
+		c.emit(asm.Xor.Reg32(regA, regX))
+	default:
+		return fmt.Errorf("unsupported ancillary load at SKF_AD_OFF+%d", offset)
+	}
+
+	return nil
+}
+
+func (c *converter) alu(ins Instruction) error {
+	op := ins.opCode().ALUOp()
+	src := ins.opCode().Source()
+
+	switch op {
+	case asm.Neg:
+		c.emit(asm.Neg.Imm32(regA, 0))
+		return nil
+
+	case asm.Add, asm.Sub, asm.Mul, asm.Or, asm.And, asm.Xor:
+
+	case asm.LSh, asm.RSh:
+		if src == asm.ImmSource && ins.K >= 32 {
+			return fmt.Errorf("shift by %d is out of range", ins.K)
+		}
+
+	case asm.Div, asm.Mod:
+		if src == asm.ImmSource && ins.K == 0 {
+			return errors.New("division by zero")
+		}
+
+		if src == asm.RegSource {
+			// Classic BPF returns zero when dividing by zero.
+			check := asm.JNE.Imm(regX, 0, "")
+			check.Offset = 2
+			c.emit(
+				check,
+				asm.Mov.Imm32(regA, 0),
+				asm.Return(),
+			)
+		}
+
+	default:
+		return fmt.Errorf("invalid ALU opcode %#x", ins.Op)
+	}
+
+	if src == asm.RegSource {
+		c.emit(op.Reg32(regA, regX))
+	} else {
+		c.emit(op.Imm32(regA, int32(ins.K)))
+	}
+	return nil
+}
+
+// inverseJumps negates conditions, which saves a jump if only the false
+// branch leaves the fall through path.
+var inverseJumps = map[asm.JumpOp]asm.JumpOp{
+	asm.JEq: asm.JNE,
+	asm.JGT: asm.JLE,
+	asm.JGE: asm.JLT,
+}
+
+func (c *converter) branch(i int, ins Instruction) error {
+	op := ins.opCode().JumpOp()
+
+	if op == asm.Ja {
+		target, err := c.target(i, ins.K)
+		if err != nil {
+			return err
+		}
+		if target != i+1 {
+			c.jump(asm.Instruction{OpCode: asm.Ja.Op(asm.ImmSource)}, target)
+		}
+		return nil
+	}
+
+	switch op {
+	case asm.JEq, asm.JGT, asm.JGE, asm.JSet:
+	default:
+		return fmt.Errorf("invalid jump opcode %#x", ins.Op)
+	}
+
+	targetTrue, err := c.target(i, uint32(ins.Jt))
+	if err != nil {
+		return err
+	}
+	targetFalse, err := c.target(i, uint32(ins.Jf))
+	if err != nil {
+		return err
+	}
+
+	// Immediates are sign extended to 64 bits, while classic BPF
+	// compares unsigned 32 bit values. Move large ones into a register.
+	src, imm := regX, ins.opCode().Source() == asm.ImmSource
+	if imm && int32(ins.K) < 0 {
+		c.emit(asm.Mov.Imm32(regTmp, int32(ins.K)))
+		src, imm = regTmp, false
+	}
+
+	cond := func(op asm.JumpOp) asm.Instruction {
+		if imm {
+			return op.Imm(regA, int32(ins.K), "")
+		}
+		return op.Reg(regA, src, "")
+	}
+
+	inverse, hasInverse := inverseJumps[op]
+	switch {
+	case targetTrue == targetFalse:
+		if targetTrue != i+1 {
+			c.jump(asm.Instruction{OpCode: asm.Ja.Op(asm.ImmSource)}, targetTrue)
+		}
+
+	case targetFalse == i+1:
+		c.jump(cond(op), targetTrue)
+
+	case targetTrue == i+1 && hasInverse:
+		c.jump(cond(inverse), targetFalse)
+
+	default:
+		c.jump(cond(op), targetTrue)
+		c.jump(asm.Instruction{OpCode: asm.Ja.Op(asm.ImmSource)}, targetFalse)
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package cbpf
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal/testutils"
+)
+
+// tcpPort80 is the output of "tcpdump -dd ip and tcp dst port 80".
+var tcpPort80 = []Instruction{
+	{0x28, 0, 0, 0x0000000c},
+	{0x15, 0, 8, 0x00000800},
+	{0x30, 0, 0, 0x00000017},
+	{0x15, 0, 6, 0x00000006},
+	{0x28, 0, 0, 0x00000014},
+	{0x45, 4, 0, 0x00001fff},
+	{0xb1, 0, 0, 0x0000000e},
+	{0x48, 0, 0, 0x00000010},
+	{0x15, 0, 1, 0x00000050},
+	{0x6, 0, 0, 0x0000ffff},
+	{0x6, 0, 0, 0x00000000},
+}
+
+// ipv4Packet returns an Ethernet frame with an IPv4 header and the first
+// bytes of a TCP or UDP header.
+func ipv4Packet(proto uint8, dstPort uint16) []byte {
+	pkt := make([]byte, 14+20+20)
+	binary.BigEndian.PutUint16(pkt[12:], 0x0800)
+	ip := pkt[14:]
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:], uint16(len(ip)))
+	ip[8] = 64
+	ip[9] = proto
+	copy(ip[12:], []byte{192, 0, 2, 1, 192, 0, 2, 2})
+	binary.BigEndian.PutUint16(ip[20:], 12345)
+	binary.BigEndian.PutUint16(ip[22:], dstPort)
+	return pkt
+}
+
+func mustRun(t *testing.T, filter []Instruction, in []byte) uint32 {
+	t.Helper()
+
+	insns, err := Convert(filter)
+	if err != nil {
+		t.Fatal("Can't convert filter:", err)
+	}
+
+	// Test runs of SocketFilter programs start at the network header,
+	// unlike filters attached to packet sockets. SchedCLS programs
+	// support the same instructions but see the link layer header.
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Type:         ebpf.SchedCLS,
+		Instructions: insns,
+		License:      "MIT",
+	})
+	if err != nil {
+		t.Fatalf("Can't load converted filter: %v\n%s", err, insns)
+	}
+	defer prog.Close()
+
+	ret, _, err := prog.Test(in)
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+func TestConvertTCPDump(t *testing.T) {
+	insns, err := Convert(tcpPort80)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Type:         ebpf.SocketFilter,
+		Instructions: insns,
+		License:      "MIT",
+	})
+	if err != nil {
+		t.Fatal("Can't load socket filter:", err)
+	}
+	prog.Close()
+
+	for name, test := range map[string]struct {
+		pkt  []byte
+		want uint32
+	}{
+		"tcp 80":  {ipv4Packet(6, 80), 0xffff},
+		"tcp 443": {ipv4Packet(6, 443), 0},
+		"udp 80":  {ipv4Packet(17, 80), 0},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if have := mustRun(t, tcpPort80, test.pkt); have != test.want {
+				t.Errorf("Expected %#x, got %#x", test.want, have)
+			}
+		})
+	}
+}
+
+func TestConvertSemantics(t *testing.T) {
+	pkt := ipv4Packet(6, 80)
+
+	for name, test := range map[string]struct {
+		filter []Instruction
+		want   uint32
+	}{
+		"scratch memory": {[]Instruction{
+			{0x00, 0, 0, 7}, // ld #7
+			{0x07, 0, 0, 0}, // tax
+			{0x00, 0, 0, 3}, // ld #3
+			{0x0c, 0, 0, 0}, // add x
+			{0x02, 0, 0, 5}, // st M[5]
+			{0x61, 0, 0, 5}, // ldx M[5]
+			{0x87, 0, 0, 0}, // txa
+			{0x24, 0, 0, 2}, // mul #2
+			{0x16, 0, 0, 0}, // ret a
+		}, 20},
+		"uninitialised scratch memory": {[]Instruction{
+			{0x60, 0, 0, 15}, // ld M[15]
+			{0x16, 0, 0, 0},  // ret a
+		}, 0},
+		"division by zero": {[]Instruction{
+			{0x00, 0, 0, 10}, // ld #10
+			{0x3c, 0, 0, 0},  // div x
+			{0x06, 0, 0, 1},  // ret #1
+		}, 0},
+		"unsigned comparison": {[]Instruction{
+			{0x00, 0, 0, 0x90000000}, // ld #0x90000000
+			{0x25, 0, 1, 0x80000000}, // jgt #0x80000000, 0, 1
+			{0x06, 0, 0, 1},          // ret #1
+			{0x06, 0, 0, 2},          // ret #2
+		}, 1},
+		"jump always": {[]Instruction{
+			{0x05, 0, 0, 1}, // ja +1
+			{0x06, 0, 0, 1}, // ret #1, unreachable
+			{0x06, 0, 0, 2}, // ret #2
+		}, 2},
+		"packet length": {[]Instruction{
+			{0x80, 0, 0, 0}, // ld len
+			{0x16, 0, 0, 0}, // ret a
+		}, uint32(len(pkt))},
+		"out of bounds load": {[]Instruction{
+			{0x20, 0, 0, 1000}, // ld [1000]
+			{0x06, 0, 0, 1},    // ret #1
+		}, 0},
+		"protocol": {[]Instruction{
+			{0x28, 0, 0, 0xfffff000}, // ldh [proto]
+			{0x16, 0, 0, 0},          // ret a
+		}, 0x0800},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if have := mustRun(t, test.filter, pkt); have != test.want {
+				t.Errorf("Expected %#x, got %#x", test.want, have)
+			}
+		})
+	}
+}
+
+func TestConvertInvalid(t *testing.T) {
+	for name, filter := range map[string][]Instruction{
+		"empty":             nil,
+		"no return":         {{0x00, 0, 0, 0}},
+		"return x":          {{0x0e, 0, 0, 0}},
+		"jump out of range": {{0x15, 1, 0, 0}, {0x06, 0, 0, 0}},
+		"division by zero":  {{0x34, 0, 0, 0}, {0x06, 0, 0, 0}},
+		"scratch index":     {{0x02, 0, 0, 16}, {0x06, 0, 0, 0}},
+		"shift":             {{0x64, 0, 0, 32}, {0x06, 0, 0, 0}},
+		"invalid opcode":    {{0xff, 0, 0, 0}, {0x06, 0, 0, 0}},
+		"ancillary":         {{0x20, 0, 0, 0xfffff000 + 12}, {0x06, 0, 0, 0}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Convert(filter); err == nil {
+				t.Error("Convert doesn't reject invalid filter")
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+// Package cbpf supports classic BPF, as used by socket filters, tcpdump
+// and seccomp.
+//
+// Classic BPF shares most of its opcodes with eBPF, so the types of the
+// asm package are used where possible.
+package cbpf
+
+import (
+	"fmt"
+
+	"github.com/cilium/ebpf/asm"
+)
+
+// Instruction is a classic BPF instruction, equivalent to struct
+// sock_filter.
+//
+// The field order matches the output of "tcpdump -dd", so filters can be
+// pasted as unkeyed composite literals:
+//
+//	[]cbpf.Instruction{
+//		{0x28, 0, 0, 0x0000000c},
+//		...
+//	}
+type Instruction struct {
+	Op uint16
+	// Jt and Jf are the number of instructions to skip if the condition
+	// of a conditional jump is true or false, respectively.
+	Jt, Jf uint8
+	K      uint32
+}
+
+// Classes which only exist in classic BPF. Other classes are the same as
+// in eBPF, see asm.Class.
+const (
+	retClass  asm.Class = 0x06
+	miscClass asm.Class = 0x07
+)
+
+// Modes which only exist in classic BPF, see asm.Mode.
+const (
+	lenMode asm.Mode = 0x80
+	mshMode asm.Mode = 0xa0
+)
+
+// Operations of miscClass.
+const (
+	miscTAX = 0x00
+	miscTXA = 0x80
+)
+
+// Return value sources of retClass.
+const (
+	retK = 0x00
+	retX = 0x08
+	retA = 0x10
+)
+
+// memWords is the number of scratch memory slots, BPF_MEMWORDS.
+const memWords = 16
+
+// maxInstructions is the maximum length of a filter, BPF_MAXINSNS.
+const maxInstructions = 4096
+
+func (ins Instruction) opCode() asm.OpCode {
+	return asm.OpCode(ins.Op)
+}
+
+func (ins Instruction) class() asm.Class {
+	return ins.opCode().Class()
+}
+
+func (ins Instruction) String() string {
+	return fmt.Sprintf("{%#02x, %d, %d, %#08x}", ins.Op, ins.Jt, ins.Jf, ins.K)
+}
+
+func op(class asm.Class, bits uint16) uint16 {
+	return uint16(class) | bits
+}
+
+// LoadAbs emits `A = *(size *)(data + offset)`.
+//
+// Packet data is loaded in network byte order.
+func LoadAbs(offset uint32, size asm.Size) Instruction {
+	return Instruction{Op: op(asm.LdClass, uint16(asm.AbsMode)|uint16(size)), K: offset}
+}
+
+// LoadInd emits `A = *(size *)(data + X + offset)`.
+func LoadInd(offset uint32, size asm.Size) Instruction {
+	return Instruction{Op: op(asm.LdClass, uint16(asm.IndMode)|uint16(size)), K: offset}
+}
+
+// LoadImm emits `A = value`.
+func LoadImm(value uint32) Instruction {
+	return Instruction{Op: op(asm.LdClass, uint16(asm.ImmMode)|uint16(asm.Word)), K: value}
+}
+
+// LoadMem emits `A = M[k]`.
+func LoadMem(k uint32) Instruction {
+	return Instruction{Op: op(asm.LdClass, uint16(asm.MemMode)|uint16(asm.Word)), K: k}
+}
+
+// LoadLen emits `A = len`, the length of the packet or of struct
+// seccomp_data.
+func LoadLen() Instruction {
+	return Instruction{Op: op(asm.LdClass, uint16(lenMode)|uint16(asm.Word))}
+}
+
+// LoadXImm emits `X = value`.
+func LoadXImm(value uint32) Instruction {
+	return Instruction{Op: op(asm.LdXClass, uint16(asm.ImmMode)|uint16(asm.Word)), K: value}
+}
+
+// LoadXMem emits `X = M[k]`.
+func LoadXMem(k uint32) Instruction {
+	return Instruction{Op: op(asm.LdXClass, uint16(asm.MemMode)|uint16(asm.Word)), K: k}
+}
+
+// LoadXLen emits `X = len`.
+func LoadXLen() Instruction {
+	return Instruction{Op: op(asm.LdXClass, uint16(lenMode)|uint16(asm.Word))}
+}
+
+// LoadXIPHeaderLen emits `X = 4 * (*(u8 *)(data + offset) & 0xf)`, which is
+// the length of an IPv4 header starting at offset.
+func LoadXIPHeaderLen(offset uint32) Instruction {
+	return Instruction{Op: op(asm.LdXClass, uint16(mshMode)|uint16(asm.Byte)), K: offset}
+}
+
+// Store emits `M[k] = A`.
+func Store(k uint32) Instruction {
+	return Instruction{Op: op(asm.StClass, 0), K: k}
+}
+
+// StoreX emits `M[k] = X`.
+func StoreX(k uint32) Instruction {
+	return Instruction{Op: op(asm.StXClass, 0), K: k}
+}
+
+// ALU emits `A = A op value`.
+func ALU(aluOp asm.ALUOp, value uint32) Instruction {
+	return Instruction{Op: op(asm.ALUClass, uint16(aluOp)|uint16(asm.ImmSource)), K: value}
+}
+
+// ALUX emits `A = A op X`.
+func ALUX(aluOp asm.ALUOp) Instruction {
+	return Instruction{Op: op(asm.ALUClass, uint16(aluOp)|uint16(asm.RegSource))}
+}
+
+// Neg emits `A = -A`.
+func Neg() Instruction {
+	return Instruction{Op: op(asm.ALUClass, uint16(asm.Neg))}
+}
+
+// Ja skips the next skip instructions.
+func Ja(skip uint32) Instruction {
+	return Instruction{Op: op(asm.JumpClass, uint16(asm.Ja)), K: skip}
+}
+
+// Jump compares A to value, and skips jt instructions if the condition
+// is true and jf instructions otherwise.
+//
+// jumpOp is one of JEq, JGT, JGE or JSet.
+func Jump(jumpOp asm.JumpOp, value uint32, jt, jf uint8) Instruction {
+	return Instruction{Op: op(asm.JumpClass, uint16(jumpOp)|uint16(asm.ImmSource)), Jt: jt, Jf: jf, K: value}
+}
+
+// JumpX compares A to X, see Jump.
+func JumpX(jumpOp asm.JumpOp, jt, jf uint8) Instruction {
+	return Instruction{Op: op(asm.JumpClass, uint16(jumpOp)|uint16(asm.RegSource)), Jt: jt, Jf: jf}
+}
+
+// Ret emits `return value`.
+func Ret(value uint32) Instruction {
+	return Instruction{Op: op(retClass, retK), K: value}
+}
+
+// RetA emits `return A`.
+func RetA() Instruction {
+	return Instruction{Op: op(retClass, retA)}
+}
+
+// TAX emits `X = A`.
+func TAX() Instruction {
+	return Instruction{Op: op(miscClass, miscTAX)}
+}
+
+// TXA emits `A = X`.
+func TXA() Instruction {
+	return Instruction{Op: op(miscClass, miscTXA)}
+}
@@ -0,0 +1,54 @@
+package cbpf
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cilium/ebpf/asm"
+)
+
+func TestBuilders(t *testing.T) {
+	have := []Instruction{
+		LoadAbs(12, asm.Half),
+		Jump(asm.JEq, 0x800, 0, 8),
+		LoadAbs(23, asm.Byte),
+		Jump(asm.JEq, 6, 0, 6),
+		LoadAbs(20, asm.Half),
+		Jump(asm.JSet, 0x1fff, 4, 0),
+		LoadXIPHeaderLen(14),
+		LoadInd(16, asm.Half),
+		Jump(asm.JEq, 80, 0, 1),
+		Ret(0xffff),
+		Ret(0),
+	}
+
+	if !reflect.DeepEqual(have, tcpPort80) {
+		t.Errorf("Builders don't match tcpdump output:\n%v\n%v", have, tcpPort80)
+	}
+
+	for _, test := range []struct {
+		have Instruction
+		want uint16
+	}{
+		{LoadImm(0), 0x00},
+		{LoadMem(0), 0x60},
+		{LoadLen(), 0x80},
+		{LoadXImm(0), 0x01},
+		{LoadXMem(0), 0x61},
+		{LoadXLen(), 0x81},
+		{Store(0), 0x02},
+		{StoreX(0), 0x03},
+		{ALU(asm.Add, 0), 0x04},
+		{ALUX(asm.Div), 0x3c},
+		{Neg(), 0x84},
+		{Ja(0), 0x05},
+		{JumpX(asm.JGT, 0, 0), 0x2d},
+		{RetA(), 0x16},
+		{TAX(), 0x07},
+		{TXA(), 0x87},
+	} {
+		if test.have.Op != test.want {
+			t.Errorf("Expected opcode %#x, got %v", test.want, test.have)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package cbpf
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+// SeccompAction is the return value of a seccomp filter.
+//
+// The values match SECCOMP_RET_* in <linux/seccomp.h>.
+type SeccompAction uint32
+
+// Valid SeccompActions, from highest to lowest precedence.
+const (
+	SeccompKillProcess SeccompAction = 0x80000000
+	SeccompKillThread  SeccompAction = 0x00000000
+	SeccompTrap        SeccompAction = 0x00030000
+	// SeccompErrno fails the syscall with the errno given via WithData.
+	SeccompErrno     SeccompAction = 0x00050000
+	SeccompUserNotif SeccompAction = 0x7fc00000
+	SeccompTrace     SeccompAction = 0x7ff00000
+	SeccompLog       SeccompAction = 0x7ffc0000
+	SeccompAllow     SeccompAction = 0x7fff0000
+)
+
+// WithData sets the data passed along with the action, for example the
+// errno returned by SeccompErrno.
+func (sa SeccompAction) WithData(data uint16) SeccompAction {
+	return sa&0xffff0000 | SeccompAction(data)
+}
+
+// Return emits an instruction returning the action.
+func (sa SeccompAction) Return() Instruction {
+	return Ret(uint32(sa))
+}
+
+// Offsets of fields in struct seccomp_data, to be used with LoadAbs.
+const (
+	SeccompDataNr                 = 0
+	SeccompDataArch               = 4
+	SeccompDataInstructionPointer = 8
+)
+
+// SeccompDataArg returns the offset of the lower 32 bits of the nth
+// argument of the syscall in struct seccomp_data. The upper 32 bits are in
+// the adjacent word.
+//
+// Arguments are stored in host byte order, so the offset differs between
+// little and big endian platforms.
+func SeccompDataArg(n int) uint32 {
+	offset := uint32(16 + 8*n)
+	if !internal.IsLittleEndian(internal.NativeEndian) {
+		offset += 4
+	}
+	return offset
+}
+
+// auditArches maps GOARCH to the AUDIT_ARCH_* values in <linux/audit.h>.
+var auditArches = map[string]uint32{
+	"386":      0x40000003,
+	"amd64":    0xc000003e,
+	"arm":      0x40000028,
+	"arm64":    0xc00000b7,
+	"mips":     0x00000008,
+	"mipsle":   0x40000008,
+	"mips64":   0x80000008,
+	"mips64le": 0xc0000008,
+	"ppc64":    0x80000015,
+	"ppc64le":  0xc0000015,
+	"riscv64":  0xc00000f3,
+	"s390x":    0x80000016,
+}
+
+// SeccompNativeArch returns the architecture of the host as found in the
+// arch field of struct seccomp_data.
+//
+// Filters must check the architecture before interpreting syscall numbers,
+// since those differ between architectures and a process may invoke the
+// syscalls of another one.
+func SeccompNativeArch() (uint32, error) {
+	arch, ok := auditArches[runtime.GOARCH]
+	if !ok {
+		return 0, fmt.Errorf("no seccomp architecture for %s: %w", runtime.GOARCH, internal.ErrNotSupported)
+	}
+	return arch, nil
+}
+
+// SeccompFlags control how a seccomp filter is installed.
+//
+// The values match SECCOMP_FILTER_FLAG_* in <linux/seccomp.h>.
+type SeccompFlags uint
+
+const (
+	// SeccompFlagLog logs all actions except SeccompAllow.
+	SeccompFlagLog SeccompFlags = 1 << (iota + 1)
+	// SeccompFlagSpecAllow disables the speculative store bypass
+	// mitigation.
+	SeccompFlagSpecAllow
+)
+
+// seccompFlagTSync applies a filter to all threads of a process.
+const seccompFlagTSync = 1
+
+// InstallSeccomp installs a seccomp filter for all threads of the process.
+//
+// The filter is executed for each syscall with struct seccomp_data as its
+// input and must return a SeccompAction. Filters can't be removed, and
+// installing another one executes both.
+//
+// Since unprivileged processes may only install filters with the
+// no_new_privs attribute, it is set for the process. It can't be cleared
+// again and prevents gaining privileges via execve, for example via setuid
+// binaries.
+func InstallSeccomp(filter []Instruction, flags SeccompFlags) error {
+	if len(filter) == 0 || len(filter) > maxInstructions {
+		return fmt.Errorf("filter must have between 1 and %d instructions", maxInstructions)
+	}
+
+	raw := make([]unix.SockFilter, 0, len(filter))
+	for _, ins := range filter {
+		raw = append(raw, unix.SockFilter{Code: ins.Op, Jt: ins.Jt, Jf: ins.Jf, K: ins.K})
+	}
+
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("set no_new_privs: %w", err)
+	}
+
+	// Go programs are multi-threaded, so a filter for only the calling
+	// thread is rarely useful.
+	tid, err := unix.SeccompSetModeFilter(uint(flags)|seccompFlagTSync, raw)
+	if err != nil {
+		return fmt.Errorf("install seccomp filter: %w", err)
+	}
+	if tid != 0 {
+		return fmt.Errorf("install seccomp filter: can't synchronize thread %d", tid)
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package cbpf
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+
+	"github.com/cilium/ebpf/asm"
+)
+
+// seccompChildEnv makes the test binary install a filter, see
+// TestInstallSeccomp.
+const seccompChildEnv = "CBPF_SECCOMP_CHILD"
+
+func TestInstallSeccomp(t *testing.T) {
+	arch, err := SeccompNativeArch()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	if os.Getenv(seccompChildEnv) == "" {
+		// Filters can't be removed, so install them in a child process.
+		cmd := exec.Command(os.Args[0], "-test.run=^TestInstallSeccomp$", "-test.v")
+		cmd.Env = append(os.Environ(), seccompChildEnv+"=1")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Child failed: %v\n%s", err, out)
+		}
+		return
+	}
+
+	filter := []Instruction{
+		LoadAbs(SeccompDataArch, asm.Word),
+		Jump(asm.JEq, arch, 1, 0),
+		SeccompKillProcess.Return(),
+		LoadAbs(SeccompDataNr, asm.Word),
+		Jump(asm.JEq, uint32(syscall.SYS_GETPPID), 0, 1),
+		SeccompErrno.WithData(uint16(syscall.EPERM)).Return(),
+		SeccompAllow.Return(),
+	}
+
+	if err := InstallSeccomp(filter, 0); err != nil {
+		t.Fatal("Can't install filter:", err)
+	}
+
+	// getppid can't fail, so Go doesn't check for errors.
+	if ppid := os.Getppid(); ppid != -int(syscall.EPERM) {
+		t.Error("Expected getppid to fail with EPERM, got", ppid)
+	}
+	if pid := os.Getpid(); pid <= 0 {
+		t.Error("getpid is denied")
+	}
+}
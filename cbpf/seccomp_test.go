@@ -0,0 +1,30 @@
+package cbpf
+
+import (
+	"testing"
+
+	"github.com/cilium/ebpf/internal"
+)
+
+func TestSeccompAction(t *testing.T) {
+	if have := SeccompErrno.WithData(1); have != 0x00050001 {
+		t.Errorf("Unexpected action %#x", have)
+	}
+	if have := SeccompErrno.WithData(1).WithData(2); have != 0x00050002 {
+		t.Errorf("WithData doesn't replace data: %#x", have)
+	}
+
+	want := uint32(16 + 8)
+	if !internal.IsLittleEndian(internal.NativeEndian) {
+		want += 4
+	}
+	if have := SeccompDataArg(1); have != want {
+		t.Errorf("Expected offset %d for argument 1, got %d", want, have)
+	}
+}
+
+func TestInstallSeccompInvalid(t *testing.T) {
+	if err := InstallSeccomp(nil, 0); err == nil {
+		t.Error("InstallSeccomp accepts an empty filter")
+	}
+}
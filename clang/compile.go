@@ -0,0 +1,294 @@
+// Package clang compiles C to eBPF at runtime.
+//
+// This is useful for tools which generate programs on the fly, for example
+// from a tracing expression. Prefer compiling ahead of time using bpf2go
+// where possible, since it doesn't require a compiler on the target.
+//
+//	obj, err := clang.Compile([]byte(src), &clang.Options{
+//		KernelHeaders: headers, // from clang.FindKernelHeaders
+//	})
+//	spec, err := ebpf.LoadCollectionSpecFromReader(bytes.NewReader(obj))
+//
+// Requires at least clang 9.
+package clang
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+// Options control compilation.
+type Options struct {
+	// The compiler to use. Defaults to the first of clang, clang-20, ...,
+	// clang-9 found in PATH.
+	CC string
+
+	// If not empty, C is compiled to LLVM bitcode for the host, which is then
+	// turned into an eBPF object by this llc binary. This is necessary when
+	// including headers which contain inline assembly for the host, for
+	// example kernel headers.
+	LLC string
+
+	// The target to compile for: bpf, bpfel or bpfeb. Defaults to bpf, which
+	// is the byte order of the host.
+	Target string
+
+	// The instruction set to use, passed as -mcpu. For example "probe"
+	// selects the newest version supported by the running kernel. Uses the
+	// compiler's default if empty.
+	CPU string
+
+	// Additional directories to search for headers.
+	IncludeDirs []string
+
+	// The directory containing kernel headers, see FindKernelHeaders. Kernel
+	// headers aren't used if empty.
+	KernelHeaders string
+
+	// Additional flags passed to CC, which take precedence over the defaults.
+	CFlags []string
+}
+
+// Compile compiles C source code to an eBPF object file.
+//
+// Includes are resolved relative to the current working directory and
+// Options.IncludeDirs. opts may be nil.
+func Compile(source []byte, opts *Options) ([]byte, error) {
+	return compile(bytes.NewReader(source), "-", opts)
+}
+
+// CompileFile compiles a C file to an eBPF object file.
+//
+// opts may be nil.
+func CompileFile(file string, opts *Options) ([]byte, error) {
+	return compile(nil, file, opts)
+}
+
+func compile(stdin *bytes.Reader, file string, opts *Options) ([]byte, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	cc := opts.CC
+	if cc == "" {
+		var err error
+		cc, err = findCompiler()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	args, err := opts.args()
+	if err != nil {
+		return nil, err
+	}
+
+	// Write the object (or bitcode) to stdout.
+	args = append(args, "-x", "c", "-c", file, "-o", "-")
+
+	obj, err := run(cc, args, stdin)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.LLC == "" {
+		return obj, nil
+	}
+
+	return run(opts.LLC, opts.llcArgs(), bytes.NewReader(obj))
+}
+
+// args returns the flags passed to clang, excluding input and output.
+func (opts *Options) args() ([]string, error) {
+	target := opts.Target
+	switch target {
+	case "":
+		target = "bpf"
+	case "bpf", "bpfel", "bpfeb":
+	default:
+		return nil, fmt.Errorf("unsupported target %q", target)
+	}
+
+	args := []string{
+		// Code needs to be optimized, otherwise the verifier will often fail
+		// to understand it.
+		"-O2",
+		// We always want BTF to be generated, so enforce debug symbols.
+		"-g",
+		// Don't include the clang version.
+		"-fno-ident",
+		// The macros in bpf_tracing.h need to know the architecture
+		// of the kernel.
+		"-D__TARGET_ARCH_" + targetArch(),
+		"-Wno-unused-value",
+		"-Wno-pointer-sign",
+		"-Wno-compare-distinct-pointer-types",
+	}
+
+	if opts.LLC != "" {
+		args = append(args, "-emit-llvm")
+	} else {
+		args = append(args, "-target", target)
+		if opts.CPU != "" {
+			args = append(args, "-mcpu="+opts.CPU)
+		}
+	}
+
+	for _, dir := range opts.IncludeDirs {
+		args = append(args, "-I", dir)
+	}
+
+	if opts.KernelHeaders != "" {
+		args = append(args, kernelHeaderArgs(opts.KernelHeaders)...)
+	}
+
+	return append(args, opts.CFlags...), nil
+}
+
+// llcArgs returns the flags passed to llc, excluding input and output.
+func (opts *Options) llcArgs() []string {
+	march := opts.Target
+	if march == "" {
+		march = "bpf"
+	}
+
+	args := []string{"-march=" + march, "-filetype=obj", "-o", "-"}
+	if opts.CPU != "" {
+		args = append(args, "-mcpu="+opts.CPU)
+	}
+	return args
+}
+
+// run executes a binary and returns its output.
+func run(name string, args []string, stdin *bytes.Reader) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return nil, fmt.Errorf("%s: %w:\n%s", name, err, msg)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// ErrNoCompiler is returned if Options.CC is empty and no clang binary
+// can be found.
+var ErrNoCompiler = errors.New("no clang binary found")
+
+func findCompiler() (string, error) {
+	candidates := []string{"clang"}
+	for v := 20; v >= 9; v-- {
+		candidates = append(candidates, fmt.Sprintf("clang-%d", v))
+	}
+
+	for _, name := range candidates {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+
+	return "", ErrNoCompiler
+}
+
+// kernelArches maps GOARCH to the name of the architecture in the kernel
+// source tree.
+var kernelArches = map[string]string{
+	"386":      "x86",
+	"amd64":    "x86",
+	"arm":      "arm",
+	"arm64":    "arm64",
+	"mips":     "mips",
+	"mipsle":   "mips",
+	"mips64":   "mips",
+	"mips64le": "mips",
+	"ppc64":    "powerpc",
+	"ppc64le":  "powerpc",
+	"riscv64":  "riscv",
+	"s390x":    "s390",
+}
+
+func targetArch() string {
+	if arch, ok := kernelArches[runtime.GOARCH]; ok {
+		return arch
+	}
+	return runtime.GOARCH
+}
+
+// kernelHeaderArgs returns the flags needed to include kernel headers
+// from dir, mirroring the kernel's own build.
+func kernelHeaderArgs(dir string) []string {
+	arch := filepath.Join(dir, "arch", targetArch())
+
+	return []string{
+		"-I", filepath.Join(arch, "include"),
+		"-I", filepath.Join(arch, "include", "generated"),
+		"-I", filepath.Join(dir, "include"),
+		"-I", filepath.Join(arch, "include", "uapi"),
+		"-I", filepath.Join(arch, "include", "generated", "uapi"),
+		"-I", filepath.Join(dir, "include", "uapi"),
+		"-I", filepath.Join(dir, "include", "generated", "uapi"),
+		"-include", filepath.Join(dir, "include", "linux", "kconfig.h"),
+		"-D__KERNEL__",
+		"-D__BPF_TRACING__",
+	}
+}
+
+// FindKernelHeaders returns the directory containing the headers of the
+// running kernel.
+//
+// The usual locations used by distributions are searched, for example
+// /lib/modules/$(uname -r)/build. Returns an error wrapping os.ErrNotExist
+// if the headers aren't installed.
+func FindKernelHeaders() (string, error) {
+	release, err := kernelRelease()
+	if err != nil {
+		return "", err
+	}
+
+	return findKernelHeaders(release, "/")
+}
+
+func findKernelHeaders(release, root string) (string, error) {
+	candidates := []string{
+		filepath.Join(root, "lib", "modules", release, "build"),
+		filepath.Join(root, "lib", "modules", release, "source"),
+		filepath.Join(root, "usr", "src", "linux-headers-"+release),
+		filepath.Join(root, "usr", "src", "kernels", release),
+	}
+
+	for _, dir := range candidates {
+		// The top level include directory is always present, unlike
+		// generated headers which may be in a separate directory.
+		if _, err := os.Stat(filepath.Join(dir, "include", "linux")); err == nil {
+			return dir, nil
+		}
+	}
+
+	return "", fmt.Errorf("headers for kernel %s: %w", release, os.ErrNotExist)
+}
+
+func kernelRelease() (string, error) {
+	var uname unix.Utsname
+	if err := unix.Uname(&uname); err != nil {
+		return "", fmt.Errorf("uname: %w", err)
+	}
+
+	return unix.ByteSliceToString(uname.Release[:]), nil
+}
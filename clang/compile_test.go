@@ -0,0 +1,166 @@
+package clang
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/cilium/ebpf"
+)
+
+const minimalSocketFilter = `__attribute__((section("socket"), used)) int main() { return 0; }`
+
+func TestCompile(t *testing.T) {
+	if _, err := findCompiler(); errors.Is(err, ErrNoCompiler) {
+		t.Skip(err)
+	}
+
+	obj, err := Compile([]byte(minimalSocketFilter), nil)
+	if err != nil {
+		t.Fatal("Can't compile:", err)
+	}
+
+	spec, err := ebpf.LoadCollectionSpecFromReader(bytes.NewReader(obj))
+	if err != nil {
+		t.Fatal("Can't parse object:", err)
+	}
+
+	if spec.Programs["main"] == nil {
+		t.Error("Program main is missing")
+	}
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "test.c")
+	if err := ioutil.WriteFile(file, []byte(minimalSocketFilter), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fileObj, err := CompileFile(file, nil)
+	if err != nil {
+		t.Fatal("Can't compile file:", err)
+	}
+	if len(fileObj) == 0 {
+		t.Error("Compiling a file returns an empty object")
+	}
+
+	_, err = Compile([]byte("this isn't C"), nil)
+	if err == nil {
+		t.Fatal("Compiling invalid source doesn't return an error")
+	}
+	if !strings.Contains(err.Error(), "error") {
+		t.Error("Error doesn't include compiler output:", err)
+	}
+}
+
+// fakeTool writes a shell script to dir which prints its name and
+// arguments, followed by its input.
+func fakeTool(t *testing.T, dir, name, script string) string {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("Fake tools require a POSIX shell")
+	}
+
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCompileFakeCompiler(t *testing.T) {
+	dir := t.TempDir()
+	echo := `echo "$0 $@"; cat`
+	cc := fakeTool(t, dir, "cc", echo)
+	llc := fakeTool(t, dir, "llc", echo)
+
+	out, err := Compile([]byte("source"), &Options{CC: cc, CFlags: []string{"-DFOO"}})
+	if err != nil {
+		t.Fatal("Can't compile:", err)
+	}
+	if want := " -DFOO -x c -c - -o -\nsource"; !strings.HasPrefix(string(out), cc) || !strings.HasSuffix(string(out), want) {
+		t.Errorf("Expected output of %s ending in %q, got %q", cc, want, out)
+	}
+
+	out, err = Compile([]byte("source"), &Options{CC: cc, LLC: llc})
+	if err != nil {
+		t.Fatal("Can't compile via llc:", err)
+	}
+	if !strings.HasPrefix(string(out), llc+" -march=bpf") || !strings.Contains(string(out), "\n"+cc+" ") {
+		t.Errorf("Output of cc isn't passed to llc: %q", out)
+	}
+
+	fail := fakeTool(t, dir, "fail", "echo broken >&2; exit 1")
+	_, err = CompileFile("foo.c", &Options{CC: fail})
+	if err == nil {
+		t.Fatal("Failing compiler doesn't return an error")
+	}
+	if !strings.Contains(err.Error(), "broken") {
+		t.Error("Error doesn't include compiler output:", err)
+	}
+}
+
+func TestOptionsArgs(t *testing.T) {
+	if _, err := (&Options{Target: "x86"}).args(); err == nil {
+		t.Error("Invalid target doesn't return an error")
+	}
+
+	args, err := (&Options{Target: "bpfeb", CPU: "v2", IncludeDirs: []string{"foo"}}).args()
+	if err != nil {
+		t.Fatal(err)
+	}
+	flags := strings.Join(args, " ")
+	for _, want := range []string{"-target bpfeb", "-mcpu=v2", "-I foo", "-g"} {
+		if !strings.Contains(flags, want) {
+			t.Errorf("Missing %q in %s", want, flags)
+		}
+	}
+
+	opts := &Options{LLC: "llc", KernelHeaders: "/headers", CFlags: []string{"-O1"}}
+	args, err = opts.args()
+	if err != nil {
+		t.Fatal(err)
+	}
+	flags = strings.Join(args, " ")
+	if strings.Contains(flags, "-target") {
+		t.Error("Target is passed to clang when using llc")
+	}
+	for _, want := range []string{"-emit-llvm", "-include /headers/include/linux/kconfig.h", "-D__KERNEL__"} {
+		if !strings.Contains(flags, want) {
+			t.Errorf("Missing %q in %s", want, flags)
+		}
+	}
+	if args[len(args)-1] != "-O1" {
+		t.Error("CFlags aren't passed last")
+	}
+
+	if llc := strings.Join(opts.llcArgs(), " "); !strings.Contains(llc, "-march=bpf") {
+		t.Error("Missing -march in", llc)
+	}
+}
+
+func TestFindKernelHeaders(t *testing.T) {
+	root := t.TempDir()
+
+	if _, err := findKernelHeaders("5.10.0-1-amd64", root); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal("Expected ErrNotExist, got", err)
+	}
+
+	want := filepath.Join(root, "usr", "src", "linux-headers-5.10.0-1-amd64")
+	if err := os.MkdirAll(filepath.Join(want, "include", "linux"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	have, err := findKernelHeaders("5.10.0-1-amd64", root)
+	if err != nil {
+		t.Fatal("Can't find headers:", err)
+	}
+	if have != want {
+		t.Errorf("Expected %s, got %s", want, have)
+	}
+}
@@ -0,0 +1,17 @@
+// Program bpfgo inspects and manages eBPF objects loaded into the kernel.
+//
+// It lists and dumps maps, shows programs and their translated
+// instructions and pins or unpins objects in bpffs:
+//    bpfgo map list
+//    bpfgo map dump 42
+//    bpfgo prog show /sys/fs/bpf/my_prog
+//    bpfgo prog dump 17
+//    bpfgo pin map 42 /sys/fs/bpf/my_map
+//    bpfgo unpin /sys/fs/bpf/my_map
+//
+// Objects are identified either by their ID or by the path they are
+// pinned at. Most commands require CAP_SYS_ADMIN.
+//
+// bpfgo is a thin layer on top of the introspection APIs of the library,
+// and doubles as an integration test of them.
+package main
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/cilium/ebpf"
+)
+
+const helpText = `Usage: %[1]s <command> [arguments]
+
+Commands:
+
+	map list                   list all maps
+	map show <map>             show information about a map
+	map dump <map>             dump the contents of a map as JSON
+	prog list                  list all programs
+	prog show <prog>           show information about a program
+	prog dump <prog>           dump the instructions of a program as
+	                           rewritten by the verifier
+	pin map|prog <id> <path>   pin an object
+	unpin <path>               remove a pinned object
+
+Objects are identified by their ID or by the path they are pinned at.
+`
+
+func main() {
+	if err := run(os.Stdout, os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(stdout io.Writer, args []string) error {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+		fmt.Fprintf(stdout, helpText, "bpfgo")
+		return nil
+	}
+
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "map":
+		return runMap(stdout, args)
+	case "prog":
+		return runProg(stdout, args)
+	case "pin":
+		return runPin(args)
+	case "unpin":
+		return runUnpin(args)
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
+
+func runMap(stdout io.Writer, args []string) error {
+	if len(args) == 1 && args[0] == "list" {
+		return listMaps(stdout)
+	}
+
+	if len(args) != 2 {
+		return errors.New("expected map list, show or dump")
+	}
+
+	m, err := openMap(args[1])
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	switch args[0] {
+	case "show":
+		w := newTableWriter(stdout)
+		writeMapHeader(w)
+		if err := writeMap(w, m); err != nil {
+			return err
+		}
+		return w.Flush()
+
+	case "dump":
+		var buf, indented bytes.Buffer
+		if err := m.DumpJSON(&buf); err != nil {
+			return err
+		}
+		if err := json.Indent(&indented, buf.Bytes(), "", "  "); err != nil {
+			return err
+		}
+		_, err = indented.WriteTo(stdout)
+		return err
+
+	default:
+		return fmt.Errorf("unknown map command %q", args[0])
+	}
+}
+
+func listMaps(stdout io.Writer) error {
+	w := newTableWriter(stdout)
+	writeMapHeader(w)
+
+	var id ebpf.MapID
+	for {
+		var err error
+		id, err = ebpf.MapGetNextID(id)
+		if errors.Is(err, ebpf.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("get next map id: %w", err)
+		}
+
+		m, err := ebpf.NewMapFromID(id)
+		if errors.Is(err, ebpf.ErrNotExist) {
+			// The map was removed after retrieving its ID.
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("map %d: %w", id, err)
+		}
+
+		err = writeMap(w, m)
+		m.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return w.Flush()
+}
+
+func writeMapHeader(w io.Writer) {
+	fmt.Fprintln(w, "ID\tTYPE\tNAME\tKEY\tVALUE\tMAX ENTRIES\tFLAGS")
+}
+
+func writeMap(w io.Writer, m *ebpf.Map) error {
+	info, err := m.Info()
+	if err != nil {
+		return fmt.Errorf("%s: %w", m, err)
+	}
+
+	id, _ := info.ID()
+	_, err = fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%d\t%d\t%#x\n",
+		id, info.Type, info.Name, info.KeySize, info.ValueSize, info.MaxEntries, info.Flags)
+	return err
+}
+
+func runProg(stdout io.Writer, args []string) error {
+	if len(args) == 1 && args[0] == "list" {
+		return listProgs(stdout)
+	}
+
+	if len(args) != 2 {
+		return errors.New("expected prog list, show or dump")
+	}
+
+	prog, err := openProg(args[1])
+	if err != nil {
+		return err
+	}
+	defer prog.Close()
+
+	switch args[0] {
+	case "show":
+		w := newTableWriter(stdout)
+		writeProgHeader(w)
+		if err := writeProg(w, prog); err != nil {
+			return err
+		}
+		return w.Flush()
+
+	case "dump":
+		info, err := prog.Info()
+		if err != nil {
+			return fmt.Errorf("%s: %w", prog, err)
+		}
+
+		insns, err := info.Instructions()
+		if err != nil {
+			return fmt.Errorf("%s: %w", prog, err)
+		}
+
+		_, err = fmt.Fprintf(stdout, "%v", insns)
+		return err
+
+	default:
+		return fmt.Errorf("unknown prog command %q", args[0])
+	}
+}
+
+func listProgs(stdout io.Writer) error {
+	w := newTableWriter(stdout)
+	writeProgHeader(w)
+
+	var id ebpf.ProgramID
+	for {
+		var err error
+		id, err = ebpf.ProgramGetNextID(id)
+		if errors.Is(err, ebpf.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("get next program id: %w", err)
+		}
+
+		prog, err := ebpf.NewProgramFromID(id)
+		if errors.Is(err, ebpf.ErrNotExist) {
+			// The program was unloaded after retrieving its ID.
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("program %d: %w", id, err)
+		}
+
+		err = writeProg(w, prog)
+		prog.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return w.Flush()
+}
+
+func writeProgHeader(w io.Writer) {
+	fmt.Fprintln(w, "ID\tTYPE\tNAME\tTAG\tRUN COUNT\tRUNTIME")
+}
+
+func writeProg(w io.Writer, prog *ebpf.Program) error {
+	info, err := prog.Info()
+	if err != nil {
+		return fmt.Errorf("%s: %w", prog, err)
+	}
+
+	id, _ := info.ID()
+	runCount, _ := info.RunCount()
+	runtime, _ := info.Runtime()
+	_, err = fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\n",
+		id, info.Type, info.Name, info.Tag, runCount, runtime)
+	return err
+}
+
+func runPin(args []string) error {
+	if len(args) != 3 {
+		return errors.New("expected pin map|prog <id> <path>")
+	}
+
+	switch args[0] {
+	case "map":
+		m, err := openMap(args[1])
+		if err != nil {
+			return err
+		}
+		defer m.Close()
+		return m.Pin(args[2])
+
+	case "prog":
+		prog, err := openProg(args[1])
+		if err != nil {
+			return err
+		}
+		defer prog.Close()
+		return prog.Pin(args[2])
+
+	default:
+		return fmt.Errorf("can't pin %q", args[0])
+	}
+}
+
+func runUnpin(args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected unpin <path>")
+	}
+
+	// Loading the object ensures that the path refers to a pinned map or
+	// program and not an arbitrary file.
+	if m, err := ebpf.LoadPinnedMap(args[0], nil); err == nil {
+		defer m.Close()
+		return m.Unpin()
+	}
+
+	prog, err := ebpf.LoadPinnedProgram(args[0], nil)
+	if err != nil {
+		return fmt.Errorf("%s is neither a pinned map nor program: %w", args[0], err)
+	}
+	defer prog.Close()
+	return prog.Unpin()
+}
+
+// openMap opens a map by ID or pinned path.
+func openMap(ref string) (*ebpf.Map, error) {
+	if id, err := strconv.ParseUint(ref, 10, 32); err == nil {
+		m, err := ebpf.NewMapFromID(ebpf.MapID(id))
+		if err != nil {
+			return nil, fmt.Errorf("map %d: %w", id, err)
+		}
+		return m, nil
+	}
+
+	m, err := ebpf.LoadPinnedMap(ref, nil)
+	if err != nil {
+		return nil, fmt.Errorf("map %s: %w", ref, err)
+	}
+	return m, nil
+}
+
+// openProg opens a program by ID or pinned path.
+func openProg(ref string) (*ebpf.Program, error) {
+	if id, err := strconv.ParseUint(ref, 10, 32); err == nil {
+		prog, err := ebpf.NewProgramFromID(ebpf.ProgramID(id))
+		if err != nil {
+			return nil, fmt.Errorf("program %d: %w", id, err)
+		}
+		return prog, nil
+	}
+
+	prog, err := ebpf.LoadPinnedProgram(ref, nil)
+	if err != nil {
+		return nil, fmt.Errorf("program %s: %w", ref, err)
+	}
+	return prog, nil
+}
+
+func newTableWriter(w io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal/testutils"
+)
+
+func mustRun(t *testing.T, args ...string) string {
+	t.Helper()
+
+	var stdout bytes.Buffer
+	if err := run(&stdout, args); err != nil {
+		t.Fatalf("%s: %s", strings.Join(args, " "), err)
+	}
+	return stdout.String()
+}
+
+func TestMapCommands(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "4.13", "map IDs")
+
+	m, err := ebpf.NewMap(&ebpf.MapSpec{
+		Name:       "bpfgo_test",
+		Type:       ebpf.Hash,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if err := m.Put(uint32(1), uint32(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := m.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := mustRun(t, "map", "list")
+	if !strings.Contains(out, "bpfgo_test") {
+		t.Error("map list doesn't contain the map:\n", out)
+	}
+
+	out = mustRun(t, "map", "show", fmt.Sprint(id))
+	if !strings.Contains(out, "bpfgo_test") {
+		t.Error("map show doesn't contain the map:\n", out)
+	}
+
+	out = mustRun(t, "map", "dump", fmt.Sprint(id))
+	if !strings.Contains(out, `"key"`) {
+		t.Error("map dump doesn't contain the entry:\n", out)
+	}
+
+	tmp := testutils.TempBPFFS(t)
+	path := filepath.Join(tmp, "map")
+	mustRun(t, "pin", "map", fmt.Sprint(id), path)
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal("Map isn't pinned:", err)
+	}
+
+	out = mustRun(t, "map", "show", path)
+	if !strings.Contains(out, "bpfgo_test") {
+		t.Error("map show by path doesn't contain the map:\n", out)
+	}
+
+	mustRun(t, "unpin", path)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Map is still pinned:", err)
+	}
+}
+
+func TestProgCommands(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "4.13", "program IDs")
+
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Name: "bpfgo_test",
+		Type: ebpf.SocketFilter,
+		Instructions: asm.Instructions{
+			asm.LoadImm(asm.R0, 0, asm.DWord),
+			asm.Return(),
+		},
+		License: "MIT",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer prog.Close()
+
+	id, err := prog.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := mustRun(t, "prog", "list")
+	if !strings.Contains(out, "bpfgo_test") {
+		t.Error("prog list doesn't contain the program:\n", out)
+	}
+
+	out = mustRun(t, "prog", "dump", fmt.Sprint(id))
+	if !strings.Contains(out, "Exit") {
+		t.Error("prog dump doesn't contain instructions:\n", out)
+	}
+
+	tmp := testutils.TempBPFFS(t)
+	path := filepath.Join(tmp, "prog")
+	mustRun(t, "pin", "prog", fmt.Sprint(id), path)
+	mustRun(t, "unpin", path)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Program is still pinned:", err)
+	}
+}
+
+func TestInvalidCommands(t *testing.T) {
+	for _, args := range [][]string{
+		{"foo"},
+		{"map"},
+		{"map", "frob", "1"},
+		{"pin", "link", "1", "/sys/fs/bpf/foo"},
+		{"unpin"},
+	} {
+		if err := run(&bytes.Buffer{}, args); err == nil {
+			t.Errorf("%v doesn't return an error", args)
+		}
+	}
+}
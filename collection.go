@@ -18,12 +18,58 @@ import (
 type CollectionOptions struct {
 	Maps     MapOptions
 	Programs ProgramOptions
+
+	// MapReplacements takes a set of Maps that are used instead of
+	// creating new ones when loading the CollectionSpec, for example
+	// maps shared with other collections.
+	//
+	// For each given Map there must be a MapSpec of the same name in
+	// CollectionSpec.Maps which is compatible with it, see
+	// MapSpec.Compatible. The Maps are cloned, so the caller can close
+	// them once the Collection is loaded.
+	MapReplacements map[string]*Map
+
+	// MapOverrides changes the properties of maps before they are
+	// created, keyed by the name of the map in CollectionSpec.Maps. This
+	// allows sizing maps at startup without modifying the spec.
+	MapOverrides map[string]MapOverride
+}
+
+// MapOverride changes the properties of a MapSpec at load time.
+type MapOverride struct {
+	// MaxEntries replaces MapSpec.MaxEntries if it is not zero.
+	MaxEntries uint32
+	// Flags are added to MapSpec.Flags.
+	Flags uint32
+	// NumaNode replaces MapSpec.NumaNode if Flags contains MapNumaNode.
+	NumaNode uint32
+}
+
+func (mo *MapOverride) apply(spec *MapSpec) *MapSpec {
+	spec = spec.Copy()
+	if mo.MaxEntries != 0 {
+		spec.MaxEntries = mo.MaxEntries
+	}
+	spec.Flags |= mo.Flags
+	if mo.Flags&MapNumaNode != 0 {
+		spec.NumaNode = mo.NumaNode
+	}
+	return spec
 }
 
 // CollectionSpec describes a collection.
 type CollectionSpec struct {
 	Maps     map[string]*MapSpec
 	Programs map[string]*ProgramSpec
+
+	// Variants are alternative implementations of programs, keyed by the
+	// name of the program and ordered by preference. Loading a program
+	// uses the first variant whose requirements are met. The entry in
+	// Programs is used if none of them are, and may be omitted.
+	//
+	// Maps which are only referenced by variants or programs that aren't
+	// loaded are not created by NewCollection.
+	Variants map[string][]ProgramVariant
 }
 
 // Copy returns a recursive copy of the spec.
@@ -45,6 +91,15 @@ func (cs *CollectionSpec) Copy() *CollectionSpec {
 		cpy.Programs[name] = spec.Copy()
 	}
 
+	if cs.Variants != nil {
+		cpy.Variants = make(map[string][]ProgramVariant, len(cs.Variants))
+		for name, variants := range cs.Variants {
+			for _, variant := range variants {
+				cpy.Variants[name] = append(cpy.Variants[name], variant.Copy())
+			}
+		}
+	}
+
 	return &cpy
 }
 
@@ -59,7 +114,7 @@ func (cs *CollectionSpec) RewriteMaps(maps map[string]*Map) error {
 		// have we seen a program that uses this symbol / map
 		seen := false
 		fd := m.FD()
-		for progName, progSpec := range cs.Programs {
+		rewrite := func(progName string, progSpec *ProgramSpec) error {
 			err := progSpec.Instructions.RewriteMapPtr(symbol, fd)
 
 			switch {
@@ -72,6 +127,21 @@ func (cs *CollectionSpec) RewriteMaps(maps map[string]*Map) error {
 			default:
 				return fmt.Errorf("program %s: %w", progName, err)
 			}
+			return nil
+		}
+
+		for progName, progSpec := range cs.Programs {
+			if err := rewrite(progName, progSpec); err != nil {
+				return err
+			}
+		}
+
+		for progName, variants := range cs.Variants {
+			for _, variant := range variants {
+				if err := rewrite(progName, variant.Spec); err != nil {
+					return err
+				}
+			}
 		}
 
 		if !seen {
@@ -201,6 +271,10 @@ func (cs *CollectionSpec) LoadAndAssign(to interface{}, opts *CollectionOptions)
 		opts = &CollectionOptions{}
 	}
 
+	if err := checkCollectionOptions(cs, opts); err != nil {
+		return err
+	}
+
 	loadMap, loadProgram, done, cleanup := lazyLoadCollection(cs, opts)
 	defer cleanup()
 
@@ -231,6 +305,40 @@ func (cs *CollectionSpec) LoadAndAssign(to interface{}, opts *CollectionOptions)
 	return nil
 }
 
+// LoadPrograms loads the named programs and the maps they reference into
+// the kernel.
+//
+// Other programs and maps in the spec aren't loaded. This saves resources
+// for objects bundling many optional programs, and allows loading the
+// programs supported by the running kernel. Use LoadAndAssign instead if
+// the set of programs is known at compile time.
+//
+// opts may be nil.
+func (cs *CollectionSpec) LoadPrograms(names []string, opts *CollectionOptions) (*Collection, error) {
+	if opts == nil {
+		opts = &CollectionOptions{}
+	}
+
+	if err := checkCollectionOptions(cs, opts); err != nil {
+		return nil, err
+	}
+
+	_, loadProgram, done, cleanup := lazyLoadCollection(cs, opts)
+	defer cleanup()
+
+	for _, name := range names {
+		if _, err := loadProgram(name); err != nil {
+			return nil, err
+		}
+	}
+
+	maps, progs := done()
+	return &Collection{
+		progs,
+		maps,
+	}, nil
+}
+
 // Collection is a collection of Programs and Maps associated
 // with their symbols
 type Collection struct {
@@ -245,17 +353,28 @@ func NewCollection(spec *CollectionSpec) (*Collection, error) {
 
 // NewCollectionWithOptions creates a Collection from a specification.
 func NewCollectionWithOptions(spec *CollectionSpec, opts CollectionOptions) (*Collection, error) {
+	if err := checkCollectionOptions(spec, &opts); err != nil {
+		return nil, err
+	}
+
 	loadMap, loadProgram, done, cleanup := lazyLoadCollection(spec, &opts)
 	defer cleanup()
 
+	// Maps which are only used by variants are created on demand when
+	// loading the selected variant.
+	optional := spec.variantMaps()
 	for mapName := range spec.Maps {
+		if optional[mapName] {
+			continue
+		}
+
 		_, err := loadMap(mapName)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	for progName := range spec.Programs {
+	for progName := range spec.programNames() {
 		_, err := loadProgram(progName)
 		if err != nil {
 			return nil, err
@@ -269,6 +388,20 @@ func NewCollectionWithOptions(spec *CollectionSpec, opts CollectionOptions) (*Co
 	}, nil
 }
 
+func checkCollectionOptions(spec *CollectionSpec, opts *CollectionOptions) error {
+	for name := range opts.MapReplacements {
+		if _, ok := spec.Maps[name]; !ok {
+			return fmt.Errorf("replacement map %s not found in CollectionSpec", name)
+		}
+	}
+	for name := range opts.MapOverrides {
+		if _, ok := spec.Maps[name]; !ok {
+			return fmt.Errorf("overridden map %s not found in CollectionSpec", name)
+		}
+	}
+	return nil
+}
+
 type btfHandleCache map[*btf.Spec]*btf.Handle
 
 func (btfs btfHandleCache) load(spec *btf.Spec) (*btf.Handle, error) {
@@ -335,6 +468,34 @@ func lazyLoadCollection(coll *CollectionSpec, opts *CollectionOptions) (
 			return nil, fmt.Errorf("missing map %s", mapName)
 		}
 
+		if override, ok := opts.MapOverrides[mapName]; ok {
+			mapSpec = override.apply(mapSpec)
+		}
+
+		if replacement := opts.MapReplacements[mapName]; replacement != nil {
+			if err := mapSpec.Compatible(replacement); err != nil {
+				return nil, fmt.Errorf("replacement map %s: %w", mapName, err)
+			}
+
+			// Clone the map so that closing the collection doesn't
+			// affect the caller's copy.
+			m, err := replacement.Clone()
+			if err != nil {
+				return nil, fmt.Errorf("replacement map %s: %w", mapName, err)
+			}
+
+			maps[mapName] = m
+			return m, nil
+		}
+
+		if mapName == kconfigMap && mapSpec.Contents == nil {
+			var err error
+			mapSpec, err = resolveKconfig(mapSpec)
+			if err != nil {
+				return nil, fmt.Errorf("map %s: %w", mapName, err)
+			}
+		}
+
 		m, err := newMapWithOptions(mapSpec, opts.Maps, btfs)
 		if err != nil {
 			return nil, fmt.Errorf("map %s: %w", mapName, err)
@@ -349,9 +510,9 @@ func lazyLoadCollection(coll *CollectionSpec, opts *CollectionOptions) (
 			return prog, nil
 		}
 
-		progSpec := coll.Programs[progName]
-		if progSpec == nil {
-			return nil, fmt.Errorf("unknown program %s", progName)
+		progSpec, err := coll.selectVariant(progName)
+		if err != nil {
+			return nil, err
 		}
 
 		progSpec = progSpec.Copy()
@@ -396,6 +557,76 @@ func lazyLoadCollection(coll *CollectionSpec, opts *CollectionOptions) (
 	return
 }
 
+// selectVariant returns the preferred variant of a program which is
+// supported by the kernel.
+func (cs *CollectionSpec) selectVariant(name string) (*ProgramSpec, error) {
+	for i, variant := range cs.Variants[name] {
+		ok, err := variant.supported()
+		if err != nil {
+			return nil, fmt.Errorf("program %s: variant %d: %w", name, i, err)
+		}
+		if ok {
+			return variant.Spec, nil
+		}
+	}
+
+	if spec := cs.Programs[name]; spec != nil {
+		return spec, nil
+	}
+
+	if len(cs.Variants[name]) > 0 {
+		return nil, fmt.Errorf("program %s: no variant is supported: %w", name, ErrNotSupported)
+	}
+
+	return nil, fmt.Errorf("unknown program %s", name)
+}
+
+// programNames returns the names of all programs, including those which
+// only have variants.
+func (cs *CollectionSpec) programNames() map[string]struct{} {
+	names := make(map[string]struct{}, len(cs.Programs))
+	for name := range cs.Programs {
+		names[name] = struct{}{}
+	}
+	for name := range cs.Variants {
+		names[name] = struct{}{}
+	}
+	return names
+}
+
+// variantMaps returns the maps which are only referenced by programs with
+// variants.
+func (cs *CollectionSpec) variantMaps() map[string]bool {
+	references := func(progSpec *ProgramSpec, used map[string]bool) {
+		for _, ins := range progSpec.Instructions {
+			if ins.OpCode == asm.LoadImmOp(asm.DWord) && ins.Reference != "" {
+				used[ins.Reference] = true
+			}
+		}
+	}
+
+	required := make(map[string]bool)
+	optional := make(map[string]bool)
+	for name, progSpec := range cs.Programs {
+		if len(cs.Variants[name]) > 0 {
+			references(progSpec, optional)
+		} else {
+			references(progSpec, required)
+		}
+	}
+
+	for _, variants := range cs.Variants {
+		for _, variant := range variants {
+			references(variant.Spec, optional)
+		}
+	}
+
+	for name := range required {
+		delete(optional, name)
+	}
+	return optional
+}
+
 // LoadCollection parses an object file and converts it to a collection.
 func LoadCollection(file string) (*Collection, error) {
 	spec, err := LoadCollectionSpec(file)
@@ -439,10 +670,31 @@ func (coll *Collection) DetachProgram(name string) *Program {
 	return p
 }
 
-// Assign the contents of a collection to a struct.
+// Assign the contents of a Collection to a struct.
+//
+// This gives applications typed handles to the maps and programs of a
+// collection which has already been loaded, for example when it is
+// shared with code that expects a Collection. Prefer
+// CollectionSpec.LoadAndAssign otherwise, which only creates the maps
+// and programs requested.
 //
-// Deprecated: use CollectionSpec.Assign instead. It provides the same
-// functionality but creates only the maps and programs requested.
+// The argument to must be a pointer to a struct. A field of the
+// struct is updated with values from Programs or Maps if it
+// has an `ebpf` tag and its type is *Program or *Map.
+// The tag gives the name of the program or map as found in
+// the Collection.
+//
+//    struct {
+//        Foo     *ebpf.Program `ebpf:"xdp_foo"`
+//        Bar     *ebpf.Map     `ebpf:"bar_map"`
+//        Ignored int
+//    }
+//
+// Assigned maps and programs are detached from the Collection, and must
+// be closed by the caller.
+//
+// Returns an error if any of the fields can't be found, or
+// if the same map or program is assigned multiple times.
 func (coll *Collection) Assign(to interface{}) error {
 	assignedMaps := make(map[string]struct{})
 	assignedPrograms := make(map[string]struct{})
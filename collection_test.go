@@ -1,6 +1,7 @@
 package ebpf
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
 	"testing"
@@ -156,6 +157,151 @@ func TestCollectionSpecRewriteMaps(t *testing.T) {
 	}
 }
 
+func TestCollectionSpecMapReplacements(t *testing.T) {
+	insns := asm.Instructions{
+		// R1 map
+		asm.LoadMapPtr(asm.R1, 0),
+		// R2 key
+		asm.Mov.Reg(asm.R2, asm.R10),
+		asm.Add.Imm(asm.R2, -4),
+		asm.StoreImm(asm.R2, 0, 0, asm.Word),
+		// Lookup map[0]
+		asm.FnMapLookupElem.Call(),
+		asm.JEq.Imm(asm.R0, 0, "ret"),
+		asm.LoadMem(asm.R0, asm.R0, 0, asm.Word),
+		asm.Return().Sym("ret"),
+	}
+	insns[0].Reference = "test-map"
+	// Mark the map pointer as not rewritten yet, like the ELF loader does.
+	if err := insns[0].RewriteMapPtr(-1); err != nil {
+		t.Fatal(err)
+	}
+
+	cs := &CollectionSpec{
+		Maps: map[string]*MapSpec{
+			"test-map": {
+				Type:       Array,
+				KeySize:    4,
+				ValueSize:  4,
+				MaxEntries: 1,
+			},
+		},
+		Programs: map[string]*ProgramSpec{
+			"test-prog": {
+				Type:         SocketFilter,
+				Instructions: insns,
+				License:      "MIT",
+			},
+		},
+	}
+
+	newMap, err := NewMap(cs.Maps["test-map"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer newMap.Close()
+
+	if err := newMap.Put(uint32(0), uint32(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	coll, err := NewCollectionWithOptions(cs, CollectionOptions{
+		MapReplacements: map[string]*Map{
+			"test-map": newMap,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer coll.Close()
+
+	ret, _, err := coll.Programs["test-prog"].Test(make([]byte, 14))
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ret != 2 {
+		t.Fatal("Replacement map not used")
+	}
+
+	// The collection uses a clone of the replacement.
+	coll.Maps["test-map"].Close()
+	if err := newMap.Put(uint32(0), uint32(3)); err != nil {
+		t.Error("Closing the collection's map closes the replacement:", err)
+	}
+
+	incompatible, err := NewMap(&MapSpec{
+		Type:       Array,
+		KeySize:    4,
+		ValueSize:  8,
+		MaxEntries: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer incompatible.Close()
+
+	_, err = NewCollectionWithOptions(cs, CollectionOptions{
+		MapReplacements: map[string]*Map{
+			"test-map": incompatible,
+		},
+	})
+	if !errors.Is(err, ErrMapIncompatible) {
+		t.Error("Incompatible replacement doesn't return ErrMapIncompatible:", err)
+	}
+
+	_, err = NewCollectionWithOptions(cs, CollectionOptions{
+		MapReplacements: map[string]*Map{
+			"missing": newMap,
+		},
+	})
+	if err == nil {
+		t.Error("Replacing a missing map doesn't return an error")
+	}
+}
+
+func TestCollectionMapOverrides(t *testing.T) {
+	spec := &CollectionSpec{
+		Maps: map[string]*MapSpec{
+			"conntrack": {
+				Type:       Hash,
+				KeySize:    4,
+				ValueSize:  4,
+				MaxEntries: 1,
+			},
+		},
+	}
+
+	coll, err := NewCollectionWithOptions(spec, CollectionOptions{
+		MapOverrides: map[string]MapOverride{
+			"conntrack": {MaxEntries: 10, Flags: MapNoPrealloc},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer coll.Close()
+
+	m := coll.Maps["conntrack"]
+	if m.MaxEntries() != 10 {
+		t.Error("MaxEntries isn't overridden:", m.MaxEntries())
+	}
+	if m.Flags() != MapNoPrealloc {
+		t.Errorf("Flags aren't overridden: %#x", m.Flags())
+	}
+	if spec.Maps["conntrack"].MaxEntries != 1 {
+		t.Error("Overriding modifies the spec")
+	}
+
+	_, err = NewCollectionWithOptions(spec, CollectionOptions{
+		MapOverrides: map[string]MapOverride{"missing": {}},
+	})
+	if err == nil {
+		t.Error("Overriding a missing map doesn't return an error")
+	}
+}
+
 func TestCollectionSpec_LoadAndAssign_LazyLoading(t *testing.T) {
 	spec := &CollectionSpec{
 		Maps: map[string]*MapSpec{
@@ -208,6 +354,74 @@ func TestCollectionSpec_LoadAndAssign_LazyLoading(t *testing.T) {
 	}
 }
 
+func TestCollectionSpecLoadPrograms(t *testing.T) {
+	insns := asm.Instructions{
+		asm.LoadMapPtr(asm.R1, 0),
+		asm.LoadImm(asm.R0, 0, asm.DWord),
+		asm.Return(),
+	}
+	insns[0].Reference = "valid"
+	if err := insns[0].RewriteMapPtr(-1); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := &CollectionSpec{
+		Maps: map[string]*MapSpec{
+			"valid": {
+				Type:       Array,
+				KeySize:    4,
+				ValueSize:  4,
+				MaxEntries: 1,
+			},
+			"unused": {
+				Type:       Array,
+				KeySize:    4,
+				ValueSize:  4,
+				MaxEntries: 1,
+			},
+			"bogus": {
+				Type:       Array,
+				MaxEntries: 0,
+			},
+		},
+		Programs: map[string]*ProgramSpec{
+			"valid": {
+				Type:         SocketFilter,
+				Instructions: insns,
+				License:      "MIT",
+			},
+			"bogus": {
+				Type: SocketFilter,
+				Instructions: asm.Instructions{
+					// Undefined return value is rejected
+					asm.Return(),
+				},
+				License: "MIT",
+			},
+		},
+	}
+
+	coll, err := spec.LoadPrograms([]string{"valid"}, nil)
+	if err != nil {
+		t.Fatal("LoadPrograms loads a map or program that isn't requested:", err)
+	}
+	defer coll.Close()
+
+	if coll.Programs["valid"] == nil {
+		t.Error("Program is missing")
+	}
+	if coll.Maps["valid"] == nil {
+		t.Error("Referenced map is missing")
+	}
+	if len(coll.Programs) != 1 || len(coll.Maps) != 1 {
+		t.Errorf("Expected one program and map, got %v", coll)
+	}
+
+	if _, err := spec.LoadPrograms([]string{"missing"}, nil); err == nil {
+		t.Error("Loading a missing program doesn't return an error")
+	}
+}
+
 func TestCollectionAssign(t *testing.T) {
 	var specs struct {
 		Program *ProgramSpec `ebpf:"prog1"`
@@ -283,6 +497,17 @@ func TestCollectionAssign(t *testing.T) {
 	map1 := coll.Maps["map1"]
 	defer map1.Close()
 
+	var missing struct {
+		Program *Program `ebpf:"prog1"`
+		Map     *Map     `ebpf:"missing"`
+	}
+	if err := coll.Assign(&missing); err == nil {
+		t.Fatal("Assign doesn't return an error for a missing map")
+	}
+	if coll.Programs["prog1"] == nil {
+		t.Fatal("Failed Assign detaches Program")
+	}
+
 	if err := coll.Assign(&objs); err != nil {
 		t.Fatal("Can't Assign objects:", err)
 	}
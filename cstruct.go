@@ -0,0 +1,365 @@
+package ebpf
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/btf"
+)
+
+// cType describes how a Go type is laid out in memory by a BPF program.
+//
+// Layout follows the rules of the BPF target: scalars are aligned to their
+// size, structs to their most aligned member, and structs are padded to a
+// multiple of their alignment.
+type cType struct {
+	size, align int
+	// fields is only populated for structs.
+	fields []cField
+	encode func(buf []byte, v reflect.Value)
+	decode func(buf []byte, v reflect.Value)
+}
+
+type cField struct {
+	// Index of the field in the Go struct, or -1 for padding.
+	index int
+	// Name of the C member. Only set for fields with an ebpf tag.
+	name   string
+	offset int
+	typ    *cType
+}
+
+// cTypes caches the result of taggedLayout, keyed by reflect.Type.
+var cTypes sync.Map
+
+type cTypeResult struct {
+	typ *cType
+	err error
+}
+
+// taggedLayout returns the C layout of a struct which has at least one
+// field with an ebpf tag.
+//
+// Returns nil if typ isn't such a struct, in which case the default
+// encoding applies.
+func taggedLayout(typ reflect.Type) (*cType, error) {
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil, nil
+	}
+
+	if result, ok := cTypes.Load(typ); ok {
+		return result.(cTypeResult).typ, result.(cTypeResult).err
+	}
+
+	var (
+		ct  *cType
+		err error
+	)
+	for i := 0; i < typ.NumField(); i++ {
+		if _, ok := typ.Field(i).Tag.Lookup("ebpf"); ok {
+			ct, err = layoutOf(typ, 0)
+			if err != nil {
+				err = fmt.Errorf("%s: %w", typ, err)
+			}
+			break
+		}
+	}
+
+	cTypes.Store(typ, cTypeResult{ct, err})
+	return ct, err
+}
+
+func layoutOf(typ reflect.Type, depth int) (*cType, error) {
+	if depth > 32 {
+		return nil, errors.New("exceeded type depth")
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool:
+		return &cType{1, 1, nil,
+			func(buf []byte, v reflect.Value) {
+				if v.Bool() {
+					buf[0] = 1
+				}
+			},
+			func(buf []byte, v reflect.Value) { v.SetBool(buf[0] != 0) },
+		}, nil
+
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size := int(typ.Size())
+		return &cType{size, size, nil,
+			func(buf []byte, v reflect.Value) { putUint(buf, size, uint64(v.Int())) },
+			func(buf []byte, v reflect.Value) {
+				// Sign extend.
+				shift := 64 - 8*size
+				v.SetInt(int64(getUint(buf, size)<<shift) >> shift)
+			},
+		}, nil
+
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		size := int(typ.Size())
+		return &cType{size, size, nil,
+			func(buf []byte, v reflect.Value) { putUint(buf, size, v.Uint()) },
+			func(buf []byte, v reflect.Value) { v.SetUint(getUint(buf, size)) },
+		}, nil
+
+	case reflect.Float32:
+		return &cType{4, 4, nil,
+			func(buf []byte, v reflect.Value) { putUint(buf, 4, uint64(math.Float32bits(float32(v.Float())))) },
+			func(buf []byte, v reflect.Value) { v.SetFloat(float64(math.Float32frombits(uint32(getUint(buf, 4))))) },
+		}, nil
+
+	case reflect.Float64:
+		return &cType{8, 8, nil,
+			func(buf []byte, v reflect.Value) { putUint(buf, 8, math.Float64bits(v.Float())) },
+			func(buf []byte, v reflect.Value) { v.SetFloat(math.Float64frombits(getUint(buf, 8))) },
+		}, nil
+
+	case reflect.Int, reflect.Uint, reflect.Uintptr:
+		return nil, fmt.Errorf("%s has a platform dependent size, use a fixed size type", typ)
+
+	case reflect.Array:
+		elem, err := layoutOf(typ.Elem(), depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		n := typ.Len()
+		return &cType{elem.size * n, elem.align, nil,
+			func(buf []byte, v reflect.Value) {
+				for i := 0; i < n; i++ {
+					elem.encode(buf[i*elem.size:], v.Index(i))
+				}
+			},
+			func(buf []byte, v reflect.Value) {
+				for i := 0; i < n; i++ {
+					elem.decode(buf[i*elem.size:], v.Index(i))
+				}
+			},
+		}, nil
+
+	case reflect.Struct:
+		return structLayout(typ, depth)
+
+	default:
+		return nil, fmt.Errorf("can't lay out %s", typ)
+	}
+}
+
+func structLayout(typ reflect.Type, depth int) (*cType, error) {
+	ct := &cType{align: 1}
+
+	offset := 0
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+
+		tag, tagged := field.Tag.Lookup("ebpf")
+		if tag == "-" {
+			continue
+		}
+
+		ft, err := layoutOf(field.Type, depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+
+		offset = align(offset, ft.align)
+		if ft.align > ct.align {
+			ct.align = ft.align
+		}
+
+		cf := cField{index: i, offset: offset, typ: ft}
+		switch {
+		case field.Name == "_":
+			// Explicit padding is zeroed.
+			cf.index = -1
+		case field.PkgPath != "":
+			return nil, fmt.Errorf("field %s is not exported, tag it with `ebpf:\"-\"` to skip it", field.Name)
+		case tagged:
+			cf.name = tag
+		}
+
+		ct.fields = append(ct.fields, cf)
+		offset += ft.size
+	}
+
+	ct.size = align(offset, ct.align)
+	ct.encode = func(buf []byte, v reflect.Value) {
+		for _, cf := range ct.fields {
+			if cf.index >= 0 {
+				cf.typ.encode(buf[cf.offset:], v.Field(cf.index))
+			}
+		}
+	}
+	ct.decode = func(buf []byte, v reflect.Value) {
+		for _, cf := range ct.fields {
+			if cf.index >= 0 {
+				cf.typ.decode(buf[cf.offset:], v.Field(cf.index))
+			}
+		}
+	}
+
+	return ct, nil
+}
+
+func putUint(buf []byte, size int, value uint64) {
+	switch size {
+	case 1:
+		buf[0] = uint8(value)
+	case 2:
+		internal.NativeEndian.PutUint16(buf, uint16(value))
+	case 4:
+		internal.NativeEndian.PutUint32(buf, uint32(value))
+	case 8:
+		internal.NativeEndian.PutUint64(buf, value)
+	}
+}
+
+func getUint(buf []byte, size int) uint64 {
+	switch size {
+	case 1:
+		return uint64(buf[0])
+	case 2:
+		return uint64(internal.NativeEndian.Uint16(buf))
+	case 4:
+		return uint64(internal.NativeEndian.Uint32(buf))
+	default:
+		return internal.NativeEndian.Uint64(buf)
+	}
+}
+
+// marshal encodes a struct value using its C layout.
+func (ct *cType) marshal(value reflect.Value) []byte {
+	buf := make([]byte, ct.size)
+	ct.encode(buf, value)
+	return buf
+}
+
+// unmarshal decodes buf into a struct using its C layout.
+func (ct *cType) unmarshal(buf []byte, value reflect.Value) error {
+	if len(buf) != ct.size {
+		return fmt.Errorf("%s has C size %d, but the buffer has %d bytes", value.Type(), ct.size, len(buf))
+	}
+
+	ct.decode(buf, value)
+	return nil
+}
+
+// checkBTF verifies that a C layout matches a BTF type.
+//
+// Only the offsets of fields with an ebpf tag are checked, since the names
+// of other fields needn't match the names of the C members.
+func (ct *cType) checkBTF(typ btf.Type) error {
+	size, err := btf.Sizeof(typ)
+	if err != nil {
+		return err
+	}
+
+	if size != ct.size {
+		return fmt.Errorf("C size %d doesn't match size %d of %s", ct.size, size, typ)
+	}
+
+	for _, cf := range ct.fields {
+		if cf.name == "" {
+			continue
+		}
+
+		offset, err := btf.Offsetof(typ, cf.name)
+		if err != nil {
+			return err
+		}
+
+		if offset != cf.offset {
+			return fmt.Errorf("member %s: offset %d doesn't match offset %d in BTF", cf.name, cf.offset, offset)
+		}
+	}
+
+	return nil
+}
+
+// CheckTypes verifies that key and value are compatible with the spec.
+//
+// The sizes of key and value must match KeySize and ValueSize. If the
+// spec has BTF, structs with ebpf tags are additionally checked against
+// the BTF of the key and value: the size of the struct and the offset of
+// each tagged field must match the C type. Pass nil to skip checking key
+// or value.
+//
+// Types implementing encoding.BinaryMarshaler aren't checked.
+func (ms *MapSpec) CheckTypes(key, value interface{}) error {
+	var keyType, valueType btf.Type
+	if ms.BTF != nil {
+		keyType, valueType = btf.MapKey(ms.BTF), btf.MapValue(ms.BTF)
+	}
+
+	if err := checkType(key, ms.KeySize, keyType); err != nil {
+		return fmt.Errorf("key: %w", err)
+	}
+
+	if err := checkType(value, ms.ValueSize, valueType); err != nil {
+		return fmt.Errorf("value: %w", err)
+	}
+
+	return nil
+}
+
+func checkType(data interface{}, size uint32, typ btf.Type) error {
+	if data == nil {
+		return nil
+	}
+
+	if _, ok := data.(encoding.BinaryMarshaler); ok {
+		return nil
+	}
+
+	goType := reflect.TypeOf(data)
+	if goType.Kind() == reflect.Ptr {
+		goType = goType.Elem()
+	}
+
+	ct, err := taggedLayout(goType)
+	if err != nil {
+		return err
+	}
+
+	if ct == nil {
+		if n := binarySize(goType); n >= 0 && uint32(n) != size {
+			return fmt.Errorf("%s has size %d, expected %d", goType, n, size)
+		}
+		return nil
+	}
+
+	if uint32(ct.size) != size {
+		return fmt.Errorf("%s has C size %d, expected %d", goType, ct.size, size)
+	}
+
+	if typ == nil {
+		return nil
+	}
+
+	if _, void := typ.(*btf.Void); void {
+		return nil
+	}
+
+	if err := ct.checkBTF(typ); err != nil {
+		return fmt.Errorf("%s: %w", goType, err)
+	}
+
+	return nil
+}
+
+// binarySize returns the size of a type when encoded with encoding/binary,
+// or -1 if the size isn't fixed.
+func binarySize(typ reflect.Type) int {
+	switch typ.Kind() {
+	case reflect.Slice, reflect.String:
+		return -1
+	}
+	return binary.Size(reflect.Zero(typ).Interface())
+}
@@ -0,0 +1,145 @@
+package ebpf
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/btf"
+)
+
+type cStructTest struct {
+	A   uint8 `ebpf:"a"`
+	B   uint32
+	C   [3]int16 `ebpf:"c"`
+	D   uint64
+	E   bool
+	Tmp string `ebpf:"-"`
+}
+
+func TestCStructMarshal(t *testing.T) {
+	in := cStructTest{1, 2, [3]int16{-1, 3, 4}, 5, true, "ignored"}
+
+	buf, err := marshalBytes(&in, 32)
+	if err != nil {
+		t.Fatal("Can't marshal:", err)
+	}
+
+	want := make([]byte, 32)
+	want[0] = 1
+	internal.NativeEndian.PutUint32(want[4:], 2)
+	internal.NativeEndian.PutUint16(want[8:], 0xffff)
+	internal.NativeEndian.PutUint16(want[10:], 3)
+	internal.NativeEndian.PutUint16(want[12:], 4)
+	internal.NativeEndian.PutUint64(want[16:], 5)
+	want[24] = 1
+	if !bytes.Equal(buf, want) {
+		t.Fatalf("Expected\n%v\ngot\n%v", want, buf)
+	}
+
+	var out cStructTest
+	if err := unmarshalBytes(&out, buf); err != nil {
+		t.Fatal("Can't unmarshal:", err)
+	}
+
+	in.Tmp = ""
+	if out != in {
+		t.Errorf("Expected %+v, got %+v", in, out)
+	}
+
+	if _, err := marshalBytes(in, 24); err == nil || !strings.Contains(err.Error(), "C size 32") {
+		t.Error("Expected error about the C size, got", err)
+	}
+
+	if err := unmarshalBytes(&out, buf[:24]); err == nil {
+		t.Error("Unmarshaling from a short buffer doesn't return an error")
+	}
+
+	if _, err := marshalBytes((*cStructTest)(nil), 32); err == nil {
+		t.Error("Marshaling a nil pointer doesn't return an error")
+	}
+	if _, err := marshalBytes((*uint32)(nil), 4); err == nil {
+		t.Error("Marshaling a nil *uint32 doesn't return an error")
+	}
+	if _, err := marshalBytes(nil, 4); err == nil {
+		t.Error("Marshaling nil doesn't return an error")
+	}
+}
+
+func TestCStructLayoutErrors(t *testing.T) {
+	type unexported struct {
+		A uint32 `ebpf:"a"`
+		b uint32
+	}
+	if _, err := marshalBytes(unexported{}, 8); err == nil {
+		t.Error("Unexported fields should be rejected")
+	}
+
+	type platform struct {
+		A int `ebpf:"a"`
+	}
+	if _, err := marshalBytes(platform{}, 8); err == nil {
+		t.Error("int should be rejected")
+	}
+
+	type padding struct {
+		A uint8 `ebpf:"a"`
+		_ [3]byte
+		B uint8
+	}
+	buf, err := marshalBytes(padding{1, [3]byte{}, 2}, 5)
+	if err != nil {
+		t.Fatal("Can't marshal explicit padding:", err)
+	}
+	if !bytes.Equal(buf, []byte{1, 0, 0, 0, 2}) {
+		t.Error("Unexpected encoding of explicit padding:", buf)
+	}
+}
+
+func TestMapSpecCheckTypes(t *testing.T) {
+	u8 := &btf.Int{Size: 1}
+	u32 := &btf.Int{Size: 4}
+	s16 := &btf.Int{Size: 2, Encoding: btf.Signed}
+	u64 := &btf.Int{Size: 8}
+	value := &btf.Struct{Size: 32, Members: []btf.Member{
+		{Name: "a", Type: u8, Offset: 0},
+		{Name: "b", Type: u32, Offset: 32},
+		{Name: "c", Type: &btf.Array{Type: s16, Nelems: 3}, Offset: 64},
+		{Name: "d", Type: u64, Offset: 128},
+		{Name: "e", Type: u8, Offset: 192},
+	}}
+
+	btfMap := btf.NewMap(nil, u32, value)
+	spec := &MapSpec{
+		Type:      Hash,
+		KeySize:   4,
+		ValueSize: 32,
+		BTF:       &btfMap,
+	}
+
+	if err := spec.CheckTypes(uint32(0), cStructTest{}); err != nil {
+		t.Error("Matching types are rejected:", err)
+	}
+
+	if err := spec.CheckTypes(uint64(0), nil); err == nil {
+		t.Error("Key with wrong size is accepted")
+	}
+
+	type wrongOffset struct {
+		A uint8  `ebpf:"a"`
+		B uint64 `ebpf:"b"`
+		C [2]uint64
+	}
+	if err := spec.CheckTypes(nil, wrongOffset{}); err == nil || !strings.Contains(err.Error(), "member b") {
+		t.Error("Expected error about the offset of b, got", err)
+	}
+
+	type wrongName struct {
+		A uint8 `ebpf:"x"`
+		B [3]uint64
+	}
+	if err := spec.CheckTypes(nil, &wrongName{}); err == nil {
+		t.Error("Unknown member is accepted")
+	}
+}
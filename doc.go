@@ -12,5 +12,15 @@
 // eBPF code should be compiled ahead of time using clang, and shipped with
 // your application as any other resource.
 //
+// On Windows, syscalls are forwarded to ebpfapi.dll of ebpf-for-windows
+// instead. Only a subset of the commands is available. This allows reusing
+// the asm package and the Map and Program abstractions, with a limitation:
+// MapType and ProgramType are passed unchanged, but ebpf-for-windows numbers
+// them differently. Only Hash, Array and ProgramArray have the same value on
+// both platforms. For other types convert the number from the headers of
+// ebpf-for-windows, for example ProgramType(1) for XDP, instead of using the
+// constants of this package. The same applies to the types reported by
+// MapInfo and ProgramInfo.
+//
 // Use the link subpackage to attach a loaded program to a hook in the kernel.
 package ebpf
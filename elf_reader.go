@@ -26,6 +26,8 @@ type elfCode struct {
 	license  string
 	version  uint32
 	btf      *btf.Spec
+	// Offsets of extern variables in the .kconfig map.
+	kconfig map[string]uint32
 }
 
 // LoadCollectionSpec parses an ELF file into a CollectionSpec.
@@ -182,13 +184,17 @@ func LoadCollectionSpecFromReader(rd io.ReaderAt) (*CollectionSpec, error) {
 		return nil, fmt.Errorf("load data sections: %w", err)
 	}
 
+	if err := ec.loadKconfigMap(maps); err != nil {
+		return nil, fmt.Errorf("load kconfig: %w", err)
+	}
+
 	// Finally, collect programs and link them.
 	progs, err := ec.loadPrograms()
 	if err != nil {
 		return nil, fmt.Errorf("load programs: %w", err)
 	}
 
-	return &CollectionSpec{maps, progs}, nil
+	return &CollectionSpec{Maps: maps, Programs: progs}, nil
 }
 
 func loadLicense(sec *elf.Section) (string, error) {
@@ -276,6 +282,7 @@ func (ec *elfCode) loadPrograms() (map[string]*ProgramSpec, error) {
 
 		spec := &ProgramSpec{
 			Name:          funcSym.Name,
+			SectionName:   sec.Name,
 			Type:          progType,
 			Flags:         progFlags,
 			AttachType:    attachType,
@@ -448,6 +455,19 @@ func (ec *elfCode) relocateInstruction(ins *asm.Instruction, rel elf.Symbol) err
 		}
 
 	case undefSection:
+		if offset, ok := ec.kconfig[name]; ok {
+			// An extern variable in the .kconfig section, which is
+			// accessed like a global variable.
+			ins.Constant = int64(offset) << 32
+			ins.Src = asm.PseudoMapValue
+			if err := ins.RewriteMapPtr(-1); err != nil {
+				return err
+			}
+
+			name = kconfigMap
+			break
+		}
+
 		if bind != elf.STB_GLOBAL {
 			return fmt.Errorf("asm relocation: %s: unsupported binding: %s", name, bind)
 		}
@@ -799,9 +819,15 @@ func (ec *elfCode) loadDataSections(maps map[string]*MapSpec) error {
 			return err
 		}
 
-		data, err := sec.Data()
-		if err != nil {
-			return fmt.Errorf("data section %s: can't get contents: %w", sec.Name, err)
+		var data []byte
+		if sec.Type == elf.SHT_NOBITS {
+			// Sections like .bss don't occupy space in the ELF.
+			data = make([]byte, sec.Size)
+		} else {
+			data, err = sec.Data()
+			if err != nil {
+				return fmt.Errorf("data section %s: can't get contents: %w", sec.Name, err)
+			}
 		}
 
 		if uint64(len(data)) > math.MaxUint32 {
@@ -832,6 +858,50 @@ func (ec *elfCode) loadDataSections(maps map[string]*MapSpec) error {
 	return nil
 }
 
+// loadKconfigMap creates a map for the extern variables in the .kconfig
+// section. Its contents are filled in when loading the collection, see
+// resolveKconfig.
+func (ec *elfCode) loadKconfigMap(maps map[string]*MapSpec) error {
+	if ec.btf == nil {
+		return nil
+	}
+
+	var ds btf.Datasec
+	err := ec.btf.FindType(kconfigMap, &ds)
+	if errors.Is(err, btf.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if ds.Size == 0 {
+		return nil
+	}
+
+	btfMap, err := ec.btf.Datasec(kconfigMap)
+	if err != nil {
+		return err
+	}
+
+	ec.kconfig = make(map[string]uint32)
+	for _, vsi := range ds.Vars {
+		ec.kconfig[string(vsi.Type.(*btf.Var).Name)] = vsi.Offset
+	}
+
+	maps[kconfigMap] = &MapSpec{
+		Name:       SanitizeName(kconfigMap, -1),
+		Type:       Array,
+		KeySize:    4,
+		ValueSize:  ds.Size,
+		MaxEntries: 1,
+		Flags:      unix.BPF_F_RDONLY_PROG,
+		Freeze:     true,
+		BTF:        btfMap,
+	}
+	return nil
+}
+
 func getProgType(sectionName string) (ProgramType, AttachType, uint32, string) {
 	types := map[string]struct {
 		progType   ProgramType
@@ -847,6 +917,10 @@ func getProgType(sectionName string) (ProgramType, AttachType, uint32, string) {
 		"uretprobe/":            {Kprobe, AttachNone, 0},
 		"tracepoint/":           {TracePoint, AttachNone, 0},
 		"raw_tracepoint/":       {RawTracepoint, AttachNone, 0},
+		"raw_tp/":               {RawTracepoint, AttachNone, 0},
+		"raw_tracepoint.w/":     {RawTracepointWritable, AttachNone, 0},
+		"raw_tp.w/":             {RawTracepointWritable, AttachNone, 0},
+		"xdp.frags":             {XDP, AttachNone, unix.BPF_F_XDP_HAS_FRAGS},
 		"xdp":                   {XDP, AttachNone, 0},
 		"perf_event":            {PerfEvent, AttachNone, 0},
 		"lwt_in":                {LWTIn, AttachNone, 0},
@@ -855,8 +929,10 @@ func getProgType(sectionName string) (ProgramType, AttachType, uint32, string) {
 		"lwt_seg6local":         {LWTSeg6Local, AttachNone, 0},
 		"sockops":               {SockOps, AttachCGroupSockOps, 0},
 		"sk_skb/stream_parser":  {SkSKB, AttachSkSKBStreamParser, 0},
-		"sk_skb/stream_verdict": {SkSKB, AttachSkSKBStreamParser, 0},
-		"sk_msg":                {SkMsg, AttachSkSKBStreamVerdict, 0},
+		"sk_skb/stream_verdict": {SkSKB, AttachSkSKBStreamVerdict, 0},
+		"sk_msg":                {SkMsg, AttachSkMsgVerdict, 0},
+		"sk_reuseport/migrate":  {SkReuseport, AttachSkReuseportSelectOrMigrate, 0},
+		"sk_reuseport":          {SkReuseport, AttachSkReuseportSelect, 0},
 		"lirc_mode2":            {LircMode2, AttachLircMode2, 0},
 		"flow_dissector":        {FlowDissector, AttachFlowDissector, 0},
 		"iter/":                 {Tracing, AttachTraceIter, 0},
@@ -864,6 +940,7 @@ func getProgType(sectionName string) (ProgramType, AttachType, uint32, string) {
 		"fmod_ret.s/":           {Tracing, AttachModifyReturn, unix.BPF_F_SLEEPABLE},
 		"fexit.s/":              {Tracing, AttachTraceFExit, unix.BPF_F_SLEEPABLE},
 		"sk_lookup/":            {SkLookup, AttachSkLookup, 0},
+		"freplace/":             {Extension, AttachNone, 0},
 		"lsm/":                  {LSM, AttachLSMMac, 0},
 		"lsm.s/":                {LSM, AttachLSMMac, unix.BPF_F_SLEEPABLE},
 
@@ -886,22 +963,30 @@ func getProgType(sectionName string) (ProgramType, AttachType, uint32, string) {
 		"cgroup/getsockopt":  {CGroupSockopt, AttachCGroupGetsockopt, 0},
 		"cgroup/setsockopt":  {CGroupSockopt, AttachCGroupSetsockopt, 0},
 		"classifier":         {SchedCLS, AttachNone, 0},
+		"tcx/ingress":        {SchedCLS, AttachTCXIngress, 0},
+		"tcx/egress":         {SchedCLS, AttachTCXEgress, 0},
 		"action":             {SchedACT, AttachNone, 0},
 	}
 
-	for prefix, t := range types {
-		if !strings.HasPrefix(sectionName, prefix) {
-			continue
+	// Prefixes may overlap, for example "xdp" and "xdp.frags". Use the
+	// longest match.
+	var match string
+	for prefix := range types {
+		if strings.HasPrefix(sectionName, prefix) && len(prefix) > len(match) {
+			match = prefix
 		}
+	}
 
-		if !strings.HasSuffix(prefix, "/") {
-			return t.progType, t.attachType, t.progFlags, ""
-		}
+	if match == "" {
+		return UnspecifiedProgram, AttachNone, 0, ""
+	}
 
-		return t.progType, t.attachType, t.progFlags, sectionName[len(prefix):]
+	t := types[match]
+	if !strings.HasSuffix(match, "/") {
+		return t.progType, t.attachType, t.progFlags, ""
 	}
 
-	return UnspecifiedProgram, AttachNone, 0, ""
+	return t.progType, t.attachType, t.progFlags, sectionName[len(match):]
 }
 
 func (ec *elfCode) loadRelocations(sec *elf.Section, symbols []elf.Symbol) (map[uint64]elf.Symbol, error) {
@@ -0,0 +1,37 @@
+// +build go1.16
+
+package ebpf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// LoadCollectionSpecFromFS parses an ELF file in fsys into a CollectionSpec.
+//
+// This allows loading objects embedded via go:embed without writing them
+// to a temporary file first.
+func LoadCollectionSpecFromFS(fsys fs.FS, name string) (*CollectionSpec, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rd, ok := f.(io.ReaderAt)
+	if !ok {
+		buf, err := io.ReadAll(f)
+		if err != nil {
+			return nil, fmt.Errorf("file %s: %w", name, err)
+		}
+		rd = bytes.NewReader(buf)
+	}
+
+	spec, err := LoadCollectionSpecFromReader(rd)
+	if err != nil {
+		return nil, fmt.Errorf("file %s: %w", name, err)
+	}
+	return spec, nil
+}
@@ -0,0 +1,63 @@
+// +build go1.16
+
+package ebpf
+
+import (
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/cilium/ebpf/internal/btf"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// readerFS hides the io.ReaderAt implementation of files.
+type readerFS struct {
+	fs.FS
+}
+
+func (rfs readerFS) Open(name string) (fs.File, error) {
+	f, err := rfs.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return struct{ fs.File }{f}, nil
+}
+
+func TestLoadCollectionSpecFromFS(t *testing.T) {
+	const name = "loader-clang-11-el.elf"
+
+	want, err := LoadCollectionSpec("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mapFS := fstest.MapFS{name: &fstest.MapFile{Data: buf}}
+	for _, fsys := range []fs.FS{os.DirFS("testdata"), mapFS, readerFS{mapFS}} {
+		have, err := LoadCollectionSpecFromFS(fsys, name)
+		if err != nil {
+			t.Fatalf("%T: %s", fsys, err)
+		}
+
+		// Instructions aren't compared since the order in which functions
+		// are linked isn't stable.
+		opts := cmp.Options{
+			cmpopts.IgnoreTypes(new(btf.Map), new(btf.Program)),
+			cmpopts.IgnoreFields(ProgramSpec{}, "Instructions"),
+		}
+		if diff := cmp.Diff(want, have, opts...); diff != "" {
+			t.Errorf("%T: spec mismatch (-want +got):\n%s", fsys, diff)
+		}
+	}
+
+	if _, err := LoadCollectionSpecFromFS(mapFS, "missing.elf"); err == nil {
+		t.Error("Loading a missing file doesn't return an error")
+	}
+}
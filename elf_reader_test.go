@@ -82,19 +82,22 @@ func TestLoadCollectionSpec(t *testing.T) {
 		},
 		Programs: map[string]*ProgramSpec{
 			"xdp_prog": {
-				Name:    "xdp_prog",
-				Type:    XDP,
-				License: "MIT",
+				Name:        "xdp_prog",
+				SectionName: "xdp",
+				Type:        XDP,
+				License:     "MIT",
 			},
 			"no_relocation": {
-				Name:    "no_relocation",
-				Type:    SocketFilter,
-				License: "MIT",
+				Name:        "no_relocation",
+				SectionName: "socket",
+				Type:        SocketFilter,
+				License:     "MIT",
 			},
 			"asm_relocation": {
-				Name:    "asm_relocation",
-				Type:    SocketFilter,
-				License: "MIT",
+				Name:        "asm_relocation",
+				SectionName: "socket/2",
+				Type:        SocketFilter,
+				License:     "MIT",
 			},
 		},
 	}
@@ -277,6 +280,47 @@ func TestLoadRawTracepoint(t *testing.T) {
 	})
 }
 
+func TestLoadKconfig(t *testing.T) {
+	testutils.TestFiles(t, "testdata/kconfig-*.elf", func(t *testing.T, file string) {
+		spec, err := LoadCollectionSpec(file)
+		if err != nil {
+			t.Fatal("Can't parse ELF:", err)
+		}
+
+		m := spec.Maps[".kconfig"]
+		if m == nil {
+			t.Fatal("Missing .kconfig map")
+		}
+		if m.ValueSize != 12 {
+			t.Error("Expected value size 12, got", m.ValueSize)
+		}
+		if !m.Freeze {
+			t.Error(".kconfig map should be frozen")
+		}
+
+		if spec.Programs["kconfig"].ByteOrder != internal.NativeEndian {
+			return
+		}
+
+		coll, err := NewCollection(spec)
+		testutils.SkipIfNotSupported(t, err)
+		if err != nil {
+			t.Fatal("Can't create collection:", err)
+		}
+		defer coll.Close()
+
+		ret, _, err := coll.Programs["kconfig"].Test(make([]byte, 14))
+		testutils.SkipIfNotSupported(t, err)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ret != 1 {
+			t.Error("Unexpected kconfig values, program returned", ret)
+		}
+	})
+}
+
 var (
 	elfPath    = flag.String("elfs", os.Getenv("KERNEL_SELFTESTS"), "`Path` containing libbpf-compatible ELFs (defaults to $KERNEL_SELFTESTS)")
 	elfPattern = flag.String("elf-pattern", "*.o", "Glob `pattern` for object files that should be tested")
@@ -337,6 +381,37 @@ func TestGetProgType(t *testing.T) {
 			At: AttachNone,
 			To: "",
 		},
+		"xdp.frags/foo": {
+			Pt: XDP,
+			At: AttachNone,
+			To: "",
+			Fl: unix.BPF_F_XDP_HAS_FRAGS,
+		},
+		"tcx/egress": {
+			Pt: SchedCLS,
+			At: AttachTCXEgress,
+			To: "",
+		},
+		"raw_tp.w/nbd_send_request": {
+			Pt: RawTracepointWritable,
+			At: AttachNone,
+			To: "nbd_send_request",
+		},
+		"freplace/handle_packet": {
+			Pt: Extension,
+			At: AttachNone,
+			To: "handle_packet",
+		},
+		"sk_msg": {
+			Pt: SkMsg,
+			At: AttachSkMsgVerdict,
+			To: "",
+		},
+		"sk_reuseport/migrate": {
+			Pt: SkReuseport,
+			At: AttachSkReuseportSelectOrMigrate,
+			To: "",
+		},
 		"cgroup_skb/ingress": {
 			Pt: CGroupSKB,
 			At: AttachCGroupInetIngress,
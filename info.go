@@ -10,8 +10,11 @@ import (
 	"strings"
 	"syscall"
 	"time"
+	"unsafe"
 
+	"github.com/cilium/ebpf/asm"
 	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/unix"
 )
 
 // MapInfo describes a map.
@@ -88,7 +91,10 @@ type ProgramInfo struct {
 	// Name as supplied by user space at load time.
 	Name string
 
+	btfID uint32
 	stats *programStats
+	// Instructions as rewritten by the verifier, in host endianness.
+	insns []byte
 }
 
 func newProgramInfoFromFd(fd *internal.FD) (*ProgramInfo, error) {
@@ -100,6 +106,19 @@ func newProgramInfoFromFd(fd *internal.FD) (*ProgramInfo, error) {
 		return nil, err
 	}
 
+	var insns []byte
+	if info.xlated_prog_len > 0 {
+		// xlated_prog_len is zero if the caller lacks CAP_SYS_ADMIN.
+		insns = make([]byte, info.xlated_prog_len)
+		info2 := bpfProgInfo{
+			xlated_prog_len:   info.xlated_prog_len,
+			xlated_prog_insns: internal.NewSlicePointer(insns),
+		}
+		if err := internal.BPFObjGetInfoByFD(fd, unsafe.Pointer(&info2), unsafe.Sizeof(info2)); err != nil {
+			return nil, fmt.Errorf("can't get program instructions: %w", err)
+		}
+	}
+
 	return &ProgramInfo{
 		Type: ProgramType(info.prog_type),
 		id:   ProgramID(info.id),
@@ -107,10 +126,13 @@ func newProgramInfoFromFd(fd *internal.FD) (*ProgramInfo, error) {
 		Tag: hex.EncodeToString(info.tag[:]),
 		// name is available from 4.15.
 		Name: internal.CString(info.name[:]),
+		// btf_id is available from 5.0.
+		btfID: info.btf_id,
 		stats: &programStats{
 			runtime:  time.Duration(info.run_time_ns),
 			runCount: info.run_cnt,
 		},
+		insns: insns,
 	}, nil
 }
 
@@ -142,6 +164,16 @@ func (pi *ProgramInfo) ID() (ProgramID, bool) {
 	return pi.id, pi.id > 0
 }
 
+// BTFID returns the ID of the BTF loaded with the program.
+//
+// Available from 5.0.
+//
+// The bool return value indicates whether this optional field is available
+// and the program was loaded with BTF.
+func (pi *ProgramInfo) BTFID() (uint32, bool) {
+	return pi.btfID, pi.btfID > 0
+}
+
 // RunCount returns the total number of times the program was called.
 //
 // Can return 0 if the collection of statistics is not enabled. See EnableStats().
@@ -164,6 +196,22 @@ func (pi *ProgramInfo) Runtime() (time.Duration, bool) {
 	return time.Duration(0), false
 }
 
+// Instructions returns the instructions of the program as rewritten by the
+// verifier.
+//
+// Map references are replaced by kernel addresses, and calls to helpers may
+// have been inlined. Requires CAP_SYS_ADMIN.
+//
+// Available from 4.13. Returns an error wrapping ErrNotSupported if the
+// instructions are not available.
+func (pi *ProgramInfo) Instructions() (asm.Instructions, error) {
+	if len(pi.insns) == 0 {
+		return nil, fmt.Errorf("translated instructions: %w", ErrNotSupported)
+	}
+
+	return asm.UnmarshalInstructions(pi.insns, internal.NativeEndian)
+}
+
 func scanFdInfo(fd *internal.FD, fields map[string]interface{}) error {
 	raw, err := fd.Value()
 	if err != nil {
@@ -220,13 +268,36 @@ func scanFdInfoReader(r io.Reader, fields map[string]interface{}) error {
 	return nil
 }
 
+// ProgramStats contains runtime statistics of a program.
+type ProgramStats struct {
+	// Total accumulated runtime of the program.
+	Runtime time.Duration
+	// Total number of times the program was called.
+	RunCount uint64
+	// Total number of times the program wasn't called because it was
+	// already running on the same CPU. Available from 5.12.
+	RecursionMisses uint64
+}
+
+// StatsRunTime enables the collection of ProgramStats.Runtime and
+// ProgramStats.RunCount, see EnableStats.
+const StatsRunTime = unix.BPF_STATS_RUN_TIME
+
 // EnableStats starts the measuring of the runtime
 // and run counts of eBPF programs.
 //
+// which selects the statistics to collect, and is usually StatsRunTime.
+// Statistics are collected for all programs on the system until the
+// returned io.Closer is closed.
+//
 // Collecting statistics can have an impact on the performance.
 //
 // Requires at least 5.8.
 func EnableStats(which uint32) (io.Closer, error) {
+	if err := haveEnableStats(); err != nil {
+		return nil, err
+	}
+
 	attr := internal.BPFEnableStatsAttr{
 		StatsType: which,
 	}
@@ -237,3 +308,17 @@ func EnableStats(which uint32) (io.Closer, error) {
 	}
 	return fd, nil
 }
+
+var haveEnableStats = internal.FeatureTest("BPF_ENABLE_STATS", "5.8", func() error {
+	fd, err := internal.BPFEnableStats(&internal.BPFEnableStatsAttr{
+		StatsType: unix.BPF_STATS_RUN_TIME,
+	})
+	if errors.Is(err, unix.EINVAL) {
+		return internal.ErrNotSupported
+	}
+	if err != nil {
+		return err
+	}
+	_ = fd.Close()
+	return nil
+})
@@ -118,6 +118,79 @@ func TestProgramInfo(t *testing.T) {
 	}
 }
 
+func TestObjNames(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "4.15", "object names")
+
+	m, err := NewMap(&MapSpec{
+		Name:       "invalid-name!_which_is_too_long",
+		Type:       Array,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 1,
+	})
+	if err != nil {
+		t.Fatal("Invalid characters aren't removed from the map name:", err)
+	}
+	defer m.Close()
+
+	info, err := m.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "invalidname_whi"; info.Name != want {
+		t.Errorf("Expected map name %q, got %q", want, info.Name)
+	}
+
+	spec := socketFilterSpec.Copy()
+	spec.Name = "my-prog"
+	prog, err := NewProgram(spec)
+	if err != nil {
+		t.Fatal("Invalid characters aren't removed from the program name:", err)
+	}
+	defer prog.Close()
+
+	id, err := prog.ID()
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fromID, err := NewProgramFromID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fromID.Close()
+
+	if want := "SocketFilter(myprog)"; !strings.HasPrefix(fromID.String(), want) {
+		t.Errorf("Expected program from ID to be %s, got %s", want, fromID)
+	}
+}
+
+func TestProgramInfoInstructions(t *testing.T) {
+	prog := createSocketFilter(t)
+	defer prog.Close()
+
+	info, err := prog.Info()
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal("Can't get program info:", err)
+	}
+
+	insns, err := info.Instructions()
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal("Can't get instructions:", err)
+	}
+
+	if len(insns) == 0 {
+		t.Fatal("Program has no instructions")
+	}
+
+	if last := insns[len(insns)-1]; last.OpCode.JumpOp() != asm.Exit {
+		t.Error("Expected last instruction to be exit, got", last)
+	}
+}
+
 func TestScanFdInfoReader(t *testing.T) {
 	tests := []struct {
 		fields map[string]interface{}
@@ -189,6 +262,60 @@ func TestStats(t *testing.T) {
 	}
 }
 
+func TestHaveEnableStats(t *testing.T) {
+	testutils.CheckFeatureTest(t, haveEnableStats)
+}
+
+func TestEnableStatsInvalid(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.8", "BPF_ENABLE_STATS")
+
+	_, err := EnableStats(^uint32(0))
+	if err == nil {
+		t.Fatal("Enabling invalid stats doesn't return an error")
+	}
+	if errors.Is(err, ErrNotSupported) {
+		t.Fatal("Invalid stats type is reported as unsupported:", err)
+	}
+}
+
+func TestProgramStats(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.8", "BPF_ENABLE_STATS")
+
+	prog, err := NewProgram(&ProgramSpec{
+		Type: SocketFilter,
+		Instructions: asm.Instructions{
+			asm.LoadImm(asm.R0, 42, asm.DWord),
+			asm.Return(),
+		},
+		License: "MIT",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer prog.Close()
+
+	stats, err := EnableStats(StatsRunTime)
+	if err != nil {
+		t.Fatal("Can't enable stats:", err)
+	}
+	defer stats.Close()
+
+	if _, _, err := prog.Test(make([]byte, 14)); err != nil {
+		t.Fatal(err)
+	}
+
+	ps, err := prog.Stats()
+	if err != nil {
+		t.Fatal("Can't get stats:", err)
+	}
+	if ps.RunCount < 1 {
+		t.Errorf("Expected a run count of at least 1, got %d", ps.RunCount)
+	}
+	if ps.Runtime == 0 {
+		t.Error("Expected a runtime other than 0ns")
+	}
+}
+
 // BenchmarkStats is a benchmark of TestStats. See testStats for details.
 func BenchmarkStats(b *testing.B) {
 	testutils.SkipOnOldKernel(b, "5.8", "BPF_ENABLE_STATS")
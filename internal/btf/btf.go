@@ -160,6 +160,15 @@ func loadSpecFromVmlinux(rd io.ReaderAt) (*Spec, error) {
 	return loadNakedSpec(btfSection.Open(), file.ByteOrder, nil, nil)
 }
 
+// LoadRawSpec reads a blob of BTF data that isn't wrapped in an ELF file,
+// as found in /sys/kernel/btf/vmlinux.
+//
+// Use this to load BTF for kernels built without CONFIG_DEBUG_INFO_BTF,
+// for example from a separately distributed file.
+func LoadRawSpec(btf io.ReadSeeker, bo binary.ByteOrder) (*Spec, error) {
+	return loadNakedSpec(btf, bo, nil, nil)
+}
+
 func loadNakedSpec(btf io.ReadSeeker, bo binary.ByteOrder, sectionSizes map[string]uint32, variableOffsets map[variable]uint32) (*Spec, error) {
 	rawTypes, rawStrings, err := parseBTF(btf, bo)
 	if err != nil {
@@ -318,7 +327,14 @@ func fixupDatasec(rawTypes []rawType, rawStrings stringTable, sectionSizes map[s
 			return err
 		}
 
-		if name == ".kconfig" || name == ".ksyms" {
+		if name == ".kconfig" {
+			if err := fixupKconfig(rawTypes, i); err != nil {
+				return fmt.Errorf("data section %s: %w", name, err)
+			}
+			continue
+		}
+
+		if name == ".ksyms" {
 			return fmt.Errorf("reference to %s: %w", name, ErrNotSupported)
 		}
 
@@ -357,6 +373,73 @@ func fixupDatasec(rawTypes []rawType, rawStrings stringTable, sectionSizes map[s
 	return nil
 }
 
+// fixupKconfig lays out the extern variables in the .kconfig section.
+//
+// The compiler doesn't assign offsets to extern variables since their values
+// are provided by the loader. Variables are placed in order of declaration
+// at their natural alignment, and turned into regular global variables
+// since the kernel doesn't accept extern ones.
+func fixupKconfig(rawTypes []rawType, i int) error {
+	var offset uint32
+	secinfos := rawTypes[i].data.([]btfVarSecinfo)
+	for j, secInfo := range secinfos {
+		id := int(secInfo.Type - 1)
+		if id < 0 || id >= len(rawTypes) || rawTypes[id].Kind() != kindVar {
+			return fmt.Errorf("invalid type id %d for variable %d", secInfo.Type, j)
+		}
+
+		size, align, err := rawSizeof(rawTypes, rawTypes[id].Type())
+		if err != nil {
+			return fmt.Errorf("variable %d: %w", j, err)
+		}
+
+		offset = (offset + align - 1) / align * align
+		secinfos[j].Offset = offset
+		secinfos[j].Size = size
+		offset += size
+
+		rawTypes[id].data.(*btfVariable).Linkage = varLinkageGlobalAllocated
+	}
+
+	rawTypes[i].SizeType = offset
+	return nil
+}
+
+// rawSizeof returns the size and alignment of types which can be used
+// as kconfig variables.
+func rawSizeof(rawTypes []rawType, id TypeID) (size, align uint32, err error) {
+	for depth := 0; depth <= maxTypeDepth; depth++ {
+		if id == 0 || int(id) > len(rawTypes) {
+			return 0, 0, fmt.Errorf("invalid type id %d", id)
+		}
+
+		raw := &rawTypes[id-1]
+		switch raw.Kind() {
+		case kindInt, kindEnum:
+			return raw.Size(), raw.Size(), nil
+
+		case kindPointer:
+			return 8, 8, nil
+
+		case kindArray:
+			arr := raw.data.(*btfArray)
+			size, align, err := rawSizeof(rawTypes, arr.Type)
+			if err != nil {
+				return 0, 0, err
+			}
+			return size * arr.Nelems, align, nil
+
+		case kindTypedef, kindVolatile, kindConst, kindRestrict:
+			id = raw.Type()
+
+		default:
+			return 0, 0, fmt.Errorf("type id %d: unsupported kind %s", id, raw.Kind())
+		}
+	}
+
+	return 0, 0, fmt.Errorf("type id %d: exceeded type depth", id)
+}
+
 type marshalOpts struct {
 	ByteOrder        binary.ByteOrder
 	StripFuncLinkage bool
@@ -496,6 +579,85 @@ func (s *Spec) FindType(name string, typ Type) error {
 	return nil
 }
 
+// TypeByID returns the type with the given ID.
+//
+// The returned type is shared with the Spec and mustn't be modified.
+//
+// Returns an error wrapping ErrNotFound if the ID doesn't exist.
+func (s *Spec) TypeByID(id TypeID) (Type, error) {
+	if int(id) >= len(s.types) {
+		return nil, fmt.Errorf("type ID %d: %w", id, ErrNotFound)
+	}
+
+	return s.types[id], nil
+}
+
+// AnyTypesByName returns all types with the given name, regardless of
+// their kind.
+//
+// The returned types are shared with the Spec and mustn't be modified.
+//
+// Returns an error wrapping ErrNotFound if no type has the name.
+func (s *Spec) AnyTypesByName(name string) ([]Type, error) {
+	var result []Type
+	for _, typ := range s.namedTypes[essentialName(name)] {
+		// Match against the full name, not just the essential one.
+		if typ.name() == name {
+			result = append(result, typ)
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("type %s: %w", name, ErrNotFound)
+	}
+
+	return result, nil
+}
+
+// LoadSpecFromID reads BTF loaded into the kernel, for example the BTF
+// of a program as returned by its info.
+//
+// Requires at least Linux 5.0.
+func LoadSpecFromID(id uint32) (*Spec, error) {
+	fd, err := bpfGetBTFFDByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("get BTF %d: %w", id, err)
+	}
+	defer fd.Close()
+
+	var info bpfBTFInfo
+	if err := internal.BPFObjGetInfoByFD(fd, unsafe.Pointer(&info), unsafe.Sizeof(info)); err != nil {
+		return nil, fmt.Errorf("get info of BTF %d: %w", id, err)
+	}
+
+	raw := make([]byte, info.btfSize)
+	info = bpfBTFInfo{
+		btf:     internal.NewSlicePointer(raw),
+		btfSize: uint32(len(raw)),
+	}
+	if err := internal.BPFObjGetInfoByFD(fd, unsafe.Pointer(&info), unsafe.Sizeof(info)); err != nil {
+		return nil, fmt.Errorf("get info of BTF %d: %w", id, err)
+	}
+
+	return loadNakedSpec(bytes.NewReader(raw), internal.NativeEndian, nil, nil)
+}
+
+// FindFuncByID returns the type ID of a function in BTF loaded into the
+// kernel, for example the BTF of a program.
+func FindFuncByID(id uint32, name string) (TypeID, error) {
+	spec, err := LoadSpecFromID(id)
+	if err != nil {
+		return 0, err
+	}
+
+	var fn Func
+	if err := spec.FindType(name, &fn); err != nil {
+		return 0, err
+	}
+
+	return fn.ID(), nil
+}
+
 // Handle is a reference to BTF loaded into the kernel.
 type Handle struct {
 	fd *internal.FD
@@ -509,7 +671,7 @@ func NewHandle(spec *Spec) (*Handle, error) {
 		return nil, err
 	}
 
-	if spec.byteOrder != internal.NativeEndian {
+	if !internal.IsNativeEndian(spec.byteOrder) {
 		return nil, fmt.Errorf("can't load %s BTF on %s", spec.byteOrder, internal.NativeEndian)
 	}
 
@@ -665,6 +827,15 @@ func ProgramLineInfos(s *Program) (recordSize uint32, bytes []byte, err error) {
 	return s.lineInfos.recordSize, bytes, nil
 }
 
+// ProgramLines returns the source lines of the program, ordered by
+// instruction offset.
+//
+// This is a free function instead of a method to hide it from users
+// of package ebpf.
+func ProgramLines(s *Program) ([]Line, error) {
+	return s.lineInfos.lines(s.spec.byteOrder, s.spec.strings)
+}
+
 // ProgramRelocations returns the CO-RE relocations required to adjust the
 // program to the target.
 //
@@ -678,6 +849,17 @@ func ProgramRelocations(s *Program, target *Spec) (map[uint64]Relocation, error)
 	return coreRelocate(s.spec, target, s.coreRelos)
 }
 
+// ProgramWithoutRelocations returns a copy of s without CO-RE
+// relocations, for use after they were applied to the instructions.
+//
+// This is a free function instead of a method to hide it from users
+// of package ebpf.
+func ProgramWithoutRelocations(s *Program) *Program {
+	cpy := *s
+	cpy.coreRelos = nil
+	return &cpy
+}
+
 type bpfLoadBTFAttr struct {
 	btf         internal.Pointer
 	logBuf      internal.Pointer
@@ -695,6 +877,26 @@ func bpfLoadBTF(attr *bpfLoadBTFAttr) (*internal.FD, error) {
 	return internal.NewFD(uint32(fd)), nil
 }
 
+type bpfGetBTFFDByIDAttr struct {
+	id uint32
+}
+
+func bpfGetBTFFDByID(id uint32) (*internal.FD, error) {
+	attr := bpfGetBTFFDByIDAttr{id}
+	fd, err := internal.BPF(internal.BPF_BTF_GET_FD_BY_ID, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	if err != nil {
+		return nil, err
+	}
+
+	return internal.NewFD(uint32(fd)), nil
+}
+
+type bpfBTFInfo struct {
+	btf     internal.Pointer
+	btfSize uint32
+	id      uint32
+}
+
 func marshalBTF(types interface{}, strings []byte, bo binary.ByteOrder) []byte {
 	const minHeaderLength = 24
 
@@ -789,3 +991,137 @@ var haveFuncLinkage = internal.FeatureTest("BTF func linkage", "5.6", func() err
 	fd.Close()
 	return nil
 })
+
+// MarshalSpec encodes s in the format accepted by LoadRawSpec, using the
+// byte order the Spec was loaded with.
+//
+// This is a free function instead of a method to hide it from users
+// of package ebpf.
+func MarshalSpec(s *Spec) ([]byte, binary.ByteOrder, error) {
+	raw, err := s.marshal(marshalOpts{ByteOrder: s.byteOrder})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return raw, s.byteOrder, nil
+}
+
+// programHeader precedes the extended information encoded by MarshalProgram.
+type programHeader struct {
+	Length         uint64
+	FuncRecordSize uint32
+	FuncInfos      uint32
+	LineRecordSize uint32
+	LineInfos      uint32
+	CoreRelos      uint32
+}
+
+// MarshalProgram encodes the length, function and line infos and CO-RE
+// relocations of a program. The Spec of the program isn't included, see
+// MarshalSpec.
+//
+// This is a free function instead of a method to hide it from users
+// of package ebpf.
+func MarshalProgram(s *Program) ([]byte, error) {
+	var (
+		buf bytes.Buffer
+		bo  = s.spec.byteOrder
+	)
+
+	header := programHeader{
+		s.length,
+		s.funcInfos.recordSize, uint32(len(s.funcInfos.records)),
+		s.lineInfos.recordSize, uint32(len(s.lineInfos.records)),
+		uint32(len(s.coreRelos)),
+	}
+	if err := binary.Write(&buf, bo, &header); err != nil {
+		return nil, err
+	}
+
+	for _, ei := range []extInfo{s.funcInfos, s.lineInfos} {
+		for _, info := range ei.records {
+			if len(info.Opaque) != int(ei.recordSize)-4 {
+				return nil, fmt.Errorf("ext_info record has length %d instead of %d", len(info.Opaque)+4, ei.recordSize)
+			}
+
+			if err := binary.Write(&buf, bo, uint32(info.InsnOff)); err != nil {
+				return nil, err
+			}
+			buf.Write(info.Opaque)
+		}
+	}
+
+	if err := binary.Write(&buf, bo, []bpfCoreRelo(s.coreRelos)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalProgram decodes the output of MarshalProgram. spec must be
+// equivalent to the Spec of the marshaled Program.
+//
+// This is a free function instead of a method to hide it from users
+// of package ebpf.
+func UnmarshalProgram(spec *Spec, buf []byte) (*Program, error) {
+	var (
+		rd     = bytes.NewReader(buf)
+		bo     = spec.byteOrder
+		header programHeader
+	)
+
+	if err := binary.Read(rd, bo, &header); err != nil {
+		return nil, fmt.Errorf("can't read header: %v", err)
+	}
+
+	readExtInfo := func(recordSize, n uint32) (extInfo, error) {
+		if n == 0 {
+			return extInfo{recordSize, nil}, nil
+		}
+
+		if recordSize < 4 || uint64(recordSize)*uint64(n) > uint64(rd.Len()) {
+			return extInfo{}, fmt.Errorf("invalid record size %d", recordSize)
+		}
+
+		records := make([]extInfoRecord, 0, n)
+		for i := uint32(0); i < n; i++ {
+			var insnOff uint32
+			if err := binary.Read(rd, bo, &insnOff); err != nil {
+				return extInfo{}, err
+			}
+
+			opaque := make([]byte, recordSize-4)
+			if _, err := io.ReadFull(rd, opaque); err != nil {
+				return extInfo{}, err
+			}
+
+			records = append(records, extInfoRecord{uint64(insnOff), opaque})
+		}
+
+		return extInfo{recordSize, records}, nil
+	}
+
+	funcInfos, err := readExtInfo(header.FuncRecordSize, header.FuncInfos)
+	if err != nil {
+		return nil, fmt.Errorf("func infos: %w", err)
+	}
+
+	lineInfos, err := readExtInfo(header.LineRecordSize, header.LineInfos)
+	if err != nil {
+		return nil, fmt.Errorf("line infos: %w", err)
+	}
+
+	if uint64(header.CoreRelos)*uint64(extInfoReloSize) != uint64(rd.Len()) {
+		return nil, fmt.Errorf("expected %d CO-RE relocations, got %d bytes", header.CoreRelos, rd.Len())
+	}
+
+	var coreRelos bpfCoreRelos
+	if header.CoreRelos > 0 {
+		coreRelos = make(bpfCoreRelos, header.CoreRelos)
+		if err := binary.Read(rd, bo, []bpfCoreRelo(coreRelos)); err != nil {
+			return nil, fmt.Errorf("CO-RE relocations: %v", err)
+		}
+	}
+
+	return &Program{spec, header.Length, funcInfos, lineInfos, coreRelos}, nil
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
 	"testing"
 
@@ -14,7 +15,9 @@ import (
 	"github.com/cilium/ebpf/internal/testutils"
 )
 
-func TestParseVmlinux(t *testing.T) {
+func parseVmlinux(t *testing.T) *Spec {
+	t.Helper()
+
 	fh, err := os.Open("testdata/vmlinux-btf.gz")
 	if err != nil {
 		t.Fatal(err)
@@ -31,13 +34,19 @@ func TestParseVmlinux(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	spec, err := loadNakedSpec(bytes.NewReader(buf), binary.LittleEndian, nil, nil)
+	spec, err := LoadRawSpec(bytes.NewReader(buf), binary.LittleEndian)
 	if err != nil {
 		t.Fatal("Can't load BTF:", err)
 	}
 
+	return spec
+}
+
+func TestParseVmlinux(t *testing.T) {
+	spec := parseVmlinux(t)
+
 	var iphdr Struct
-	err = spec.FindType("iphdr", &iphdr)
+	err := spec.FindType("iphdr", &iphdr)
 	if err != nil {
 		t.Fatalf("unable to find `iphdr` struct: %s", err)
 	}
@@ -66,6 +75,63 @@ func TestParseVmlinux(t *testing.T) {
 	}
 }
 
+func TestSpecTypeLookup(t *testing.T) {
+	spec := parseVmlinux(t)
+
+	types, err := spec.AnyTypesByName("sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sock *Struct
+	for _, typ := range types {
+		if s, ok := typ.(*Struct); ok {
+			sock = s
+		}
+	}
+	if sock == nil {
+		t.Fatal("No struct sock in", types)
+	}
+
+	typ, err := spec.TypeByID(sock.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != sock {
+		t.Error("TypeByID returns", typ, "instead of", sock)
+	}
+
+	for _, test := range []struct {
+		member string
+		offset int
+	}{
+		{"__sk_common", 0},
+		{"__sk_common.skc_family", 16},
+		{"__sk_common.skc_daddr", 0},
+	} {
+		offset, err := Offsetof(sock, test.member)
+		if err != nil {
+			t.Errorf("%s: %s", test.member, err)
+			continue
+		}
+		if offset != test.offset {
+			t.Errorf("%s: expected offset %d, got %d", test.member, test.offset, offset)
+		}
+	}
+
+	if _, err := Offsetof(sock, "__sk_common.bogus"); !errors.Is(err, ErrNotFound) {
+		t.Error("Expected ErrNotFound for missing member, got", err)
+	}
+
+	if _, err := spec.AnyTypesByName("totally_bogus_type"); !errors.Is(err, ErrNotFound) {
+		t.Error("Expected ErrNotFound for missing type, got", err)
+	}
+
+	if _, err := spec.TypeByID(math.MaxUint32); !errors.Is(err, ErrNotFound) {
+		t.Error("Expected ErrNotFound for missing type ID, got", err)
+	}
+}
+
 func TestParseCurrentKernelBTF(t *testing.T) {
 	spec, err := loadKernelSpec()
 	testutils.SkipIfNotSupported(t, err)
@@ -137,10 +203,19 @@ func TestLoadKernelSpec(t *testing.T) {
 		t.Skip("/sys/kernel/btf/vmlinux not present")
 	}
 
-	_, err := LoadKernelSpec()
+	spec, err := LoadKernelSpec()
 	if err != nil {
 		t.Fatal("Can't load kernel spec:", err)
 	}
+
+	cached, err := LoadKernelSpec()
+	if err != nil {
+		t.Fatal("Can't load kernel spec:", err)
+	}
+
+	if spec != cached {
+		t.Error("Kernel spec isn't cached")
+	}
 }
 
 func TestHaveBTF(t *testing.T) {
@@ -166,3 +241,78 @@ func ExampleSpec_FindType() {
 	// We've found struct foo
 	fmt.Println(foo.Name)
 }
+
+func TestMarshalProgram(t *testing.T) {
+	testutils.TestFiles(t, "testdata/relocs-*.elf", func(t *testing.T, file string) {
+		fh, err := os.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fh.Close()
+
+		spec, err := LoadSpecFromReader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		prog, err := spec.Program("socket_filter/type_ids", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		raw, bo, err := MarshalSpec(spec)
+		if err != nil {
+			t.Fatal("Can't marshal spec:", err)
+		}
+
+		spec2, err := LoadRawSpec(bytes.NewReader(raw), bo)
+		if err != nil {
+			t.Fatal("Can't load marshaled spec:", err)
+		}
+
+		if len(spec2.types) != len(spec.types) {
+			t.Errorf("Spec has %d types instead of %d", len(spec2.types), len(spec.types))
+		}
+
+		buf, err := MarshalProgram(prog)
+		if err != nil {
+			t.Fatal("Can't marshal program:", err)
+		}
+
+		prog2, err := UnmarshalProgram(spec2, buf)
+		if err != nil {
+			t.Fatal("Can't unmarshal program:", err)
+		}
+
+		if prog2.length != prog.length {
+			t.Error("Length doesn't match")
+		}
+		if len(prog2.coreRelos) == 0 || fmt.Sprint(prog2.coreRelos) != fmt.Sprint(prog.coreRelos) {
+			t.Error("CO-RE relocations don't match")
+		}
+
+		lines, err := ProgramLines(prog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines2, err := ProgramLines(prog2)
+		if err != nil {
+			t.Fatal("Can't read lines of unmarshaled program:", err)
+		}
+		if len(lines) == 0 || fmt.Sprint(lines2) != fmt.Sprint(lines) {
+			t.Error("Lines don't match")
+		}
+
+		buf2, err := MarshalProgram(prog2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf2, buf) {
+			t.Error("Marshaling the unmarshaled program gives a different result")
+		}
+
+		if _, err := UnmarshalProgram(spec2, buf[:len(buf)-1]); err == nil {
+			t.Error("Unmarshaling truncated program doesn't return an error")
+		}
+	})
+}
@@ -201,6 +201,13 @@ type btfVariable struct {
 	Linkage uint32
 }
 
+// Equivalent of enum btf_var_linkage.
+const (
+	varLinkageStatic uint32 = iota
+	varLinkageGlobalAllocated
+	varLinkageGlobalExtern
+)
+
 type btfEnum struct {
 	NameOff uint32
 	Val     int32
@@ -73,7 +73,7 @@ func (k coreReloKind) String() string {
 func coreRelocate(local, target *Spec, coreRelos bpfCoreRelos) (map[uint64]Relocation, error) {
 	if target == nil {
 		var err error
-		target, err = loadKernelSpec()
+		target, err = LoadKernelSpec()
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,421 @@
+package btf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/cilium/ebpf/internal"
+)
+
+// Decode interprets buf as a value of type typ, and stores the result in
+// the value pointed to by dst.
+//
+// buf is expected to be in native byte order, as produced by a BPF program
+// writing to a perf event array or a ring buffer. It may be longer than
+// the type.
+//
+// If dst points to an empty interface, the value is decoded as follows:
+//
+//   - Struct and Union: map[string]interface{} keyed by member name
+//   - Int: int64 if signed, uint64 if unsigned and bool if boolean
+//   - Enum: the name of the value as a string, or int64 if unknown
+//   - Pointer: uint64
+//   - Array of char: string up to the first NUL byte
+//   - other Array: []interface{}
+//
+// Otherwise dst may point to a Go type which matches the BTF. Members are
+// assigned to exported struct fields with the same name, ignoring case.
+// The name can be overridden with a `btf:"name"` tag, and a tag of "-"
+// skips a field. Members without a matching field are ignored. Enums
+// can be decoded into strings or integers, and char arrays into strings,
+// byte arrays or byte slices.
+//
+// Members of anonymous structs and unions are decoded as if they were
+// members of the enclosing type.
+func Decode(typ Type, buf []byte, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("dst must be a non-nil pointer, got %T", dst)
+	}
+
+	d := decoder{internal.NativeEndian}
+	return d.decode(typ, buf, v.Elem(), 0)
+}
+
+var emptyInterface = reflect.TypeOf((*interface{})(nil)).Elem()
+
+type decoder struct {
+	bo binary.ByteOrder
+}
+
+func (d *decoder) decode(typ Type, buf []byte, dst reflect.Value, depth int) error {
+	if depth > maxTypeDepth {
+		return errors.New("exceeded type depth")
+	}
+
+	typ = skipQualifierAndTypedef(typ)
+	switch t := typ.(type) {
+	case *Int:
+		raw, err := d.readUint(buf, int(t.Size))
+		if err != nil {
+			return fmt.Errorf("%s: %w", t, err)
+		}
+		return setInt(t, raw, t.Size*8, dst)
+
+	case *Enum:
+		raw, err := d.readUint(buf, 4)
+		if err != nil {
+			return fmt.Errorf("%s: %w", t, err)
+		}
+		return setEnum(t, int64(int32(raw)), dst)
+
+	case *Pointer:
+		raw, err := d.readUint(buf, 8)
+		if err != nil {
+			return fmt.Errorf("%s: %w", t, err)
+		}
+		return setUnsigned(raw, dst)
+
+	case *Array:
+		return d.decodeArray(t, buf, dst, depth)
+
+	case composite:
+		return d.decodeComposite(t, buf, dst, depth)
+
+	default:
+		return fmt.Errorf("can't decode %s", typ)
+	}
+}
+
+func (d *decoder) decodeArray(t *Array, buf []byte, dst reflect.Value, depth int) error {
+	elemSize, err := Sizeof(t.Type)
+	if err != nil {
+		return fmt.Errorf("%s: %w", t, err)
+	}
+
+	n := int(t.Nelems)
+	if elemSize > 0 && n > len(buf)/elemSize {
+		return fmt.Errorf("%s: buffer too short", t)
+	}
+
+	if elemSize == 1 {
+		data := buf[:n]
+
+		if isByteContainer(dst.Type()) {
+			switch dst.Kind() {
+			case reflect.Array:
+				if dst.Len() != n {
+					return fmt.Errorf("%s: can't decode into %s", t, dst.Type())
+				}
+				reflect.Copy(dst, reflect.ValueOf(data))
+			case reflect.Slice:
+				dst.SetBytes(append([]byte(nil), data...))
+			}
+			return nil
+		}
+
+		if isChar(t.Type) && (dst.Kind() == reflect.String || dst.Type() == emptyInterface) {
+			if i := strings.IndexByte(string(data), 0); i >= 0 {
+				data = data[:i]
+			}
+			dst.Set(reflect.ValueOf(string(data)).Convert(dst.Type()))
+			return nil
+		}
+	}
+
+	var elems reflect.Value
+	switch {
+	case dst.Type() == emptyInterface:
+		elems = reflect.MakeSlice(reflect.TypeOf([]interface{}(nil)), n, n)
+	case dst.Kind() == reflect.Slice:
+		elems = reflect.MakeSlice(dst.Type(), n, n)
+	case dst.Kind() == reflect.Array && dst.Len() == n:
+		elems = dst
+	default:
+		return fmt.Errorf("%s: can't decode into %s", t, dst.Type())
+	}
+
+	for i := 0; i < n; i++ {
+		if err := d.decode(t.Type, buf[i*elemSize:], elems.Index(i), depth+1); err != nil {
+			return fmt.Errorf("index %d: %w", i, err)
+		}
+	}
+
+	if dst.Kind() != reflect.Array {
+		dst.Set(elems)
+	}
+	return nil
+}
+
+func (d *decoder) decodeComposite(t composite, buf []byte, dst reflect.Value, depth int) error {
+	size, err := Sizeof(t.(Type))
+	if err != nil {
+		return fmt.Errorf("%s: %w", t, err)
+	}
+	if len(buf) < size {
+		return fmt.Errorf("%s: buffer too short", t)
+	}
+
+	switch {
+	case dst.Type() == emptyInterface:
+		fields := make(map[string]interface{})
+		if err := d.decodeMembers(t, buf, reflect.ValueOf(fields), depth); err != nil {
+			return err
+		}
+		dst.Set(reflect.ValueOf(fields))
+		return nil
+
+	case dst.Kind() == reflect.Map && dst.Type().Key().Kind() == reflect.String && dst.Type().Elem() == emptyInterface:
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMap(dst.Type()))
+		}
+		return d.decodeMembers(t, buf, dst, depth)
+
+	case dst.Kind() == reflect.Struct:
+		return d.decodeMembers(t, buf, dst, depth)
+
+	default:
+		return fmt.Errorf("%s: can't decode into %s", t, dst.Type())
+	}
+}
+
+// decodeMembers decodes the members of t into either a map or a struct.
+func (d *decoder) decodeMembers(t composite, buf []byte, dst reflect.Value, depth int) error {
+	if depth > maxTypeDepth {
+		return errors.New("exceeded type depth")
+	}
+
+	for _, m := range t.members() {
+		if anon, ok := skipQualifierAndTypedef(m.Type).(composite); ok && m.Name == "" {
+			if m.Offset%8 != 0 {
+				return fmt.Errorf("anonymous member at bit offset %d is not byte aligned", m.Offset)
+			}
+			if err := d.decodeMembers(anon, buf[m.Offset/8:], dst, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var field reflect.Value
+		if dst.Kind() == reflect.Map {
+			field = reflect.New(emptyInterface).Elem()
+		} else if field = structField(dst, string(m.Name)); !field.IsValid() {
+			continue
+		}
+
+		if err := d.decodeMember(m, buf, field, depth); err != nil {
+			return fmt.Errorf("member %s: %w", m.Name, err)
+		}
+
+		if dst.Kind() == reflect.Map {
+			dst.SetMapIndex(reflect.ValueOf(string(m.Name)), field)
+		}
+	}
+
+	return nil
+}
+
+func (d *decoder) decodeMember(m Member, buf []byte, dst reflect.Value, depth int) error {
+	if m.BitfieldSize == 0 {
+		if m.Offset%8 != 0 {
+			return fmt.Errorf("bit offset %d is not byte aligned", m.Offset)
+		}
+		return d.decode(m.Type, buf[m.Offset/8:], dst, depth+1)
+	}
+
+	raw, err := d.readBits(buf, m.Offset, m.BitfieldSize)
+	if err != nil {
+		return err
+	}
+
+	switch t := skipQualifierAndTypedef(m.Type).(type) {
+	case *Int:
+		return setInt(t, raw, m.BitfieldSize, dst)
+	case *Enum:
+		return setEnum(t, signExtend(raw, m.BitfieldSize), dst)
+	default:
+		return fmt.Errorf("can't decode bitfield of type %s", m.Type)
+	}
+}
+
+// structField finds the field of a struct which a member is decoded into.
+//
+// Returns an invalid Value if there is no such field.
+func structField(dst reflect.Value, name string) reflect.Value {
+	typ := dst.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			// Unexported field.
+			continue
+		}
+
+		tag := field.Tag.Get("btf")
+		if tag == "-" {
+			continue
+		}
+
+		if tag == name || (tag == "" && strings.EqualFold(field.Name, name)) {
+			return dst.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+func (d *decoder) readUint(buf []byte, size int) (uint64, error) {
+	if len(buf) < size {
+		return 0, errors.New("buffer too short")
+	}
+
+	switch size {
+	case 1:
+		return uint64(buf[0]), nil
+	case 2:
+		return uint64(d.bo.Uint16(buf)), nil
+	case 4:
+		return uint64(d.bo.Uint32(buf)), nil
+	case 8:
+		return d.bo.Uint64(buf), nil
+	default:
+		return 0, fmt.Errorf("unsupported size %d", size)
+	}
+}
+
+// readBits reads an integer of n bits starting at bit offset off.
+func (d *decoder) readBits(buf []byte, off, n uint32) (uint64, error) {
+	first := off / 8
+	last := (off + n - 1) / 8
+	if n > 64 || last-first >= 8 {
+		return 0, fmt.Errorf("bitfield at offset %d with %d bits spans more than 8 bytes", off, n)
+	}
+	if int(last) >= len(buf) {
+		return 0, errors.New("buffer too short")
+	}
+
+	var raw uint64
+	shift := off % 8
+	if internal.IsLittleEndian(d.bo) {
+		for i := last; ; i-- {
+			raw = raw<<8 | uint64(buf[i])
+			if i == first {
+				break
+			}
+		}
+	} else {
+		for i := first; i <= last; i++ {
+			raw = raw<<8 | uint64(buf[i])
+		}
+		// Bits are numbered starting from the most significant bit.
+		shift = (last-first+1)*8 - shift - n
+	}
+
+	raw >>= shift
+	if n < 64 {
+		raw &= 1<<n - 1
+	}
+	return raw, nil
+}
+
+func isChar(typ Type) bool {
+	i, ok := skipQualifierAndTypedef(typ).(*Int)
+	return ok && i.Size == 1 && (i.Encoding&Char != 0 || i.Name == "char")
+}
+
+func isByteContainer(typ reflect.Type) bool {
+	return (typ.Kind() == reflect.Array || typ.Kind() == reflect.Slice) && typ.Elem().Kind() == reflect.Uint8
+}
+
+func signExtend(raw uint64, bits uint32) int64 {
+	shift := 64 - bits
+	return int64(raw<<shift) >> shift
+}
+
+func setInt(t *Int, raw uint64, bits uint32, dst reflect.Value) error {
+	switch {
+	case t.Encoding&Bool != 0:
+		switch {
+		case dst.Kind() == reflect.Bool:
+			dst.SetBool(raw != 0)
+		case dst.Type() == emptyInterface:
+			dst.Set(reflect.ValueOf(raw != 0))
+		default:
+			return fmt.Errorf("%s: can't decode into %s", t, dst.Type())
+		}
+		return nil
+
+	case t.Encoding&Signed != 0:
+		return setSigned(signExtend(raw, bits), dst)
+
+	default:
+		return setUnsigned(raw, dst)
+	}
+}
+
+func setEnum(t *Enum, value int64, dst reflect.Value) error {
+	if dst.Kind() != reflect.String && dst.Type() != emptyInterface {
+		return setSigned(value, dst)
+	}
+
+	for _, ev := range t.Values {
+		if int64(ev.Value) == value {
+			dst.Set(reflect.ValueOf(string(ev.Name)).Convert(dst.Type()))
+			return nil
+		}
+	}
+
+	if dst.Kind() == reflect.String {
+		return fmt.Errorf("%s: unknown value %d", t, value)
+	}
+
+	dst.Set(reflect.ValueOf(value))
+	return nil
+}
+
+func setSigned(value int64, dst reflect.Value) error {
+	switch dst.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if dst.OverflowInt(value) {
+			return fmt.Errorf("value %d overflows %s", value, dst.Type())
+		}
+		dst.SetInt(value)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if value < 0 || dst.OverflowUint(uint64(value)) {
+			return fmt.Errorf("value %d overflows %s", value, dst.Type())
+		}
+		dst.SetUint(uint64(value))
+
+	default:
+		if dst.Type() != emptyInterface {
+			return fmt.Errorf("can't decode integer into %s", dst.Type())
+		}
+		dst.Set(reflect.ValueOf(value))
+	}
+	return nil
+}
+
+func setUnsigned(value uint64, dst reflect.Value) error {
+	switch dst.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if int64(value) < 0 || dst.OverflowInt(int64(value)) {
+			return fmt.Errorf("value %d overflows %s", value, dst.Type())
+		}
+		dst.SetInt(int64(value))
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if dst.OverflowUint(value) {
+			return fmt.Errorf("value %d overflows %s", value, dst.Type())
+		}
+		dst.SetUint(value)
+
+	default:
+		if dst.Type() != emptyInterface {
+			return fmt.Errorf("can't decode integer into %s", dst.Type())
+		}
+		dst.Set(reflect.ValueOf(value))
+	}
+	return nil
+}
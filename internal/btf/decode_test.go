@@ -0,0 +1,170 @@
+package btf
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDecode(t *testing.T) {
+	u32 := &Int{Name: "u32", Size: 4, Bits: 32}
+	s16 := &Int{Name: "s16", Size: 2, Encoding: Signed, Bits: 16}
+	u64 := &Int{Name: "u64", Size: 8, Bits: 64}
+	char := &Int{Name: "char", Size: 1, Encoding: Signed, Bits: 8}
+	state := &Enum{Name: "state", Values: []EnumValue{{"RUNNING", 0}, {"SLEEPING", 1}}}
+
+	event := &Struct{Name: "event", Size: 40, Members: []Member{
+		{Name: "pid", Type: &Typedef{Name: "pid_t", Type: u32}, Offset: 0},
+		{Name: "state", Type: &Const{Type: state}, Offset: 32},
+		{Name: "comm", Type: &Array{Type: char, Nelems: 8}, Offset: 64},
+		{Name: "flag", Type: u32, Offset: 128, BitfieldSize: 1},
+		{Name: "val", Type: &Int{Name: "int", Size: 4, Encoding: Signed, Bits: 32}, Offset: 129, BitfieldSize: 3},
+		{Name: "", Type: &Union{Size: 8, Members: []Member{
+			{Name: "addr", Type: &Pointer{Target: (*Void)(nil)}},
+		}}, Offset: 192},
+		{Name: "arr", Type: &Array{Type: s16, Nelems: 2}, Offset: 256},
+		{Name: "pad", Type: u64, Offset: 288, BitfieldSize: 32},
+	}}
+
+	buf := make([]byte, 40)
+	binary.LittleEndian.PutUint32(buf[0:], 42)
+	binary.LittleEndian.PutUint32(buf[4:], 1)
+	copy(buf[8:], "bash\x00xyz")
+	// flag = 1, val = -2
+	buf[16] = 0x0d
+	binary.LittleEndian.PutUint64(buf[24:], 0xdeadbeef)
+	binary.LittleEndian.PutUint16(buf[32:], 0xffff)
+	binary.LittleEndian.PutUint16(buf[34:], 7)
+
+	d := decoder{binary.LittleEndian}
+
+	t.Run("interface", func(t *testing.T) {
+		var have interface{}
+		if err := d.decode(event, buf, reflect.ValueOf(&have).Elem(), 0); err != nil {
+			t.Fatal("Can't decode:", err)
+		}
+
+		want := map[string]interface{}{
+			"pid":   uint64(42),
+			"state": "SLEEPING",
+			"comm":  "bash",
+			"flag":  uint64(1),
+			"val":   int64(-2),
+			"addr":  uint64(0xdeadbeef),
+			"arr":   []interface{}{int64(-1), int64(7)},
+			"pad":   uint64(0),
+		}
+		if diff := cmp.Diff(want, have); diff != "" {
+			t.Errorf("Decoded value doesn't match (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("struct", func(t *testing.T) {
+		type state string
+		var have struct {
+			PID     uint32
+			State   state
+			Name    string `btf:"comm"`
+			Comm    [8]byte
+			Flag    bool `btf:"-"`
+			Val     int8
+			Address uintptr `btf:"addr"`
+			Arr     []int
+			unused  int
+		}
+
+		if err := d.decode(event, buf, reflect.ValueOf(&have).Elem(), 0); err != nil {
+			t.Fatal("Can't decode:", err)
+		}
+
+		if have.PID != 42 {
+			t.Error("Expected PID 42, got", have.PID)
+		}
+		if have.State != "SLEEPING" {
+			t.Error("Expected state SLEEPING, got", have.State)
+		}
+		if have.Name != "bash" {
+			t.Errorf("Expected comm bash, got %q", have.Name)
+		}
+		if have.Comm != [8]byte{} {
+			t.Error("Field shadowed by a tag should not be decoded")
+		}
+		if have.Flag {
+			t.Error("Field with tag - should not be decoded")
+		}
+		if have.Val != -2 {
+			t.Error("Expected val -2, got", have.Val)
+		}
+		if have.Address != 0xdeadbeef {
+			t.Errorf("Expected addr 0xdeadbeef, got %#x", have.Address)
+		}
+		if diff := cmp.Diff([]int{-1, 7}, have.Arr); diff != "" {
+			t.Errorf("Arr doesn't match (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		var have struct{ State int64 }
+		if err := d.decode(event, buf, reflect.ValueOf(&have).Elem(), 0); err != nil {
+			t.Fatal("Can't decode enum into integer:", err)
+		}
+		if have.State != 1 {
+			t.Error("Expected state 1, got", have.State)
+		}
+
+		var overflow struct{ Arr []uint16 }
+		if err := d.decode(event, buf, reflect.ValueOf(&overflow).Elem(), 0); err == nil {
+			t.Error("Decoding a negative value into an unsigned field doesn't return an error")
+		}
+
+		var wrong struct{ Pid string }
+		if err := d.decode(event, buf, reflect.ValueOf(&wrong).Elem(), 0); err == nil {
+			t.Error("Decoding an integer into a string doesn't return an error")
+		}
+
+		var v interface{}
+		if err := d.decode(event, buf[:39], reflect.ValueOf(&v).Elem(), 0); err == nil {
+			t.Error("Decoding a short buffer doesn't return an error")
+		}
+	})
+
+	if err := Decode(event, buf, nil); err == nil {
+		t.Error("Decode accepts a nil destination")
+	}
+}
+
+func TestDecoderReadBits(t *testing.T) {
+	testcases := []struct {
+		bo       binary.ByteOrder
+		buf      []byte
+		off, n   uint32
+		expected uint64
+	}{
+		{binary.LittleEndian, []byte{0x0d}, 0, 1, 1},
+		{binary.LittleEndian, []byte{0x0d}, 1, 3, 6},
+		{binary.LittleEndian, []byte{0x00, 0xf0, 0x0f}, 12, 8, 0xff},
+		{binary.BigEndian, []byte{0x80}, 0, 1, 1},
+		{binary.BigEndian, []byte{0x70}, 1, 3, 7},
+		{binary.BigEndian, []byte{0x00, 0x0f, 0xf0}, 12, 8, 0xff},
+		{binary.LittleEndian, []byte{1, 2, 3, 4, 5, 6, 7, 8}, 0, 64, 0x0807060504030201},
+	}
+
+	for _, tc := range testcases {
+		d := decoder{tc.bo}
+		have, err := d.readBits(tc.buf, tc.off, tc.n)
+		if err != nil {
+			t.Errorf("%s offset %d bits %d: %s", tc.bo, tc.off, tc.n, err)
+			continue
+		}
+		if have != tc.expected {
+			t.Errorf("%s offset %d bits %d: expected %#x, got %#x", tc.bo, tc.off, tc.n, tc.expected, have)
+		}
+	}
+
+	d := decoder{binary.LittleEndian}
+	if _, err := d.readBits(make([]byte, 9), 4, 64); err == nil {
+		t.Error("Reading a bitfield spanning 9 bytes doesn't return an error")
+	}
+}
@@ -0,0 +1,315 @@
+package btf
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/cilium/ebpf/internal"
+)
+
+// EncodeValue is the inverse of decoding into an empty interface.
+//
+// It encodes value into the memory layout described by typ using the
+// native endianness. value is usually produced by encoding/json: structs
+// and unions are described by a map[string]interface{} keyed by member
+// name, arrays by a []interface{}. Missing members are zeroed.
+//
+// Integers may be given as json.Number, float64, any Go integer type or
+// as a string, which is parsed using strconv with a base prefix. Enums
+// also accept the name of a value, bools a Go bool and char arrays a
+// string.
+func EncodeValue(typ Type, value interface{}) ([]byte, error) {
+	size, err := Sizeof(typ)
+	if err != nil {
+		return nil, err
+	}
+
+	e := encoder{internal.NativeEndian}
+	buf := make([]byte, size)
+	if err := e.encode(typ, buf, value, 0); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+type encoder struct {
+	bo binary.ByteOrder
+}
+
+func (e *encoder) encode(typ Type, buf []byte, value interface{}, depth int) error {
+	if depth > maxTypeDepth {
+		return errors.New("exceeded type depth")
+	}
+
+	typ = skipQualifierAndTypedef(typ)
+	switch t := typ.(type) {
+	case *Int:
+		raw, err := intValue(t, value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", t, err)
+		}
+		return e.writeUint(buf, int(t.Size), raw)
+
+	case *Enum:
+		raw, err := enumValue(t, value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", t, err)
+		}
+		return e.writeUint(buf, 4, raw)
+
+	case *Pointer:
+		raw, err := uintValue(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", t, err)
+		}
+		return e.writeUint(buf, 8, raw)
+
+	case *Array:
+		return e.encodeArray(t, buf, value, depth)
+
+	case composite:
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: can't encode %T", t, value)
+		}
+		return e.encodeMembers(t, buf, fields, depth)
+
+	default:
+		return fmt.Errorf("can't encode %s", typ)
+	}
+}
+
+func (e *encoder) encodeArray(t *Array, buf []byte, value interface{}, depth int) error {
+	elemSize, err := Sizeof(t.Type)
+	if err != nil {
+		return fmt.Errorf("%s: %w", t, err)
+	}
+
+	n := int(t.Nelems)
+	if str, ok := value.(string); ok && isChar(t.Type) {
+		if len(str) > n {
+			return fmt.Errorf("%s: string %q is too long", t, str)
+		}
+		copy(buf, str)
+		return nil
+	}
+
+	elems, ok := value.([]interface{})
+	if !ok {
+		return fmt.Errorf("%s: can't encode %T", t, value)
+	}
+	if len(elems) > n {
+		return fmt.Errorf("%s: %d elements don't fit", t, len(elems))
+	}
+
+	for i, elem := range elems {
+		if err := e.encode(t.Type, buf[i*elemSize:], elem, depth+1); err != nil {
+			return fmt.Errorf("index %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (e *encoder) encodeMembers(t composite, buf []byte, fields map[string]interface{}, depth int) error {
+	if depth > maxTypeDepth {
+		return errors.New("exceeded type depth")
+	}
+
+	for _, m := range t.members() {
+		if anon, ok := skipQualifierAndTypedef(m.Type).(composite); ok && m.Name == "" {
+			if m.Offset%8 != 0 {
+				return fmt.Errorf("anonymous member at bit offset %d is not byte aligned", m.Offset)
+			}
+			if err := e.encodeMembers(anon, buf[m.Offset/8:], fields, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, ok := fields[string(m.Name)]
+		if !ok {
+			continue
+		}
+
+		if err := e.encodeMember(m, buf, value, depth); err != nil {
+			return fmt.Errorf("member %s: %w", m.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (e *encoder) encodeMember(m Member, buf []byte, value interface{}, depth int) error {
+	if m.BitfieldSize == 0 {
+		if m.Offset%8 != 0 {
+			return fmt.Errorf("bit offset %d is not byte aligned", m.Offset)
+		}
+		return e.encode(m.Type, buf[m.Offset/8:], value, depth+1)
+	}
+
+	var (
+		raw uint64
+		err error
+	)
+	switch t := skipQualifierAndTypedef(m.Type).(type) {
+	case *Int:
+		raw, err = intValue(t, value)
+	case *Enum:
+		raw, err = enumValue(t, value)
+	default:
+		return fmt.Errorf("can't encode bitfield of type %s", m.Type)
+	}
+	if err != nil {
+		return err
+	}
+
+	return e.writeBits(buf, m.Offset, m.BitfieldSize, raw)
+}
+
+func (e *encoder) writeUint(buf []byte, size int, value uint64) error {
+	if len(buf) < size {
+		return errors.New("buffer too short")
+	}
+
+	if size < 8 && value>>(uint(size)*8) != 0 && int64(value)>>(uint(size)*8-1) != -1 {
+		return fmt.Errorf("value %d doesn't fit into %d bytes", int64(value), size)
+	}
+
+	switch size {
+	case 1:
+		buf[0] = uint8(value)
+	case 2:
+		e.bo.PutUint16(buf, uint16(value))
+	case 4:
+		e.bo.PutUint32(buf, uint32(value))
+	case 8:
+		e.bo.PutUint64(buf, value)
+	default:
+		return fmt.Errorf("unsupported size %d", size)
+	}
+	return nil
+}
+
+// writeBits is the inverse of decoder.readBits.
+func (e *encoder) writeBits(buf []byte, off, n uint32, value uint64) error {
+	first := off / 8
+	last := (off + n - 1) / 8
+	if n > 64 || last-first >= 8 {
+		return fmt.Errorf("bitfield at offset %d with %d bits spans more than 8 bytes", off, n)
+	}
+	if int(last) >= len(buf) {
+		return errors.New("buffer too short")
+	}
+
+	mask := uint64(math.MaxUint64)
+	if n < 64 {
+		mask = 1<<n - 1
+	}
+	value &= mask
+
+	shift := off % 8
+	if !internal.IsLittleEndian(e.bo) {
+		shift = (last-first+1)*8 - shift - n
+	}
+	mask <<= shift
+	value <<= shift
+
+	if internal.IsLittleEndian(e.bo) {
+		for i := first; i <= last; i++ {
+			buf[i] = buf[i]&^uint8(mask) | uint8(value)
+			mask >>= 8
+			value >>= 8
+		}
+	} else {
+		for i := last; ; i-- {
+			buf[i] = buf[i]&^uint8(mask) | uint8(value)
+			mask >>= 8
+			value >>= 8
+			if i == first {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func intValue(t *Int, value interface{}) (uint64, error) {
+	if t.Encoding&Bool != 0 {
+		if b, ok := value.(bool); ok {
+			if b {
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+
+	return uintValue(value)
+}
+
+func enumValue(t *Enum, value interface{}) (uint64, error) {
+	if name, ok := value.(string); ok {
+		for _, ev := range t.Values {
+			if string(ev.Name) == name {
+				return uint64(int64(ev.Value)), nil
+			}
+		}
+	}
+
+	return uintValue(value)
+}
+
+// uintValue converts an integer into its two's complement representation.
+func uintValue(value interface{}) (uint64, error) {
+	switch v := value.(type) {
+	case json.Number:
+		return parseInt(string(v))
+	case string:
+		return parseInt(v)
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, fmt.Errorf("%v is not an integer", v)
+		}
+		if v < 0 {
+			return uint64(int64(v)), nil
+		}
+		return uint64(v), nil
+	case int:
+		return uint64(v), nil
+	case int8:
+		return uint64(v), nil
+	case int16:
+		return uint64(v), nil
+	case int32:
+		return uint64(v), nil
+	case int64:
+		return uint64(v), nil
+	case uint:
+		return uint64(v), nil
+	case uint8:
+		return uint64(v), nil
+	case uint16:
+		return uint64(v), nil
+	case uint32:
+		return uint64(v), nil
+	case uint64:
+		return v, nil
+	default:
+		return 0, fmt.Errorf("can't encode %T as an integer", value)
+	}
+}
+
+func parseInt(s string) (uint64, error) {
+	if u, err := strconv.ParseUint(s, 0, 64); err == nil {
+		return u, nil
+	}
+
+	i, err := strconv.ParseInt(s, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer %q", s)
+	}
+	return uint64(i), nil
+}
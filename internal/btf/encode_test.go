@@ -0,0 +1,112 @@
+package btf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+)
+
+func TestEncodeValue(t *testing.T) {
+	u32 := &Int{Name: "u32", Size: 4, Bits: 32}
+	s16 := &Int{Name: "s16", Size: 2, Encoding: Signed, Bits: 16}
+	char := &Int{Name: "char", Size: 1, Encoding: Signed, Bits: 8}
+	state := &Enum{Name: "state", Values: []EnumValue{{"RUNNING", 0}, {"SLEEPING", 1}}}
+
+	event := &Struct{Name: "event", Size: 24, Members: []Member{
+		{Name: "pid", Type: &Typedef{Name: "pid_t", Type: u32}, Offset: 0},
+		{Name: "state", Type: &Const{Type: state}, Offset: 32},
+		{Name: "comm", Type: &Array{Type: char, Nelems: 4}, Offset: 64},
+		{Name: "flag", Type: u32, Offset: 96, BitfieldSize: 1},
+		{Name: "val", Type: &Int{Name: "int", Size: 4, Encoding: Signed, Bits: 32}, Offset: 97, BitfieldSize: 3},
+		{Name: "", Type: &Union{Size: 4, Members: []Member{
+			{Name: "addr", Type: u32},
+		}}, Offset: 128},
+		{Name: "arr", Type: &Array{Type: s16, Nelems: 2}, Offset: 160},
+	}}
+
+	var value interface{}
+	dec := json.NewDecoder(bytes.NewReader([]byte(`{
+		"pid": 42,
+		"state": "SLEEPING",
+		"comm": "sh",
+		"flag": 1,
+		"val": -2,
+		"addr": "0xdeadbeef",
+		"arr": [-1, 7]
+	}`)))
+	dec.UseNumber()
+	if err := dec.Decode(&value); err != nil {
+		t.Fatal(err)
+	}
+
+	e := encoder{binary.LittleEndian}
+	have := make([]byte, 24)
+	if err := e.encode(event, have, value, 0); err != nil {
+		t.Fatal("Can't encode:", err)
+	}
+
+	want := make([]byte, 24)
+	binary.LittleEndian.PutUint32(want[0:], 42)
+	binary.LittleEndian.PutUint32(want[4:], 1)
+	copy(want[8:], "sh")
+	// flag = 1, val = -2
+	want[12] = 0x0d
+	binary.LittleEndian.PutUint32(want[16:], 0xdeadbeef)
+	binary.LittleEndian.PutUint16(want[20:], 0xffff)
+	binary.LittleEndian.PutUint16(want[22:], 7)
+
+	if !bytes.Equal(have, want) {
+		t.Errorf("Expected\n%v\ngot\n%v", want, have)
+	}
+
+	for _, invalid := range []interface{}{
+		map[string]interface{}{"pid": "foo"},
+		map[string]interface{}{"comm": "too long"},
+		map[string]interface{}{"arr": []interface{}{1, 2, 3}},
+		map[string]interface{}{"arr": []interface{}{1 << 16}},
+		map[string]interface{}{"pid": 1.5},
+		[]interface{}{},
+	} {
+		if err := e.encode(event, make([]byte, 24), invalid, 0); err == nil {
+			t.Errorf("Encoding %v doesn't return an error", invalid)
+		}
+	}
+}
+
+func TestEncoderWriteBits(t *testing.T) {
+	for _, bo := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		for _, tc := range []struct {
+			off, n uint32
+			value  uint64
+		}{
+			{0, 1, 1},
+			{1, 3, 6},
+			{12, 8, 0xff},
+			{3, 17, 0x1abcd},
+			{0, 64, 0x0807060504030201},
+		} {
+			buf := bytes.Repeat([]byte{0xaa}, 9)
+			e := encoder{bo}
+			if err := e.writeBits(buf, tc.off, tc.n, tc.value); err != nil {
+				t.Fatalf("%s offset %d bits %d: %s", bo, tc.off, tc.n, err)
+			}
+
+			d := decoder{bo}
+			have, err := d.readBits(buf, tc.off, tc.n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have != tc.value {
+				t.Errorf("%s offset %d bits %d: expected %#x, got %#x", bo, tc.off, tc.n, tc.value, have)
+			}
+
+			// Bytes outside the bitfield must not change.
+			for i := range buf {
+				if (uint32(i) < tc.off/8 || uint32(i) > (tc.off+tc.n-1)/8) && buf[i] != 0xaa {
+					t.Errorf("%s offset %d bits %d: byte %d is modified", bo, tc.off, tc.n, i)
+				}
+			}
+		}
+	}
+}
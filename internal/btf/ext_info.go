@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"strings"
 
 	"github.com/cilium/ebpf/asm"
 	"github.com/cilium/ebpf/internal"
@@ -154,6 +155,51 @@ func (ei extInfo) MarshalBinary() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// Line is the location of an instruction in the source code.
+type Line struct {
+	// Offset of the instruction in raw BPF instructions.
+	InsnOff    uint64
+	FileName   string
+	Line       string
+	LineNumber uint32
+	Column     uint32
+}
+
+func (l Line) String() string {
+	return fmt.Sprintf("%s:%d (%s)", l.FileName, l.LineNumber, strings.TrimSpace(l.Line))
+}
+
+// lines decodes the records of a line info (struct bpf_line_info).
+func (ei extInfo) lines(bo binary.ByteOrder, strings stringTable) ([]Line, error) {
+	lines := make([]Line, 0, len(ei.records))
+	for _, info := range ei.records {
+		if len(info.Opaque) < 12 {
+			return nil, errors.New("line info record is too short")
+		}
+
+		fileName, err := strings.Lookup(bo.Uint32(info.Opaque))
+		if err != nil {
+			return nil, fmt.Errorf("file name: %w", err)
+		}
+
+		line, err := strings.Lookup(bo.Uint32(info.Opaque[4:]))
+		if err != nil {
+			return nil, fmt.Errorf("line: %w", err)
+		}
+
+		lineCol := bo.Uint32(info.Opaque[8:])
+		lines = append(lines, Line{
+			InsnOff:    info.InsnOff / asm.InstructionSize,
+			FileName:   fileName,
+			Line:       line,
+			LineNumber: lineCol >> 10,
+			Column:     lineCol & 0x3ff,
+		})
+	}
+
+	return lines, nil
+}
+
 func parseExtInfo(r io.Reader, bo binary.ByteOrder, strings stringTable) (map[string]extInfo, error) {
 	const maxRecordSize = 256
 
@@ -550,6 +550,72 @@ func Sizeof(typ Type) (int, error) {
 	return 0, errors.New("exceeded type depth")
 }
 
+// Offsetof returns the offset of a member of a Struct or Union in bytes.
+//
+// Nested members are separated by dots, for example "sk.__sk_common.skc_family".
+// Members of anonymous structs and unions can be found without naming them.
+//
+// Returns an error wrapping ErrNotFound if a member doesn't exist, and an
+// error if the member is a bitfield which doesn't start on a byte boundary.
+func Offsetof(typ Type, member string) (int, error) {
+	var offset uint64
+	for _, name := range strings.Split(member, ".") {
+		comp, ok := skipQualifierAndTypedef(typ).(composite)
+		if !ok {
+			return 0, fmt.Errorf("member %s: %s is not a struct or union", name, typ)
+		}
+
+		m, bits, err := findMember(comp, name, 0)
+		if err != nil {
+			return 0, fmt.Errorf("member %s: %w", name, err)
+		}
+
+		offset += uint64(bits)
+		typ = m.Type
+	}
+
+	if offset%8 != 0 {
+		return 0, fmt.Errorf("member %s: bit offset %d is not byte aligned", member, offset)
+	}
+
+	return int(offset / 8), nil
+}
+
+// findMember returns a member and its offset in bits, descending into
+// anonymous members.
+func findMember(comp composite, name string, depth int) (Member, uint32, error) {
+	if depth > maxTypeDepth {
+		return Member{}, 0, errors.New("exceeded type depth")
+	}
+
+	for _, m := range comp.members() {
+		if string(m.Name) == name {
+			return m, m.Offset, nil
+		}
+
+		if m.Name != "" {
+			continue
+		}
+
+		anon, ok := skipQualifierAndTypedef(m.Type).(composite)
+		if !ok {
+			continue
+		}
+
+		found, offset, err := findMember(anon, name, depth+1)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return Member{}, 0, err
+		}
+
+		return found, m.Offset + offset, nil
+	}
+
+	return Member{}, 0, ErrNotFound
+}
+
 // copy a Type recursively.
 //
 // typ may form a cycle.
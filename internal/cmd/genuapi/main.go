@@ -0,0 +1,315 @@
+// Program genuapi adds constants defined in the kernel UAPI to Go source.
+//
+// It parses enums from linux/bpf.h and appends missing values to the
+// matching const block in a Go file. Existing constants and their
+// documentation are left untouched, so names can be adjusted by hand
+// after generating.
+//
+// Flags like BPF_F_RDONLY are taken from golang.org/x/sys/unix via
+// internal/unix instead.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const helpText = `Usage: %[1]s [options] <Go file> <type>...
+
+Appends constants missing from the const block declaring type in Go file.
+Supported types are:
+
+%[2]s
+Options:
+
+`
+
+// enum describes how a C enum maps to a Go type.
+type enum struct {
+	// Name of the C enum, or of the macro in case of helpers.
+	cName string
+	// Prefix of the values in C, which is removed.
+	prefix string
+	// Prefix of the values in Go.
+	goPrefix string
+	// Spell common abbreviations like SKB in upper case.
+	acronyms bool
+}
+
+var enums = map[string]enum{
+	"MapType":     {"bpf_map_type", "BPF_MAP_TYPE_", "", true},
+	"ProgramType": {"bpf_prog_type", "BPF_PROG_TYPE_", "", true},
+	"AttachType":  {"bpf_attach_type", "BPF_", "Attach", true},
+	"BuiltinFunc": {"__BPF_FUNC_MAPPER", "", "Fn", false},
+}
+
+var acronyms = map[string]string{
+	"CGROUP": "CGroup",
+	"CPU":    "CPU",
+	"LRU":    "LRU",
+	"LSM":    "LSM",
+	"LWT":    "LWT",
+	"SKB":    "SKB",
+	"TCP":    "TCP",
+	"TCX":    "TCX",
+	"UDP":    "UDP",
+	"XDP":    "XDP",
+}
+
+// Names which don't follow from the rules above.
+var overrides = map[string]string{
+	"BPF_MAP_TYPE_STRUCT_OPS":   "StructOpsMap",
+	"BPF_MAP_TYPE_RINGBUF":      "RingBuf",
+	"BPF_MAP_TYPE_USER_RINGBUF": "UserRingBuf",
+	"BPF_MAP_TYPE_CGRP_STORAGE": "CgroupStorage",
+}
+
+func run(stdout io.Writer, args []string) error {
+	var (
+		fs         = flag.NewFlagSet("genuapi", flag.ContinueOnError)
+		flagHeader = fs.String("header", "/usr/include/linux/bpf.h", "`path` to linux/bpf.h")
+	)
+
+	fs.SetOutput(stdout)
+	fs.Usage = func() {
+		var types strings.Builder
+		for name, e := range enums {
+			fmt.Fprintf(&types, "  %s (%s)\n", name, e.cName)
+		}
+		fmt.Fprintf(fs.Output(), helpText, fs.Name(), types.String())
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); errors.Is(err, flag.ErrHelp) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return errors.New("expected a Go file and at least one type")
+	}
+
+	header, err := ioutil.ReadFile(*flagHeader)
+	if err != nil {
+		return err
+	}
+	header = stripComments(header)
+
+	file := fs.Arg(0)
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	for _, typ := range fs.Args()[1:] {
+		e, ok := enums[typ]
+		if !ok {
+			return fmt.Errorf("unsupported type %s", typ)
+		}
+
+		var values []string
+		if e.cName == "__BPF_FUNC_MAPPER" {
+			values, err = parseFuncMapper(header)
+		} else {
+			values, err = parseEnum(header, e.cName)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", typ, err)
+		}
+
+		names := make([]string, 0, len(values))
+		for _, value := range values {
+			names = append(names, e.goName(value))
+		}
+
+		src, err = appendConstants(src, typ, names)
+		if err != nil {
+			return fmt.Errorf("%s: %w", typ, err)
+		}
+	}
+
+	return ioutil.WriteFile(file, src, 0644)
+}
+
+var commentRe = regexp.MustCompile(`(?s)/\*.*?\*/|//[^\n]*`)
+
+func stripComments(src []byte) []byte {
+	return commentRe.ReplaceAll(src, nil)
+}
+
+// parseEnum returns the values of a C enum ordered by their numeric value.
+//
+// Aliases and values starting with __ are skipped. The enum must be
+// contiguous and start at zero.
+func parseEnum(header []byte, name string) ([]string, error) {
+	re := regexp.MustCompile(`(?s)enum\s+` + regexp.QuoteMeta(name) + `\s*\{(.*?)\}`)
+	match := re.FindSubmatch(header)
+	if match == nil {
+		return nil, fmt.Errorf("enum %s not found", name)
+	}
+
+	var values []string
+	for _, field := range strings.Split(string(match[1]), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" || strings.HasPrefix(field, "__") {
+			continue
+		}
+
+		parts := strings.SplitN(field, "=", 2)
+		ident := strings.TrimSpace(parts[0])
+		if len(parts) == 2 {
+			value := strings.TrimSpace(parts[1])
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				// An alias of an existing value.
+				continue
+			}
+			if n != len(values) {
+				return nil, fmt.Errorf("%s has value %d, expected %d", ident, n, len(values))
+			}
+		}
+
+		values = append(values, ident)
+	}
+
+	return values, nil
+}
+
+var funcRe = regexp.MustCompile(`FN\((\w+)(?:,\s*(\d+))?`)
+
+// parseFuncMapper returns the names of helpers ordered by their ID.
+//
+// Both the old FN(name) and the newer FN(name, id, ...) syntax are supported.
+func parseFuncMapper(header []byte) ([]string, error) {
+	re := regexp.MustCompile(`(?s)#define\s+_*BPF_FUNC_MAPPER\(FN[^)]*\)(.*?[^\\])\n`)
+	match := re.FindSubmatch(header)
+	if match == nil {
+		return nil, errors.New("helper definitions not found")
+	}
+
+	var names []string
+	for _, fn := range funcRe.FindAllSubmatch(match[1], -1) {
+		if len(fn[2]) > 0 {
+			id, err := strconv.Atoi(string(fn[2]))
+			if err != nil {
+				return nil, err
+			}
+			if id != len(names) {
+				return nil, fmt.Errorf("helper %s has id %d, expected %d", fn[1], id, len(names))
+			}
+		}
+		names = append(names, string(fn[1]))
+	}
+
+	if len(names) == 0 {
+		return nil, errors.New("no helpers found")
+	}
+	return names, nil
+}
+
+func (e enum) goName(value string) string {
+	if name, ok := overrides[value]; ok {
+		return name
+	}
+
+	var b strings.Builder
+	b.WriteString(e.goPrefix)
+	for _, part := range strings.Split(strings.TrimPrefix(value, e.prefix), "_") {
+		if part == "" {
+			continue
+		}
+
+		if e.acronyms {
+			if acronym, ok := acronyms[strings.ToUpper(part)]; ok {
+				b.WriteString(acronym)
+				continue
+			}
+		}
+
+		b.WriteString(strings.ToUpper(part[:1]))
+		b.WriteString(strings.ToLower(part[1:]))
+	}
+	return b.String()
+}
+
+// appendConstants adds names to the const block which declares the first
+// constant of typ using iota.
+//
+// names must contain every value of the enum. The existing constants must
+// be a prefix of it, but may be spelled differently.
+func appendConstants(src []byte, typ string, names []string) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	var block *ast.GenDecl
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST || !gen.Lparen.IsValid() || len(gen.Specs) == 0 {
+			continue
+		}
+
+		first := gen.Specs[0].(*ast.ValueSpec)
+		if ident, ok := first.Type.(*ast.Ident); ok && ident.Name == typ && isIota(first.Values) {
+			block = gen
+			break
+		}
+	}
+
+	if block == nil {
+		return nil, fmt.Errorf("no const block starting with %s = iota", typ)
+	}
+
+	existing := 0
+	for _, spec := range block.Specs {
+		vs := spec.(*ast.ValueSpec)
+		if len(vs.Values) > 0 && vs != block.Specs[0] {
+			return nil, fmt.Errorf("constant %s has an explicit value", vs.Names[0])
+		}
+		existing += len(vs.Names)
+	}
+
+	if existing > len(names) {
+		return nil, fmt.Errorf("header defines %d values but there are %d constants, is the header too old?", len(names), existing)
+	}
+
+	var buf bytes.Buffer
+	end := fset.Position(block.Rparen).Offset
+	buf.Write(src[:end])
+	for _, name := range names[existing:] {
+		fmt.Fprintf(&buf, "\t%s\n", name)
+	}
+	buf.Write(src[end:])
+
+	return format.Source(buf.Bytes())
+}
+
+func isIota(values []ast.Expr) bool {
+	if len(values) != 1 {
+		return false
+	}
+	ident, ok := values[0].(*ast.Ident)
+	return ok && ident.Name == "iota"
+}
+
+func main() {
+	if err := run(os.Stdout, os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testHeader = `
+enum bpf_map_type {
+	BPF_MAP_TYPE_UNSPEC,
+	BPF_MAP_TYPE_HASH, /* a comment, with a comma */
+	BPF_MAP_TYPE_CGROUP_STORAGE_DEPRECATED,
+	BPF_MAP_TYPE_CGROUP_STORAGE = BPF_MAP_TYPE_CGROUP_STORAGE_DEPRECATED,
+	BPF_MAP_TYPE_RINGBUF = 3,
+	__MAX_BPF_MAP_TYPE
+};
+
+#define ___BPF_FUNC_MAPPER(FN, ctx...)			\
+	FN(unspec, 0, ##ctx)				\
+	FN(map_lookup_elem, 1, ##ctx)			\
+	FN(get_smp_processor_id, 2, ##ctx)		\
+
+#define __BPF_FUNC_MAPPER_APPLY(name, value, FN) FN(name),
+`
+
+func TestParseEnum(t *testing.T) {
+	values, err := parseEnum(stripComments([]byte(testHeader)), "bpf_map_type")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"BPF_MAP_TYPE_UNSPEC", "BPF_MAP_TYPE_HASH", "BPF_MAP_TYPE_CGROUP_STORAGE_DEPRECATED", "BPF_MAP_TYPE_RINGBUF"}
+	if !reflect.DeepEqual(values, want) {
+		t.Error("Unexpected values:", values)
+	}
+
+	if _, err := parseEnum([]byte("enum foo { A, B = 2 };"), "foo"); err == nil {
+		t.Error("Non-contiguous enum doesn't return an error")
+	}
+}
+
+func TestParseFuncMapper(t *testing.T) {
+	names, err := parseFuncMapper(stripComments([]byte(testHeader)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"unspec", "map_lookup_elem", "get_smp_processor_id"}
+	if !reflect.DeepEqual(names, want) {
+		t.Error("Unexpected names:", names)
+	}
+
+	old := "#define __BPF_FUNC_MAPPER(FN)\t\\\n\tFN(unspec),\t\\\n\tFN(map_lookup_elem),\n"
+	names, err = parseFuncMapper([]byte(old))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, want[:2]) {
+		t.Error("Unexpected names for old syntax:", names)
+	}
+}
+
+func TestGoName(t *testing.T) {
+	for _, test := range []struct {
+		typ, value, name string
+	}{
+		{"MapType", "BPF_MAP_TYPE_PERCPU_CGROUP_STORAGE", "PercpuCGroupStorage"},
+		{"MapType", "BPF_MAP_TYPE_RINGBUF", "RingBuf"},
+		{"AttachType", "BPF_SK_SKB_VERDICT", "AttachSkSKBVerdict"},
+		{"BuiltinFunc", "get_smp_processor_id", "FnGetSmpProcessorId"},
+	} {
+		if name := enums[test.typ].goName(test.value); name != test.name {
+			t.Errorf("%s: expected %s, got %s", test.value, test.name, name)
+		}
+	}
+}
+
+func TestAppendConstants(t *testing.T) {
+	src := `package foo
+
+type Foo int
+
+const (
+	// A is documented.
+	A Foo = iota
+	B
+)
+`
+
+	out, err := appendConstants([]byte(src), "Foo", []string{"A", "B", "C", "D"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(out), "\t// A is documented.\n\tA Foo = iota\n\tB\n\tC\n\tD\n)") {
+		t.Error("Constants weren't appended:\n", string(out))
+	}
+
+	if _, err := appendConstants([]byte(src), "Foo", []string{"A"}); err == nil {
+		t.Error("Header with fewer values doesn't return an error")
+	}
+}
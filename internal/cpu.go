@@ -3,6 +3,7 @@ package internal
 import (
 	"fmt"
 	"io/ioutil"
+	"strconv"
 	"strings"
 	"sync"
 )
@@ -23,6 +24,26 @@ func PossibleCPUs() (int, error) {
 	return sysCPU.num, sysCPU.err
 }
 
+// OnlineCPUs returns the logical numbers of the CPUs which are currently
+// online, in ascending order.
+//
+// The result isn't cached since CPUs can be hotplugged at any time.
+func OnlineCPUs() ([]int, error) {
+	const path = "/sys/devices/system/cpu/online"
+
+	spec, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cpus, err := parseCPUList(string(spec))
+	if err != nil {
+		return nil, fmt.Errorf("can't parse %s: %v", path, err)
+	}
+
+	return cpus, nil
+}
+
 func parseCPUsFromFile(path string) (int, error) {
 	spec, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -39,24 +60,60 @@ func parseCPUsFromFile(path string) (int, error) {
 
 // parseCPUs parses the number of cpus from a string produced
 // by bitmap_list_string() in the Linux kernel.
-// Multiple ranges are rejected, since they can't be unified
-// into a single number.
+// Lists which don't form a single range starting at zero are rejected,
+// since they can't be unified into a single number.
 // This is the format of /sys/devices/system/cpu/possible, it
 // is not suitable for /sys/devices/system/cpu/online, etc.
 func parseCPUs(spec string) (int, error) {
-	if strings.Trim(spec, "\n") == "0" {
-		return 1, nil
+	cpus, err := parseCPUList(spec)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, cpu := range cpus {
+		if cpu != i {
+			return 0, fmt.Errorf("CPU spec isn't a single range starting at zero: %s", spec)
+		}
 	}
 
-	var low, high int
-	n, err := fmt.Sscanf(spec, "%d-%d\n", &low, &high)
-	if n != 2 || err != nil {
-		return 0, fmt.Errorf("invalid format: %s", spec)
+	return len(cpus), nil
+}
+
+// parseCPUList parses a string produced by bitmap_list_string() in the
+// Linux kernel, for example "0-3,5,7-8".
+//
+// Returns the logical CPU numbers in ascending order.
+func parseCPUList(spec string) ([]int, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, fmt.Errorf("invalid format: empty CPU list")
 	}
-	if low != 0 {
-		return 0, fmt.Errorf("CPU spec doesn't start at zero: %s", spec)
+
+	var cpus []int
+	for _, field := range strings.Split(spec, ",") {
+		low, high := field, field
+		if i := strings.IndexByte(field, '-'); i >= 0 {
+			low, high = field[:i], field[i+1:]
+		}
+
+		first, err := strconv.ParseUint(low, 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("invalid format: %s", spec)
+		}
+
+		last, err := strconv.ParseUint(high, 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("invalid format: %s", spec)
+		}
+
+		if last < first || (len(cpus) > 0 && int(first) <= cpus[len(cpus)-1]) {
+			return nil, fmt.Errorf("invalid format: %s", spec)
+		}
+
+		for cpu := int(first); cpu <= int(last); cpu++ {
+			cpus = append(cpus, cpu)
+		}
 	}
 
-	// cpus is 0 indexed
-	return high + 1, nil
+	return cpus, nil
 }
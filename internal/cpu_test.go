@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -20,6 +21,7 @@ func TestParseCPUs(t *testing.T) {
 
 	for _, str := range []string{
 		"0,3-4",
+		"1-3",
 		"0-",
 		"1,",
 		"",
@@ -30,3 +32,51 @@ func TestParseCPUs(t *testing.T) {
 		}
 	}
 }
+
+func TestParseCPUList(t *testing.T) {
+	for str, want := range map[string][]int{
+		"0":         {0},
+		"0-2\n":     {0, 1, 2},
+		"0,3-4":     {0, 3, 4},
+		"1-2,5,7-8": {1, 2, 5, 7, 8},
+	} {
+		have, err := parseCPUList(str)
+		if err != nil {
+			t.Errorf("Can't parse `%s`: %v", str, err)
+			continue
+		}
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("Parsing %q returns %v instead of %v", str, have, want)
+		}
+	}
+
+	for _, str := range []string{
+		"",
+		"0-",
+		"1,",
+		"3-1",
+		"2,1",
+		"0-2,2",
+		"a",
+	} {
+		if _, err := parseCPUList(str); err == nil {
+			t.Error("Parsed invalid format:", str)
+		}
+	}
+}
+
+func TestOnlineCPUs(t *testing.T) {
+	cpus, err := OnlineCPUs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	possible, err := PossibleCPUs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cpus) == 0 || cpus[len(cpus)-1] >= possible {
+		t.Errorf("Online CPUs %v don't fit into %d possible CPUs", cpus, possible)
+	}
+}
@@ -22,3 +22,18 @@ func isBigEndian() (ret bool) {
 	bs := (*[int(unsafe.Sizeof(i))]byte)(unsafe.Pointer(&i))
 	return bs[0] == 0
 }
+
+// IsLittleEndian returns true if bo encodes the least significant byte
+// first.
+//
+// Unlike comparing against binary.LittleEndian this works for any
+// implementation of binary.ByteOrder, for example binary.NativeEndian.
+func IsLittleEndian(bo binary.ByteOrder) bool {
+	return bo.Uint16([]byte{1, 0}) == 1
+}
+
+// IsNativeEndian returns true if bo encodes integers in the byte order of
+// the host, which is what the kernel expects.
+func IsNativeEndian(bo binary.ByteOrder) bool {
+	return IsLittleEndian(bo) == !isBigEndian()
+}
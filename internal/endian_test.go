@@ -0,0 +1,37 @@
+package internal_test
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/testutils"
+)
+
+func TestIsLittleEndian(t *testing.T) {
+	for _, test := range []struct {
+		bo     binary.ByteOrder
+		little bool
+	}{
+		{binary.LittleEndian, true},
+		{binary.BigEndian, false},
+		{testutils.WrappedByteOrder{ByteOrder: binary.LittleEndian}, true},
+		{testutils.WrappedByteOrder{ByteOrder: binary.BigEndian}, false},
+	} {
+		if have := internal.IsLittleEndian(test.bo); have != test.little {
+			t.Errorf("IsLittleEndian(%s) returns %t", test.bo, have)
+		}
+	}
+
+	if !internal.IsNativeEndian(internal.NativeEndian) || !internal.IsNativeEndian(testutils.WrappedByteOrder{ByteOrder: internal.NativeEndian}) {
+		t.Error("NativeEndian isn't native")
+	}
+
+	other := binary.ByteOrder(binary.BigEndian)
+	if !internal.IsLittleEndian(internal.NativeEndian) {
+		other = binary.LittleEndian
+	}
+	if internal.IsNativeEndian(other) {
+		t.Errorf("%s is considered native", other)
+	}
+}
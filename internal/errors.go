@@ -37,6 +37,31 @@ func (le *VerifierError) Error() string {
 	return fmt.Sprintf("%s: %s", le.cause, le.log)
 }
 
+// SyscallError wraps an error returned by a syscall so that it matches
+// sentinel in errors.Is, while still unwrapping to the original errno.
+//
+// The error message is the message of sentinel.
+func SyscallError(sentinel, err error) error {
+	return &syscallError{sentinel, err}
+}
+
+type syscallError struct {
+	sentinel error
+	errno    error
+}
+
+func (se *syscallError) Error() string {
+	return se.sentinel.Error()
+}
+
+func (se *syscallError) Is(target error) bool {
+	return target == se.sentinel
+}
+
+func (se *syscallError) Unwrap() error {
+	return se.errno
+}
+
 // CString turns a NUL / zero terminated byte buffer into a string.
 func CString(in []byte) string {
 	inLen := bytes.IndexByte(in, 0)
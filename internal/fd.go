@@ -6,6 +6,8 @@ import (
 	"os"
 	"runtime"
 	"strconv"
+	"strings"
+	"sync/atomic"
 
 	"github.com/cilium/ebpf/internal/unix"
 )
@@ -14,14 +16,59 @@ var ErrClosedFd = errors.New("use of closed file descriptor")
 
 type FD struct {
 	raw int64
+	// The stack which created the fd, only recorded if a leak reporter
+	// is set.
+	stack []uintptr
+}
+
+// LeakReporter is called with the value of an fd which was garbage
+// collected without being closed, and the stack which created it.
+type LeakReporter func(fd int, stack string)
+
+type leakReporter struct {
+	report LeakReporter
+}
+
+var fdLeaks atomic.Value
+
+// SetLeakReporter enables tracking of leaked fds.
+//
+// Only fds created after the call are tracked. Pass nil to disable
+// tracking.
+func SetLeakReporter(report LeakReporter) {
+	fdLeaks.Store(leakReporter{report})
 }
 
 func NewFD(value uint32) *FD {
-	fd := &FD{int64(value)}
+	fd := &FD{raw: int64(value)}
+
+	if lr, _ := fdLeaks.Load().(leakReporter); lr.report != nil {
+		pcs := make([]uintptr, 32)
+		// Skip runtime.Callers and NewFD.
+		fd.stack = pcs[:runtime.Callers(2, pcs)]
+		runtime.SetFinalizer(fd, func(fd *FD) {
+			lr.report(int(fd.raw), formatStack(fd.stack))
+			fd.Close()
+		})
+		return fd
+	}
+
 	runtime.SetFinalizer(fd, (*FD).Close)
 	return fd
 }
 
+func formatStack(pcs []uintptr) string {
+	var b strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			return b.String()
+		}
+	}
+}
+
 func (fd *FD) String() string {
 	return strconv.FormatInt(fd.raw, 10)
 }
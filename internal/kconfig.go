@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+var kernelConfig struct {
+	once   sync.Once
+	err    error
+	config map[string]string
+}
+
+// KernelConfig returns the configuration the running kernel was built with.
+//
+// The configuration is read from /proc/config.gz, or from
+// /boot/config-$(uname -r) if the former doesn't exist. Options which are
+// not set are omitted from the result.
+func KernelConfig() (map[string]string, error) {
+	kernelConfig.once.Do(func() {
+		kernelConfig.config, kernelConfig.err = readKernelConfig()
+	})
+
+	return kernelConfig.config, kernelConfig.err
+}
+
+func readKernelConfig() (map[string]string, error) {
+	f, err := os.Open("/proc/config.gz")
+	if err == nil {
+		defer f.Close()
+
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("/proc/config.gz: %w", err)
+		}
+		defer gz.Close()
+
+		return parseKernelConfig(gz)
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	var uname unix.Utsname
+	if err := unix.Uname(&uname); err != nil {
+		return nil, fmt.Errorf("uname: %w", err)
+	}
+
+	f, err = os.Open("/boot/config-" + unix.ByteSliceToString(uname.Release[:]))
+	if err != nil {
+		return nil, fmt.Errorf("kernel config: %w", err)
+	}
+	defer f.Close()
+
+	return parseKernelConfig(f)
+}
+
+// parseKernelConfig parses the output of make config.
+func parseKernelConfig(r io.Reader) (map[string]string, error) {
+	config := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], "CONFIG_") {
+			return nil, fmt.Errorf("invalid line %q", line)
+		}
+
+		config[parts[0]] = parts[1]
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
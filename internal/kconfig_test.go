@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseKernelConfig(t *testing.T) {
+	config, err := parseKernelConfig(strings.NewReader(`
+#
+# Automatically generated file; DO NOT EDIT.
+#
+CONFIG_BPF=y
+CONFIG_BPF_JIT=m
+# CONFIG_BPF_PRELOAD is not set
+CONFIG_HZ=250
+CONFIG_DEFAULT_HOSTNAME="(none)"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"CONFIG_BPF":              "y",
+		"CONFIG_BPF_JIT":          "m",
+		"CONFIG_HZ":               "250",
+		"CONFIG_DEFAULT_HOSTNAME": `"(none)"`,
+	}
+	if len(config) != len(want) {
+		t.Errorf("Expected %d options, got %d", len(want), len(config))
+	}
+	for k, v := range want {
+		if config[k] != v {
+			t.Errorf("Expected %s=%s, got %q", k, v, config[k])
+		}
+	}
+
+	for _, invalid := range []string{"CONFIG_FOO", "FOO=y"} {
+		if _, err := parseKernelConfig(strings.NewReader(invalid)); err == nil {
+			t.Errorf("Accepted invalid line %q", invalid)
+		}
+	}
+}
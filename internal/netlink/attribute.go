@@ -0,0 +1,120 @@
+package netlink
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cilium/ebpf/internal"
+)
+
+// Nested is set in the type of attributes which contain other attributes.
+const Nested = 0x8000
+
+const attributeHeaderLen = 4
+
+// Attribute is a netlink attribute.
+type Attribute struct {
+	Type uint16
+	Data []byte
+}
+
+// Uint32Attribute creates an attribute holding a uint32.
+func Uint32Attribute(typ uint16, value uint32) Attribute {
+	data := make([]byte, 4)
+	internal.NativeEndian.PutUint32(data, value)
+	return Attribute{typ, data}
+}
+
+// Uint16Attribute creates an attribute holding a uint16.
+func Uint16Attribute(typ uint16, value uint16) Attribute {
+	data := make([]byte, 2)
+	internal.NativeEndian.PutUint16(data, value)
+	return Attribute{typ, data}
+}
+
+// StringAttribute creates an attribute holding a NUL terminated string.
+func StringAttribute(typ uint16, value string) Attribute {
+	return Attribute{typ, append([]byte(value), 0)}
+}
+
+// NestedAttribute creates an attribute containing attrs.
+func NestedAttribute(typ uint16, attrs ...Attribute) Attribute {
+	return Attribute{typ | Nested, MarshalAttributes(attrs)}
+}
+
+// Uint32 decodes the attribute as a uint32.
+func (a Attribute) Uint32() (uint32, error) {
+	if len(a.Data) < 4 {
+		return 0, fmt.Errorf("attribute %d: expected 4 bytes, got %d", a.Type, len(a.Data))
+	}
+	return internal.NativeEndian.Uint32(a.Data), nil
+}
+
+// Uint8 decodes the attribute as a uint8.
+func (a Attribute) Uint8() (uint8, error) {
+	if len(a.Data) < 1 {
+		return 0, fmt.Errorf("attribute %d: empty", a.Type)
+	}
+	return a.Data[0], nil
+}
+
+// String decodes the attribute as a NUL terminated string.
+func (a Attribute) String() string {
+	for i, b := range a.Data {
+		if b == 0 {
+			return string(a.Data[:i])
+		}
+	}
+	return string(a.Data)
+}
+
+// Nested decodes the attributes contained in a.
+func (a Attribute) Nested() ([]Attribute, error) {
+	return UnmarshalAttributes(a.Data)
+}
+
+// MarshalAttributes encodes attributes including padding.
+func MarshalAttributes(attrs []Attribute) []byte {
+	var buf []byte
+	for _, attr := range attrs {
+		length := attributeHeaderLen + len(attr.Data)
+		hdr := make([]byte, attributeHeaderLen)
+		internal.NativeEndian.PutUint16(hdr[0:], uint16(length))
+		internal.NativeEndian.PutUint16(hdr[2:], attr.Type)
+
+		buf = append(buf, hdr...)
+		buf = append(buf, attr.Data...)
+		buf = append(buf, make([]byte, align(length)-length)...)
+	}
+	return buf
+}
+
+// UnmarshalAttributes decodes attributes. The Nested flag is cleared from
+// the type of returned attributes.
+func UnmarshalAttributes(buf []byte) ([]Attribute, error) {
+	var attrs []Attribute
+	for len(buf) > 0 {
+		if len(buf) < attributeHeaderLen {
+			return nil, errors.New("trailing data after attributes")
+		}
+
+		length := int(internal.NativeEndian.Uint16(buf[0:]))
+		if length < attributeHeaderLen || length > len(buf) {
+			return nil, fmt.Errorf("invalid attribute length %d", length)
+		}
+
+		attrs = append(attrs, Attribute{
+			Type: internal.NativeEndian.Uint16(buf[2:]) &^ Nested,
+			Data: buf[attributeHeaderLen:length],
+		})
+
+		// The last attribute may not be padded, see RTA_NEXT.
+		next := align(length)
+		if next > len(buf) {
+			next = len(buf)
+		}
+		buf = buf[next:]
+	}
+
+	return attrs, nil
+}
@@ -0,0 +1,207 @@
+// Package netlink implements the subset of rtnetlink required to manage
+// BPF programs attached to network interfaces and routes.
+package netlink
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+// Message flags, see <linux/netlink.h>.
+const (
+	Request = 0x1
+	Multi   = 0x2
+	Ack     = 0x4
+	Root    = 0x100
+	Match   = 0x200
+	Dump    = Root | Match
+	Replace = 0x100
+	Excl    = 0x200
+	Create  = 0x400
+)
+
+// Message types, see <linux/netlink.h> and <linux/rtnetlink.h>.
+const (
+	typeError = 0x2
+	typeDone  = 0x3
+
+	RTM_NEWLINK    = 16
+	RTM_GETLINK    = 18
+	RTM_SETLINK    = 19
+	RTM_NEWROUTE   = 24
+	RTM_DELROUTE   = 25
+	RTM_GETROUTE   = 26
+	RTM_NEWTFILTER = 44
+	RTM_DELTFILTER = 45
+	RTM_GETTFILTER = 46
+)
+
+const headerLen = 16
+
+// Message is a netlink message without its header.
+type Message struct {
+	Type  uint16
+	Flags uint16
+	Data  []byte
+}
+
+// Conn is a NETLINK_ROUTE socket.
+//
+// It's safe to use a Conn from multiple goroutines.
+type Conn struct {
+	mu  sync.Mutex
+	fd  int
+	seq uint32
+}
+
+// Dial opens a NETLINK_ROUTE socket.
+func Dial() (*Conn, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return nil, fmt.Errorf("can't open netlink socket: %w", err)
+	}
+
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("can't bind netlink socket: %w", err)
+	}
+
+	return &Conn{fd: fd}, nil
+}
+
+// Close the socket.
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.fd == -1 {
+		return nil
+	}
+
+	err := unix.Close(c.fd)
+	c.fd = -1
+	return err
+}
+
+// Execute sends a request and returns the replies.
+//
+// The Request and Ack flags are always set. Acknowledgements aren't part
+// of the returned messages. Returns an error wrapping the errno if the
+// kernel rejects the request.
+func (c *Conn) Execute(req Message) ([]Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.fd == -1 {
+		return nil, fmt.Errorf("netlink: %w", internal.ErrClosedFd)
+	}
+
+	c.seq++
+	seq := c.seq
+
+	// Root and Match share bits with Replace, Excl and Create. Like the
+	// kernel, only treat get requests as dumps. Their type is always
+	// RTM_BASE + 2 modulo 4, see <linux/rtnetlink.h>.
+	dump := req.Flags&Dump != 0 && req.Type%4 == 2
+
+	msg := make([]byte, headerLen, headerLen+len(req.Data))
+	internal.NativeEndian.PutUint32(msg[0:], uint32(headerLen+len(req.Data)))
+	internal.NativeEndian.PutUint16(msg[4:], req.Type)
+	internal.NativeEndian.PutUint16(msg[6:], req.Flags|Request|Ack)
+	internal.NativeEndian.PutUint32(msg[8:], seq)
+	msg = append(msg, req.Data...)
+
+	if err := unix.Sendto(c.fd, msg, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return nil, fmt.Errorf("netlink: send: %w", err)
+	}
+
+	var (
+		replies []Message
+		buf     = make([]byte, os.Getpagesize()*8)
+	)
+	for {
+		n, _, err := unix.Recvfrom(c.fd, buf, 0)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("netlink: receive: %w", err)
+		}
+
+		msgs, err := parseMessages(buf[:n])
+		if err != nil {
+			return nil, fmt.Errorf("netlink: %w", err)
+		}
+
+		for _, msg := range msgs {
+			if msg.seq != seq {
+				// A reply to an earlier request which was interrupted.
+				continue
+			}
+
+			switch msg.Type {
+			case typeDone:
+				return replies, nil
+
+			case typeError:
+				if len(msg.Data) < 4 {
+					return nil, errors.New("netlink: truncated error message")
+				}
+
+				errno := -int32(internal.NativeEndian.Uint32(msg.Data))
+				if errno != 0 {
+					return nil, fmt.Errorf("netlink: %w", syscall.Errno(errno))
+				}
+				if !dump {
+					return replies, nil
+				}
+
+			default:
+				replies = append(replies, msg.Message)
+			}
+		}
+	}
+}
+
+type rawMessage struct {
+	Message
+	seq uint32
+}
+
+func parseMessages(buf []byte) ([]rawMessage, error) {
+	var msgs []rawMessage
+	for len(buf) >= headerLen {
+		length := internal.NativeEndian.Uint32(buf[0:])
+		if length < headerLen || int(length) > len(buf) {
+			return nil, fmt.Errorf("invalid message length %d", length)
+		}
+
+		msgs = append(msgs, rawMessage{
+			Message{
+				Type:  internal.NativeEndian.Uint16(buf[4:]),
+				Flags: internal.NativeEndian.Uint16(buf[6:]),
+				Data:  append([]byte(nil), buf[headerLen:length]...),
+			},
+			internal.NativeEndian.Uint32(buf[8:]),
+		})
+
+		// The last message may not be padded, see NLMSG_NEXT.
+		next := align(int(length))
+		if next > len(buf) {
+			next = len(buf)
+		}
+		buf = buf[next:]
+	}
+	return msgs, nil
+}
+
+// align rounds n up to NLMSG_ALIGNTO and NLA_ALIGNTO.
+func align(n int) int {
+	return (n + 3) &^ 3
+}
@@ -0,0 +1,206 @@
+package netlink
+
+import (
+	"errors"
+	"math"
+	"net"
+	"testing"
+
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+func TestAttributes(t *testing.T) {
+	attrs := []Attribute{
+		Uint32Attribute(1, 42),
+		StringAttribute(2, "abc"),
+		NestedAttribute(3, Uint16Attribute(4, 7)),
+	}
+
+	buf := MarshalAttributes(attrs)
+	if len(buf)%4 != 0 {
+		t.Error("Attributes aren't padded:", len(buf))
+	}
+
+	have, err := UnmarshalAttributes(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(have) != 3 {
+		t.Fatal("Expected 3 attributes, got", len(have))
+	}
+
+	if v, err := have[0].Uint32(); err != nil || v != 42 {
+		t.Error("Wrong uint32 attribute:", v, err)
+	}
+	if s := have[1].String(); s != "abc" {
+		t.Errorf("Wrong string attribute: %q", s)
+	}
+	if have[2].Type != 3 {
+		t.Error("Nested flag isn't cleared:", have[2].Type)
+	}
+	nested, err := have[2].Nested()
+	if err != nil || len(nested) != 1 || internal.NativeEndian.Uint16(nested[0].Data) != 7 {
+		t.Error("Wrong nested attributes:", nested, err)
+	}
+
+	if _, err := UnmarshalAttributes([]byte{8, 0, 1, 0}); err == nil {
+		t.Error("Truncated attribute doesn't return an error")
+	}
+
+	// The last attribute doesn't have to be padded.
+	unpadded := MarshalAttributes([]Attribute{StringAttribute(1, "abc")})
+	unpadded = append(unpadded, MarshalAttributes([]Attribute{Uint16Attribute(2, 7)})[:6]...)
+	have, err = UnmarshalAttributes(unpadded)
+	if err != nil {
+		t.Fatal("Unpadded last attribute:", err)
+	}
+	if len(have) != 2 || internal.NativeEndian.Uint16(have[1].Data) != 7 {
+		t.Error("Wrong unpadded attributes:", have)
+	}
+}
+
+func TestParseMessagesUnpadded(t *testing.T) {
+	msg := func(typ uint16, data ...byte) []byte {
+		buf := make([]byte, headerLen, headerLen+len(data))
+		internal.NativeEndian.PutUint32(buf[0:], uint32(headerLen+len(data)))
+		internal.NativeEndian.PutUint16(buf[4:], typ)
+		return append(buf, data...)
+	}
+
+	buf := append(msg(1, 1, 2, 3, 0), msg(2, 4, 5)...)
+	msgs, err := parseMessages(buf)
+	if err != nil {
+		t.Fatal("Unpadded last message:", err)
+	}
+	if len(msgs) != 2 {
+		t.Fatal("Expected 2 messages, got", len(msgs))
+	}
+	if msgs[1].Type != 2 || len(msgs[1].Data) != 2 {
+		t.Error("Wrong last message:", msgs[1].Message)
+	}
+}
+
+func TestXDP(t *testing.T) {
+	iface, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skip("No loopback interface:", err)
+	}
+
+	conn, err := Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Attaching programs is tested by package link. Other packages may
+	// attach to lo concurrently, so only query it here.
+	if _, err := conn.XDP(iface.Index); err != nil {
+		t.Fatal("Can't query XDP:", err)
+	}
+
+	if _, err := conn.XDP(math.MaxInt32); !errors.Is(err, unix.ENODEV) {
+		t.Error("Querying a missing interface doesn't return ENODEV:", err)
+	}
+
+	err = conn.SetXDP(math.MaxInt32, SetXDPOptions{FD: -1})
+	if !errors.Is(err, unix.ENODEV) {
+		t.Error("Detaching from a missing interface doesn't return ENODEV:", err)
+	}
+
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.XDP(iface.Index); err == nil {
+		t.Error("Using a closed Conn doesn't return an error")
+	}
+}
+
+func TestBPFFilters(t *testing.T) {
+	iface, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skip("No loopback interface:", err)
+	}
+
+	conn, err := Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Attaching filters is tested by package link.
+	for _, parent := range []uint32{TC_H_INGRESS, TC_H_EGRESS} {
+		if _, err := conn.BPFFilters(iface.Index, parent); err != nil {
+			t.Fatalf("Can't query filters of parent %#x: %s", parent, err)
+		}
+	}
+}
+
+func TestUnmarshalBPFFilter(t *testing.T) {
+	msg := marshalTcMsg(1, 7, TC_H_INGRESS, filterInfo(3, ethPAll),
+		StringAttribute(TCA_KIND, "bpf"),
+		NestedAttribute(TCA_OPTIONS,
+			StringAttribute(TCA_BPF_NAME, "foo"),
+			Uint32Attribute(TCA_BPF_ID, 42),
+			Uint32Attribute(TCA_BPF_FLAGS, TCA_BPF_FLAG_ACT_DIRECT),
+		),
+	)
+
+	have, err := unmarshalBPFFilter(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := BPFFilter{Handle: 7, Priority: 3, Name: "foo", ProgramID: 42, DirectAction: true}
+	if have == nil || *have != want {
+		t.Errorf("Expected %+v, got %+v", want, have)
+	}
+
+	head := marshalTcMsg(1, 0, TC_H_INGRESS, filterInfo(3, ethPAll), StringAttribute(TCA_KIND, "bpf"))
+	if have, err := unmarshalBPFFilter(head); err != nil || have != nil {
+		t.Error("Filter without options isn't skipped:", have, err)
+	}
+}
+
+func TestMarshalRtMsg(t *testing.T) {
+	for _, tc := range []struct {
+		cidr   string
+		family uint8
+		dst    net.IP
+	}{
+		{"198.51.100.0/24", afInet, net.IP{198, 51, 100, 0}},
+		{"2001:db8::1/128", afInet6, net.ParseIP("2001:db8::1")},
+	} {
+		_, dst, err := net.ParseCIDR(tc.cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buf, err := marshalRtMsg(Route{Dst: dst, Interface: 1})
+		if err != nil {
+			t.Fatalf("%s: %s", tc.cidr, err)
+		}
+
+		ones, _ := dst.Mask.Size()
+		if buf[0] != tc.family || int(buf[1]) != ones {
+			t.Errorf("%s: wrong family or prefix length: %v", tc.cidr, buf[:2])
+		}
+
+		attrs, err := UnmarshalAttributes(buf[rtMsgLen:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(attrs) != 2 || attrs[0].Type != RTA_DST || !net.IP(attrs[0].Data).Equal(tc.dst) {
+			t.Errorf("%s: wrong destination: %v", tc.cidr, attrs)
+		}
+	}
+
+	ipv6Mask := &net.IPNet{IP: net.IP{198, 51, 100, 0}, Mask: net.CIDRMask(64, 128)}
+	if _, err := marshalRtMsg(Route{Dst: ipv6Mask}); err == nil {
+		t.Error("IPv4 destination with IPv6 mask doesn't return an error")
+	}
+
+	if _, err := marshalRtMsg(Route{}); err == nil {
+		t.Error("Missing destination doesn't return an error")
+	}
+}
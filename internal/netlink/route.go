@@ -0,0 +1,155 @@
+package netlink
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Route attributes, see <linux/rtnetlink.h> and <linux/lwtunnel.h>.
+const (
+	RTA_DST        = 1
+	RTA_OIF        = 4
+	RTA_ENCAP_TYPE = 21
+	RTA_ENCAP      = 22
+
+	LWTUNNEL_ENCAP_BPF = 6
+
+	LWT_BPF_IN            = 1
+	LWT_BPF_OUT           = 2
+	LWT_BPF_XMIT          = 3
+	LWT_BPF_XMIT_HEADROOM = 4
+
+	LWT_BPF_PROG_FD   = 1
+	LWT_BPF_PROG_NAME = 2
+)
+
+// Address families, see <linux/socket.h>.
+const (
+	afInet  = 2
+	afInet6 = 10
+)
+
+// Route properties, see <linux/rtnetlink.h>.
+const (
+	rtTableMain = 254
+	rtProtBoot  = 3
+	rtScopeLink = 253
+	rtnUnicast  = 1
+)
+
+// rtMsgLen is the size of struct rtmsg.
+const rtMsgLen = 12
+
+// Route is a unicast route in the main table which sends packets for Dst
+// directly to an interface.
+type Route struct {
+	Dst       *net.IPNet
+	Interface int
+}
+
+func marshalRtMsg(route Route, attrs ...Attribute) ([]byte, error) {
+	if route.Dst == nil {
+		return nil, errors.New("route: missing destination")
+	}
+
+	family, dst := uint8(afInet), route.Dst.IP.To4()
+	if dst == nil {
+		family, dst = afInet6, route.Dst.IP.To16()
+	}
+	if dst == nil {
+		return nil, fmt.Errorf("route: invalid destination %s", route.Dst)
+	}
+
+	ones, bits := route.Dst.Mask.Size()
+	if bits != len(dst)*8 {
+		return nil, fmt.Errorf("route: invalid mask for %s", route.Dst)
+	}
+
+	buf := make([]byte, rtMsgLen)
+	buf[0] = family
+	buf[1] = uint8(ones)
+	buf[4] = rtTableMain
+	buf[5] = rtProtBoot
+	buf[6] = rtScopeLink
+	buf[7] = rtnUnicast
+
+	attrs = append([]Attribute{
+		{RTA_DST, dst.Mask(route.Dst.Mask)},
+		Uint32Attribute(RTA_OIF, uint32(route.Interface)),
+	}, attrs...)
+	return append(buf, MarshalAttributes(attrs)...), nil
+}
+
+// LWTProgram is a program invoked by a lightweight tunnel.
+type LWTProgram struct {
+	// Hook is LWT_BPF_IN, LWT_BPF_OUT or LWT_BPF_XMIT.
+	Hook uint16
+	FD   int
+	// Name is an arbitrary description of the program.
+	Name string
+	// Headroom reserves space for headers pushed by the program. Only
+	// valid for LWT_BPF_XMIT.
+	Headroom uint32
+}
+
+func (prog *LWTProgram) encap() []Attribute {
+	attrs := []Attribute{
+		Uint16Attribute(RTA_ENCAP_TYPE, LWTUNNEL_ENCAP_BPF),
+	}
+
+	encap := []Attribute{
+		NestedAttribute(prog.Hook,
+			Uint32Attribute(LWT_BPF_PROG_FD, uint32(prog.FD)),
+			StringAttribute(LWT_BPF_PROG_NAME, prog.Name),
+		),
+	}
+	if prog.Headroom != 0 {
+		encap = append(encap, Uint32Attribute(LWT_BPF_XMIT_HEADROOM, prog.Headroom))
+	}
+
+	return append(attrs, NestedAttribute(RTA_ENCAP, encap...))
+}
+
+// AddLWTRoute adds a route which runs prog for all packets it matches.
+//
+// Returns an error wrapping EEXIST if the route already exists, unless
+// replace is true. Replacing a route is atomic.
+func (c *Conn) AddLWTRoute(route Route, prog LWTProgram, replace bool) error {
+	data, err := marshalRtMsg(route, prog.encap()...)
+	if err != nil {
+		return err
+	}
+
+	flags := uint16(Create | Excl)
+	if replace {
+		flags = Create | Replace
+	}
+
+	_, err = c.Execute(Message{
+		Type:  RTM_NEWROUTE,
+		Flags: flags,
+		Data:  data,
+	})
+	if err != nil {
+		return fmt.Errorf("add route to %s: %w", route.Dst, err)
+	}
+	return nil
+}
+
+// DelRoute removes a route.
+func (c *Conn) DelRoute(route Route) error {
+	data, err := marshalRtMsg(route)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Execute(Message{
+		Type: RTM_DELROUTE,
+		Data: data,
+	})
+	if err != nil {
+		return fmt.Errorf("remove route to %s: %w", route.Dst, err)
+	}
+	return nil
+}
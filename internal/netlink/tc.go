@@ -0,0 +1,228 @@
+package netlink
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/cilium/ebpf/internal"
+)
+
+// Traffic control message types, see <linux/rtnetlink.h>.
+const (
+	RTM_NEWQDISC = 36
+	RTM_DELQDISC = 37
+)
+
+// Traffic control attributes, see <linux/rtnetlink.h> and
+// <linux/pkt_cls.h>.
+const (
+	TCA_KIND    = 1
+	TCA_OPTIONS = 2
+
+	TCA_BPF_FD    = 6
+	TCA_BPF_NAME  = 7
+	TCA_BPF_FLAGS = 8
+	TCA_BPF_ID    = 11
+
+	TCA_BPF_FLAG_ACT_DIRECT = 1 << 0
+)
+
+// Parents of filters attached to the clsact qdisc, see <linux/pkt_sched.h>.
+const (
+	TC_H_CLSACT  = 0xfffffff1
+	TC_H_INGRESS = 0xfffffff2
+	TC_H_EGRESS  = 0xfffffff3
+
+	clsactHandle = 0xffff0000
+)
+
+// ethPAll matches all protocols, see <linux/if_ether.h>.
+const ethPAll = 0x3
+
+// tcMsgLen is the size of struct tcmsg.
+const tcMsgLen = 20
+
+func marshalTcMsg(ifindex int, handle, parent, info uint32, attrs ...Attribute) []byte {
+	buf := make([]byte, tcMsgLen)
+	buf[0] = 0 // AF_UNSPEC
+	internal.NativeEndian.PutUint32(buf[4:], uint32(ifindex))
+	internal.NativeEndian.PutUint32(buf[8:], handle)
+	internal.NativeEndian.PutUint32(buf[12:], parent)
+	internal.NativeEndian.PutUint32(buf[16:], info)
+	return append(buf, MarshalAttributes(attrs)...)
+}
+
+// filterInfo encodes the priority and protocol of a filter. The protocol
+// is in network byte order.
+func filterInfo(priority, protocol uint16) uint32 {
+	proto := make([]byte, 2)
+	binary.BigEndian.PutUint16(proto, protocol)
+	return uint32(priority)<<16 | uint32(internal.NativeEndian.Uint16(proto))
+}
+
+// AddClsact adds a clsact qdisc to an interface.
+//
+// Returns an error wrapping EEXIST if the interface already has one.
+func (c *Conn) AddClsact(ifindex int) error {
+	_, err := c.Execute(Message{
+		Type:  RTM_NEWQDISC,
+		Flags: Create | Excl,
+		Data:  marshalTcMsg(ifindex, clsactHandle, TC_H_CLSACT, 0, StringAttribute(TCA_KIND, "clsact")),
+	})
+	if err != nil {
+		return fmt.Errorf("add clsact to interface %d: %w", ifindex, err)
+	}
+	return nil
+}
+
+// DelClsact removes the clsact qdisc and all its filters from an interface.
+func (c *Conn) DelClsact(ifindex int) error {
+	_, err := c.Execute(Message{
+		Type: RTM_DELQDISC,
+		Data: marshalTcMsg(ifindex, clsactHandle, TC_H_CLSACT, 0, StringAttribute(TCA_KIND, "clsact")),
+	})
+	if err != nil {
+		return fmt.Errorf("remove clsact from interface %d: %w", ifindex, err)
+	}
+	return nil
+}
+
+// BPFFilter is a cls_bpf filter matching all protocols.
+type BPFFilter struct {
+	Handle   uint32
+	Priority uint16
+	// Name is an arbitrary description of the program.
+	Name      string
+	ProgramID uint32
+	// DirectAction is true if the return value of the program is used
+	// as the action of the filter.
+	DirectAction bool
+}
+
+// AddBPFFilter attaches a program to the clsact qdisc of an interface.
+//
+// parent is either TC_H_INGRESS or TC_H_EGRESS. filter.ProgramID is
+// ignored, fd is used instead.
+func (c *Conn) AddBPFFilter(ifindex int, parent uint32, filter BPFFilter, fd int) error {
+	opts := []Attribute{
+		Uint32Attribute(TCA_BPF_FD, uint32(fd)),
+		StringAttribute(TCA_BPF_NAME, filter.Name),
+	}
+	if filter.DirectAction {
+		opts = append(opts, Uint32Attribute(TCA_BPF_FLAGS, TCA_BPF_FLAG_ACT_DIRECT))
+	}
+
+	_, err := c.Execute(Message{
+		Type:  RTM_NEWTFILTER,
+		Flags: Create | Excl,
+		Data: marshalTcMsg(ifindex, filter.Handle, parent, filterInfo(filter.Priority, ethPAll),
+			StringAttribute(TCA_KIND, "bpf"),
+			NestedAttribute(TCA_OPTIONS, opts...),
+		),
+	})
+	if err != nil {
+		return fmt.Errorf("add filter to interface %d: %w", ifindex, err)
+	}
+	return nil
+}
+
+// DelBPFFilter removes a filter added by AddBPFFilter.
+func (c *Conn) DelBPFFilter(ifindex int, parent uint32, handle uint32, priority uint16) error {
+	_, err := c.Execute(Message{
+		Type: RTM_DELTFILTER,
+		Data: marshalTcMsg(ifindex, handle, parent, filterInfo(priority, ethPAll),
+			StringAttribute(TCA_KIND, "bpf"),
+		),
+	})
+	if err != nil {
+		return fmt.Errorf("remove filter from interface %d: %w", ifindex, err)
+	}
+	return nil
+}
+
+// BPFFilters returns the cls_bpf filters attached to the clsact qdisc of an
+// interface.
+//
+// parent is either TC_H_INGRESS or TC_H_EGRESS. Returns an empty slice if
+// the interface doesn't have a clsact qdisc.
+func (c *Conn) BPFFilters(ifindex int, parent uint32) ([]BPFFilter, error) {
+	replies, err := c.Execute(Message{
+		Type:  RTM_GETTFILTER,
+		Flags: Dump,
+		Data:  marshalTcMsg(ifindex, 0, parent, 0),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get filters of interface %d: %w", ifindex, err)
+	}
+
+	var filters []BPFFilter
+	for _, reply := range replies {
+		if reply.Type != RTM_NEWTFILTER || len(reply.Data) < tcMsgLen {
+			continue
+		}
+
+		filter, err := unmarshalBPFFilter(reply.Data)
+		if err != nil {
+			return nil, fmt.Errorf("interface %d: %w", ifindex, err)
+		}
+		if filter != nil {
+			filters = append(filters, *filter)
+		}
+	}
+
+	return filters, nil
+}
+
+// unmarshalBPFFilter decodes a filter. Returns nil if the message doesn't
+// describe a cls_bpf filter with a program.
+func unmarshalBPFFilter(buf []byte) (*BPFFilter, error) {
+	filter := BPFFilter{
+		Handle:   internal.NativeEndian.Uint32(buf[8:]),
+		Priority: uint16(internal.NativeEndian.Uint32(buf[16:]) >> 16),
+	}
+
+	attrs, err := UnmarshalAttributes(buf[tcMsgLen:])
+	if err != nil {
+		return nil, err
+	}
+
+	var kind string
+	var opts []Attribute
+	for _, attr := range attrs {
+		switch attr.Type {
+		case TCA_KIND:
+			kind = attr.String()
+		case TCA_OPTIONS:
+			opts, err = attr.Nested()
+			if err != nil {
+				return nil, fmt.Errorf("filter %d: %w", filter.Handle, err)
+			}
+		}
+	}
+
+	// The kernel emits an entry without options for each priority.
+	if kind != "bpf" || opts == nil {
+		return nil, nil
+	}
+
+	for _, attr := range opts {
+		switch attr.Type {
+		case TCA_BPF_NAME:
+			filter.Name = attr.String()
+		case TCA_BPF_ID:
+			filter.ProgramID, err = attr.Uint32()
+		case TCA_BPF_FLAGS:
+			var flags uint32
+			flags, err = attr.Uint32()
+			filter.DirectAction = flags&TCA_BPF_FLAG_ACT_DIRECT != 0
+		}
+		if err != nil {
+			return nil, fmt.Errorf("filter %d: %w", filter.Handle, err)
+		}
+	}
+
+	if filter.ProgramID == 0 {
+		return nil, nil
+	}
+	return &filter, nil
+}
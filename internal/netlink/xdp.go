@@ -0,0 +1,140 @@
+package netlink
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cilium/ebpf/internal"
+)
+
+// Interface attributes, see <linux/if_link.h>.
+const (
+	IFLA_IFNAME = 3
+	IFLA_XDP    = 43
+
+	IFLA_XDP_FD          = 1
+	IFLA_XDP_ATTACHED    = 2
+	IFLA_XDP_FLAGS       = 3
+	IFLA_XDP_PROG_ID     = 4
+	IFLA_XDP_DRV_PROG_ID = 5
+	IFLA_XDP_SKB_PROG_ID = 6
+	IFLA_XDP_HW_PROG_ID  = 7
+	IFLA_XDP_EXPECTED_FD = 8
+)
+
+// XDP attach flags, see <linux/if_link.h>.
+const (
+	XDP_FLAGS_UPDATE_IF_NOEXIST = 1 << 0
+	XDP_FLAGS_REPLACE           = 1 << 4
+)
+
+// ifInfomsgLen is the size of struct ifinfomsg.
+const ifInfomsgLen = 16
+
+func marshalIfInfomsg(ifindex int, attrs ...Attribute) []byte {
+	buf := make([]byte, ifInfomsgLen)
+	buf[0] = 0 // AF_UNSPEC
+	internal.NativeEndian.PutUint32(buf[4:], uint32(ifindex))
+	return append(buf, MarshalAttributes(attrs)...)
+}
+
+// SetXDPOptions control SetXDP.
+type SetXDPOptions struct {
+	// The file descriptor of the program to attach, or -1 to detach.
+	FD int
+	// The program which must currently be attached, or -1 to require that
+	// no program is attached. Ignored unless Flags has XDP_FLAGS_REPLACE.
+	ExpectedFD int
+	Flags      uint32
+}
+
+// SetXDP attaches or detaches an XDP program from an interface.
+func (c *Conn) SetXDP(ifindex int, opts SetXDPOptions) error {
+	attrs := []Attribute{
+		Uint32Attribute(IFLA_XDP_FD, uint32(opts.FD)),
+		Uint32Attribute(IFLA_XDP_FLAGS, opts.Flags),
+	}
+	if opts.Flags&XDP_FLAGS_REPLACE != 0 {
+		attrs = append(attrs, Uint32Attribute(IFLA_XDP_EXPECTED_FD, uint32(opts.ExpectedFD)))
+	}
+
+	_, err := c.Execute(Message{
+		Type: RTM_SETLINK,
+		Data: marshalIfInfomsg(ifindex, NestedAttribute(IFLA_XDP, attrs...)),
+	})
+	if err != nil {
+		return fmt.Errorf("set XDP program of interface %d: %w", ifindex, err)
+	}
+	return nil
+}
+
+// XDPInfo describes the XDP programs attached to an interface.
+type XDPInfo struct {
+	// One of the XDP_ATTACHED_* values from <linux/if_link.h>.
+	Attached uint8
+	// The program ID if a single program is attached.
+	ProgramID uint32
+	// Program IDs per attach mode.
+	DriverProgramID  uint32
+	GenericProgramID uint32
+	OffloadProgramID uint32
+}
+
+// XDP returns information about the XDP programs attached to an interface.
+func (c *Conn) XDP(ifindex int) (*XDPInfo, error) {
+	replies, err := c.Execute(Message{
+		Type: RTM_GETLINK,
+		Data: marshalIfInfomsg(ifindex),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get interface %d: %w", ifindex, err)
+	}
+
+	for _, reply := range replies {
+		if reply.Type != RTM_NEWLINK || len(reply.Data) < ifInfomsgLen {
+			continue
+		}
+
+		attrs, err := UnmarshalAttributes(reply.Data[ifInfomsgLen:])
+		if err != nil {
+			return nil, fmt.Errorf("interface %d: %w", ifindex, err)
+		}
+
+		var info XDPInfo
+		for _, attr := range attrs {
+			if attr.Type != IFLA_XDP {
+				continue
+			}
+
+			nested, err := attr.Nested()
+			if err != nil {
+				return nil, fmt.Errorf("interface %d: XDP: %w", ifindex, err)
+			}
+
+			for _, attr := range nested {
+				var dst *uint32
+				switch attr.Type {
+				case IFLA_XDP_ATTACHED:
+					info.Attached, err = attr.Uint8()
+				case IFLA_XDP_PROG_ID:
+					dst = &info.ProgramID
+				case IFLA_XDP_DRV_PROG_ID:
+					dst = &info.DriverProgramID
+				case IFLA_XDP_SKB_PROG_ID:
+					dst = &info.GenericProgramID
+				case IFLA_XDP_HW_PROG_ID:
+					dst = &info.OffloadProgramID
+				}
+				if dst != nil {
+					*dst, err = attr.Uint32()
+				}
+				if err != nil {
+					return nil, fmt.Errorf("interface %d: XDP: %w", ifindex, err)
+				}
+			}
+		}
+		return &info, nil
+	}
+
+	return nil, errors.New("no reply from kernel")
+}
@@ -1,9 +1,13 @@
 package internal
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/cilium/ebpf/internal/unix"
 )
@@ -42,3 +46,107 @@ func Unpin(pinnedPath string) error {
 	}
 	return err
 }
+
+const bpfFSType = 0xcafe4a11
+
+// DefaultBPFFSPath is where the BPF filesystem is conventionally mounted.
+const DefaultBPFFSPath = "/sys/fs/bpf"
+
+// IsBPFFS returns true if path is located on a BPF filesystem.
+func IsBPFFS(path string) (bool, error) {
+	var statfs unix.Statfs_t
+	if err := unix.Statfs(path, &statfs); err != nil {
+		return false, &os.PathError{Op: "statfs", Path: path, Err: err}
+	}
+	return uint64(statfs.Type) == bpfFSType, nil
+}
+
+// CheckBPFFSPath returns an error if fileName can't be used to pin an object.
+//
+// The parent directory of fileName must exist and be on a BPF filesystem.
+func CheckBPFFSPath(fileName string) error {
+	dirName := filepath.Dir(fileName)
+	ok, err := IsBPFFS(dirName)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("pin %s: directory %s doesn't exist, create it first: %w", fileName, dirName, err)
+	}
+	if err != nil {
+		return fmt.Errorf("pin %s: %w", fileName, err)
+	}
+	if !ok {
+		return fmt.Errorf("%s is not on a bpf filesystem, mount one using 'mount -t bpf bpf %s'", fileName, DefaultBPFFSPath)
+	}
+	return nil
+}
+
+// FindBPFFS returns the mount point of a BPF filesystem.
+//
+// DefaultBPFFSPath is preferred if there are multiple mounts. Returns an error
+// wrapping os.ErrNotExist if no BPF filesystem is mounted.
+func FindBPFFS() (string, error) {
+	if ok, _ := IsBPFFS(DefaultBPFFSPath); ok {
+		return DefaultBPFFSPath, nil
+	}
+
+	f, err := os.Open("/proc/self/mounts")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	mounts, err := bpfFSMounts(f)
+	if err != nil {
+		return "", fmt.Errorf("read mounts: %w", err)
+	}
+
+	for _, mount := range mounts {
+		if ok, _ := IsBPFFS(mount); ok {
+			return mount, nil
+		}
+	}
+
+	return "", fmt.Errorf("no bpf filesystem mounted, mount one using 'mount -t bpf bpf %s': %w", DefaultBPFFSPath, os.ErrNotExist)
+}
+
+// mountPathReplacer undoes the octal escaping applied to /proc/self/mounts.
+var mountPathReplacer = strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`)
+
+// bpfFSMounts returns the mount points of all bpf filesystems listed in r,
+// which must be in the format of /proc/self/mounts.
+func bpfFSMounts(r io.Reader) ([]string, error) {
+	var mounts []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		if fields[2] != "bpf" {
+			continue
+		}
+		mounts = append(mounts, mountPathReplacer.Replace(fields[1]))
+	}
+	return mounts, scanner.Err()
+}
+
+// MountBPFFS mounts a BPF filesystem at path, creating the directory if
+// necessary.
+//
+// It is not an error if path already is on a BPF filesystem.
+func MountBPFFS(path string) error {
+	if ok, _ := IsBPFFS(path); ok {
+		return nil
+	}
+
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return fmt.Errorf("create mount point: %w", err)
+	}
+
+	if err := unix.Mount("bpf", path, "bpf", 0, "mode=0700"); err != nil {
+		if errors.Is(err, unix.EPERM) {
+			return fmt.Errorf("mount bpf filesystem at %s: %w (requires CAP_SYS_ADMIN)", path, err)
+		}
+		return fmt.Errorf("mount bpf filesystem at %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBPFFSMounts(t *testing.T) {
+	const mounts = `sysfs /sys sysfs rw,nosuid,nodev,noexec,relatime 0 0
+bpf /sys/fs/bpf bpf rw,nosuid,nodev,noexec,relatime,mode=700 0 0
+tmpfs /run tmpfs rw,nosuid,nodev,mode=755 0 0
+bpf /run/my\040bpf bpf rw,relatime 0 0
+`
+
+	paths, err := bpfFSMounts(strings.NewReader(mounts))
+	if err != nil {
+		t.Fatal("Can't parse mounts:", err)
+	}
+
+	if len(paths) != 2 {
+		t.Fatalf("Expected two mounts, got %v", paths)
+	}
+	if paths[0] != "/sys/fs/bpf" {
+		t.Error("First mount is", paths[0])
+	}
+	if paths[1] != "/run/my bpf" {
+		t.Error("Escaped mount is", paths[1])
+	}
+}
@@ -1,9 +1,12 @@
 package internal
 
 import (
+	"errors"
 	"fmt"
-	"path/filepath"
 	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
 	"unsafe"
 
 	"github.com/cilium/ebpf/internal/unix"
@@ -50,12 +53,18 @@ const (
 	BPF_LINK_GET_NEXT_ID
 	BPF_ENABLE_STATS
 	BPF_ITER_CREATE
+	BPF_LINK_DETACH
+	BPF_PROG_BIND_MAP
 )
 
-// BPF wraps SYS_BPF.
-//
-// Any pointers contained in attr must use the Pointer type from this package.
-func BPF(cmd BPFCmd, attr unsafe.Pointer, size uintptr) (uintptr, error) {
+// Syscaller executes the bpf syscall.
+type Syscaller interface {
+	BPF(cmd BPFCmd, attr unsafe.Pointer, size uintptr) (uintptr, error)
+}
+
+type kernelSyscaller struct{}
+
+func (kernelSyscaller) BPF(cmd BPFCmd, attr unsafe.Pointer, size uintptr) (uintptr, error) {
 	r1, _, errNo := unix.Syscall(unix.SYS_BPF, uintptr(cmd), uintptr(attr), size)
 	runtime.KeepAlive(attr)
 
@@ -67,6 +76,147 @@ func BPF(cmd BPFCmd, attr unsafe.Pointer, size uintptr) (uintptr, error) {
 	return r1, err
 }
 
+// KernelSyscaller invokes the bpf syscall of the running kernel.
+var KernelSyscaller Syscaller = kernelSyscaller{}
+
+type syscallerValue struct{ Syscaller }
+
+var (
+	syscaller      atomic.Value
+	syscallerMutex sync.Mutex
+)
+
+func init() {
+	syscaller.Store(syscallerValue{KernelSyscaller})
+}
+
+// SetSyscaller changes the implementation used by BPF and returns the
+// previous one.
+//
+// This is intended for tests which need to observe or script the
+// interaction with the kernel.
+func SetSyscaller(s Syscaller) Syscaller {
+	if s == nil {
+		s = KernelSyscaller
+	}
+
+	syscallerMutex.Lock()
+	defer syscallerMutex.Unlock()
+
+	old := syscaller.Load().(syscallerValue)
+	syscaller.Store(syscallerValue{s})
+	return old.Syscaller
+}
+
+// SyscallHook is called after every bpf syscall with a copy of the
+// attributes, the result and how long the syscall took.
+type SyscallHook func(cmd BPFCmd, attr []byte, ret uintptr, err error, duration time.Duration)
+
+type syscallHook struct {
+	hook SyscallHook
+}
+
+var syscallHooks atomic.Value
+
+// SetSyscallHook installs a hook which observes all invocations of BPF.
+// Pass nil to remove the hook.
+func SetSyscallHook(hook SyscallHook) {
+	syscallHooks.Store(syscallHook{hook})
+}
+
+// MaxSyscallRetries bounds how often BPF retries a syscall which was
+// interrupted by a signal.
+const MaxSyscallRetries = 64
+
+// maxAttrSize is the largest size of attributes accepted by BPF. The
+// kernel rejects anything larger than a page which isn't zero, but RawBPF
+// allows passing arbitrary sizes.
+const maxAttrSize = 1 << 30
+
+// BPF wraps SYS_BPF.
+//
+// Syscalls failing with EINTR are retried, except for BPF_PROG_TEST_RUN
+// which callers may want to reset first. BPF_PROG_LOAD is also retried
+// on EAGAIN, which the verifier returns since Linux 4.20 when it is
+// interrupted by a signal. The Go runtime sends signals frequently, for
+// example for preemption and profiling. After MaxSyscallRetries attempts
+// the last error is returned, wrapped.
+//
+// Any pointers contained in attr must use the Pointer type from this package.
+func BPF(cmd BPFCmd, attr unsafe.Pointer, size uintptr) (uintptr, error) {
+	if err := checkAttrSize(cmd, size); err != nil {
+		return 0, err
+	}
+
+	for i := 0; ; i++ {
+		ret, err := bpf(cmd, attr, size)
+		if err == nil || !interrupted(cmd, err) {
+			return ret, err
+		}
+
+		if i+1 >= MaxSyscallRetries {
+			return ret, fmt.Errorf("%s interrupted %d times: %w", cmd, i+1, err)
+		}
+	}
+}
+
+func checkAttrSize(cmd BPFCmd, size uintptr) error {
+	if size > maxAttrSize {
+		return fmt.Errorf("%s: attributes of %d bytes: %w", cmd, size, unix.E2BIG)
+	}
+	return nil
+}
+
+// CopyAttr returns a copy of the attributes of a syscall, for Syscallers
+// and hooks which record them. attr may be nil.
+//
+// Returns an error wrapping E2BIG if size exceeds the limit of BPF.
+func CopyAttr(cmd BPFCmd, attr unsafe.Pointer, size uintptr) ([]byte, error) {
+	if err := checkAttrSize(cmd, size); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, size)
+	if attr != nil {
+		copy(buf, (*[maxAttrSize]byte)(attr)[:size:size])
+	}
+	return buf, nil
+}
+
+// interrupted returns true if the syscall failed due to a signal and
+// should be retried.
+func interrupted(cmd BPFCmd, err error) bool {
+	switch {
+	case errors.Is(err, unix.EINTR):
+		return cmd != BPF_PROG_TEST_RUN
+	case errors.Is(err, unix.EAGAIN):
+		return cmd == BPF_PROG_LOAD
+	default:
+		return false
+	}
+}
+
+func bpf(cmd BPFCmd, attr unsafe.Pointer, size uintptr) (uintptr, error) {
+	sc := syscaller.Load().(syscallerValue)
+
+	sh, _ := syscallHooks.Load().(syscallHook)
+	if sh.hook == nil {
+		return sc.BPF(cmd, attr, size)
+	}
+
+	start := time.Now()
+	ret, err := sc.BPF(cmd, attr, size)
+	duration := time.Since(start)
+
+	buf, cerr := CopyAttr(cmd, attr, size)
+	if cerr != nil {
+		return ret, cerr
+	}
+
+	sh.hook(cmd, buf, ret, err, duration)
+	return ret, err
+}
+
 type BPFProgAttachAttr struct {
 	TargetFd     uint32
 	AttachBpfFd  uint32
@@ -110,18 +260,11 @@ type bpfObjAttr struct {
 	fileFlags uint32
 }
 
-const bpfFSType = 0xcafe4a11
-
 // BPFObjPin wraps BPF_OBJ_PIN.
 func BPFObjPin(fileName string, fd *FD) error {
-	dirName := filepath.Dir(fileName)
-	var statfs unix.Statfs_t
-	if err := unix.Statfs(dirName, &statfs); err != nil {
+	if err := CheckBPFFSPath(fileName); err != nil {
 		return err
 	}
-	if uint64(statfs.Type) != bpfFSType {
-		return fmt.Errorf("%s is not on a bpf filesystem", fileName)
-	}
 
 	value, err := fd.Value()
 	if err != nil {
@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+// failingSyscaller fails the first n calls with err.
+type failingSyscaller struct {
+	n     int
+	err   error
+	calls int
+}
+
+func (fs *failingSyscaller) BPF(cmd BPFCmd, attr unsafe.Pointer, size uintptr) (uintptr, error) {
+	fs.calls++
+	if fs.calls <= fs.n {
+		return 0, fs.err
+	}
+	return 42, nil
+}
+
+func TestBPFRetries(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		cmd   BPFCmd
+		err   error
+		n     int
+		calls int
+		fail  bool
+	}{
+		{"EINTR", BPF_MAP_CREATE, unix.EINTR, 3, 4, false},
+		{"EINTR test run", BPF_PROG_TEST_RUN, unix.EINTR, 1, 1, true},
+		{"EAGAIN prog load", BPF_PROG_LOAD, unix.EAGAIN, 2, 3, false},
+		{"EAGAIN map create", BPF_MAP_CREATE, unix.EAGAIN, 1, 1, true},
+		{"EINVAL", BPF_PROG_LOAD, unix.EINVAL, 1, 1, true},
+		{"bounded", BPF_MAP_LOOKUP_ELEM, unix.EINTR, MaxSyscallRetries + 1, MaxSyscallRetries, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fs := &failingSyscaller{n: test.n, err: test.err}
+			old := SetSyscaller(fs)
+			defer SetSyscaller(old)
+
+			ret, err := BPF(test.cmd, nil, 0)
+			if fs.calls != test.calls {
+				t.Errorf("Expected %d calls, got %d", test.calls, fs.calls)
+			}
+
+			if test.fail {
+				if !errors.Is(err, test.err) {
+					t.Errorf("Expected error %v, got %v", test.err, err)
+				}
+				return
+			}
+
+			if err != nil || ret != 42 {
+				t.Errorf("Expected result 42, got %d (%v)", ret, err)
+			}
+		})
+	}
+}
+
+func TestSyscallHookLargeAttr(t *testing.T) {
+	old := SetSyscaller(&failingSyscaller{})
+	defer SetSyscaller(old)
+
+	var got []byte
+	SetSyscallHook(func(cmd BPFCmd, attr []byte, ret uintptr, err error, duration time.Duration) {
+		got = attr
+	})
+	defer SetSyscallHook(nil)
+
+	attr := make([]byte, 70000)
+	attr[len(attr)-1] = 0xff
+	if _, err := BPF(BPF_PROG_LOAD, unsafe.Pointer(&attr[0]), uintptr(len(attr))); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != len(attr) || got[len(got)-1] != 0xff {
+		t.Errorf("Hook doesn't observe all %d bytes of the attributes", len(attr))
+	}
+}
+
+func TestCopyAttr(t *testing.T) {
+	attr := []byte{1, 2, 3}
+	buf, err := CopyAttr(BPF_PROG_LOAD, unsafe.Pointer(&attr[0]), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buf) != 2 || buf[0] != 1 || buf[1] != 2 {
+		t.Error("Unexpected copy:", buf)
+	}
+
+	if buf, err := CopyAttr(BPF_PROG_LOAD, nil, 4); err != nil || len(buf) != 4 {
+		t.Error("Can't copy nil attributes:", buf, err)
+	}
+
+	if _, err := CopyAttr(BPF_PROG_LOAD, nil, maxAttrSize+1); !errors.Is(err, unix.E2BIG) {
+		t.Error("Expected E2BIG for oversized attributes, got", err)
+	}
+}
@@ -0,0 +1,7 @@
+package testutils
+
+import "encoding/binary"
+
+// WrappedByteOrder is a binary.ByteOrder which isn't comparable to the
+// implementations in encoding/binary, like binary.NativeEndian.
+type WrappedByteOrder struct{ binary.ByteOrder }
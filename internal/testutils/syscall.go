@@ -0,0 +1,102 @@
+package testutils
+
+import (
+	"sync"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"github.com/cilium/ebpf/internal"
+)
+
+// Syscall is a bpf syscall observed by SyscallRecorder.
+type Syscall struct {
+	Cmd internal.BPFCmd
+	// A copy of the attributes passed to the syscall.
+	Attr []byte
+}
+
+// SyscallResult is the outcome of a scripted syscall.
+type SyscallResult struct {
+	Ret uintptr
+	Err error
+}
+
+// SyscallRecorder records bpf syscalls and returns scripted results.
+//
+// Commands without a scripted result are passed to the kernel.
+type SyscallRecorder struct {
+	mu      sync.Mutex
+	calls   []Syscall
+	results map[internal.BPFCmd][]SyscallResult
+	next    internal.Syscaller
+}
+
+// RecordSyscalls intercepts all bpf syscalls until the end of the test.
+func RecordSyscalls(tb testing.TB) *SyscallRecorder {
+	tb.Helper()
+
+	sr := &SyscallRecorder{
+		results: make(map[internal.BPFCmd][]SyscallResult),
+	}
+	sr.next = internal.SetSyscaller(sr)
+	tb.Cleanup(func() { internal.SetSyscaller(sr.next) })
+
+	return sr
+}
+
+// Return scripts the result of the next invocation of cmd.
+//
+// Calling Return multiple times queues results in order.
+func (sr *SyscallRecorder) Return(cmd internal.BPFCmd, ret uintptr, err error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	sr.results[cmd] = append(sr.results[cmd], SyscallResult{ret, err})
+}
+
+// Fail scripts the next invocation of cmd to return errno.
+func (sr *SyscallRecorder) Fail(cmd internal.BPFCmd, errno syscall.Errno) {
+	sr.Return(cmd, 0, errno)
+}
+
+// Calls returns all recorded syscalls.
+func (sr *SyscallRecorder) Calls() []Syscall {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	return append([]Syscall(nil), sr.calls...)
+}
+
+// CallsTo returns the recorded invocations of cmd.
+func (sr *SyscallRecorder) CallsTo(cmd internal.BPFCmd) []Syscall {
+	var calls []Syscall
+	for _, call := range sr.Calls() {
+		if call.Cmd == cmd {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// BPF implements internal.Syscaller.
+func (sr *SyscallRecorder) BPF(cmd internal.BPFCmd, attr unsafe.Pointer, size uintptr) (uintptr, error) {
+	buf, err := internal.CopyAttr(cmd, attr, size)
+	if err != nil {
+		return 0, err
+	}
+
+	sr.mu.Lock()
+	sr.calls = append(sr.calls, Syscall{cmd, buf})
+	results := sr.results[cmd]
+	if len(results) > 0 {
+		sr.results[cmd] = results[1:]
+	}
+	sr.mu.Unlock()
+
+	if len(results) > 0 {
+		return results[0].Ret, results[0].Err
+	}
+
+	return sr.next.BPF(cmd, attr, size)
+}
@@ -0,0 +1,40 @@
+// +build linux
+
+package unix
+
+import (
+	"unsafe"
+
+	linux "golang.org/x/sys/unix"
+)
+
+const (
+	PR_SET_NO_NEW_PRIVS = linux.PR_SET_NO_NEW_PRIVS
+	// Not defined by x/sys, see <linux/seccomp.h>.
+	SECCOMP_SET_MODE_FILTER = 0x1
+)
+
+// SockFilter is a wrapper
+type SockFilter = linux.SockFilter
+
+// Prctl is a wrapper
+func Prctl(option int, arg2 uintptr, arg3 uintptr, arg4 uintptr, arg5 uintptr) (err error) {
+	return linux.Prctl(option, arg2, arg3, arg4, arg5)
+}
+
+// SeccompSetModeFilter installs a seccomp filter.
+//
+// Returns the result of the syscall, which is the ID of a thread that
+// couldn't be synchronized if flags contains SECCOMP_FILTER_FLAG_TSYNC.
+func SeccompSetModeFilter(flags uint, filter []SockFilter) (int, error) {
+	prog := linux.SockFprog{Len: uint16(len(filter))}
+	if len(filter) > 0 {
+		prog.Filter = &filter[0]
+	}
+
+	r1, _, errNo := linux.Syscall(linux.SYS_SECCOMP, SECCOMP_SET_MODE_FILTER, uintptr(flags), uintptr(unsafe.Pointer(&prog)))
+	if errNo != 0 {
+		return 0, errNo
+	}
+	return int(r1), nil
+}
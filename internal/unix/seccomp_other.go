@@ -0,0 +1,26 @@
+// +build !linux
+
+package unix
+
+const (
+	PR_SET_NO_NEW_PRIVS     = 0x26
+	SECCOMP_SET_MODE_FILTER = 0x1
+)
+
+// SockFilter is a wrapper
+type SockFilter struct {
+	Code uint16
+	Jt   uint8
+	Jf   uint8
+	K    uint32
+}
+
+// Prctl is a wrapper
+func Prctl(option int, arg2 uintptr, arg3 uintptr, arg4 uintptr, arg5 uintptr) (err error) {
+	return errNonLinux
+}
+
+// SeccompSetModeFilter is a wrapper
+func SeccompSetModeFilter(flags uint, filter []SockFilter) (int, error) {
+	return 0, errNonLinux
+}
@@ -0,0 +1,67 @@
+// +build linux
+
+package unix
+
+import (
+	linux "golang.org/x/sys/unix"
+)
+
+const (
+	SOCK_RAW                 = linux.SOCK_RAW
+	SOCK_CLOEXEC             = linux.SOCK_CLOEXEC
+	ENOBUFS                  = linux.ENOBUFS
+	ENOPROTOOPT              = linux.ENOPROTOOPT
+	MSG_DONTWAIT             = linux.MSG_DONTWAIT
+	POLLIN                   = linux.POLLIN
+	POLLOUT                  = linux.POLLOUT
+	AF_NETLINK               = linux.AF_NETLINK
+	NETLINK_ROUTE            = linux.NETLINK_ROUTE
+	SOL_SOCKET               = linux.SOL_SOCKET
+	SO_REUSEPORT             = linux.SO_REUSEPORT
+	SO_ATTACH_REUSEPORT_EBPF = linux.SO_ATTACH_REUSEPORT_EBPF
+	SO_DETACH_REUSEPORT_BPF  = linux.SO_DETACH_REUSEPORT_BPF
+)
+
+// Sockaddr is a wrapper
+type Sockaddr = linux.Sockaddr
+
+// PollFd is a wrapper
+type PollFd = linux.PollFd
+
+// Socket is a wrapper
+func Socket(domain, typ, proto int) (fd int, err error) {
+	return linux.Socket(domain, typ, proto)
+}
+
+// Bind is a wrapper
+func Bind(fd int, sa Sockaddr) (err error) {
+	return linux.Bind(fd, sa)
+}
+
+// SendmsgN is a wrapper
+func SendmsgN(fd int, p, oob []byte, to Sockaddr, flags int) (n int, err error) {
+	return linux.SendmsgN(fd, p, oob, to, flags)
+}
+
+// Poll is a wrapper
+func Poll(fds []PollFd, timeout int) (n int, err error) {
+	return linux.Poll(fds, timeout)
+}
+
+// SetsockoptInt is a wrapper
+func SetsockoptInt(fd, level, opt int, value int) (err error) {
+	return linux.SetsockoptInt(fd, level, opt, value)
+}
+
+// SockaddrNetlink is a wrapper
+type SockaddrNetlink = linux.SockaddrNetlink
+
+// Sendto is a wrapper
+func Sendto(fd int, p []byte, flags int, to Sockaddr) (err error) {
+	return linux.Sendto(fd, p, flags, to)
+}
+
+// Recvfrom is a wrapper
+func Recvfrom(fd int, p []byte, flags int) (n int, from Sockaddr, err error) {
+	return linux.Recvfrom(fd, p, flags)
+}
@@ -0,0 +1,74 @@
+// +build !linux
+
+package unix
+
+import "syscall"
+
+const (
+	SOCK_RAW                 = 0x3
+	SOCK_CLOEXEC             = 0x80000
+	ENOBUFS                  = syscall.ENOBUFS
+	ENOPROTOOPT              = syscall.ENOPROTOOPT
+	MSG_DONTWAIT             = 0x40
+	POLLIN                   = 0x1
+	POLLOUT                  = 0x4
+	AF_NETLINK               = 0x10
+	NETLINK_ROUTE            = 0x0
+	SOL_SOCKET               = 0x1
+	SO_REUSEPORT             = 0xf
+	SO_ATTACH_REUSEPORT_EBPF = 0x34
+	SO_DETACH_REUSEPORT_BPF  = 0x44
+)
+
+// Sockaddr is a wrapper
+type Sockaddr interface{}
+
+// PollFd is a wrapper
+type PollFd struct {
+	Fd      int32
+	Events  int16
+	Revents int16
+}
+
+// Socket is a wrapper
+func Socket(domain, typ, proto int) (fd int, err error) {
+	return -1, errNonLinux
+}
+
+// Bind is a wrapper
+func Bind(fd int, sa Sockaddr) (err error) {
+	return errNonLinux
+}
+
+// SendmsgN is a wrapper
+func SendmsgN(fd int, p, oob []byte, to Sockaddr, flags int) (n int, err error) {
+	return 0, errNonLinux
+}
+
+// Poll is a wrapper
+func Poll(fds []PollFd, timeout int) (n int, err error) {
+	return 0, errNonLinux
+}
+
+// SetsockoptInt is a wrapper
+func SetsockoptInt(fd, level, opt int, value int) (err error) {
+	return errNonLinux
+}
+
+// SockaddrNetlink is a wrapper
+type SockaddrNetlink struct {
+	Family uint16
+	Pad    uint16
+	Pid    uint32
+	Groups uint32
+}
+
+// Sendto is a wrapper
+func Sendto(fd int, p []byte, flags int, to Sockaddr) (err error) {
+	return errNonLinux
+}
+
+// Recvfrom is a wrapper
+func Recvfrom(fd int, p []byte, flags int) (n int, from Sockaddr, err error) {
+	return 0, nil, errNonLinux
+}
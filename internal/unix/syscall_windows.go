@@ -0,0 +1,87 @@
+package unix
+
+import (
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// The bpf syscall is emulated by ebpfapi.dll of ebpf-for-windows, which
+// mimics the libbpf API. File descriptors are those of the C runtime.
+var (
+	ebpfapi   = syscall.NewLazyDLL("ebpfapi.dll")
+	procBPF   = ebpfapi.NewProc("bpf")
+	ucrtbase  = syscall.NewLazyDLL("ucrtbase.dll")
+	procErrno = ucrtbase.NewProc("_get_errno")
+	procDup   = ucrtbase.NewProc("_dup")
+	procClose = ucrtbase.NewProc("_close")
+)
+
+// crtCall invokes a C runtime function which reports errors via errno.
+func crtCall(proc *syscall.LazyProc, args ...uintptr) (int32, syscall.Errno) {
+	if err := proc.Find(); err != nil {
+		return -1, ENOTSUPP
+	}
+
+	// errno is thread local.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	r1, _, _ := proc.Call(args...)
+	ret := int32(r1)
+	if ret >= 0 {
+		return ret, 0
+	}
+
+	var errno int32
+	if r1, _, _ := procErrno.Call(uintptr(unsafe.Pointer(&errno))); r1 != 0 {
+		return ret, EINVAL
+	}
+
+	return ret, crtErrno(errno)
+}
+
+// Syscall is a wrapper
+//
+// Only SYS_BPF is supported, by calling into ebpfapi.dll. The attributes
+// are passed unchanged, see windowsCommands.
+func Syscall(trap, a1, a2, a3 uintptr) (r1, r2 uintptr, err syscall.Errno) {
+	if trap != SYS_BPF {
+		return 0, 0, syscall.Errno(1)
+	}
+
+	cmd, ok := WindowsCommand(a1)
+	if !ok {
+		return 0, 0, ENOTSUPP
+	}
+
+	ret, errno := crtCall(procBPF, cmd, a2, a3)
+	if errno != 0 {
+		return 0, 0, errno
+	}
+	return uintptr(ret), 0, 0
+}
+
+// FcntlInt is a wrapper
+//
+// Only F_DUPFD_CLOEXEC is supported. Descriptors of the C runtime are
+// never inherited by child processes created via package os.
+func FcntlInt(fd uintptr, cmd, arg int) (int, error) {
+	if cmd != F_DUPFD_CLOEXEC {
+		return -1, errNonLinux
+	}
+
+	ret, errno := crtCall(procDup, fd)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(ret), nil
+}
+
+// Close is a wrapper
+func Close(fd int) (err error) {
+	if _, errno := crtCall(procClose, uintptr(fd)); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -20,6 +20,10 @@ const (
 	EPERM  = syscall.EPERM
 	ESRCH  = syscall.ESRCH
 	ENODEV = syscall.ENODEV
+	EBUSY  = syscall.EBUSY
+	ESTALE = syscall.ESTALE
+	EACCES = syscall.EACCES
+	E2BIG  = syscall.E2BIG
 	EBADF  = syscall.Errno(0)
 	// ENOTSUPP is not the same as ENOTSUP or EOPNOTSUP
 	ENOTSUPP = syscall.Errno(0x20c)
@@ -31,6 +35,7 @@ const (
 	BPF_F_RDONLY_PROG        = 0
 	BPF_F_WRONLY_PROG        = 0
 	BPF_F_SLEEPABLE          = 0
+	BPF_F_XDP_HAS_FRAGS      = 0
 	BPF_OBJ_NAME_LEN         = 0x10
 	BPF_TAG_SIZE             = 0x8
 	SYS_BPF                  = 321
@@ -50,6 +55,7 @@ const (
 	PERF_EVENT_IOC_ENABLE    = 0
 	PERF_EVENT_IOC_SET_BPF   = 0
 	PerfBitWatermark         = 0x4000
+	PerfBitWriteBackward     = 0x8000000
 	PERF_SAMPLE_RAW          = 0x400
 	PERF_FLAG_FD_CLOEXEC     = 0x8
 	RLIM_INFINITY            = 0x7fffffffffffffff
@@ -88,14 +94,9 @@ func Setrlimit(resource int, rlim *Rlimit) (err error) {
 	return errNonLinux
 }
 
-// Syscall is a wrapper
-func Syscall(trap, a1, a2, a3 uintptr) (r1, r2 uintptr, err syscall.Errno) {
-	return 0, 0, syscall.Errno(1)
-}
-
-// FcntlInt is a wrapper
-func FcntlInt(fd uintptr, cmd, arg int) (int, error) {
-	return -1, errNonLinux
+// ErrnoName is a wrapper
+func ErrnoName(errno syscall.Errno) string {
+	return ""
 }
 
 // IoctlSetInt is a wrapper
@@ -108,11 +109,6 @@ func Statfs(path string, buf *Statfs_t) error {
 	return errNonLinux
 }
 
-// Close is a wrapper
-func Close(fd int) (err error) {
-	return errNonLinux
-}
-
 // EpollEvent is a wrapper
 type EpollEvent struct {
 	Events uint32
@@ -135,6 +131,11 @@ func Eventfd(initval uint, flags int) (fd int, err error) {
 	return 0, errNonLinux
 }
 
+// Read is a wrapper
+func Read(fd int, p []byte) (n int, err error) {
+	return 0, errNonLinux
+}
+
 // Write is a wrapper
 func Write(fd int, p []byte) (n int, err error) {
 	return 0, errNonLinux
@@ -255,6 +256,11 @@ func Renameat2(olddirfd int, oldpath string, newdirfd int, newpath string, flags
 	return errNonLinux
 }
 
+// Mount is a wrapper
+func Mount(source string, target string, fstype string, flags uintptr, data string) (err error) {
+	return errNonLinux
+}
+
 func KernelRelease() (string, error) {
 	return "", errNonLinux
 }
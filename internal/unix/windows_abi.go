@@ -0,0 +1,72 @@
+package unix
+
+import "syscall"
+
+// The tables in this file describe the ABI of ebpf-for-windows. They are
+// kept out of syscall_windows.go so that they can be tested on any
+// platform.
+
+// windowsCommands maps Linux bpf commands to the bpf_cmd_id of
+// ebpf-for-windows, which only implements a subset of them in a
+// different order.
+//
+// Only the command is translated. ebpf-for-windows declares union bpf_attr
+// with the same leading fields as Linux for these commands, but numbers
+// map and program types differently: BPF_PROG_TYPE_XDP is 1 instead of 6,
+// for example. Callers have to use the values of ebpf-for-windows, and
+// fields which only exist on Linux must be zero.
+var windowsCommands = map[uintptr]uintptr{
+	0:  0,  // BPF_MAP_CREATE
+	1:  1,  // BPF_MAP_LOOKUP_ELEM
+	2:  2,  // BPF_MAP_UPDATE_ELEM
+	3:  3,  // BPF_MAP_DELETE_ELEM
+	4:  4,  // BPF_MAP_GET_NEXT_KEY
+	5:  5,  // BPF_PROG_LOAD
+	6:  6,  // BPF_OBJ_PIN
+	7:  7,  // BPF_OBJ_GET
+	11: 8,  // BPF_PROG_GET_NEXT_ID
+	12: 9,  // BPF_MAP_GET_NEXT_ID
+	31: 10, // BPF_LINK_GET_NEXT_ID
+	13: 11, // BPF_PROG_GET_FD_BY_ID
+	14: 12, // BPF_MAP_GET_FD_BY_ID
+	30: 13, // BPF_LINK_GET_FD_BY_ID
+	15: 14, // BPF_OBJ_GET_INFO_BY_FD
+	34: 15, // BPF_LINK_DETACH
+	35: 16, // BPF_PROG_BIND_MAP
+	10: 17, // BPF_PROG_TEST_RUN
+}
+
+// crtErrnos maps errno values of the C runtime to the invented Errno
+// values of package syscall, so that comparisons with the constants in
+// this package work.
+var crtErrnos = map[uintptr]syscall.Errno{
+	1:   EPERM,
+	2:   ENOENT,
+	3:   ESRCH,
+	4:   EINTR,
+	7:   E2BIG,
+	11:  EAGAIN,
+	13:  EACCES,
+	16:  EBUSY,
+	17:  EEXIST,
+	19:  ENODEV,
+	22:  EINVAL,
+	28:  ENOSPC,
+	129: ENOTSUPP, // ENOTSUP
+	130: ENOTSUPP, // EOPNOTSUPP
+}
+
+// WindowsCommand translates a Linux bpf command to the bpf_cmd_id of
+// ebpf-for-windows. Returns false if the command isn't available.
+func WindowsCommand(cmd uintptr) (uintptr, bool) {
+	id, ok := windowsCommands[cmd]
+	return id, ok
+}
+
+// crtErrno translates an errno of the C runtime.
+func crtErrno(errno int32) syscall.Errno {
+	if mapped, ok := crtErrnos[uintptr(errno)]; ok {
+		return mapped
+	}
+	return syscall.Errno(errno)
+}
@@ -0,0 +1,28 @@
+package unix
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestCRTErrno(t *testing.T) {
+	// Values from errno.h of the Universal C Runtime.
+	for _, tc := range []struct {
+		crt  int32
+		want syscall.Errno
+	}{
+		{1, EPERM},
+		{2, ENOENT},
+		{7, E2BIG},
+		{11, EAGAIN},
+		{16, EBUSY},
+		{22, EINVAL},
+		{129, ENOTSUPP},
+		{130, ENOTSUPP},
+		{1000, syscall.Errno(1000)},
+	} {
+		if got := crtErrno(tc.crt); got != tc.want {
+			t.Errorf("errno %d maps to %d instead of %d", tc.crt, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// +build linux
+
+package unix
+
+import (
+	"unsafe"
+
+	linux "golang.org/x/sys/unix"
+)
+
+const (
+	AF_XDP                         = linux.AF_XDP
+	SOL_XDP                        = linux.SOL_XDP
+	MAP_PRIVATE                    = linux.MAP_PRIVATE
+	MAP_ANONYMOUS                  = linux.MAP_ANONYMOUS
+	MAP_POPULATE                   = linux.MAP_POPULATE
+	XDP_MMAP_OFFSETS               = linux.XDP_MMAP_OFFSETS
+	XDP_RX_RING                    = linux.XDP_RX_RING
+	XDP_TX_RING                    = linux.XDP_TX_RING
+	XDP_UMEM_REG                   = linux.XDP_UMEM_REG
+	XDP_UMEM_FILL_RING             = linux.XDP_UMEM_FILL_RING
+	XDP_UMEM_COMPLETION_RING       = linux.XDP_UMEM_COMPLETION_RING
+	XDP_STATISTICS                 = linux.XDP_STATISTICS
+	XDP_PGOFF_RX_RING              = linux.XDP_PGOFF_RX_RING
+	XDP_PGOFF_TX_RING              = linux.XDP_PGOFF_TX_RING
+	XDP_UMEM_PGOFF_FILL_RING       = linux.XDP_UMEM_PGOFF_FILL_RING
+	XDP_UMEM_PGOFF_COMPLETION_RING = linux.XDP_UMEM_PGOFF_COMPLETION_RING
+	XDP_SHARED_UMEM                = linux.XDP_SHARED_UMEM
+	XDP_COPY                       = linux.XDP_COPY
+	XDP_ZEROCOPY                   = linux.XDP_ZEROCOPY
+	XDP_USE_NEED_WAKEUP            = linux.XDP_USE_NEED_WAKEUP
+	XDP_RING_NEED_WAKEUP           = linux.XDP_RING_NEED_WAKEUP
+)
+
+// SockaddrXDP is a wrapper
+type SockaddrXDP = linux.SockaddrXDP
+
+// XDPRingOffset is a wrapper
+type XDPRingOffset = linux.XDPRingOffset
+
+// XDPMmapOffsets is a wrapper
+type XDPMmapOffsets = linux.XDPMmapOffsets
+
+// XDPStatistics is a wrapper
+type XDPStatistics = linux.XDPStatistics
+
+// XDPDesc is a wrapper
+type XDPDesc = linux.XDPDesc
+
+// XDPUmemReg must match struct xdp_umem_reg in <linux/if_xdp.h>.
+type XDPUmemReg struct {
+	Addr     uint64
+	Len      uint64
+	Size     uint32
+	Headroom uint32
+	Flags    uint32
+	_        uint32
+}
+
+// SetsockoptXDPUmemReg registers an UMEM with an AF_XDP socket.
+func SetsockoptXDPUmemReg(fd int, reg *XDPUmemReg) error {
+	_, _, errNo := linux.Syscall6(linux.SYS_SETSOCKOPT, uintptr(fd), SOL_XDP, XDP_UMEM_REG,
+		uintptr(unsafe.Pointer(reg)), unsafe.Sizeof(*reg), 0)
+	if errNo != 0 {
+		return errNo
+	}
+	return nil
+}
+
+// GetsockoptXDPMmapOffsets returns the offsets of the rings of an AF_XDP socket.
+func GetsockoptXDPMmapOffsets(fd int) (*XDPMmapOffsets, error) {
+	var offsets XDPMmapOffsets
+	if err := getsockopt(fd, SOL_XDP, XDP_MMAP_OFFSETS, unsafe.Pointer(&offsets), unsafe.Sizeof(offsets)); err != nil {
+		return nil, err
+	}
+	return &offsets, nil
+}
+
+// GetsockoptXDPStatistics returns the statistics of an AF_XDP socket.
+func GetsockoptXDPStatistics(fd int) (*XDPStatistics, error) {
+	var stats XDPStatistics
+	if err := getsockopt(fd, SOL_XDP, XDP_STATISTICS, unsafe.Pointer(&stats), unsafe.Sizeof(stats)); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+func getsockopt(fd, level, opt int, value unsafe.Pointer, size uintptr) error {
+	length := uint32(size)
+	_, _, errNo := linux.Syscall6(linux.SYS_GETSOCKOPT, uintptr(fd), uintptr(level), uintptr(opt),
+		uintptr(value), uintptr(unsafe.Pointer(&length)), 0)
+	if errNo != 0 {
+		return errNo
+	}
+	return nil
+}
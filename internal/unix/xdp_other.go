@@ -0,0 +1,93 @@
+// +build !linux
+
+package unix
+
+const (
+	AF_XDP                         = 0x2c
+	SOL_XDP                        = 0x11b
+	MAP_PRIVATE                    = 0x2
+	MAP_ANONYMOUS                  = 0x20
+	MAP_POPULATE                   = 0x8000
+	XDP_MMAP_OFFSETS               = 0x1
+	XDP_RX_RING                    = 0x2
+	XDP_TX_RING                    = 0x3
+	XDP_UMEM_REG                   = 0x4
+	XDP_UMEM_FILL_RING             = 0x5
+	XDP_UMEM_COMPLETION_RING       = 0x6
+	XDP_STATISTICS                 = 0x7
+	XDP_PGOFF_RX_RING              = 0
+	XDP_PGOFF_TX_RING              = 0x80000000
+	XDP_UMEM_PGOFF_FILL_RING       = 0x100000000
+	XDP_UMEM_PGOFF_COMPLETION_RING = 0x180000000
+	XDP_SHARED_UMEM                = 0x1
+	XDP_COPY                       = 0x2
+	XDP_ZEROCOPY                   = 0x4
+	XDP_USE_NEED_WAKEUP            = 0x8
+	XDP_RING_NEED_WAKEUP           = 0x1
+)
+
+// SockaddrXDP is a wrapper
+type SockaddrXDP struct {
+	Flags        uint16
+	Ifindex      uint32
+	QueueID      uint32
+	SharedUmemFD uint32
+}
+
+// XDPRingOffset is a wrapper
+type XDPRingOffset struct {
+	Producer uint64
+	Consumer uint64
+	Desc     uint64
+	Flags    uint64
+}
+
+// XDPMmapOffsets is a wrapper
+type XDPMmapOffsets struct {
+	Rx XDPRingOffset
+	Tx XDPRingOffset
+	Fr XDPRingOffset
+	Cr XDPRingOffset
+}
+
+// XDPStatistics is a wrapper
+type XDPStatistics struct {
+	Rx_dropped               uint64
+	Rx_invalid_descs         uint64
+	Tx_invalid_descs         uint64
+	Rx_ring_full             uint64
+	Rx_fill_ring_empty_descs uint64
+	Tx_ring_empty_descs      uint64
+}
+
+// XDPDesc is a wrapper
+type XDPDesc struct {
+	Addr    uint64
+	Len     uint32
+	Options uint32
+}
+
+// XDPUmemReg must match struct xdp_umem_reg in <linux/if_xdp.h>.
+type XDPUmemReg struct {
+	Addr     uint64
+	Len      uint64
+	Size     uint32
+	Headroom uint32
+	Flags    uint32
+	_        uint32
+}
+
+// SetsockoptXDPUmemReg registers an UMEM with an AF_XDP socket.
+func SetsockoptXDPUmemReg(fd int, reg *XDPUmemReg) error {
+	return errNonLinux
+}
+
+// GetsockoptXDPMmapOffsets returns the offsets of the rings of an AF_XDP socket.
+func GetsockoptXDPMmapOffsets(fd int) (*XDPMmapOffsets, error) {
+	return nil, errNonLinux
+}
+
+// GetsockoptXDPStatistics returns the statistics of an AF_XDP socket.
+func GetsockoptXDPStatistics(fd int) (*XDPStatistics, error) {
+	return nil, errNonLinux
+}
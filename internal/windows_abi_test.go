@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+// windowsCommandIDs is enum bpf_cmd_id from include/ebpf_structs.h of
+// ebpf-for-windows, in order.
+var windowsCommandIDs = []string{
+	"BPF_MAP_CREATE",
+	"BPF_MAP_LOOKUP_ELEM",
+	"BPF_MAP_UPDATE_ELEM",
+	"BPF_MAP_DELETE_ELEM",
+	"BPF_MAP_GET_NEXT_KEY",
+	"BPF_PROG_LOAD",
+	"BPF_OBJ_PIN",
+	"BPF_OBJ_GET",
+	"BPF_PROG_GET_NEXT_ID",
+	"BPF_MAP_GET_NEXT_ID",
+	"BPF_LINK_GET_NEXT_ID",
+	"BPF_PROG_GET_FD_BY_ID",
+	"BPF_MAP_GET_FD_BY_ID",
+	"BPF_LINK_GET_FD_BY_ID",
+	"BPF_OBJ_GET_INFO_BY_FD",
+	"BPF_LINK_DETACH",
+	"BPF_PROG_BIND_MAP",
+	"BPF_PROG_TEST_RUN",
+}
+
+func TestWindowsCommands(t *testing.T) {
+	ids := make(map[string]uintptr)
+	for i, name := range windowsCommandIDs {
+		ids[name] = uintptr(i)
+	}
+
+	for cmd := BPF_MAP_CREATE; cmd <= BPF_PROG_BIND_MAP; cmd++ {
+		want, supported := ids[cmd.String()]
+		delete(ids, cmd.String())
+
+		have, ok := unix.WindowsCommand(uintptr(cmd))
+		if ok != supported {
+			t.Errorf("%s: expected supported to be %t", cmd, supported)
+			continue
+		}
+		if ok && have != want {
+			t.Errorf("%s: expected id %d, got %d", cmd, want, have)
+		}
+	}
+
+	for name := range ids {
+		t.Errorf("%s has no Linux equivalent", name)
+	}
+}
@@ -0,0 +1,322 @@
+// Package kallsyms resolves kernel addresses to symbols.
+//
+// The kernel exports the addresses of its symbols via /proc/kallsyms. This
+// allows rendering kernel stack traces and kprobe addresses as
+// symbol+offset.
+package kallsyms
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	kallsymsPath = "/proc/kallsyms"
+	modulesPath  = "/proc/modules"
+)
+
+// ErrRestricted is returned if the kernel hides symbol addresses.
+//
+// This happens when kernel.kptr_restrict is set and the caller lacks
+// CAP_SYSLOG.
+var ErrRestricted = errors.New("symbol addresses are hidden, check kernel.kptr_restrict")
+
+// Symbol is a function in the kernel or in a kernel module.
+type Symbol struct {
+	Address uint64
+	Name    string
+	// Module is empty for symbols of the kernel image. BPF programs are
+	// listed with module "bpf".
+	Module string
+}
+
+func (s Symbol) String() string {
+	if s.Module == "" {
+		return s.Name
+	}
+	return fmt.Sprintf("%s [%s]", s.Name, s.Module)
+}
+
+// Symbols is a snapshot of the kernel's symbol table.
+type Symbols struct {
+	// Sorted by Address.
+	symbols []Symbol
+	// ends holds the address following each symbol, which is the start
+	// of the next symbol of any type.
+	ends []uint64
+}
+
+// Load reads the symbols of the running kernel.
+//
+// Returns ErrRestricted if the addresses are hidden.
+func Load() (*Symbols, error) {
+	f, err := os.Open(kallsymsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Parse(f)
+}
+
+// Parse reads symbols in the format of /proc/kallsyms.
+//
+// Only symbols in text sections are retained, since only these can appear
+// in stack traces.
+func Parse(r io.Reader) (*Symbols, error) {
+	var (
+		symbols []Symbol
+		// The addresses of all symbols, which bound text symbols.
+		bounds  []uint64
+		hidden  = true
+		scanner = bufio.NewScanner(r)
+	)
+
+	for scanner.Scan() {
+		// Lines are formatted as "address type name\t[module]".
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("invalid line %q", scanner.Text())
+		}
+
+		addr, err := strconv.ParseUint(fields[0], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address in line %q: %w", scanner.Text(), err)
+		}
+
+		if addr != 0 {
+			hidden = false
+		}
+		bounds = append(bounds, addr)
+
+		switch fields[1] {
+		case "t", "T", "w", "W":
+		default:
+			continue
+		}
+
+		sym := Symbol{Address: addr, Name: fields[2]}
+		if len(fields) > 3 {
+			sym.Module = strings.Trim(fields[3], "[]")
+		}
+
+		symbols = append(symbols, sym)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(symbols) > 0 && hidden {
+		return nil, ErrRestricted
+	}
+
+	sort.SliceStable(symbols, func(i, j int) bool {
+		return symbols[i].Address < symbols[j].Address
+	})
+	sort.Slice(bounds, func(i, j int) bool { return bounds[i] < bounds[j] })
+
+	ends := make([]uint64, len(symbols))
+	for i, sym := range symbols {
+		j := sort.Search(len(bounds), func(j int) bool {
+			return bounds[j] > sym.Address
+		})
+		if j < len(bounds) {
+			ends[i] = bounds[j]
+		} else {
+			// The size of the last symbol is unknown.
+			ends[i] = sym.Address + 1
+		}
+	}
+
+	return &Symbols{symbols, ends}, nil
+}
+
+// Lookup finds the symbol which contains addr, and the offset of addr from
+// the start of the symbol.
+//
+// Symbols are assumed to extend up to the next symbol in the table, of any
+// type. Returns false if addr is below the lowest known symbol, or isn't
+// covered by a function. Only the start of the highest symbol can be
+// resolved, since its size is unknown.
+func (s *Symbols) Lookup(addr uint64) (Symbol, uint64, bool) {
+	i := sort.Search(len(s.symbols), func(i int) bool {
+		return s.symbols[i].Address > addr
+	})
+	if i == 0 || addr >= s.ends[i-1] {
+		return Symbol{}, 0, false
+	}
+
+	// Multiple symbols may share an address, prefer the first one.
+	sym := s.symbols[i-1]
+	for i > 1 && s.symbols[i-2].Address == sym.Address {
+		i--
+		sym = s.symbols[i-1]
+	}
+
+	return sym, addr - sym.Address, true
+}
+
+// Format renders addr as symbol+offset.
+//
+// Addresses which can't be resolved are rendered in hex.
+func (s *Symbols) Format(addr uint64) string {
+	return format(s, addr)
+}
+
+// Address returns the address of the first symbol with the given name.
+func (s *Symbols) Address(name string) (uint64, bool) {
+	for _, sym := range s.symbols {
+		if sym.Name == name {
+			return sym.Address, true
+		}
+	}
+	return 0, false
+}
+
+type lookuper interface {
+	Lookup(addr uint64) (Symbol, uint64, bool)
+}
+
+func format(l lookuper, addr uint64) string {
+	sym, offset, ok := l.Lookup(addr)
+	if !ok {
+		return fmt.Sprintf("%#x", addr)
+	}
+
+	name := sym.Name
+	if offset != 0 {
+		name = fmt.Sprintf("%s+%#x", name, offset)
+	}
+	if sym.Module != "" {
+		name = fmt.Sprintf("%s [%s]", name, sym.Module)
+	}
+	return name
+}
+
+// Resolver resolves addresses using the symbols of the running kernel.
+//
+// The symbol table is loaded on first use, and reloaded lazily when the
+// set of loaded kernel modules changes. Symbols of BPF programs loaded
+// after the last reload are only picked up by calling Reload.
+//
+// It is safe to use a Resolver from multiple goroutines.
+type Resolver struct {
+	// How often to check whether modules have changed. Defaults to one
+	// second.
+	CheckInterval time.Duration
+
+	mu        sync.Mutex
+	symbols   *Symbols
+	modules   string
+	lastCheck time.Time
+}
+
+// Lookup finds the symbol which contains addr, and the offset of addr from
+// the start of the symbol.
+//
+// Returns false if the symbol table can't be loaded.
+func (r *Resolver) Lookup(addr uint64) (Symbol, uint64, bool) {
+	symbols, err := r.Symbols()
+	if err != nil {
+		return Symbol{}, 0, false
+	}
+	return symbols.Lookup(addr)
+}
+
+// Format renders addr as symbol+offset.
+//
+// Addresses which can't be resolved are rendered in hex.
+func (r *Resolver) Format(addr uint64) string {
+	return format(r, addr)
+}
+
+// Symbols returns the current snapshot of the symbol table, reloading it
+// if necessary.
+func (r *Resolver) Symbols() (*Symbols, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	interval := r.CheckInterval
+	if interval == 0 {
+		interval = time.Second
+	}
+
+	if r.symbols != nil && time.Since(r.lastCheck) < interval {
+		return r.symbols, nil
+	}
+	r.lastCheck = time.Now()
+
+	// /proc/modules is tiny compared to /proc/kallsyms, so use it
+	// to find out whether a reload is necessary.
+	modules, err := loadedModules()
+	if err != nil {
+		return nil, err
+	}
+
+	if r.symbols != nil && modules == r.modules {
+		return r.symbols, nil
+	}
+
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	r.modules = modules
+	return r.symbols, nil
+}
+
+// Reload the symbol table unconditionally.
+func (r *Resolver) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.reload()
+}
+
+func (r *Resolver) reload() error {
+	symbols, err := Load()
+	if err != nil {
+		return fmt.Errorf("load kallsyms: %w", err)
+	}
+
+	r.symbols = symbols
+	return nil
+}
+
+// loadedModules returns the names and load addresses of kernel modules.
+//
+// Reference counts are omitted since they change without affecting
+// symbols.
+func loadedModules() (string, error) {
+	contents, err := ioutil.ReadFile(modulesPath)
+	if os.IsNotExist(err) {
+		// The kernel doesn't support modules.
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var modules strings.Builder
+	for _, line := range strings.Split(string(contents), "\n") {
+		// Lines are formatted as "name size refcount deps state address".
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		modules.WriteString(fields[0])
+		modules.WriteString(fields[len(fields)-1])
+		modules.WriteByte('\n')
+	}
+
+	return modules.String(), nil
+}
@@ -0,0 +1,118 @@
+package kallsyms
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const fixture = `ffffffff81000000 T _stext
+ffffffff81000000 T _text
+ffffffff81000100 t do_one_initcall
+ffffffff81002000 D some_data
+ffffffff81001000 W weak_func
+ffffffffc0000000 t bpf_prog_6deef7357e7b4530_foo	[bpf]
+ffffffffc0001000 t xt_init	[x_tables]
+`
+
+func TestParse(t *testing.T) {
+	syms, err := Parse(strings.NewReader(fixture))
+	if err != nil {
+		t.Fatal("Can't parse:", err)
+	}
+
+	testcases := []struct {
+		addr   uint64
+		name   string
+		module string
+		offset uint64
+	}{
+		{0xffffffff81000000, "_stext", "", 0},
+		{0xffffffff81000010, "_stext", "", 0x10},
+		{0xffffffff81000100, "do_one_initcall", "", 0},
+		{0xffffffff81001010, "weak_func", "", 0x10},
+		{0xffffffffc0000004, "bpf_prog_6deef7357e7b4530_foo", "bpf", 4},
+		{0xffffffffc0001000, "xt_init", "x_tables", 0},
+	}
+
+	for _, tc := range testcases {
+		sym, offset, ok := syms.Lookup(tc.addr)
+		if !ok {
+			t.Errorf("Can't look up %#x", tc.addr)
+			continue
+		}
+		if sym.Name != tc.name || sym.Module != tc.module || offset != tc.offset {
+			t.Errorf("%#x: expected %s [%s]+%#x, got %s+%#x", tc.addr, tc.name, tc.module, tc.offset, sym, offset)
+		}
+	}
+
+	if _, _, ok := syms.Lookup(0x1000); ok {
+		t.Error("Lookup below the first symbol should fail")
+	}
+	if _, _, ok := syms.Lookup(0xffffffff81002010); ok {
+		t.Error("Lookup of a data symbol should fail")
+	}
+	if _, _, ok := syms.Lookup(0xffffffffc0001004); ok {
+		t.Error("Lookup past the last symbol should fail")
+	}
+
+	if s := syms.Format(0xffffffffc0000004); s != "bpf_prog_6deef7357e7b4530_foo+0x4 [bpf]" {
+		t.Error("Unexpected format:", s)
+	}
+	if s := syms.Format(0x1000); s != "0x1000" {
+		t.Error("Unexpected format:", s)
+	}
+
+	if addr, ok := syms.Address("do_one_initcall"); !ok || addr != 0xffffffff81000100 {
+		t.Errorf("Expected address of do_one_initcall, got %#x", addr)
+	}
+	if _, ok := syms.Address("some_data"); ok {
+		t.Error("Data symbols should be ignored")
+	}
+}
+
+func TestParseRestricted(t *testing.T) {
+	restricted := `0000000000000000 T _stext
+0000000000000000 t do_one_initcall
+`
+	if _, err := Parse(strings.NewReader(restricted)); !errors.Is(err, ErrRestricted) {
+		t.Fatal("Expected ErrRestricted, got", err)
+	}
+
+	if _, err := Parse(strings.NewReader("garbage\n")); err == nil {
+		t.Fatal("Parsing an invalid line doesn't return an error")
+	}
+}
+
+func TestResolver(t *testing.T) {
+	var r Resolver
+
+	syms, err := r.Symbols()
+	if errors.Is(err, ErrRestricted) {
+		t.Skip("Symbol addresses are hidden")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr, ok := syms.Address("_stext")
+	if !ok {
+		t.Skip("Kernel doesn't have _stext")
+	}
+
+	sym, offset, ok := r.Lookup(addr + 1)
+	if !ok {
+		t.Fatal("Can't look up", addr+1)
+	}
+	if sym.Address != addr || offset != 1 {
+		t.Errorf("Expected %#x+1, got %s at %#x+%d", addr, sym, sym.Address, offset)
+	}
+
+	if again, _ := r.Symbols(); again != syms {
+		t.Error("Symbols should be cached")
+	}
+
+	if err := r.Reload(); err != nil {
+		t.Fatal("Can't reload:", err)
+	}
+}
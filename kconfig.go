@@ -0,0 +1,213 @@
+package ebpf
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/btf"
+)
+
+// kconfigMap is the name of the map which holds the values of variables
+// declared as
+//
+//    extern type CONFIG_FOO __kconfig;
+//
+// where __kconfig places the variable into the .kconfig section.
+const kconfigMap = ".kconfig"
+
+// resolveKconfig returns a copy of spec with its contents set from the
+// configuration of the running kernel.
+//
+// Options which aren't set are zero. LINUX_KERNEL_VERSION is set to the
+// version of the running kernel, in the format of the KERNEL_VERSION macro.
+func resolveKconfig(spec *MapSpec) (*MapSpec, error) {
+	if spec.BTF == nil {
+		return nil, errors.New("missing BTF")
+	}
+
+	ds, ok := btf.MapValue(spec.BTF).(*btf.Datasec)
+	if !ok {
+		return nil, fmt.Errorf("value type is %T, not a data section", btf.MapValue(spec.BTF))
+	}
+
+	var config map[string]string
+	data := make([]byte, spec.ValueSize)
+	for _, vsi := range ds.Vars {
+		v := vsi.Type.(*btf.Var)
+		name := string(v.Name)
+
+		if int(vsi.Offset+vsi.Size) > len(data) {
+			return nil, fmt.Errorf("variable %s exceeds value size", name)
+		}
+		buf := data[vsi.Offset : vsi.Offset+vsi.Size]
+
+		switch {
+		case name == "LINUX_KERNEL_VERSION":
+			version, err := internal.KernelVersion()
+			if err != nil {
+				return nil, err
+			}
+
+			if err := putKconfigInt(buf, v.Type, uint64(version.Kernel())); err != nil {
+				return nil, fmt.Errorf("variable %s: %w", name, err)
+			}
+
+		case strings.HasPrefix(name, "CONFIG_"):
+			if config == nil {
+				var err error
+				config, err = internal.KernelConfig()
+				if err != nil {
+					return nil, fmt.Errorf("variable %s: %w", name, err)
+				}
+			}
+
+			value, ok := config[name]
+			if !ok {
+				continue
+			}
+
+			if err := putKconfigValue(buf, v.Type, value); err != nil {
+				return nil, fmt.Errorf("variable %s: %w", name, err)
+			}
+
+		default:
+			return nil, fmt.Errorf("variable %s: unsupported kconfig variable", name)
+		}
+	}
+
+	cpy := spec.Copy()
+	cpy.Contents = []MapKV{{uint32(0), data}}
+	return cpy, nil
+}
+
+// putKconfigValue encodes a value from the kernel config into buf.
+func putKconfigValue(buf []byte, typ btf.Type, value string) error {
+	typ = skipKconfigQualifiers(typ)
+
+	switch value {
+	case "y", "n", "m":
+		return putKconfigTristate(buf, typ, value)
+	}
+
+	if strings.HasPrefix(value, `"`) {
+		str, err := strconv.Unquote(value)
+		if err != nil {
+			return err
+		}
+
+		arr, ok := typ.(*btf.Array)
+		if !ok {
+			return fmt.Errorf("can't store string in %s", typ)
+		}
+
+		if i, ok := skipKconfigQualifiers(arr.Type).(*btf.Int); !ok || i.Size != 1 {
+			return fmt.Errorf("can't store string in %s", typ)
+		}
+
+		// Truncate the string and keep the trailing NUL.
+		copy(buf[:len(buf)-1], str)
+		return nil
+	}
+
+	n, err := strconv.ParseInt(value, 0, 64)
+	if err != nil {
+		u, uerr := strconv.ParseUint(value, 0, 64)
+		if uerr != nil {
+			return fmt.Errorf("can't parse %q: %w", value, err)
+		}
+		n = int64(u)
+	}
+
+	return putKconfigInt(buf, typ, uint64(n))
+}
+
+// putKconfigTristate encodes y, n or m into buf.
+//
+// bool accepts y and n, char stores the letter itself and enums use the
+// values of enum libbpf_tristate.
+func putKconfigTristate(buf []byte, typ btf.Type, value string) error {
+	switch typ := typ.(type) {
+	case *btf.Int:
+		switch {
+		case typ.Encoding&btf.Bool != 0:
+			if value == "m" {
+				return errors.New("bool can't store m")
+			}
+			buf[0] = 0
+			if value == "y" {
+				buf[0] = 1
+			}
+			return nil
+
+		case typ.Encoding&btf.Char != 0:
+			buf[0] = value[0]
+			return nil
+		}
+
+	case *btf.Enum:
+		tristate := map[string]uint64{"n": 0, "y": 1, "m": 2}
+		return putKconfigInt(buf, typ, tristate[value])
+	}
+
+	return fmt.Errorf("can't store %s in %s", value, typ)
+}
+
+// putKconfigInt encodes an integer in native endianness.
+func putKconfigInt(buf []byte, typ btf.Type, n uint64) error {
+	typ = skipKconfigQualifiers(typ)
+
+	var signed bool
+	switch typ := typ.(type) {
+	case *btf.Int:
+		signed = typ.Encoding&btf.Signed != 0
+	case *btf.Enum:
+		signed = true
+	default:
+		return fmt.Errorf("can't store integer in %s", typ)
+	}
+
+	size := len(buf)
+	if size < 8 {
+		bits := uint(size * 8)
+		if signed {
+			if v := int64(n); v < -(1<<(bits-1)) || v >= 1<<(bits-1) {
+				return fmt.Errorf("value %d doesn't fit into %d bytes", v, size)
+			}
+		} else if n > math.MaxUint64>>(64-bits) {
+			return fmt.Errorf("value %d doesn't fit into %d bytes", n, size)
+		}
+	}
+
+	switch size {
+	case 1:
+		buf[0] = byte(n)
+	case 2:
+		internal.NativeEndian.PutUint16(buf, uint16(n))
+	case 4:
+		internal.NativeEndian.PutUint32(buf, uint32(n))
+	case 8:
+		internal.NativeEndian.PutUint64(buf, n)
+	default:
+		return fmt.Errorf("unsupported size %d", size)
+	}
+	return nil
+}
+
+func skipKconfigQualifiers(typ btf.Type) btf.Type {
+	for {
+		switch v := typ.(type) {
+		case *btf.Typedef:
+			typ = v.Type
+		case *btf.Const:
+			typ = v.Type
+		case *btf.Volatile:
+			typ = v.Type
+		default:
+			return typ
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package ebpf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/btf"
+)
+
+func TestPutKconfigValue(t *testing.T) {
+	u32 := &btf.Int{Size: 4}
+	s8 := &btf.Int{Size: 1, Encoding: btf.Signed}
+	boolean := &btf.Int{Size: 1, Encoding: btf.Bool}
+	char := &btf.Int{Size: 1, Encoding: btf.Char | btf.Signed}
+	tristate := &btf.Enum{}
+	str := &btf.Array{Type: char, Nelems: 4}
+
+	le32 := func(n uint32) []byte {
+		buf := make([]byte, 4)
+		internal.NativeEndian.PutUint32(buf, n)
+		return buf
+	}
+
+	for _, test := range []struct {
+		typ   btf.Type
+		size  int
+		value string
+		want  []byte
+	}{
+		{boolean, 1, "y", []byte{1}},
+		{boolean, 1, "n", []byte{0}},
+		{char, 1, "m", []byte{'m'}},
+		{tristate, 4, "m", le32(2)},
+		{&btf.Typedef{Type: u32}, 4, "250", le32(250)},
+		{u32, 4, "0x10", le32(16)},
+		{s8, 1, "-1", []byte{0xff}},
+		{str, 4, `"abcdef"`, []byte("abc\x00")},
+	} {
+		buf := make([]byte, test.size)
+		if err := putKconfigValue(buf, test.typ, test.value); err != nil {
+			t.Errorf("%s %s: %s", test.typ, test.value, err)
+			continue
+		}
+		if !bytes.Equal(buf, test.want) {
+			t.Errorf("%s %s: expected %v, got %v", test.typ, test.value, test.want, buf)
+		}
+	}
+
+	for _, test := range []struct {
+		typ   btf.Type
+		size  int
+		value string
+	}{
+		{boolean, 1, "m"},
+		{s8, 1, "128"},
+		{u32, 4, "-1"},
+		{u32, 4, `"foo"`},
+		{str, 4, "1"},
+	} {
+		buf := make([]byte, test.size)
+		if err := putKconfigValue(buf, test.typ, test.value); err == nil {
+			t.Errorf("%s %s: expected an error", test.typ, test.value)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package ebpf
+
+import (
+	"github.com/cilium/ebpf/internal"
+)
+
+// TrackFDLeaks reports file descriptors of maps, programs and links which
+// are garbage collected without having been closed.
+//
+// report is invoked from a finalizer with the value of the leaked fd and
+// the stack trace of the code which created it. The fd is closed after
+// report returns. Only fds created after the call are tracked, pass nil to
+// stop tracking.
+//
+// Recording stack traces makes creating fds more expensive, so this is
+// meant for debugging long running processes.
+func TrackFDLeaks(report func(fd int, stack string)) {
+	internal.SetLeakReporter(report)
+}
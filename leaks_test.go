@@ -0,0 +1,51 @@
+package ebpf
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrackFDLeaks(t *testing.T) {
+	leaks := make(chan string, 10)
+	TrackFDLeaks(func(fd int, stack string) {
+		leaks <- stack
+	})
+	defer TrackFDLeaks(nil)
+
+	closed := createArray(t)
+	if err := closed.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := closed.Close(); err != nil {
+		t.Fatal("Close isn't idempotent:", err)
+	}
+
+	createArray(t)
+
+	timeout := time.After(5 * time.Second)
+	for {
+		runtime.GC()
+
+		select {
+		case stack := <-leaks:
+			if !strings.Contains(stack, "createArray") {
+				t.Error("Stack doesn't contain the creating function:\n", stack)
+			}
+
+			runtime.GC()
+			select {
+			case <-leaks:
+				t.Error("Closed map is reported as leaked")
+			case <-time.After(100 * time.Millisecond):
+			}
+			return
+
+		case <-timeout:
+			t.Fatal("Leaked map isn't reported")
+
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -8,13 +8,25 @@ import (
 	"github.com/cilium/ebpf"
 )
 
-type cgroupAttachFlags uint32
+// CgroupAttachFlags control how programs attached to a cgroup via
+// BPF_PROG_ATTACH interact with programs attached to the same cgroup or
+// to its descendants.
+type CgroupAttachFlags uint32
 
-// cgroup attach flags
+// Valid CgroupAttachFlags. Without flags a cgroup has at most one program
+// per attach type, and descendants can't attach programs of their own.
 const (
-	flagAllowOverride cgroupAttachFlags = 1 << iota
-	flagAllowMulti
-	flagReplace
+	// CgroupAllowOverride allows descendants to attach a program which
+	// runs instead of this one.
+	CgroupAllowOverride CgroupAttachFlags = 1 << iota
+	// CgroupAllowMulti allows attaching multiple programs to the same
+	// cgroup, and to descendants. Programs in descendants run first.
+	CgroupAllowMulti
+	// CgroupReplace atomically replaces the program given by
+	// CgroupOptions.Replace. Requires CgroupAllowMulti.
+	//
+	// Requires at least Linux 5.5.
+	CgroupReplace
 )
 
 type CgroupOptions struct {
@@ -24,9 +36,22 @@ type CgroupOptions struct {
 	Attach ebpf.AttachType
 	// Program must be of type CGroup*, and the attach type must match Attach.
 	Program *ebpf.Program
+	// Flags force attaching via BPF_PROG_ATTACH instead of bpf_link.
+	// Links behave like CgroupAllowMulti, but are detached when the
+	// process holding them exits.
+	Flags CgroupAttachFlags
+	// Replace is a program attached with CgroupAllowMulti, for example
+	// by another controller, which is atomically replaced by Program.
+	// Implies CgroupAllowMulti and CgroupReplace, and can't be combined
+	// with CgroupAllowOverride.
+	Replace *ebpf.Program
 }
 
 // AttachCgroup links a BPF program to a cgroup.
+//
+// Uses bpf_link if available and no Flags or Replace are given, otherwise
+// BPF_PROG_ATTACH with CgroupAllowMulti, falling back to
+// CgroupAllowOverride on kernels which don't support multiple programs.
 func AttachCgroup(opts CgroupOptions) (Link, error) {
 	cgroup, err := os.Open(opts.Path)
 	if err != nil {
@@ -40,12 +65,16 @@ func AttachCgroup(opts CgroupOptions) (Link, error) {
 	}
 
 	var cg Link
-	cg, err = newLinkCgroup(cgroup, opts.Attach, clone)
-	if errors.Is(err, ErrNotSupported) {
-		cg, err = newProgAttachCgroup(cgroup, opts.Attach, clone, flagAllowMulti)
-	}
-	if errors.Is(err, ErrNotSupported) {
-		cg, err = newProgAttachCgroup(cgroup, opts.Attach, clone, flagAllowOverride)
+	if opts.Flags != 0 || opts.Replace != nil {
+		cg, err = newProgAttachCgroup(cgroup, opts.Attach, clone, opts.Flags, opts.Replace)
+	} else {
+		cg, err = newLinkCgroup(cgroup, opts.Attach, clone)
+		if errors.Is(err, ErrNotSupported) {
+			cg, err = newProgAttachCgroup(cgroup, opts.Attach, clone, CgroupAllowMulti, nil)
+		}
+		if errors.Is(err, ErrNotSupported) {
+			cg, err = newProgAttachCgroup(cgroup, opts.Attach, clone, CgroupAllowOverride, nil)
+		}
 	}
 	if err != nil {
 		cgroup.Close()
@@ -56,6 +85,54 @@ func AttachCgroup(opts CgroupOptions) (Link, error) {
 	return cg, nil
 }
 
+// AttachCgroupSKB attaches a CGroupSKB program to the ingress or egress
+// of a cgroup, which filters the packets of all sockets created by
+// processes in the cgroup and its descendants.
+//
+// The program must return 1 to allow a packet and 0 to drop it. See
+// AttachCgroup for how the program is attached.
+func AttachCgroupSKB(cgroupPath string, dir Direction, prog *ebpf.Program) (Link, error) {
+	switch dir {
+	case Ingress:
+		return attachCgroupProgram(cgroupPath, ebpf.AttachCGroupInetIngress, prog)
+	case Egress:
+		return attachCgroupProgram(cgroupPath, ebpf.AttachCGroupInetEgress, prog)
+	default:
+		return nil, fmt.Errorf("invalid direction %s", dir)
+	}
+}
+
+// cgroupProgramTypes are the program types expected by the AttachCgroup*
+// helpers.
+var cgroupProgramTypes = map[ebpf.AttachType]ebpf.ProgramType{
+	ebpf.AttachCGroupInetIngress: ebpf.CGroupSKB,
+	ebpf.AttachCGroupInetEgress:  ebpf.CGroupSKB,
+	ebpf.AttachCGroupSockOps:     ebpf.SockOps,
+	ebpf.AttachCGroupSysctl:      ebpf.CGroupSysctl,
+	ebpf.AttachCGroupGetsockopt:  ebpf.CGroupSockopt,
+	ebpf.AttachCGroupSetsockopt:  ebpf.CGroupSockopt,
+	ebpf.AttachCGroupDevice:      ebpf.CGroupDevice,
+}
+
+// attachCgroupProgram checks the type of prog before attaching it to a
+// cgroup using AttachCgroup.
+func attachCgroupProgram(cgroupPath string, attach ebpf.AttachType, prog *ebpf.Program) (Link, error) {
+	want, ok := cgroupProgramTypes[attach]
+	if !ok {
+		return nil, fmt.Errorf("no program type for attach type %s", attach)
+	}
+
+	if t := prog.Type(); t != want {
+		return nil, fmt.Errorf("invalid program type %s, expected %s", t, want)
+	}
+
+	return AttachCgroup(CgroupOptions{
+		Path:    cgroupPath,
+		Attach:  attach,
+		Program: prog,
+	})
+}
+
 // LoadPinnedCgroup loads a pinned cgroup from a bpffs.
 func LoadPinnedCgroup(fileName string, opts *ebpf.LoadPinOptions) (Link, error) {
 	link, err := LoadPinnedRawLink(fileName, CgroupType, opts)
@@ -70,15 +147,24 @@ type progAttachCgroup struct {
 	cgroup     *os.File
 	current    *ebpf.Program
 	attachType ebpf.AttachType
-	flags      cgroupAttachFlags
+	flags      CgroupAttachFlags
 }
 
 var _ Link = (*progAttachCgroup)(nil)
 
 func (cg *progAttachCgroup) isLink() {}
 
-func newProgAttachCgroup(cgroup *os.File, attach ebpf.AttachType, prog *ebpf.Program, flags cgroupAttachFlags) (*progAttachCgroup, error) {
-	if flags&flagAllowMulti > 0 {
+func newProgAttachCgroup(cgroup *os.File, attach ebpf.AttachType, prog *ebpf.Program, flags CgroupAttachFlags, replace *ebpf.Program) (*progAttachCgroup, error) {
+	if replace != nil {
+		if flags&CgroupAllowOverride > 0 {
+			return nil, errors.New("cgroup: can't replace a program with CgroupAllowOverride")
+		}
+		flags |= CgroupAllowMulti | CgroupReplace
+	} else if flags&CgroupReplace > 0 {
+		return nil, errors.New("cgroup: CgroupReplace requires a program to replace")
+	}
+
+	if flags&CgroupAllowMulti > 0 {
 		if err := haveProgAttachReplace(); err != nil {
 			return nil, fmt.Errorf("can't support multiple programs: %w", err)
 		}
@@ -87,6 +173,7 @@ func newProgAttachCgroup(cgroup *os.File, attach ebpf.AttachType, prog *ebpf.Pro
 	err := RawAttachProgram(RawAttachProgramOptions{
 		Target:  int(cgroup.Fd()),
 		Program: prog,
+		Replace: replace,
 		Flags:   uint32(flags),
 		Attach:  attach,
 	})
@@ -94,7 +181,8 @@ func newProgAttachCgroup(cgroup *os.File, attach ebpf.AttachType, prog *ebpf.Pro
 		return nil, fmt.Errorf("cgroup: %w", err)
 	}
 
-	return &progAttachCgroup{cgroup, prog, attach, flags}, nil
+	// Replacing is a one-off, later updates replace prog.
+	return &progAttachCgroup{cgroup, prog, attach, flags &^ CgroupReplace}, nil
 }
 
 func (cg *progAttachCgroup) Close() error {
@@ -125,11 +213,11 @@ func (cg *progAttachCgroup) Update(prog *ebpf.Program) error {
 		Flags:   uint32(cg.flags),
 	}
 
-	if cg.flags&flagAllowMulti > 0 {
+	if cg.flags&CgroupAllowMulti > 0 {
 		// Atomically replacing multiple programs requires at least
 		// 5.5 (commit 7dd68b3279f17921 "bpf: Support replacing cgroup-bpf
 		// program in MULTI mode")
-		args.Flags |= uint32(flagReplace)
+		args.Flags |= uint32(CgroupReplace)
 		args.Replace = cg.current
 	}
 
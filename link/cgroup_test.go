@@ -1,9 +1,12 @@
 package link
 
 import (
+	"os"
 	"testing"
 
 	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal"
 	"github.com/cilium/ebpf/internal/testutils"
 )
 
@@ -31,10 +34,166 @@ func TestAttachCgroup(t *testing.T) {
 	}
 }
 
+func TestAttachCgroupSKB(t *testing.T) {
+	cgroup, egress := mustCgroupFixtures(t)
+
+	ingress, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Type:    ebpf.CGroupSKB,
+		License: "MIT",
+		Instructions: asm.Instructions{
+			asm.Mov.Imm(asm.R0, 1),
+			asm.Return(),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ingress.Close()
+
+	for dir, prog := range map[Direction]*ebpf.Program{Ingress: ingress, Egress: egress} {
+		link, err := AttachCgroupSKB(cgroup.Name(), dir, prog)
+		testutils.SkipIfNotSupported(t, err)
+		if err != nil {
+			t.Fatalf("Can't attach to %s: %s", dir, err)
+		}
+		defer link.Close()
+	}
+
+	for _, attach := range []ebpf.AttachType{ebpf.AttachCGroupInetIngress, ebpf.AttachCGroupInetEgress} {
+		if ids := mustQueryCgroup(t, cgroup, attach); len(ids) != 1 {
+			t.Errorf("Expected one program for %s, got %v", attach, ids)
+		}
+	}
+
+	if _, err := AttachCgroupSKB(cgroup.Name(), Direction(42), ingress); err == nil {
+		t.Error("Invalid direction doesn't return an error")
+	}
+}
+
+func TestAttachCgroupWrongType(t *testing.T) {
+	cgroup, _ := mustCgroupFixtures(t)
+	prog := mustXDPProgram(t)
+
+	for name, attach := range map[string]func(string, *ebpf.Program) (Link, error){
+		"SKB": func(path string, prog *ebpf.Program) (Link, error) {
+			return AttachCgroupSKB(path, Ingress, prog)
+		},
+		"SockOps":    AttachSockOps,
+		"Sysctl":     AttachCgroupSysctl,
+		"Getsockopt": AttachCgroupGetsockopt,
+		"Setsockopt": AttachCgroupSetsockopt,
+		"Device":     AttachCgroupDevice,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := attach(cgroup.Name(), prog); err == nil {
+				t.Error("Attaching a program of the wrong type doesn't return an error")
+			}
+		})
+	}
+
+	for attach := range cgroupProgramTypes {
+		if _, err := attachCgroupProgram(cgroup.Name(), attach, prog); err == nil {
+			t.Errorf("%s: attaching a program of the wrong type doesn't return an error", attach)
+		}
+	}
+}
+
+func TestAttachCgroupFlags(t *testing.T) {
+	cgroup, prog := mustCgroupFixtures(t)
+
+	link, err := AttachCgroup(CgroupOptions{
+		Path:    cgroup.Name(),
+		Attach:  ebpf.AttachCGroupInetEgress,
+		Program: prog,
+		Flags:   CgroupAllowMulti,
+	})
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer link.Close()
+
+	if _, ok := link.(*progAttachCgroup); !ok {
+		t.Fatalf("Expected progAttachCgroup, got %T instead", link)
+	}
+
+	// Another controller replaces the program.
+	prog2 := mustCgroupEgressProgram(t)
+	link2, err := AttachCgroup(CgroupOptions{
+		Path:    cgroup.Name(),
+		Attach:  ebpf.AttachCGroupInetEgress,
+		Program: prog2,
+		Replace: prog,
+	})
+	if err != nil {
+		t.Fatal("Can't replace program:", err)
+	}
+
+	info, err := prog2.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := info.ID()
+
+	ids := mustQueryCgroup(t, cgroup, ebpf.AttachCGroupInetEgress)
+	if len(ids) != 1 || ids[0] != id {
+		t.Errorf("Expected only program %d to be attached, got %v", id, ids)
+	}
+
+	if err := link2.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if ids := mustQueryCgroup(t, cgroup, ebpf.AttachCGroupInetEgress); len(ids) != 0 {
+		t.Error("Programs are still attached after Close:", ids)
+	}
+
+	_, err = AttachCgroup(CgroupOptions{
+		Path:    cgroup.Name(),
+		Attach:  ebpf.AttachCGroupInetEgress,
+		Program: prog,
+		Flags:   CgroupAllowMulti | CgroupReplace,
+	})
+	if err == nil {
+		t.Error("CgroupReplace without a program to replace doesn't return an error")
+	}
+
+	_, err = AttachCgroup(CgroupOptions{
+		Path:    cgroup.Name(),
+		Attach:  ebpf.AttachCGroupInetEgress,
+		Program: prog2,
+		Flags:   CgroupAllowOverride,
+		Replace: prog,
+	})
+	if err == nil {
+		t.Error("Replacing a program with CgroupAllowOverride doesn't return an error")
+	}
+}
+
+func mustQueryCgroup(t *testing.T, cgroup *os.File, attach ebpf.AttachType) []ebpf.ProgramID {
+	t.Helper()
+
+	buf := make([]byte, 4*16)
+	attr := bpfProgQueryAttr{
+		targetFdOrIfindex: uint32(cgroup.Fd()),
+		attachType:        attach,
+		progIDs:           internal.NewSlicePointer(buf),
+		count:             16,
+	}
+	if err := bpfProgQuery(&attr); err != nil {
+		t.Fatal("Can't query cgroup:", err)
+	}
+
+	var ids []ebpf.ProgramID
+	for i := 0; i < int(attr.count)*4; i += 4 {
+		ids = append(ids, ebpf.ProgramID(internal.NativeEndian.Uint32(buf[i:])))
+	}
+	return ids
+}
+
 func TestProgAttachCgroup(t *testing.T) {
 	cgroup, prog := mustCgroupFixtures(t)
 
-	link, err := newProgAttachCgroup(cgroup, ebpf.AttachCGroupInetEgress, prog, 0)
+	link, err := newProgAttachCgroup(cgroup, ebpf.AttachCGroupInetEgress, prog, 0, nil)
 	if err != nil {
 		t.Fatal("Can't create link:", err)
 	}
@@ -47,7 +206,7 @@ func TestProgAttachCgroup(t *testing.T) {
 func TestProgAttachCgroupAllowMulti(t *testing.T) {
 	cgroup, prog := mustCgroupFixtures(t)
 
-	link, err := newProgAttachCgroup(cgroup, ebpf.AttachCGroupInetEgress, prog, flagAllowMulti)
+	link, err := newProgAttachCgroup(cgroup, ebpf.AttachCGroupInetEgress, prog, CgroupAllowMulti, nil)
 	testutils.SkipIfNotSupported(t, err)
 	if err != nil {
 		t.Fatal("Can't create link:", err)
@@ -0,0 +1,145 @@
+package link
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cilium/ebpf"
+)
+
+// AttachAllOptions control how AttachAll attaches programs.
+type AttachAllOptions struct {
+	// Path to a cgroupv2 folder. Required to attach cgroup programs.
+	Cgroup string
+	// Index of a network interface. Required to attach XDP and tcx programs.
+	Interface int
+}
+
+// AttachAll attaches the programs in coll according to the section names
+// they were loaded from.
+//
+// The following conventions are understood:
+//
+//    kprobe/<symbol>, kretprobe/<symbol>
+//    tracepoint/<group>/<name>, tp/<group>/<name>
+//    raw_tracepoint/<name>, raw_tp/<name>
+//    raw_tracepoint.w/<name>, raw_tp.w/<name>
+//    iter/<target>
+//    freplace/<function>
+//    xdp
+//    tcx/ingress, tcx/egress
+//    cgroup_skb/..., cgroup/..., sockops
+//
+// Programs in other sections, like socket filters or the targets of tail
+// calls, are skipped. opts may be nil.
+//
+// Returns the created links keyed by program name. All links are closed
+// if attaching any of the programs fails.
+func AttachAll(spec *ebpf.CollectionSpec, coll *ebpf.Collection, opts *AttachAllOptions) (map[string]Link, error) {
+	if opts == nil {
+		opts = &AttachAllOptions{}
+	}
+
+	// Attach in a stable order to make errors reproducible.
+	names := make([]string, 0, len(spec.Programs))
+	for name := range spec.Programs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	links := make(map[string]Link)
+	for _, name := range names {
+		progSpec := spec.Programs[name]
+		prog := coll.Programs[name]
+		if prog == nil {
+			continue
+		}
+
+		link, err := attachBySection(progSpec, prog, opts)
+		if err != nil {
+			for _, link := range links {
+				link.Close()
+			}
+			return nil, fmt.Errorf("program %s: %w", name, err)
+		}
+		if link != nil {
+			links[name] = link
+		}
+	}
+
+	return links, nil
+}
+
+// attachBySection returns a nil Link if the section name doesn't follow
+// a known convention.
+func attachBySection(spec *ebpf.ProgramSpec, prog *ebpf.Program, opts *AttachAllOptions) (Link, error) {
+	kind, target := spec.SectionName, ""
+	if i := strings.IndexByte(kind, '/'); i >= 0 {
+		kind, target = kind[:i], kind[i+1:]
+	}
+
+	switch kind {
+	case "kprobe":
+		return Kprobe(target, prog)
+
+	case "kretprobe":
+		return Kretprobe(target, prog)
+
+	case "tracepoint", "tp":
+		parts := strings.SplitN(target, "/", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("section %s: expected tracepoint/<group>/<name>", spec.SectionName)
+		}
+		return Tracepoint(parts[0], parts[1], prog)
+
+	case "raw_tracepoint", "raw_tp", "raw_tracepoint.w", "raw_tp.w":
+		return AttachRawTracepoint(RawTracepointOptions{
+			Name:    target,
+			Program: prog,
+		})
+
+	case "iter":
+		return AttachIter(IterOptions{
+			Program: prog,
+		})
+
+	case "freplace":
+		return AttachFreplace(FreplaceOptions{
+			Program: prog,
+		})
+
+	case "xdp":
+		if opts.Interface == 0 {
+			return nil, errors.New("missing interface for XDP program")
+		}
+		return AttachXDP(XDPOptions{
+			Program:   prog,
+			Interface: opts.Interface,
+		})
+
+	case "tcx":
+		if opts.Interface == 0 {
+			return nil, errors.New("missing interface for tcx program")
+		}
+		return AttachTCX(TCXOptions{
+			Program:   prog,
+			Interface: opts.Interface,
+			Attach:    spec.AttachType,
+		})
+
+	case "cgroup_skb", "cgroup", "sockops":
+		if opts.Cgroup == "" {
+			return nil, errors.New("missing cgroup for cgroup program")
+		}
+		return AttachCgroup(CgroupOptions{
+			Path:    opts.Cgroup,
+			Attach:  spec.AttachType,
+			Program: prog,
+		})
+
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,94 @@
+package link
+
+import (
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal/testutils"
+)
+
+func TestAttachAll(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "4.17", "BPF_RAW_TRACEPOINT API")
+
+	insns := asm.Instructions{
+		asm.LoadImm(asm.R0, 0, asm.DWord),
+		asm.Return(),
+	}
+
+	spec := &ebpf.CollectionSpec{
+		Programs: map[string]*ebpf.ProgramSpec{
+			"tp": {
+				SectionName:  "tracepoint/printk/console",
+				Type:         ebpf.TracePoint,
+				Instructions: insns,
+				License:      "MIT",
+			},
+			"raw_tp": {
+				SectionName:  "raw_tracepoint/cgroup_mkdir",
+				Type:         ebpf.RawTracepoint,
+				Instructions: insns,
+				License:      "GPL",
+			},
+			"filter": {
+				SectionName:  "socket",
+				Type:         ebpf.SocketFilter,
+				Instructions: insns,
+				License:      "MIT",
+			},
+		},
+	}
+
+	coll, err := ebpf.NewCollection(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer coll.Close()
+
+	links, err := AttachAll(spec, coll, nil)
+	if err != nil {
+		t.Fatal("Can't attach collection:", err)
+	}
+	defer func() {
+		for _, link := range links {
+			link.Close()
+		}
+	}()
+
+	for _, name := range []string{"tp", "raw_tp"} {
+		if links[name] == nil {
+			t.Errorf("Program %s isn't attached", name)
+		}
+	}
+	if _, ok := links["filter"]; ok {
+		t.Error("Socket filter is attached")
+	}
+}
+
+func TestAttachAllMissingOptions(t *testing.T) {
+	insns := asm.Instructions{
+		asm.LoadImm(asm.R0, 0, asm.DWord),
+		asm.Return(),
+	}
+
+	for _, progSpec := range []*ebpf.ProgramSpec{
+		{SectionName: "xdp", Type: ebpf.XDP, Instructions: insns, License: "MIT"},
+		{SectionName: "tcx/ingress", Type: ebpf.SchedCLS, AttachType: ebpf.AttachTCXIngress, Instructions: insns, License: "MIT"},
+		{SectionName: "cgroup_skb/egress", Type: ebpf.CGroupSKB, AttachType: ebpf.AttachCGroupInetEgress, Instructions: insns, License: "MIT"},
+		{SectionName: "tracepoint/printk", Type: ebpf.TracePoint, Instructions: insns, License: "MIT"},
+	} {
+		spec := &ebpf.CollectionSpec{
+			Programs: map[string]*ebpf.ProgramSpec{"prog": progSpec},
+		}
+
+		coll, err := ebpf.NewCollection(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := AttachAll(spec, coll, nil); err == nil {
+			t.Errorf("Attaching section %s without options doesn't return an error", progSpec.SectionName)
+		}
+		coll.Close()
+	}
+}
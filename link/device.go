@@ -0,0 +1,53 @@
+package link
+
+import (
+	"github.com/cilium/ebpf"
+)
+
+// Offsets of the fields of struct bpf_cgroup_dev_ctx, the context of
+// CGroupDevice programs.
+const (
+	// DeviceAccessTypeOffset is the offset of a u32 holding the
+	// DeviceAccess in the upper and the DeviceType in the lower 16 bits.
+	DeviceAccessTypeOffset = 0
+	// DeviceMajorOffset and DeviceMinorOffset are the offsets of the u32
+	// device numbers.
+	DeviceMajorOffset = 4
+	DeviceMinorOffset = 8
+)
+
+// DeviceAccess is a bitmask of the ways a device is accessed.
+//
+// Equivalent to the BPF_DEVCG_ACC_* values in the kernel's UAPI.
+type DeviceAccess uint32
+
+// Valid DeviceAccess values.
+const (
+	DeviceAccessMknod DeviceAccess = 1 << iota
+	DeviceAccessRead
+	DeviceAccessWrite
+)
+
+// DeviceType is the kind of device being accessed.
+//
+// Equivalent to the BPF_DEVCG_DEV_* values in the kernel's UAPI.
+type DeviceType uint32
+
+// Valid DeviceTypes.
+const (
+	DeviceBlock DeviceType = iota + 1
+	DeviceChar
+)
+
+// AttachCgroupDevice attaches a CGroupDevice program to a cgroup. The
+// program is invoked whenever a process in the cgroup or its descendants
+// creates or opens a block or character device.
+//
+// The program must return 1 to allow the access and 0 to reject it with
+// EPERM. On cgroup v2 this replaces the devices controller of cgroup v1.
+//
+// See AttachCgroup for how the program is attached. Requires at least
+// Linux 4.15.
+func AttachCgroupDevice(cgroupPath string, prog *ebpf.Program) (Link, error) {
+	return attachCgroupProgram(cgroupPath, ebpf.AttachCGroupDevice, prog)
+}
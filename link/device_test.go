@@ -0,0 +1,62 @@
+package link
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal/testutils"
+)
+
+func TestAttachCgroupDevice(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "4.15", "cgroup device")
+
+	cgroup, _ := mustCgroupFixtures(t)
+
+	// Deny reading /dev/null, which is character device 1:3.
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Type:       ebpf.CGroupDevice,
+		AttachType: ebpf.AttachCGroupDevice,
+		License:    "MIT",
+		Instructions: asm.Instructions{
+			asm.Mov.Imm(asm.R0, 1),
+			asm.LoadMem(asm.R2, asm.R1, DeviceAccessTypeOffset, asm.Word),
+			asm.Mov.Reg(asm.R3, asm.R2),
+			asm.And.Imm(asm.R3, 0xffff),
+			asm.JNE.Imm(asm.R3, int32(DeviceChar), "out"),
+			asm.RSh.Imm(asm.R2, 16),
+			asm.And.Imm(asm.R2, int32(DeviceAccessRead)),
+			asm.JEq.Imm(asm.R2, 0, "out"),
+			asm.LoadMem(asm.R2, asm.R1, DeviceMajorOffset, asm.Word),
+			asm.JNE.Imm(asm.R2, 1, "out"),
+			asm.LoadMem(asm.R2, asm.R1, DeviceMinorOffset, asm.Word),
+			asm.JNE.Imm(asm.R2, 3, "out"),
+			asm.Mov.Imm(asm.R0, 0),
+			asm.Return().Sym("out"),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer prog.Close()
+
+	link, err := AttachCgroupDevice(cgroup.Name(), prog)
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal("Can't attach program:", err)
+	}
+	defer link.Close()
+
+	// Move a shell into the cgroup before opening the device.
+	procs := filepath.Join(cgroup.Name(), "cgroup.procs")
+	cmd := exec.Command("/bin/sh", "-c", `echo $$ > "$0" && exec cat /dev/null`, procs)
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Errorf("Reading /dev/null isn't rejected: %s", out)
+	} else if !strings.Contains(string(out), "cat:") {
+		t.Fatalf("Can't run shell in cgroup: %s: %s", err, out)
+	}
+}
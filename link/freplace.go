@@ -0,0 +1,103 @@
+package link
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/btf"
+)
+
+// FreplaceOptions control how an Extension program is attached.
+type FreplaceOptions struct {
+	// Program must be an Extension program.
+	Program *ebpf.Program
+	// Target is the program containing the function to replace. Defaults
+	// to the AttachTarget the Program was loaded with, which can only be
+	// used for the first link of a Program.
+	//
+	// Requires at least Linux 5.10.
+	Target *ebpf.Program
+	// Name of the global function to replace. Required if Target is set.
+	Name string
+}
+
+// AttachFreplace replaces a global function of a loaded program with an
+// Extension program. The replacement lasts until the link is closed.
+//
+// Requires at least Linux 5.6.
+func AttachFreplace(opts FreplaceOptions) (Link, error) {
+	if t := opts.Program.Type(); t != ebpf.Extension {
+		return nil, fmt.Errorf("invalid program type %s, expected Extension", t)
+	}
+
+	progFd := opts.Program.FD()
+	if progFd < 0 {
+		return nil, fmt.Errorf("invalid program: %s", internal.ErrClosedFd)
+	}
+
+	if opts.Target == nil {
+		fd, err := bpfRawTracepointOpen(&bpfRawTracepointOpenAttr{
+			fd: uint32(progFd),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("freplace: %w", err)
+		}
+		return &freplaceLink{RawLink{fd, ""}}, nil
+	}
+
+	targetFd := opts.Target.FD()
+	if targetFd < 0 {
+		return nil, fmt.Errorf("invalid target: %s", internal.ErrClosedFd)
+	}
+
+	if opts.Name == "" {
+		return nil, errors.New("missing name of function to replace")
+	}
+
+	info, err := opts.Target.Info()
+	if err != nil {
+		return nil, fmt.Errorf("freplace: %w", err)
+	}
+
+	btfID, ok := info.BTFID()
+	if !ok {
+		return nil, fmt.Errorf("freplace: target %s has no BTF", opts.Target)
+	}
+
+	id, err := btf.FindFuncByID(btfID, opts.Name)
+	if err != nil {
+		return nil, fmt.Errorf("freplace: %w", err)
+	}
+
+	fd, err := bpfLinkCreateTracing(&bpfLinkCreateTracingAttr{
+		progFd:      uint32(progFd),
+		targetFd:    uint32(targetFd),
+		targetBTFID: uint32(id),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("freplace: %w", err)
+	}
+	return &freplaceLink{RawLink{fd, ""}}, nil
+}
+
+// LoadPinnedFreplace loads a pinned freplace link from a bpffs.
+func LoadPinnedFreplace(fileName string, opts *ebpf.LoadPinOptions) (Link, error) {
+	link, err := LoadPinnedRawLink(fileName, TracingType, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &freplaceLink{*link}, nil
+}
+
+type freplaceLink struct {
+	RawLink
+}
+
+var _ Link = (*freplaceLink)(nil)
+
+func (f *freplaceLink) Update(new *ebpf.Program) error {
+	return fmt.Errorf("can't update freplace: %w", ErrNotSupported)
+}
@@ -0,0 +1,103 @@
+package link
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/testutils"
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+func TestAttachFreplace(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.10", "freplace via bpf_link")
+
+	testutils.TestFiles(t, "../testdata/loader-clang-11-*.elf", func(t *testing.T, file string) {
+		spec, err := ebpf.LoadCollectionSpec(file)
+		if err != nil {
+			t.Fatal("Can't parse ELF:", err)
+		}
+
+		if spec.Programs["xdp_prog"].ByteOrder != internal.NativeEndian {
+			return
+		}
+
+		if err := spec.RewriteConstants(map[string]interface{}{"arg": uint32(1)}); err != nil {
+			t.Fatal(err)
+		}
+		spec.Maps["array_of_hash_map"].InnerMap = spec.Maps["hash_map"]
+
+		pinPath := testutils.TempBPFFS(t)
+		mustTarget := func() *ebpf.Program {
+			t.Helper()
+
+			coll, err := ebpf.NewCollectionWithOptions(spec, ebpf.CollectionOptions{
+				Maps: ebpf.MapOptions{PinPath: pinPath},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { coll.Close() })
+
+			return coll.Programs["xdp_prog"]
+		}
+
+		target, other := mustTarget(), mustTarget()
+
+		// no_relocation has the same signature as xdp_prog, but returns
+		// zero instead of five.
+		extSpec := spec.Programs["no_relocation"].Copy()
+		extSpec.Type = ebpf.Extension
+		extSpec.AttachTarget = target
+		extSpec.AttachTo = "xdp_prog"
+
+		ext, err := ebpf.NewProgram(extSpec)
+		testutils.SkipIfNotSupported(t, err)
+		if errors.Is(err, unix.EPERM) {
+			t.Skip("Insufficient permissions to load extension programs")
+		}
+		if err != nil {
+			t.Fatal("Can't load extension:", err)
+		}
+		defer ext.Close()
+
+		link, err := AttachFreplace(FreplaceOptions{Program: ext})
+		if err != nil {
+			t.Fatal("Can't attach extension:", err)
+		}
+		mustReturn(t, target, 0)
+
+		link2, err := AttachFreplace(FreplaceOptions{
+			Program: ext,
+			Target:  other,
+			Name:    "xdp_prog",
+		})
+		if err != nil {
+			t.Fatal("Can't attach extension to another program:", err)
+		}
+		mustReturn(t, other, 0)
+
+		if err := link2.Close(); err != nil {
+			t.Fatal(err)
+		}
+		mustReturn(t, other, 5)
+
+		testLink(t, link, testLinkOptions{
+			prog:       ext,
+			loadPinned: LoadPinnedFreplace,
+		})
+	})
+}
+
+func mustReturn(t *testing.T, prog *ebpf.Program, want uint32) {
+	t.Helper()
+
+	ret, _, err := prog.Test(make([]byte, 14))
+	if err != nil {
+		t.Fatal("Can't run program:", err)
+	}
+	if ret != want {
+		t.Errorf("Expected %s to return %d, got %d", prog, want, ret)
+	}
+}
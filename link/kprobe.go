@@ -17,6 +17,16 @@ var (
 	kprobeEventsPath = filepath.Join(tracefsPath, "kprobe_events")
 )
 
+// KprobeOptions defines additional parameters that will be used
+// when attaching a kprobe or kretprobe.
+type KprobeOptions struct {
+	// Arbitrary value that can be fetched from an eBPF program
+	// via `bpf_get_attach_cookie()`.
+	//
+	// Needs kernel 5.15+.
+	Cookie uint64
+}
+
 // Kprobe attaches the given eBPF program to a perf event that fires when the
 // given kernel symbol starts executing. See /proc/kallsyms for available
 // symbols. For example, printk():
@@ -26,12 +36,18 @@ var (
 // The resulting Link must be Closed during program shutdown to avoid leaking
 // system resources.
 func Kprobe(symbol string, prog *ebpf.Program) (Link, error) {
+	return KprobeWithOptions(symbol, prog, nil)
+}
+
+// KprobeWithOptions is like Kprobe, but allows passing additional
+// parameters. opts may be nil.
+func KprobeWithOptions(symbol string, prog *ebpf.Program, opts *KprobeOptions) (Link, error) {
 	k, err := kprobe(symbol, prog, false)
 	if err != nil {
 		return nil, err
 	}
 
-	err = k.attach(prog)
+	err = k.attach(prog, opts.cookie())
 	if err != nil {
 		k.Close()
 		return nil, err
@@ -49,12 +65,18 @@ func Kprobe(symbol string, prog *ebpf.Program) (Link, error) {
 // The resulting Link must be Closed during program shutdown to avoid leaking
 // system resources.
 func Kretprobe(symbol string, prog *ebpf.Program) (Link, error) {
+	return KretprobeWithOptions(symbol, prog, nil)
+}
+
+// KretprobeWithOptions is like Kretprobe, but allows passing additional
+// parameters. opts may be nil.
+func KretprobeWithOptions(symbol string, prog *ebpf.Program, opts *KprobeOptions) (Link, error) {
 	k, err := kprobe(symbol, prog, true)
 	if err != nil {
 		return nil, err
 	}
 
-	err = k.attach(prog)
+	err = k.attach(prog, opts.cookie())
 	if err != nil {
 		k.Close()
 		return nil, err
@@ -63,6 +85,13 @@ func Kretprobe(symbol string, prog *ebpf.Program) (Link, error) {
 	return k, nil
 }
 
+func (ko *KprobeOptions) cookie() uint64 {
+	if ko == nil {
+		return 0
+	}
+	return ko.Cookie
+}
+
 // kprobe opens a perf event on the given symbol and attaches prog to it.
 // If ret is true, create a kretprobe.
 func kprobe(symbol string, prog *ebpf.Program, ret bool) (*perfEvent, error) {
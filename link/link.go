@@ -41,6 +41,26 @@ type Link interface {
 // ID uniquely identifies a BPF link.
 type ID uint32
 
+// Direction of network traffic.
+type Direction int
+
+// Valid Directions.
+const (
+	Ingress Direction = iota
+	Egress
+)
+
+func (dir Direction) String() string {
+	switch dir {
+	case Ingress:
+		return "ingress"
+	case Egress:
+		return "egress"
+	default:
+		return fmt.Sprintf("Direction(%d)", int(dir))
+	}
+}
+
 // RawLinkOptions control the creation of a raw link.
 type RawLinkOptions struct {
 	// File descriptor to attach to. This differs for each attach type.
@@ -0,0 +1,169 @@
+package link
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal/netlink"
+)
+
+// LWTOptions control how a lightweight tunnel program is attached.
+type LWTOptions struct {
+	// Program must be a LWTIn, LWTOut or LWTXmit program.
+	Program *ebpf.Program
+	// Destination of the route, either IPv4 or IPv6.
+	Destination *net.IPNet
+	// Index of the network interface the route sends packets to.
+	Interface int
+	// Name is an arbitrary description shown by "ip route". Defaults to
+	// the type of the program. The ID of the program is appended if
+	// available.
+	Name string
+	// Headroom reserves space for headers pushed by a LWTXmit program.
+	Headroom uint32
+}
+
+// AttachLWT adds a route which runs a program for all packets it matches,
+// equivalent to "ip route add ... encap bpf".
+//
+// LWTIn programs run for packets received via the route, LWTOut programs
+// for packets sent by local processes and LWTXmit programs for all packets
+// before they are transmitted.
+//
+// Fails if the route already exists. Closing the link removes the route.
+func AttachLWT(opts LWTOptions) (Link, error) {
+	var hook uint16
+	switch t := opts.Program.Type(); t {
+	case ebpf.LWTIn:
+		hook = netlink.LWT_BPF_IN
+	case ebpf.LWTOut:
+		hook = netlink.LWT_BPF_OUT
+	case ebpf.LWTXmit:
+		hook = netlink.LWT_BPF_XMIT
+	default:
+		return nil, fmt.Errorf("invalid program type %s, expected LWTIn, LWTOut or LWTXmit", t)
+	}
+
+	if opts.Destination == nil {
+		return nil, errors.New("missing destination")
+	}
+
+	if opts.Interface < 1 {
+		return nil, fmt.Errorf("invalid interface index: %d", opts.Interface)
+	}
+
+	if opts.Headroom != 0 && hook != netlink.LWT_BPF_XMIT {
+		return nil, errors.New("headroom is only valid for LWTXmit programs")
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = opts.Program.Type().String()
+	}
+
+	prog, err := opts.Program.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := netlink.Dial()
+	if err != nil {
+		prog.Close()
+		return nil, fmt.Errorf("lwt: %w", err)
+	}
+
+	lwt := &lwtRoute{
+		conn:     conn,
+		route:    netlink.Route{Dst: opts.Destination, Interface: opts.Interface},
+		hook:     hook,
+		name:     name,
+		headroom: opts.Headroom,
+		current:  prog,
+	}
+
+	if err := lwt.add(prog, false); err != nil {
+		conn.Close()
+		prog.Close()
+		return nil, fmt.Errorf("lwt: %w", err)
+	}
+
+	return lwt, nil
+}
+
+// lwtRoute is a route with a lightweight tunnel program. It can't be
+// pinned.
+type lwtRoute struct {
+	conn     *netlink.Conn
+	route    netlink.Route
+	hook     uint16
+	name     string
+	headroom uint32
+	current  *ebpf.Program
+}
+
+var _ Link = (*lwtRoute)(nil)
+
+func (lwt *lwtRoute) isLink() {}
+
+func (lwt *lwtRoute) add(prog *ebpf.Program, replace bool) error {
+	// The kernel compares programs by name when deduplicating routes, and
+	// would keep using the previous program if the name didn't change.
+	name := lwt.name
+	if info, err := prog.Info(); err == nil {
+		if id, ok := info.ID(); ok {
+			name = fmt.Sprintf("%s#%d", name, id)
+		}
+	}
+
+	return lwt.conn.AddLWTRoute(lwt.route, netlink.LWTProgram{
+		Hook:     lwt.hook,
+		FD:       prog.FD(),
+		Name:     name,
+		Headroom: lwt.headroom,
+	}, replace)
+}
+
+// Update atomically replaces the route with one running prog.
+func (lwt *lwtRoute) Update(prog *ebpf.Program) error {
+	if prog == nil {
+		return errors.New("can't update lwt: nil program")
+	}
+
+	if prog.Type() != lwt.current.Type() {
+		return fmt.Errorf("can't update lwt: invalid program type %s, expected %s", prog.Type(), lwt.current.Type())
+	}
+
+	new, err := prog.Clone()
+	if err != nil {
+		return err
+	}
+
+	if err := lwt.add(new, true); err != nil {
+		new.Close()
+		return fmt.Errorf("can't update lwt: %w", err)
+	}
+
+	lwt.current.Close()
+	lwt.current = new
+	return nil
+}
+
+func (lwt *lwtRoute) Close() error {
+	defer lwt.conn.Close()
+	defer lwt.current.Close()
+
+	if err := lwt.conn.DelRoute(lwt.route); err != nil {
+		return fmt.Errorf("close lwt: %w", err)
+	}
+	return nil
+}
+
+func (lwt *lwtRoute) Pin(string) error {
+	return fmt.Errorf("can't pin lwt: %w", ErrNotSupported)
+}
+
+func (lwt *lwtRoute) Unpin() error {
+	return fmt.Errorf("can't pin lwt: %w", ErrNotSupported)
+}
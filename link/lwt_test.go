@@ -0,0 +1,115 @@
+package link
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal/testutils"
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+func TestAttachLWT(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "4.10", "lwt")
+
+	iface, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skip("No loopback interface:", err)
+	}
+
+	// TEST-NET-2, see RFC 5737.
+	_, dst, _ := net.ParseCIDR("198.51.100.1/32")
+
+	pass, drop := mustLWTXmitProgram(t, 0), mustLWTXmitProgram(t, 2)
+
+	link, err := AttachLWT(LWTOptions{
+		Program:     drop,
+		Destination: dst,
+		Interface:   iface.Index,
+	})
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal("Can't attach program:", err)
+	}
+
+	_, err = AttachLWT(LWTOptions{
+		Program:     pass,
+		Destination: dst,
+		Interface:   iface.Index,
+	})
+	if !errors.Is(err, unix.EEXIST) {
+		t.Error("Attaching to an existing route doesn't return EEXIST:", err)
+	}
+
+	if err := sendUDP(dst.IP); !errors.Is(err, unix.EPERM) {
+		t.Error("Sending with BPF_DROP doesn't return EPERM:", err)
+	}
+
+	if err := link.Update(pass); err != nil {
+		t.Fatal("Can't update program:", err)
+	}
+
+	if err := sendUDP(dst.IP); err != nil {
+		t.Error("Can't send with BPF_OK:", err)
+	}
+
+	testLink(t, link, testLinkOptions{prog: pass})
+
+	_, err = AttachLWT(LWTOptions{
+		Program:     mustXDPProgram(t),
+		Destination: dst,
+		Interface:   iface.Index,
+	})
+	if err == nil {
+		t.Error("Attaching a program of the wrong type doesn't return an error")
+	}
+
+	_, err = AttachLWT(LWTOptions{
+		Program:     mustLWTProgram(t, ebpf.LWTIn, 0),
+		Destination: dst,
+		Interface:   iface.Index,
+		Headroom:    16,
+	})
+	if err == nil {
+		t.Error("Headroom for a LWTIn program doesn't return an error")
+	}
+}
+
+func mustLWTXmitProgram(t *testing.T, verdict int32) *ebpf.Program {
+	t.Helper()
+	return mustLWTProgram(t, ebpf.LWTXmit, verdict)
+}
+
+func mustLWTProgram(t *testing.T, typ ebpf.ProgramType, verdict int32) *ebpf.Program {
+	t.Helper()
+
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Type:    typ,
+		License: "MIT",
+		Instructions: asm.Instructions{
+			asm.Mov.Imm(asm.R0, verdict),
+			asm.Return(),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { prog.Close() })
+
+	return prog
+}
+
+// sendUDP sends a datagram to the discard port of ip. A new socket is used
+// for every call, since sockets cache their route.
+func sendUDP(ip net.IP) error {
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: ip, Port: 9})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("foo"))
+	return err
+}
@@ -71,6 +71,10 @@ type perfEvent struct {
 
 	fd       *internal.FD
 	progType ebpf.ProgramType
+
+	// The bpf_link which attaches the program, if it was attached
+	// with a cookie.
+	link *internal.FD
 }
 
 func (pe *perfEvent) isLink() {}
@@ -112,6 +116,12 @@ func (pe *perfEvent) Close() error {
 		return fmt.Errorf("disabling perf event: %w", err)
 	}
 
+	if pe.link != nil {
+		if err := pe.link.Close(); err != nil {
+			return fmt.Errorf("closing perf event link: %w", err)
+		}
+	}
+
 	err = pe.fd.Close()
 	if err != nil {
 		return fmt.Errorf("closing perf event fd: %w", err)
@@ -134,7 +144,10 @@ func (pe *perfEvent) Close() error {
 // attach the given eBPF prog to the perf event stored in pe.
 // pe must contain a valid perf event fd.
 // prog's type must match the program type stored in pe.
-func (pe *perfEvent) attach(prog *ebpf.Program) error {
+//
+// A non-zero cookie is made available to prog via bpf_get_attach_cookie,
+// which requires attaching via BPF_LINK_CREATE.
+func (pe *perfEvent) attach(prog *ebpf.Program, cookie uint64) error {
 	if prog == nil {
 		return errors.New("cannot attach a nil program")
 	}
@@ -151,10 +164,27 @@ func (pe *perfEvent) attach(prog *ebpf.Program) error {
 	// The ioctl below will fail when the fd is invalid.
 	kfd, _ := pe.fd.Value()
 
-	// Assign the eBPF program to the perf event.
-	err := unix.IoctlSetInt(int(kfd), unix.PERF_EVENT_IOC_SET_BPF, prog.FD())
-	if err != nil {
-		return fmt.Errorf("setting perf event bpf program: %w", err)
+	if cookie != 0 {
+		if err := haveBPFLinkPerfEvent(); err != nil {
+			return fmt.Errorf("bpf cookie: %w", err)
+		}
+
+		link, err := bpfLinkCreatePerfEvent(&bpfLinkCreatePerfEventAttr{
+			progFd:     uint32(prog.FD()),
+			targetFd:   kfd,
+			attachType: ebpf.AttachPerfEvent,
+			bpfCookie:  cookie,
+		})
+		if err != nil {
+			return fmt.Errorf("creating perf event link: %w", err)
+		}
+		pe.link = link
+	} else {
+		// Assign the eBPF program to the perf event.
+		err := unix.IoctlSetInt(int(kfd), unix.PERF_EVENT_IOC_SET_BPF, prog.FD())
+		if err != nil {
+			return fmt.Errorf("setting perf event bpf program: %w", err)
+		}
 	}
 
 	// PERF_EVENT_IOC_ENABLE and _DISABLE ignore their given values.
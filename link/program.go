@@ -16,7 +16,8 @@ type RawAttachProgramOptions struct {
 	Replace *ebpf.Program
 	// Attach must match the attach type of Program (and Replace).
 	Attach ebpf.AttachType
-	// Flags control the attach behaviour. This differs for each attach type.
+	// Flags control the attach behaviour. This differs for each attach type,
+	// see CgroupAttachFlags for cgroups.
 	Flags uint32
 }
 
@@ -0,0 +1,95 @@
+package link
+
+import (
+	"fmt"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal/netlink"
+)
+
+// XDPProgram is an XDP program attached to a network interface.
+type XDPProgram struct {
+	ID ebpf.ProgramID
+	// Mode is one of XDPGenericMode, XDPDriverMode or XDPOffloadMode.
+	Mode XDPAttachFlags
+}
+
+// QueryXDP returns the XDP programs attached to a network interface,
+// regardless of whether they were attached by this package or other
+// tooling. There is at most one program per mode.
+func QueryXDP(ifindex int) ([]XDPProgram, error) {
+	conn, err := netlink.Dial()
+	if err != nil {
+		return nil, fmt.Errorf("query xdp: %w", err)
+	}
+	defer conn.Close()
+
+	info, err := conn.XDP(ifindex)
+	if err != nil {
+		return nil, fmt.Errorf("query xdp: %w", err)
+	}
+
+	var progs []XDPProgram
+	for _, prog := range []XDPProgram{
+		{ebpf.ProgramID(info.GenericProgramID), XDPGenericMode},
+		{ebpf.ProgramID(info.DriverProgramID), XDPDriverMode},
+		{ebpf.ProgramID(info.OffloadProgramID), XDPOffloadMode},
+	} {
+		if prog.ID != 0 {
+			progs = append(progs, prog)
+		}
+	}
+	return progs, nil
+}
+
+// TCFilter is a BPF classifier attached to the clsact qdisc of a network
+// interface.
+type TCFilter struct {
+	ID        ebpf.ProgramID
+	Direction Direction
+	// Name is the description given when attaching the filter,
+	// usually the ELF file and section the program was loaded from.
+	Name     string
+	Handle   uint32
+	Priority uint16
+	// DirectAction is true if the return value of the program is used
+	// as the action of the filter.
+	DirectAction bool
+}
+
+// QueryTC returns the BPF classifiers attached to the clsact qdisc of a
+// network interface, as done by "tc filter add ... bpf".
+//
+// Returns an empty slice if the interface doesn't have a clsact qdisc.
+func QueryTC(ifindex int) ([]TCFilter, error) {
+	conn, err := netlink.Dial()
+	if err != nil {
+		return nil, fmt.Errorf("query tc: %w", err)
+	}
+	defer conn.Close()
+
+	var filters []TCFilter
+	for _, dir := range []Direction{Ingress, Egress} {
+		parent := uint32(netlink.TC_H_INGRESS)
+		if dir == Egress {
+			parent = netlink.TC_H_EGRESS
+		}
+
+		bpfFilters, err := conn.BPFFilters(ifindex, parent)
+		if err != nil {
+			return nil, fmt.Errorf("query tc %s: %w", dir, err)
+		}
+
+		for _, f := range bpfFilters {
+			filters = append(filters, TCFilter{
+				ID:           ebpf.ProgramID(f.ProgramID),
+				Direction:    dir,
+				Name:         f.Name,
+				Handle:       f.Handle,
+				Priority:     f.Priority,
+				DirectAction: f.DirectAction,
+			})
+		}
+	}
+	return filters, nil
+}
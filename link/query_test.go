@@ -0,0 +1,124 @@
+package link
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal/netlink"
+	"github.com/cilium/ebpf/internal/testutils"
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+func TestQueryXDP(t *testing.T) {
+	prog, ifindex := mustXDPFixtures(t)
+
+	progs, err := QueryXDP(ifindex)
+	if err != nil {
+		t.Fatal("Can't query XDP:", err)
+	}
+	if len(progs) != 0 {
+		t.Fatal("Expected no programs, got", progs)
+	}
+
+	link, err := AttachXDP(XDPOptions{
+		Program:   prog,
+		Interface: ifindex,
+		Flags:     XDPGenericMode,
+	})
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer link.Close()
+
+	info, err := prog.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := info.ID()
+
+	progs, err = QueryXDP(ifindex)
+	if err != nil {
+		t.Fatal("Can't query XDP:", err)
+	}
+	if len(progs) != 1 || progs[0] != (XDPProgram{id, XDPGenericMode}) {
+		t.Errorf("Expected program %d in generic mode, got %v", id, progs)
+	}
+}
+
+func TestQueryTC(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "4.5", "clsact qdisc")
+
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skip("No loopback interface:", err)
+	}
+
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Type:    ebpf.SchedCLS,
+		License: "MIT",
+		Instructions: asm.Instructions{
+			// TC_ACT_OK
+			asm.Mov.Imm(asm.R0, 0),
+			asm.Return(),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer prog.Close()
+
+	conn, err := netlink.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	err = conn.AddClsact(lo.Index)
+	if errors.Is(err, unix.EEXIST) {
+		t.Skip("lo already has a clsact qdisc")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.DelClsact(lo.Index)
+
+	filter := netlink.BPFFilter{Handle: 1, Priority: 1, Name: "test", DirectAction: true}
+	if err := conn.AddBPFFilter(lo.Index, netlink.TC_H_EGRESS, filter, prog.FD()); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := prog.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := info.ID()
+
+	filters, err := QueryTC(lo.Index)
+	if err != nil {
+		t.Fatal("Can't query TC:", err)
+	}
+
+	want := TCFilter{
+		ID:           id,
+		Direction:    Egress,
+		Name:         "test",
+		Handle:       1,
+		Priority:     1,
+		DirectAction: true,
+	}
+	if len(filters) != 1 || filters[0] != want {
+		t.Errorf("Expected %+v, got %+v", want, filters)
+	}
+
+	if err := conn.DelBPFFilter(lo.Index, netlink.TC_H_EGRESS, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if filters, err := QueryTC(lo.Index); err != nil || len(filters) != 0 {
+		t.Error("Filter is still attached after removing it:", filters, err)
+	}
+}
@@ -1,10 +1,12 @@
 package link
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/unix"
 )
 
 type RawTracepointOptions struct {
@@ -16,9 +18,15 @@ type RawTracepointOptions struct {
 
 // AttachRawTracepoint links a BPF program to a raw_tracepoint.
 //
-// Requires at least Linux 4.17.
+// RawTracepointWritable programs may modify the buffer passed as the first
+// argument of the few tracepoints which allow it, like nbd_send_request.
+// Attaching them fails if the tracepoint isn't writable or the program
+// accesses more of the buffer than the tracepoint allows.
+//
+// Requires at least Linux 4.17, or Linux 5.2 for writable programs.
 func AttachRawTracepoint(opts RawTracepointOptions) (Link, error) {
-	if t := opts.Program.Type(); t != ebpf.RawTracepoint && t != ebpf.RawTracepointWritable {
+	t := opts.Program.Type()
+	if t != ebpf.RawTracepoint && t != ebpf.RawTracepointWritable {
 		return nil, fmt.Errorf("invalid program type %s, expected RawTracepoint(Writable)", t)
 	}
 	if opts.Program.FD() < 0 {
@@ -29,6 +37,9 @@ func AttachRawTracepoint(opts RawTracepointOptions) (Link, error) {
 		name: internal.NewStringPointer(opts.Name),
 		fd:   uint32(opts.Program.FD()),
 	})
+	if t == ebpf.RawTracepointWritable && errors.Is(err, unix.EINVAL) {
+		return nil, fmt.Errorf("raw_tracepoint %s isn't writable or too small for the program: %w", opts.Name, err)
+	}
 	if err != nil {
 		return nil, err
 	}
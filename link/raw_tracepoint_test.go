@@ -1,11 +1,13 @@
 package link
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/asm"
 	"github.com/cilium/ebpf/internal/testutils"
+	"github.com/cilium/ebpf/internal/unix"
 )
 
 func TestRawTracepoint(t *testing.T) {
@@ -67,3 +69,31 @@ func TestRawTracepoint_writable(t *testing.T) {
 		prog: prog,
 	})
 }
+
+func TestRawTracepoint_writableBuffer(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.2", "BPF_RAW_TRACEPOINT_WRITABLE API")
+
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Type: ebpf.RawTracepointWritable,
+		Instructions: asm.Instructions{
+			// Write to the first four bytes of the writable buffer.
+			asm.LoadMem(asm.R1, asm.R1, 0, asm.DWord),
+			asm.StoreImm(asm.R1, 0, 0, asm.Word),
+			asm.Mov.Imm(asm.R0, 0),
+			asm.Return(),
+		},
+		License: "GPL",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer prog.Close()
+
+	_, err = AttachRawTracepoint(RawTracepointOptions{
+		Name:    "cgroup_rmdir",
+		Program: prog,
+	})
+	if !errors.Is(err, unix.EINVAL) {
+		t.Fatal("Attaching to a tracepoint which isn't writable doesn't return EINVAL:", err)
+	}
+}
@@ -0,0 +1,102 @@
+package link
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+// AttachReuseport attaches an SkReuseport program to the SO_REUSEPORT group
+// of a socket. The program selects which socket of the group receives a
+// new connection or packet, usually by calling bpf_sk_select_reuseport
+// with a ReusePortSockArray map holding the sockets of the group.
+//
+// The program returns SK_PASS to use the selected socket, or the socket
+// picked by the kernel if none was selected, and SK_DROP to drop the
+// connection or packet.
+//
+// fd must have SO_REUSEPORT set, and is duplicated by the returned Link.
+// Closing the Link requires at least Linux 5.3, older kernels detach the
+// program when all sockets of the group are closed.
+func AttachReuseport(fd int, prog *ebpf.Program) (Link, error) {
+	if t := prog.Type(); t != ebpf.SkReuseport {
+		return nil, fmt.Errorf("invalid program type %s, expected SkReuseport", t)
+	}
+
+	dup, err := unix.FcntlInt(uintptr(fd), unix.F_DUPFD_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("can't dup socket: %w", err)
+	}
+	sock := internal.NewFD(uint32(dup))
+
+	rp := &reuseportLink{sock}
+	if err := rp.attach(prog); err != nil {
+		sock.Close()
+		return nil, fmt.Errorf("reuseport: %w", err)
+	}
+
+	return rp, nil
+}
+
+type reuseportLink struct {
+	sock *internal.FD
+}
+
+var _ Link = (*reuseportLink)(nil)
+
+func (rp *reuseportLink) isLink() {}
+
+func (rp *reuseportLink) attach(prog *ebpf.Program) error {
+	sock, err := rp.sock.Value()
+	if err != nil {
+		return err
+	}
+
+	progFd := prog.FD()
+	if progFd < 0 {
+		return fmt.Errorf("invalid program: %s", internal.ErrClosedFd)
+	}
+
+	return unix.SetsockoptInt(int(sock), unix.SOL_SOCKET, unix.SO_ATTACH_REUSEPORT_EBPF, progFd)
+}
+
+// Update atomically replaces the program of the group.
+func (rp *reuseportLink) Update(prog *ebpf.Program) error {
+	if prog == nil {
+		return errors.New("can't update reuseport: nil program")
+	}
+
+	if err := rp.attach(prog); err != nil {
+		return fmt.Errorf("can't update reuseport: %w", err)
+	}
+	return nil
+}
+
+func (rp *reuseportLink) Close() error {
+	defer rp.sock.Close()
+
+	sock, err := rp.sock.Value()
+	if err != nil {
+		return fmt.Errorf("close reuseport: %w", err)
+	}
+
+	err = unix.SetsockoptInt(int(sock), unix.SOL_SOCKET, unix.SO_DETACH_REUSEPORT_BPF, 0)
+	if errors.Is(err, unix.ENOPROTOOPT) {
+		return fmt.Errorf("close reuseport: %w", ErrNotSupported)
+	}
+	if err != nil {
+		return fmt.Errorf("close reuseport: %w", err)
+	}
+	return nil
+}
+
+func (rp *reuseportLink) Pin(string) error {
+	return fmt.Errorf("can't pin reuseport: %w", ErrNotSupported)
+}
+
+func (rp *reuseportLink) Unpin() error {
+	return fmt.Errorf("can't pin reuseport: %w", ErrNotSupported)
+}
@@ -0,0 +1,134 @@
+package link
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal/testutils"
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+func TestAttachReuseport(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "4.19", "sk_reuseport")
+
+	sockets, err := ebpf.NewMap(&ebpf.MapSpec{
+		Type:       ebpf.ReusePortSockArray,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sockets.Close()
+
+	first := mustReuseportUDP(t, "127.0.0.1:0")
+	second := mustReuseportUDP(t, first.LocalAddr().String())
+
+	for i, conn := range []*net.UDPConn{first, second} {
+		if err := sockets.Put(uint32(i), uint32(mustFD(t, conn))); err != nil {
+			t.Fatal("Can't add socket to map:", err)
+		}
+	}
+
+	link, err := AttachReuseport(mustFD(t, first), mustReuseportProgram(t, sockets, 1))
+	if err != nil {
+		t.Fatal("Can't attach program:", err)
+	}
+
+	mustReceive(t, first.LocalAddr(), second)
+
+	prog := mustReuseportProgram(t, sockets, 0)
+	if err := link.Update(prog); err != nil {
+		t.Fatal("Can't update program:", err)
+	}
+
+	mustReceive(t, first.LocalAddr(), first)
+
+	testLink(t, link, testLinkOptions{prog: prog})
+
+	if _, err := AttachReuseport(mustFD(t, first), mustXDPProgram(t)); err == nil {
+		t.Error("Attaching a program of the wrong type doesn't return an error")
+	}
+}
+
+func mustReuseportProgram(t *testing.T, sockets *ebpf.Map, key int32) *ebpf.Program {
+	t.Helper()
+
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Type:    ebpf.SkReuseport,
+		License: "MIT",
+		Instructions: asm.Instructions{
+			asm.StoreImm(asm.RFP, -4, int64(key), asm.Word),
+			asm.LoadMapPtr(asm.R2, sockets.FD()),
+			asm.Mov.Reg(asm.R3, asm.RFP),
+			asm.Add.Imm(asm.R3, -4),
+			asm.Mov.Imm(asm.R4, 0),
+			asm.FnSkSelectReuseport.Call(),
+			// SK_PASS
+			asm.Mov.Imm(asm.R0, 1),
+			asm.Return(),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { prog.Close() })
+
+	return prog
+}
+
+func mustReuseportUDP(t *testing.T, addr string) *net.UDPConn {
+	t.Helper()
+
+	lc := net.ListenConfig{
+		Control: func(_, _ string, c syscall.RawConn) error {
+			var err error
+			cerr := c.Control(func(fd uintptr) {
+				err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+			})
+			if cerr != nil {
+				return cerr
+			}
+			return err
+		},
+	}
+
+	conn, err := lc.ListenPacket(context.Background(), "udp4", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn.(*net.UDPConn)
+}
+
+// mustReceive sends a datagram to addr and checks that it is received by
+// conn.
+func mustReceive(t *testing.T, addr net.Addr, conn *net.UDPConn) {
+	t.Helper()
+
+	client, err := net.Dial("udp4", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err := client.Write([]byte("foo")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 3)
+	if _, err := conn.Read(buf); err != nil || string(buf) != "foo" {
+		t.Fatalf("Expected foo, got %q (%v)", buf, err)
+	}
+}
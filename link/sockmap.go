@@ -0,0 +1,120 @@
+package link
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cilium/ebpf"
+)
+
+// AttachSkMsg attaches an SkMsg program to a SockMap or SockHash. The
+// program is invoked for each sendmsg or sendfile on a socket stored in
+// the map.
+//
+// The program returns SK_PASS to send the message or SK_DROP to fail the
+// call with EACCES. Helpers like bpf_msg_redirect_map allow it to redirect
+// the message to another socket in a map, bypassing the network stack.
+//
+// Sockets use the program which was attached when they were added to the
+// map.
+//
+// Requires at least Linux 4.17.
+func AttachSkMsg(sockmap *ebpf.Map, prog *ebpf.Program) (Link, error) {
+	if t := prog.Type(); t != ebpf.SkMsg {
+		return nil, fmt.Errorf("invalid program type %s, expected SkMsg", t)
+	}
+
+	return newProgAttachMap(sockmap, ebpf.AttachSkMsgVerdict, prog)
+}
+
+// progAttachMap is a program attached to a map via BPF_PROG_ATTACH. It
+// can't be pinned.
+type progAttachMap struct {
+	m          *ebpf.Map
+	current    *ebpf.Program
+	attachType ebpf.AttachType
+}
+
+var _ Link = (*progAttachMap)(nil)
+
+func newProgAttachMap(m *ebpf.Map, attach ebpf.AttachType, prog *ebpf.Program) (*progAttachMap, error) {
+	if t := m.Type(); t != ebpf.SockMap && t != ebpf.SockHash {
+		return nil, fmt.Errorf("invalid map type %s, expected SockMap or SockHash", t)
+	}
+
+	m, err := m.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	prog, err = prog.Clone()
+	if err != nil {
+		m.Close()
+		return nil, err
+	}
+
+	err = RawAttachProgram(RawAttachProgramOptions{
+		Target:  m.FD(),
+		Program: prog,
+		Attach:  attach,
+	})
+	if err != nil {
+		m.Close()
+		prog.Close()
+		return nil, fmt.Errorf("sockmap: %w", err)
+	}
+
+	return &progAttachMap{m, prog, attach}, nil
+}
+
+func (pm *progAttachMap) isLink() {}
+
+// Update replaces the program. Sockets which are already in the map keep
+// using the previous program until they are removed.
+func (pm *progAttachMap) Update(prog *ebpf.Program) error {
+	if prog == nil {
+		return errors.New("can't update sockmap: nil program")
+	}
+
+	new, err := prog.Clone()
+	if err != nil {
+		return err
+	}
+
+	err = RawAttachProgram(RawAttachProgramOptions{
+		Target:  pm.m.FD(),
+		Program: new,
+		Attach:  pm.attachType,
+	})
+	if err != nil {
+		new.Close()
+		return fmt.Errorf("can't update sockmap: %w", err)
+	}
+
+	pm.current.Close()
+	pm.current = new
+	return nil
+}
+
+func (pm *progAttachMap) Close() error {
+	defer pm.m.Close()
+	defer pm.current.Close()
+
+	err := RawDetachProgram(RawDetachProgramOptions{
+		Target:  pm.m.FD(),
+		Program: pm.current,
+		Attach:  pm.attachType,
+	})
+	if err != nil {
+		return fmt.Errorf("close sockmap: %w", err)
+	}
+	return nil
+}
+
+func (pm *progAttachMap) Pin(string) error {
+	return fmt.Errorf("can't pin sockmap: %w", ErrNotSupported)
+}
+
+func (pm *progAttachMap) Unpin() error {
+	return fmt.Errorf("can't pin sockmap: %w", ErrNotSupported)
+}
@@ -0,0 +1,143 @@
+package link
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal/testutils"
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+func TestAttachSkMsg(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "4.17", "sk_msg")
+
+	sockmap, err := ebpf.NewMap(&ebpf.MapSpec{
+		Type:       ebpf.SockMap,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sockmap.Close()
+
+	pass, drop := mustSkMsgProgram(t, 1), mustSkMsgProgram(t, 0)
+
+	link, err := AttachSkMsg(sockmap, pass)
+	if err != nil {
+		t.Fatal("Can't attach program:", err)
+	}
+
+	client, server := mustTCPPair(t)
+	if err := sockmap.Put(uint32(0), uint32(mustFD(t, client))); err != nil {
+		t.Fatal("Can't add socket to map:", err)
+	}
+
+	if _, err := client.Write([]byte("foo")); err != nil {
+		t.Fatal("Can't send with SK_PASS:", err)
+	}
+	buf := make([]byte, 3)
+	if _, err := server.Read(buf); err != nil || string(buf) != "foo" {
+		t.Fatalf("Expected foo, got %q (%v)", buf, err)
+	}
+
+	if err := link.Update(drop); err != nil {
+		t.Fatal("Can't update program:", err)
+	}
+
+	// Sockets use the program which was attached when they were added.
+	if err := sockmap.Delete(uint32(0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := sockmap.Put(uint32(0), uint32(mustFD(t, client))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Write([]byte("bar")); !errors.Is(err, unix.EACCES) {
+		t.Error("Sending with SK_DROP doesn't return EACCES:", err)
+	}
+
+	testLink(t, link, testLinkOptions{prog: pass})
+
+	hash, err := ebpf.NewMap(&ebpf.MapSpec{
+		Type:       ebpf.Hash,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hash.Close()
+
+	if _, err := AttachSkMsg(hash, pass); err == nil {
+		t.Error("Attaching to a hash map doesn't return an error")
+	}
+	if _, err := AttachSkMsg(sockmap, mustXDPProgram(t)); err == nil {
+		t.Error("Attaching a program of the wrong type doesn't return an error")
+	}
+}
+
+func mustSkMsgProgram(t *testing.T, verdict int32) *ebpf.Program {
+	t.Helper()
+
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Type:       ebpf.SkMsg,
+		AttachType: ebpf.AttachSkMsgVerdict,
+		License:    "MIT",
+		Instructions: asm.Instructions{
+			asm.Mov.Imm(asm.R0, verdict),
+			asm.Return(),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { prog.Close() })
+
+	return prog
+}
+
+func mustTCPPair(t *testing.T) (net.Conn, net.Conn) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	client, err := net.Dial("tcp4", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	server, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	return client, server
+}
+
+func mustFD(t *testing.T, conn net.Conn) int {
+	t.Helper()
+
+	raw, err := conn.(syscall.Conn).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fd int
+	err = raw.Control(func(f uintptr) { fd = int(f) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fd
+}
@@ -0,0 +1,105 @@
+package link
+
+import (
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+)
+
+// AttachSockOps attaches a SockOps program to a cgroup. The program is
+// invoked for events on TCP connections of processes in the cgroup and
+// its descendants, see SockOpsOp.
+//
+// See AttachCgroup for how the program is attached.
+func AttachSockOps(cgroupPath string, prog *ebpf.Program) (Link, error) {
+	return attachCgroupProgram(cgroupPath, ebpf.AttachCGroupSockOps, prog)
+}
+
+// SockOpsOp is the reason a SockOps program is invoked, stored in the op
+// field of struct bpf_sock_ops.
+//
+// Equivalent to the BPF_SOCK_OPS_* values in the kernel's UAPI.
+type SockOpsOp uint32
+
+// Valid SockOpsOps.
+const (
+	SockOpsVoid SockOpsOp = iota
+	SockOpsTimeoutInit
+	SockOpsRwndInit
+	SockOpsTCPConnect
+	SockOpsActiveEstablished
+	SockOpsPassiveEstablished
+	SockOpsNeedsECN
+	SockOpsBaseRTT
+	// Requires SockOpsRTOCallback.
+	SockOpsRTO
+	// Requires SockOpsRetransCallback.
+	SockOpsRetrans
+	// Requires SockOpsStateCallback.
+	SockOpsState
+	SockOpsTCPListen
+	// Requires SockOpsRTTCallback.
+	SockOpsRTT
+	SockOpsParseHeaderOption
+	SockOpsHeaderOptionLen
+	// Requires SockOpsWriteHeaderOptionsCallback.
+	SockOpsWriteHeaderOption
+)
+
+// SockOpsOpOffset is the offset of the op field in struct bpf_sock_ops.
+const SockOpsOpOffset = 0
+
+// SockOpsCallbackFlags enable additional invocations of a SockOps program
+// for a single connection. They can only be set from the program itself,
+// usually when a connection is established, see Instructions.
+//
+// Equivalent to the BPF_SOCK_OPS_*_CB_FLAG values in the kernel's UAPI.
+type SockOpsCallbackFlags uint32
+
+// Valid SockOpsCallbackFlags.
+const (
+	// SockOpsRTOCallback invokes the program with SockOpsRTO when a
+	// retransmission timeout fires.
+	SockOpsRTOCallback SockOpsCallbackFlags = 1 << iota
+	// SockOpsRetransCallback invokes the program with SockOpsRetrans
+	// when a segment is retransmitted.
+	SockOpsRetransCallback
+	// SockOpsStateCallback invokes the program with SockOpsState when
+	// the state of the connection changes.
+	SockOpsStateCallback
+	// SockOpsRTTCallback invokes the program with SockOpsRTT for every
+	// RTT sample.
+	//
+	// Requires at least Linux 5.6.
+	SockOpsRTTCallback
+	// SockOpsParseAllHeaderOptionsCallback invokes the program with
+	// SockOpsParseHeaderOption for all TCP header options.
+	//
+	// Requires at least Linux 5.10.
+	SockOpsParseAllHeaderOptionsCallback
+	// SockOpsParseUnknownHeaderOptionsCallback invokes the program with
+	// SockOpsParseHeaderOption for TCP header options unknown to the
+	// kernel.
+	//
+	// Requires at least Linux 5.10.
+	SockOpsParseUnknownHeaderOptionsCallback
+	// SockOpsWriteHeaderOptionsCallback invokes the program with
+	// SockOpsHeaderOptionLen and SockOpsWriteHeaderOption to add TCP
+	// header options.
+	//
+	// Requires at least Linux 5.10.
+	SockOpsWriteHeaderOptionsCallback
+)
+
+// Instructions returns instructions which replace the callback flags of the
+// connection with flags by calling bpf_sock_ops_cb_flags_set.
+//
+// ctx must hold the pointer to struct bpf_sock_ops passed to the program.
+// R0 holds the result of the helper, which is zero on success and the
+// unsupported flags otherwise. R1 to R5 are clobbered.
+func (flags SockOpsCallbackFlags) Instructions(ctx asm.Register) asm.Instructions {
+	return asm.Instructions{
+		asm.Mov.Reg(asm.R1, ctx),
+		asm.Mov.Imm(asm.R2, int32(flags)),
+		asm.FnSockOpsCbFlagsSet.Call(),
+	}
+}
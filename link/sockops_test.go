@@ -0,0 +1,48 @@
+package link
+
+import (
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal/testutils"
+)
+
+func TestAttachSockOps(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "4.13", "sock_ops")
+
+	cgroup, _ := mustCgroupFixtures(t)
+
+	flags := SockOpsRTOCallback | SockOpsRetransCallback | SockOpsStateCallback
+	insns := asm.Instructions{
+		asm.Mov.Reg(asm.R6, asm.R1),
+		asm.LoadMem(asm.R2, asm.R6, SockOpsOpOffset, asm.Word),
+		asm.JNE.Imm(asm.R2, int32(SockOpsActiveEstablished), "out"),
+	}
+	insns = append(insns, flags.Instructions(asm.R6)...)
+	insns = append(insns,
+		asm.Mov.Imm(asm.R0, 1).Sym("out"),
+		asm.Return(),
+	)
+
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Type:         ebpf.SockOps,
+		License:      "MIT",
+		Instructions: insns,
+	})
+	if err != nil {
+		t.Fatal("Can't load program setting callback flags:", err)
+	}
+	defer prog.Close()
+
+	link, err := AttachSockOps(cgroup.Name(), prog)
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal("Can't attach program:", err)
+	}
+	defer link.Close()
+
+	if ids := mustQueryCgroup(t, cgroup, ebpf.AttachCGroupSockOps); len(ids) != 1 {
+		t.Error("Expected one attached program, got", ids)
+	}
+}
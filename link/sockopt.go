@@ -0,0 +1,53 @@
+package link
+
+import (
+	"github.com/cilium/ebpf"
+)
+
+// Offsets of the fields of struct bpf_sockopt, the context of
+// CGroupSockopt programs.
+const (
+	// SockoptSkOffset is the offset of the pointer to the socket.
+	SockoptSkOffset = 0
+	// SockoptOptvalOffset and SockoptOptvalEndOffset are the offsets of
+	// the pointers to the start and end of the option value.
+	SockoptOptvalOffset    = 8
+	SockoptOptvalEndOffset = 16
+	// SockoptLevelOffset, SockoptOptnameOffset and SockoptOptlenOffset
+	// are the offsets of the s32 arguments of the system call. Setsockopt
+	// programs may overwrite them.
+	SockoptLevelOffset   = 24
+	SockoptOptnameOffset = 28
+	SockoptOptlenOffset  = 32
+	// SockoptRetvalOffset is the offset of the s32 return value of
+	// getsockopt, which getsockopt programs may overwrite.
+	SockoptRetvalOffset = 36
+)
+
+// AttachCgroupGetsockopt attaches a CGroupSockopt program loaded with
+// AttachCGroupGetsockopt to a cgroup. The program is invoked after the
+// kernel handles getsockopt for a process in the cgroup or its
+// descendants.
+//
+// The program must return 1 to pass the option value to the caller, which
+// it may modify, or 0 to fail the call with EPERM.
+//
+// See AttachCgroup for how the program is attached. Requires at least
+// Linux 5.3.
+func AttachCgroupGetsockopt(cgroupPath string, prog *ebpf.Program) (Link, error) {
+	return attachCgroupProgram(cgroupPath, ebpf.AttachCGroupGetsockopt, prog)
+}
+
+// AttachCgroupSetsockopt attaches a CGroupSockopt program loaded with
+// AttachCGroupSetsockopt to a cgroup. The program is invoked before the
+// kernel handles setsockopt for a process in the cgroup or its
+// descendants.
+//
+// The program must return 1 to continue with the, possibly modified,
+// arguments or 0 to fail the call with EPERM.
+//
+// See AttachCgroup for how the program is attached. Requires at least
+// Linux 5.3.
+func AttachCgroupSetsockopt(cgroupPath string, prog *ebpf.Program) (Link, error) {
+	return attachCgroupProgram(cgroupPath, ebpf.AttachCGroupSetsockopt, prog)
+}
@@ -0,0 +1,54 @@
+package link
+
+import (
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal/testutils"
+)
+
+func TestAttachCgroupSockopt(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.3", "cgroup sockopt")
+
+	cgroup, _ := mustCgroupFixtures(t)
+
+	for _, tc := range []struct {
+		attach ebpf.AttachType
+		fn     func(string, *ebpf.Program) (Link, error)
+	}{
+		{ebpf.AttachCGroupGetsockopt, AttachCgroupGetsockopt},
+		{ebpf.AttachCGroupSetsockopt, AttachCgroupSetsockopt},
+	} {
+		t.Run(tc.attach.String(), func(t *testing.T) {
+			// Reject options with name 42.
+			prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+				Type:       ebpf.CGroupSockopt,
+				AttachType: tc.attach,
+				License:    "MIT",
+				Instructions: asm.Instructions{
+					asm.LoadMem(asm.R2, asm.R1, SockoptOptnameOffset, asm.Word),
+					asm.Mov.Imm(asm.R0, 1),
+					asm.JNE.Imm(asm.R2, 42, "out"),
+					asm.Mov.Imm(asm.R0, 0),
+					asm.Return().Sym("out"),
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer prog.Close()
+
+			link, err := tc.fn(cgroup.Name(), prog)
+			testutils.SkipIfNotSupported(t, err)
+			if err != nil {
+				t.Fatal("Can't attach program:", err)
+			}
+			defer link.Close()
+
+			if ids := mustQueryCgroup(t, cgroup, tc.attach); len(ids) != 1 {
+				t.Error("Expected one attached program, got", ids)
+			}
+		})
+	}
+}
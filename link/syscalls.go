@@ -24,6 +24,11 @@ const (
 	IterType
 	NetNsType
 	XDPType
+	PerfEventType
+	KprobeMultiType
+	StructOpsType
+	NetfilterType
+	TCXType
 )
 
 var haveProgAttach = internal.FeatureTest("BPF_PROG_ATTACH", "4.10", func() error {
@@ -74,7 +79,7 @@ var haveProgAttachReplace = internal.FeatureTest("BPF_PROG_ATTACH atomic replace
 		TargetFd:    ^uint32(0),
 		AttachBpfFd: uint32(prog.FD()),
 		AttachType:  uint32(ebpf.AttachCGroupInetIngress),
-		AttachFlags: uint32(flagReplace),
+		AttachFlags: uint32(CgroupReplace),
 	}
 
 	err = internal.BPFProgAttach(&attr)
@@ -145,6 +150,138 @@ var haveBPFLink = internal.FeatureTest("bpf_link", "5.7", func() error {
 	return err
 })
 
+type bpfLinkCreateTracingAttr struct {
+	progFd      uint32
+	targetFd    uint32
+	attachType  ebpf.AttachType
+	flags       uint32
+	targetBTFID uint32
+	_           uint32
+	cookie      uint64
+}
+
+func bpfLinkCreateTracing(attr *bpfLinkCreateTracingAttr) (*internal.FD, error) {
+	ptr, err := internal.BPF(internal.BPF_LINK_CREATE, unsafe.Pointer(attr), unsafe.Sizeof(*attr))
+	if err != nil {
+		return nil, err
+	}
+	return internal.NewFD(uint32(ptr)), nil
+}
+
+type bpfLinkCreatePerfEventAttr struct {
+	progFd     uint32
+	targetFd   uint32
+	attachType ebpf.AttachType
+	flags      uint32
+	bpfCookie  uint64
+}
+
+func bpfLinkCreatePerfEvent(attr *bpfLinkCreatePerfEventAttr) (*internal.FD, error) {
+	ptr, err := internal.BPF(internal.BPF_LINK_CREATE, unsafe.Pointer(attr), unsafe.Sizeof(*attr))
+	if err != nil {
+		return nil, err
+	}
+	return internal.NewFD(uint32(ptr)), nil
+}
+
+var haveBPFLinkPerfEvent = internal.FeatureTest("bpf_link for perf events", "5.15", func() error {
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Name: "probe_bpf_perf_link",
+		Type: ebpf.Kprobe,
+		Instructions: asm.Instructions{
+			asm.Mov.Imm(asm.R0, 0),
+			asm.Return(),
+		},
+		License: "MIT",
+	})
+	if err != nil {
+		return internal.ErrNotSupported
+	}
+	defer prog.Close()
+
+	attr := bpfLinkCreatePerfEventAttr{
+		// This is a hopefully invalid file descriptor, which triggers EBADF.
+		targetFd:   ^uint32(0),
+		progFd:     uint32(prog.FD()),
+		attachType: ebpf.AttachPerfEvent,
+	}
+	_, err = bpfLinkCreatePerfEvent(&attr)
+	if errors.Is(err, unix.EINVAL) {
+		return internal.ErrNotSupported
+	}
+	if errors.Is(err, unix.EBADF) {
+		return nil
+	}
+	return err
+})
+
+type bpfLinkCreateTCXAttr struct {
+	progFd           uint32
+	targetIfindex    uint32
+	attachType       ebpf.AttachType
+	flags            uint32
+	relativeFdOrID   uint32
+	_                uint32
+	expectedRevision uint64
+}
+
+func bpfLinkCreateTCX(attr *bpfLinkCreateTCXAttr) (*internal.FD, error) {
+	ptr, err := internal.BPF(internal.BPF_LINK_CREATE, unsafe.Pointer(attr), unsafe.Sizeof(*attr))
+	if err != nil {
+		return nil, err
+	}
+	return internal.NewFD(uint32(ptr)), nil
+}
+
+var haveTCX = internal.FeatureTest("tcx", "6.6", func() error {
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Type:    ebpf.SchedCLS,
+		License: "MIT",
+		Instructions: asm.Instructions{
+			asm.Mov.Imm(asm.R0, 0),
+			asm.Return(),
+		},
+	})
+	if err != nil {
+		return internal.ErrNotSupported
+	}
+	defer prog.Close()
+
+	attr := bpfLinkCreateTCXAttr{
+		// This is a hopefully invalid interface index, which triggers ENODEV.
+		targetIfindex: ^uint32(0),
+		progFd:        uint32(prog.FD()),
+		attachType:    ebpf.AttachTCXIngress,
+	}
+	_, err = bpfLinkCreateTCX(&attr)
+	if errors.Is(err, unix.EINVAL) {
+		return internal.ErrNotSupported
+	}
+	if errors.Is(err, unix.ENODEV) {
+		return nil
+	}
+	return err
+})
+
+type bpfProgQueryAttr struct {
+	targetFdOrIfindex uint32
+	attachType        ebpf.AttachType
+	queryFlags        uint32
+	attachFlags       uint32
+	progIDs           internal.Pointer
+	count             uint32
+	_                 uint32
+	progAttachFlags   internal.Pointer
+	linkIDs           internal.Pointer
+	linkAttachFlags   internal.Pointer
+	revision          uint64
+}
+
+func bpfProgQuery(attr *bpfProgQueryAttr) error {
+	_, err := internal.BPF(internal.BPF_PROG_QUERY, unsafe.Pointer(attr), unsafe.Sizeof(*attr))
+	return err
+}
+
 type bpfIterCreateAttr struct {
 	linkFd uint32
 	flags  uint32
@@ -17,3 +17,11 @@ func TestHaveProgAttachReplace(t *testing.T) {
 func TestHaveBPFLink(t *testing.T) {
 	testutils.CheckFeatureTest(t, haveBPFLink)
 }
+
+func TestHaveBPFLinkPerfEvent(t *testing.T) {
+	testutils.CheckFeatureTest(t, haveBPFLinkPerfEvent)
+}
+
+func TestHaveTCX(t *testing.T) {
+	testutils.CheckFeatureTest(t, haveTCX)
+}
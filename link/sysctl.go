@@ -0,0 +1,30 @@
+package link
+
+import (
+	"github.com/cilium/ebpf"
+)
+
+// Offsets of the fields of struct bpf_sysctl, the context of CGroupSysctl
+// programs.
+const (
+	// SysctlWriteOffset is the offset of a u32 which is non-zero if the
+	// sysctl is being written.
+	SysctlWriteOffset = 0
+	// SysctlFilePosOffset is the offset of the u32 file position of the
+	// access. It may be overwritten by the program.
+	SysctlFilePosOffset = 4
+)
+
+// AttachCgroupSysctl attaches a CGroupSysctl program to a cgroup. The
+// program is invoked whenever a process in the cgroup or its descendants
+// reads or writes a file in /proc/sys.
+//
+// The program must return 1 to allow the access and 0 to reject it with
+// EPERM. Helpers like bpf_sysctl_set_new_value allow it to rewrite the
+// value being written.
+//
+// See AttachCgroup for how the program is attached. Requires at least
+// Linux 5.2.
+func AttachCgroupSysctl(cgroupPath string, prog *ebpf.Program) (Link, error) {
+	return attachCgroupProgram(cgroupPath, ebpf.AttachCGroupSysctl, prog)
+}
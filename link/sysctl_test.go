@@ -0,0 +1,53 @@
+package link
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal/testutils"
+)
+
+func TestAttachCgroupSysctl(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.2", "cgroup sysctl")
+
+	cgroup, _ := mustCgroupFixtures(t)
+
+	// Allow writes and deny reads.
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Type:       ebpf.CGroupSysctl,
+		AttachType: ebpf.AttachCGroupSysctl,
+		License:    "MIT",
+		Instructions: asm.Instructions{
+			asm.LoadMem(asm.R2, asm.R1, SysctlWriteOffset, asm.Word),
+			asm.Mov.Imm(asm.R0, 1),
+			asm.JNE.Imm(asm.R2, 0, "out"),
+			asm.Mov.Imm(asm.R0, 0),
+			asm.Return().Sym("out"),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer prog.Close()
+
+	link, err := AttachCgroupSysctl(cgroup.Name(), prog)
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal("Can't attach program:", err)
+	}
+	defer link.Close()
+
+	// Move a shell into the cgroup before reading a sysctl.
+	procs := filepath.Join(cgroup.Name(), "cgroup.procs")
+	cmd := exec.Command("/bin/sh", "-c", `echo $$ > "$0" && exec cat /proc/sys/kernel/ostype`, procs)
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Errorf("Reading a sysctl isn't rejected: %s", out)
+	} else if !strings.Contains(string(out), "cat:") {
+		t.Fatalf("Can't run shell in cgroup: %s: %s", err, out)
+	}
+}
@@ -0,0 +1,259 @@
+package link
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+// Flags for ordering programs attached via tcx, see <linux/bpf.h>.
+const (
+	flagBefore = 1 << 3
+	flagAfter  = 1 << 4
+	flagID     = 1 << 5
+	flagLink   = 1 << 13
+)
+
+// Anchor is a position relative to the other programs attached to the
+// same hook.
+type Anchor interface {
+	// anchor returns the flags and the relative fd or ID.
+	anchor() (uint32, uint32, error)
+}
+
+type firstAnchor struct{}
+
+func (firstAnchor) anchor() (uint32, uint32, error) { return flagBefore, 0, nil }
+
+type lastAnchor struct{}
+
+func (lastAnchor) anchor() (uint32, uint32, error) { return flagAfter, 0, nil }
+
+// First places a program before all other programs.
+func First() Anchor { return firstAnchor{} }
+
+// Last places a program after all other programs.
+func Last() Anchor { return lastAnchor{} }
+
+type relativeAnchor struct {
+	flags uint32
+	prog  *ebpf.Program
+	link  Link
+	id    uint32
+}
+
+func (ra relativeAnchor) anchor() (uint32, uint32, error) {
+	switch {
+	case ra.prog != nil:
+		fd := ra.prog.FD()
+		if fd < 0 {
+			return 0, 0, fmt.Errorf("anchor: %s", internal.ErrClosedFd)
+		}
+		return ra.flags, uint32(fd), nil
+
+	case ra.link != nil:
+		fder, ok := ra.link.(interface{ FD() int })
+		if !ok {
+			return 0, 0, fmt.Errorf("anchor: %T is not a bpf_link", ra.link)
+		}
+		fd := fder.FD()
+		if fd < 0 {
+			return 0, 0, fmt.Errorf("anchor: %s", internal.ErrClosedFd)
+		}
+		return ra.flags | flagLink, uint32(fd), nil
+
+	default:
+		return ra.flags | flagID, ra.id, nil
+	}
+}
+
+// BeforeProgram places a program before prog.
+func BeforeProgram(prog *ebpf.Program) Anchor {
+	return relativeAnchor{flags: flagBefore, prog: prog}
+}
+
+// AfterProgram places a program after prog.
+func AfterProgram(prog *ebpf.Program) Anchor {
+	return relativeAnchor{flags: flagAfter, prog: prog}
+}
+
+// BeforeProgramByID places a program before the program with the given ID.
+func BeforeProgramByID(id ebpf.ProgramID) Anchor {
+	return relativeAnchor{flags: flagBefore, id: uint32(id)}
+}
+
+// AfterProgramByID places a program after the program with the given ID.
+func AfterProgramByID(id ebpf.ProgramID) Anchor {
+	return relativeAnchor{flags: flagAfter, id: uint32(id)}
+}
+
+// BeforeLink places a program before the program attached by link.
+func BeforeLink(link Link) Anchor {
+	return relativeAnchor{flags: flagBefore, link: link}
+}
+
+// AfterLink places a program after the program attached by link.
+func AfterLink(link Link) Anchor {
+	return relativeAnchor{flags: flagAfter, link: link}
+}
+
+// BeforeLinkByID places a program before the program attached by the link
+// with the given ID.
+func BeforeLinkByID(id ID) Anchor {
+	return relativeAnchor{flags: flagBefore | flagLink, id: uint32(id)}
+}
+
+// AfterLinkByID places a program after the program attached by the link
+// with the given ID.
+func AfterLinkByID(id ID) Anchor {
+	return relativeAnchor{flags: flagAfter | flagLink, id: uint32(id)}
+}
+
+// TCXOptions control how a program is attached via tcx.
+type TCXOptions struct {
+	// Program must be a SchedCLS program.
+	Program *ebpf.Program
+	// Index of the network interface to attach to.
+	Interface int
+	// Attach is either AttachTCXIngress or AttachTCXEgress.
+	Attach ebpf.AttachType
+	// Anchor is the position of the program relative to other programs
+	// attached to the same hook. Defaults to Last.
+	Anchor Anchor
+	// ExpectedRevision makes attaching fail with ESTALE unless the hook has
+	// the given revision, see QueryTCX. Zero disables the check.
+	ExpectedRevision uint64
+}
+
+// AttachTCX links a program to the ingress or egress of a network
+// interface.
+//
+// Unlike tc filters attached via netlink, multiple programs can be attached
+// by different users without a clsact qdisc. They run in order until one
+// of them returns a verdict other than TCX_NEXT.
+//
+// Requires at least Linux 6.6.
+func AttachTCX(opts TCXOptions) (Link, error) {
+	if t := opts.Program.Type(); t != ebpf.SchedCLS {
+		return nil, fmt.Errorf("invalid program type %s, expected SchedCLS", t)
+	}
+
+	if opts.Attach != ebpf.AttachTCXIngress && opts.Attach != ebpf.AttachTCXEgress {
+		return nil, fmt.Errorf("invalid attach type %s", opts.Attach)
+	}
+
+	if opts.Interface < 1 {
+		return nil, fmt.Errorf("invalid interface index: %d", opts.Interface)
+	}
+
+	progFd := opts.Program.FD()
+	if progFd < 0 {
+		return nil, fmt.Errorf("invalid program: %s", internal.ErrClosedFd)
+	}
+
+	anchor := opts.Anchor
+	if anchor == nil {
+		anchor = Last()
+	}
+
+	flags, relative, err := anchor.anchor()
+	if err != nil {
+		return nil, fmt.Errorf("tcx: %w", err)
+	}
+
+	if err := haveTCX(); err != nil {
+		return nil, err
+	}
+
+	fd, err := bpfLinkCreateTCX(&bpfLinkCreateTCXAttr{
+		progFd:           uint32(progFd),
+		targetIfindex:    uint32(opts.Interface),
+		attachType:       opts.Attach,
+		flags:            flags,
+		relativeFdOrID:   relative,
+		expectedRevision: opts.ExpectedRevision,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("tcx link: %w", err)
+	}
+
+	return &tcxLink{RawLink{fd, ""}}, nil
+}
+
+// LoadPinnedTCX loads a pinned tcx link from a bpffs.
+func LoadPinnedTCX(fileName string, opts *ebpf.LoadPinOptions) (Link, error) {
+	link, err := LoadPinnedRawLink(fileName, TCXType, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tcxLink{*link}, nil
+}
+
+type tcxLink struct {
+	RawLink
+}
+
+var _ Link = (*tcxLink)(nil)
+
+// TCXProgram is a program attached via tcx.
+type TCXProgram struct {
+	ID ebpf.ProgramID
+	// Link is zero if the program was attached without a link.
+	Link ID
+}
+
+// TCXInfo describes the programs attached to a tcx hook.
+type TCXInfo struct {
+	// Programs in order of execution.
+	Programs []TCXProgram
+	// Revision is incremented whenever a program is attached or
+	// detached, see TCXOptions.ExpectedRevision.
+	Revision uint64
+}
+
+// QueryTCX returns the programs attached to the ingress or egress of a
+// network interface via tcx.
+//
+// Requires at least Linux 6.6.
+func QueryTCX(ifindex int, attach ebpf.AttachType) (*TCXInfo, error) {
+	if err := haveTCX(); err != nil {
+		return nil, err
+	}
+
+	for {
+		attr := bpfProgQueryAttr{
+			targetFdOrIfindex: uint32(ifindex),
+			attachType:        attach,
+		}
+		if err := bpfProgQuery(&attr); err != nil {
+			return nil, fmt.Errorf("query tcx: %w", err)
+		}
+
+		progIDs := make([]byte, 4*attr.count)
+		linkIDs := make([]byte, 4*attr.count)
+		attr.progIDs = internal.NewSlicePointer(progIDs)
+		attr.linkIDs = internal.NewSlicePointer(linkIDs)
+
+		err := bpfProgQuery(&attr)
+		if errors.Is(err, unix.ENOSPC) {
+			// A program was attached in between the two queries.
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("query tcx: %w", err)
+		}
+
+		info := &TCXInfo{Revision: attr.revision}
+		for i := 0; i < int(attr.count)*4; i += 4 {
+			info.Programs = append(info.Programs, TCXProgram{
+				ebpf.ProgramID(internal.NativeEndian.Uint32(progIDs[i:])),
+				ID(internal.NativeEndian.Uint32(linkIDs[i:])),
+			})
+		}
+		return info, nil
+	}
+}
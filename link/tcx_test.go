@@ -0,0 +1,142 @@
+package link
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal/testutils"
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+func TestAttachTCX(t *testing.T) {
+	prog, ifindex := mustTCXFixtures(t)
+
+	link, err := AttachTCX(TCXOptions{
+		Program:   prog,
+		Interface: ifindex,
+		Attach:    ebpf.AttachTCXIngress,
+	})
+	if err != nil {
+		t.Fatal("Can't attach tcx program:", err)
+	}
+
+	testLink(t, link, testLinkOptions{
+		prog: prog,
+		loadPinned: func(f string, opts *ebpf.LoadPinOptions) (Link, error) {
+			return LoadPinnedTCX(f, opts)
+		},
+	})
+}
+
+func TestTCXAnchor(t *testing.T) {
+	a, ifindex := mustTCXFixtures(t)
+	b, c, d, e := mustTCXProgram(t), mustTCXProgram(t), mustTCXProgram(t), mustTCXProgram(t)
+
+	attach := func(prog *ebpf.Program, anchor Anchor) Link {
+		t.Helper()
+
+		link, err := AttachTCX(TCXOptions{
+			Program:   prog,
+			Interface: ifindex,
+			Attach:    ebpf.AttachTCXEgress,
+			Anchor:    anchor,
+		})
+		if err != nil {
+			t.Fatal("Can't attach tcx program:", err)
+		}
+		t.Cleanup(func() { link.Close() })
+		return link
+	}
+
+	linkA := attach(a, nil)
+	linkB := attach(b, First())
+	attach(c, AfterProgram(a))
+	attach(d, BeforeLink(linkB))
+	attach(e, AfterLink(linkA))
+
+	ids := make(map[ebpf.ProgramID]string)
+	for name, prog := range map[string]*ebpf.Program{"a": a, "b": b, "c": c, "d": d, "e": e} {
+		info, err := prog.Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := info.ID()
+		ids[id] = name
+	}
+
+	info, err := QueryTCX(ifindex, ebpf.AttachTCXEgress)
+	if err != nil {
+		t.Fatal("Can't query tcx:", err)
+	}
+
+	// Other tests may have left programs which are released
+	// asynchronously, ignore them.
+	var order string
+	for _, prog := range info.Programs {
+		if name, ok := ids[prog.ID]; ok {
+			order += name
+			if prog.Link == 0 {
+				t.Errorf("Program %s has no link ID", name)
+			}
+		}
+	}
+	if order != "dbaec" {
+		t.Errorf("Expected order dbaec, got %s", order)
+	}
+
+	_, err = AttachTCX(TCXOptions{
+		Program:          mustTCXProgram(t),
+		Interface:        ifindex,
+		Attach:           ebpf.AttachTCXEgress,
+		ExpectedRevision: info.Revision - 1,
+	})
+	if !errors.Is(err, unix.ESTALE) {
+		t.Error("Attaching with a stale revision doesn't return ESTALE:", err)
+	}
+
+	_, err = AttachTCX(TCXOptions{
+		Program:   mustTCXProgram(t),
+		Interface: ifindex,
+		Attach:    ebpf.AttachTCXEgress,
+		Anchor:    BeforeProgramByID(^ebpf.ProgramID(0)),
+	})
+	if err == nil {
+		t.Error("Attaching relative to a missing program doesn't return an error")
+	}
+}
+
+func mustTCXFixtures(t *testing.T) (*ebpf.Program, int) {
+	t.Helper()
+
+	testutils.SkipIfNotSupported(t, haveTCX())
+
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skip("No loopback interface:", err)
+	}
+
+	return mustTCXProgram(t), lo.Index
+}
+
+func mustTCXProgram(t *testing.T) *ebpf.Program {
+	t.Helper()
+
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Type:    ebpf.SchedCLS,
+		License: "MIT",
+		Instructions: asm.Instructions{
+			// TCX_NEXT
+			asm.Mov.Imm(asm.R0, -1),
+			asm.Return(),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { prog.Close() })
+
+	return prog
+}
@@ -6,6 +6,16 @@ import (
 	"github.com/cilium/ebpf"
 )
 
+// TracepointOptions defines additional parameters that will be used
+// when attaching a tracepoint.
+type TracepointOptions struct {
+	// Arbitrary value that can be fetched from an eBPF program
+	// via `bpf_get_attach_cookie()`.
+	//
+	// Needs kernel 5.15+.
+	Cookie uint64
+}
+
 // Tracepoint attaches the given eBPF program to the tracepoint with the given
 // group and name. See /sys/kernel/debug/tracing/events to find available
 // tracepoints. The top-level directory is the group, the event's subdirectory
@@ -16,6 +26,12 @@ import (
 // Note that attaching eBPF programs to syscalls (sys_enter_*/sys_exit_*) is
 // only possible as of kernel 4.14 (commit cf5f5ce).
 func Tracepoint(group, name string, prog *ebpf.Program) (Link, error) {
+	return TracepointWithOptions(group, name, prog, nil)
+}
+
+// TracepointWithOptions is like Tracepoint, but allows passing additional
+// parameters. opts may be nil.
+func TracepointWithOptions(group, name string, prog *ebpf.Program, opts *TracepointOptions) (Link, error) {
 	if group == "" || name == "" {
 		return nil, fmt.Errorf("group and name cannot be empty: %w", errInvalidInput)
 	}
@@ -47,10 +63,17 @@ func Tracepoint(group, name string, prog *ebpf.Program) (Link, error) {
 		progType:  ebpf.TracePoint,
 	}
 
-	if err := pe.attach(prog); err != nil {
+	if err := pe.attach(prog, opts.cookie()); err != nil {
 		pe.Close()
 		return nil, err
 	}
 
 	return pe, nil
 }
+
+func (to *TracepointOptions) cookie() uint64 {
+	if to == nil {
+		return 0
+	}
+	return to.Cookie
+}
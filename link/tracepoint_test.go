@@ -2,6 +2,7 @@ package link
 
 import (
 	"errors"
+	"os"
 	"testing"
 
 	"github.com/cilium/ebpf"
@@ -71,3 +72,61 @@ func TestTraceGetEventID(t *testing.T) {
 		t.Fatal("Doesn't return ErrNotSupported")
 	}
 }
+
+func TestTracepointCookie(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.15", "bpf_get_attach_cookie")
+
+	m, err := ebpf.NewMap(&ebpf.MapSpec{
+		Type:       ebpf.Array,
+		KeySize:    4,
+		ValueSize:  8,
+		MaxEntries: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Type:    ebpf.TracePoint,
+		License: "MIT",
+		Instructions: asm.Instructions{
+			// r1 contains the context.
+			asm.FnGetAttachCookie.Call(),
+			asm.StoreMem(asm.RFP, -8, asm.R0, asm.DWord),
+			asm.StoreImm(asm.RFP, -12, 0, asm.Word),
+			asm.LoadMapPtr(asm.R1, m.FD()),
+			asm.Mov.Reg(asm.R2, asm.RFP),
+			asm.Add.Imm(asm.R2, -12),
+			asm.Mov.Reg(asm.R3, asm.RFP),
+			asm.Add.Imm(asm.R3, -8),
+			asm.Mov.Imm(asm.R4, 0),
+			asm.FnMapUpdateElem.Call(),
+			asm.Mov.Imm(asm.R0, 0),
+			asm.Return(),
+		},
+	})
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer prog.Close()
+
+	tp, err := TracepointWithOptions("syscalls", "sys_enter_getpid", prog, &TracepointOptions{Cookie: 0xcafe})
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tp.Close()
+
+	os.Getpid()
+
+	var cookie uint64
+	if err := m.Lookup(uint32(0), &cookie); err != nil {
+		t.Fatal(err)
+	}
+
+	if cookie != 0xcafe {
+		t.Errorf("Expected cookie 0xcafe, got %#x", cookie)
+	}
+}
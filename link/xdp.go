@@ -0,0 +1,190 @@
+package link
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal/netlink"
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+// XDPAttachFlags control where an XDP program is executed.
+type XDPAttachFlags uint32
+
+// Valid XDPAttachFlags. The kernel picks a mode if none is given.
+const (
+	// XDPGenericMode runs the program in the networking stack. It works
+	// with all interfaces, but is slower than the other modes.
+	XDPGenericMode XDPAttachFlags = 1 << (iota + 1)
+	// XDPDriverMode runs the program in the driver.
+	XDPDriverMode
+	// XDPOffloadMode runs the program on the network card.
+	XDPOffloadMode
+)
+
+// XDPOptions control how an XDP program is attached.
+type XDPOptions struct {
+	// Program must be an XDP program.
+	Program *ebpf.Program
+	// Index of the network interface to attach to.
+	Interface int
+	// Flags select the attach mode.
+	Flags XDPAttachFlags
+}
+
+// AttachXDP links an XDP program to a network interface.
+//
+// Fails if another program is already attached to the interface. The
+// returned Link can replace the program without a window in which no
+// program is attached: on Linux 5.9 and later a bpf_link is used, older
+// kernels fall back to netlink.
+func AttachXDP(opts XDPOptions) (Link, error) {
+	if t := opts.Program.Type(); t != ebpf.XDP {
+		return nil, fmt.Errorf("invalid program type %s, expected XDP", t)
+	}
+
+	if opts.Interface < 1 {
+		return nil, fmt.Errorf("invalid interface index: %d", opts.Interface)
+	}
+
+	link, err := newLinkXDP(opts)
+	if errors.Is(err, ErrNotSupported) {
+		return newNetlinkXDP(opts)
+	}
+	return link, err
+}
+
+// LoadPinnedXDP loads a pinned XDP link from a bpffs.
+func LoadPinnedXDP(fileName string, opts *ebpf.LoadPinOptions) (Link, error) {
+	link, err := LoadPinnedRawLink(fileName, XDPType, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &linkXDP{*link}, nil
+}
+
+type linkXDP struct {
+	RawLink
+}
+
+var _ Link = (*linkXDP)(nil)
+
+func newLinkXDP(opts XDPOptions) (*linkXDP, error) {
+	if err := haveBPFLink(); err != nil {
+		return nil, err
+	}
+
+	fd, err := bpfLinkCreate(&bpfLinkCreateAttr{
+		targetFd:   uint32(opts.Interface),
+		progFd:     uint32(opts.Program.FD()),
+		attachType: ebpf.AttachXDP,
+		flags:      uint32(opts.Flags),
+	})
+	if errors.Is(err, unix.EINVAL) {
+		// Kernels before 5.9 don't support XDP links. The kernel also
+		// returns EINVAL for unknown interfaces, which is then reported
+		// by the netlink fallback.
+		return nil, fmt.Errorf("xdp link: %w", ErrNotSupported)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("xdp link: %w", err)
+	}
+
+	return &linkXDP{RawLink{fd, ""}}, nil
+}
+
+// netlinkXDP attaches a program via netlink. It can't be pinned.
+type netlinkXDP struct {
+	conn    *netlink.Conn
+	ifindex int
+	flags   XDPAttachFlags
+	current *ebpf.Program
+}
+
+var _ Link = (*netlinkXDP)(nil)
+
+func newNetlinkXDP(opts XDPOptions) (*netlinkXDP, error) {
+	prog, err := opts.Program.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := netlink.Dial()
+	if err != nil {
+		prog.Close()
+		return nil, fmt.Errorf("xdp: %w", err)
+	}
+
+	err = conn.SetXDP(opts.Interface, netlink.SetXDPOptions{
+		FD:    prog.FD(),
+		Flags: uint32(opts.Flags) | netlink.XDP_FLAGS_UPDATE_IF_NOEXIST,
+	})
+	if err != nil {
+		conn.Close()
+		prog.Close()
+		return nil, fmt.Errorf("xdp: %w", err)
+	}
+
+	return &netlinkXDP{conn, opts.Interface, opts.Flags, prog}, nil
+}
+
+func (nx *netlinkXDP) isLink() {}
+
+// replace swaps the current program for fd, which may be -1 to detach.
+func (nx *netlinkXDP) replace(fd int) error {
+	err := nx.conn.SetXDP(nx.ifindex, netlink.SetXDPOptions{
+		FD:         fd,
+		ExpectedFD: nx.current.FD(),
+		Flags:      uint32(nx.flags) | netlink.XDP_FLAGS_REPLACE,
+	})
+	if errors.Is(err, unix.EINVAL) {
+		// Kernels before 5.7 don't support XDP_FLAGS_REPLACE. Replacing
+		// the program is still atomic, but might clobber a program
+		// attached by somebody else.
+		err = nx.conn.SetXDP(nx.ifindex, netlink.SetXDPOptions{
+			FD:    fd,
+			Flags: uint32(nx.flags),
+		})
+	}
+	return err
+}
+
+func (nx *netlinkXDP) Update(prog *ebpf.Program) error {
+	if prog == nil {
+		return errors.New("can't update xdp: nil program")
+	}
+
+	new, err := prog.Clone()
+	if err != nil {
+		return err
+	}
+
+	if err := nx.replace(new.FD()); err != nil {
+		new.Close()
+		return fmt.Errorf("can't update xdp: %w", err)
+	}
+
+	nx.current.Close()
+	nx.current = new
+	return nil
+}
+
+func (nx *netlinkXDP) Close() error {
+	defer nx.conn.Close()
+	defer nx.current.Close()
+
+	if err := nx.replace(-1); err != nil {
+		return fmt.Errorf("close xdp: %w", err)
+	}
+	return nil
+}
+
+func (nx *netlinkXDP) Pin(string) error {
+	return fmt.Errorf("can't pin xdp: %w", ErrNotSupported)
+}
+
+func (nx *netlinkXDP) Unpin() error {
+	return fmt.Errorf("can't pin xdp: %w", ErrNotSupported)
+}
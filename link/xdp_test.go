@@ -0,0 +1,140 @@
+package link
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal/netlink"
+	"github.com/cilium/ebpf/internal/testutils"
+)
+
+func TestAttachXDP(t *testing.T) {
+	prog, ifindex := mustXDPFixtures(t)
+
+	link, err := AttachXDP(XDPOptions{
+		Program:   prog,
+		Interface: ifindex,
+		Flags:     XDPGenericMode,
+	})
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal("Can't attach XDP program:", err)
+	}
+
+	testLink(t, link, testLinkOptions{
+		prog: prog,
+		loadPinned: func(f string, opts *ebpf.LoadPinOptions) (Link, error) {
+			return LoadPinnedXDP(f, opts)
+		},
+	})
+}
+
+func TestNetlinkXDP(t *testing.T) {
+	prog, ifindex := mustXDPFixtures(t)
+
+	opts := XDPOptions{
+		Program:   prog,
+		Interface: ifindex,
+		Flags:     XDPGenericMode,
+	}
+
+	link, err := newNetlinkXDP(opts)
+	if err != nil {
+		t.Fatal("Can't attach XDP program via netlink:", err)
+	}
+	defer link.Close()
+
+	if _, err := newNetlinkXDP(opts); err == nil {
+		t.Fatal("Attaching twice doesn't return an error")
+	}
+
+	prog2 := mustXDPProgram(t)
+	if err := link.Update(prog2); err != nil {
+		t.Fatal("Can't update program:", err)
+	}
+
+	info, err := prog2.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := info.ID()
+
+	conn, err := netlink.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	xdp, err := conn.XDP(ifindex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if xdp.GenericProgramID != uint32(id) {
+		t.Errorf("Expected program %d to be attached, got %d", id, xdp.GenericProgramID)
+	}
+
+	if err := link.Close(); err != nil {
+		t.Fatal("Can't close link:", err)
+	}
+
+	if xdp, err := conn.XDP(ifindex); err != nil || xdp.GenericProgramID != 0 {
+		t.Errorf("Program is still attached after Close: %+v %v", xdp, err)
+	}
+}
+
+func mustXDPFixtures(t *testing.T) (*ebpf.Program, int) {
+	t.Helper()
+
+	testutils.SkipOnOldKernel(t, "4.12", "generic XDP")
+
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skip("No loopback interface:", err)
+	}
+
+	// Pinned links are released asynchronously after being unpinned, so a
+	// previous test may still be attached.
+	conn, err := netlink.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		xdp, err := conn.XDP(lo.Index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if xdp.Attached == 0 {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("Another XDP program is attached to lo")
+		}
+	}
+
+	return mustXDPProgram(t), lo.Index
+}
+
+func mustXDPProgram(t *testing.T) *ebpf.Program {
+	t.Helper()
+
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Type:    ebpf.XDP,
+		License: "MIT",
+		Instructions: asm.Instructions{
+			// XDP_PASS
+			asm.Mov.Imm(asm.R0, 2),
+			asm.Return(),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { prog.Close() })
+
+	return prog
+}
@@ -2,6 +2,7 @@ package ebpf
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/cilium/ebpf/asm"
 	"github.com/cilium/ebpf/internal/btf"
@@ -86,46 +87,75 @@ func needSection(insns, section asm.Instructions) (bool, error) {
 }
 
 func fixupJumpsAndCalls(insns asm.Instructions) error {
-	symbolOffsets := make(map[string]asm.RawInstructionOffset)
+	if err := insns.ResolveReferences(); err != nil {
+		return err
+	}
+
+	return checkSubprograms(insns)
+}
+
+// maxSubprograms mirrors BPF_MAX_SUBPROGS in the kernel.
+const maxSubprograms = 256
+
+// checkSubprograms enforces the restrictions the verifier places on
+// bpf to bpf calls.
+//
+// Every target of a call starts a new function. There may be at most
+// maxSubprograms functions, and jumps may not cross from one function into
+// another.
+func checkSubprograms(insns asm.Instructions) error {
+	starts := []asm.RawInstructionOffset{0}
 	iter := insns.Iterate()
 	for iter.Next() {
 		ins := iter.Ins
-
-		if ins.Symbol == "" {
+		if !ins.IsFunctionCall() {
 			continue
 		}
 
-		if _, ok := symbolOffsets[ins.Symbol]; ok {
-			return fmt.Errorf("duplicate symbol %s", ins.Symbol)
+		target := int64(iter.Offset) + ins.Constant + 1
+		if target < 0 {
+			return fmt.Errorf("instruction %d: call to negative offset %d", iter.Index, target)
+		}
+		starts = append(starts, asm.RawInstructionOffset(target))
+	}
+
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	var funcs []asm.RawInstructionOffset
+	for i, start := range starts {
+		if i > 0 && start == starts[i-1] {
+			continue
 		}
+		funcs = append(funcs, start)
+	}
 
-		symbolOffsets[ins.Symbol] = iter.Offset
+	if len(funcs) > maxSubprograms {
+		return fmt.Errorf("program has %d functions, only %d are allowed", len(funcs), maxSubprograms)
+	}
+
+	if len(funcs) == 1 {
+		return nil
+	}
+
+	// function returns the start of the function containing offset.
+	function := func(offset int64) asm.RawInstructionOffset {
+		i := sort.Search(len(funcs), func(i int) bool { return int64(funcs[i]) > offset })
+		return funcs[i-1]
 	}
 
 	iter = insns.Iterate()
 	for iter.Next() {
-		i := iter.Index
-		offset := iter.Offset
 		ins := iter.Ins
+		if ins.OpCode.Class() != asm.JumpClass {
+			continue
+		}
 
-		switch {
-		case ins.IsFunctionCall() && ins.Constant == -1:
-			// Rewrite bpf to bpf call
-			callOffset, ok := symbolOffsets[ins.Reference]
-			if !ok {
-				return fmt.Errorf("instruction %d: reference to missing symbol %q", i, ins.Reference)
-			}
-
-			ins.Constant = int64(callOffset - offset - 1)
-
-		case ins.OpCode.Class() == asm.JumpClass && ins.Offset == -1:
-			// Rewrite jump to label
-			jumpOffset, ok := symbolOffsets[ins.Reference]
-			if !ok {
-				return fmt.Errorf("instruction %d: reference to missing symbol %q", i, ins.Reference)
-			}
+		if op := ins.OpCode.JumpOp(); op == asm.Call || op == asm.Exit {
+			continue
+		}
 
-			ins.Offset = int16(jumpOffset - offset - 1)
+		target := int64(iter.Offset) + int64(ins.Offset) + 1
+		if target < 0 || function(target) != function(int64(iter.Offset)) {
+			return fmt.Errorf("instruction %d: jump crosses function boundary", iter.Index)
 		}
 	}
 
@@ -58,3 +58,32 @@ func TestLink(t *testing.T) {
 		t.Errorf("Expected return code 1337, got %d", ret)
 	}
 }
+
+func TestFixupJumpsAndCallsSubprograms(t *testing.T) {
+	insns := asm.Instructions{
+		asm.Call.Label("fn"),
+		asm.Return(),
+		asm.Mov.Imm(asm.R0, 1).Sym("fn"),
+		asm.Return(),
+	}
+
+	if err := fixupJumpsAndCalls(insns); err != nil {
+		t.Fatal("Can't fix up valid bpf to bpf call:", err)
+	}
+
+	if insns[0].Constant != 1 {
+		t.Errorf("Expected call offset 1, got %d", insns[0].Constant)
+	}
+
+	insns = asm.Instructions{
+		asm.Call.Label("fn"),
+		asm.Ja.Label("in_fn"),
+		asm.Return(),
+		asm.Mov.Imm(asm.R0, 1).Sym("fn"),
+		asm.Return().Sym("in_fn"),
+	}
+
+	if err := fixupJumpsAndCalls(insns); err == nil {
+		t.Error("Accepted jump into another function")
+	}
+}
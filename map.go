@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
@@ -14,10 +15,14 @@ import (
 )
 
 // Errors returned by Map and MapIterator methods.
+//
+// Use errors.Is to check for them. Errors caused by a syscall also match
+// the underlying errno, for example unix.ENOENT for ErrKeyNotExist.
 var (
 	ErrKeyNotExist      = errors.New("key does not exist")
 	ErrKeyExist         = errors.New("key already exists")
 	ErrIterationAborted = errors.New("iteration aborted")
+	ErrMapIncompatible  = errors.New("map's spec is incompatible with pinned map")
 )
 
 // MapOptions control loading a map into the kernel.
@@ -34,8 +39,9 @@ type MapID uint32
 
 // MapSpec defines a Map.
 type MapSpec struct {
-	// Name is passed to the kernel as a debug aid. Must only contain
-	// alpha numeric and '_' characters.
+	// Name is passed to the kernel as a debug aid, and shows up in the
+	// output of bpftool and MapInfo. Characters the kernel doesn't accept
+	// are removed, and the name is truncated to 15 bytes.
 	Name       string
 	Type       MapType
 	KeySize    uint32
@@ -43,7 +49,7 @@ type MapSpec struct {
 	MaxEntries uint32
 
 	// Flags is passed to the kernel and specifies additional map
-	// creation attributes.
+	// creation attributes, see MapNoPrealloc and friends.
 	Flags uint32
 
 	// Automatically pin and load a map from MapOptions.PinPath.
@@ -51,8 +57,8 @@ type MapSpec struct {
 	Pinning PinType
 
 	// Specify numa node during map creation
-	// (effective only if unix.BPF_F_NUMA_NODE flag is set,
-	// which can be imported from golang.org/x/sys/unix)
+	// (effective only if the MapNumaNode flag is set).
+	// See InterfaceNumaNode for placing maps close to a NIC.
 	NumaNode uint32
 
 	// The initial contents of the map. May be nil.
@@ -68,6 +74,41 @@ type MapSpec struct {
 	BTF *btf.Map
 }
 
+// Flags for MapSpec.Flags.
+//
+// The values match the BPF_F_* constants in the kernel's UAPI.
+const (
+	// MapNoPrealloc allocates the elements of hash maps on demand instead
+	// of when creating the map. This saves memory for sparse maps at the
+	// cost of slower updates.
+	MapNoPrealloc = 1 << iota
+	// MapNoCommonLRU gives each CPU its own LRU list instead of sharing
+	// one between all CPUs. Only valid for LRUHash and LRUCPUHash.
+	MapNoCommonLRU
+	// MapNumaNode creates the map on the NUMA node given by
+	// MapSpec.NumaNode.
+	MapNumaNode
+	// MapReadOnly prevents user space from modifying the map.
+	MapReadOnly
+	// MapWriteOnly prevents user space from reading the map.
+	MapWriteOnly
+	_ // BPF_F_STACK_BUILD_ID
+	_ // BPF_F_ZERO_SEED
+	// MapReadOnlyProg prevents BPF programs from modifying the map.
+	//
+	// Requires at least 5.2.
+	MapReadOnlyProg
+	// MapWriteOnlyProg prevents BPF programs from reading the map.
+	//
+	// Requires at least 5.2.
+	MapWriteOnlyProg
+	_ // BPF_F_CLONE
+	// MapMmapable allows mapping the contents of an Array into memory.
+	//
+	// Requires at least 5.5.
+	MapMmapable
+)
+
 func (ms *MapSpec) String() string {
 	return fmt.Sprintf("%s(keySize=%d, valueSize=%d, maxEntries=%d, flags=%d)", ms.Type, ms.KeySize, ms.ValueSize, ms.MaxEntries, ms.Flags)
 }
@@ -93,26 +134,81 @@ type MapKV struct {
 	Value interface{}
 }
 
-func (ms *MapSpec) checkCompatibility(m *Map) error {
-	switch {
-	case m.typ != ms.Type:
-		return fmt.Errorf("expected type %v, got %v", ms.Type, m.typ)
-
-	case m.keySize != ms.KeySize:
-		return fmt.Errorf("expected key size %v, got %v", ms.KeySize, m.keySize)
+// Compatible returns nil if an existing map can be used in place of one
+// created from the spec.
+//
+// The returned error lists all mismatching properties and wraps
+// ErrMapIncompatible.
+func (ms *MapSpec) Compatible(m *Map) error {
+	spec, err := ms.withDefaults()
+	if err != nil {
+		return err
+	}
 
-	case m.valueSize != ms.ValueSize:
-		return fmt.Errorf("expected value size %v, got %v", ms.ValueSize, m.valueSize)
+	var mismatches []string
+	mismatch := func(field string, want, got interface{}) {
+		mismatches = append(mismatches, fmt.Sprintf("%s %v != %v", field, want, got))
+	}
 
-	case m.maxEntries != ms.MaxEntries:
-		return fmt.Errorf("expected max entries %v, got %v", ms.MaxEntries, m.maxEntries)
+	if m.typ != spec.Type {
+		mismatch("type", spec.Type, m.typ)
+	}
+	if m.keySize != spec.KeySize {
+		mismatch("key_size", spec.KeySize, m.keySize)
+	}
+	if m.valueSize != spec.ValueSize {
+		mismatch("value_size", spec.ValueSize, m.valueSize)
+	}
+	if m.maxEntries != spec.MaxEntries {
+		mismatch("max_entries", spec.MaxEntries, m.maxEntries)
+	}
+	if m.flags != spec.Flags {
+		mismatch("flags", fmt.Sprintf("%#x", spec.Flags), fmt.Sprintf("%#x", m.flags))
+	}
 
-	case m.flags != ms.Flags:
-		return fmt.Errorf("expected flags %v, got %v", ms.Flags, m.flags)
+	if len(mismatches) > 0 {
+		return fmt.Errorf("%s: %w", strings.Join(mismatches, ", "), ErrMapIncompatible)
 	}
 	return nil
 }
 
+// withDefaults returns a copy of the spec with implicit values filled in.
+//
+// Some map types allow omitting key size, value size or max entries since
+// they only accept a single value.
+func (ms *MapSpec) withDefaults() (*MapSpec, error) {
+	spec := ms.Copy()
+
+	switch spec.Type {
+	case ArrayOfMaps, HashOfMaps:
+		if spec.ValueSize != 0 && spec.ValueSize != 4 {
+			return nil, errors.New("ValueSize must be zero or four for map of map")
+		}
+		spec.ValueSize = 4
+
+	case PerfEventArray:
+		if spec.KeySize != 0 && spec.KeySize != 4 {
+			return nil, errors.New("KeySize must be zero or four for perf event array")
+		}
+		spec.KeySize = 4
+
+		if spec.ValueSize != 0 && spec.ValueSize != 4 {
+			return nil, errors.New("ValueSize must be zero or four for perf event array")
+		}
+		spec.ValueSize = 4
+
+		if spec.MaxEntries == 0 {
+			n, err := internal.PossibleCPUs()
+			if err != nil {
+				return nil, fmt.Errorf("perf event array: %w", err)
+			}
+			spec.MaxEntries = uint32(n)
+		}
+	}
+
+	return spec, nil
+}
+
 // Map represents a Map file descriptor.
 //
 // It is not safe to close a map which is used by other goroutines.
@@ -120,8 +216,17 @@ func (ms *MapSpec) checkCompatibility(m *Map) error {
 // Methods which take interface{} arguments by default encode
 // them using binary.Read/Write in the machine's native endianness.
 //
+// Structs with at least one field tagged `ebpf:"name"` are instead encoded
+// using the layout of the equivalent C struct, including padding and
+// alignment. The tag names the C member, which allows checking the layout
+// against BTF via MapSpec.CheckTypes. Fields tagged `ebpf:"-"` are skipped.
+//
 // Implement encoding.BinaryMarshaler or encoding.BinaryUnmarshaler
-// if you require custom encoding.
+// if you require custom encoding. Slices of such types or of tagged structs
+// are encoded element by element, for example when used with the batch API.
+//
+// Pass an unsafe.Pointer to avoid copying keys and values. The memory
+// it points at must be large enough to hold the key or value.
 type Map struct {
 	name       string
 	fd         *internal.FD
@@ -133,6 +238,8 @@ type Map struct {
 	pinnedPath string
 	// Per CPU maps return values larger than the size in the spec
 	fullValueSize int
+	// Types of key and value, may be nil.
+	btf *btf.Map
 }
 
 // NewMapFromFD creates a map from a raw fd.
@@ -201,8 +308,8 @@ func newMapWithOptions(spec *MapSpec, opts MapOptions, btfs btfHandleCache) (_ *
 		}
 		defer closeOnError(m)
 
-		if err := spec.checkCompatibility(m); err != nil {
-			return nil, fmt.Errorf("use pinned map %s: %s", spec.Name, err)
+		if err := spec.Compatible(m); err != nil {
+			return nil, fmt.Errorf("use pinned map %s: %w", spec.Name, err)
 		}
 
 		return m, nil
@@ -256,43 +363,25 @@ func createMap(spec *MapSpec, inner *internal.FD, opts MapOptions, btfs btfHandl
 		}
 	}
 
-	spec = spec.Copy()
-
-	switch spec.Type {
-	case ArrayOfMaps:
-		fallthrough
-	case HashOfMaps:
+	if spec.Type == ArrayOfMaps || spec.Type == HashOfMaps {
 		if err := haveNestedMaps(); err != nil {
 			return nil, err
 		}
+	}
 
-		if spec.ValueSize != 0 && spec.ValueSize != 4 {
-			return nil, errors.New("ValueSize must be zero or four for map of map")
-		}
-		spec.ValueSize = 4
-
-	case PerfEventArray:
-		if spec.KeySize != 0 && spec.KeySize != 4 {
-			return nil, errors.New("KeySize must be zero or four for perf event array")
-		}
-		spec.KeySize = 4
-
-		if spec.ValueSize != 0 && spec.ValueSize != 4 {
-			return nil, errors.New("ValueSize must be zero or four for perf event array")
-		}
-		spec.ValueSize = 4
+	spec, err = spec.withDefaults()
+	if err != nil {
+		return nil, err
+	}
 
-		if spec.MaxEntries == 0 {
-			n, err := internal.PossibleCPUs()
-			if err != nil {
-				return nil, fmt.Errorf("perf event array: %w", err)
-			}
-			spec.MaxEntries = uint32(n)
+	if spec.Flags&(MapReadOnlyProg|MapWriteOnlyProg) > 0 || spec.Freeze {
+		if err := haveMapMutabilityModifiers(); err != nil {
+			return nil, fmt.Errorf("map create: %w", err)
 		}
 	}
 
-	if spec.Flags&(unix.BPF_F_RDONLY_PROG|unix.BPF_F_WRONLY_PROG) > 0 || spec.Freeze {
-		if err := haveMapMutabilityModifiers(); err != nil {
+	if spec.Flags&MapMmapable > 0 {
+		if err := haveMmapableMaps(); err != nil {
 			return nil, fmt.Errorf("map create: %w", err)
 		}
 	}
@@ -315,7 +404,7 @@ func createMap(spec *MapSpec, inner *internal.FD, opts MapOptions, btfs btfHandl
 	}
 
 	if haveObjName() == nil {
-		attr.mapName = newBPFObjName(spec.Name)
+		attr.mapName = newBPFObjName(SanitizeName(spec.Name, -1))
 	}
 
 	var btfDisabled bool
@@ -349,6 +438,7 @@ func createMap(spec *MapSpec, inner *internal.FD, opts MapOptions, btfs btfHandl
 	if err != nil {
 		return nil, fmt.Errorf("map create: %w", err)
 	}
+	m.btf = spec.BTF
 
 	if err := m.populate(spec.Contents); err != nil {
 		return nil, fmt.Errorf("map create: can't set initial contents: %w", err)
@@ -374,6 +464,7 @@ func newMap(fd *internal.FD, name string, typ MapType, keySize, valueSize, maxEn
 		flags,
 		"",
 		int(valueSize),
+		nil,
 	}
 
 	if !typ.hasPerCPUValue() {
@@ -433,8 +524,25 @@ func (m *Map) Info() (*MapInfo, error) {
 //
 // Returns an error if the key doesn't exist, see ErrKeyNotExist.
 func (m *Map) Lookup(key, valueOut interface{}) error {
+	return m.LookupWithFlags(key, valueOut, 0)
+}
+
+// MapLookupFlags controls the behaviour of the Map.LookupWithFlags call.
+type MapLookupFlags uint64
+
+// LookupLock reads elements under bpf_spin_lock, which prevents torn reads
+// of values concurrently modified by BPF programs.
+//
+// Requires a value containing a struct bpf_spin_lock described by BTF,
+// and at least 5.1.
+const LookupLock MapLookupFlags = 4
+
+// LookupWithFlags retrieves a value from a Map with flags.
+//
+// Behaves like Lookup otherwise.
+func (m *Map) LookupWithFlags(key, valueOut interface{}, flags MapLookupFlags) error {
 	valuePtr, valueBytes := makeBuffer(valueOut, m.fullValueSize)
-	if err := m.lookup(key, valuePtr); err != nil {
+	if err := m.lookup(key, valuePtr, flags); err != nil {
 		return err
 	}
 
@@ -443,6 +551,10 @@ func (m *Map) Lookup(key, valueOut interface{}) error {
 
 // LookupAndDelete retrieves and deletes a value from a Map.
 //
+// The lookup and the delete are atomic, which allows draining a map
+// without losing concurrent updates. Queue and Stack maps ignore the key,
+// pass nil. Hash maps require at least Linux 5.14.
+//
 // Returns ErrKeyNotExist if the key doesn't exist.
 func (m *Map) LookupAndDelete(key, valueOut interface{}) error {
 	valuePtr, valueBytes := makeBuffer(valueOut, m.fullValueSize)
@@ -466,7 +578,7 @@ func (m *Map) LookupBytes(key interface{}) ([]byte, error) {
 	valueBytes := make([]byte, m.fullValueSize)
 	valuePtr := internal.NewSlicePointer(valueBytes)
 
-	err := m.lookup(key, valuePtr)
+	err := m.lookup(key, valuePtr, 0)
 	if errors.Is(err, ErrKeyNotExist) {
 		return nil, nil
 	}
@@ -474,13 +586,13 @@ func (m *Map) LookupBytes(key interface{}) ([]byte, error) {
 	return valueBytes, err
 }
 
-func (m *Map) lookup(key interface{}, valueOut internal.Pointer) error {
+func (m *Map) lookup(key interface{}, valueOut internal.Pointer, flags MapLookupFlags) error {
 	keyPtr, err := m.marshalKey(key)
 	if err != nil {
 		return fmt.Errorf("can't marshal key: %w", err)
 	}
 
-	if err = bpfMapLookupElem(m.fd, keyPtr, valueOut); err != nil {
+	if err = bpfMapLookupElem(m.fd, keyPtr, valueOut, uint64(flags)); err != nil {
 		return fmt.Errorf("lookup failed: %w", err)
 	}
 	return nil
@@ -498,6 +610,11 @@ const (
 	UpdateNoExist MapUpdateFlags = 1 << (iota - 1)
 	// UpdateExist updates an existing element.
 	UpdateExist
+	// UpdateLock updates elements under bpf_spin_lock. It may be combined
+	// with one of the other flags.
+	//
+	// Requires a value containing a struct bpf_spin_lock described by BTF.
+	UpdateLock
 )
 
 // Put replaces or creates a value in map.
@@ -749,6 +866,326 @@ func (m *Map) BatchDelete(keys interface{}, opts *BatchOptions) (int, error) {
 	return int(ct), err
 }
 
+// Clear deletes all entries from the map.
+//
+// Keys are deleted in batches if the kernel supports it, and one by one
+// otherwise. Keys which are deleted concurrently are skipped, keys which
+// are added concurrently may or may not be deleted. Queue and Stack maps
+// are drained instead.
+//
+// Returns the number of deleted entries. Arrays can't be cleared, since
+// their elements can't be deleted.
+func (m *Map) Clear() (int, error) {
+	if m.typ == Queue || m.typ == Stack {
+		return m.drain()
+	}
+
+	// Limit the number of keys held in memory.
+	const batchSize = 256
+
+	var (
+		deleted int
+		keys    = make([]byte, 0, batchSize*int(m.keySize))
+		next    = make([]byte, m.keySize)
+	)
+	for {
+		keys = keys[:0]
+
+		// Always start at the first key, since deleting the key which is
+		// passed to NextKey makes iteration restart anyway.
+		var prev interface{}
+		for len(keys) < cap(keys) {
+			err := m.nextKey(prev, internal.NewSlicePointer(next))
+			if errors.Is(err, ErrKeyNotExist) {
+				break
+			}
+			if err != nil {
+				return deleted, err
+			}
+
+			keys = append(keys, next...)
+			prev = keys[len(keys)-len(next):]
+		}
+
+		if len(keys) == 0 {
+			return deleted, nil
+		}
+
+		n, err := m.deleteKeys(keys)
+		deleted += n
+		if err != nil {
+			return deleted, fmt.Errorf("clear: %w", err)
+		}
+	}
+}
+
+// deleteKeys deletes the concatenated keys in buf, skipping keys which
+// don't exist.
+func (m *Map) deleteKeys(buf []byte) (int, error) {
+	keySize := int(m.keySize)
+
+	if haveBatchAPI() != nil || m.typ.hasPerCPUValue() {
+		var deleted int
+		for ; len(buf) > 0; buf = buf[keySize:] {
+			err := bpfMapDeleteElem(m.fd, internal.NewSlicePointer(buf[:keySize]))
+			if errors.Is(err, ErrKeyNotExist) {
+				continue
+			}
+			if err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+		return deleted, nil
+	}
+
+	var (
+		deleted int
+		nilPtr  internal.Pointer
+	)
+	for len(buf) > 0 {
+		count := uint32(len(buf) / keySize)
+		n, err := bpfMapBatch(internal.BPF_MAP_DELETE_BATCH, m.fd, nilPtr, nilPtr, internal.NewSlicePointer(buf), nilPtr, count, nil)
+		deleted += int(n)
+		if errors.Is(err, ErrKeyNotExist) {
+			// The key at index n doesn't exist anymore, skip it.
+			buf = buf[(int(n)+1)*keySize:]
+			continue
+		}
+		if err != nil {
+			return deleted, err
+		}
+		break
+	}
+
+	return deleted, nil
+}
+
+// drain removes all elements from a Queue or Stack.
+func (m *Map) drain() (int, error) {
+	var (
+		drained int
+		value   = make([]byte, m.fullValueSize)
+	)
+	for {
+		err := bpfMapLookupAndDelete(m.fd, internal.Pointer{}, internal.NewSlicePointer(value))
+		if errors.Is(err, ErrKeyNotExist) {
+			return drained, nil
+		}
+		if err != nil {
+			return drained, fmt.Errorf("clear: %w", err)
+		}
+		drained++
+	}
+}
+
+// CopyMap copies all entries of src into dst, overwriting existing entries.
+//
+// Both maps must have the same type, key size and value size. dst must be
+// large enough to hold all entries. Entries are transferred using the
+// batch API for hash maps if the kernel supports it.
+//
+// Entries which are modified concurrently may or may not be copied.
+// Maps which store maps, programs or perf events can't be copied, since
+// lookups return IDs instead of fds.
+//
+// Returns the number of copied entries.
+func CopyMap(dst, src *Map) (int, error) {
+	switch {
+	case dst.typ != src.typ:
+		return 0, fmt.Errorf("copy map: type %s doesn't match %s", dst.typ, src.typ)
+	case dst.keySize != src.keySize:
+		return 0, fmt.Errorf("copy map: key size %d doesn't match %d", dst.keySize, src.keySize)
+	case dst.valueSize != src.valueSize:
+		return 0, fmt.Errorf("copy map: value size %d doesn't match %d", dst.valueSize, src.valueSize)
+	case src.typ.canStoreMap(), src.typ.canStoreProgram():
+		return 0, fmt.Errorf("copy map: can't copy %s", src.typ)
+	case src.typ == PerfEventArray, src.typ == Queue, src.typ == Stack:
+		return 0, fmt.Errorf("copy map: can't copy %s", src.typ)
+	}
+
+	switch src.typ {
+	case Hash, LRUHash:
+		if haveBatchAPI() == nil {
+			n, err := copyBatch(dst, src)
+			if err != nil {
+				return n, fmt.Errorf("copy map: %w", err)
+			}
+			return n, nil
+		}
+	}
+
+	var (
+		copied int
+		key    = make([]byte, src.keySize)
+		value  = make([]byte, src.fullValueSize)
+		prev   interface{}
+	)
+	for {
+		err := src.nextKey(prev, internal.NewSlicePointer(key))
+		if errors.Is(err, ErrKeyNotExist) {
+			return copied, nil
+		}
+		if err != nil {
+			return copied, fmt.Errorf("copy map: %w", err)
+		}
+		prev = key
+
+		keyPtr := internal.NewSlicePointer(key)
+		err = bpfMapLookupElem(src.fd, keyPtr, internal.NewSlicePointer(value), 0)
+		if errors.Is(err, ErrKeyNotExist) {
+			// Deleted concurrently.
+			continue
+		}
+		if err != nil {
+			return copied, fmt.Errorf("copy map: lookup: %w", err)
+		}
+
+		if err := bpfMapUpdateElem(dst.fd, keyPtr, internal.NewSlicePointer(value), uint64(UpdateAny)); err != nil {
+			return copied, fmt.Errorf("copy map: update: %w", err)
+		}
+		copied++
+	}
+}
+
+// makeBatchCursor allocates a buffer for the out_batch token of batch
+// lookups. Hash maps write a u32 bucket index to it regardless of the
+// key size, so it must hold at least four bytes.
+func makeBatchCursor(keySize uint32) []byte {
+	if keySize < 4 {
+		keySize = 4
+	}
+	return make([]byte, keySize)
+}
+
+// copyBatch copies entries between hash maps using the batch API.
+func copyBatch(dst, src *Map) (int, error) {
+	const batchSize = 256
+
+	var (
+		copied   int
+		keys     = make([]byte, batchSize*int(src.keySize))
+		values   = make([]byte, batchSize*src.fullValueSize)
+		inBatch  internal.Pointer
+		outBatch = makeBatchCursor(src.keySize)
+		nilPtr   internal.Pointer
+	)
+	for {
+		n, err := bpfMapBatch(internal.BPF_MAP_LOOKUP_BATCH, src.fd, inBatch, internal.NewSlicePointer(outBatch),
+			internal.NewSlicePointer(keys), internal.NewSlicePointer(values), batchSize, nil)
+		done := errors.Is(err, ErrKeyNotExist)
+		if err != nil && !done {
+			return copied, fmt.Errorf("lookup batch: %w", err)
+		}
+
+		if n > 0 {
+			updated, err := bpfMapBatch(internal.BPF_MAP_UPDATE_BATCH, dst.fd, nilPtr, nilPtr,
+				internal.NewSlicePointer(keys), internal.NewSlicePointer(values), n, nil)
+			copied += int(updated)
+			if err != nil {
+				return copied, fmt.Errorf("update batch: %w", err)
+			}
+		}
+
+		if done {
+			return copied, nil
+		}
+
+		// Copy the token, since the next call overwrites outBatch.
+		inBatch = internal.NewSlicePointer(append([]byte(nil), outBatch...))
+	}
+}
+
+// ResizeOptions control ResizeMap.
+type ResizeOptions struct {
+	// Replace the pin of the map with the resized map. The map must be
+	// pinned.
+	ReplacePin bool
+	// Store the resized map at OuterKey in Outer, which must be an
+	// ArrayOfMaps or HashOfMaps.
+	Outer    *Map
+	OuterKey interface{}
+}
+
+// ResizeMap creates a copy of m with room for maxEntries and migrates all
+// entries to it, since maps can't grow in place.
+//
+// The resized map can optionally replace m in the file system or in an
+// outer map. Both operations are atomic, so readers see either the old or
+// the new map. Updates made to m while it is being copied may be lost.
+//
+// The resized map only carries BTF if m was created from a MapSpec with
+// BTF. m is left open and must be closed by the caller.
+func ResizeMap(m *Map, maxEntries uint32, opts *ResizeOptions) (*Map, error) {
+	if opts == nil {
+		opts = new(ResizeOptions)
+	}
+
+	if opts.ReplacePin && m.pinnedPath == "" {
+		return nil, errors.New("resize map: can't replace pin of a map which isn't pinned")
+	}
+
+	resized, err := NewMap(&MapSpec{
+		Name:       m.name,
+		Type:       m.typ,
+		KeySize:    m.keySize,
+		ValueSize:  m.valueSize,
+		MaxEntries: maxEntries,
+		Flags:      m.flags,
+		BTF:        m.btf,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("resize map: %w", err)
+	}
+
+	if _, err := CopyMap(resized, m); err != nil {
+		resized.Close()
+		return nil, fmt.Errorf("resize map: %w", err)
+	}
+
+	// Replace the pin before updating the outer map, since only the pin
+	// can be restored if the second step fails.
+	if opts.ReplacePin {
+		if err := replacePin(m.pinnedPath, resized.fd); err != nil {
+			resized.Close()
+			return nil, fmt.Errorf("resize map: replace pin: %w", err)
+		}
+	}
+
+	if opts.Outer != nil {
+		if err := opts.Outer.Put(opts.OuterKey, resized); err != nil {
+			if opts.ReplacePin {
+				_ = replacePin(m.pinnedPath, m.fd)
+			}
+			resized.Close()
+			return nil, fmt.Errorf("resize map: replace in outer map: %w", err)
+		}
+	}
+
+	if opts.ReplacePin {
+		resized.pinnedPath = m.pinnedPath
+		m.pinnedPath = ""
+	}
+
+	return resized, nil
+}
+
+// replacePin atomically replaces the object pinned at path with fd.
+func replacePin(path string, fd *internal.FD) error {
+	// Pin next to the old object and rename over it, which is atomic.
+	tmp := fmt.Sprintf("%s_resize_%d", path, os.Getpid())
+	if err := internal.Pin("", tmp, fd); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		_ = internal.Unpin(tmp)
+		return err
+	}
+
+	return nil
+}
+
 // Iterate traverses a map.
 //
 // It's safe to create multiple iterators at the same time.
@@ -760,6 +1197,9 @@ func (m *Map) Iterate() *MapIterator {
 }
 
 // Close removes a Map
+//
+// Calling Close more than once is a no-op. Use TrackFDLeaks to find
+// maps which are never closed.
 func (m *Map) Close() error {
 	if m == nil {
 		// This makes it easier to clean up when iterating maps
@@ -811,6 +1251,7 @@ func (m *Map) Clone() (*Map, error) {
 		m.flags,
 		"",
 		m.fullValueSize,
+		m.btf,
 	}, nil
 }
 
@@ -894,7 +1335,11 @@ func (m *Map) unmarshalKey(data interface{}, buf []byte) error {
 
 func (m *Map) marshalValue(data interface{}) (internal.Pointer, error) {
 	if m.typ.hasPerCPUValue() {
-		return marshalPerCPUValue(data, int(m.valueSize))
+		buf, err := marshalPerCPUValue(data, int(m.valueSize))
+		if err != nil {
+			return internal.Pointer{}, err
+		}
+		return internal.NewSlicePointer(buf), nil
 	}
 
 	var (
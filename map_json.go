@@ -0,0 +1,279 @@
+package ebpf
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/btf"
+)
+
+// jsonEntry is an element of a map encoded as JSON.
+type jsonEntry struct {
+	Key    interface{}   `json:"key"`
+	Value  interface{}   `json:"value,omitempty"`
+	Values []interface{} `json:"values,omitempty"`
+}
+
+// DumpJSON writes the contents of the map to w.
+//
+// The entries are encoded as a JSON array of objects with a "key" and a
+// "value" property. Values of per-CPU maps are stored in a "values"
+// array instead, with one element per possible CPU.
+//
+// Keys and values are decoded using the BTF of the MapSpec the map was
+// created from. Without BTF they are encoded as hex strings.
+func (m *Map) DumpJSON(w io.Writer) error {
+	entries, err := m.dump()
+	if err != nil {
+		return fmt.Errorf("dump %s: %w", m, err)
+	}
+
+	var keyType, valueType btf.Type
+	if m.btf != nil {
+		keyType, valueType = btf.MapKey(m.btf), btf.MapValue(m.btf)
+	}
+
+	out := make([]jsonEntry, 0, len(entries))
+	for _, entry := range entries {
+		var je jsonEntry
+
+		je.Key, err = decodeJSON(keyType, entry.key)
+		if err != nil {
+			return fmt.Errorf("key: %w", err)
+		}
+
+		if !m.typ.hasPerCPUValue() {
+			je.Value, err = decodeJSON(valueType, entry.value)
+			if err != nil {
+				return fmt.Errorf("value: %w", err)
+			}
+			out = append(out, je)
+			continue
+		}
+
+		stride := align(int(m.valueSize), 8)
+		for buf := entry.value; len(buf) >= stride; buf = buf[stride:] {
+			value, err := decodeJSON(valueType, buf[:m.valueSize])
+			if err != nil {
+				return fmt.Errorf("value: %w", err)
+			}
+			je.Values = append(je.Values, value)
+		}
+		out = append(out, je)
+	}
+
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		return fmt.Errorf("dump %s: %w", m, err)
+	}
+	return nil
+}
+
+// decodeJSON decodes buf into a value which can be encoded by
+// encoding/json.
+func decodeJSON(typ btf.Type, buf []byte) (interface{}, error) {
+	if typ == nil {
+		return hex.EncodeToString(buf), nil
+	}
+
+	if _, void := typ.(*btf.Void); void {
+		return hex.EncodeToString(buf), nil
+	}
+
+	var value interface{}
+	if err := btf.Decode(typ, buf, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// LoadJSON reads entries in the format produced by DumpJSON from r and
+// stores them in the map, overwriting existing entries.
+//
+// Keys and values are encoded using the BTF of the MapSpec the map was
+// created from, see btf.EncodeValue for the accepted values. Without BTF
+// they must be hex strings.
+//
+// Returns the number of stored entries.
+func (m *Map) LoadJSON(r io.Reader) (int, error) {
+	var in []jsonEntry
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := dec.Decode(&in); err != nil {
+		return 0, fmt.Errorf("load json: %w", err)
+	}
+
+	entries := make([]rawEntry, 0, len(in))
+	for i, je := range in {
+		values := je.Values
+		if !m.typ.hasPerCPUValue() {
+			values = []interface{}{je.Value}
+		}
+
+		entry, err := m.encodeEntry(je.Key, values)
+		if err != nil {
+			return 0, fmt.Errorf("load json: entry %d: %w", i, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	n, err := m.updateRaw(entries)
+	if err != nil {
+		return n, fmt.Errorf("load json: %w", err)
+	}
+	return n, nil
+}
+
+// LoadCSV reads entries in CSV format from r and stores them in the map,
+// overwriting existing entries.
+//
+// Each record contains a key followed by a value, or by one value per
+// possible CPU for per-CPU maps. Fields are encoded like by LoadJSON,
+// except that fields starting with '{' or '[' are parsed as JSON and all
+// other fields are used as strings.
+//
+// Returns the number of stored entries.
+func (m *Map) LoadCSV(r io.Reader) (int, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return 0, fmt.Errorf("load csv: %w", err)
+	}
+
+	entries := make([]rawEntry, 0, len(records))
+	for i, record := range records {
+		fields := make([]interface{}, 0, len(record))
+		for _, field := range record {
+			value, err := parseCSVField(field)
+			if err != nil {
+				return 0, fmt.Errorf("load csv: record %d: %w", i+1, err)
+			}
+			fields = append(fields, value)
+		}
+
+		entry, err := m.encodeEntry(fields[0], fields[1:])
+		if err != nil {
+			return 0, fmt.Errorf("load csv: record %d: %w", i+1, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	n, err := m.updateRaw(entries)
+	if err != nil {
+		return n, fmt.Errorf("load csv: %w", err)
+	}
+	return n, nil
+}
+
+func parseCSVField(field string) (interface{}, error) {
+	field = strings.TrimSpace(field)
+	if !strings.HasPrefix(field, "{") && !strings.HasPrefix(field, "[") {
+		return field, nil
+	}
+
+	var value interface{}
+	dec := json.NewDecoder(strings.NewReader(field))
+	dec.UseNumber()
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// encodeEntry encodes a key and either a single value or one value per
+// possible CPU.
+func (m *Map) encodeEntry(key interface{}, values []interface{}) (rawEntry, error) {
+	var keyType, valueType btf.Type
+	if m.btf != nil {
+		keyType, valueType = btf.MapKey(m.btf), btf.MapValue(m.btf)
+	}
+
+	keyBytes, err := encodeJSON(keyType, key, int(m.keySize))
+	if err != nil {
+		return rawEntry{}, fmt.Errorf("key: %w", err)
+	}
+
+	stride := int(m.valueSize)
+	if m.typ.hasPerCPUValue() {
+		stride = align(stride, 8)
+	}
+
+	if want := m.fullValueSize / stride; len(values) != want {
+		return rawEntry{}, fmt.Errorf("expected %d values, got %d", want, len(values))
+	}
+
+	valueBytes := make([]byte, m.fullValueSize)
+	for i, value := range values {
+		buf, err := encodeJSON(valueType, value, int(m.valueSize))
+		if err != nil {
+			return rawEntry{}, fmt.Errorf("value: %w", err)
+		}
+		copy(valueBytes[i*stride:], buf)
+	}
+
+	return rawEntry{keyBytes, valueBytes}, nil
+}
+
+// encodeJSON is the inverse of decodeJSON.
+func encodeJSON(typ btf.Type, value interface{}, size int) ([]byte, error) {
+	if _, void := typ.(*btf.Void); typ == nil || void {
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a hex string, got %T", value)
+		}
+
+		buf, err := hex.DecodeString(str)
+		if err != nil {
+			return nil, err
+		}
+		if len(buf) != size {
+			return nil, fmt.Errorf("%d bytes don't match size %d", len(buf), size)
+		}
+		return buf, nil
+	}
+
+	buf, err := btf.EncodeValue(typ, value)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) != size {
+		return nil, fmt.Errorf("%s has size %d, expected %d", typ, len(buf), size)
+	}
+	return buf, nil
+}
+
+// updateRaw stores encoded entries in the map, using the batch API for
+// hash maps if available.
+func (m *Map) updateRaw(entries []rawEntry) (int, error) {
+	if (m.typ != Hash && m.typ != LRUHash) || haveBatchAPI() != nil {
+		for i, entry := range entries {
+			err := bpfMapUpdateElem(m.fd, internal.NewSlicePointer(entry.key), internal.NewSlicePointer(entry.value), uint64(UpdateAny))
+			if err != nil {
+				return i, err
+			}
+		}
+		return len(entries), nil
+	}
+
+	if len(entries) == 0 {
+		return 0, nil
+	}
+
+	var keys, values bytes.Buffer
+	for _, entry := range entries {
+		keys.Write(entry.key)
+		values.Write(entry.value)
+	}
+
+	var nilPtr internal.Pointer
+	n, err := bpfMapBatch(internal.BPF_MAP_UPDATE_BATCH, m.fd, nilPtr, nilPtr,
+		internal.NewSlicePointer(keys.Bytes()), internal.NewSlicePointer(values.Bytes()), uint32(len(entries)), nil)
+	if err != nil {
+		return int(n), fmt.Errorf("update batch: %w", err)
+	}
+	return int(n), nil
+}
@@ -0,0 +1,218 @@
+package ebpf
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/btf"
+)
+
+func TestMapDumpJSON(t *testing.T) {
+	m, err := NewMap(&MapSpec{
+		Type:       Hash,
+		KeySize:    4,
+		ValueSize:  8,
+		MaxEntries: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if err := m.Put(uint32(1), [2]uint32{2, 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := interface{}(m).(json.Marshaler); ok {
+		t.Error("Map implements json.Marshaler")
+	}
+
+	var have []map[string]interface{}
+	decode := func() {
+		t.Helper()
+
+		var buf bytes.Buffer
+		if err := m.DumpJSON(&buf); err != nil {
+			t.Fatal("Can't dump map:", err)
+		}
+
+		have = nil
+		if err := json.Unmarshal(buf.Bytes(), &have); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	decode()
+	key := make([]byte, 4)
+	internal.NativeEndian.PutUint32(key, 1)
+	if len(have) != 1 || have[0]["key"] != hex.EncodeToString(key) {
+		t.Error("Key without BTF isn't encoded as hex:", have)
+	}
+
+	u32 := &btf.Int{Name: "u32", Size: 4}
+	value := &btf.Struct{Size: 8, Members: []btf.Member{
+		{Name: "a", Type: u32, Offset: 0},
+		{Name: "b", Type: u32, Offset: 32},
+	}}
+	btfMap := btf.NewMap(nil, u32, value)
+	m.btf = &btfMap
+
+	decode()
+	want := []map[string]interface{}{{
+		"key":   float64(1),
+		"value": map[string]interface{}{"a": float64(2), "b": float64(3)},
+	}}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("Expected %v, got %v", want, have)
+	}
+}
+
+func TestPerCPUMapDumpJSON(t *testing.T) {
+	m, err := NewMap(&MapSpec{
+		Type:       PerCPUArray,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	cpus, err := internal.PossibleCPUs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := m.DumpJSON(&buf); err != nil {
+		t.Fatal("Can't dump map:", err)
+	}
+
+	var have []struct {
+		Values []string `json:"values"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &have); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(have) != 1 || len(have[0].Values) != cpus {
+		t.Errorf("Expected one value per CPU, got %s", buf.String())
+	}
+}
+
+func TestMapLoadJSON(t *testing.T) {
+	m, err := NewMap(&MapSpec{
+		Type:       Hash,
+		KeySize:    4,
+		ValueSize:  8,
+		MaxEntries: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if err := m.Put(uint32(1), [2]uint32{2, 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := m.DumpJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Delete(uint32(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := m.LoadJSON(&buf)
+	if err != nil {
+		t.Fatal("Can't load JSON:", err)
+	}
+	if n != 1 {
+		t.Error("Expected one entry, got", n)
+	}
+
+	var value [2]uint32
+	if err := m.Lookup(uint32(1), &value); err != nil || value != [2]uint32{2, 3} {
+		t.Error("Round trip through JSON doesn't preserve contents:", value, err)
+	}
+
+	u32 := &btf.Int{Name: "u32", Size: 4}
+	btfMap := btf.NewMap(nil, u32, &btf.Struct{Size: 8, Members: []btf.Member{
+		{Name: "a", Type: u32, Offset: 0},
+		{Name: "b", Type: u32, Offset: 32},
+	}})
+	m.btf = &btfMap
+
+	_, err = m.LoadJSON(strings.NewReader(`[{"key": 5, "value": {"a": 6, "b": "0x7"}}]`))
+	if err != nil {
+		t.Fatal("Can't load JSON with BTF:", err)
+	}
+	if err := m.Lookup(uint32(5), &value); err != nil || value != [2]uint32{6, 7} {
+		t.Error("Wrong value after loading JSON with BTF:", value, err)
+	}
+
+	_, err = m.LoadJSON(strings.NewReader(`[{"key": 5, "value": {"a": "foo"}}]`))
+	if err == nil {
+		t.Error("Loading an invalid value doesn't return an error")
+	}
+}
+
+func TestMapLoadCSV(t *testing.T) {
+	m, err := NewMap(&MapSpec{
+		Type:       Hash,
+		KeySize:    4,
+		ValueSize:  8,
+		MaxEntries: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	key := make([]byte, 4)
+	internal.NativeEndian.PutUint32(key, 1)
+	value := make([]byte, 8)
+	internal.NativeEndian.PutUint32(value, 2)
+	internal.NativeEndian.PutUint32(value[4:], 3)
+
+	csv := hex.EncodeToString(key) + "," + hex.EncodeToString(value) + "\n"
+	if _, err := m.LoadCSV(strings.NewReader(csv)); err != nil {
+		t.Fatal("Can't load CSV without BTF:", err)
+	}
+
+	var have [2]uint32
+	if err := m.Lookup(uint32(1), &have); err != nil || have != [2]uint32{2, 3} {
+		t.Error("Wrong value after loading CSV without BTF:", have, err)
+	}
+
+	u32 := &btf.Int{Name: "u32", Size: 4}
+	btfMap := btf.NewMap(nil, u32, &btf.Array{Type: u32, Nelems: 2})
+	m.btf = &btfMap
+
+	n, err := m.LoadCSV(strings.NewReader("2,\"[4, 5]\"\n0x3,[6]\n"))
+	if err != nil {
+		t.Fatal("Can't load CSV with BTF:", err)
+	}
+	if n != 2 {
+		t.Error("Expected two entries, got", n)
+	}
+
+	if err := m.Lookup(uint32(2), &have); err != nil || have != [2]uint32{4, 5} {
+		t.Error("Wrong value for key 2:", have, err)
+	}
+	if err := m.Lookup(uint32(3), &have); err != nil || have != [2]uint32{6, 0} {
+		t.Error("Wrong value for key 3:", have, err)
+	}
+
+	if _, err := m.LoadCSV(strings.NewReader("1\n")); err == nil {
+		t.Error("Loading a record without value doesn't return an error")
+	}
+}
@@ -1,6 +1,7 @@
 package ebpf
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -224,6 +225,62 @@ func TestBatchAPIHash(t *testing.T) {
 	}
 }
 
+func TestBatchAPIMarshalers(t *testing.T) {
+	if err := haveBatchAPI(); err != nil {
+		t.Skipf("batch api not available: %v", err)
+	}
+	m, err := NewMap(&MapSpec{
+		Type:       Hash,
+		KeySize:    5,
+		ValueSize:  8,
+		MaxEntries: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	type value struct {
+		A uint8 `ebpf:"a"`
+		B uint32
+	}
+
+	var (
+		keys         = []customEncoding{{"hello"}, {"world"}}
+		values       = []value{{1, 2}, {3, 4}}
+		nextKey      customEncoding
+		lookupKeys   = make([]*customEncoding, 2)
+		lookupValues = make([]value, 2)
+	)
+
+	if _, err := m.BatchUpdate(keys, values, nil); err != nil {
+		t.Fatal("BatchUpdate:", err)
+	}
+
+	// customEncoding implements MarshalBinary with a pointer receiver.
+	var v value
+	if err := m.Lookup(customEncoding{"hello"}, &v); err != nil {
+		t.Fatal("Can't lookup key passed by value:", err)
+	}
+	if v != values[0] {
+		t.Errorf("Expected %v, got %v", values[0], v)
+	}
+
+	_, err = m.BatchLookup(nil, &nextKey, lookupKeys, lookupValues, nil)
+	if !errors.Is(err, ErrKeyNotExist) {
+		t.Fatalf("BatchLookup: expected %v got %v", ErrKeyNotExist, err)
+	}
+
+	found := make(map[string]value)
+	for i, key := range lookupKeys {
+		found[key.data] = lookupValues[i]
+	}
+	want := map[string]value{"HELLO": values[0], "WORLD": values[1]}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("Expected %v, got %v", want, found)
+	}
+}
+
 func TestBatchAPIMapDelete(t *testing.T) {
 	if err := haveBatchAPI(); err != nil {
 		t.Skipf("batch api not available: %v", err)
@@ -619,6 +676,338 @@ func createArray(t *testing.T) *Map {
 	return m
 }
 
+func TestMapClear(t *testing.T) {
+	for _, typ := range []MapType{Hash, PerCPUHash, Queue} {
+		t.Run(typ.String(), func(t *testing.T) {
+			spec := &MapSpec{
+				Type:       typ,
+				KeySize:    4,
+				ValueSize:  4,
+				MaxEntries: 1000,
+			}
+			if typ == Queue {
+				testutils.SkipOnOldKernel(t, "4.20", "map type queue")
+				spec.KeySize = 0
+			}
+
+			m, err := NewMap(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer m.Close()
+
+			cpus, err := internal.PossibleCPUs()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := uint32(0); i < spec.MaxEntries; i++ {
+				var key interface{} = i
+				if typ == Queue {
+					key = nil
+				}
+
+				var value interface{} = i
+				if typ == PerCPUHash {
+					value = make([]uint32, cpus)
+				}
+
+				if err := m.Put(key, value); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			n, err := m.Clear()
+			if err != nil {
+				t.Fatal("Can't clear map:", err)
+			}
+			if n != int(spec.MaxEntries) {
+				t.Errorf("Expected %d deleted entries, got %d", spec.MaxEntries, n)
+			}
+
+			if typ == Queue {
+				var v uint32
+				if err := m.LookupAndDelete(nil, &v); !errors.Is(err, ErrKeyNotExist) {
+					t.Error("Queue isn't empty:", err)
+				}
+				return
+			}
+
+			if key, err := m.NextKeyBytes(nil); key != nil || err != nil {
+				t.Errorf("Map isn't empty: %v %v", key, err)
+			}
+		})
+	}
+
+	t.Run("missing keys", func(t *testing.T) {
+		m, err := NewMap(&MapSpec{
+			Type:       Hash,
+			KeySize:    4,
+			ValueSize:  4,
+			MaxEntries: 3,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer m.Close()
+
+		keys := make([]byte, 12)
+		for i := uint32(0); i < 3; i++ {
+			internal.NativeEndian.PutUint32(keys[i*4:], i)
+			if i != 1 {
+				if err := m.Put(i, i); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		// Key 1 simulates a key which was deleted concurrently.
+		n, err := m.deleteKeys(keys)
+		if err != nil {
+			t.Fatal("Missing key isn't skipped:", err)
+		}
+		if n != 2 {
+			t.Error("Expected 2 deleted keys, got", n)
+		}
+	})
+
+	arr := createArray(t)
+	defer arr.Close()
+
+	if _, err := arr.Clear(); err == nil {
+		t.Error("Clearing an array doesn't return an error")
+	}
+}
+
+func TestCopyMap(t *testing.T) {
+	for _, typ := range []MapType{Hash, Array, PerCPUHash} {
+		t.Run(typ.String(), func(t *testing.T) {
+			spec := &MapSpec{
+				Type:       typ,
+				KeySize:    4,
+				ValueSize:  4,
+				MaxEntries: 600,
+			}
+
+			src, err := NewMap(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer src.Close()
+
+			dst, err := NewMap(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer dst.Close()
+
+			cpus, err := internal.PossibleCPUs()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := uint32(0); i < spec.MaxEntries; i++ {
+				var value interface{} = i * 2
+				if typ == PerCPUHash {
+					values := make([]uint32, cpus)
+					values[0] = i * 2
+					value = values
+				}
+
+				if err := src.Put(i, value); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			n, err := CopyMap(dst, src)
+			if err != nil {
+				t.Fatal("Can't copy map:", err)
+			}
+			if n != int(spec.MaxEntries) {
+				t.Errorf("Expected %d copied entries, got %d", spec.MaxEntries, n)
+			}
+
+			for i := uint32(0); i < spec.MaxEntries; i++ {
+				var value uint32
+				if typ == PerCPUHash {
+					var values []uint32
+					if err := dst.Lookup(i, &values); err != nil {
+						t.Fatal(err)
+					}
+					value = values[0]
+				} else if err := dst.Lookup(i, &value); err != nil {
+					t.Fatal(err)
+				}
+
+				if value != i*2 {
+					t.Fatalf("Expected value %d for key %d, got %d", i*2, i, value)
+				}
+			}
+		})
+	}
+
+	t.Run("small key", func(t *testing.T) {
+		// The batch API writes a u32 cursor for hash maps, which is
+		// larger than the key.
+		spec := &MapSpec{
+			Type:       Hash,
+			KeySize:    1,
+			ValueSize:  4,
+			MaxEntries: 256,
+		}
+
+		src, err := NewMap(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer src.Close()
+
+		dst, err := NewMap(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dst.Close()
+
+		for i := 0; i < int(spec.MaxEntries); i++ {
+			if err := src.Put(uint8(i), uint32(i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		n, err := CopyMap(dst, src)
+		if err != nil {
+			t.Fatal("Can't copy map:", err)
+		}
+		if n != int(spec.MaxEntries) {
+			t.Errorf("Expected %d copied entries, got %d", spec.MaxEntries, n)
+		}
+
+		var value uint32
+		if err := dst.Lookup(uint8(255), &value); err != nil || value != 255 {
+			t.Error("Can't look up copied entry:", value, err)
+		}
+
+		if cursor := makeBatchCursor(spec.KeySize); len(cursor) < 4 {
+			t.Errorf("Batch cursor has %d bytes, expected at least 4", len(cursor))
+		}
+	})
+
+	hash := createHash()
+	defer hash.Close()
+
+	arr := createArray(t)
+	defer arr.Close()
+
+	if _, err := CopyMap(arr, hash); err == nil {
+		t.Error("Copying between incompatible maps doesn't return an error")
+	}
+}
+
+func TestResizeMap(t *testing.T) {
+	tmp := testutils.TempBPFFS(t)
+
+	spec := &MapSpec{
+		Name:       "resize",
+		Type:       Hash,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 2,
+	}
+
+	m, err := NewMap(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if err := m.Put(uint32(1), uint32(42)); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(tmp, "map")
+	if err := m.Pin(path); err != nil {
+		t.Fatal(err)
+	}
+
+	outer, err := NewMap(&MapSpec{
+		Type:       HashOfMaps,
+		KeySize:    4,
+		MaxEntries: 1,
+		InnerMap:   spec,
+	})
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer outer.Close()
+
+	resized, err := ResizeMap(m, 10, &ResizeOptions{
+		ReplacePin: true,
+		Outer:      outer,
+		OuterKey:   uint32(0),
+	})
+	if err != nil {
+		t.Fatal("Can't resize map:", err)
+	}
+	defer resized.Close()
+
+	if resized.MaxEntries() != 10 {
+		t.Error("Expected MaxEntries 10, got", resized.MaxEntries())
+	}
+
+	var value uint32
+	if err := resized.Lookup(uint32(1), &value); err != nil || value != 42 {
+		t.Error("Entries aren't migrated:", value, err)
+	}
+
+	pinned, err := LoadPinnedMap(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pinned.Close()
+
+	if pinned.MaxEntries() != 10 {
+		t.Error("Pin isn't replaced by the resized map")
+	}
+
+	var inner *Map
+	if err := outer.Lookup(uint32(0), &inner); err != nil {
+		t.Fatal("Resized map isn't stored in outer map:", err)
+	}
+	defer inner.Close()
+
+	if inner.MaxEntries() != 10 {
+		t.Error("Outer map doesn't contain the resized map")
+	}
+
+	unpinned := createHash()
+	defer unpinned.Close()
+
+	if _, err := ResizeMap(unpinned, 10, &ResizeOptions{ReplacePin: true}); err == nil {
+		t.Error("Replacing the pin of an unpinned map doesn't return an error")
+	}
+
+	// The pin is restored if updating the outer map fails.
+	_, err = ResizeMap(resized, 20, &ResizeOptions{
+		ReplacePin: true,
+		Outer:      outer,
+		OuterKey:   uint64(0),
+	})
+	if err == nil {
+		t.Fatal("Using an invalid outer key doesn't return an error")
+	}
+
+	pinned, err = LoadPinnedMap(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pinned.Close()
+
+	if pinned.MaxEntries() != 10 {
+		t.Error("Pin isn't restored after failing to update the outer map")
+	}
+}
+
 func TestMapQueue(t *testing.T) {
 	testutils.SkipOnOldKernel(t, "4.20", "map type queue")
 
@@ -659,6 +1048,41 @@ func TestMapQueue(t *testing.T) {
 	}
 }
 
+func TestMapLookupAndDeleteHash(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.14", "lookup and delete for hash maps")
+
+	m, err := NewMap(&MapSpec{
+		Type:       Hash,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if err := m.Put(uint32(1), uint32(42)); err != nil {
+		t.Fatal(err)
+	}
+
+	var v uint32
+	if err := m.LookupAndDelete(uint32(1), &v); err != nil {
+		t.Fatal("Can't lookup and delete element:", err)
+	}
+	if v != 42 {
+		t.Error("Want value 42, got", v)
+	}
+
+	if err := m.Lookup(uint32(1), &v); !errors.Is(err, ErrKeyNotExist) {
+		t.Error("Lookup after lookup and delete:", err)
+	}
+
+	if err := m.LookupAndDelete(uint32(1), &v); !errors.Is(err, ErrKeyNotExist) {
+		t.Error("Lookup and delete of missing key:", err)
+	}
+}
+
 func TestMapInMap(t *testing.T) {
 	for _, typ := range []MapType{ArrayOfMaps, HashOfMaps} {
 		t.Run(typ.String(), func(t *testing.T) {
@@ -963,6 +1387,23 @@ func TestExist(t *testing.T) {
 	if err := hash.Update("hello", uint32(42), UpdateNoExist); !errors.Is(err, ErrKeyExist) {
 		t.Error("Updating existing key doesn't return ErrKeyExist")
 	}
+
+	if err := hash.Update("world", uint32(42), UpdateExist); !errors.Is(err, ErrKeyNotExist) {
+		t.Error("Updating missing key doesn't return ErrKeyNotExist")
+	}
+
+	if err := hash.Update("hello", uint32(42), UpdateLock); err == nil {
+		t.Error("UpdateLock is accepted for a value without bpf_spin_lock")
+	}
+
+	var value uint32
+	if err := hash.LookupWithFlags("hello", &value, 0); err != nil || value != 21 {
+		t.Error("LookupWithFlags without flags doesn't behave like Lookup:", value, err)
+	}
+
+	if err := hash.LookupWithFlags("hello", &value, LookupLock); err == nil {
+		t.Error("LookupLock is accepted for a value without bpf_spin_lock")
+	}
 }
 
 func TestIterateMapInMap(t *testing.T) {
@@ -1049,6 +1490,45 @@ func TestPerCPUMarshaling(t *testing.T) {
 	}
 }
 
+func TestMarshalNativeEndian(t *testing.T) {
+	// Keys and values are encoded in the byte order of the host, without
+	// padding, regardless of the word size of the platform.
+	type kv struct {
+		A uint16
+		B uint32
+		C uint64
+	}
+
+	buf, err := marshalBytes(kv{1, 2, 3}, 14)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := make([]byte, 14)
+	internal.NativeEndian.PutUint16(want[0:], 1)
+	internal.NativeEndian.PutUint32(want[2:], 2)
+	internal.NativeEndian.PutUint64(want[6:], 3)
+	if !bytes.Equal(buf, want) {
+		t.Errorf("Expected %v, got %v", want, buf)
+	}
+
+	var have kv
+	if err := unmarshalBytes(&have, want); err != nil {
+		t.Fatal(err)
+	}
+	if have != (kv{1, 2, 3}) {
+		t.Errorf("Round trip returns %+v", have)
+	}
+
+	// The size of these types depends on the platform.
+	if _, err := marshalBytes(int(1), int(unsafe.Sizeof(int(0)))); err == nil {
+		t.Error("Marshaling int doesn't return an error")
+	}
+	if _, err := marshalBytes(uintptr(1), int(unsafe.Sizeof(uintptr(0)))); err == nil {
+		t.Error("Marshaling uintptr doesn't return an error")
+	}
+}
+
 func TestMapMarshalUnsafe(t *testing.T) {
 	m, err := NewMap(&MapSpec{
 		Type:       Hash,
@@ -1216,6 +1696,62 @@ func TestMapFreeze(t *testing.T) {
 	}
 }
 
+func TestMapFlags(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		typ     MapType
+		flags   uint32
+		version string
+	}{
+		{"NoPrealloc", Hash, MapNoPrealloc, "4.6"},
+		{"NoCommonLRU", LRUHash, MapNoCommonLRU, "4.10"},
+		{"ReadOnlyProg", Array, MapReadOnlyProg, "5.2"},
+		{"WriteOnlyProg", Array, MapWriteOnlyProg, "5.2"},
+		{"Mmapable", Array, MapMmapable, "5.5"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			testutils.SkipOnOldKernel(t, tc.version, tc.name)
+
+			m, err := NewMap(&MapSpec{
+				Type:       tc.typ,
+				KeySize:    4,
+				ValueSize:  4,
+				MaxEntries: 1,
+				Flags:      tc.flags,
+			})
+			testutils.SkipIfNotSupported(t, err)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer m.Close()
+
+			if m.Flags() != tc.flags {
+				t.Errorf("Expected flags %#x, got %#x", tc.flags, m.Flags())
+			}
+		})
+	}
+
+	t.Run("ReadOnly", func(t *testing.T) {
+		testutils.SkipOnOldKernel(t, "4.15", "BPF_F_RDONLY")
+
+		m, err := NewMap(&MapSpec{
+			Type:       Array,
+			KeySize:    4,
+			ValueSize:  4,
+			MaxEntries: 1,
+			Flags:      MapReadOnly,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer m.Close()
+
+		if err := m.Put(uint32(0), uint32(1)); err == nil {
+			t.Error("Read-only map can be modified from user space")
+		}
+	})
+}
+
 func TestMapGetNextID(t *testing.T) {
 	testutils.SkipOnOldKernel(t, "4.13", "bpf_map_get_next_id")
 	var next MapID
@@ -1317,6 +1853,29 @@ func TestMapPinning(t *testing.T) {
 	}
 }
 
+func TestMapSpecCompatible(t *testing.T) {
+	cpus, err := internal.PossibleCPUs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Map{typ: PerfEventArray, keySize: 4, valueSize: 4, maxEntries: uint32(cpus)}
+	spec := &MapSpec{Type: PerfEventArray}
+	if err := spec.Compatible(m); err != nil {
+		t.Error("Perf event array with implicit values isn't compatible:", err)
+	}
+
+	m = &Map{typ: Hash, keySize: 4, valueSize: 8, maxEntries: 1}
+	spec = &MapSpec{Type: Hash, KeySize: 4, ValueSize: 4, MaxEntries: 1}
+	err = spec.Compatible(m)
+	if !errors.Is(err, ErrMapIncompatible) {
+		t.Error("Expected ErrMapIncompatible for differing value size, got", err)
+	}
+	if !strings.Contains(err.Error(), "value_size 4 != 8") {
+		t.Error("Error doesn't explain mismatch:", err)
+	}
+}
+
 type benchValue struct {
 	ID      uint32
 	Val16   uint16
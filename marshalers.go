@@ -50,7 +50,44 @@ func marshalBytes(data interface{}, length int) (buf []byte, err error) {
 		err = errors.New("can't marshal from unsafe.Pointer")
 	case Map, *Map, Program, *Program:
 		err = fmt.Errorf("can't marshal %T", value)
+	case nil:
+		err = errors.New("can't marshal nil")
 	default:
+		if rv := reflect.ValueOf(value); rv.Kind() != reflect.Ptr && reflect.PtrTo(rv.Type()).Implements(binaryMarshalerType) {
+			// MarshalBinary has a pointer receiver, but the value was
+			// passed directly.
+			ptr := reflect.New(rv.Type())
+			ptr.Elem().Set(rv)
+			return marshalBytes(ptr.Interface(), length)
+		}
+
+		if rv := reflect.ValueOf(value); rv.Kind() == reflect.Slice {
+			elementwise, lerr := encodesElementwise(rv.Type().Elem(), binaryMarshalerType)
+			if lerr != nil {
+				return nil, lerr
+			}
+			if elementwise {
+				return marshalElements(rv, length)
+			}
+		}
+
+		v := reflect.Indirect(reflect.ValueOf(value))
+		if !v.IsValid() {
+			return nil, fmt.Errorf("can't marshal nil %T", value)
+		}
+
+		ct, lerr := taggedLayout(v.Type())
+		if lerr != nil {
+			return nil, lerr
+		}
+
+		if ct != nil {
+			if ct.size != length {
+				return nil, fmt.Errorf("%T has C size %d, expected %d", data, ct.size, length)
+			}
+			return ct.marshal(v), nil
+		}
+
 		var wr bytes.Buffer
 		err = binary.Write(&wr, internal.NativeEndian, value)
 		if err != nil {
@@ -111,6 +148,26 @@ func unmarshalBytes(data interface{}, buf []byte) error {
 	case []byte:
 		return errors.New("require pointer to []byte")
 	default:
+		if v := reflect.ValueOf(value); v.Kind() == reflect.Slice {
+			elementwise, err := encodesElementwise(v.Type().Elem(), binaryUnmarshalerType)
+			if err != nil {
+				return err
+			}
+			if elementwise {
+				return unmarshalElements(v, buf)
+			}
+		}
+
+		if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr && !v.IsNil() {
+			ct, err := taggedLayout(v.Type().Elem())
+			if err != nil {
+				return err
+			}
+			if ct != nil {
+				return ct.unmarshal(buf, v.Elem())
+			}
+		}
+
 		rd := bytes.NewReader(buf)
 		if err := binary.Read(rd, internal.NativeEndian, value); err != nil {
 			return fmt.Errorf("decoding %T: %v", value, err)
@@ -119,27 +176,106 @@ func unmarshalBytes(data interface{}, buf []byte) error {
 	}
 }
 
+var (
+	binaryMarshalerType   = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+)
+
+// encodesElementwise returns true if the elements of a slice can't be
+// encoded by encoding/binary, because they implement iface or are structs
+// with a C layout.
+func encodesElementwise(elem reflect.Type, iface reflect.Type) (bool, error) {
+	if elem.Implements(iface) || reflect.PtrTo(elem).Implements(iface) {
+		return true, nil
+	}
+
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+
+	ct, err := taggedLayout(elem)
+	return ct != nil, err
+}
+
+// marshalElements encodes each element of a slice into an equal share of
+// length bytes.
+func marshalElements(slice reflect.Value, length int) ([]byte, error) {
+	n := slice.Len()
+	if n == 0 || length%n != 0 {
+		return nil, fmt.Errorf("%s with %d elements doesn't marshal to %d bytes", slice.Type(), n, length)
+	}
+
+	elemLength := length / n
+	buf := make([]byte, 0, length)
+	for i := 0; i < n; i++ {
+		elem := slice.Index(i)
+		target := elem.Addr().Interface()
+		if elem.Kind() == reflect.Ptr {
+			target = elem.Interface()
+		}
+
+		elemBytes, err := marshalBytes(target, elemLength)
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		buf = append(buf, elemBytes...)
+	}
+
+	return buf, nil
+}
+
+// unmarshalElements decodes an equal share of buf into each element of a
+// slice.
+func unmarshalElements(slice reflect.Value, buf []byte) error {
+	n := slice.Len()
+	if n == 0 || len(buf)%n != 0 {
+		return fmt.Errorf("can't unmarshal %d bytes into %s with %d elements", len(buf), slice.Type(), n)
+	}
+
+	elemLength := len(buf) / n
+	for i := 0; i < n; i++ {
+		elem := slice.Index(i)
+		if elem.Kind() == reflect.Ptr && elem.IsNil() {
+			elem.Set(reflect.New(elem.Type().Elem()))
+		}
+
+		target := elem.Addr().Interface()
+		if elem.Kind() == reflect.Ptr {
+			target = elem.Interface()
+		}
+
+		// Make a copy, since unmarshal can hold on to the buffer.
+		elemBytes := make([]byte, elemLength)
+		copy(elemBytes, buf[i*elemLength:])
+		if err := unmarshalBytes(target, elemBytes); err != nil {
+			return fmt.Errorf("element %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
 // marshalPerCPUValue encodes a slice containing one value per
 // possible CPU into a buffer of bytes.
 //
 // Values are initialized to zero if the slice has less elements than CPUs.
 //
 // slice must have a type like []elementType.
-func marshalPerCPUValue(slice interface{}, elemLength int) (internal.Pointer, error) {
+func marshalPerCPUValue(slice interface{}, elemLength int) ([]byte, error) {
 	sliceType := reflect.TypeOf(slice)
-	if sliceType.Kind() != reflect.Slice {
-		return internal.Pointer{}, errors.New("per-CPU value requires slice")
+	if sliceType == nil || sliceType.Kind() != reflect.Slice {
+		return nil, errors.New("per-CPU value requires slice")
 	}
 
 	possibleCPUs, err := internal.PossibleCPUs()
 	if err != nil {
-		return internal.Pointer{}, err
+		return nil, err
 	}
 
 	sliceValue := reflect.ValueOf(slice)
 	sliceLen := sliceValue.Len()
 	if sliceLen > possibleCPUs {
-		return internal.Pointer{}, fmt.Errorf("per-CPU value exceeds number of CPUs")
+		return nil, fmt.Errorf("per-CPU value exceeds number of CPUs")
 	}
 
 	alignedElemLength := align(elemLength, 8)
@@ -149,14 +285,14 @@ func marshalPerCPUValue(slice interface{}, elemLength int) (internal.Pointer, er
 		elem := sliceValue.Index(i).Interface()
 		elemBytes, err := marshalBytes(elem, elemLength)
 		if err != nil {
-			return internal.Pointer{}, err
+			return nil, err
 		}
 
 		offset := i * alignedElemLength
 		copy(buf[offset:offset+elemLength], elemBytes)
 	}
 
-	return internal.NewSlicePointer(buf), nil
+	return buf, nil
 }
 
 // unmarshalPerCPUValue decodes a buffer into a slice containing one value per
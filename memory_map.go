@@ -0,0 +1,413 @@
+package ebpf
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/cilium/ebpf/internal"
+)
+
+// KeyValueMap is implemented by Map and MemoryMap.
+//
+// It allows writing code which works with maps in the kernel as well as
+// with maps which only exist in user space, for example during tests.
+type KeyValueMap interface {
+	Lookup(key, valueOut interface{}) error
+	Put(key, value interface{}) error
+	Update(key, value interface{}, flags MapUpdateFlags) error
+	Delete(key interface{}) error
+	NextKey(key, nextKeyOut interface{}) error
+}
+
+var (
+	_ KeyValueMap = (*Map)(nil)
+	_ KeyValueMap = (*MemoryMap)(nil)
+)
+
+// MemoryMap is a map which is stored in user space memory.
+//
+// It mimics the semantics of Hash, LRUHash, Array and their per-CPU variants
+// without requiring the bpf syscall. Keys and values are encoded like they
+// would be for a Map, except that unsafe.Pointer, *Map and *Program are not
+// supported.
+//
+// It is safe to use a MemoryMap from multiple goroutines.
+type MemoryMap struct {
+	typ        MapType
+	keySize    uint32
+	valueSize  uint32
+	maxEntries uint32
+	// Per CPU maps store values larger than the size in the spec
+	fullValueSize int
+
+	mu      sync.Mutex
+	entries map[string]*memoryMapEntry
+	// Keys in the order they were inserted.
+	keys  []string
+	clock uint64
+}
+
+type memoryMapEntry struct {
+	value []byte
+	// Used to find the least recently used entry of LRU maps.
+	lastUsed uint64
+}
+
+// NewMemoryMap creates a map in user space.
+//
+// spec.Type must be one of Hash, LRUHash, Array, PerCPUHash, LRUCPUHash or
+// PerCPUArray. Contents of the spec are inserted into the map, all other
+// options like pinning are ignored.
+func NewMemoryMap(spec *MapSpec) (*MemoryMap, error) {
+	switch spec.Type {
+	case Hash, LRUHash, PerCPUHash, LRUCPUHash:
+	case Array, PerCPUArray:
+		if spec.KeySize != 4 {
+			return nil, fmt.Errorf("%s requires KeySize of four", spec.Type)
+		}
+	default:
+		return nil, fmt.Errorf("memory map of type %s: %w", spec.Type, ErrNotSupported)
+	}
+
+	if spec.KeySize == 0 || spec.ValueSize == 0 || spec.MaxEntries == 0 {
+		return nil, errors.New("KeySize, ValueSize and MaxEntries must be non-zero")
+	}
+
+	m := &MemoryMap{
+		typ:           spec.Type,
+		keySize:       spec.KeySize,
+		valueSize:     spec.ValueSize,
+		maxEntries:    spec.MaxEntries,
+		fullValueSize: int(spec.ValueSize),
+		entries:       make(map[string]*memoryMapEntry),
+	}
+
+	if m.typ.hasPerCPUValue() {
+		possibleCPUs, err := internal.PossibleCPUs()
+		if err != nil {
+			return nil, err
+		}
+		m.fullValueSize = align(int(spec.ValueSize), 8) * possibleCPUs
+	}
+
+	if m.isArray() {
+		// Arrays are preallocated and zeroed.
+		for i := uint32(0); i < m.maxEntries; i++ {
+			key := make([]byte, 4)
+			internal.NativeEndian.PutUint32(key, i)
+			m.insert(string(key), make([]byte, m.fullValueSize))
+		}
+	}
+
+	for _, kv := range spec.Contents {
+		if err := m.Put(kv.Key, kv.Value); err != nil {
+			return nil, fmt.Errorf("putting value: key %v: %w", kv.Key, err)
+		}
+	}
+
+	return m, nil
+}
+
+func (m *MemoryMap) String() string {
+	return fmt.Sprintf("%s(memory)", m.typ)
+}
+
+// Type returns the type of the map.
+func (m *MemoryMap) Type() MapType {
+	return m.typ
+}
+
+// KeySize returns the size of the map key in bytes.
+func (m *MemoryMap) KeySize() uint32 {
+	return m.keySize
+}
+
+// ValueSize returns the size of the map value in bytes.
+func (m *MemoryMap) ValueSize() uint32 {
+	return m.valueSize
+}
+
+// MaxEntries returns the maximum number of elements the map can hold.
+func (m *MemoryMap) MaxEntries() uint32 {
+	return m.maxEntries
+}
+
+func (m *MemoryMap) isArray() bool {
+	return m.typ == Array || m.typ == PerCPUArray
+}
+
+func (m *MemoryMap) isLRU() bool {
+	return m.typ == LRUHash || m.typ == LRUCPUHash
+}
+
+// Lookup retrieves a value from the map.
+//
+// Returns an error if the key doesn't exist, see ErrKeyNotExist.
+func (m *MemoryMap) Lookup(key, valueOut interface{}) error {
+	keyBytes, err := m.marshalKey(key)
+	if err != nil {
+		return fmt.Errorf("can't marshal key: %w", err)
+	}
+
+	m.mu.Lock()
+	entry := m.entries[keyBytes]
+	var value []byte
+	if entry != nil {
+		m.touch(entry)
+		value = make([]byte, len(entry.value))
+		copy(value, entry.value)
+	}
+	m.mu.Unlock()
+
+	if entry == nil {
+		return fmt.Errorf("lookup failed: %w", ErrKeyNotExist)
+	}
+
+	return m.unmarshalValue(valueOut, value)
+}
+
+// Put replaces or creates a value in the map.
+//
+// It is equivalent to calling Update with UpdateAny.
+func (m *MemoryMap) Put(key, value interface{}) error {
+	return m.Update(key, value, UpdateAny)
+}
+
+// Update changes the value of a key.
+func (m *MemoryMap) Update(key, value interface{}, flags MapUpdateFlags) error {
+	keyBytes, err := m.marshalKey(key)
+	if err != nil {
+		return fmt.Errorf("can't marshal key: %w", err)
+	}
+
+	valueBytes, err := m.marshalValue(value)
+	if err != nil {
+		return fmt.Errorf("can't marshal value: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry := m.entries[keyBytes]
+	// Updates are always atomic, so UpdateLock has no effect.
+	switch flags &^ UpdateLock {
+	case UpdateAny:
+	case UpdateNoExist:
+		if entry != nil {
+			return fmt.Errorf("update failed: %w", ErrKeyExist)
+		}
+	case UpdateExist:
+		if entry == nil {
+			return fmt.Errorf("update failed: %w", ErrKeyNotExist)
+		}
+	default:
+		return fmt.Errorf("update failed: invalid flags %d", flags)
+	}
+
+	if m.isArray() && entry == nil {
+		return fmt.Errorf("update failed: index %d out of bounds", internal.NativeEndian.Uint32([]byte(keyBytes)))
+	}
+
+	if entry != nil {
+		entry.value = valueBytes
+		m.touch(entry)
+		return nil
+	}
+
+	if len(m.entries) >= int(m.maxEntries) {
+		if !m.isLRU() {
+			return errors.New("update failed: map is full")
+		}
+		m.evict()
+	}
+
+	m.insert(keyBytes, valueBytes)
+	return nil
+}
+
+// Delete removes a value.
+//
+// Returns ErrKeyNotExist if the key does not exist. Values can't be deleted
+// from arrays.
+func (m *MemoryMap) Delete(key interface{}) error {
+	if m.isArray() {
+		return fmt.Errorf("delete failed: can't delete from %s", m.typ)
+	}
+
+	keyBytes, err := m.marshalKey(key)
+	if err != nil {
+		return fmt.Errorf("can't marshal key: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.entries[keyBytes] == nil {
+		return fmt.Errorf("delete failed: %w", ErrKeyNotExist)
+	}
+
+	m.remove(keyBytes)
+	return nil
+}
+
+// LookupAndDelete retrieves and deletes a value from the map.
+//
+// Returns ErrKeyNotExist if the key doesn't exist. Values can't be deleted
+// from arrays.
+func (m *MemoryMap) LookupAndDelete(key, valueOut interface{}) error {
+	if m.isArray() {
+		return fmt.Errorf("lookup and delete failed: can't delete from %s", m.typ)
+	}
+
+	keyBytes, err := m.marshalKey(key)
+	if err != nil {
+		return fmt.Errorf("can't marshal key: %w", err)
+	}
+
+	m.mu.Lock()
+	entry := m.entries[keyBytes]
+	if entry != nil {
+		m.remove(keyBytes)
+	}
+	m.mu.Unlock()
+
+	if entry == nil {
+		return fmt.Errorf("lookup and delete failed: %w", ErrKeyNotExist)
+	}
+
+	return m.unmarshalValue(valueOut, entry.value)
+}
+
+// NextKey finds the key following an initial key.
+//
+// Passing nil as key returns the first key. Keys are returned in insertion
+// order, or in order of their index for arrays. If the initial key doesn't
+// exist the first key is returned.
+//
+// Returns ErrKeyNotExist if there is no next key.
+func (m *MemoryMap) NextKey(key, nextKeyOut interface{}) error {
+	var keyBytes string
+	if key != nil {
+		var err error
+		keyBytes, err = m.marshalKey(key)
+		if err != nil {
+			return fmt.Errorf("can't marshal key: %w", err)
+		}
+	}
+
+	m.mu.Lock()
+	next := -1
+	if key == nil || m.entries[keyBytes] == nil {
+		if len(m.keys) > 0 {
+			next = 0
+		}
+	} else {
+		for i, k := range m.keys {
+			if k == keyBytes && i+1 < len(m.keys) {
+				next = i + 1
+				break
+			}
+		}
+	}
+
+	var nextKey []byte
+	if next != -1 {
+		nextKey = []byte(m.keys[next])
+	}
+	m.mu.Unlock()
+
+	if nextKey == nil {
+		return fmt.Errorf("next key failed: %w", ErrKeyNotExist)
+	}
+
+	return unmarshalBytes(nextKeyOut, nextKey)
+}
+
+// insert adds a new entry. The caller must hold m.mu.
+func (m *MemoryMap) insert(key string, value []byte) {
+	entry := &memoryMapEntry{value: value}
+	m.touch(entry)
+	m.entries[key] = entry
+	m.keys = append(m.keys, key)
+}
+
+// putRaw stores an encoded value, bypassing the checks done by Update.
+func (m *MemoryMap) putRaw(key, value []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry := m.entries[string(key)]; entry != nil {
+		entry.value = value
+		return
+	}
+	m.insert(string(key), value)
+}
+
+// remove deletes an entry. The caller must hold m.mu.
+func (m *MemoryMap) remove(key string) {
+	delete(m.entries, key)
+	for i, k := range m.keys {
+		if k == key {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// evict removes the least recently used entry. The caller must hold m.mu.
+func (m *MemoryMap) evict() {
+	var (
+		oldest string
+		min    uint64
+	)
+	for i, key := range m.keys {
+		if used := m.entries[key].lastUsed; i == 0 || used < min {
+			oldest, min = key, used
+		}
+	}
+	m.remove(oldest)
+}
+
+// touch marks an entry as recently used. The caller must hold m.mu.
+func (m *MemoryMap) touch(entry *memoryMapEntry) {
+	m.clock++
+	entry.lastUsed = m.clock
+}
+
+func (m *MemoryMap) marshalKey(key interface{}) (string, error) {
+	if key == nil {
+		return "", errors.New("can't use nil as key of map")
+	}
+
+	buf, err := marshalBytes(key, int(m.keySize))
+	if err != nil {
+		return "", err
+	}
+
+	return string(buf), nil
+}
+
+func (m *MemoryMap) marshalValue(value interface{}) ([]byte, error) {
+	if m.typ.hasPerCPUValue() {
+		return marshalPerCPUValue(value, int(m.valueSize))
+	}
+
+	buf, err := marshalBytes(value, int(m.valueSize))
+	if err != nil {
+		return nil, err
+	}
+
+	// Don't alias the caller's buffer.
+	cpy := make([]byte, len(buf))
+	copy(cpy, buf)
+	return cpy, nil
+}
+
+func (m *MemoryMap) unmarshalValue(valueOut interface{}, buf []byte) error {
+	if m.typ.hasPerCPUValue() {
+		return unmarshalPerCPUValue(valueOut, int(m.valueSize), buf)
+	}
+
+	return unmarshalBytes(valueOut, buf)
+}
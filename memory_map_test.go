@@ -0,0 +1,184 @@
+package ebpf
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cilium/ebpf/internal"
+)
+
+func TestMemoryMap(t *testing.T) {
+	for _, typ := range []MapType{Hash, LRUHash, Array} {
+		spec := &MapSpec{
+			Type:       typ,
+			KeySize:    4,
+			ValueSize:  4,
+			MaxEntries: 2,
+		}
+
+		t.Run(typ.String(), func(t *testing.T) {
+			mem, err := NewMemoryMap(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			testKeyValueMap(t, mem, typ)
+		})
+
+		t.Run(typ.String()+"/kernel", func(t *testing.T) {
+			m, err := NewMap(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer m.Close()
+			testKeyValueMap(t, m, typ)
+		})
+	}
+}
+
+// testKeyValueMap checks that m has the semantics of a map of type typ with
+// four byte keys and values and two entries.
+func testKeyValueMap(t *testing.T, m KeyValueMap, typ MapType) {
+	t.Helper()
+
+	if err := m.Update(uint32(0), uint32(42), UpdateAny); err != nil {
+		t.Fatal("Can't update:", err)
+	}
+
+	var value uint32
+	if err := m.Lookup(uint32(0), &value); err != nil {
+		t.Fatal("Can't lookup:", err)
+	}
+	if value != 42 {
+		t.Error("Expected value 42, got", value)
+	}
+
+	if err := m.Update(uint32(0), uint32(1), UpdateNoExist); !errors.Is(err, ErrKeyExist) {
+		t.Error("Expected ErrKeyExist, got", err)
+	}
+
+	if err := m.Put(uint32(1), uint32(23)); err != nil {
+		t.Fatal("Can't put:", err)
+	}
+
+	var key uint32
+	if err := m.NextKey(nil, &key); err != nil {
+		t.Fatal("Can't get first key:", err)
+	}
+	var next uint32
+	if err := m.NextKey(key, &next); err != nil {
+		t.Fatal("Can't get next key:", err)
+	}
+	if key+next != 1 {
+		t.Errorf("Expected keys 0 and 1, got %d and %d", key, next)
+	}
+	if err := m.NextKey(next, &next); !errors.Is(err, ErrKeyNotExist) {
+		t.Error("Expected ErrKeyNotExist after last key, got", err)
+	}
+
+	if typ == Array {
+		if err := m.Delete(uint32(0)); err == nil {
+			t.Error("Deleted from array")
+		}
+		if err := m.Put(uint32(2), uint32(0)); err == nil {
+			t.Error("Put index out of bounds")
+		}
+		return
+	}
+
+	switch err := m.Put(uint32(2), uint32(5)); {
+	case typ == LRUHash && err != nil:
+		t.Error("LRU map doesn't evict:", err)
+	case typ == Hash && err == nil:
+		t.Error("Put into full map")
+	}
+
+	if _, ok := m.(*MemoryMap); ok && typ == LRUHash {
+		// Key 0 was used least recently. The kernel only approximates LRU,
+		// so this is only checked for memory maps.
+		if err := m.Lookup(uint32(0), &value); !errors.Is(err, ErrKeyNotExist) {
+			t.Error("Expected key 0 to be evicted, got", err)
+		}
+		return
+	}
+
+	if err := m.Delete(uint32(1)); err != nil {
+		t.Fatal("Can't delete:", err)
+	}
+	if err := m.Delete(uint32(1)); !errors.Is(err, ErrKeyNotExist) {
+		t.Error("Expected ErrKeyNotExist, got", err)
+	}
+	if err := m.Lookup(uint32(1), &value); !errors.Is(err, ErrKeyNotExist) {
+		t.Error("Expected ErrKeyNotExist, got", err)
+	}
+}
+
+func TestMemoryMapPerCPU(t *testing.T) {
+	possibleCPUs, err := internal.PossibleCPUs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewMemoryMap(&MapSpec{
+		Type:       PerCPUHash,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 1,
+		Contents: []MapKV{
+			{uint32(1), []uint32{1}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var values []uint32
+	if err := m.Lookup(uint32(1), &values); err != nil {
+		t.Fatal("Can't lookup:", err)
+	}
+
+	if len(values) != possibleCPUs {
+		t.Fatalf("Expected %d values, got %d", possibleCPUs, len(values))
+	}
+	if values[0] != 1 {
+		t.Error("Unexpected values:", values)
+	}
+}
+
+func TestNewMemoryMapUnsupported(t *testing.T) {
+	_, err := NewMemoryMap(&MapSpec{Type: ProgramArray, KeySize: 4, ValueSize: 4, MaxEntries: 1})
+	if !errors.Is(err, ErrNotSupported) {
+		t.Error("Expected ErrNotSupported, got", err)
+	}
+}
+
+func TestMemoryMapLookupAndDelete(t *testing.T) {
+	m, err := NewMemoryMap(&MapSpec{
+		Type:       Hash,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Put(uint32(1), uint32(42)); err != nil {
+		t.Fatal(err)
+	}
+
+	var value uint32
+	if err := m.LookupAndDelete(uint32(1), &value); err != nil {
+		t.Fatal("Can't lookup and delete:", err)
+	}
+	if value != 42 {
+		t.Error("Expected value 42, got", value)
+	}
+
+	if err := m.Lookup(uint32(1), &value); !errors.Is(err, ErrKeyNotExist) {
+		t.Error("Key isn't deleted:", err)
+	}
+
+	if err := m.LookupAndDelete(uint32(1), &value); !errors.Is(err, ErrKeyNotExist) {
+		t.Error("Expected ErrKeyNotExist, got", err)
+	}
+}
@@ -0,0 +1,7 @@
+// Package metrics exports the contents of BPF maps as Prometheus metrics.
+//
+// BPF programs commonly count events in hash or array maps, often with
+// one value per CPU to avoid contention. A Collector reads such maps on
+// every scrape and renders them in the Prometheus text exposition format,
+// turning keys into labels and summing per-CPU values.
+package metrics
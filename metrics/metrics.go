@@ -0,0 +1,387 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal"
+)
+
+var (
+	metricNameRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRe  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// Type is the type of a metric.
+type Type int
+
+const (
+	// Counter is a monotonically increasing value.
+	Counter Type = iota
+	// Gauge is a value which can go up and down.
+	Gauge
+	// Histogram is a distribution of values, where each key of the map
+	// identifies a bucket and each value is the number of samples in it.
+	Histogram
+)
+
+func (t Type) String() string {
+	switch t {
+	case Counter:
+		return "counter"
+	case Gauge:
+		return "gauge"
+	case Histogram:
+		return "histogram"
+	default:
+		return fmt.Sprintf("Type(%d)", int(t))
+	}
+}
+
+// Label is a name and value attached to a sample.
+type Label struct {
+	Name, Value string
+}
+
+// Metric describes how to export a map.
+type Metric struct {
+	// Name of the metric, for example "xdp_packets_total".
+	Name string
+	// Help is an optional description of the metric.
+	Help string
+	Type Type
+	Map  *ebpf.Map
+
+	// Labels returns the labels of the sample stored at key.
+	//
+	// Defaults to a single label "key" containing the key as a decimal
+	// integer if it is 1, 2, 4 or 8 bytes long and as a hex string
+	// otherwise. Histograms have no labels by default.
+	Labels func(key []byte) ([]Label, error)
+
+	// Value returns the value of a sample. For per-CPU maps it is
+	// called once per CPU and the results are summed.
+	//
+	// Defaults to decoding an unsigned integer of 1, 2, 4 or 8 bytes.
+	Value func(value []byte) (float64, error)
+
+	// Bucket returns the upper bound of the histogram bucket stored at key.
+	// Keys which return the same labels are aggregated into a single
+	// histogram.
+	//
+	// Defaults to 2^n where n is the key decoded as an unsigned integer,
+	// which matches the log2 histograms commonly used in BPF programs.
+	Bucket func(key []byte) (float64, error)
+}
+
+// Collector renders maps as Prometheus metrics.
+//
+// Maps are read each time metrics are written, which makes it suitable
+// to serve scrapes directly.
+type Collector struct {
+	metrics []Metric
+}
+
+// NewCollector validates metrics and creates a collector for them.
+//
+// The collector doesn't take ownership of the maps, they must stay open
+// for as long as it is used.
+func NewCollector(metrics ...Metric) (*Collector, error) {
+	names := make(map[string]bool)
+	for _, m := range metrics {
+		if !metricNameRe.MatchString(m.Name) {
+			return nil, fmt.Errorf("invalid metric name %q", m.Name)
+		}
+		if names[m.Name] {
+			return nil, fmt.Errorf("duplicate metric %s", m.Name)
+		}
+		names[m.Name] = true
+
+		if m.Map == nil {
+			return nil, fmt.Errorf("metric %s: missing map", m.Name)
+		}
+		if m.Type < Counter || m.Type > Histogram {
+			return nil, fmt.Errorf("metric %s: invalid type %s", m.Name, m.Type)
+		}
+	}
+
+	return &Collector{append([]Metric(nil), metrics...)}, nil
+}
+
+// WriteTo reads all maps and writes them to w in the Prometheus text
+// exposition format.
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	for _, m := range c.metrics {
+		if err := m.write(&buf); err != nil {
+			return 0, fmt.Errorf("metric %s: %w", m.Name, err)
+		}
+	}
+	return buf.WriteTo(w)
+}
+
+// ServeHTTP implements http.Handler.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	if _, err := c.WriteTo(&buf); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = buf.WriteTo(w)
+}
+
+type sample struct {
+	key    []byte
+	labels []Label
+	value  float64
+}
+
+func (m *Metric) write(w *bytes.Buffer) error {
+	samples, err := m.read()
+	if err != nil {
+		return err
+	}
+
+	if m.Help != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.Name, escapeHelp(m.Help))
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", m.Name, m.Type)
+
+	if m.Type == Histogram {
+		return m.writeHistograms(w, samples)
+	}
+
+	for _, s := range samples {
+		writeSample(w, m.Name, s.labels, s.value)
+	}
+	return nil
+}
+
+// read returns all samples in the map, ordered by their labels.
+func (m *Metric) read() ([]sample, error) {
+	labels := m.Labels
+	if labels == nil {
+		labels = keyLabels
+		if m.Type == Histogram {
+			labels = func([]byte) ([]Label, error) { return nil, nil }
+		}
+	}
+
+	valueFn := m.Value
+	if valueFn == nil {
+		valueFn = uintValue
+	}
+
+	var (
+		samples []sample
+		key     []byte
+		iter    = m.Map.Iterate()
+	)
+	for {
+		var values [][]byte
+		if perCPU(m.Map.Type()) {
+			if !iter.Next(&key, &values) {
+				break
+			}
+		} else {
+			var value []byte
+			if !iter.Next(&key, &value) {
+				break
+			}
+			values = [][]byte{value}
+		}
+
+		s := sample{key: append([]byte(nil), key...)}
+		for _, value := range values {
+			v, err := valueFn(value)
+			if err != nil {
+				return nil, fmt.Errorf("key %x: %w", key, err)
+			}
+			s.value += v
+		}
+
+		var err error
+		s.labels, err = labels(s.key)
+		if err != nil {
+			return nil, fmt.Errorf("key %x: %w", key, err)
+		}
+		for _, l := range s.labels {
+			if !labelNameRe.MatchString(l.Name) || strings.HasPrefix(l.Name, "__") {
+				return nil, fmt.Errorf("key %x: invalid label name %q", key, l.Name)
+			}
+			if m.Type == Histogram && l.Name == "le" {
+				return nil, fmt.Errorf("key %x: histograms can't have a label le", key)
+			}
+		}
+
+		samples = append(samples, s)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(samples, func(i, j int) bool {
+		return formatLabels(samples[i].labels) < formatLabels(samples[j].labels)
+	})
+	return samples, nil
+}
+
+func (m *Metric) writeHistograms(w *bytes.Buffer, samples []sample) error {
+	bucketFn := m.Bucket
+	if bucketFn == nil {
+		bucketFn = log2Bucket
+	}
+
+	type bucket struct {
+		le    float64
+		count float64
+	}
+
+	// samples are sorted by labels, so each histogram is a run of
+	// consecutive samples.
+	for len(samples) > 0 {
+		labels := formatLabels(samples[0].labels)
+		n := 1
+		for n < len(samples) && formatLabels(samples[n].labels) == labels {
+			n++
+		}
+
+		buckets := make([]bucket, 0, n)
+		for _, s := range samples[:n] {
+			le, err := bucketFn(s.key)
+			if err != nil {
+				return fmt.Errorf("key %x: %w", s.key, err)
+			}
+			buckets = append(buckets, bucket{le, s.value})
+		}
+		sort.Slice(buckets, func(i, j int) bool { return buckets[i].le < buckets[j].le })
+
+		var count float64
+		for i, b := range buckets {
+			count += b.count
+			if i+1 < len(buckets) && buckets[i+1].le == b.le {
+				continue
+			}
+			writeSample(w, m.Name+"_bucket", withLabel(samples[0].labels, "le", formatValue(b.le)), count)
+		}
+		if len(buckets) == 0 || !math.IsInf(buckets[len(buckets)-1].le, 1) {
+			writeSample(w, m.Name+"_bucket", withLabel(samples[0].labels, "le", "+Inf"), count)
+		}
+		writeSample(w, m.Name+"_count", samples[0].labels, count)
+
+		samples = samples[n:]
+	}
+
+	return nil
+}
+
+func writeSample(w *bytes.Buffer, name string, labels []Label, value float64) {
+	w.WriteString(name)
+	w.WriteString(formatLabels(labels))
+	w.WriteByte(' ')
+	w.WriteString(formatValue(value))
+	w.WriteByte('\n')
+}
+
+// withLabel returns a copy of labels with an additional label.
+func withLabel(labels []Label, name, value string) []Label {
+	out := make([]Label, 0, len(labels)+1)
+	out = append(out, labels...)
+	return append(out, Label{name, value})
+}
+
+func formatLabels(labels []Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l.Name)
+		b.WriteString(`="`)
+		b.WriteString(labelValueEscaper.Replace(l.Value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var (
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+func perCPU(typ ebpf.MapType) bool {
+	return typ == ebpf.PerCPUHash || typ == ebpf.PerCPUArray || typ == ebpf.LRUCPUHash
+}
+
+func decodeUint(buf []byte) (uint64, error) {
+	switch len(buf) {
+	case 1:
+		return uint64(buf[0]), nil
+	case 2:
+		return uint64(internal.NativeEndian.Uint16(buf)), nil
+	case 4:
+		return uint64(internal.NativeEndian.Uint32(buf)), nil
+	case 8:
+		return internal.NativeEndian.Uint64(buf), nil
+	default:
+		return 0, fmt.Errorf("can't decode %d bytes as an integer", len(buf))
+	}
+}
+
+func keyLabels(key []byte) ([]Label, error) {
+	if n, err := decodeUint(key); err == nil {
+		return []Label{{"key", strconv.FormatUint(n, 10)}}, nil
+	}
+	return []Label{{"key", hex.EncodeToString(key)}}, nil
+}
+
+func uintValue(value []byte) (float64, error) {
+	n, err := decodeUint(value)
+	return float64(n), err
+}
+
+func log2Bucket(key []byte) (float64, error) {
+	n, err := decodeUint(key)
+	if err != nil {
+		return 0, err
+	}
+	if n > 1023 {
+		return 0, errors.New("bucket exceeds float64 range")
+	}
+	return math.Ldexp(1, int(n)), nil
+}
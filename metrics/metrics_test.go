@@ -0,0 +1,171 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal"
+)
+
+func mustNewMap(t *testing.T, typ ebpf.MapType, valueSize uint32) *ebpf.Map {
+	t.Helper()
+
+	m, err := ebpf.NewMap(&ebpf.MapSpec{
+		Type:       typ,
+		KeySize:    4,
+		ValueSize:  valueSize,
+		MaxEntries: 4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func mustWrite(t *testing.T, metrics ...Metric) string {
+	t.Helper()
+
+	c, err := NewCollector(metrics...)
+	if err != nil {
+		t.Fatal("Can't create collector:", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := c.WriteTo(&buf); err != nil {
+		t.Fatal("Can't write metrics:", err)
+	}
+	return buf.String()
+}
+
+func TestCollectorCounter(t *testing.T) {
+	m := mustNewMap(t, ebpf.Hash, 8)
+	if err := m.Put(uint32(2), uint64(20)); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Put(uint32(1), uint64(10)); err != nil {
+		t.Fatal(err)
+	}
+
+	have := mustWrite(t, Metric{
+		Name: "packets_total",
+		Help: "Number of packets.\nPer interface.",
+		Type: Counter,
+		Map:  m,
+		Labels: func(key []byte) ([]Label, error) {
+			return []Label{{"ifindex", fmt.Sprint(internal.NativeEndian.Uint32(key))}}, nil
+		},
+	})
+
+	want := `# HELP packets_total Number of packets.\nPer interface.
+# TYPE packets_total counter
+packets_total{ifindex="1"} 10
+packets_total{ifindex="2"} 20
+`
+	if have != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, have)
+	}
+}
+
+func TestCollectorPerCPU(t *testing.T) {
+	m := mustNewMap(t, ebpf.PerCPUArray, 4)
+
+	cpus, err := internal.PossibleCPUs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := make([]uint32, cpus)
+	for i := range values {
+		values[i] = 1
+	}
+	if err := m.Put(uint32(0), values); err != nil {
+		t.Fatal(err)
+	}
+
+	have := mustWrite(t, Metric{Name: "events", Type: Gauge, Map: m})
+	if !strings.Contains(have, fmt.Sprintf("events{key=\"0\"} %d\n", cpus)) {
+		t.Error("Per-CPU values aren't summed:\n", have)
+	}
+	if !strings.Contains(have, "events{key=\"3\"} 0\n") {
+		t.Error("Missing sample for zero value:\n", have)
+	}
+}
+
+func TestCollectorHistogram(t *testing.T) {
+	m := mustNewMap(t, ebpf.Array, 8)
+	for i, count := range []uint64{1, 0, 3, 2} {
+		if err := m.Put(uint32(i), count); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	have := mustWrite(t, Metric{Name: "latency", Type: Histogram, Map: m})
+	want := `# TYPE latency histogram
+latency_bucket{le="1"} 1
+latency_bucket{le="2"} 1
+latency_bucket{le="4"} 4
+latency_bucket{le="8"} 6
+latency_bucket{le="+Inf"} 6
+latency_count 6
+`
+	if have != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, have)
+	}
+
+	c, err := NewCollector(Metric{Name: "latency", Type: Histogram, Map: m,
+		Labels: func([]byte) ([]Label, error) { return []Label{{"le", ""}}, nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.WriteTo(&bytes.Buffer{}); err == nil {
+		t.Error("Histogram with label le doesn't return an error")
+	}
+}
+
+func TestCollectorServeHTTP(t *testing.T) {
+	m := mustNewMap(t, ebpf.Hash, 8)
+	c, err := NewCollector(Metric{Name: "drops_total", Map: m})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != 200 {
+		t.Fatal("Unexpected status", rec.Code)
+	}
+	if body := rec.Body.String(); body != "# TYPE drops_total counter\n" {
+		t.Errorf("Unexpected body %q", body)
+	}
+
+	if err := m.Put(uint32(1), uint64(5)); err != nil {
+		t.Fatal(err)
+	}
+
+	rec = httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(rec.Body.String(), `drops_total{key="1"} 5`) {
+		t.Error("Map isn't read on every scrape:", rec.Body.String())
+	}
+}
+
+func TestNewCollectorInvalid(t *testing.T) {
+	m := mustNewMap(t, ebpf.Hash, 8)
+
+	for _, metrics := range [][]Metric{
+		{{Name: "1foo", Map: m}},
+		{{Name: "foo"}},
+		{{Name: "foo", Map: m, Type: Type(42)}},
+		{{Name: "foo", Map: m}, {Name: "foo", Map: m}},
+	} {
+		if _, err := NewCollector(metrics...); err == nil {
+			t.Errorf("NewCollector(%v) doesn't return an error", metrics)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package ebpf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var sysClassNet = "/sys/class/net"
+
+// InterfaceNumaNode returns the NUMA node of the device backing a network
+// interface.
+//
+// Use it with MapSpec.NumaNode and MapNumaNode to allocate maps used by
+// XDP programs close to the NIC handling the traffic.
+//
+// Returns an error wrapping os.ErrNotExist if the interface isn't backed
+// by a device with NUMA affinity, for example virtual interfaces or
+// machines with a single node.
+func InterfaceNumaNode(ifname string) (uint32, error) {
+	if ifname == "" || strings.ContainsRune(ifname, '/') {
+		return 0, fmt.Errorf("invalid interface name %q", ifname)
+	}
+
+	path := filepath.Join(sysClassNet, ifname, "device", "numa_node")
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("interface %s: %w", ifname, err)
+	}
+
+	node, err := strconv.Atoi(strings.TrimSpace(string(buf)))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+
+	// The kernel reports NUMA_NO_NODE if there is no affinity.
+	if node < 0 {
+		return 0, fmt.Errorf("interface %s: no NUMA affinity: %w", ifname, os.ErrNotExist)
+	}
+
+	return uint32(node), nil
+}
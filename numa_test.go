@@ -0,0 +1,78 @@
+package ebpf
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInterfaceNumaNode(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "ebpf-numa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for ifname, node := range map[string]string{
+		"eth0": "1\n",
+		"eth1": "-1\n",
+	} {
+		dir := filepath.Join(tmp, ifname, "device")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "numa_node"), []byte(node), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func(old string) { sysClassNet = old }(sysClassNet)
+	sysClassNet = tmp
+
+	node, err := InterfaceNumaNode("eth0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node != 1 {
+		t.Error("Expected node 1, got", node)
+	}
+
+	for _, ifname := range []string{"eth1", "lo"} {
+		if _, err := InterfaceNumaNode(ifname); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s: expected os.ErrNotExist, got %v", ifname, err)
+		}
+	}
+
+	if _, err := InterfaceNumaNode("../eth0"); err == nil {
+		t.Error("Accepted interface name containing a slash")
+	}
+}
+
+func TestMapNumaNode(t *testing.T) {
+	m, err := NewMap(&MapSpec{
+		Type:       Hash,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 1,
+		Flags:      MapNumaNode,
+		NumaNode:   0,
+	})
+	if err != nil {
+		t.Fatal("Can't create map on NUMA node 0:", err)
+	}
+	m.Close()
+
+	_, err = NewMap(&MapSpec{
+		Type:       Hash,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 1,
+		Flags:      MapNumaNode,
+		NumaNode:   1 << 20,
+	})
+	if err == nil {
+		t.Error("Creating a map on a missing NUMA node doesn't return an error")
+	}
+}
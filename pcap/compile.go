@@ -0,0 +1,302 @@
+// Package pcap compiles libpcap filter expressions, as used by tcpdump, to
+// eBPF.
+//
+// Unlike attaching the output of "tcpdump -dd" via the cbpf package, this
+// doesn't depend on libpcap and works for XDP programs. Only a subset of
+// pcap-filter(7) is supported:
+//
+//	ip, ip6, arp, tcp, udp, icmp, icmp6
+//	[ether|ip|ip6] proto PROTOCOL
+//	[ether|ip|ip6] [src|dst] host ADDRESS
+//	[ip|ip6] [src|dst] net ADDRESS/PREFIX
+//	[tcp|udp] [src|dst] port PORT
+//	[tcp|udp] [src|dst] portrange FIRST-LAST
+//
+// Primitives are combined with and, or, not and parentheses. Addresses,
+// ports and protocols must be given numerically, names aren't resolved.
+// Packets are expected to start with an Ethernet header.
+package pcap
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+)
+
+// Compile translates a filter expression into a program of the given type,
+// which returns match for packets accepted by the filter and noMatch
+// otherwise.
+//
+// SocketFilter, SchedCLS and SchedACT programs read packets using LoadAbs
+// and LoadInd, XDP programs use direct packet access. Packets which are
+// too short for a field used by the filter don't match.
+//
+// The return values depend on the program type, for example
+//
+//	// Accept whole packets on a socket.
+//	pcap.Compile("tcp port 443", ebpf.SocketFilter, -1, 0)
+//	// Drop everything else on an XDP hook.
+//	pcap.Compile("tcp port 443", ebpf.XDP, 2 /* XDP_PASS */, 1 /* XDP_DROP */)
+func Compile(expr string, typ ebpf.ProgramType, match, noMatch int32) (asm.Instructions, error) {
+	switch typ {
+	case ebpf.SocketFilter, ebpf.SchedCLS, ebpf.SchedACT, ebpf.XDP:
+	default:
+		return nil, fmt.Errorf("program type %s: %w", typ, ebpf.ErrNotSupported)
+	}
+
+	root, err := parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("parse %q: %w", expr, err)
+	}
+
+	c := compiler{xdp: typ == ebpf.XDP}
+	c.noMatch = c.newLabel()
+
+	c.emit(asm.Mov.Reg(regCtx, asm.R1))
+	if c.xdp {
+		c.emit(
+			asm.LoadMem(regData, regCtx, xdpData, asm.Word),
+			asm.LoadMem(regDataEnd, regCtx, xdpDataEnd, asm.Word),
+		)
+	}
+
+	root.compile(&c, c.noMatch)
+	c.emit(
+		asm.Mov.Imm32(asm.R0, match),
+		asm.Return(),
+	)
+
+	c.bind(c.noMatch)
+	c.emit(
+		asm.Mov.Imm32(asm.R0, noMatch),
+		asm.Return(),
+	)
+
+	// All emitted instructions are a single raw instruction long, so
+	// indices and raw offsets are the same.
+	for _, f := range c.fixups {
+		offset := c.labels[f.label] - f.index - 1
+		if offset > math.MaxInt16 {
+			return nil, fmt.Errorf("filter %q is too large", expr)
+		}
+		c.insns[f.index].Offset = int16(offset)
+	}
+
+	return c.insns, nil
+}
+
+// Registers used by compiled filters. R1 to R5 are clobbered by LoadAbs
+// and LoadInd.
+const (
+	regCtx = asm.R6
+	// regData and regDataEnd hold the bounds of the packet in XDP
+	// programs.
+	regData    = asm.R7
+	regDataEnd = asm.R8
+	// regTransport holds the offset of the IPv4 payload for SocketFilter
+	// programs, or a pointer to it for XDP.
+	regTransport = asm.R9
+)
+
+// Offsets of fields in struct __sk_buff and struct xdp_md.
+const (
+	skbLen     = 0
+	xdpData    = 0
+	xdpDataEnd = 4
+)
+
+// node is an element of a parsed filter expression.
+type node interface {
+	// compile emits instructions which fall through if a packet matches
+	// and jump to miss otherwise.
+	compile(c *compiler, miss label)
+}
+
+type and struct{ left, right node }
+
+func (n and) compile(c *compiler, miss label) {
+	n.left.compile(c, miss)
+	n.right.compile(c, miss)
+}
+
+type or struct{ left, right node }
+
+func (n or) compile(c *compiler, miss label) {
+	right, done := c.newLabel(), c.newLabel()
+	n.left.compile(c, right)
+	c.jump(asm.Ja.Label(""), done)
+	c.bind(right)
+	n.right.compile(c, miss)
+	c.bind(done)
+}
+
+type not struct{ node }
+
+func (n not) compile(c *compiler, miss label) {
+	match := c.newLabel()
+	n.node.compile(c, match)
+	c.jump(asm.Ja.Label(""), miss)
+	c.bind(match)
+}
+
+// test matches packets where `(*(size *)(packet + offset) & mask) op value`
+// is true. The field is converted from network byte order.
+type test struct {
+	// transport makes offset relative to the payload of an IPv4 packet.
+	transport bool
+	offset    int32
+	size      asm.Size
+	// mask is ignored if it's zero.
+	mask  uint32
+	op    asm.JumpOp
+	value uint32
+}
+
+// inverseJumps are the conditions under which a test doesn't match.
+var inverseJumps = map[asm.JumpOp]asm.JumpOp{
+	asm.JEq: asm.JNE,
+	asm.JGE: asm.JLT,
+	asm.JLE: asm.JGT,
+}
+
+func (t test) compile(c *compiler, miss label) {
+	if t.transport {
+		c.loadTransport(t.offset, t.size)
+	} else {
+		c.load(t.offset, t.size)
+	}
+
+	if t.mask != 0 {
+		c.emit(asm.And.Imm32(asm.R0, int32(t.mask)))
+	}
+
+	// Immediates are sign extended to 64 bits, while fields are
+	// unsigned. Move large values into a register.
+	cond := func(op asm.JumpOp) asm.Instruction {
+		if int32(t.value) < 0 {
+			return op.Reg(asm.R0, asm.R1, "")
+		}
+		return op.Imm(asm.R0, int32(t.value), "")
+	}
+	if int32(t.value) < 0 {
+		c.emit(asm.Mov.Imm32(asm.R1, int32(t.value)))
+	}
+
+	if inverse, ok := inverseJumps[t.op]; ok {
+		c.jump(cond(inverse), miss)
+		return
+	}
+
+	match := c.newLabel()
+	c.jump(cond(t.op), match)
+	c.jump(asm.Ja.Label(""), miss)
+	c.bind(match)
+}
+
+// label is a position in the program which jumps may refer to before it
+// is known.
+type label int
+
+type compiler struct {
+	xdp bool
+	// noMatch ends the program with the noMatch return value.
+	noMatch label
+	insns   asm.Instructions
+	// labels holds the index of the instruction a label refers to.
+	labels []int
+	fixups []fixup
+}
+
+// fixup is a jump whose offset is only known once all instructions are
+// emitted.
+type fixup struct {
+	index int
+	label label
+}
+
+func (c *compiler) emit(insns ...asm.Instruction) {
+	c.insns = append(c.insns, insns...)
+}
+
+func (c *compiler) newLabel() label {
+	c.labels = append(c.labels, -1)
+	return label(len(c.labels) - 1)
+}
+
+// bind makes l refer to the next emitted instruction.
+func (c *compiler) bind(l label) {
+	c.labels[l] = len(c.insns)
+}
+
+// jump emits ins and arranges for it to jump to l.
+func (c *compiler) jump(ins asm.Instruction, l label) {
+	ins.Reference = ""
+	c.fixups = append(c.fixups, fixup{len(c.insns), l})
+	c.emit(ins)
+}
+
+// load emits `R0 = *(size *)(packet + offset)`, converted to host byte
+// order. Packets which are too short end the program with noMatch.
+func (c *compiler) load(offset int32, size asm.Size) {
+	end := offset + int32(size.Sizeof())
+
+	if c.xdp {
+		c.emit(
+			asm.Mov.Reg(asm.R1, regData),
+			asm.Add.Imm(asm.R1, end),
+		)
+		c.jump(asm.JGT.Reg(asm.R1, regDataEnd, ""), c.noMatch)
+		c.emit(asm.LoadMem(asm.R0, regData, int16(offset), size))
+		if size != asm.Byte {
+			c.emit(asm.HostTo(asm.BE, asm.R0, size))
+		}
+		return
+	}
+
+	// LoadAbs ends the program with a return value of zero if the
+	// packet is too short, which might not be noMatch.
+	c.emit(asm.LoadMem(asm.R1, regCtx, skbLen, asm.Word))
+	c.jump(asm.JLT.Imm(asm.R1, end, ""), c.noMatch)
+	c.emit(asm.LoadAbs(offset, size))
+}
+
+// loadTransport is like load, except that offset is relative to the
+// payload of an IPv4 packet.
+func (c *compiler) loadTransport(offset int32, size asm.Size) {
+	// The header length is in the lower four bits of the first byte,
+	// in units of four bytes.
+	c.load(ethHeaderLen, asm.Byte)
+	c.emit(
+		asm.And.Imm32(asm.R0, 0xf),
+		asm.LSh.Imm32(asm.R0, 2),
+	)
+
+	offset += ethHeaderLen
+	end := offset + int32(size.Sizeof())
+
+	if c.xdp {
+		c.emit(
+			asm.Mov.Reg(regTransport, regData),
+			asm.Add.Reg(regTransport, asm.R0),
+			asm.Mov.Reg(asm.R1, regTransport),
+			asm.Add.Imm(asm.R1, end),
+		)
+		c.jump(asm.JGT.Reg(asm.R1, regDataEnd, ""), c.noMatch)
+		c.emit(asm.LoadMem(asm.R0, regTransport, int16(offset), size))
+		if size != asm.Byte {
+			c.emit(asm.HostTo(asm.BE, asm.R0, size))
+		}
+		return
+	}
+
+	c.emit(
+		asm.Mov.Reg(regTransport, asm.R0),
+		asm.LoadMem(asm.R1, regCtx, skbLen, asm.Word),
+		asm.Mov.Reg(asm.R2, regTransport),
+		asm.Add.Imm(asm.R2, end),
+	)
+	c.jump(asm.JGT.Reg(asm.R2, asm.R1, ""), c.noMatch)
+	c.emit(asm.LoadInd(asm.R0, regTransport, offset, size))
+}
@@ -0,0 +1,217 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal/testutils"
+)
+
+const (
+	retMatch   = 2
+	retNoMatch = 1
+)
+
+func ethernet(etherType uint16, payload []byte) []byte {
+	frame := make([]byte, ethHeaderLen, ethHeaderLen+len(payload))
+	copy(frame[ethDst:], []byte{0x02, 0, 0, 0, 0, 2})
+	copy(frame[ethSrc:], []byte{0x02, 0, 0, 0, 0, 1})
+	binary.BigEndian.PutUint16(frame[ethType:], etherType)
+	return append(frame, payload...)
+}
+
+// ports returns the start of a TCP or UDP header.
+func ports(src, dst uint16) []byte {
+	hdr := make([]byte, 20)
+	binary.BigEndian.PutUint16(hdr[0:], src)
+	binary.BigEndian.PutUint16(hdr[2:], dst)
+	return hdr
+}
+
+func ipv4(proto uint8, src, dst string, options int, payload []byte) []byte {
+	hdr := make([]byte, 20+options, 20+options+len(payload))
+	hdr[0] = 0x40 | uint8(len(hdr)/4)
+	binary.BigEndian.PutUint16(hdr[2:], uint16(len(hdr)+len(payload)))
+	hdr[8] = 64
+	hdr[9] = proto
+	copy(hdr[12:], net.ParseIP(src).To4())
+	copy(hdr[16:], net.ParseIP(dst).To4())
+	return ethernet(etherTypeIPv4, append(hdr, payload...))
+}
+
+func ipv6(nextHeader uint8, src, dst string, payload []byte) []byte {
+	hdr := make([]byte, 40, 40+len(payload))
+	hdr[0] = 0x60
+	binary.BigEndian.PutUint16(hdr[4:], uint16(len(payload)))
+	hdr[6] = nextHeader
+	hdr[7] = 64
+	copy(hdr[8:], net.ParseIP(src))
+	copy(hdr[24:], net.ParseIP(dst))
+	return ethernet(etherTypeIPv6, append(hdr, payload...))
+}
+
+func mustRun(t *testing.T, expr string, typ ebpf.ProgramType, pkt []byte) uint32 {
+	t.Helper()
+
+	insns, err := Compile(expr, typ, retMatch, retNoMatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Type:         typ,
+		Instructions: insns,
+		License:      "MIT",
+	})
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatalf("Can't load %s: %v\n%s", expr, err, insns)
+	}
+	defer prog.Close()
+
+	ret, _, err := prog.Test(pkt)
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+func TestCompile(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "4.14", "JLT and JLE")
+
+	var (
+		tcp80      = ipv4(6, "10.0.0.1", "10.0.0.2", 0, ports(12345, 80))
+		tcp80Opts  = ipv4(6, "10.0.0.1", "10.0.0.2", 8, ports(12345, 80))
+		tcp443     = ipv4(6, "10.0.0.1", "10.0.0.2", 0, ports(443, 12345))
+		udp53      = ipv4(17, "10.0.1.1", "10.0.0.2", 0, ports(12345, 53))
+		icmp       = ipv4(1, "10.0.0.1", "10.0.0.2", 0, make([]byte, 8))
+		tcp6       = ipv6(6, "fd00::1", "fd00::2", ports(12345, 80))
+		udp6       = ipv6(17, "fd00:1::1", "fd00::2", ports(12345, 53))
+		arp        = ethernet(etherTypeARP, make([]byte, 28))
+		truncated  = tcp80[:ethHeaderLen+20+2]
+		fragmented = append([]byte(nil), tcp80...)
+	)
+	binary.BigEndian.PutUint16(fragmented[ipv4Frag:], 0x10)
+
+	for _, test := range []struct {
+		expr    string
+		match   [][]byte
+		noMatch [][]byte
+	}{
+		{"ip", [][]byte{tcp80, icmp}, [][]byte{tcp6, arp}},
+		{"ip6", [][]byte{tcp6}, [][]byte{tcp80, arp}},
+		{"arp", [][]byte{arp}, [][]byte{tcp80}},
+		{"tcp", [][]byte{tcp80, tcp6}, [][]byte{udp53, udp6, arp}},
+		{"!tcp", [][]byte{udp53, udp6, arp}, [][]byte{tcp80, tcp6}},
+		{"icmp", [][]byte{icmp}, [][]byte{tcp80, tcp6}},
+		{"ip proto 17", [][]byte{udp53}, [][]byte{udp6, tcp80}},
+		{"proto udp", [][]byte{udp53, udp6}, [][]byte{tcp80}},
+		{"ether proto 0x806", [][]byte{arp}, [][]byte{tcp80}},
+		{"ether src 02:00:00:00:00:01", [][]byte{tcp80}, nil},
+		{"ether dst 02:00:00:00:00:01", nil, [][]byte{tcp80}},
+		{"host 10.0.0.2", [][]byte{tcp80, udp53}, [][]byte{tcp6, arp}},
+		{"src host 10.0.0.2", nil, [][]byte{tcp80}},
+		{"src or dst 10.0.0.1", [][]byte{tcp80}, [][]byte{udp53}},
+		{"src and dst host 10.0.0.1", nil, [][]byte{tcp80}},
+		{"host fd00::2", [][]byte{tcp6, udp6}, [][]byte{tcp80}},
+		{"ip6 src net fd00::/32", [][]byte{tcp6}, [][]byte{udp6, tcp80}},
+		{"src net 10.0.0.0/24", [][]byte{tcp80}, [][]byte{udp53}},
+		{"net 0.0.0.0/0", [][]byte{tcp80}, [][]byte{tcp6}},
+		{"port 80", [][]byte{tcp80, tcp80Opts, tcp6}, [][]byte{tcp443, udp53, icmp, fragmented, truncated}},
+		{"not port 80", [][]byte{tcp443, udp53}, [][]byte{tcp80, truncated}},
+		{"udp port 53 or 80", [][]byte{udp53, udp6}, [][]byte{tcp80}},
+		{"tcp src port 443", [][]byte{tcp443}, [][]byte{tcp80}},
+		{"dst portrange 50-100", [][]byte{tcp80, udp53, udp6}, [][]byte{tcp443}},
+		{"tcp port 80 and host 10.0.0.1", [][]byte{tcp80}, [][]byte{tcp6, tcp443}},
+		{"(tcp or udp) && !(ip6 || port 53)", [][]byte{tcp80, tcp443}, [][]byte{udp53, tcp6, icmp}},
+		{"tcp or udp and port 53", [][]byte{udp53, udp6}, [][]byte{tcp80, icmp}},
+	} {
+		t.Run(test.expr, func(t *testing.T) {
+			for _, typ := range []ebpf.ProgramType{ebpf.SchedCLS, ebpf.XDP} {
+				for i, pkt := range test.match {
+					if ret := mustRun(t, test.expr, typ, pkt); ret != retMatch {
+						t.Errorf("%s: packet %d doesn't match", typ, i)
+					}
+				}
+				for i, pkt := range test.noMatch {
+					if ret := mustRun(t, test.expr, typ, pkt); ret != retNoMatch {
+						t.Errorf("%s: packet %d matches", typ, i)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParsePrecedence(t *testing.T) {
+	for expr, want := range map[string]string{
+		"tcp or udp and port 53":   "(tcp or udp) and port 53",
+		"tcp and udp or port 53":   "(tcp and udp) or port 53",
+		"not tcp or udp and ip6":   "((not tcp) or udp) and ip6",
+		"tcp || udp && port 53":    "(tcp or udp) and port 53",
+		"tcp or (udp and port 53)": "tcp or (udp and port 53)",
+	} {
+		have, err := parse(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantNode, err := parse(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(have, wantNode) {
+			t.Errorf("%q isn't parsed as %q", expr, want)
+		}
+	}
+}
+
+func TestCompileSocketFilter(t *testing.T) {
+	insns, err := Compile("tcp port 80", ebpf.SocketFilter, -1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Type:         ebpf.SocketFilter,
+		Instructions: insns,
+		License:      "MIT",
+	})
+	if err != nil {
+		t.Fatal("Can't load socket filter:", err)
+	}
+	prog.Close()
+}
+
+func TestCompileInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"tcp and",
+		"(tcp",
+		"tcp)",
+		"host",
+		"host foo",
+		"ip6 host 10.0.0.1",
+		"ip host fd00::1",
+		"net 10.0.0.0",
+		"port 65536",
+		"portrange 1",
+		"icmp port 80",
+		"ether",
+		"ether host 10.0.0.1",
+		"src proto 6",
+		"ip proto 256",
+		"ip foo",
+	} {
+		if _, err := Compile(expr, ebpf.XDP, retMatch, retNoMatch); err == nil {
+			t.Errorf("Compile accepts %q", expr)
+		}
+	}
+
+	if _, err := Compile("tcp", ebpf.Kprobe, retMatch, retNoMatch); err == nil {
+		t.Error("Compile accepts kprobes")
+	}
+}
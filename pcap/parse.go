@@ -0,0 +1,309 @@
+package pcap
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// tokenize splits a filter expression into words, parentheses and the
+// operators !, && and ||.
+func tokenize(expr string) []string {
+	var (
+		tokens []string
+		word   strings.Builder
+	)
+
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+
+	for i := 0; i < len(expr); i++ {
+		switch c := expr[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			flush()
+
+		case c == '(' || c == ')' || c == '!':
+			flush()
+			tokens = append(tokens, string(c))
+
+		case (c == '&' || c == '|') && i+1 < len(expr) && expr[i+1] == c:
+			flush()
+			tokens = append(tokens, expr[i:i+2])
+			i++
+
+		default:
+			word.WriteByte(c)
+		}
+	}
+
+	flush()
+	return tokens
+}
+
+// qualifiers of a primitive, for example "tcp dst port".
+type qualifiers struct {
+	proto string
+	dir   string
+	kind  string
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+	// last are the qualifiers of the previous primitive, which are reused
+	// if a primitive only consists of a value.
+	last qualifiers
+}
+
+// parse turns a filter expression into a tree of tests.
+//
+// The grammar is a subset of pcap-filter(7). Like there, "and" and "or"
+// have the same precedence and associate to the left, so "tcp or udp and
+// port 53" is "(tcp or udp) and port 53".
+//
+//	expr      = unary { ("and" | "&&" | "or" | "||") unary }
+//	unary     = ("not" | "!") unary | "(" expr ")" | primitive
+//	primitive = [proto] [dir] [kind] [value]
+func parse(expr string) (node, error) {
+	p := parser{tokens: tokenize(expr)}
+	if len(p.tokens) == 0 {
+		return nil, errors.New("empty expression")
+	}
+
+	n, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok != "" {
+		return nil, fmt.Errorf("unexpected %q", tok)
+	}
+
+	return n, nil
+}
+
+func (p *parser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() string {
+	tok := p.peek()
+	if tok != "" {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) expr() (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		switch tok := p.peek(); tok {
+		case "and", "&&", "or", "||":
+			p.next()
+			right, err := p.unary()
+			if err != nil {
+				return nil, err
+			}
+
+			if tok == "and" || tok == "&&" {
+				left = and{left, right}
+			} else {
+				left = or{left, right}
+			}
+
+		default:
+			return left, nil
+		}
+	}
+}
+
+func (p *parser) unary() (node, error) {
+	switch tok := p.peek(); tok {
+	case "not", "!":
+		p.next()
+		n, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return not{n}, nil
+
+	case "(":
+		p.next()
+		n, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.next(); tok != ")" {
+			return nil, fmt.Errorf("expected \")\", got %q", tok)
+		}
+		return n, nil
+
+	case "":
+		return nil, errors.New("unexpected end of expression")
+
+	default:
+		return p.primitive()
+	}
+}
+
+var (
+	protoQualifiers = map[string]bool{
+		"ether": true, "ip": true, "ip6": true, "arp": true,
+		"tcp": true, "udp": true, "icmp": true, "icmp6": true,
+	}
+	kindQualifiers = map[string]bool{
+		"host": true, "net": true, "port": true, "portrange": true, "proto": true,
+	}
+)
+
+func (p *parser) primitive() (node, error) {
+	var q qualifiers
+
+	if protoQualifiers[p.peek()] {
+		q.proto = p.next()
+	}
+
+	switch p.peek() {
+	case "src", "dst":
+		q.dir = p.next()
+		// "src or dst" and "src and dst" are directions, unless they
+		// are followed by another primitive.
+		if op := p.peek(); (op == "or" || op == "and") && p.pos+1 < len(p.tokens) {
+			if other := p.tokens[p.pos+1]; other != q.dir && (other == "src" || other == "dst") {
+				p.pos += 2
+				q.dir = "src " + op + " dst"
+			}
+		}
+	}
+
+	if kindQualifiers[p.peek()] {
+		q.kind = p.next()
+	}
+
+	if q == (qualifiers{}) {
+		// A lone value reuses the qualifiers of the previous primitive,
+		// so "port 53 or 80" means "port 53 or port 80".
+		if p.last == (qualifiers{}) {
+			q.kind = "host"
+		} else {
+			q = p.last
+		}
+	}
+
+	if q.kind == "" && q.dir == "" {
+		if q.proto == "ether" {
+			return nil, errors.New("ether requires a qualifier")
+		}
+		return protocol(q.proto)
+	}
+
+	if q.kind == "" {
+		q.kind = "host"
+	}
+
+	value := p.next()
+	switch value {
+	case "", "(", ")", "!", "&&", "||", "and", "or", "not":
+		return nil, fmt.Errorf("%s: missing value", q)
+	}
+
+	p.last = q
+	n, err := q.primitive(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", q, value, err)
+	}
+	return n, nil
+}
+
+func (q qualifiers) String() string {
+	var parts []string
+	for _, part := range []string{q.proto, q.dir, q.kind} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func (q qualifiers) primitive(value string) (node, error) {
+	switch q.kind {
+	case "host":
+		if q.proto == "ether" {
+			mac, err := net.ParseMAC(value)
+			if err != nil || len(mac) != 6 {
+				return nil, errors.New("invalid MAC address")
+			}
+			return etherHost(q.dir, mac)
+		}
+
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, errors.New("invalid IP address")
+		}
+		return ipHost(q.proto, q.dir, ip)
+
+	case "net":
+		_, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, errors.New("invalid network")
+		}
+		return ipNetwork(q.proto, q.dir, ipNet)
+
+	case "port", "portrange":
+		if q.proto == "ether" {
+			return nil, errors.New("ports require an IP protocol")
+		}
+
+		first, last := value, value
+		if q.kind == "portrange" {
+			i := strings.IndexByte(value, '-')
+			if i == -1 {
+				return nil, errors.New("port range must be of the form first-last")
+			}
+			first, last = value[:i], value[i+1:]
+		}
+
+		lo, err := parsePort(first)
+		if err != nil {
+			return nil, err
+		}
+		hi, err := parsePort(last)
+		if err != nil {
+			return nil, err
+		}
+		if lo > hi {
+			lo, hi = hi, lo
+		}
+		return portRange(q.proto, q.dir, lo, hi)
+
+	case "proto":
+		if q.dir != "" {
+			return nil, errors.New("proto doesn't take a direction")
+		}
+		return protocolNumber(q.proto, value)
+
+	default:
+		return nil, fmt.Errorf("unknown qualifier %q", q.kind)
+	}
+}
+
+func parsePort(value string) (uint16, error) {
+	port, err := strconv.ParseUint(value, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid port %q", value)
+	}
+	return uint16(port), nil
+}
@@ -0,0 +1,294 @@
+package pcap
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/cilium/ebpf/asm"
+)
+
+// Offsets into packets, which start with an Ethernet header.
+const (
+	ethDst       = 0
+	ethSrc       = 6
+	ethType      = 12
+	ethHeaderLen = 14
+
+	ipv4Frag  = ethHeaderLen + 6
+	ipv4Proto = ethHeaderLen + 9
+	ipv4Src   = ethHeaderLen + 12
+	ipv4Dst   = ethHeaderLen + 16
+
+	ipv6NextHeader = ethHeaderLen + 6
+	ipv6Src        = ethHeaderLen + 8
+	ipv6Dst        = ethHeaderLen + 24
+	ipv6Transport  = ethHeaderLen + 40
+)
+
+// Values of the EtherType field.
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeARP  = 0x0806
+	etherTypeIPv6 = 0x86dd
+)
+
+// ipProtocols maps names to IP protocol numbers.
+var ipProtocols = map[string]uint8{
+	"icmp":  1,
+	"tcp":   6,
+	"udp":   17,
+	"icmp6": 58,
+	"sctp":  132,
+}
+
+func allOf(nodes ...node) node {
+	n := nodes[0]
+	for _, other := range nodes[1:] {
+		n = and{n, other}
+	}
+	return n
+}
+
+func anyOf(nodes ...node) node {
+	n := nodes[0]
+	for _, other := range nodes[1:] {
+		n = or{n, other}
+	}
+	return n
+}
+
+// byDirection combines the tests returned by fn for the source and
+// destination of a packet according to dir.
+func byDirection(dir string, fn func(src bool) node) (node, error) {
+	switch dir {
+	case "src":
+		return fn(true), nil
+	case "dst":
+		return fn(false), nil
+	case "", "src or dst":
+		return or{fn(true), fn(false)}, nil
+	case "src and dst":
+		return and{fn(true), fn(false)}, nil
+	default:
+		return nil, fmt.Errorf("invalid direction %q", dir)
+	}
+}
+
+func equals(offset int32, size asm.Size, value uint32) test {
+	return test{offset: offset, size: size, op: asm.JEq, value: value}
+}
+
+func etherType(typ uint16) node {
+	return equals(ethType, asm.Half, uint32(typ))
+}
+
+func ipv4Protocol(proto uint8) node {
+	return and{etherType(etherTypeIPv4), equals(ipv4Proto, asm.Byte, uint32(proto))}
+}
+
+func ipv6Protocol(proto uint8) node {
+	return and{etherType(etherTypeIPv6), equals(ipv6NextHeader, asm.Byte, uint32(proto))}
+}
+
+// protocol returns the test for a lone protocol qualifier, like "tcp".
+func protocol(name string) (node, error) {
+	switch name {
+	case "ip":
+		return etherType(etherTypeIPv4), nil
+	case "ip6":
+		return etherType(etherTypeIPv6), nil
+	case "arp":
+		return etherType(etherTypeARP), nil
+	case "icmp":
+		return ipv4Protocol(ipProtocols[name]), nil
+	case "icmp6":
+		return ipv6Protocol(ipProtocols[name]), nil
+	case "tcp", "udp":
+		proto := ipProtocols[name]
+		return or{ipv4Protocol(proto), ipv6Protocol(proto)}, nil
+	default:
+		return nil, fmt.Errorf("unknown protocol %q", name)
+	}
+}
+
+// protocolNumber returns the test for "[ether|ip|ip6] proto value".
+func protocolNumber(qualifier, value string) (node, error) {
+	if qualifier == "ether" {
+		typ, ok := map[string]uint16{
+			"ip":  etherTypeIPv4,
+			"ip6": etherTypeIPv6,
+			"arp": etherTypeARP,
+		}[value]
+		if !ok {
+			n, err := strconv.ParseUint(value, 0, 16)
+			if err != nil {
+				return nil, errors.New("invalid EtherType")
+			}
+			typ = uint16(n)
+		}
+		return etherType(typ), nil
+	}
+
+	proto, ok := ipProtocols[value]
+	if !ok {
+		n, err := strconv.ParseUint(value, 0, 8)
+		if err != nil {
+			return nil, errors.New("invalid IP protocol")
+		}
+		proto = uint8(n)
+	}
+
+	switch qualifier {
+	case "":
+		return or{ipv4Protocol(proto), ipv6Protocol(proto)}, nil
+	case "ip":
+		return ipv4Protocol(proto), nil
+	case "ip6":
+		return ipv6Protocol(proto), nil
+	default:
+		return nil, fmt.Errorf("%s doesn't have protocols", qualifier)
+	}
+}
+
+func etherHost(dir string, mac net.HardwareAddr) (node, error) {
+	return byDirection(dir, func(src bool) node {
+		offset := int32(ethDst)
+		if src {
+			offset = ethSrc
+		}
+
+		return and{
+			equals(offset, asm.Word, uint32(mac[0])<<24|uint32(mac[1])<<16|uint32(mac[2])<<8|uint32(mac[3])),
+			equals(offset+4, asm.Half, uint32(mac[4])<<8|uint32(mac[5])),
+		}
+	})
+}
+
+func ipHost(proto, dir string, ip net.IP) (node, error) {
+	bits := 8 * net.IPv6len
+	if ip.To4() != nil {
+		bits = 8 * net.IPv4len
+	}
+	return ipNetwork(proto, dir, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+}
+
+// ipNetwork returns the test for addresses in ipNet. The address family
+// is taken from ipNet.
+func ipNetwork(proto, dir string, ipNet *net.IPNet) (node, error) {
+	ip, family, src, dst := ipNet.IP.To4(), etherType(etherTypeIPv4), int32(ipv4Src), int32(ipv4Dst)
+	if ip == nil {
+		ip, family, src, dst = ipNet.IP.To16(), etherType(etherTypeIPv6), ipv6Src, ipv6Dst
+	}
+
+	switch {
+	case proto == "":
+	case proto == "ip" && len(ip) == net.IPv4len:
+	case proto == "ip6" && len(ip) == net.IPv6len:
+	default:
+		return nil, fmt.Errorf("address family doesn't match %s", proto)
+	}
+
+	mask := ipNet.Mask
+	if len(mask) != len(ip) {
+		return nil, errors.New("mask doesn't match address family")
+	}
+
+	addr, err := byDirection(dir, func(isSrc bool) node {
+		offset := dst
+		if isSrc {
+			offset = src
+		}
+
+		var words []node
+		for i := 0; i < len(ip); i += 4 {
+			m := uint32(mask[i])<<24 | uint32(mask[i+1])<<16 | uint32(mask[i+2])<<8 | uint32(mask[i+3])
+			if m == 0 {
+				break
+			}
+
+			t := equals(offset+int32(i), asm.Word, uint32(ip[i])<<24|uint32(ip[i+1])<<16|uint32(ip[i+2])<<8|uint32(ip[i+3]))
+			if m != 0xffffffff {
+				t.mask = m
+				t.value &= m
+			}
+			words = append(words, t)
+		}
+
+		if len(words) == 0 {
+			// A zero length prefix matches all addresses.
+			return family
+		}
+		return allOf(words...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return and{family, addr}, nil
+}
+
+// portRange returns the test for TCP, UDP or SCTP ports between lo and
+// hi, inclusive.
+//
+// Like libpcap, only the first fragment of an IPv4 packet matches and
+// IPv6 extension headers aren't skipped.
+func portRange(proto, dir string, lo, hi uint16) (node, error) {
+	var protos []uint8
+	switch proto {
+	case "":
+		protos = []uint8{ipProtocols["tcp"], ipProtocols["udp"], ipProtocols["sctp"]}
+	case "tcp", "udp":
+		protos = []uint8{ipProtocols[proto]}
+	default:
+		return nil, fmt.Errorf("%s doesn't have ports", proto)
+	}
+
+	port := func(t test) node {
+		if lo == hi {
+			t.op, t.value = asm.JEq, uint32(lo)
+			return t
+		}
+
+		upper := t
+		t.op, t.value = asm.JGE, uint32(lo)
+		upper.op, upper.value = asm.JLE, uint32(hi)
+		return and{t, upper}
+	}
+
+	// Source and destination port are the first two fields of all
+	// supported protocols.
+	ipv4Ports, err := byDirection(dir, func(src bool) node {
+		t := test{transport: true, offset: 2, size: asm.Half}
+		if src {
+			t.offset = 0
+		}
+		return port(t)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ipv6Ports, _ := byDirection(dir, func(src bool) node {
+		t := test{offset: ipv6Transport + 2, size: asm.Half}
+		if src {
+			t.offset = ipv6Transport
+		}
+		return port(t)
+	})
+
+	var ipv4Protos, ipv6Protos []node
+	for _, p := range protos {
+		ipv4Protos = append(ipv4Protos, equals(ipv4Proto, asm.Byte, uint32(p)))
+		ipv6Protos = append(ipv6Protos, equals(ipv6NextHeader, asm.Byte, uint32(p)))
+	}
+
+	firstFragment := equals(ipv4Frag, asm.Half, 0)
+	firstFragment.mask = 0x1fff
+
+	return or{
+		allOf(etherType(etherTypeIPv4), anyOf(ipv4Protos...), firstFragment, ipv4Ports),
+		allOf(etherType(etherTypeIPv6), anyOf(ipv6Protos...), ipv6Ports),
+	}, nil
+}
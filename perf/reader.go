@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"os"
 	"runtime"
 	"sync"
+	"time"
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/internal"
@@ -15,8 +17,9 @@ import (
 )
 
 var (
-	errClosed = errors.New("perf reader was closed")
-	errEOR    = errors.New("end of ring")
+	errClosed       = errors.New("perf reader was closed")
+	errEOR          = errors.New("end of ring")
+	errMustBePaused = errors.New("perf reader must be paused before reading overwritable buffers")
 )
 
 // perfEventHeader must match 'struct perf_event_header` in <linux/perf_event.h>.
@@ -131,7 +134,8 @@ func readRawSample(rd io.Reader) ([]byte, error) {
 // from user space.
 type Reader struct {
 	// mu protects read/write access to the Reader structure with the
-	// exception of 'pauseFds', which is protected by 'pauseMu'.
+	// exception of 'pauseFds', 'paused' and the elements of 'rings', which
+	// are protected by 'pauseMu'.
 	// If locking both 'mu' and 'pauseMu', 'mu' must be locked first.
 	mu sync.Mutex
 
@@ -140,6 +144,10 @@ type Reader struct {
 	array *ebpf.Map
 	rings []*perfEventRing
 
+	// Used to create rings for CPUs which come online later on.
+	perCPUBuffer int
+	opts         ReaderOptions
+
 	epollFd     int
 	epollEvents []unix.EpollEvent
 	epollRings  []*perfEventRing
@@ -148,11 +156,22 @@ type Reader struct {
 	// Ensure we only close once
 	closeOnce sync.Once
 
+	// deadlineFd is an eventfd used to interrupt Read when the deadline
+	// changes. deadlineMu protects both it and deadline, since they are
+	// accessed while Read holds mu.
+	deadlineMu sync.Mutex
+	deadline   time.Time
+	deadlineFd int
+
 	// pauseFds are a copy of the fds in 'rings', protected by 'pauseMu'.
 	// These allow Pause/Resume to be executed independently of any ongoing
 	// Read calls, which would otherwise need to be interrupted.
 	pauseMu  sync.Mutex
 	pauseFds []int
+	paused   bool
+	// loaded is true if overwritable rings have been snapshotted by Read
+	// since the last call to Pause.
+	loaded bool
 }
 
 // ReaderOptions control the behaviour of the user
@@ -162,6 +181,17 @@ type ReaderOptions struct {
 	// Read will process data. Must be smaller than PerCPUBuffer.
 	// The default is to start processing as soon as data is available.
 	Watermark int
+	// The number of samples required in any per CPU buffer before
+	// Read will process data. Setting this to a value larger than one
+	// reduces the number of wakeups at the cost of latency.
+	// Mutually exclusive with Watermark.
+	WakeupEvents int
+	// Overwritable turns the per CPU buffers into flight recorders: once
+	// a buffer is full, new samples overwrite the oldest ones instead of
+	// being lost. The Reader must be paused before calling Read.
+	//
+	// Requires at least Linux 4.7.
+	Overwritable bool
 }
 
 // NewReader creates a new reader with default options.
@@ -179,11 +209,25 @@ func NewReaderWithOptions(array *ebpf.Map, perCPUBuffer int, opts ReaderOptions)
 		return nil, errors.New("perCPUBuffer must be larger than 0")
 	}
 
+	if opts.Watermark < 0 || opts.WakeupEvents < 0 {
+		return nil, errors.New("Watermark and WakeupEvents mustn't be negative")
+	}
+
+	if opts.Watermark > 0 && opts.WakeupEvents > 0 {
+		return nil, errors.New("Watermark and WakeupEvents are mutually exclusive")
+	}
+
 	epollFd, err := unix.EpollCreate1(unix.EPOLL_CLOEXEC)
 	if err != nil {
 		return nil, fmt.Errorf("can't create epoll fd: %v", err)
 	}
 
+	possibleCPUs, err := internal.PossibleCPUs()
+	if err != nil {
+		unix.Close(epollFd)
+		return nil, fmt.Errorf("can't get number of possible CPUs: %w", err)
+	}
+
 	var (
 		fds      = []int{epollFd}
 		nCPU     = int(array.MaxEntries())
@@ -191,6 +235,12 @@ func NewReaderWithOptions(array *ebpf.Map, perCPUBuffer int, opts ReaderOptions)
 		pauseFds = make([]int, 0, nCPU)
 	)
 
+	// The array may be larger than the number of CPUs in the system, but
+	// perf events can't be opened for CPUs which don't exist.
+	if nCPU > possibleCPUs {
+		nCPU = possibleCPUs
+	}
+
 	defer func() {
 		if err != nil {
 			for _, fd := range fds {
@@ -208,7 +258,7 @@ func NewReaderWithOptions(array *ebpf.Map, perCPUBuffer int, opts ReaderOptions)
 	// but doesn't allow using a wildcard like -1 to specify "all CPUs".
 	// Hence we have to create a ring for each CPU.
 	for i := 0; i < nCPU; i++ {
-		ring, err := newPerfEventRing(i, perCPUBuffer, opts.Watermark)
+		ring, err := newPerfEventRing(i, perCPUBuffer, opts.Watermark, opts.WakeupEvents, opts.Overwritable)
 		if errors.Is(err, unix.ENODEV) {
 			// The requested CPU is currently offline, skip it.
 			rings = append(rings, nil)
@@ -237,19 +287,32 @@ func NewReaderWithOptions(array *ebpf.Map, perCPUBuffer int, opts ReaderOptions)
 		return nil, err
 	}
 
+	deadlineFd, err := unix.Eventfd(0, unix.O_CLOEXEC|unix.O_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	fds = append(fds, deadlineFd)
+
+	if err := addToEpoll(epollFd, deadlineFd, -1); err != nil {
+		return nil, err
+	}
+
 	array, err = array.Clone()
 	if err != nil {
 		return nil, err
 	}
 
 	pr = &Reader{
-		array:   array,
-		rings:   rings,
-		epollFd: epollFd,
-		// Allocate extra event for closeFd
-		epollEvents: make([]unix.EpollEvent, len(rings)+1),
+		array:        array,
+		rings:        rings,
+		perCPUBuffer: perCPUBuffer,
+		opts:         opts,
+		epollFd:      epollFd,
+		// Allocate extra events for closeFd and deadlineFd
+		epollEvents: make([]unix.EpollEvent, len(rings)+2),
 		epollRings:  make([]*perfEventRing, 0, len(rings)),
 		closeFd:     closeFd,
+		deadlineFd:  deadlineFd,
 		pauseFds:    pauseFds,
 	}
 	if err = pr.Resume(); err != nil {
@@ -290,6 +353,11 @@ func (pr *Reader) Close() error {
 		unix.Close(pr.closeFd)
 		pr.epollFd, pr.closeFd = -1, -1
 
+		pr.deadlineMu.Lock()
+		unix.Close(pr.deadlineFd)
+		pr.deadlineFd = -1
+		pr.deadlineMu.Unlock()
+
 		// Close rings
 		for _, ring := range pr.rings {
 			if ring != nil {
@@ -316,7 +384,12 @@ func (pr *Reader) Close() error {
 // Records can contain between 0 and 7 bytes of trailing garbage from the ring
 // depending on the input sample's length.
 //
-// Calling Close interrupts the function.
+// Calling Close interrupts the function. Returns an error wrapping
+// os.ErrDeadlineExceeded if the deadline set by SetDeadline passes.
+//
+// Overwritable buffers are read without blocking, and the Reader must be
+// paused. Records are returned one CPU at a time, starting with the most
+// recent record of each CPU. Returns io.EOF once all records have been read.
 func (pr *Reader) Read() (Record, error) {
 	pr.mu.Lock()
 	defer pr.mu.Unlock()
@@ -325,9 +398,18 @@ func (pr *Reader) Read() (Record, error) {
 		return Record{}, errClosed
 	}
 
+	if pr.opts.Overwritable {
+		return pr.readOverwritable()
+	}
+
 	for {
 		if len(pr.epollRings) == 0 {
-			nEvents, err := unix.EpollWait(pr.epollFd, pr.epollEvents, -1)
+			timeout, err := pr.epollTimeout()
+			if err != nil {
+				return Record{}, err
+			}
+
+			nEvents, err := unix.EpollWait(pr.epollFd, pr.epollEvents, timeout)
 			if temp, ok := err.(temporaryError); ok && temp.Temporary() {
 				// Retry the syscall if we we're interrupted, see https://github.com/golang/go/issues/20400
 				continue
@@ -342,7 +424,17 @@ func (pr *Reader) Read() (Record, error) {
 					return Record{}, errClosed
 				}
 
+				if int(event.Fd) == pr.deadlineFd {
+					// The deadline changed, drain the eventfd and
+					// recompute the timeout.
+					var value [8]byte
+					_, _ = unix.Read(pr.deadlineFd, value[:])
+					continue
+				}
+
+				pr.pauseMu.Lock()
 				ring := pr.rings[cpuForEvent(&event)]
+				pr.pauseMu.Unlock()
 				pr.epollRings = append(pr.epollRings, ring)
 
 				// Read the current head pointer now, not every time
@@ -350,6 +442,11 @@ func (pr *Reader) Read() (Record, error) {
 				// from keeping the reader busy.
 				ring.loadHead()
 			}
+
+			if len(pr.epollRings) == 0 {
+				// Either the deadline changed or it has passed.
+				continue
+			}
 		}
 
 		// Start at the last available event. The order in which we
@@ -367,12 +464,95 @@ func (pr *Reader) Read() (Record, error) {
 	}
 }
 
+// readOverwritable returns the records which are present in overwritable
+// rings. It doesn't block.
+//
+// Must be called with mu held.
+func (pr *Reader) readOverwritable() (Record, error) {
+	pr.pauseMu.Lock()
+	if !pr.paused {
+		pr.pauseMu.Unlock()
+		return Record{}, errMustBePaused
+	}
+
+	if !pr.loaded {
+		// Iterate in reverse, since epollRings is consumed from the back.
+		pr.epollRings = pr.epollRings[:0]
+		for i := len(pr.rings) - 1; i >= 0; i-- {
+			if ring := pr.rings[i]; ring != nil {
+				ring.loadHead()
+				pr.epollRings = append(pr.epollRings, ring)
+			}
+		}
+		pr.loaded = true
+	}
+	pr.pauseMu.Unlock()
+
+	for len(pr.epollRings) > 0 {
+		record, err := readRecordFromRing(pr.epollRings[len(pr.epollRings)-1])
+		if err == errEOR {
+			pr.epollRings = pr.epollRings[:len(pr.epollRings)-1]
+			continue
+		}
+
+		return record, err
+	}
+
+	return Record{}, io.EOF
+}
+
+// SetDeadline controls how long Read blocks waiting for records.
+//
+// A Read which is blocked at the time of the call observes the new
+// deadline. Passing the zero time.Time removes the deadline.
+func (pr *Reader) SetDeadline(t time.Time) {
+	pr.deadlineMu.Lock()
+	defer pr.deadlineMu.Unlock()
+
+	pr.deadline = t
+
+	if pr.deadlineFd == -1 {
+		return
+	}
+
+	// Interrupt Read() so that it picks up the new deadline.
+	var value [8]byte
+	internal.NativeEndian.PutUint64(value[:], 1)
+	_, _ = unix.Write(pr.deadlineFd, value[:])
+}
+
+// epollTimeout returns the timeout for epoll_wait in milliseconds, based
+// on the deadline.
+func (pr *Reader) epollTimeout() (int, error) {
+	pr.deadlineMu.Lock()
+	defer pr.deadlineMu.Unlock()
+
+	if pr.deadline.IsZero() {
+		return -1, nil
+	}
+
+	left := time.Until(pr.deadline)
+	if left <= 0 {
+		return 0, fmt.Errorf("perf reader: %w", os.ErrDeadlineExceeded)
+	}
+
+	// Round up, otherwise epoll_wait returns shortly before the deadline.
+	msecs := (left + time.Millisecond - 1) / time.Millisecond
+	if msecs > math.MaxInt32 {
+		msecs = math.MaxInt32
+	}
+	return int(msecs), nil
+}
+
 // Pause stops all notifications from this Reader.
 //
 // While the Reader is paused, any attempts to write to the event buffer from
 // BPF programs will return -ENOENT.
 //
-// Subsequent calls to Read will block until a call to Resume.
+// Subsequent calls to Read will block until a call to Resume, unless the
+// buffers are overwritable. In that case Read returns the records present
+// at the time of the first Read after Pause, even if they were already
+// returned while the Reader was previously paused.
 func (pr *Reader) Pause() error {
 	pr.pauseMu.Lock()
 	defer pr.pauseMu.Unlock()
@@ -387,6 +567,8 @@ func (pr *Reader) Pause() error {
 		}
 	}
 
+	pr.paused = true
+	pr.loaded = false
 	return nil
 }
 
@@ -411,9 +593,60 @@ func (pr *Reader) Resume() error {
 		}
 	}
 
+	pr.paused = false
 	return nil
 }
 
+// AddOnlineCPUs creates rings for CPUs which were offline when the Reader
+// was created, but have come online since.
+//
+// CPUs which are still offline are skipped. Rings of CPUs which go offline
+// are kept, since the CPU may come back later.
+//
+// Returns the number of added rings. It's safe to call this concurrently
+// with Read.
+func (pr *Reader) AddOnlineCPUs() (int, error) {
+	pr.pauseMu.Lock()
+	defer pr.pauseMu.Unlock()
+
+	if pr.pauseFds == nil {
+		return 0, errClosed
+	}
+
+	added := 0
+	for cpu := range pr.rings {
+		if pr.rings[cpu] != nil {
+			continue
+		}
+
+		ring, err := newPerfEventRing(cpu, pr.perCPUBuffer, pr.opts.Watermark, pr.opts.WakeupEvents, pr.opts.Overwritable)
+		if errors.Is(err, unix.ENODEV) {
+			continue
+		}
+		if err != nil {
+			return added, fmt.Errorf("failed to create perf ring for CPU %d: %v", cpu, err)
+		}
+
+		if err := addToEpoll(pr.epollFd, ring.fd, cpu); err != nil {
+			ring.Close()
+			return added, err
+		}
+
+		if !pr.paused {
+			if err := pr.array.Put(uint32(cpu), uint32(ring.fd)); err != nil {
+				ring.Close()
+				return added, fmt.Errorf("couldn't put event fd %d for CPU %d: %w", ring.fd, cpu, err)
+			}
+		}
+
+		pr.rings[cpu] = ring
+		pr.pauseFds[cpu] = ring.fd
+		added++
+	}
+
+	return added, nil
+}
+
 type temporaryError interface {
 	Temporary() bool
 }
@@ -3,7 +3,9 @@ package perf
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"syscall"
 	"testing"
@@ -68,6 +70,39 @@ func TestPerfReader(t *testing.T) {
 	}
 }
 
+func TestPerfReaderWakeupEvents(t *testing.T) {
+	prog, events := mustOutputSamplesProg(t, 5, 5)
+	defer prog.Close()
+	defer events.Close()
+
+	rd, err := NewReaderWithOptions(events, 4096, ReaderOptions{WakeupEvents: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+
+	ret, _, err := prog.Test(make([]byte, 14))
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if errno := syscall.Errno(-int32(ret)); errno != 0 {
+		t.Fatal("Expected 0 as return value, got", errno)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := rd.Read(); err != nil {
+			t.Fatalf("Can't read sample %d: %s", i, err)
+		}
+	}
+
+	_, err = NewReaderWithOptions(events, 4096, ReaderOptions{Watermark: 1, WakeupEvents: 2})
+	if err == nil {
+		t.Error("Watermark and WakeupEvents can be combined")
+	}
+}
+
 func outputSamplesProg(sampleSizes ...int) (*ebpf.Program, *ebpf.Map, error) {
 	const bpfFCurrentCPU = 0xffffffff
 
@@ -283,8 +318,65 @@ func TestPerfReaderClose(t *testing.T) {
 	}
 }
 
+func TestPerfReaderDeadline(t *testing.T) {
+	prog, events := mustOutputSamplesProg(t, 5)
+	defer prog.Close()
+	defer events.Close()
+
+	rd, err := NewReader(events, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+
+	rd.SetDeadline(time.Now().Add(-time.Second))
+	if _, err := rd.Read(); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatal("Expected os.ErrDeadlineExceeded from expired deadline, got", err)
+	}
+
+	rd.SetDeadline(time.Time{})
+
+	errs := make(chan error, 1)
+	waiting := make(chan struct{})
+	go func() {
+		close(waiting)
+		_, err := rd.Read()
+		errs <- err
+	}()
+
+	<-waiting
+
+	// Setting a deadline should interrupt Read
+	rd.SetDeadline(time.Now().Add(10 * time.Millisecond))
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatal("Expected os.ErrDeadlineExceeded, got", err)
+		}
+	case <-time.After(readTimeout):
+		t.Fatal("SetDeadline doesn't interrupt Read")
+	}
+
+	rd.SetDeadline(time.Now().Add(readTimeout))
+
+	ret, _, err := prog.Test(make([]byte, 14))
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if errno := syscall.Errno(-int32(ret)); errno != 0 {
+		t.Fatal("Expected 0 as return value, got", errno)
+	}
+
+	if _, err := rd.Read(); err != nil {
+		t.Fatal("Can't read sample before deadline:", err)
+	}
+}
+
 func TestCreatePerfEvent(t *testing.T) {
-	fd, err := createPerfEvent(0, 1)
+	fd, err := createPerfEvent(0, 1, 0, false)
 	if err != nil {
 		t.Fatal("Can't create perf event:", err)
 	}
@@ -472,3 +564,133 @@ func ExampleReader() {
 	// Data is padded with 0 for alignment
 	fmt.Println("Sample:", record.RawSample)
 }
+
+func TestPerfReaderAddOnlineCPUs(t *testing.T) {
+	prog, events := mustOutputSamplesProg(t, 5)
+	defer prog.Close()
+	defer events.Close()
+
+	rd, err := NewReader(events, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+
+	n, err := rd.AddOnlineCPUs()
+	if err != nil {
+		t.Fatal("Can't add online CPUs:", err)
+	}
+	if n != 0 {
+		t.Fatal("Added rings for CPUs which already have one:", n)
+	}
+
+	// Pretend that all CPUs were offline when the reader was created.
+	rd.pauseMu.Lock()
+	added := 0
+	for cpu, ring := range rd.rings {
+		if ring == nil {
+			continue
+		}
+		ring.Close()
+		rd.rings[cpu] = nil
+		rd.pauseFds[cpu] = -1
+		added++
+	}
+	rd.pauseMu.Unlock()
+
+	n, err = rd.AddOnlineCPUs()
+	if err != nil {
+		t.Fatal("Can't add online CPUs:", err)
+	}
+	if n != added {
+		t.Fatalf("Expected %d new rings, got %d", added, n)
+	}
+
+	ret, _, err := prog.Test(make([]byte, 14))
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil || ret != 0 {
+		t.Fatal("Can't write sample:", ret, err)
+	}
+
+	rd.SetDeadline(time.Now().Add(readTimeout))
+	if _, err := rd.Read(); err != nil {
+		t.Fatal("Can't read from added ring:", err)
+	}
+
+	rd.Close()
+	if _, err := rd.AddOnlineCPUs(); !IsClosed(err) {
+		t.Error("Expected IsClosed on a closed reader, got", err)
+	}
+}
+
+func TestPerfReaderOverwritable(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "4.7", "overwritable perf events")
+
+	prog, events := mustOutputSamplesProg(t, 5)
+	defer prog.Close()
+	defer events.Close()
+
+	rd, err := NewReaderWithOptions(events, 4096, ReaderOptions{Overwritable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+
+	if _, err := rd.Read(); !errors.Is(err, errMustBePaused) {
+		t.Fatal("Reading an unpaused overwritable reader doesn't fail:", err)
+	}
+
+	// Write more samples than fit into the buffer.
+	const nSamples = 1000
+	for i := 0; i < nSamples; i++ {
+		ret, _, err := prog.Test(make([]byte, 14))
+		testutils.SkipIfNotSupported(t, err)
+		if err != nil || ret != 0 {
+			t.Fatal("Can't write sample:", ret, err)
+		}
+	}
+
+	if err := rd.Pause(); err != nil {
+		t.Fatal(err)
+	}
+
+	readAll := func() int {
+		t.Helper()
+
+		// Trailing garbage in overwritten buffers isn't zero.
+		want := []byte{1, 2, 3, 4, 4}
+		n := 0
+		for {
+			record, err := rd.Read()
+			if errors.Is(err, io.EOF) {
+				return n
+			}
+			if err != nil {
+				t.Fatal("Can't read samples:", err)
+			}
+			if record.LostSamples != 0 {
+				t.Fatal("Overwritable buffer lost samples:", record.LostSamples)
+			}
+			if !bytes.HasPrefix(record.RawSample, want) {
+				t.Fatal("Sample doesn't match expected output:", record.RawSample)
+			}
+			n++
+		}
+	}
+
+	n := readAll()
+	if n == 0 || n >= nSamples {
+		t.Fatalf("Expected the buffer to contain part of the %d samples, got %d", nSamples, n)
+	}
+
+	if _, err := rd.Read(); !errors.Is(err, io.EOF) {
+		t.Error("Expected io.EOF after reading all samples, got", err)
+	}
+
+	if err := rd.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if again := readAll(); again != n {
+		t.Errorf("Reading the same buffer again returns %d instead of %d samples", again, n)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"sync/atomic"
 	"unsafe"
 
+	"github.com/cilium/ebpf/internal"
 	"github.com/cilium/ebpf/internal/unix"
 )
 
@@ -19,15 +20,15 @@ type perfEventRing struct {
 	fd   int
 	cpu  int
 	mmap []byte
-	*ringReader
+	ringReader
 }
 
-func newPerfEventRing(cpu, perCPUBuffer, watermark int) (*perfEventRing, error) {
+func newPerfEventRing(cpu, perCPUBuffer, watermark, wakeupEvents int, overwritable bool) (*perfEventRing, error) {
 	if watermark >= perCPUBuffer {
 		return nil, errors.New("watermark must be smaller than perCPUBuffer")
 	}
 
-	fd, err := createPerfEvent(cpu, watermark)
+	fd, err := createPerfEvent(cpu, watermark, wakeupEvents, overwritable)
 	if err != nil {
 		return nil, err
 	}
@@ -37,7 +38,13 @@ func newPerfEventRing(cpu, perCPUBuffer, watermark int) (*perfEventRing, error)
 		return nil, err
 	}
 
-	mmap, err := unix.Mmap(fd, 0, perfBufferSize(perCPUBuffer), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	// The kernel only overwrites old data if the mapping is read-only.
+	protections := unix.PROT_READ
+	if !overwritable {
+		protections |= unix.PROT_WRITE
+	}
+
+	mmap, err := unix.Mmap(fd, 0, perfBufferSize(perCPUBuffer), protections, unix.MAP_SHARED)
 	if err != nil {
 		unix.Close(fd)
 		return nil, fmt.Errorf("can't mmap: %v", err)
@@ -48,12 +55,20 @@ func newPerfEventRing(cpu, perCPUBuffer, watermark int) (*perfEventRing, error)
 	// This use of unsafe.Pointer isn't explicitly sanctioned by the
 	// documentation, since a byte is smaller than sampledPerfEvent.
 	meta := (*unix.PerfEventMmapPage)(unsafe.Pointer(&mmap[0]))
+	data := mmap[meta.Data_offset : meta.Data_offset+meta.Data_size]
+
+	var reader ringReader
+	if overwritable {
+		reader = newReverseReader(meta, data)
+	} else {
+		reader = newForwardReader(meta, data)
+	}
 
 	ring := &perfEventRing{
 		fd:         fd,
 		cpu:        cpu,
 		mmap:       mmap,
-		ringReader: newRingReader(meta, mmap[meta.Data_offset:meta.Data_offset+meta.Data_size]),
+		ringReader: reader,
 	}
 	runtime.SetFinalizer(ring, (*perfEventRing).Close)
 
@@ -86,17 +101,29 @@ func (ring *perfEventRing) Close() {
 	ring.mmap = nil
 }
 
-func createPerfEvent(cpu, watermark int) (int, error) {
-	if watermark == 0 {
-		watermark = 1
-	}
-
+// createPerfEvent opens a BPF output event. The reader is woken up after
+// wakeupEvents samples if it is non-zero, and after watermark bytes
+// otherwise. Overwritable events are written backwards, see reverseReader.
+func createPerfEvent(cpu, watermark, wakeupEvents int, overwritable bool) (int, error) {
 	attr := unix.PerfEventAttr{
 		Type:        unix.PERF_TYPE_SOFTWARE,
 		Config:      unix.PERF_COUNT_SW_BPF_OUTPUT,
-		Bits:        unix.PerfBitWatermark,
 		Sample_type: unix.PERF_SAMPLE_RAW,
-		Wakeup:      uint32(watermark),
+	}
+
+	if wakeupEvents > 0 {
+		attr.Wakeup = uint32(wakeupEvents)
+	} else {
+		if watermark == 0 {
+			watermark = 1
+		}
+
+		attr.Bits = unix.PerfBitWatermark
+		attr.Wakeup = uint32(watermark)
+	}
+
+	if overwritable {
+		attr.Bits |= unix.PerfBitWriteBackward
 	}
 
 	attr.Size = uint32(unsafe.Sizeof(attr))
@@ -107,15 +134,29 @@ func createPerfEvent(cpu, watermark int) (int, error) {
 	return fd, nil
 }
 
-type ringReader struct {
+// ringReader reads records from the data area of a perf ring.
+type ringReader interface {
+	// loadHead fetches the position of the most recent record written by
+	// the kernel. Read doesn't return any data written after the call.
+	loadHead()
+	// writeTail tells the kernel which data has been consumed.
+	writeTail()
+	// size returns the size of the data area in bytes.
+	size() int
+	Read(p []byte) (int, error)
+}
+
+// forwardReader reads a ring which the kernel doesn't overwrite, in the
+// order in which records were written.
+type forwardReader struct {
 	meta       *unix.PerfEventMmapPage
 	head, tail uint64
 	mask       uint64
 	ring       []byte
 }
 
-func newRingReader(meta *unix.PerfEventMmapPage, ring []byte) *ringReader {
-	return &ringReader{
+func newForwardReader(meta *unix.PerfEventMmapPage, ring []byte) *forwardReader {
+	return &forwardReader{
 		meta: meta,
 		head: atomic.LoadUint64(&meta.Data_head),
 		tail: atomic.LoadUint64(&meta.Data_tail),
@@ -125,17 +166,21 @@ func newRingReader(meta *unix.PerfEventMmapPage, ring []byte) *ringReader {
 	}
 }
 
-func (rr *ringReader) loadHead() {
+func (rr *forwardReader) loadHead() {
 	rr.head = atomic.LoadUint64(&rr.meta.Data_head)
 }
 
-func (rr *ringReader) writeTail() {
+func (rr *forwardReader) writeTail() {
 	// Commit the new tail. This lets the kernel know that
 	// the ring buffer has been consumed.
 	atomic.StoreUint64(&rr.meta.Data_tail, rr.tail)
 }
 
-func (rr *ringReader) Read(p []byte) (int, error) {
+func (rr *forwardReader) size() int {
+	return cap(rr.ring)
+}
+
+func (rr *forwardReader) Read(p []byte) (int, error) {
 	start := int(rr.tail & rr.mask)
 
 	n := len(p)
@@ -158,3 +203,86 @@ func (rr *ringReader) Read(p []byte) (int, error) {
 
 	return n, nil
 }
+
+// reverseReader reads an overwritable ring, which the kernel fills
+// backwards. Records are returned starting with the most recent one.
+//
+// The kernel decrements the head before writing a record, so the records
+// between the head and the end of the ring are ordered from newest to
+// oldest. Once the ring has wrapped, the oldest record may be partially
+// overwritten.
+type reverseReader struct {
+	meta *unix.PerfEventMmapPage
+	// read is the position of the next byte to return.
+	read uint64
+	// head is the position of the most recent record.
+	head uint64
+	// tail is the end of the last complete record after head.
+	tail uint64
+	mask uint64
+	ring []byte
+}
+
+func newReverseReader(meta *unix.PerfEventMmapPage, ring []byte) *reverseReader {
+	rr := &reverseReader{
+		meta: meta,
+		// cap is always a power of two
+		mask: uint64(cap(ring) - 1),
+		ring: ring,
+	}
+	rr.loadHead()
+	return rr
+}
+
+func (rr *reverseReader) loadHead() {
+	rr.head = atomic.LoadUint64(&rr.meta.Data_head)
+	rr.read = rr.head
+	rr.tail = rr.head
+
+	// Walk the records to find the oldest one which is still intact.
+	// Records are aligned to 8 bytes, so a header never wraps.
+	const headerSize = uint64(unsafe.Sizeof(perfEventHeader{}))
+	size := uint64(cap(rr.ring))
+	for rr.tail-rr.head+headerSize <= size {
+		start := rr.tail & rr.mask
+		recordSize := uint64(internal.NativeEndian.Uint16(rr.ring[start+uint64(unsafe.Offsetof(perfEventHeader{}.Size)):]))
+		if recordSize == 0 || rr.tail-rr.head+recordSize > size {
+			// Either the ring hasn't wrapped yet and this is unused
+			// space, or the record was partially overwritten.
+			break
+		}
+		rr.tail += recordSize
+	}
+}
+
+func (rr *reverseReader) writeTail() {
+	// The kernel ignores the tail of overwritable rings.
+}
+
+func (rr *reverseReader) size() int {
+	return cap(rr.ring)
+}
+
+func (rr *reverseReader) Read(p []byte) (int, error) {
+	start := int(rr.read & rr.mask)
+
+	n := len(p)
+	// Truncate if the read wraps in the ring buffer
+	if remainder := cap(rr.ring) - start; n > remainder {
+		n = remainder
+	}
+
+	// Truncate if there isn't enough data
+	if remainder := int(rr.tail - rr.read); n > remainder {
+		n = remainder
+	}
+
+	copy(p, rr.ring[start:start+n])
+	rr.read += uint64(n)
+
+	if rr.read == rr.tail {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
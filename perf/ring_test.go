@@ -6,6 +6,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/cilium/ebpf/internal"
 	"github.com/cilium/ebpf/internal/unix"
 )
 
@@ -45,7 +46,7 @@ func TestRingBufferReader(t *testing.T) {
 	}
 }
 
-func makeRing(size, offset int) *ringReader {
+func makeRing(size, offset int) *forwardReader {
 	if size%2 != 0 {
 		panic("size must be power of two")
 	}
@@ -61,17 +62,17 @@ func makeRing(size, offset int) *ringReader {
 		Data_size: uint64(len(ring)),
 	}
 
-	return newRingReader(&meta, ring)
+	return newForwardReader(&meta, ring)
 }
 
 func TestPerfEventRing(t *testing.T) {
 	check := func(buffer, watermark int) {
-		ring, err := newPerfEventRing(0, buffer, watermark)
+		ring, err := newPerfEventRing(0, buffer, watermark, 0, false)
 		if err != nil {
 			t.Fatal(err)
 		}
 
-		size := len(ring.ringReader.ring)
+		size := ring.size()
 
 		// Ring size should be at least as big as buffer
 		if size < buffer {
@@ -89,13 +90,13 @@ func TestPerfEventRing(t *testing.T) {
 	}
 
 	// watermark > buffer
-	_, err := newPerfEventRing(0, 8192, 8193)
+	_, err := newPerfEventRing(0, 8192, 8193, 0, false)
 	if err == nil {
 		t.Fatal("watermark > buffer allowed")
 	}
 
 	// watermark == buffer
-	_, err = newPerfEventRing(0, 8192, 8192)
+	_, err = newPerfEventRing(0, 8192, 8192, 0, false)
 	if err == nil {
 		t.Fatal("watermark == buffer allowed")
 	}
@@ -106,3 +107,67 @@ func TestPerfEventRing(t *testing.T) {
 	// large buffer not a multiple of page size at all (prime)
 	check(65537, 8192)
 }
+
+func TestReverseReader(t *testing.T) {
+	// writeBackward emulates the kernel writing a sample to an
+	// overwritable ring.
+	writeBackward := func(ring []byte, head uint64, data []byte) uint64 {
+		size := 8 + (4+len(data)+7)/8*8
+		head -= uint64(size)
+
+		record := make([]byte, size)
+		internal.NativeEndian.PutUint32(record[0:], unix.PERF_RECORD_SAMPLE)
+		internal.NativeEndian.PutUint16(record[6:], uint16(size))
+		internal.NativeEndian.PutUint32(record[8:], uint32(len(data)))
+		copy(record[12:], data)
+
+		for i, b := range record {
+			ring[(head+uint64(i))%uint64(len(ring))] = b
+		}
+		return head
+	}
+
+	read := func(rr *reverseReader) [][]byte {
+		t.Helper()
+
+		var samples [][]byte
+		for {
+			record, err := readRecord(rr, 0)
+			if err == errEOR {
+				return samples
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			samples = append(samples, record.RawSample)
+		}
+	}
+
+	ring := make([]byte, 64)
+	var meta unix.PerfEventMmapPage
+	rr := newReverseReader(&meta, ring)
+	if samples := read(rr); len(samples) != 0 {
+		t.Fatal("Empty ring returns samples:", samples)
+	}
+
+	meta.Data_head = writeBackward(ring, meta.Data_head, []byte{1, 1, 1, 1})
+	meta.Data_head = writeBackward(ring, meta.Data_head, []byte{2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2})
+	rr.loadHead()
+	if samples := read(rr); len(samples) != 2 || samples[0][0] != 2 || samples[1][0] != 1 {
+		t.Fatal("Expected the most recent sample first, got", samples)
+	}
+
+	// The ring wraps and partially overwrites the first sample.
+	meta.Data_head = writeBackward(ring, meta.Data_head, []byte{3, 3, 3, 3})
+	meta.Data_head = writeBackward(ring, meta.Data_head, []byte{4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4})
+	rr.loadHead()
+	samples := read(rr)
+	if len(samples) != 3 {
+		t.Fatal("Expected three intact samples, got", samples)
+	}
+	for i, want := range []byte{4, 3, 2} {
+		if samples[i][0] != want {
+			t.Errorf("Sample %d is %v, expected it to start with %d", i, samples[i], want)
+		}
+	}
+}
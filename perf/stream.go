@@ -0,0 +1,128 @@
+package perf
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// OverflowPolicy determines what a Stream does when its channel is full.
+type OverflowPolicy int
+
+// Valid overflow policies.
+const (
+	// Block stops reading until the channel has space. Samples may be
+	// lost in the kernel instead, which is reported via LostSamples.
+	Block OverflowPolicy = iota
+	// DropNewest discards the record which doesn't fit into the channel.
+	DropNewest
+	// DropOldest discards the oldest record in the channel to make space.
+	DropOldest
+)
+
+// StreamOptions control a Stream.
+type StreamOptions struct {
+	// The number of records buffered in the channel. Must be positive
+	// unless Overflow is Block.
+	Size int
+	// What to do when the channel is full. Defaults to Block.
+	Overflow OverflowPolicy
+}
+
+// Stream delivers records from a Reader on a channel.
+type Stream struct {
+	// Accessed atomically, must be the first field to be 64-bit
+	// aligned on 32-bit platforms.
+	dropped uint64
+
+	// C receives records, including records of lost samples. It is
+	// closed when the underlying Reader is closed or fails.
+	C <-chan Record
+
+	err error
+}
+
+// Stream reads records in a separate goroutine and delivers them on a
+// channel.
+//
+// Stop the Stream by closing the Reader. The Reader mustn't be read from
+// while a Stream is active. When using Block, C must be drained until it is
+// closed, otherwise the goroutine leaks.
+//
+// Returns an error if the options are invalid. DropNewest and DropOldest
+// need a buffered channel, since an unbuffered one is never full.
+func (pr *Reader) Stream(opts StreamOptions) (*Stream, error) {
+	switch {
+	case opts.Size < 0:
+		return nil, fmt.Errorf("stream: negative size %d", opts.Size)
+	case opts.Overflow != Block && opts.Overflow != DropNewest && opts.Overflow != DropOldest:
+		return nil, fmt.Errorf("stream: invalid overflow policy %d", opts.Overflow)
+	case opts.Overflow != Block && opts.Size == 0:
+		return nil, fmt.Errorf("stream: overflow policy %d requires a positive size", opts.Overflow)
+	}
+
+	records := make(chan Record, opts.Size)
+	s := &Stream{C: records}
+
+	go func() {
+		defer close(records)
+
+		for {
+			record, err := pr.Read()
+			if err != nil {
+				if !IsClosed(err) {
+					s.err = err
+				}
+				return
+			}
+
+			s.deliver(records, record, opts.Overflow)
+		}
+	}()
+
+	return s, nil
+}
+
+func (s *Stream) deliver(records chan Record, record Record, policy OverflowPolicy) {
+	switch policy {
+	case DropNewest:
+		select {
+		case records <- record:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+
+	case DropOldest:
+		for {
+			select {
+			case records <- record:
+				return
+			default:
+			}
+
+			// The consumer may have emptied the channel in the meantime,
+			// so don't block here.
+			select {
+			case <-records:
+				atomic.AddUint64(&s.dropped, 1)
+			default:
+			}
+		}
+
+	default:
+		records <- record
+	}
+}
+
+// Dropped returns the number of records discarded due to the
+// OverflowPolicy.
+func (s *Stream) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Err returns the error which stopped the Stream, or nil if the Reader
+// was closed.
+//
+// It is only valid to call Err after C is closed.
+func (s *Stream) Err() error {
+	return s.err
+}
@@ -0,0 +1,97 @@
+package perf
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cilium/ebpf/internal/testutils"
+)
+
+func TestStream(t *testing.T) {
+	for _, test := range []struct {
+		policy   OverflowPolicy
+		size     int
+		received []int
+		dropped  uint64
+	}{
+		{Block, 0, []int{5, 13, 21}, 0},
+		{DropNewest, 1, []int{5}, 2},
+		{DropOldest, 1, []int{21}, 2},
+	} {
+		prog, events := mustOutputSamplesProg(t, 5, 13, 21)
+		defer prog.Close()
+		defer events.Close()
+
+		rd, err := NewReader(events, 4096)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rd.Close()
+
+		ret, _, err := prog.Test(make([]byte, 14))
+		testutils.SkipIfNotSupported(t, err)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ret != 0 {
+			t.Fatal("Expected 0 as return value, got", ret)
+		}
+
+		s, err := rd.Stream(StreamOptions{Size: test.size, Overflow: test.policy})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		deadline := time.Now().Add(readTimeout)
+		for s.Dropped() != test.dropped && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if dropped := s.Dropped(); dropped != test.dropped {
+			t.Fatalf("Policy %d: expected %d dropped records, got %d", test.policy, test.dropped, dropped)
+		}
+
+		for _, size := range test.received {
+			select {
+			case record := <-s.C:
+				// Samples are padded to eight bytes and prefixed with their size.
+				if want := (size+4+7)/8*8 - 4; len(record.RawSample) != want {
+					t.Errorf("Policy %d: expected sample of length %d, got %d", test.policy, want, len(record.RawSample))
+				}
+			case <-time.After(readTimeout):
+				t.Fatalf("Policy %d: no record received", test.policy)
+			}
+		}
+
+		if err := rd.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case record, ok := <-s.C:
+			if ok {
+				t.Fatalf("Policy %d: unexpected record %v", test.policy, record)
+			}
+		case <-time.After(readTimeout):
+			t.Fatalf("Policy %d: channel isn't closed", test.policy)
+		}
+
+		if err := s.Err(); err != nil {
+			t.Errorf("Policy %d: closing the reader returns an error: %s", test.policy, err)
+		}
+	}
+}
+
+func TestStreamInvalid(t *testing.T) {
+	// Options are checked before the Reader is used.
+	var rd Reader
+	for name, opts := range map[string]StreamOptions{
+		"DropNewest unbuffered": {Size: 0, Overflow: DropNewest},
+		"DropOldest unbuffered": {Size: 0, Overflow: DropOldest},
+		"negative size":         {Size: -1},
+		"invalid policy":        {Size: 1, Overflow: 42},
+	} {
+		if _, err := rd.Stream(opts); err == nil {
+			t.Errorf("%s: Stream doesn't return an error", name)
+		}
+	}
+}
@@ -1,12 +1,13 @@
 package ebpf
 
 import (
-	"bytes"
+	"encoding"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"math"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,6 +20,9 @@ import (
 // ErrNotSupported is returned whenever the kernel doesn't support a feature.
 var ErrNotSupported = internal.ErrNotSupported
 
+// ErrProgIncompatible is returned if a loaded program doesn't match a spec.
+var ErrProgIncompatible = errors.New("program's spec is incompatible with loaded program")
+
 // ProgramID represents the unique ID of an eBPF program.
 type ProgramID uint32
 
@@ -41,33 +45,65 @@ type ProgramOptions struct {
 	// Controls the output buffer size for the verifier. Defaults to
 	// DefaultVerifierLogSize.
 	LogSize int
+	// Check instructions for common mistakes before passing them to the
+	// kernel. Problems are reported as asm.Diagnostics, which are easier
+	// to understand than the verifier log. See asm.Instructions.Check.
+	CheckInstructions bool
+	// Type information used for CO-RE relocations and when resolving
+	// attach targets. Defaults to the BTF of the running kernel, which is
+	// cached after the first use.
+	//
+	// Set this when the kernel isn't built with CONFIG_DEBUG_INFO_BTF,
+	// see btf.LoadRawSpec.
+	KernelTypes *btf.Spec
+	// KernelVersion overrides ProgramSpec.KernelVersion of Kprobe
+	// programs, for example when loading objects compiled against
+	// different kernel headers. Encoded like the KERNEL_VERSION macro.
+	KernelVersion uint32
 }
 
 // ProgramSpec defines a Program.
 type ProgramSpec struct {
-	// Name is passed to the kernel as a debug aid. Must only contain
-	// alpha numeric and '_' characters.
+	// Name is passed to the kernel as a debug aid, and shows up in the
+	// output of bpftool and ProgramInfo. Characters the kernel doesn't
+	// accept are removed, and the name is truncated to 15 bytes.
 	Name string
+	// SectionName is the name of the ELF section the program was loaded
+	// from. By convention it describes where the program is attached,
+	// for example "kprobe/sys_execve".
+	SectionName string
 	// Type determines at which hook in the kernel a program will run.
 	Type       ProgramType
 	AttachType AttachType
 	// Name of a kernel data structure to attach to. It's interpretation
 	// depends on Type and AttachType.
-	AttachTo     string
+	AttachTo string
+	// AttachTarget is a loaded program to attach to instead of the kernel.
+	// Required by Extension programs, and used by Tracing programs to
+	// trace other programs. AttachTo is then the name of a function in the
+	// BTF of AttachTarget, which must be a global function for Extension
+	// programs.
+	AttachTarget *Program
 	Instructions asm.Instructions
 	// Flags is passed to the kernel and specifies additional program
-	// load attributes.
+	// load attributes, see ProgStrictAlignment and friends.
 	Flags uint32
 	// License of the program. Some helpers are only available if
-	// the license is deemed compatible with the GPL.
+	// the license is deemed compatible with the GPL, for example "GPL"
+	// or "Dual MIT/GPL". Populated from the "license" section of ELF
+	// files.
 	//
 	// See https://www.kernel.org/doc/html/latest/process/license-rules.html#id1
 	License string
 
-	// Version used by Kprobe programs.
+	// Version used by Kprobe programs, encoded like the KERNEL_VERSION
+	// macro. Kernels before 5.0 refuse to load kprobes if it doesn't
+	// match the running kernel. Populated from the "version" section of
+	// ELF files.
 	//
-	// Deprecated on kernels 5.0 and later. Leave empty to let the library
-	// detect this value automatically.
+	// Ignored on kernels 5.0 and later. Leave empty or set to the magic
+	// value 0xFFFFFFFE to let the library detect the running kernel's
+	// version, or override it via ProgramOptions.KernelVersion.
 	KernelVersion uint32
 
 	// The BTF associated with this program. Changing Instructions
@@ -79,6 +115,32 @@ type ProgramSpec struct {
 	ByteOrder binary.ByteOrder
 }
 
+// Flags for ProgramSpec.Flags.
+//
+// The values match the BPF_F_* constants in the kernel's UAPI.
+const (
+	// ProgStrictAlignment makes the verifier enforce alignment of
+	// memory accesses even on architectures which don't require it.
+	ProgStrictAlignment = 1 << iota
+	// ProgAnyAlignment makes the verifier ignore alignment of memory
+	// accesses. Only useful for testing.
+	ProgAnyAlignment
+	_ // BPF_F_TEST_RND_HI32
+	_ // BPF_F_TEST_STATE_FREQ
+	// ProgSleepable allows Tracing and LSM programs to call helpers
+	// which may sleep.
+	//
+	// Requires at least 5.10.
+	ProgSleepable
+	// ProgXDPHasFrags marks an XDP program as able to handle frames
+	// which are split across multiple buffers, as used by jumbo frames
+	// on some drivers. Such programs may also be tested with input
+	// larger than a page.
+	//
+	// Requires at least 5.18.
+	ProgXDPHasFrags
+)
+
 // Copy returns a copy of the spec.
 func (ps *ProgramSpec) Copy() *ProgramSpec {
 	if ps == nil {
@@ -98,6 +160,46 @@ func (ps *ProgramSpec) Tag() (string, error) {
 	return ps.Instructions.Tag(internal.NativeEndian)
 }
 
+// Complexity estimates how hard it is for the verifier to check the
+// program. See asm.Instructions.Complexity.
+func (ps *ProgramSpec) Complexity() (asm.Complexity, error) {
+	insns := make(asm.Instructions, len(ps.Instructions))
+	copy(insns, ps.Instructions)
+
+	if err := fixupJumpsAndCalls(insns); err != nil {
+		return asm.Complexity{}, err
+	}
+
+	return insns.Complexity()
+}
+
+// Compatible returns nil if an existing program is equivalent to one loaded
+// from the spec.
+//
+// Programs are compared by type and by the tag the kernel calculates over
+// the instructions, which requires at least 4.10. The returned error
+// explains the mismatch and wraps ErrProgIncompatible.
+func (ps *ProgramSpec) Compatible(p *Program) error {
+	if p.typ != ps.Type {
+		return fmt.Errorf("type %v != %v: %w", ps.Type, p.typ, ErrProgIncompatible)
+	}
+
+	info, err := p.Info()
+	if err != nil {
+		return fmt.Errorf("get program info: %w", err)
+	}
+
+	tag, err := ps.Tag()
+	if err != nil {
+		return fmt.Errorf("calculate tag: %w", err)
+	}
+
+	if info.Tag != tag {
+		return fmt.Errorf("tag %s != %s: %w", tag, info.Tag, ErrProgIncompatible)
+	}
+	return nil
+}
+
 // Program represents BPF program loaded into the kernel.
 //
 // It is not safe to close a Program which is used by other goroutines.
@@ -131,17 +233,14 @@ func NewProgramWithOptions(spec *ProgramSpec, opts ProgramOptions) (*Program, er
 	return newProgramWithOptions(spec, opts, btfs)
 }
 
-func newProgramWithOptions(spec *ProgramSpec, opts ProgramOptions, btfs btfHandleCache) (*Program, error) {
-	if len(spec.Instructions) == 0 {
-		return nil, errors.New("Instructions cannot be empty")
-	}
-
-	if len(spec.License) == 0 {
-		return nil, errors.New("License cannot be empty")
+// progKernelVersion returns the kernel version to load spec with.
+func progKernelVersion(spec *ProgramSpec, opts ProgramOptions) (uint32, error) {
+	if spec.Type != Kprobe {
+		return spec.KernelVersion, nil
 	}
 
-	if spec.ByteOrder != nil && spec.ByteOrder != internal.NativeEndian {
-		return nil, fmt.Errorf("can't load %s program on %s", spec.ByteOrder, internal.NativeEndian)
+	if opts.KernelVersion != 0 {
+		return opts.KernelVersion, nil
 	}
 
 	// Kernels before 5.0 (6c4fc209fcf9 "bpf: remove useless version check for prog load")
@@ -149,13 +248,42 @@ func newProgramWithOptions(spec *ProgramSpec, opts ProgramOptions, btfs btfHandl
 	// macro for kprobe-type programs.
 	// Overwrite Kprobe program version if set to zero or the magic version constant.
 	kv := spec.KernelVersion
-	if spec.Type == Kprobe && (kv == 0 || kv == internal.MagicKernelVersion) {
+	if kv == 0 || kv == internal.MagicKernelVersion {
 		v, err := internal.KernelVersion()
 		if err != nil {
-			return nil, fmt.Errorf("detecting kernel version: %w", err)
+			return 0, fmt.Errorf("detecting kernel version: %w", err)
 		}
 		kv = v.Kernel()
 	}
+	return kv, nil
+}
+
+func newProgramWithOptions(spec *ProgramSpec, opts ProgramOptions, btfs btfHandleCache) (*Program, error) {
+	if len(spec.Instructions) == 0 {
+		return nil, errors.New("Instructions cannot be empty")
+	}
+
+	if len(spec.License) == 0 {
+		return nil, errors.New("License cannot be empty")
+	}
+
+	if spec.ByteOrder != nil && !internal.IsNativeEndian(spec.ByteOrder) {
+		return nil, fmt.Errorf("can't load %s program on %s", spec.ByteOrder, internal.NativeEndian)
+	}
+
+	if spec.Flags&ProgXDPHasFrags > 0 {
+		if spec.Type != XDP {
+			return nil, fmt.Errorf("flag ProgXDPHasFrags requires an XDP program, got %s", spec.Type)
+		}
+		if err := haveXDPFrags(); err != nil {
+			return nil, fmt.Errorf("load program: %w", err)
+		}
+	}
+
+	kv, err := progKernelVersion(spec, opts)
+	if err != nil {
+		return nil, err
+	}
 
 	insns := make(asm.Instructions, len(spec.Instructions))
 	copy(insns, spec.Instructions)
@@ -164,13 +292,17 @@ func newProgramWithOptions(spec *ProgramSpec, opts ProgramOptions, btfs btfHandl
 		return nil, err
 	}
 
-	buf := bytes.NewBuffer(make([]byte, 0, len(spec.Instructions)*asm.InstructionSize))
-	err := insns.Marshal(buf, internal.NativeEndian)
+	if opts.CheckInstructions {
+		if err := insns.Check(); err != nil {
+			return nil, fmt.Errorf("check instructions: %w", err)
+		}
+	}
+
+	bytecode, err := insns.AppendMarshal(nil, internal.NativeEndian)
 	if err != nil {
 		return nil, err
 	}
 
-	bytecode := buf.Bytes()
 	insCount := uint32(len(bytecode) / asm.InstructionSize)
 	attr := &bpfProgLoadAttr{
 		progType:           spec.Type,
@@ -183,12 +315,12 @@ func newProgramWithOptions(spec *ProgramSpec, opts ProgramOptions, btfs btfHandl
 	}
 
 	if haveObjName() == nil {
-		attr.progName = newBPFObjName(spec.Name)
+		attr.progName = newBPFObjName(SanitizeName(spec.Name, -1))
 	}
 
 	var btfDisabled bool
 	if spec.BTF != nil {
-		if relos, err := btf.ProgramRelocations(spec.BTF, nil); err != nil {
+		if relos, err := btf.ProgramRelocations(spec.BTF, opts.KernelTypes); err != nil {
 			return nil, fmt.Errorf("CO-RE relocations: %s", err)
 		} else if len(relos) > 0 {
 			return nil, fmt.Errorf("applying CO-RE relocations: %w", ErrNotSupported)
@@ -221,8 +353,23 @@ func newProgramWithOptions(spec *ProgramSpec, opts ProgramOptions, btfs btfHandl
 		}
 	}
 
-	if spec.AttachTo != "" {
-		target, err := resolveBTFType(spec.AttachTo, spec.Type, spec.AttachType)
+	if spec.AttachTarget != nil {
+		targetFd := spec.AttachTarget.FD()
+		if targetFd < 0 {
+			return nil, fmt.Errorf("attach target: %w", internal.ErrClosedFd)
+		}
+
+		targetID, err := resolveProgramFunc(spec.AttachTarget, spec.AttachTo)
+		if err != nil {
+			return nil, err
+		}
+
+		attr.attachProgFd = uint32(targetFd)
+		attr.attachBTFID = targetID
+	} else if spec.Type == Extension {
+		return nil, errors.New("extension program requires an AttachTarget")
+	} else if spec.AttachTo != "" {
+		target, err := resolveBTFType(opts.KernelTypes, spec.AttachTo, spec.Type, spec.AttachType)
 		if err != nil {
 			return nil, err
 		}
@@ -267,12 +414,65 @@ func newProgramWithOptions(spec *ProgramSpec, opts ProgramOptions, btfs btfHandl
 	}
 
 	err = internal.ErrorWithLog(err, logBuf, logErr)
+	if spec.BTF != nil {
+		if line, ok := verifierErrorLine(internal.CString(logBuf), spec.BTF); ok {
+			err = fmt.Errorf("at %s: %w", line, err)
+		}
+	}
 	if btfDisabled {
 		return nil, fmt.Errorf("load program without BTF: %w", err)
 	}
 	return nil, fmt.Errorf("load program: %w", err)
 }
 
+// verifierErrorLine returns the source line of the instruction the verifier
+// rejected.
+//
+// The verifier prints each instruction it processes as "idx: (op) ...", so
+// the last of these is assumed to be the offending one.
+func verifierErrorLine(log string, prog *btf.Program) (btf.Line, bool) {
+	var (
+		insn  uint64
+		found bool
+	)
+	for _, line := range strings.Split(log, "\n") {
+		i := strings.Index(line, ": (")
+		if i <= 0 {
+			continue
+		}
+
+		n, err := strconv.ParseUint(line[:i], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		insn, found = n, true
+	}
+
+	if !found {
+		return btf.Line{}, false
+	}
+
+	lines, err := btf.ProgramLines(prog)
+	if err != nil {
+		return btf.Line{}, false
+	}
+
+	// Line infos only mark the first instruction generated for a line.
+	var (
+		result btf.Line
+		ok     bool
+	)
+	for _, line := range lines {
+		if line.InsnOff > insn {
+			break
+		}
+		result, ok = line, true
+	}
+
+	return result, ok
+}
+
 // NewProgramFromFD creates a program from a raw fd.
 //
 // You should not use fd after calling this function.
@@ -305,7 +505,7 @@ func newProgramFromFD(fd *internal.FD) (*Program, error) {
 		return nil, fmt.Errorf("discover program type: %w", err)
 	}
 
-	return &Program{"", fd, "", "", info.Type}, nil
+	return &Program{"", fd, info.Name, "", info.Type}, nil
 }
 
 func (p *Program) String() string {
@@ -327,6 +527,26 @@ func (p *Program) Info() (*ProgramInfo, error) {
 	return newProgramInfoFromFd(p.fd)
 }
 
+// Stats returns runtime statistics of the program.
+//
+// The kernel only collects statistics while they are enabled, either by
+// EnableStats or the kernel.bpf_stats_enabled sysctl. Stats is cheaper
+// than Info since it doesn't retrieve the program's instructions.
+//
+// Requires at least 5.1.
+func (p *Program) Stats() (*ProgramStats, error) {
+	info, err := bpfGetProgInfoByFD(p.fd)
+	if err != nil {
+		return nil, fmt.Errorf("get stats of %s: %w", p, err)
+	}
+
+	return &ProgramStats{
+		Runtime:         time.Duration(info.run_time_ns),
+		RunCount:        info.run_cnt,
+		RecursionMisses: info.recursion_misses,
+	}, nil
+}
+
 // FD gets the file descriptor of the Program.
 //
 // It is invalid to call this function after Close has been called.
@@ -393,6 +613,9 @@ func (p *Program) IsPinned() bool {
 }
 
 // Close unloads the program from the kernel.
+//
+// Calling Close more than once is a no-op. Use TrackFDLeaks to find
+// programs which are never closed.
 func (p *Program) Close() error {
 	if p == nil {
 		return nil
@@ -405,17 +628,59 @@ func (p *Program) Close() error {
 // value returned by the eBPF program. outLen may be zero.
 //
 // Note: the kernel expects at least 14 bytes input for an ethernet header for
-// XDP and SKB programs.
+// XDP and SKB programs. Input for XDP programs loaded with ProgXDPHasFrags
+// may exceed a page, in which case it is split into fragments.
+//
+// Packets for XDP and TC programs are easiest to build and inspect with
+// gopacket, see the testrun/gopackettest module:
+//
+//	ret, pkt, err := gopackettest.Run(prog, &eth, &ip, &tcp)
 //
 // This function requires at least Linux 4.12.
 func (p *Program) Test(in []byte) (uint32, []byte, error) {
-	ret, out, _, err := p.testRun(in, 1, nil)
+	ret, out, _, err := p.testRun(&RunOptions{Data: in})
 	if err != nil {
 		return ret, nil, fmt.Errorf("can't test program: %w", err)
 	}
 	return ret, out, nil
 }
 
+// RunOptions control a test run of a program, see Program.Run.
+type RunOptions struct {
+	// Data is the input of the program, usually a packet.
+	Data []byte
+	// Context is marshaled and passed to the program as its context, for
+	// example a testrun.SKBuff. Optional.
+	Context interface{}
+	// ContextOut receives the context after the program ran. Optional.
+	ContextOut interface{}
+	// Repeat is the number of times to run the program. Defaults to one.
+	Repeat uint32
+	// Reset is called whenever the run is interrupted and restarted.
+	// Optional.
+	Reset func()
+}
+
+// Run runs the Program in the kernel and returns the value returned by the
+// eBPF program and the output data.
+//
+// The testrun package has builders for common inputs. A nil opts is
+// treated like zero RunOptions, which is rejected since Data is missing.
+//
+// Passing a context requires at least Linux 5.2 for programs operating on
+// struct __sk_buff, and 5.14 for XDP.
+func (p *Program) Run(opts *RunOptions) (uint32, []byte, error) {
+	if opts == nil {
+		opts = new(RunOptions)
+	}
+
+	ret, out, _, err := p.testRun(opts)
+	if err != nil {
+		return ret, nil, fmt.Errorf("can't run program: %w", err)
+	}
+	return ret, out, nil
+}
+
 // Benchmark runs the Program with the given input for a number of times
 // and returns the time taken per iteration.
 //
@@ -428,7 +693,15 @@ func (p *Program) Test(in []byte) (uint32, []byte, error) {
 //
 // This function requires at least Linux 4.12.
 func (p *Program) Benchmark(in []byte, repeat int, reset func()) (uint32, time.Duration, error) {
-	ret, _, total, err := p.testRun(in, repeat, reset)
+	if uint(repeat) > math.MaxUint32 {
+		return 0, 0, fmt.Errorf("repeat is too high")
+	}
+
+	ret, _, total, err := p.testRun(&RunOptions{
+		Data:   in,
+		Repeat: uint32(repeat),
+		Reset:  reset,
+	})
 	if err != nil {
 		return ret, total, fmt.Errorf("can't benchmark program: %w", err)
 	}
@@ -471,16 +744,39 @@ var haveProgTestRun = internal.FeatureTest("BPF_PROG_TEST_RUN", "4.12", func() e
 	return err
 })
 
-func (p *Program) testRun(in []byte, repeat int, reset func()) (uint32, []byte, time.Duration, error) {
-	if uint(repeat) > math.MaxUint32 {
-		return 0, nil, 0, fmt.Errorf("repeat is too high")
+var haveXDPFrags = internal.FeatureTest("XDP frags", "5.18", func() error {
+	insns := asm.Instructions{
+		asm.Mov.Imm(asm.R0, 0),
+		asm.Return(),
+	}
+
+	bytecode, err := insns.AppendMarshal(nil, internal.NativeEndian)
+	if err != nil {
+		return err
+	}
+
+	attr := bpfProgLoadAttr{
+		progType:     XDP,
+		progFlags:    ProgXDPHasFrags,
+		insCount:     uint32(len(bytecode) / asm.InstructionSize),
+		instructions: internal.NewSlicePointer(bytecode),
+		license:      internal.NewStringPointer("MIT"),
 	}
 
-	if len(in) == 0 {
+	fd, err := bpfProgLoad(&attr)
+	if err != nil {
+		return internal.ErrNotSupported
+	}
+	_ = fd.Close()
+	return nil
+})
+
+func (p *Program) testRun(opts *RunOptions) (uint32, []byte, time.Duration, error) {
+	if len(opts.Data) == 0 {
 		return 0, nil, 0, fmt.Errorf("missing input")
 	}
 
-	if uint(len(in)) > math.MaxUint32 {
+	if uint(len(opts.Data)) > math.MaxUint32 {
 		return 0, nil, 0, fmt.Errorf("input is too long")
 	}
 
@@ -493,31 +789,64 @@ func (p *Program) testRun(in []byte, repeat int, reset func()) (uint32, []byte,
 	// size will be. Hence we allocate an output buffer which we hope will always be large
 	// enough, and panic if the kernel wrote past the end of the allocation.
 	// See https://patchwork.ozlabs.org/cover/1006822/
-	out := make([]byte, len(in)+outputPad)
+	out := make([]byte, len(opts.Data)+outputPad)
 
 	fd, err := p.fd.Value()
 	if err != nil {
 		return 0, nil, 0, err
 	}
 
+	repeat := opts.Repeat
+	if repeat == 0 {
+		repeat = 1
+	}
+
 	attr := bpfProgTestRunAttr{
 		fd:          fd,
-		dataSizeIn:  uint32(len(in)),
+		dataSizeIn:  uint32(len(opts.Data)),
 		dataSizeOut: uint32(len(out)),
-		dataIn:      internal.NewSlicePointer(in),
+		dataIn:      internal.NewSlicePointer(opts.Data),
 		dataOut:     internal.NewSlicePointer(out),
-		repeat:      uint32(repeat),
+		repeat:      repeat,
+	}
+
+	var ctxIn []byte
+	if opts.Context != nil {
+		ctxIn, err = marshalContext(opts.Context)
+		if err != nil {
+			return 0, nil, 0, fmt.Errorf("context: %w", err)
+		}
+
+		attr.ctxSizeIn = uint32(len(ctxIn))
+		attr.ctxIn = internal.NewSlicePointer(ctxIn)
+	}
+
+	var ctxOut []byte
+	if opts.ContextOut != nil {
+		size := binary.Size(opts.ContextOut)
+		if size < 0 {
+			return 0, nil, 0, fmt.Errorf("context out: can't determine size of %T", opts.ContextOut)
+		}
+		if len(ctxIn) > size {
+			size = len(ctxIn)
+		}
+
+		ctxOut = make([]byte, size)
+		attr.ctxSizeOut = uint32(len(ctxOut))
+		attr.ctxOut = internal.NewSlicePointer(ctxOut)
 	}
 
-	for {
+	for i := 1; ; i++ {
 		err = bpfProgTestRun(&attr)
 		if err == nil {
 			break
 		}
 
-		if errors.Is(err, unix.EINTR) {
-			if reset != nil {
-				reset()
+		// BPF doesn't retry PROG_TEST_RUN, since state modified by the
+		// program may have to be reset first.
+		if errors.Is(err, unix.EINTR) && i < internal.MaxSyscallRetries {
+			if opts.Reset != nil {
+				opts.Reset()
 			}
 			continue
 		}
@@ -532,10 +861,32 @@ func (p *Program) testRun(in []byte, repeat int, reset func()) (uint32, []byte,
 	}
 	out = out[:int(attr.dataSizeOut)]
 
+	if opts.ContextOut != nil {
+		// The kernel's context may be smaller than ContextOut, the
+		// remainder stays zero.
+		if err := unmarshalBytes(opts.ContextOut, ctxOut); err != nil {
+			return 0, nil, 0, fmt.Errorf("context out: %w", err)
+		}
+	}
+
 	total := time.Duration(attr.duration) * time.Nanosecond
 	return attr.retval, out, total, nil
 }
 
+// marshalContext encodes the context of a test run. Unlike map keys and
+// values its size isn't known in advance.
+func marshalContext(ctx interface{}) ([]byte, error) {
+	if m, ok := ctx.(encoding.BinaryMarshaler); ok {
+		return m.MarshalBinary()
+	}
+
+	size := binary.Size(ctx)
+	if size < 0 {
+		return nil, fmt.Errorf("can't determine size of %T", ctx)
+	}
+	return marshalBytes(ctx, size)
+}
+
 func unmarshalProgram(buf []byte) (*Program, error) {
 	if len(buf) != 4 {
 		return nil, errors.New("program id requires 4 byte value")
@@ -664,16 +1015,41 @@ func (p *Program) ID() (ProgramID, error) {
 	return ProgramID(info.id), nil
 }
 
-func findKernelType(name string, typ btf.Type) error {
-	kernel, err := btf.LoadKernelSpec()
-	if err != nil {
-		return fmt.Errorf("can't load kernel spec: %w", err)
+func findKernelType(kernel *btf.Spec, name string, typ btf.Type) error {
+	if kernel == nil {
+		var err error
+		kernel, err = btf.LoadKernelSpec()
+		if err != nil {
+			return fmt.Errorf("can't load kernel spec: %w", err)
+		}
 	}
 
 	return kernel.FindType(name, typ)
 }
 
-func resolveBTFType(name string, progType ProgramType, attachType AttachType) (btf.Type, error) {
+// resolveProgramFunc finds the BTF ID of a function in a loaded program.
+func resolveProgramFunc(prog *Program, name string) (btf.TypeID, error) {
+	if name == "" {
+		return 0, errors.New("missing function name for attach target")
+	}
+
+	info, err := bpfGetProgInfoByFD(prog.fd)
+	if err != nil {
+		return 0, fmt.Errorf("attach target: %w", err)
+	}
+	if info.btf_id == 0 {
+		return 0, fmt.Errorf("attach target %s has no BTF", prog)
+	}
+
+	id, err := btf.FindFuncByID(info.btf_id, name)
+	if err != nil {
+		return 0, fmt.Errorf("attach target %s: %w", prog, err)
+	}
+
+	return id, nil
+}
+
+func resolveBTFType(kernel *btf.Spec, name string, progType ProgramType, attachType AttachType) (btf.Type, error) {
 	type match struct {
 		p ProgramType
 		a AttachType
@@ -683,7 +1059,7 @@ func resolveBTFType(name string, progType ProgramType, attachType AttachType) (b
 	switch target {
 	case match{LSM, AttachLSMMac}:
 		var target btf.Func
-		err := findKernelType("bpf_lsm_"+name, &target)
+		err := findKernelType(kernel, "bpf_lsm_"+name, &target)
 		if errors.Is(err, btf.ErrNotFound) {
 			return nil, &internal.UnsupportedFeatureError{
 				Name: name + " LSM hook",
@@ -697,7 +1073,7 @@ func resolveBTFType(name string, progType ProgramType, attachType AttachType) (b
 
 	case match{Tracing, AttachTraceIter}:
 		var target btf.Func
-		err := findKernelType("bpf_iter_"+name, &target)
+		err := findKernelType(kernel, "bpf_iter_"+name, &target)
 		if errors.Is(err, btf.ErrNotFound) {
 			return nil, &internal.UnsupportedFeatureError{
 				Name: name + " iterator",
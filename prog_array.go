@@ -0,0 +1,73 @@
+package ebpf
+
+import (
+	"fmt"
+)
+
+// ProgramArrayMap is a Map of type ProgramArray.
+//
+// BPF programs use it together with asm.FnTailCall to jump into another
+// program. The wrapper only exists for convenience, all operations are
+// also possible via the underlying Map.
+type ProgramArrayMap struct {
+	m *Map
+}
+
+// NewProgramArrayMap wraps an existing ProgramArray.
+//
+// The map isn't copied, closing it invalidates the ProgramArrayMap.
+func NewProgramArrayMap(m *Map) (*ProgramArrayMap, error) {
+	if m.Type() != ProgramArray {
+		return nil, fmt.Errorf("%s is not a %s", m, ProgramArray)
+	}
+
+	if m.KeySize() != 4 || m.ValueSize() != 4 {
+		return nil, fmt.Errorf("%s: key and value size must be four bytes", m)
+	}
+
+	return &ProgramArrayMap{m}, nil
+}
+
+// Map returns the underlying Map.
+func (pa *ProgramArrayMap) Map() *Map {
+	return pa.m
+}
+
+// Close the underlying Map.
+func (pa *ProgramArrayMap) Close() error {
+	return pa.m.Close()
+}
+
+// Set makes prog the target of tail calls to index.
+func (pa *ProgramArrayMap) Set(index uint32, prog *Program) error {
+	if prog == nil {
+		return fmt.Errorf("index %d: program is nil", index)
+	}
+
+	if err := pa.m.Put(index, prog); err != nil {
+		return fmt.Errorf("index %d: %w", index, err)
+	}
+	return nil
+}
+
+// Get returns the program at index.
+//
+// The caller must close the returned program. Returns an error wrapping
+// ErrKeyNotExist if the index is empty. Requires at least 4.12.
+func (pa *ProgramArrayMap) Get(index uint32) (*Program, error) {
+	var prog *Program
+	if err := pa.m.Lookup(index, &prog); err != nil {
+		return nil, fmt.Errorf("index %d: %w", index, err)
+	}
+	return prog, nil
+}
+
+// Delete removes the program at index, so that tail calls to it fail.
+//
+// Returns an error wrapping ErrKeyNotExist if the index is empty.
+func (pa *ProgramArrayMap) Delete(index uint32) error {
+	if err := pa.m.Delete(index); err != nil {
+		return fmt.Errorf("index %d: %w", index, err)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package ebpf
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cilium/ebpf/internal/testutils"
+)
+
+func TestProgramArrayMap(t *testing.T) {
+	arr, err := NewProgramArrayMap(createProgramArray(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer arr.Close()
+
+	prog := createSocketFilter(t)
+	defer prog.Close()
+
+	if err := arr.Set(0, prog); err != nil {
+		t.Fatal("Can't set program:", err)
+	}
+
+	if err := arr.Set(1, prog); err == nil {
+		t.Error("Set accepts out of bounds index")
+	}
+
+	testutils.SkipOnOldKernel(t, "4.12", "lookup for ProgramArray")
+
+	prog2, err := arr.Get(0)
+	if err != nil {
+		t.Fatal("Can't get program:", err)
+	}
+	prog2.Close()
+
+	if err := arr.Delete(0); err != nil {
+		t.Fatal("Can't delete program:", err)
+	}
+
+	if _, err := arr.Get(0); !errors.Is(err, ErrKeyNotExist) {
+		t.Error("Expected ErrKeyNotExist from Get, got", err)
+	}
+
+	if err := arr.Delete(0); !errors.Is(err, ErrKeyNotExist) {
+		t.Error("Expected ErrKeyNotExist from Delete, got", err)
+	}
+}
+
+func TestNewProgramArrayMapInvalid(t *testing.T) {
+	m := createArray(t)
+	defer m.Close()
+
+	if _, err := NewProgramArrayMap(m); err == nil {
+		t.Error("NewProgramArrayMap accepts an Array")
+	}
+}
@@ -2,9 +2,11 @@ package ebpf
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"math"
 	"os"
 	"path/filepath"
@@ -18,6 +20,7 @@ import (
 
 	"github.com/cilium/ebpf/asm"
 	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/btf"
 	"github.com/cilium/ebpf/internal/testutils"
 	"github.com/cilium/ebpf/internal/unix"
 )
@@ -84,6 +87,104 @@ func TestProgramRun(t *testing.T) {
 	if !bytes.Equal(out[:len(pat)], pat) {
 		t.Errorf("Expected %v, got %v", pat, out)
 	}
+
+	if _, _, err := prog.Run(nil); err == nil {
+		t.Error("Run accepts nil options")
+	}
+}
+
+func TestProgramRunContext(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.2", "context for BPF_PROG_TEST_RUN")
+
+	// Return skb->mark and set skb->cb[0].
+	prog, err := NewProgram(&ProgramSpec{
+		Type: SchedCLS,
+		Instructions: asm.Instructions{
+			asm.LoadMem(asm.R0, asm.R1, 8, asm.Word),
+			asm.StoreImm(asm.R1, 48, 23, asm.Word),
+			asm.Return(),
+		},
+		License: "MIT",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer prog.Close()
+
+	// The context is a struct __sk_buff.
+	ctx := make([]byte, 192)
+	internal.NativeEndian.PutUint32(ctx[8:], 42)
+	ctxOut := make([]byte, len(ctx))
+
+	ret, _, err := prog.Run(&RunOptions{
+		Data:       make([]byte, 14),
+		Context:    ctx,
+		ContextOut: &ctxOut,
+	})
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ret != 42 {
+		t.Error("Expected return value to be 42, got", ret)
+	}
+	if cb := internal.NativeEndian.Uint32(ctxOut[48:]); cb != 23 {
+		t.Error("Expected cb[0] to be 23, got", cb)
+	}
+
+	_, _, err = prog.Run(&RunOptions{
+		Data:       make([]byte, 14),
+		ContextOut: new(interface{}),
+	})
+	if err == nil {
+		t.Error("Run accepts ContextOut without a size")
+	}
+}
+
+func TestProgramXDPFrags(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.18", "BPF_F_XDP_HAS_FRAGS")
+
+	spec := &ProgramSpec{
+		Type: XDP,
+		Instructions: asm.Instructions{
+			// return XDP_PASS
+			asm.LoadImm(asm.R0, 2, asm.DWord),
+			asm.Return(),
+		},
+		License: "MIT",
+	}
+
+	spec.Flags = ProgXDPHasFrags
+	prog, err := NewProgram(spec)
+	if err != nil {
+		t.Fatal("Can't load program with ProgXDPHasFrags:", err)
+	}
+	defer prog.Close()
+
+	// Larger than a page, so the input is split into fragments.
+	in := make([]byte, 9000)
+	for i := range in {
+		in[i] = byte(i)
+	}
+
+	ret, out, err := prog.Test(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ret != 2 {
+		t.Error("Expected return value 2, got", ret)
+	}
+
+	if !bytes.Equal(out, in) {
+		t.Errorf("Output doesn't match input (%d bytes, expected %d)", len(out), len(in))
+	}
+
+	spec.Type = SocketFilter
+	if _, err := NewProgram(spec); err == nil {
+		t.Error("Loading a non-XDP program with ProgXDPHasFrags doesn't return an error")
+	}
 }
 
 func TestProgramBenchmark(t *testing.T) {
@@ -134,13 +235,13 @@ func TestProgramTestRunInterrupt(t *testing.T) {
 
 		// Block this thread in the BPF syscall, so that we can
 		// trigger EINTR by sending a signal.
-		_, _, _, err := prog.testRun(make([]byte, 14), math.MaxInt32, func() {
+		_, _, _, err := prog.testRun(&RunOptions{Data: make([]byte, 14), Repeat: math.MaxInt32, Reset: func() {
 			// We don't know how long finishing the
 			// test run would take, so flag that we've seen
 			// an interruption and abort the goroutine.
 			close(errs)
 			runtime.Goexit()
-		})
+		}})
 
 		errs <- err
 	}()
@@ -296,6 +397,35 @@ func TestProgramKernelVersion(t *testing.T) {
 	defer prog.Close()
 }
 
+func TestProgKernelVersion(t *testing.T) {
+	v, err := internal.KernelVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		typ      ProgramType
+		spec     uint32
+		override uint32
+		want     uint32
+	}{
+		{SocketFilter, 0, 42, 0},
+		{Kprobe, 42, 0, 42},
+		{Kprobe, 42, 23, 23},
+		{Kprobe, 0, 0, v.Kernel()},
+		{Kprobe, internal.MagicKernelVersion, 0, v.Kernel()},
+	} {
+		spec := &ProgramSpec{Type: tc.typ, KernelVersion: tc.spec}
+		have, err := progKernelVersion(spec, ProgramOptions{KernelVersion: tc.override})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have != tc.want {
+			t.Errorf("%s with version %#x and override %#x: expected %#x, got %#x", tc.typ, tc.spec, tc.override, tc.want, have)
+		}
+	}
+}
+
 func TestProgramVerifierOutput(t *testing.T) {
 	prog, err := NewProgramWithOptions(socketFilterSpec, ProgramOptions{
 		LogLevel: 2,
@@ -330,6 +460,180 @@ func TestProgramVerifierOutput(t *testing.T) {
 	}
 }
 
+func TestProgramCheckInstructions(t *testing.T) {
+	_, err := NewProgramWithOptions(&ProgramSpec{
+		Type: SocketFilter,
+		Instructions: asm.Instructions{
+			asm.Mov.Reg(asm.R0, asm.R2),
+			asm.Return(),
+		},
+		License: "MIT",
+	}, ProgramOptions{
+		CheckInstructions: true,
+	})
+
+	var diags asm.Diagnostics
+	if !errors.As(err, &diags) {
+		t.Fatal("Expected asm.Diagnostics, got", err)
+	}
+}
+
+func TestProgramBTFInfos(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.0", "BTF func and line info")
+
+	testutils.TestFiles(t, "testdata/raw_tracepoint-*.elf", func(t *testing.T, file string) {
+		spec, err := LoadCollectionSpec(file)
+		if err != nil {
+			t.Fatal("Can't parse ELF:", err)
+		}
+
+		progSpec := spec.Programs["sched_process_exec"]
+		if progSpec.ByteOrder != internal.NativeEndian {
+			return
+		}
+
+		prog, err := NewProgram(progSpec)
+		testutils.SkipIfNotSupported(t, err)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer prog.Close()
+
+		info, err := bpfGetProgInfoByFD(prog.fd)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.btf_id == 0 {
+			t.Error("Program has no BTF")
+		}
+		if info.nr_func_info == 0 {
+			t.Error("Program has no function infos")
+		}
+		if info.nr_line_info == 0 {
+			t.Error("Program has no line infos")
+		}
+	})
+}
+
+func TestProgramExtension(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.6", "BPF_PROG_TYPE_EXT")
+
+	testutils.TestFiles(t, "testdata/loader-clang-11-*.elf", func(t *testing.T, file string) {
+		spec, err := LoadCollectionSpec(file)
+		if err != nil {
+			t.Fatal("Can't parse ELF:", err)
+		}
+
+		if spec.Programs["xdp_prog"].ByteOrder != internal.NativeEndian {
+			return
+		}
+
+		spec.Maps["array_of_hash_map"].InnerMap = spec.Maps["hash_map"]
+		coll, err := NewCollectionWithOptions(spec, CollectionOptions{
+			Maps: MapOptions{PinPath: testutils.TempBPFFS(t)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer coll.Close()
+
+		// no_relocation has the same signature as xdp_prog.
+		ext := spec.Programs["no_relocation"].Copy()
+		ext.Type = Extension
+		ext.AttachTo = "xdp_prog"
+		if _, err := NewProgram(ext); err == nil {
+			t.Error("Extension without target doesn't return an error")
+		}
+
+		ext.AttachTarget = coll.Programs["xdp_prog"]
+		ext.AttachTo = "missing_fn"
+		if _, err := NewProgram(ext); !errors.Is(err, btf.ErrNotFound) {
+			t.Error("Missing target function doesn't return ErrNotFound:", err)
+		}
+
+		ext.AttachTo = "xdp_prog"
+		prog, err := NewProgram(ext)
+		testutils.SkipIfNotSupported(t, err)
+		if errors.Is(err, unix.EPERM) {
+			t.Skip("Insufficient permissions to load extension programs")
+		}
+		if err != nil {
+			t.Fatal("Can't load extension:", err)
+		}
+		prog.Close()
+	})
+}
+
+func TestProgramVerifierErrorLine(t *testing.T) {
+	testutils.TestFiles(t, "testdata/raw_tracepoint-*.elf", func(t *testing.T, file string) {
+		spec, err := LoadCollectionSpec(file)
+		if err != nil {
+			t.Fatal("Can't parse ELF:", err)
+		}
+
+		progSpec := spec.Programs["sched_process_exec"]
+		if progSpec.ByteOrder != internal.NativeEndian {
+			return
+		}
+
+		// Read from an uninitialized register.
+		progSpec.Instructions[0] = asm.Mov.Reg(asm.R0, asm.R5)
+
+		_, err = NewProgram(progSpec)
+		testutils.SkipIfNotSupported(t, err)
+		if err == nil {
+			t.Fatal("Loading an invalid program doesn't fail")
+		}
+
+		if !strings.Contains(err.Error(), "raw_tracepoint.c:12 (return 0;)") {
+			t.Error("Error doesn't contain source line:", err)
+		}
+
+		var ve *internal.VerifierError
+		if !errors.As(err, &ve) {
+			t.Error("Error doesn't wrap VerifierError")
+		}
+	})
+}
+
+func TestProgramKernelTypes(t *testing.T) {
+	fh, err := os.Open("internal/btf/testdata/vmlinux-btf.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+
+	rd, err := gzip.NewReader(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := ioutil.ReadAll(rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kernel, err := btf.LoadRawSpec(bytes.NewReader(buf), binary.LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := resolveBTFType(kernel, "file_open", LSM, AttachLSMMac)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fn, ok := target.(*btf.Func); !ok || fn.Name != "bpf_lsm_file_open" {
+		t.Error("Expected bpf_lsm_file_open, got", target)
+	}
+
+	_, err = resolveBTFType(kernel, "totally_bogus", LSM, AttachLSMMac)
+	if !errors.Is(err, ErrNotSupported) {
+		t.Error("Expected ErrNotSupported for missing hook, got", err)
+	}
+}
+
 func TestProgramName(t *testing.T) {
 	if err := haveObjName(); err != nil {
 		t.Skip(err)
@@ -451,6 +755,10 @@ func TestHaveProgTestRun(t *testing.T) {
 	testutils.CheckFeatureTest(t, haveProgTestRun)
 }
 
+func TestHaveXDPFrags(t *testing.T) {
+	testutils.CheckFeatureTest(t, haveXDPFrags)
+}
+
 func TestProgramGetNextID(t *testing.T) {
 	testutils.SkipOnOldKernel(t, "4.13", "bpf_prog_get_next_id")
 	var next ProgramID
@@ -575,6 +883,29 @@ func TestProgramSpecTag(t *testing.T) {
 	}
 }
 
+func TestProgramSpecCompatible(t *testing.T) {
+	spec := &ProgramSpec{
+		Type: SocketFilter,
+		Instructions: asm.Instructions{
+			asm.Mov.Imm32(asm.R0, 0),
+			asm.Return(),
+		},
+		License: "MIT",
+	}
+
+	prog, err := NewProgram(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer prog.Close()
+
+	other := spec.Copy()
+	other.Type = XDP
+	if err := other.Compatible(prog); !errors.Is(err, ErrProgIncompatible) {
+		t.Error("Expected ErrProgIncompatible for differing type, got", err)
+	}
+}
+
 func TestProgramTypeLSM(t *testing.T) {
 	lsmTests := []struct {
 		attachFn    string
@@ -0,0 +1,175 @@
+package ebpf
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"github.com/cilium/ebpf/internal"
+)
+
+// BPFCommand is a command of the bpf syscall.
+//
+// The values match the BPF_* enum bpf_cmd in the kernel's UAPI, for example
+// BPFCommand(0) is BPF_MAP_CREATE.
+type BPFCommand uint32
+
+func (cmd BPFCommand) String() string {
+	return internal.BPFCmd(cmd).String()
+}
+
+// RawAttr builds a union bpf_attr for RawBPF.
+//
+// Fields are written at byte offsets taken from <linux/bpf.h> in native
+// endianness. Setters return the RawAttr so that calls can be chained.
+// Errors, like writing past the end of the attributes, are deferred until
+// the attributes are passed to RawBPF.
+type RawAttr struct {
+	buf []byte
+	// refs keeps memory referenced by the attributes alive until the
+	// syscall returns, since buf is opaque to the garbage collector.
+	refs [][]byte
+	err  error
+}
+
+// NewRawAttr creates zeroed attributes of the given size.
+//
+// The kernel rejects attributes larger than it knows about unless the
+// excess is zero, so size should be the end of the last field used by the
+// command.
+func NewRawAttr(size int) *RawAttr {
+	if size < 0 {
+		return &RawAttr{err: fmt.Errorf("invalid size %d", size)}
+	}
+	return &RawAttr{buf: make([]byte, size)}
+}
+
+func (ra *RawAttr) field(offset, size, align int) []byte {
+	if ra.err != nil {
+		return nil
+	}
+	if offset < 0 || offset%align != 0 {
+		ra.err = fmt.Errorf("offset %d isn't aligned to %d bytes", offset, align)
+		return nil
+	}
+	if offset+size > len(ra.buf) {
+		ra.err = fmt.Errorf("field at offset %d exceeds size %d", offset, len(ra.buf))
+		return nil
+	}
+	return ra.buf[offset : offset+size]
+}
+
+// SetUint32 writes a __u32 field.
+func (ra *RawAttr) SetUint32(offset int, value uint32) *RawAttr {
+	if field := ra.field(offset, 4, 4); field != nil {
+		internal.NativeEndian.PutUint32(field, value)
+	}
+	return ra
+}
+
+// SetUint64 writes a __u64 field.
+func (ra *RawAttr) SetUint64(offset int, value uint64) *RawAttr {
+	if field := ra.field(offset, 8, 8); field != nil {
+		internal.NativeEndian.PutUint64(field, value)
+	}
+	return ra
+}
+
+// SetFD writes a __u32 field containing a file descriptor, for example
+// the result of Map.FD or Program.FD.
+func (ra *RawAttr) SetFD(offset int, fd int) *RawAttr {
+	if fd < 0 && ra.err == nil {
+		ra.err = fmt.Errorf("offset %d: %w", offset, internal.ErrClosedFd)
+		return ra
+	}
+	return ra.SetUint32(offset, uint32(fd))
+}
+
+// SetPointer writes an aligned __u64 field pointing at buf.
+//
+// The kernel may read from or write to buf during the syscall, depending on
+// the command. buf mustn't be modified concurrently. A nil or empty buf
+// writes a NULL pointer.
+func (ra *RawAttr) SetPointer(offset int, buf []byte) *RawAttr {
+	if len(buf) == 0 {
+		return ra.SetUint64(offset, 0)
+	}
+
+	ra.refs = append(ra.refs, buf)
+	return ra.SetUint64(offset, uint64(uintptr(unsafe.Pointer(&buf[0]))))
+}
+
+// SetString writes an aligned __u64 field pointing at a NUL terminated copy
+// of str.
+func (ra *RawAttr) SetString(offset int, str string) *RawAttr {
+	for i := 0; i < len(str); i++ {
+		if str[i] == 0 && ra.err == nil {
+			ra.err = fmt.Errorf("offset %d: string contains NUL byte", offset)
+			return ra
+		}
+	}
+	return ra.SetPointer(offset, append([]byte(str), 0))
+}
+
+// SetName writes a char[BPF_OBJ_NAME_LEN] field, like the name of a map or
+// program. Names which are too long are truncated.
+func (ra *RawAttr) SetName(offset int, name string) *RawAttr {
+	objName := newBPFObjName(name)
+	if field := ra.field(offset, len(objName), 1); field != nil {
+		copy(field, objName[:])
+	}
+	return ra
+}
+
+// Uint32 reads a __u32 field, for example one written by the kernel.
+func (ra *RawAttr) Uint32(offset int) uint32 {
+	if offset < 0 || offset+4 > len(ra.buf) {
+		return 0
+	}
+	return internal.NativeEndian.Uint32(ra.buf[offset:])
+}
+
+// Uint64 reads a __u64 field, for example one written by the kernel.
+func (ra *RawAttr) Uint64(offset int) uint64 {
+	if offset < 0 || offset+8 > len(ra.buf) {
+		return 0
+	}
+	return internal.NativeEndian.Uint64(ra.buf[offset:])
+}
+
+// Bytes returns the encoded attributes.
+func (ra *RawAttr) Bytes() []byte {
+	return ra.buf
+}
+
+// RawBPF invokes the bpf syscall with cmd and attr.
+//
+// It allows using commands or fields which aren't wrapped by this package
+// yet. Prefer the typed API where possible: the kernel can't validate
+// most of attr, and passing the wrong pointer or file descriptor can
+// corrupt memory or resources of the process.
+//
+// Returns the result of the syscall, which is a new file descriptor for
+// some commands. The caller is responsible for closing it, for example by
+// using NewMapFromFD. Errors wrap the errno returned by the kernel.
+func RawBPF(cmd BPFCommand, attr *RawAttr) (int, error) {
+	if attr == nil {
+		return 0, errors.New("missing attributes")
+	}
+	if attr.err != nil {
+		return 0, fmt.Errorf("%s: invalid attributes: %w", cmd, attr.err)
+	}
+
+	var ptr unsafe.Pointer
+	if len(attr.buf) > 0 {
+		ptr = unsafe.Pointer(&attr.buf[0])
+	}
+
+	ret, err := internal.BPF(internal.BPFCmd(cmd), ptr, uintptr(len(attr.buf)))
+	runtime.KeepAlive(attr)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", cmd, err)
+	}
+	return int(ret), nil
+}
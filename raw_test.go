@@ -0,0 +1,110 @@
+package ebpf
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/testutils"
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+func TestRawBPF(t *testing.T) {
+	const (
+		mapCreate     BPFCommand = 0
+		mapUpdateElem BPFCommand = 2
+	)
+
+	if mapCreate.String() != "BPF_MAP_CREATE" {
+		t.Error("Unexpected name of command 0:", mapCreate)
+	}
+
+	fd, err := RawBPF(mapCreate, NewRawAttr(44).
+		SetUint32(0, uint32(Hash)).
+		SetUint32(4, 4).
+		SetUint32(8, 4).
+		SetUint32(12, 1).
+		SetName(28, "raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewMapFromFD(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if m.Type() != Hash || m.KeySize() != 4 || m.MaxEntries() != 1 {
+		t.Error("Map doesn't match the attributes:", m)
+	}
+
+	key := make([]byte, 4)
+	value := make([]byte, 4)
+	internal.NativeEndian.PutUint32(key, 1)
+	internal.NativeEndian.PutUint32(value, 42)
+
+	_, err = RawBPF(mapUpdateElem, NewRawAttr(32).
+		SetFD(0, m.FD()).
+		SetPointer(8, key).
+		SetPointer(16, value))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var have uint32
+	if err := m.Lookup(uint32(1), &have); err != nil || have != 42 {
+		t.Error("Element wasn't updated:", have, err)
+	}
+
+	_, err = RawBPF(mapUpdateElem, NewRawAttr(32).
+		SetFD(0, m.FD()).
+		SetPointer(8, key).
+		SetPointer(16, value).
+		SetUint64(24, uint64(UpdateNoExist)))
+	if !errors.Is(err, unix.EEXIST) {
+		t.Error("Expected EEXIST when creating an existing element, got", err)
+	}
+}
+
+func TestRawBPFLargeAttr(t *testing.T) {
+	sr := testutils.RecordSyscalls(t)
+	sr.Return(internal.BPF_PROG_LOAD, 0, unix.EINVAL)
+
+	attr := NewRawAttr(70000).SetUint32(69996, 0xffffffff)
+	if _, err := RawBPF(BPFCommand(internal.BPF_PROG_LOAD), attr); !errors.Is(err, unix.EINVAL) {
+		t.Fatal("Expected scripted EINVAL, got", err)
+	}
+
+	calls := sr.CallsTo(internal.BPF_PROG_LOAD)
+	if len(calls) != 1 {
+		t.Fatalf("Expected one call, got %d", len(calls))
+	}
+	if buf := calls[0].Attr; len(buf) != 70000 || buf[69999] != 0xff {
+		t.Error("Recorder doesn't copy all 70000 bytes of the attributes")
+	}
+}
+
+func TestRawAttrInvalid(t *testing.T) {
+	for name, attr := range map[string]*RawAttr{
+		"out of bounds": NewRawAttr(8).SetUint64(8, 1),
+		"unaligned":     NewRawAttr(8).SetUint32(2, 1),
+		"closed fd":     NewRawAttr(8).SetFD(0, -1),
+		"nul in string": NewRawAttr(8).SetString(0, "a\x00b"),
+		"long name":     NewRawAttr(20).SetName(8, "name"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := RawBPF(0, attr); err == nil {
+				t.Error("RawBPF doesn't reject invalid attributes")
+			}
+		})
+	}
+
+	attr := NewRawAttr(8).SetUint32(0, 1)
+	if v := attr.Uint32(0); v != 1 {
+		t.Error("Uint32 returns", v)
+	}
+	if v := attr.Uint64(8); v != 0 {
+		t.Error("Uint64 out of bounds returns", v)
+	}
+}
@@ -0,0 +1,368 @@
+package ringbuf
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+var errClosed = errors.New("ringbuf reader was closed")
+
+// Record contains a sample from the ring buffer.
+type Record struct {
+	RawSample []byte
+}
+
+// Reader allows reading bpf_ringbuf_output from user space.
+type Reader struct {
+	// mu protects read/write access to the Reader structure.
+	mu sync.Mutex
+
+	// Keep a reference to the map alive while reading.
+	ringbufMap *ebpf.Map
+	ring       *ringbufEventRing
+
+	epollFd     int
+	epollEvents []unix.EpollEvent
+	// Eventfd for closing
+	closeFd int
+	// Ensure we only close once
+	closeOnce sync.Once
+
+	// deadlineFd is an eventfd used to interrupt Read when the deadline
+	// changes. deadlineMu protects both it and deadline, since they are
+	// accessed while Read holds mu.
+	deadlineMu sync.Mutex
+	deadline   time.Time
+	deadlineFd int
+}
+
+// NewReader creates a new BPF ringbuf reader.
+//
+// ringbufMap must be a RingBuf.
+func NewReader(ringbufMap *ebpf.Map) (r *Reader, err error) {
+	if ringbufMap.Type() != ebpf.RingBuf {
+		return nil, fmt.Errorf("invalid map type: %s", ringbufMap.Type())
+	}
+
+	maxEntries := int(ringbufMap.MaxEntries())
+	if maxEntries == 0 || (maxEntries&(maxEntries-1)) != 0 {
+		return nil, fmt.Errorf("ringbuffer map size %d is zero or not a power of two", maxEntries)
+	}
+
+	epollFd, err := unix.EpollCreate1(unix.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("can't create epoll fd: %w", err)
+	}
+
+	fds := []int{epollFd}
+	defer func() {
+		if err != nil {
+			for _, fd := range fds {
+				unix.Close(fd)
+			}
+		}
+	}()
+
+	if err := addToEpoll(epollFd, ringbufMap.FD()); err != nil {
+		return nil, err
+	}
+
+	closeFd, err := unix.Eventfd(0, unix.O_CLOEXEC|unix.O_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	fds = append(fds, closeFd)
+
+	if err := addToEpoll(epollFd, closeFd); err != nil {
+		return nil, err
+	}
+
+	deadlineFd, err := unix.Eventfd(0, unix.O_CLOEXEC|unix.O_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	fds = append(fds, deadlineFd)
+
+	if err := addToEpoll(epollFd, deadlineFd); err != nil {
+		return nil, err
+	}
+
+	ringbufMap, err = ringbufMap.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	ring, err := newRingBufEventRing(ringbufMap.FD(), maxEntries)
+	if err != nil {
+		ringbufMap.Close()
+		return nil, fmt.Errorf("failed to create ringbuf ring: %w", err)
+	}
+
+	r = &Reader{
+		ringbufMap:  ringbufMap,
+		ring:        ring,
+		epollFd:     epollFd,
+		epollEvents: make([]unix.EpollEvent, 3),
+		closeFd:     closeFd,
+		deadlineFd:  deadlineFd,
+	}
+	runtime.SetFinalizer(r, (*Reader).Close)
+	return r, nil
+}
+
+func addToEpoll(epollFd, fd int) error {
+	event := unix.EpollEvent{
+		Events: unix.EPOLLIN,
+		Fd:     int32(fd),
+	}
+
+	if err := unix.EpollCtl(epollFd, unix.EPOLL_CTL_ADD, fd, &event); err != nil {
+		return fmt.Errorf("can't add fd to epoll: %w", err)
+	}
+	return nil
+}
+
+// Close frees resources used by the reader.
+//
+// It interrupts calls to Read and Consumer.Run.
+func (r *Reader) Close() error {
+	var err error
+	r.closeOnce.Do(func() {
+		runtime.SetFinalizer(r, nil)
+
+		// Interrupt Read() via the event fd.
+		var value [8]byte
+		internal.NativeEndian.PutUint64(value[:], 1)
+		if _, err = unix.Write(r.closeFd, value[:]); err != nil {
+			err = fmt.Errorf("can't write event fd: %w", err)
+			return
+		}
+
+		// Acquire the lock. This ensures that Read isn't running.
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		unix.Close(r.epollFd)
+		unix.Close(r.closeFd)
+		r.epollFd, r.closeFd = -1, -1
+
+		r.deadlineMu.Lock()
+		unix.Close(r.deadlineFd)
+		r.deadlineFd = -1
+		r.deadlineMu.Unlock()
+
+		r.ring.Close()
+		r.ring = nil
+
+		r.ringbufMap.Close()
+	})
+	if err != nil {
+		return fmt.Errorf("close ringbuf reader: %w", err)
+	}
+	return nil
+}
+
+// Read the next record from the BPF ringbuf.
+//
+// Calling Close interrupts the function. Returns an error wrapping
+// os.ErrDeadlineExceeded if the deadline set by SetDeadline passes.
+func (r *Reader) Read() (Record, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.epollFd == -1 {
+		return Record{}, errClosed
+	}
+
+	for {
+		if sample := r.ring.next(); sample != nil {
+			record := Record{RawSample: append([]byte(nil), sample...)}
+			r.ring.commit()
+			return record, nil
+		}
+
+		if r.ring.loadProducer() {
+			continue
+		}
+
+		if err := r.wait(); err != nil {
+			return Record{}, err
+		}
+	}
+}
+
+// wait blocks until the ring buffer has data, the reader is closed or the
+// deadline passes.
+//
+// The caller must hold mu.
+func (r *Reader) wait() error {
+	for {
+		timeout, err := r.epollTimeout()
+		if err != nil {
+			return err
+		}
+
+		nEvents, err := unix.EpollWait(r.epollFd, r.epollEvents, timeout)
+		if temp, ok := err.(temporaryError); ok && temp.Temporary() {
+			// Retry the syscall if we we're interrupted, see https://github.com/golang/go/issues/20400
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		ready := false
+		for _, event := range r.epollEvents[:nEvents] {
+			switch int(event.Fd) {
+			case r.closeFd:
+				return errClosed
+
+			case r.deadlineFd:
+				// The deadline changed, drain the eventfd and
+				// recompute the timeout.
+				var value [8]byte
+				_, _ = unix.Read(r.deadlineFd, value[:])
+
+			default:
+				ready = true
+			}
+		}
+
+		if ready {
+			return nil
+		}
+		// Either the deadline changed or it has passed.
+	}
+}
+
+// SetDeadline controls how long Read blocks waiting for records.
+//
+// A Read which is blocked at the time of the call observes the new
+// deadline. Passing the zero time.Time removes the deadline.
+func (r *Reader) SetDeadline(t time.Time) {
+	r.deadlineMu.Lock()
+	defer r.deadlineMu.Unlock()
+
+	r.deadline = t
+
+	if r.deadlineFd == -1 {
+		return
+	}
+
+	// Interrupt Read() so that it picks up the new deadline.
+	var value [8]byte
+	internal.NativeEndian.PutUint64(value[:], 1)
+	_, _ = unix.Write(r.deadlineFd, value[:])
+}
+
+// epollTimeout returns the timeout for epoll_wait in milliseconds, based
+// on the deadline.
+func (r *Reader) epollTimeout() (int, error) {
+	r.deadlineMu.Lock()
+	defer r.deadlineMu.Unlock()
+
+	if r.deadline.IsZero() {
+		return -1, nil
+	}
+
+	left := time.Until(r.deadline)
+	if left <= 0 {
+		return 0, fmt.Errorf("ringbuf reader: %w", os.ErrDeadlineExceeded)
+	}
+
+	// Round up, otherwise epoll_wait returns shortly before the deadline.
+	msecs := (left + time.Millisecond - 1) / time.Millisecond
+	if msecs > math.MaxInt32 {
+		msecs = math.MaxInt32
+	}
+	return int(msecs), nil
+}
+
+// Consumer invokes a callback for every record in a ring buffer.
+//
+// All records available after a wakeup are processed as a batch, and
+// their space is returned to the kernel once the batch is done. This is
+// cheaper than Reader.Read, which copies each record and returns its
+// space individually.
+type Consumer struct {
+	rd *Reader
+	fn func(sample []byte) error
+}
+
+// NewConsumer creates a Consumer for a ring buffer.
+//
+// ringbufMap must be a RingBuf. fn is called with each record. The
+// sample aliases the ring buffer and is only valid until fn returns.
+func NewConsumer(ringbufMap *ebpf.Map, fn func(sample []byte) error) (*Consumer, error) {
+	if fn == nil {
+		return nil, errors.New("callback is nil")
+	}
+
+	rd, err := NewReader(ringbufMap)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Consumer{rd, fn}, nil
+}
+
+// Run processes records until the Consumer is closed or the callback
+// returns an error.
+//
+// Returns nil if Close interrupts Run, and the error returned by the
+// callback otherwise. The record which caused the error is not processed
+// again.
+func (c *Consumer) Run() error {
+	c.rd.mu.Lock()
+	defer c.rd.mu.Unlock()
+
+	if c.rd.epollFd == -1 {
+		return errClosed
+	}
+
+	for {
+		// Only process records which are present now, otherwise a fast
+		// producer keeps the batch from ending.
+		c.rd.ring.loadProducer()
+		for sample := c.rd.ring.next(); sample != nil; sample = c.rd.ring.next() {
+			if err := c.fn(sample); err != nil {
+				c.rd.ring.commit()
+				return err
+			}
+		}
+		c.rd.ring.commit()
+
+		if err := c.rd.wait(); errors.Is(err, errClosed) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// Close stops the Consumer and frees its resources.
+//
+// It interrupts Run, but waits for a running callback to return.
+func (c *Consumer) Close() error {
+	return c.rd.Close()
+}
+
+type temporaryError interface {
+	Temporary() bool
+}
+
+// IsClosed returns true if the error occurred because
+// a Reader was closed.
+func IsClosed(err error) bool {
+	return errors.Is(err, errClosed)
+}
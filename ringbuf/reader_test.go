@@ -0,0 +1,326 @@
+package ringbuf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/testutils"
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+var readTimeout = 250 * time.Millisecond
+
+func TestMain(m *testing.M) {
+	err := unix.Setrlimit(unix.RLIMIT_MEMLOCK, &unix.Rlimit{
+		Cur: unix.RLIM_INFINITY,
+		Max: unix.RLIM_INFINITY,
+	})
+	if err != nil {
+		fmt.Println("WARNING: Failed to adjust rlimit, tests may fail")
+	}
+	os.Exit(m.Run())
+}
+
+func TestRingbufReader(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.8", "BPF ring buffer")
+
+	prog, events := mustOutputSamplesProg(t, 5, 0, 13)
+	defer prog.Close()
+	defer events.Close()
+
+	rd, err := NewReader(events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+
+	mustRun(t, prog)
+
+	for _, size := range []int{5, 0, 13} {
+		record, err := rd.Read()
+		if err != nil {
+			t.Fatal("Can't read samples:", err)
+		}
+
+		if want := sample[:size]; !bytes.Equal(record.RawSample, want) {
+			t.Errorf("Expected sample %v, got %v", want, record.RawSample)
+		}
+	}
+}
+
+func TestRingbufReaderClose(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.8", "BPF ring buffer")
+
+	_, events := mustOutputSamplesProg(t, 5)
+	defer events.Close()
+
+	rd, err := NewReader(events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+
+	errs := make(chan error, 1)
+	waiting := make(chan struct{})
+	go func() {
+		close(waiting)
+		_, err := rd.Read()
+		errs <- err
+	}()
+
+	<-waiting
+
+	// Close should interrupt Read
+	if err := rd.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-errs:
+		if !IsClosed(err) {
+			t.Fatal("Expected IsClosed error, got", err)
+		}
+	case <-time.After(readTimeout):
+		t.Fatal("Close doesn't interrupt Read")
+	}
+
+	if _, err := rd.Read(); !IsClosed(err) {
+		t.Fatal("Read on a closed reader doesn't return an IsClosed error")
+	}
+}
+
+func TestRingbufReaderDeadline(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.8", "BPF ring buffer")
+
+	prog, events := mustOutputSamplesProg(t, 5)
+	defer prog.Close()
+	defer events.Close()
+
+	rd, err := NewReader(events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+
+	rd.SetDeadline(time.Now().Add(-time.Second))
+	if _, err := rd.Read(); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatal("Expected os.ErrDeadlineExceeded from expired deadline, got", err)
+	}
+
+	rd.SetDeadline(time.Time{})
+
+	errs := make(chan error, 1)
+	waiting := make(chan struct{})
+	go func() {
+		close(waiting)
+		_, err := rd.Read()
+		errs <- err
+	}()
+
+	<-waiting
+
+	// Setting a deadline should interrupt Read
+	rd.SetDeadline(time.Now().Add(10 * time.Millisecond))
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatal("Expected os.ErrDeadlineExceeded, got", err)
+		}
+	case <-time.After(readTimeout):
+		t.Fatal("SetDeadline doesn't interrupt Read")
+	}
+
+	rd.SetDeadline(time.Now().Add(readTimeout))
+	mustRun(t, prog)
+
+	if _, err := rd.Read(); err != nil {
+		t.Fatal("Can't read sample before deadline:", err)
+	}
+}
+
+func TestRingReaderBatch(t *testing.T) {
+	var (
+		ring       = make([]byte, 2*64)
+		cons, prod uintptr
+	)
+
+	write := func(size int) {
+		internal.NativeEndian.PutUint32(ring[prod:], uint32(size))
+		prod += uintptr(ringbufHeaderSize+size+7) &^ 7
+	}
+
+	rr := newRingReader(&cons, &prod, ring)
+	write(1)
+	if !rr.loadProducer() {
+		t.Fatal("loadProducer doesn't find new record")
+	}
+
+	// Records written during a batch aren't part of it.
+	write(2)
+	if sample := rr.next(); len(sample) != 1 {
+		t.Fatalf("Expected sample of size 1, got %v", sample)
+	}
+	if sample := rr.next(); sample != nil {
+		t.Fatalf("Expected end of batch, got %v", sample)
+	}
+
+	if !rr.loadProducer() {
+		t.Fatal("loadProducer doesn't find new record")
+	}
+	if sample := rr.next(); len(sample) != 2 {
+		t.Fatalf("Expected sample of size 2, got %v", sample)
+	}
+	if rr.loadProducer() {
+		t.Fatal("loadProducer returns true without new records")
+	}
+
+	rr.commit()
+	if cons != prod {
+		t.Errorf("Expected consumer position %d, got %d", prod, cons)
+	}
+}
+
+func TestConsumer(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.8", "BPF ring buffer")
+
+	prog, events := mustOutputSamplesProg(t, 1, 2, 3)
+	defer prog.Close()
+	defer events.Close()
+
+	var (
+		sizes   []int
+		errStop = errors.New("stop")
+	)
+	c, err := NewConsumer(events, func(sample []byte) error {
+		sizes = append(sizes, len(sample))
+		if len(sizes) == 4 {
+			return errStop
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	mustRun(t, prog)
+	mustRun(t, prog)
+
+	if err := c.Run(); !errors.Is(err, errStop) {
+		t.Fatal("Expected the callback's error, got", err)
+	}
+
+	if want := []int{1, 2, 3, 1}; !equalInts(sizes, want) {
+		t.Fatalf("Expected samples of size %v, got %v", want, sizes)
+	}
+
+	// Run picks up where it stopped.
+	errs := make(chan error, 1)
+	go func() {
+		errs <- c.Run()
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatal("Expected nil after Close, got", err)
+		}
+	case <-time.After(readTimeout):
+		t.Fatal("Close doesn't interrupt Run")
+	}
+
+	if want := []int{1, 2, 3, 1, 2, 3}; !equalInts(sizes, want) {
+		t.Fatalf("Expected samples of size %v, got %v", want, sizes)
+	}
+}
+
+var sample = []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+
+func mustOutputSamplesProg(tb testing.TB, sampleSizes ...int) (*ebpf.Program, *ebpf.Map) {
+	tb.Helper()
+
+	events, err := ebpf.NewMap(&ebpf.MapSpec{
+		Type:       ebpf.RingBuf,
+		MaxEntries: 4096,
+	})
+	testutils.SkipIfNotSupported(tb, err)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	// Copy sample to the stack.
+	insns := asm.Instructions{
+		asm.LoadImm(asm.R0, int64(internal.NativeEndian.Uint64(sample[:8])), asm.DWord),
+		asm.StoreMem(asm.RFP, -16, asm.R0, asm.DWord),
+		asm.LoadImm(asm.R0, int64(internal.NativeEndian.Uint64(sample[8:])), asm.DWord),
+		asm.StoreMem(asm.RFP, -8, asm.R0, asm.DWord),
+	}
+
+	for _, sampleSize := range sampleSizes {
+		insns = append(insns,
+			asm.LoadMapPtr(asm.R1, events.FD()),
+			asm.Mov.Reg(asm.R2, asm.RFP),
+			asm.Add.Imm(asm.R2, -16),
+			asm.Mov.Imm(asm.R3, int32(sampleSize)),
+			asm.Mov.Imm(asm.R4, 0),
+			asm.FnRingbufOutput.Call(),
+		)
+	}
+
+	insns = append(insns,
+		asm.Mov.Imm(asm.R0, 0),
+		asm.Return(),
+	)
+
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		License:      "MIT",
+		Type:         ebpf.XDP,
+		Instructions: insns,
+	})
+	if err != nil {
+		events.Close()
+		tb.Fatal(err)
+	}
+
+	return prog, events
+}
+
+func mustRun(tb testing.TB, prog *ebpf.Program) {
+	tb.Helper()
+
+	ret, _, err := prog.Test(make([]byte, 14))
+	testutils.SkipIfNotSupported(tb, err)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	if errno := syscall.Errno(-int32(ret)); errno != 0 {
+		tb.Fatal("Expected 0 as return value, got", errno)
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
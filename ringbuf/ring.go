@@ -0,0 +1,143 @@
+package ringbuf
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+// Flags in the length field of a record header, see
+// BPF_RINGBUF_BUSY_BIT and BPF_RINGBUF_DISCARD_BIT.
+const (
+	ringbufBusyBit    = 1 << 31
+	ringbufDiscardBit = 1 << 30
+	ringbufHeaderSize = 8
+)
+
+// ringbufEventRing is the memory shared with the kernel: a read-write page
+// holding the consumer position, followed by a read-only page holding the
+// producer position and the data pages. The data pages are mapped twice
+// in a row, so that records wrapping around the end of the ring can be
+// accessed without copying.
+type ringbufEventRing struct {
+	cons []byte
+	prod []byte
+	*ringReader
+}
+
+func newRingBufEventRing(mapFD, size int) (*ringbufEventRing, error) {
+	pageSize := os.Getpagesize()
+
+	cons, err := unix.Mmap(mapFD, 0, pageSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("can't mmap consumer page: %w", err)
+	}
+
+	prod, err := unix.Mmap(mapFD, int64(pageSize), pageSize+2*size, unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		_ = unix.Munmap(cons)
+		return nil, fmt.Errorf("can't mmap data pages: %w", err)
+	}
+
+	consPos := (*uintptr)(unsafe.Pointer(&cons[0]))
+	prodPos := (*uintptr)(unsafe.Pointer(&prod[0]))
+
+	ring := &ringbufEventRing{
+		cons:       cons,
+		prod:       prod,
+		ringReader: newRingReader(consPos, prodPos, prod[pageSize:]),
+	}
+	runtime.SetFinalizer(ring, (*ringbufEventRing).Close)
+
+	return ring, nil
+}
+
+func (ring *ringbufEventRing) Close() {
+	runtime.SetFinalizer(ring, nil)
+
+	_ = unix.Munmap(ring.prod)
+	_ = unix.Munmap(ring.cons)
+
+	ring.prod = nil
+	ring.cons = nil
+}
+
+type ringReader struct {
+	// These point into the mmap'ed consumer and producer pages.
+	consPos, prodPos *uintptr
+	// The position up to which records have been processed. This may
+	// be ahead of *consPos until commit is called.
+	cons uintptr
+	// The producer position at the time of the last loadProducer. Records
+	// past it aren't returned, so that a fast producer can't keep a batch
+	// going forever.
+	prod uintptr
+	mask uintptr
+	ring []byte
+}
+
+func newRingReader(consPos, prodPos *uintptr, ring []byte) *ringReader {
+	return &ringReader{
+		consPos: consPos,
+		prodPos: prodPos,
+		cons:    atomic.LoadUintptr(consPos),
+		prod:    atomic.LoadUintptr(prodPos),
+		// cap(ring) is twice the size of the ring buffer, which is
+		// always a power of two.
+		mask: uintptr(cap(ring)/2 - 1),
+		ring: ring,
+	}
+}
+
+// loadProducer makes records written since the last call available to
+// next. Returns true if there are new records.
+func (rr *ringReader) loadProducer() bool {
+	prod := atomic.LoadUintptr(rr.prodPos)
+	if prod == rr.prod {
+		return false
+	}
+
+	rr.prod = prod
+	return true
+}
+
+// next returns the next record in the ring, or nil if no record is
+// available up to the position read by loadProducer. A record which is
+// still being written by the kernel blocks all following records.
+//
+// The returned slice aliases the ring and is only valid until commit is
+// called.
+func (rr *ringReader) next() []byte {
+	for {
+		if rr.cons >= rr.prod {
+			return nil
+		}
+
+		start := rr.cons & rr.mask
+		header := (*uint32)(unsafe.Pointer(&rr.ring[start]))
+		length := atomic.LoadUint32(header)
+		if length&ringbufBusyBit != 0 {
+			return nil
+		}
+
+		dataLen := uintptr(length &^ (ringbufBusyBit | ringbufDiscardBit))
+		rr.cons += (ringbufHeaderSize + dataLen + 7) &^ 7
+
+		if length&ringbufDiscardBit != 0 {
+			continue
+		}
+
+		start += ringbufHeaderSize
+		return rr.ring[start : start+dataLen : start+dataLen]
+	}
+}
+
+// commit makes the space of all records returned by next available to
+// the kernel again.
+func (rr *ringReader) commit() {
+	atomic.StoreUintptr(rr.consPos, rr.cons)
+}
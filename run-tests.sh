@@ -26,6 +26,7 @@ if [[ "${1:-}" = "--in-vm" ]]; then
 
   echo Running tests...
   go test -v -coverpkg=./... -coverprofile="$output/coverage.txt" -count 1 ./...
+  (cd testrun/gopackettest && go test -v -count 1 ./...)
   touch "$output/success"
   exit 0
 fi
@@ -33,6 +34,7 @@ fi
 # Pull all dependencies, so that we can run tests without the
 # vm having network access.
 go mod download
+(cd testrun/gopackettest && go mod download)
 
 # Use sudo if /dev/kvm isn't accessible by the current user.
 sudo=""
@@ -0,0 +1,181 @@
+package ebpf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+// SnapshotOptions control Map.Snapshot.
+type SnapshotOptions struct {
+	// Freeze the map before dumping it, which prevents further updates
+	// from user space. BPF programs can still modify the map.
+	//
+	// Freezing is permanent.
+	Freeze bool
+
+	// The number of times the map is dumped while looking for two
+	// consecutive identical dumps. Defaults to 5.
+	Attempts int
+}
+
+// Snapshot returns a point-in-time copy of the contents of a map.
+//
+// The map is dumped repeatedly until two consecutive dumps are identical,
+// which means that no writes happened in between. Hash maps are dumped
+// using the batch API if available, which is retried if the kernel
+// returns EBUSY or ENOSPC.
+//
+// The copy supports the same types as MemoryMap. Returns an error wrapping
+// ErrIterationAborted if no consistent dump was obtained.
+func (m *Map) Snapshot(opts *SnapshotOptions) (*MemoryMap, error) {
+	if opts == nil {
+		opts = new(SnapshotOptions)
+	}
+
+	attempts := opts.Attempts
+	if attempts <= 0 {
+		attempts = 5
+	}
+
+	snapshot, err := NewMemoryMap(&MapSpec{
+		Type:       m.typ,
+		KeySize:    m.keySize,
+		ValueSize:  m.valueSize,
+		MaxEntries: m.maxEntries,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("snapshot: %w", err)
+	}
+
+	if opts.Freeze {
+		if err := m.Freeze(); err != nil {
+			return nil, fmt.Errorf("snapshot: %w", err)
+		}
+	}
+
+	var prev []rawEntry
+	for i := 0; i < attempts; i++ {
+		entries, err := m.dump()
+		if err != nil {
+			return nil, fmt.Errorf("snapshot: %w", err)
+		}
+
+		if i > 0 && equalEntries(prev, entries) {
+			for _, entry := range entries {
+				snapshot.putRaw(entry.key, entry.value)
+			}
+			return snapshot, nil
+		}
+
+		prev = entries
+	}
+
+	return nil, fmt.Errorf("snapshot: map changed during %d dumps: %w", attempts, ErrIterationAborted)
+}
+
+type rawEntry struct {
+	key, value []byte
+}
+
+func equalEntries(a, b []rawEntry) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !bytes.Equal(a[i].key, b[i].key) || !bytes.Equal(a[i].value, b[i].value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// dump returns all entries of a map, in the order they are returned by
+// the kernel.
+func (m *Map) dump() ([]rawEntry, error) {
+	if (m.typ == Hash || m.typ == LRUHash) && haveBatchAPI() == nil {
+		return m.dumpBatch()
+	}
+
+	var (
+		entries []rawEntry
+		prev    interface{}
+	)
+	for {
+		key := make([]byte, m.keySize)
+		err := m.nextKey(prev, internal.NewSlicePointer(key))
+		if errors.Is(err, ErrKeyNotExist) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		value := make([]byte, m.fullValueSize)
+		err = bpfMapLookupElem(m.fd, internal.NewSlicePointer(key), internal.NewSlicePointer(value), 0)
+		if errors.Is(err, ErrKeyNotExist) {
+			// Deleted concurrently, the next dump won't match.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, rawEntry{key, value})
+		prev = key
+	}
+}
+
+func (m *Map) dumpBatch() ([]rawEntry, error) {
+	var (
+		entries  []rawEntry
+		count    = 256
+		busy     int
+		inBatch  internal.Pointer
+		outBatch = makeBatchCursor(m.keySize)
+	)
+	for {
+		keys := make([]byte, count*int(m.keySize))
+		values := make([]byte, count*m.fullValueSize)
+
+		n, err := bpfMapBatch(internal.BPF_MAP_LOOKUP_BATCH, m.fd, inBatch, internal.NewSlicePointer(outBatch),
+			internal.NewSlicePointer(keys), internal.NewSlicePointer(values), uint32(count), nil)
+		if errors.Is(err, unix.ENOSPC) {
+			// A bucket holds more elements than fit into the buffer.
+			count *= 2
+			continue
+		}
+		if errors.Is(err, unix.EBUSY) {
+			// A bucket is locked by a concurrent update.
+			busy++
+			if busy < internal.MaxSyscallRetries {
+				continue
+			}
+			return nil, fmt.Errorf("map busy after %d attempts: %w", busy, err)
+		}
+		busy = 0
+
+		done := errors.Is(err, ErrKeyNotExist)
+		if err != nil && !done {
+			return nil, err
+		}
+
+		for i := 0; i < int(n); i++ {
+			entries = append(entries, rawEntry{
+				keys[i*int(m.keySize) : (i+1)*int(m.keySize)],
+				values[i*m.fullValueSize : (i+1)*m.fullValueSize],
+			})
+		}
+
+		if done {
+			return entries, nil
+		}
+
+		inBatch = internal.NewSlicePointer(append([]byte(nil), outBatch...))
+	}
+}
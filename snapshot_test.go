@@ -0,0 +1,125 @@
+package ebpf
+
+import (
+	"testing"
+
+	"github.com/cilium/ebpf/internal/testutils"
+)
+
+func TestMapSnapshot(t *testing.T) {
+	for _, typ := range []MapType{Hash, Array} {
+		t.Run(typ.String(), func(t *testing.T) {
+			m, err := NewMap(&MapSpec{
+				Type:       typ,
+				KeySize:    4,
+				ValueSize:  4,
+				MaxEntries: 1000,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer m.Close()
+
+			for i := uint32(0); i < 1000; i++ {
+				if err := m.Put(i, i+1); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			snapshot, err := m.Snapshot(nil)
+			if err != nil {
+				t.Fatal("Can't snapshot map:", err)
+			}
+
+			if err := m.Put(uint32(0), uint32(42)); err != nil {
+				t.Fatal(err)
+			}
+
+			for i := uint32(0); i < 1000; i++ {
+				var value uint32
+				if err := snapshot.Lookup(i, &value); err != nil {
+					t.Fatalf("Key %d is missing from snapshot: %s", i, err)
+				}
+				if value != i+1 {
+					t.Fatalf("Expected value %d for key %d, got %d", i+1, i, value)
+				}
+			}
+		})
+	}
+}
+
+func TestMapSnapshotSmallKey(t *testing.T) {
+	// Batch lookups write a u32 cursor for hash maps, which is larger
+	// than the key.
+	m, err := NewMap(&MapSpec{
+		Type:       Hash,
+		KeySize:    2,
+		ValueSize:  4,
+		MaxEntries: 300,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	for i := uint16(0); i < 300; i++ {
+		if err := m.Put(i, uint32(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snapshot, err := m.Snapshot(nil)
+	if err != nil {
+		t.Fatal("Can't snapshot map:", err)
+	}
+
+	for i := uint16(0); i < 300; i++ {
+		var value uint32
+		if err := snapshot.Lookup(i, &value); err != nil {
+			t.Fatalf("Key %d is missing from snapshot: %s", i, err)
+		}
+		if value != uint32(i) {
+			t.Fatalf("Expected value %d for key %d, got %d", i, i, value)
+		}
+	}
+}
+
+func TestMapSnapshotFreeze(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.2", "BPF_MAP_FREEZE")
+
+	m := createHash()
+	defer m.Close()
+
+	if err := m.Put("hello", uint32(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := m.Snapshot(&SnapshotOptions{Freeze: true})
+	if err != nil {
+		t.Fatal("Can't snapshot map:", err)
+	}
+
+	var value uint32
+	if err := snapshot.Lookup("hello", &value); err != nil || value != 1 {
+		t.Error("Snapshot doesn't contain the map's contents:", value, err)
+	}
+
+	if err := m.Put("world", uint32(2)); err == nil {
+		t.Error("Map isn't frozen")
+	}
+}
+
+func TestEqualEntries(t *testing.T) {
+	a := []rawEntry{{[]byte{1}, []byte{2}}}
+	b := []rawEntry{{[]byte{1}, []byte{3}}}
+
+	if !equalEntries(a, a) {
+		t.Error("Identical dumps aren't equal")
+	}
+	if equalEntries(a, b) {
+		t.Error("Dumps with different values are equal")
+	}
+	if equalEntries(a, nil) {
+		t.Error("Dumps with different lengths are equal")
+	}
+}
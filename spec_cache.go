@@ -0,0 +1,530 @@
+package ebpf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/btf"
+)
+
+// specCacheVersion is incremented whenever the encoding of a CollectionSpec
+// changes incompatibly.
+const specCacheVersion = 1
+
+type cachedCollectionSpec struct {
+	Version  int                           `json:"version"`
+	BTF      []cachedBTF                   `json:"btf,omitempty"`
+	Maps     map[string]*cachedMapSpec     `json:"maps"`
+	Programs map[string]*cachedProgramSpec `json:"programs"`
+}
+
+type cachedBTF struct {
+	ByteOrder string `json:"byte_order"`
+	Raw       []byte `json:"raw"`
+}
+
+type cachedMapSpec struct {
+	Name       string         `json:"name"`
+	Type       MapType        `json:"type"`
+	KeySize    uint32         `json:"key_size"`
+	ValueSize  uint32         `json:"value_size"`
+	MaxEntries uint32         `json:"max_entries"`
+	Flags      uint32         `json:"flags"`
+	Pinning    PinType        `json:"pinning"`
+	NumaNode   uint32         `json:"numa_node"`
+	Contents   [][2][]byte    `json:"contents,omitempty"`
+	Freeze     bool           `json:"freeze"`
+	InnerMap   *cachedMapSpec `json:"inner_map,omitempty"`
+	BTF        *cachedMapBTF  `json:"btf,omitempty"`
+}
+
+type cachedMapBTF struct {
+	Spec  int        `json:"spec"`
+	Key   btf.TypeID `json:"key"`
+	Value btf.TypeID `json:"value"`
+}
+
+type cachedProgramSpec struct {
+	Name          string            `json:"name"`
+	SectionName   string            `json:"section_name"`
+	Type          ProgramType       `json:"type"`
+	AttachType    AttachType        `json:"attach_type"`
+	AttachTo      string            `json:"attach_to"`
+	Instructions  []byte            `json:"instructions"`
+	Symbols       map[int]string    `json:"symbols,omitempty"`
+	References    map[int]string    `json:"references,omitempty"`
+	Flags         uint32            `json:"flags"`
+	License       string            `json:"license"`
+	KernelVersion uint32            `json:"kernel_version"`
+	BTF           *cachedProgramBTF `json:"btf,omitempty"`
+	ByteOrder     string            `json:"byte_order,omitempty"`
+}
+
+type cachedProgramBTF struct {
+	Spec int    `json:"spec"`
+	Info []byte `json:"info"`
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+//
+// The result contains everything needed to load the collection without
+// parsing the original ELF again: the instructions of each program, maps
+// and their initial contents, and BTF. Store it, for example keyed by a hash
+// of the object file, and restore it using UnmarshalBinary.
+//
+// CO-RE relocations are not applied, so the result is independent of the
+// kernel. Use MarshalBinaryFor to cache a spec prepared for a particular
+// kernel.
+//
+// The encoding is not stable across versions of the library, in which
+// case UnmarshalBinary returns an error.
+//
+// Variants, programs with an AttachTarget and map contents which aren't
+// plain data, for example programs in a ProgramArray, can't be marshaled.
+func (cs *CollectionSpec) MarshalBinary() ([]byte, error) {
+	return cs.marshal()
+}
+
+// MarshalBinaryFor is like MarshalBinary, but applies CO-RE relocations
+// against target first. Loading the result doesn't need any relocations,
+// but it is only valid for kernels with the same BTF as target. Key the
+// cache by the object file and the kernel, for example by its release
+// and build ID.
+//
+// target defaults to the BTF of the running kernel if nil. cs isn't
+// modified.
+func (cs *CollectionSpec) MarshalBinaryFor(target *btf.Spec) ([]byte, error) {
+	resolved := cs.Copy()
+	for name, prog := range resolved.Programs {
+		if err := prog.applyCORE(target); err != nil {
+			return nil, fmt.Errorf("program %s: %w", name, err)
+		}
+	}
+
+	return resolved.marshal()
+}
+
+func (cs *CollectionSpec) marshal() ([]byte, error) {
+	if len(cs.Variants) > 0 {
+		return nil, errors.New("can't marshal Variants")
+	}
+
+	enc := specEncoder{
+		btf: make(map[*btf.Spec]int),
+		out: cachedCollectionSpec{
+			Version:  specCacheVersion,
+			Maps:     make(map[string]*cachedMapSpec, len(cs.Maps)),
+			Programs: make(map[string]*cachedProgramSpec, len(cs.Programs)),
+		},
+	}
+
+	// Encode in a fixed order so that the output is deterministic.
+	mapNames := make([]string, 0, len(cs.Maps))
+	for name := range cs.Maps {
+		mapNames = append(mapNames, name)
+	}
+	sort.Strings(mapNames)
+
+	progNames := make([]string, 0, len(cs.Programs))
+	for name := range cs.Programs {
+		progNames = append(progNames, name)
+	}
+	sort.Strings(progNames)
+
+	for _, name := range mapNames {
+		cm, err := enc.mapSpec(cs.Maps[name])
+		if err != nil {
+			return nil, fmt.Errorf("map %s: %w", name, err)
+		}
+		enc.out.Maps[name] = cm
+	}
+
+	for _, name := range progNames {
+		cp, err := enc.programSpec(cs.Programs[name])
+		if err != nil {
+			return nil, fmt.Errorf("program %s: %w", name, err)
+		}
+		enc.out.Programs[name] = cp
+	}
+
+	return json.Marshal(&enc.out)
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+//
+// It restores a CollectionSpec encoded by MarshalBinary, replacing the
+// contents of cs. The result can be modified and loaded like a spec
+// returned by LoadCollectionSpec.
+func (cs *CollectionSpec) UnmarshalBinary(data []byte) error {
+	var in cachedCollectionSpec
+	if err := json.Unmarshal(data, &in); err != nil {
+		return fmt.Errorf("decode spec: %w", err)
+	}
+
+	if in.Version != specCacheVersion {
+		return fmt.Errorf("unsupported spec version %d", in.Version)
+	}
+
+	dec := specDecoder{btf: make([]*btf.Spec, 0, len(in.BTF))}
+	for i, cb := range in.BTF {
+		bo, err := byteOrderFromString(cb.ByteOrder)
+		if err != nil {
+			return fmt.Errorf("BTF %d: %w", i, err)
+		}
+
+		spec, err := btf.LoadRawSpec(bytes.NewReader(cb.Raw), bo)
+		if err != nil {
+			return fmt.Errorf("BTF %d: %w", i, err)
+		}
+		dec.btf = append(dec.btf, spec)
+	}
+
+	maps := make(map[string]*MapSpec, len(in.Maps))
+	for name, cm := range in.Maps {
+		spec, err := dec.mapSpec(cm)
+		if err != nil {
+			return fmt.Errorf("map %s: %w", name, err)
+		}
+		maps[name] = spec
+	}
+
+	progs := make(map[string]*ProgramSpec, len(in.Programs))
+	for name, cp := range in.Programs {
+		spec, err := dec.programSpec(cp)
+		if err != nil {
+			return fmt.Errorf("program %s: %w", name, err)
+		}
+		progs[name] = spec
+	}
+
+	cs.Maps = maps
+	cs.Programs = progs
+	return nil
+}
+
+// applyCORE patches the instructions of ps with the results of its CO-RE
+// relocations against target, and removes the relocations from its BTF.
+func (ps *ProgramSpec) applyCORE(target *btf.Spec) error {
+	if ps.BTF == nil {
+		return nil
+	}
+
+	relos, err := btf.ProgramRelocations(ps.BTF, target)
+	if err != nil {
+		return fmt.Errorf("CO-RE relocations: %w", err)
+	}
+
+	iter := ps.Instructions.Iterate()
+	for iter.Next() {
+		offset := iter.Offset.Bytes()
+		relo, ok := relos[offset]
+		if !ok {
+			continue
+		}
+		delete(relos, offset)
+
+		ins := iter.Ins
+		if ins.Constant != int64(relo.Current) {
+			return fmt.Errorf("instruction %d: CO-RE relocation expects constant %d, got %d", iter.Index, relo.Current, ins.Constant)
+		}
+		ins.Constant = int64(relo.New)
+	}
+
+	if len(relos) > 0 {
+		return fmt.Errorf("%d CO-RE relocations don't match an instruction", len(relos))
+	}
+
+	ps.BTF = btf.ProgramWithoutRelocations(ps.BTF)
+	return nil
+}
+
+type specEncoder struct {
+	btf map[*btf.Spec]int
+	out cachedCollectionSpec
+}
+
+// spec returns the index of a BTF spec, adding it if necessary.
+func (enc *specEncoder) spec(spec *btf.Spec) (int, error) {
+	if i, ok := enc.btf[spec]; ok {
+		return i, nil
+	}
+
+	raw, bo, err := btf.MarshalSpec(spec)
+	if err != nil {
+		return 0, fmt.Errorf("marshal BTF: %w", err)
+	}
+
+	boStr, err := byteOrderString(bo)
+	if err != nil {
+		return 0, fmt.Errorf("BTF: %w", err)
+	}
+
+	i := len(enc.out.BTF)
+	enc.out.BTF = append(enc.out.BTF, cachedBTF{boStr, raw})
+	enc.btf[spec] = i
+	return i, nil
+}
+
+func (enc *specEncoder) mapSpec(spec *MapSpec) (*cachedMapSpec, error) {
+	if spec == nil {
+		return nil, nil
+	}
+
+	cm := &cachedMapSpec{
+		Name:       spec.Name,
+		Type:       spec.Type,
+		KeySize:    spec.KeySize,
+		ValueSize:  spec.ValueSize,
+		MaxEntries: spec.MaxEntries,
+		Flags:      spec.Flags,
+		Pinning:    spec.Pinning,
+		NumaNode:   spec.NumaNode,
+		Freeze:     spec.Freeze,
+	}
+
+	for _, kv := range spec.Contents {
+		key, err := marshalBytes(kv.Key, int(spec.KeySize))
+		if err != nil {
+			return nil, fmt.Errorf("contents: key %v: %w", kv.Key, err)
+		}
+
+		value, err := marshalBytes(kv.Value, int(spec.ValueSize))
+		if err != nil {
+			return nil, fmt.Errorf("contents: value of key %v: %w", kv.Key, err)
+		}
+
+		cm.Contents = append(cm.Contents, [2][]byte{key, value})
+	}
+
+	inner, err := enc.mapSpec(spec.InnerMap)
+	if err != nil {
+		return nil, fmt.Errorf("inner map: %w", err)
+	}
+	cm.InnerMap = inner
+
+	if spec.BTF != nil {
+		i, err := enc.spec(btf.MapSpec(spec.BTF))
+		if err != nil {
+			return nil, err
+		}
+
+		cm.BTF = &cachedMapBTF{
+			i,
+			btf.MapKey(spec.BTF).ID(),
+			btf.MapValue(spec.BTF).ID(),
+		}
+	}
+
+	return cm, nil
+}
+
+func (enc *specEncoder) programSpec(spec *ProgramSpec) (*cachedProgramSpec, error) {
+	if spec.AttachTarget != nil {
+		return nil, errors.New("can't marshal AttachTarget")
+	}
+
+	// The byte order of the instructions doesn't matter, as long as
+	// it's the same when decoding them.
+	insns, err := spec.Instructions.AppendMarshal(nil, binary.LittleEndian)
+	if err != nil {
+		return nil, fmt.Errorf("marshal instructions: %w", err)
+	}
+
+	bo, err := byteOrderString(spec.ByteOrder)
+	if err != nil {
+		return nil, err
+	}
+
+	cp := &cachedProgramSpec{
+		Name:          spec.Name,
+		SectionName:   spec.SectionName,
+		Type:          spec.Type,
+		AttachType:    spec.AttachType,
+		AttachTo:      spec.AttachTo,
+		Instructions:  insns,
+		Flags:         spec.Flags,
+		License:       spec.License,
+		KernelVersion: spec.KernelVersion,
+		ByteOrder:     bo,
+	}
+
+	for i, ins := range spec.Instructions {
+		if ins.Symbol != "" {
+			if cp.Symbols == nil {
+				cp.Symbols = make(map[int]string)
+			}
+			cp.Symbols[i] = ins.Symbol
+		}
+
+		if ins.Reference != "" {
+			if cp.References == nil {
+				cp.References = make(map[int]string)
+			}
+			cp.References[i] = ins.Reference
+		}
+	}
+
+	if spec.BTF != nil {
+		i, err := enc.spec(btf.ProgramSpec(spec.BTF))
+		if err != nil {
+			return nil, err
+		}
+
+		info, err := btf.MarshalProgram(spec.BTF)
+		if err != nil {
+			return nil, fmt.Errorf("marshal BTF: %w", err)
+		}
+
+		cp.BTF = &cachedProgramBTF{i, info}
+	}
+
+	return cp, nil
+}
+
+type specDecoder struct {
+	btf []*btf.Spec
+}
+
+func (dec *specDecoder) spec(i int) (*btf.Spec, error) {
+	if i < 0 || i >= len(dec.btf) {
+		return nil, fmt.Errorf("invalid BTF index %d", i)
+	}
+	return dec.btf[i], nil
+}
+
+func (dec *specDecoder) mapSpec(cm *cachedMapSpec) (*MapSpec, error) {
+	if cm == nil {
+		return nil, nil
+	}
+
+	spec := &MapSpec{
+		Name:       cm.Name,
+		Type:       cm.Type,
+		KeySize:    cm.KeySize,
+		ValueSize:  cm.ValueSize,
+		MaxEntries: cm.MaxEntries,
+		Flags:      cm.Flags,
+		Pinning:    cm.Pinning,
+		NumaNode:   cm.NumaNode,
+		Freeze:     cm.Freeze,
+	}
+
+	for _, kv := range cm.Contents {
+		spec.Contents = append(spec.Contents, MapKV{kv[0], kv[1]})
+	}
+
+	inner, err := dec.mapSpec(cm.InnerMap)
+	if err != nil {
+		return nil, fmt.Errorf("inner map: %w", err)
+	}
+	spec.InnerMap = inner
+
+	if cm.BTF != nil {
+		btfSpec, err := dec.spec(cm.BTF.Spec)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := btfSpec.TypeByID(cm.BTF.Key)
+		if err != nil {
+			return nil, fmt.Errorf("BTF key: %w", err)
+		}
+
+		value, err := btfSpec.TypeByID(cm.BTF.Value)
+		if err != nil {
+			return nil, fmt.Errorf("BTF value: %w", err)
+		}
+
+		m := btf.NewMap(btfSpec, key, value)
+		spec.BTF = &m
+	}
+
+	return spec, nil
+}
+
+func (dec *specDecoder) programSpec(cp *cachedProgramSpec) (*ProgramSpec, error) {
+	var insns asm.Instructions
+	if err := insns.Unmarshal(bytes.NewReader(cp.Instructions), binary.LittleEndian); err != nil {
+		return nil, fmt.Errorf("instructions: %w", err)
+	}
+
+	for i, sym := range cp.Symbols {
+		if i < 0 || i >= len(insns) {
+			return nil, fmt.Errorf("symbol %s: invalid instruction %d", sym, i)
+		}
+		insns[i].Symbol = sym
+	}
+
+	for i, ref := range cp.References {
+		if i < 0 || i >= len(insns) {
+			return nil, fmt.Errorf("reference %s: invalid instruction %d", ref, i)
+		}
+		insns[i].Reference = ref
+	}
+
+	bo, err := byteOrderFromString(cp.ByteOrder)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &ProgramSpec{
+		Name:          cp.Name,
+		SectionName:   cp.SectionName,
+		Type:          cp.Type,
+		AttachType:    cp.AttachType,
+		AttachTo:      cp.AttachTo,
+		Instructions:  insns,
+		Flags:         cp.Flags,
+		License:       cp.License,
+		KernelVersion: cp.KernelVersion,
+		ByteOrder:     bo,
+	}
+
+	if cp.BTF != nil {
+		btfSpec, err := dec.spec(cp.BTF.Spec)
+		if err != nil {
+			return nil, err
+		}
+
+		spec.BTF, err = btf.UnmarshalProgram(btfSpec, cp.BTF.Info)
+		if err != nil {
+			return nil, fmt.Errorf("BTF: %w", err)
+		}
+	}
+
+	return spec, nil
+}
+
+// byteOrderString encodes a byte order. A nil byte order is encoded as an
+// empty string.
+func byteOrderString(bo binary.ByteOrder) (string, error) {
+	switch {
+	case bo == nil:
+		return "", nil
+	case internal.IsLittleEndian(bo):
+		return "little", nil
+	case bo.Uint16([]byte{0, 1}) == 1:
+		return "big", nil
+	default:
+		return "", fmt.Errorf("unknown byte order %v", bo)
+	}
+}
+
+func byteOrderFromString(str string) (binary.ByteOrder, error) {
+	switch str {
+	case "little":
+		return binary.LittleEndian, nil
+	case "big":
+		return binary.BigEndian, nil
+	case "":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown byte order %q", str)
+	}
+}
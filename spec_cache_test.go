@@ -0,0 +1,278 @@
+package ebpf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/btf"
+	"github.com/cilium/ebpf/internal/testutils"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestCollectionSpecMarshalBinary(t *testing.T) {
+	testutils.TestFiles(t, "testdata/loader-*.elf", func(t *testing.T, file string) {
+		spec, err := LoadCollectionSpec(file)
+		if err != nil {
+			t.Fatal("Can't parse ELF:", err)
+		}
+
+		buf, err := spec.MarshalBinary()
+		if err != nil {
+			t.Fatal("Can't marshal spec:", err)
+		}
+
+		var have CollectionSpec
+		if err := have.UnmarshalBinary(buf); err != nil {
+			t.Fatal("Can't unmarshal spec:", err)
+		}
+
+		opts := cmp.Options{
+			cmpopts.IgnoreTypes(new(btf.Map), new(btf.Program)),
+			// Contents are decoded as []byte.
+			cmpopts.IgnoreFields(MapSpec{}, "Contents"),
+		}
+		if diff := cmp.Diff(spec, &have, opts...); diff != "" {
+			t.Errorf("Spec mismatch (-want +got):\n%s", diff)
+		}
+
+		for name, m := range spec.Maps {
+			if (m.BTF == nil) != (have.Maps[name].BTF == nil) {
+				t.Errorf("BTF of map %s isn't preserved", name)
+			}
+		}
+
+		for name, p := range spec.Programs {
+			if (p.BTF == nil) != (have.Programs[name].BTF == nil) {
+				t.Errorf("BTF of program %s isn't preserved", name)
+			}
+		}
+
+		buf2, err := have.MarshalBinary()
+		if err != nil {
+			t.Fatal("Can't marshal unmarshaled spec:", err)
+		}
+		if !bytes.Equal(buf, buf2) {
+			t.Error("Marshaling the unmarshaled spec gives a different result")
+		}
+
+		if have.Programs["xdp_prog"].ByteOrder != internal.NativeEndian {
+			return
+		}
+
+		if have.Maps[".rodata"] != nil {
+			err := have.RewriteConstants(map[string]interface{}{
+				"arg": uint32(1),
+			})
+			if err != nil {
+				t.Fatal("Can't rewrite constant:", err)
+			}
+		}
+
+		have.Maps["array_of_hash_map"].InnerMap = have.Maps["hash_map"]
+		coll, err := NewCollectionWithOptions(&have, CollectionOptions{
+			Maps: MapOptions{
+				PinPath: testutils.TempBPFFS(t),
+			},
+		})
+		testutils.SkipIfNotSupported(t, err)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer coll.Close()
+
+		ret, _, err := coll.Programs["xdp_prog"].Test(make([]byte, 14))
+		if err != nil {
+			t.Fatal("Can't run program:", err)
+		}
+
+		if ret != 5 {
+			t.Error("Expected return value to be 5, got", ret)
+		}
+	})
+}
+
+func TestCollectionSpecUnmarshalBinaryInvalid(t *testing.T) {
+	for _, data := range []string{
+		``,
+		`{"version":0}`,
+		`{"version":1,"programs":{"foo":{"instructions":"AQ=="}}}`,
+		`{"version":1,"programs":{"foo":{"btf":{"spec":1}}}}`,
+		`{"version":1,"maps":{"foo":{"btf":{"spec":0}}}}`,
+	} {
+		var spec CollectionSpec
+		if err := spec.UnmarshalBinary([]byte(data)); err == nil {
+			t.Errorf("No error for %q", data)
+		}
+	}
+}
+
+// zeroByteOrder is neither little nor big endian.
+type zeroByteOrder struct{ binary.ByteOrder }
+
+func (zeroByteOrder) Uint16([]byte) uint16 { return 0 }
+
+func TestCollectionSpecMarshalByteOrder(t *testing.T) {
+	for _, bo := range []binary.ByteOrder{
+		binary.LittleEndian,
+		binary.BigEndian,
+		testutils.WrappedByteOrder{ByteOrder: binary.LittleEndian},
+		testutils.WrappedByteOrder{ByteOrder: binary.BigEndian},
+	} {
+		spec := &CollectionSpec{
+			Programs: map[string]*ProgramSpec{
+				"prog": {
+					Type:         SocketFilter,
+					Instructions: asm.Instructions{asm.Return()},
+					ByteOrder:    bo,
+				},
+			},
+		}
+
+		data, err := spec.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var have CollectionSpec
+		if err := have.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+
+		want := binary.ByteOrder(binary.LittleEndian)
+		if !internal.IsLittleEndian(bo) {
+			want = binary.BigEndian
+		}
+		if have.Programs["prog"].ByteOrder != want {
+			t.Errorf("%v is restored as %v", bo, have.Programs["prog"].ByteOrder)
+		}
+	}
+
+	spec := &CollectionSpec{
+		Programs: map[string]*ProgramSpec{
+			"prog": {ByteOrder: zeroByteOrder{binary.LittleEndian}},
+		},
+	}
+	if _, err := spec.MarshalBinary(); err == nil {
+		t.Error("MarshalBinary accepts an unknown byte order")
+	}
+}
+
+func TestCollectionSpecMarshalBinaryFor(t *testing.T) {
+	testutils.TestFiles(t, "internal/btf/testdata/relocs-*.elf", func(t *testing.T, file string) {
+		spec, err := LoadCollectionSpec(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Relocate against the types of the object itself, which makes
+		// relocations of local and target IDs agree.
+		target, err := btf.LoadSpecFromReader(mustOpen(t, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := spec.MarshalBinaryFor(target); err == nil {
+			t.Error("Ambiguous relocations don't return an error")
+		}
+
+		delete(spec.Programs, "ambiguous")
+		delete(spec.Programs, "ambiguous_flavour")
+		for _, prog := range spec.Programs {
+			prog.License = "MIT"
+		}
+
+		data, err := spec.MarshalBinaryFor(target)
+		if err != nil {
+			t.Fatal("Can't marshal:", err)
+		}
+
+		if relos, _ := btf.ProgramRelocations(spec.Programs["type_ids"].BTF, target); len(relos) == 0 {
+			t.Fatal("MarshalBinaryFor modifies the spec")
+		}
+
+		var have CollectionSpec
+		if err := have.UnmarshalBinary(data); err != nil {
+			t.Fatal("Can't unmarshal:", err)
+		}
+
+		prog := have.Programs["type_ids"]
+		if relos, err := btf.ProgramRelocations(prog.BTF, nil); err != nil || len(relos) != 0 {
+			t.Fatal("Relocations aren't removed:", relos, err)
+		}
+
+		if prog.ByteOrder != internal.NativeEndian {
+			return
+		}
+
+		_, err = NewProgramWithOptions(spec.Programs["type_ids"], ProgramOptions{KernelTypes: target})
+		if !errors.Is(err, ErrNotSupported) {
+			t.Fatal("Expected unresolved program to require CO-RE, got", err)
+		}
+
+		p, err := NewProgram(prog)
+		testutils.SkipIfNotSupported(t, err)
+		if err != nil {
+			t.Fatal("Can't load resolved program:", err)
+		}
+		defer p.Close()
+
+		ret, _, err := p.Test(make([]byte, 14))
+		testutils.SkipIfNotSupported(t, err)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ret != 0 {
+			t.Error("Relocation at line", ret, "is wrong")
+		}
+	})
+}
+
+func TestCollectionSpecMarshalBinaryForMismatch(t *testing.T) {
+	file := "internal/btf/testdata/relocs-el.elf"
+	spec, err := LoadCollectionSpec(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := btf.LoadSpecFromReader(mustOpen(t, file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prog := spec.Programs["type_ids"]
+	relos, err := btf.ProgramRelocations(prog.BTF, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iter := prog.Instructions.Iterate()
+	for iter.Next() {
+		if _, ok := relos[iter.Offset.Bytes()]; ok {
+			iter.Ins.Constant++
+			break
+		}
+	}
+
+	cs := &CollectionSpec{Programs: map[string]*ProgramSpec{"type_ids": prog}}
+	if _, err := cs.MarshalBinaryFor(target); err == nil {
+		t.Error("Relocating an unexpected constant doesn't return an error")
+	}
+}
+
+func mustOpen(tb testing.TB, file string) *os.File {
+	tb.Helper()
+
+	f, err := os.Open(file)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { f.Close() })
+	return f
+}
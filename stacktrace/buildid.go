@@ -0,0 +1,234 @@
+package stacktrace
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal"
+)
+
+// StackBuildID is a flag for StackTrace maps. It makes the map store
+// frames of user space stacks as build ID and file offset instead of
+// instruction pointers.
+//
+// This keeps stacks symbolizable after the traced process exited. Read
+// such stacks using Map.LookupBuildID.
+const StackBuildID = 1 << 5
+
+// Size of struct bpf_stack_build_id.
+const buildIDFrameSize = 32
+
+// BuildID identifies an ELF file, see the --build-id flag of ld.
+type BuildID [20]byte
+
+func (id BuildID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// maxNotesSize is the largest PT_NOTE segment searched for a build ID.
+const maxNotesSize = 1 << 20
+
+// ReadBuildID returns the GNU build ID of an ELF file.
+func ReadBuildID(f *elf.File) (BuildID, error) {
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_NOTE {
+			continue
+		}
+
+		// Don't trust the size of the segment, build ID notes are tiny.
+		if prog.Filesz > maxNotesSize {
+			continue
+		}
+
+		notes := make([]byte, prog.Filesz)
+		if _, err := prog.ReadAt(notes, 0); err != nil {
+			return BuildID{}, fmt.Errorf("read notes: %w", err)
+		}
+
+		if id, ok := findBuildIDNote(notes, f.ByteOrder); ok {
+			return id, nil
+		}
+	}
+
+	return BuildID{}, errors.New("no build ID")
+}
+
+func findBuildIDNote(notes []byte, bo binary.ByteOrder) (BuildID, bool) {
+	const ntGNUBuildID = 3
+
+	// Sizes come from untrusted input, so compute offsets in 64 bits where
+	// they can't wrap around.
+	align := func(n uint32) uint64 { return (uint64(n) + 3) &^ 3 }
+
+	for len(notes) >= 12 {
+		nameSize := bo.Uint32(notes[0:])
+		descSize := bo.Uint32(notes[4:])
+		typ := bo.Uint32(notes[8:])
+		notes = notes[12:]
+
+		descOff := align(nameSize)
+		end := descOff + align(descSize)
+		if end > uint64(len(notes)) {
+			return BuildID{}, false
+		}
+
+		name := notes[:nameSize]
+		desc := notes[descOff : descOff+uint64(descSize)]
+		notes = notes[end:]
+
+		if typ == ntGNUBuildID && string(name) == "GNU\x00" {
+			// The kernel truncates or zero pads build IDs to 20 bytes,
+			// do the same.
+			var id BuildID
+			copy(id[:], desc)
+			return id, true
+		}
+	}
+
+	return BuildID{}, false
+}
+
+// BuildIDStatus describes the contents of a BuildIDFrame.
+type BuildIDStatus int32
+
+// Valid build ID statuses.
+const (
+	// BuildIDEmpty marks the end of the stack.
+	BuildIDEmpty BuildIDStatus = iota
+	// BuildIDValid frames contain a build ID and a file offset.
+	BuildIDValid
+	// BuildIDIP frames contain an instruction pointer, since the kernel
+	// couldn't read the build ID.
+	BuildIDIP
+)
+
+// BuildIDFrame is a frame of a stack collected with StackBuildID.
+type BuildIDFrame struct {
+	Status  BuildIDStatus
+	BuildID BuildID
+	// The file offset if Status is BuildIDValid, the instruction pointer
+	// if Status is BuildIDIP.
+	Offset uint64
+}
+
+func (f BuildIDFrame) String() string {
+	if f.Status == BuildIDValid {
+		return fmt.Sprintf("%s+%#x", f.BuildID, f.Offset)
+	}
+	return fmt.Sprintf("%#x", f.Offset)
+}
+
+// LookupBuildID returns the frames of the stack with the given ID,
+// innermost frame first.
+//
+// The map must have been created with StackBuildID.
+func (sm *Map) LookupBuildID(id uint32) ([]BuildIDFrame, error) {
+	if !sm.buildID {
+		return nil, errors.New("map doesn't contain build IDs")
+	}
+
+	buf, err := sm.m.LookupBytes(id)
+	if err != nil {
+		return nil, fmt.Errorf("lookup stack %d: %w", id, err)
+	}
+	if buf == nil {
+		return nil, fmt.Errorf("lookup stack %d: %w", id, ebpf.ErrKeyNotExist)
+	}
+
+	var frames []BuildIDFrame
+	for ; len(buf) >= buildIDFrameSize; buf = buf[buildIDFrameSize:] {
+		// struct bpf_stack_build_id { s32 status; u8 build_id[20]; u64 offset; }
+		frame := BuildIDFrame{
+			Status: BuildIDStatus(internal.NativeEndian.Uint32(buf)),
+			Offset: internal.NativeEndian.Uint64(buf[24:]),
+		}
+		if frame.Status == BuildIDEmpty {
+			break
+		}
+
+		copy(frame.BuildID[:], buf[4:24])
+		frames = append(frames, frame)
+	}
+
+	return frames, nil
+}
+
+// SymbolStore resolves addresses in files identified by build ID.
+type SymbolStore interface {
+	// ResolveBuildID returns the frame at a file offset.
+	//
+	// Returns an error if the offset can't be resolved.
+	ResolveBuildID(id BuildID, offset uint64) (Frame, error)
+}
+
+// BuildIDDirectory is a SymbolStore which finds files in the layout used
+// for separate debug info, for example /usr/lib/debug.
+//
+// The file of build ID abcdef... is expected at
+// <Path>/.build-id/ab/cdef....debug.
+type BuildIDDirectory struct {
+	Path string
+
+	mu    sync.Mutex
+	files map[BuildID]*symbolTable
+}
+
+var _ SymbolStore = (*BuildIDDirectory)(nil)
+
+// ResolveBuildID implements SymbolStore.
+func (dir *BuildIDDirectory) ResolveBuildID(id BuildID, offset uint64) (Frame, error) {
+	dir.mu.Lock()
+	defer dir.mu.Unlock()
+
+	path := filepath.Join(dir.Path, ".build-id", id.String()[:2], id.String()[2:]+".debug")
+
+	symbols := dir.files[id]
+	if symbols == nil {
+		var err error
+		symbols, err = loadSymbolTable(path)
+		if err != nil {
+			return Frame{}, fmt.Errorf("build ID %s: %w", id, err)
+		}
+
+		if dir.files == nil {
+			dir.files = make(map[BuildID]*symbolTable)
+		}
+		dir.files[id] = symbols
+	}
+
+	sym, symOffset, err := symbols.lookup(offset)
+	if err != nil {
+		return Frame{}, fmt.Errorf("build ID %s: %w", id, err)
+	}
+
+	return Frame{
+		Address: offset,
+		Symbol:  sym,
+		Offset:  symOffset,
+		Module:  path,
+	}, nil
+}
+
+// BuildID resolves a stack collected with StackBuildID.
+//
+// Frames which can't be resolved only contain the file offset or the
+// instruction pointer as Address.
+func (s *Symbolizer) BuildID(stack []BuildIDFrame) []Frame {
+	frames := make([]Frame, 0, len(stack))
+	for _, bf := range stack {
+		frame := Frame{Address: bf.Offset}
+		if bf.Status == BuildIDValid && s.BuildIDSymbols != nil {
+			if resolved, err := s.BuildIDSymbols.ResolveBuildID(bf.BuildID, bf.Offset); err == nil {
+				frame = resolved
+			}
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
@@ -0,0 +1,153 @@
+package stacktrace
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cilium/ebpf/internal/testutils"
+	"github.com/cilium/ebpf/link"
+)
+
+const libc = "/lib/x86_64-linux-gnu/libc.so.6"
+
+func TestMapLookupBuildID(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "4.17", "BPF_F_STACK_BUILD_ID")
+
+	stacks, ids := mustStackTraceMaps(t, StackBuildID)
+	prog := mustGetStackIDProg(t, stacks, ids, UserStack)
+
+	tp, err := link.Tracepoint("syscalls", "sys_enter_getpid", prog)
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tp.Close()
+
+	os.Getpid()
+
+	var id int64
+	if err := ids.Lookup(uint32(0), &id); err != nil {
+		t.Fatal(err)
+	}
+	if id < 0 {
+		t.Fatal("Program didn't collect a stack:", id)
+	}
+
+	sm, err := NewMap(stacks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sm.Lookup(uint32(id)); err == nil {
+		t.Error("Lookup doesn't return an error for a build ID map")
+	}
+
+	frames, err := sm.LookupBuildID(uint32(id))
+	if err != nil {
+		t.Fatal("Can't look up stack:", err)
+	}
+	if len(frames) == 0 {
+		t.Fatal("Stack has no frames")
+	}
+
+	for _, frame := range (&Symbolizer{}).BuildID(frames) {
+		t.Log(frame)
+	}
+}
+
+func TestBuildIDDirectory(t *testing.T) {
+	f, err := elf.Open(libc)
+	if err != nil {
+		t.Skip("Can't open libc:", err)
+	}
+	defer f.Close()
+
+	id, err := ReadBuildID(f)
+	if err != nil {
+		t.Fatal("Can't read build ID:", err)
+	}
+
+	// Find the file offset of a function.
+	syms, err := f.DynamicSymbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var offset uint64
+	for _, sym := range syms {
+		if sym.Name != "getpid" {
+			continue
+		}
+
+		for _, prog := range f.Progs {
+			if prog.Type == elf.PT_LOAD && sym.Value >= prog.Vaddr && sym.Value < prog.Vaddr+prog.Filesz {
+				offset = sym.Value - prog.Vaddr + prog.Off
+			}
+		}
+	}
+	if offset == 0 {
+		t.Fatal("Can't find getpid in libc")
+	}
+
+	dir := t.TempDir()
+	debugFile := filepath.Join(dir, ".build-id", id.String()[:2], id.String()[2:]+".debug")
+	if err := os.MkdirAll(filepath.Dir(debugFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(libc, debugFile); err != nil {
+		t.Fatal(err)
+	}
+
+	s := Symbolizer{BuildIDSymbols: &BuildIDDirectory{Path: dir}}
+	frames := s.BuildID([]BuildIDFrame{
+		{Status: BuildIDValid, BuildID: id, Offset: offset + 1},
+		{Status: BuildIDValid, BuildID: BuildID{1}, Offset: offset},
+		{Status: BuildIDIP, Offset: 0x1234},
+	})
+
+	if frames[0].Symbol == "" || frames[0].Offset != 1 || frames[0].Module != debugFile {
+		t.Error("Can't resolve frame with valid build ID:", frames[0])
+	}
+	if frames[1].Symbol != "" || frames[1].Address != offset {
+		t.Error("Frame with unknown build ID should be unresolved:", frames[1])
+	}
+	if frames[2].Symbol != "" || frames[2].Address != 0x1234 {
+		t.Error("Frame with IP should be unresolved:", frames[2])
+	}
+}
+
+func TestFindBuildIDNote(t *testing.T) {
+	note := func(nameSize, descSize, typ uint32, data ...byte) []byte {
+		buf := make([]byte, 12, 12+len(data))
+		binary.LittleEndian.PutUint32(buf[0:], nameSize)
+		binary.LittleEndian.PutUint32(buf[4:], descSize)
+		binary.LittleEndian.PutUint32(buf[8:], typ)
+		return append(buf, data...)
+	}
+
+	desc := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	valid := note(4, uint32(len(desc)), 3, append([]byte("GNU\x00"), desc...)...)
+	id, ok := findBuildIDNote(valid, binary.LittleEndian)
+	if !ok {
+		t.Fatal("Can't find build ID")
+	}
+	if want := (BuildID{1, 2, 3, 4, 5, 6, 7, 8}); id != want {
+		t.Errorf("Expected %s, got %s", want, id)
+	}
+
+	for name, notes := range map[string][]byte{
+		"truncated":      valid[:len(valid)-1],
+		"oversized name": note(0xfffffffe, 0, 3, []byte("GNU\x00")...),
+		"oversized desc": note(4, 0xfffffffd, 3, []byte("GNU\x00")...),
+		"other type":     note(4, uint32(len(desc)), 1, append([]byte("GNU\x00"), desc...)...),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, ok := findBuildIDNote(notes, binary.LittleEndian); ok {
+				t.Error("Found a build ID")
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+// Package stacktrace allows reading stack traces collected by BPF programs.
+//
+// Programs record stack traces into a StackTrace map using the GetStackid
+// helper, which returns an ID identifying the trace. User space reads the
+// trace from the map and resolves the addresses to symbols.
+package stacktrace
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/kallsyms"
+)
+
+// Flags of the GetStackid helper.
+const (
+	// SkipMask is the mask of the number of frames to skip.
+	SkipMask = 0xff
+	// UserStack collects the user space stack instead of the kernel stack.
+	UserStack = 1 << 8
+	// FastStackCompare compares stacks by hash only.
+	FastStackCompare = 1 << 9
+	// ReuseStackID replaces an existing stack if the hash collides.
+	ReuseStackID = 1 << 10
+)
+
+// Map wraps a StackTrace map.
+type Map struct {
+	m       *ebpf.Map
+	buildID bool
+}
+
+// NewMap wraps a StackTrace map.
+//
+// The Map refers to m, which must not be closed while the Map is in use.
+func NewMap(m *ebpf.Map) (*Map, error) {
+	if m.Type() != ebpf.StackTrace {
+		return nil, fmt.Errorf("invalid map type: %s", m.Type())
+	}
+
+	buildID := m.Flags()&StackBuildID != 0
+	frameSize := uint32(8)
+	if buildID {
+		frameSize = buildIDFrameSize
+	}
+
+	if m.ValueSize() == 0 || m.ValueSize()%frameSize != 0 {
+		return nil, fmt.Errorf("value size %d is not a multiple of %d", m.ValueSize(), frameSize)
+	}
+
+	return &Map{m, buildID}, nil
+}
+
+// Lookup returns the instruction pointers of the stack with the given ID,
+// innermost frame first.
+//
+// Returns ebpf.ErrKeyNotExist if there is no such stack. Use LookupBuildID
+// for maps created with StackBuildID.
+func (sm *Map) Lookup(id uint32) ([]uint64, error) {
+	if sm.buildID {
+		return nil, errors.New("map contains build IDs, use LookupBuildID")
+	}
+
+	frames := make([]uint64, sm.m.ValueSize()/8)
+	if err := sm.m.Lookup(id, frames); err != nil {
+		return nil, fmt.Errorf("lookup stack %d: %w", id, err)
+	}
+
+	// Traces which are shorter than the maximum depth are padded with
+	// zeroes.
+	for i, ip := range frames {
+		if ip == 0 {
+			return frames[:i], nil
+		}
+	}
+
+	return frames, nil
+}
+
+// Delete removes the stack with the given ID from the map.
+//
+// Stack IDs are only reused once their trace is deleted, so long running
+// collectors should delete traces after processing them.
+func (sm *Map) Delete(id uint32) error {
+	if err := sm.m.Delete(id); err != nil {
+		return fmt.Errorf("delete stack %d: %w", id, err)
+	}
+	return nil
+}
+
+// Frame is a resolved stack frame.
+type Frame struct {
+	Address uint64
+	// The name of the function, or empty if the address couldn't be
+	// resolved.
+	Symbol string
+	// The offset of Address from the start of the function.
+	Offset uint64
+	// The kernel module or binary which contains the function. Empty for
+	// the kernel image.
+	Module string
+}
+
+func (f Frame) String() string {
+	if f.Symbol == "" {
+		return fmt.Sprintf("%#x", f.Address)
+	}
+
+	s := f.Symbol
+	if f.Offset != 0 {
+		s = fmt.Sprintf("%s+%#x", s, f.Offset)
+	}
+	if f.Module != "" {
+		s = fmt.Sprintf("%s [%s]", s, f.Module)
+	}
+	return s
+}
+
+// UserResolver resolves addresses in the address space of a process.
+type UserResolver interface {
+	// ResolveUser returns the frame at addr in process pid.
+	//
+	// Returns an error if addr can't be resolved.
+	ResolveUser(pid int, addr uint64) (Frame, error)
+}
+
+// Symbolizer resolves stack traces to symbols.
+type Symbolizer struct {
+	// KernelSymbols resolves kernel addresses. A Resolver for the running
+	// kernel is used if nil.
+	KernelSymbols *kallsyms.Resolver
+	// UserSymbols resolves user space addresses. User space addresses are
+	// left unresolved if nil.
+	UserSymbols UserResolver
+	// BuildIDSymbols resolves frames of stacks collected with
+	// StackBuildID. These frames are left unresolved if nil.
+	BuildIDSymbols SymbolStore
+}
+
+var defaultKernelResolver kallsyms.Resolver
+
+// Kernel resolves a kernel stack trace.
+//
+// Frames which can't be resolved only contain the address.
+func (s *Symbolizer) Kernel(ips []uint64) []Frame {
+	resolver := s.KernelSymbols
+	if resolver == nil {
+		resolver = &defaultKernelResolver
+	}
+
+	frames := make([]Frame, 0, len(ips))
+	for _, ip := range ips {
+		frame := Frame{Address: ip}
+		if sym, offset, ok := resolver.Lookup(ip); ok {
+			frame.Symbol = sym.Name
+			frame.Offset = offset
+			frame.Module = sym.Module
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// User resolves a user space stack trace of process pid.
+//
+// Frames which can't be resolved only contain the address.
+func (s *Symbolizer) User(pid int, ips []uint64) []Frame {
+	frames := make([]Frame, 0, len(ips))
+	for _, ip := range ips {
+		frame := Frame{Address: ip}
+		if s.UserSymbols != nil {
+			if resolved, err := s.UserSymbols.ResolveUser(pid, ip); err == nil {
+				frame = resolved
+				frame.Address = ip
+			}
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
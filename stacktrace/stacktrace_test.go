@@ -0,0 +1,201 @@
+package stacktrace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal/testutils"
+	"github.com/cilium/ebpf/internal/unix"
+	"github.com/cilium/ebpf/link"
+)
+
+func TestMain(m *testing.M) {
+	err := unix.Setrlimit(unix.RLIMIT_MEMLOCK, &unix.Rlimit{
+		Cur: unix.RLIM_INFINITY,
+		Max: unix.RLIM_INFINITY,
+	})
+	if err != nil {
+		fmt.Println("WARNING: Failed to adjust rlimit, tests may fail")
+	}
+	os.Exit(m.Run())
+}
+
+func TestNewMap(t *testing.T) {
+	m, err := ebpf.NewMap(&ebpf.MapSpec{
+		Type:       ebpf.Array,
+		KeySize:    4,
+		ValueSize:  8,
+		MaxEntries: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if _, err := NewMap(m); err == nil {
+		t.Fatal("NewMap accepts an Array")
+	}
+}
+
+func TestMapLookup(t *testing.T) {
+	for _, flags := range []int32{0, UserStack} {
+		t.Run(fmt.Sprintf("flags %#x", flags), func(t *testing.T) {
+			stacks, ids := mustStackTraceMaps(t, 0)
+			prog := mustGetStackIDProg(t, stacks, ids, flags)
+
+			tp, err := link.Tracepoint("syscalls", "sys_enter_getpid", prog)
+			testutils.SkipIfNotSupported(t, err)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tp.Close()
+
+			os.Getpid()
+
+			var id int64
+			if err := ids.Lookup(uint32(0), &id); err != nil {
+				t.Fatal(err)
+			}
+			if id < 0 {
+				t.Fatal("Program didn't collect a stack:", id)
+			}
+
+			sm, err := NewMap(stacks)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ips, err := sm.Lookup(uint32(id))
+			if err != nil {
+				t.Fatal("Can't look up stack:", err)
+			}
+			if len(ips) == 0 || len(ips) == int(stacks.ValueSize()/8) {
+				t.Fatalf("Zero padding isn't stripped: %d frames", len(ips))
+			}
+
+			if flags&UserStack != 0 {
+				frames := (&Symbolizer{UserSymbols: fakeResolver{}}).User(os.Getpid(), ips)
+				if frames[0].Symbol != "fake" || frames[0].Address != ips[0] {
+					t.Error("User frames aren't resolved using UserSymbols:", frames[0])
+				}
+			} else {
+				var s Symbolizer
+				frames := s.Kernel(ips)
+				if frames[0].Symbol == "" {
+					t.Log("Kernel symbols aren't available")
+				}
+				for _, frame := range frames {
+					t.Log(frame)
+				}
+			}
+
+			if err := sm.Delete(uint32(id)); err != nil {
+				t.Fatal("Can't delete stack:", err)
+			}
+			if _, err := sm.Lookup(uint32(id)); !errors.Is(err, ebpf.ErrKeyNotExist) {
+				t.Fatal("Expected ErrKeyNotExist after delete, got", err)
+			}
+		})
+	}
+}
+
+func TestFrameString(t *testing.T) {
+	for _, tc := range []struct {
+		frame Frame
+		want  string
+	}{
+		{Frame{Address: 0x1234}, "0x1234"},
+		{Frame{Address: 0x1234, Symbol: "foo"}, "foo"},
+		{Frame{Address: 0x1234, Symbol: "foo", Offset: 0x10, Module: "bar"}, "foo+0x10 [bar]"},
+	} {
+		if have := tc.frame.String(); have != tc.want {
+			t.Errorf("Expected %q, got %q", tc.want, have)
+		}
+	}
+}
+
+type fakeResolver struct{}
+
+func (fakeResolver) ResolveUser(pid int, addr uint64) (Frame, error) {
+	return Frame{Symbol: "fake"}, nil
+}
+
+func mustStackTraceMaps(tb testing.TB, flags uint32) (stacks, ids *ebpf.Map) {
+	tb.Helper()
+
+	frameSize := uint32(8)
+	if flags&StackBuildID != 0 {
+		frameSize = buildIDFrameSize
+	}
+
+	stacks, err := ebpf.NewMap(&ebpf.MapSpec{
+		Type:       ebpf.StackTrace,
+		KeySize:    4,
+		ValueSize:  127 * frameSize,
+		MaxEntries: 16,
+		Flags:      flags,
+	})
+	testutils.SkipIfNotSupported(tb, err)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { stacks.Close() })
+
+	ids, err = ebpf.NewMap(&ebpf.MapSpec{
+		Type:       ebpf.Array,
+		KeySize:    4,
+		ValueSize:  8,
+		MaxEntries: 1,
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { ids.Close() })
+
+	// Stack IDs start at zero, so use a negative value to detect that
+	// the program didn't run.
+	if err := ids.Put(uint32(0), int64(-1)); err != nil {
+		tb.Fatal(err)
+	}
+
+	return stacks, ids
+}
+
+// mustGetStackIDProg returns a tracepoint program which stores the result
+// of GetStackid in ids.
+func mustGetStackIDProg(tb testing.TB, stacks, ids *ebpf.Map, flags int32) *ebpf.Program {
+	tb.Helper()
+
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Type:    ebpf.TracePoint,
+		License: "GPL",
+		Instructions: asm.Instructions{
+			// r1 contains the context.
+			asm.LoadMapPtr(asm.R2, stacks.FD()),
+			asm.Mov.Imm(asm.R3, flags),
+			asm.FnGetStackid.Call(),
+			asm.StoreMem(asm.RFP, -8, asm.R0, asm.DWord),
+			asm.StoreImm(asm.RFP, -12, 0, asm.Word),
+			asm.LoadMapPtr(asm.R1, ids.FD()),
+			asm.Mov.Reg(asm.R2, asm.RFP),
+			asm.Add.Imm(asm.R2, -12),
+			asm.Mov.Reg(asm.R3, asm.RFP),
+			asm.Add.Imm(asm.R3, -8),
+			asm.Mov.Imm(asm.R4, 0),
+			asm.FnMapUpdateElem.Call(),
+			asm.Mov.Imm(asm.R0, 0),
+			asm.Return(),
+		},
+	})
+	testutils.SkipIfNotSupported(tb, err)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { prog.Close() })
+
+	return prog
+}
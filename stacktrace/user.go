@@ -0,0 +1,358 @@
+package stacktrace
+
+import (
+	"bufio"
+	"debug/dwarf"
+	"debug/elf"
+	"debug/gosym"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ProcessResolver resolves addresses in user space processes.
+//
+// It reads the memory mappings of a process from /proc/<pid>/maps and
+// resolves addresses using the symbol table of the mapped ELF file. If a
+// file has no symbol table the functions described by its DWARF are used
+// instead, then the function table of stripped Go binaries and finally the
+// dynamic symbol table.
+//
+// Mappings and symbol tables are cached. The mappings of a process are
+// reread if an address isn't covered by any of them, for example after a
+// library was loaded. Call Forget once a process has exited.
+//
+// The zero value is ready to use. It is safe to use a ProcessResolver from
+// multiple goroutines.
+type ProcessResolver struct {
+	mu        sync.Mutex
+	processes map[int][]mapping
+	files     map[fileKey]*symbolTable
+}
+
+var _ UserResolver = (*ProcessResolver)(nil)
+
+// ResolveUser returns the frame at addr in process pid.
+func (pr *ProcessResolver) ResolveUser(pid int, addr uint64) (Frame, error) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	if pr.processes == nil {
+		pr.processes = make(map[int][]mapping)
+		pr.files = make(map[fileKey]*symbolTable)
+	}
+
+	m, ok := findMapping(pr.processes[pid], addr)
+	if !ok {
+		mappings, err := readMappings(pid)
+		if err != nil {
+			return Frame{}, err
+		}
+		pr.processes[pid] = mappings
+
+		if m, ok = findMapping(mappings, addr); !ok {
+			return Frame{}, fmt.Errorf("address %#x is not in an executable mapping of pid %d", addr, pid)
+		}
+	}
+
+	symbols, err := pr.symbolTable(pid, m)
+	if err != nil {
+		return Frame{}, err
+	}
+
+	fileOff := addr - m.start + m.offset
+	sym, offset, err := symbols.lookup(fileOff)
+	if err != nil {
+		return Frame{}, fmt.Errorf("%s: %w", m.path, err)
+	}
+
+	return Frame{
+		Address: addr,
+		Symbol:  sym,
+		Offset:  offset,
+		Module:  m.path,
+	}, nil
+}
+
+// Forget drops the cached mappings of a process.
+//
+// Symbol tables of files are kept, since other processes may map them.
+func (pr *ProcessResolver) Forget(pid int) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	delete(pr.processes, pid)
+}
+
+// The caller must hold mu.
+func (pr *ProcessResolver) symbolTable(pid int, m mapping) (*symbolTable, error) {
+	if symbols := pr.files[m.key]; symbols != nil {
+		return symbols, nil
+	}
+
+	// Go via the root of the process, since it may live in a different
+	// mount namespace.
+	path := filepath.Join("/proc", strconv.Itoa(pid), "root", m.path)
+	symbols, err := loadSymbolTable(path)
+	if err != nil {
+		return nil, fmt.Errorf("load symbols of %s: %w", m.path, err)
+	}
+
+	pr.files[m.key] = symbols
+	return symbols, nil
+}
+
+// fileKey identifies a file independent of its path.
+type fileKey struct {
+	dev   string
+	inode uint64
+}
+
+type mapping struct {
+	start, end uint64
+	offset     uint64
+	key        fileKey
+	path       string
+}
+
+func findMapping(mappings []mapping, addr uint64) (mapping, bool) {
+	for _, m := range mappings {
+		if addr >= m.start && addr < m.end {
+			return m, true
+		}
+	}
+	return mapping{}, false
+}
+
+func readMappings(pid int) ([]mapping, error) {
+	f, err := os.Open(filepath.Join("/proc", strconv.Itoa(pid), "maps"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseMappings(f)
+}
+
+// parseMappings returns the executable, file backed mappings in the format
+// of /proc/<pid>/maps.
+func parseMappings(r io.Reader) ([]mapping, error) {
+	var mappings []mapping
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// Lines are formatted as "start-end perms offset dev inode path".
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			return nil, fmt.Errorf("invalid mapping %q", scanner.Text())
+		}
+
+		if len(fields) < 6 || !strings.HasPrefix(fields[5], "/") || !strings.Contains(fields[1], "x") {
+			// Anonymous, special or non-executable mapping.
+			continue
+		}
+
+		addrs := strings.SplitN(fields[0], "-", 2)
+		if len(addrs) != 2 {
+			return nil, fmt.Errorf("invalid address range in mapping %q", scanner.Text())
+		}
+
+		var (
+			m   = mapping{key: fileKey{dev: fields[3]}, path: strings.Join(fields[5:], " ")}
+			err error
+		)
+		if m.start, err = strconv.ParseUint(addrs[0], 16, 64); err != nil {
+			return nil, fmt.Errorf("invalid mapping %q: %w", scanner.Text(), err)
+		}
+		if m.end, err = strconv.ParseUint(addrs[1], 16, 64); err != nil {
+			return nil, fmt.Errorf("invalid mapping %q: %w", scanner.Text(), err)
+		}
+		if m.offset, err = strconv.ParseUint(fields[2], 16, 64); err != nil {
+			return nil, fmt.Errorf("invalid mapping %q: %w", scanner.Text(), err)
+		}
+		if m.key.inode, err = strconv.ParseUint(fields[4], 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid mapping %q: %w", scanner.Text(), err)
+		}
+
+		mappings = append(mappings, m)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return mappings, nil
+}
+
+type userSymbol struct {
+	name        string
+	value, size uint64
+}
+
+// symbolTable contains the functions of an ELF file.
+type symbolTable struct {
+	// PT_LOAD segments, used to translate file offsets into virtual
+	// addresses.
+	segments []*elf.Prog
+	// Sorted by value.
+	symbols []userSymbol
+}
+
+func loadSymbolTable(path string) (*symbolTable, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	st := new(symbolTable)
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_LOAD {
+			st.segments = append(st.segments, prog)
+		}
+	}
+
+	st.symbols, err = elfFunctions(f.Symbols)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(st.symbols) == 0 {
+		// Stripped binaries may still ship DWARF, for example if the
+		// debug info was added back via objcopy.
+		if dw, err := f.DWARF(); err == nil {
+			st.symbols, err = dwarfFunctions(dw)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(st.symbols) == 0 {
+		// Go binaries retain the function table used by the runtime
+		// even when stripped.
+		st.symbols, err = goFunctions(f)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(st.symbols) == 0 {
+		// Only consulted last since the dynamic symbols of executables
+		// are usually limited to a few exports, for example those of cgo.
+		st.symbols, err = elfFunctions(f.DynamicSymbols)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(st.symbols, func(i, j int) bool {
+		return st.symbols[i].value < st.symbols[j].value
+	})
+
+	return st, nil
+}
+
+func elfFunctions(read func() ([]elf.Symbol, error)) ([]userSymbol, error) {
+	syms, err := read()
+	if errors.Is(err, elf.ErrNoSymbols) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var symbols []userSymbol
+	for _, sym := range syms {
+		if elf.ST_TYPE(sym.Info) != elf.STT_FUNC || sym.Value == 0 {
+			continue
+		}
+		symbols = append(symbols, userSymbol{sym.Name, sym.Value, sym.Size})
+	}
+	return symbols, nil
+}
+
+func dwarfFunctions(dw *dwarf.Data) ([]userSymbol, error) {
+	var symbols []userSymbol
+	rd := dw.Reader()
+	for {
+		entry, err := rd.Next()
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			return symbols, nil
+		}
+
+		if entry.Tag != dwarf.TagSubprogram {
+			continue
+		}
+
+		name, _ := entry.Val(dwarf.AttrName).(string)
+		ranges, err := dw.Ranges(entry)
+		if name == "" || err != nil || len(ranges) == 0 {
+			continue
+		}
+
+		symbols = append(symbols, userSymbol{name, ranges[0][0], ranges[0][1] - ranges[0][0]})
+	}
+}
+
+func goFunctions(f *elf.File) ([]userSymbol, error) {
+	pclntab, text := f.Section(".gopclntab"), f.Section(".text")
+	if pclntab == nil || text == nil {
+		return nil, nil
+	}
+
+	data, err := pclntab.Data()
+	if err != nil {
+		return nil, err
+	}
+
+	table, err := gosym.NewTable(nil, gosym.NewLineTable(data, text.Addr))
+	if err != nil {
+		return nil, fmt.Errorf("read .gopclntab: %w", err)
+	}
+
+	symbols := make([]userSymbol, 0, len(table.Funcs))
+	for _, fn := range table.Funcs {
+		symbols = append(symbols, userSymbol{fn.Name, fn.Entry, fn.End - fn.Entry})
+	}
+	return symbols, nil
+}
+
+// lookup finds the function at a file offset.
+func (st *symbolTable) lookup(fileOff uint64) (string, uint64, error) {
+	var (
+		vaddr uint64
+		found bool
+	)
+	for _, prog := range st.segments {
+		if fileOff >= prog.Off && fileOff < prog.Off+prog.Filesz {
+			vaddr = fileOff - prog.Off + prog.Vaddr
+			found = true
+			break
+		}
+	}
+	if !found {
+		return "", 0, fmt.Errorf("file offset %#x is not in a loadable segment", fileOff)
+	}
+
+	i := sort.Search(len(st.symbols), func(i int) bool {
+		return st.symbols[i].value > vaddr
+	})
+	if i == 0 {
+		return "", 0, fmt.Errorf("no symbol at %#x", vaddr)
+	}
+
+	sym := st.symbols[i-1]
+	if sym.size > 0 && vaddr >= sym.value+sym.size {
+		return "", 0, fmt.Errorf("no symbol at %#x", vaddr)
+	}
+
+	return sym.name, vaddr - sym.value, nil
+}
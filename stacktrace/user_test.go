@@ -0,0 +1,74 @@
+package stacktrace
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMappings(t *testing.T) {
+	maps := `55d0c2a00000-55d0c2a02000 r--p 00000000 fd:01 1234 /usr/bin/cat
+55d0c2a02000-55d0c2a07000 r-xp 00002000 fd:01 1234 /usr/bin/cat
+55d0c3000000-55d0c3021000 rw-p 00000000 00:00 0 [heap]
+7f0000000000-7f0000001000 r-xp 00001000 fd:01 42 /opt/with space/lib.so
+7ffd5a9f0000-7ffd5a9f2000 r-xp 00000000 00:00 0 [vdso]
+7ffd5aa00000-7ffd5aa01000 r-xp 00000000 00:00 0
+`
+
+	mappings, err := parseMappings(strings.NewReader(maps))
+	if err != nil {
+		t.Fatal("Can't parse mappings:", err)
+	}
+
+	want := []mapping{
+		{0x55d0c2a02000, 0x55d0c2a07000, 0x2000, fileKey{"fd:01", 1234}, "/usr/bin/cat"},
+		{0x7f0000000000, 0x7f0000001000, 0x1000, fileKey{"fd:01", 42}, "/opt/with space/lib.so"},
+	}
+	if !reflect.DeepEqual(mappings, want) {
+		t.Errorf("Expected %+v, got %+v", want, mappings)
+	}
+
+	if _, ok := findMapping(mappings, 0x55d0c2a07000); ok {
+		t.Error("The end of a mapping should be exclusive")
+	}
+
+	if _, err := parseMappings(strings.NewReader("garbage\n")); err == nil {
+		t.Error("Parsing an invalid mapping doesn't return an error")
+	}
+}
+
+//go:noinline
+func resolveMe(x int) int { return x*3 + 1 }
+
+func TestProcessResolver(t *testing.T) {
+	var pr ProcessResolver
+
+	addr := uint64(reflect.ValueOf(resolveMe).Pointer())
+	frame, err := pr.ResolveUser(os.Getpid(), addr+1)
+	if err != nil {
+		t.Fatal("Can't resolve address:", err)
+	}
+
+	if want := "github.com/cilium/ebpf/stacktrace.resolveMe"; frame.Symbol != want {
+		t.Errorf("Expected symbol %s, got %s", want, frame.Symbol)
+	}
+	if frame.Offset != 1 {
+		t.Error("Expected offset 1, got", frame.Offset)
+	}
+	if frame.Address != addr+1 {
+		t.Errorf("Expected address %#x, got %#x", addr+1, frame.Address)
+	}
+	if frame.Module == "" {
+		t.Error("Frame doesn't contain the binary")
+	}
+
+	if _, err := pr.ResolveUser(os.Getpid(), 0x10); err == nil {
+		t.Error("Resolving an unmapped address doesn't return an error")
+	}
+
+	pr.Forget(os.Getpid())
+	if _, err := pr.ResolveUser(os.Getpid(), addr); err != nil {
+		t.Error("Can't resolve address after Forget:", err)
+	}
+}
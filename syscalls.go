@@ -155,6 +155,7 @@ type bpfProgInfo struct {
 	prog_tags                internal.Pointer
 	run_time_ns              uint64
 	run_cnt                  uint64
+	recursion_misses         uint64 // since 5.12 9ed9e9ba2337
 }
 
 type bpfProgTestRunAttr struct {
@@ -166,6 +167,10 @@ type bpfProgTestRunAttr struct {
 	dataOut     internal.Pointer
 	repeat      uint32
 	duration    uint32
+	ctxSizeIn   uint32
+	ctxSizeOut  uint32
+	ctxIn       internal.Pointer
+	ctxOut      internal.Pointer
 }
 
 type bpfGetFDByIDAttr struct {
@@ -184,20 +189,12 @@ type bpfObjGetNextIDAttr struct {
 }
 
 func bpfProgLoad(attr *bpfProgLoadAttr) (*internal.FD, error) {
-	for {
-		fd, err := internal.BPF(internal.BPF_PROG_LOAD, unsafe.Pointer(attr), unsafe.Sizeof(*attr))
-		// As of ~4.20 the verifier can be interrupted by a signal,
-		// and returns EAGAIN in that case.
-		if err == unix.EAGAIN {
-			continue
-		}
-
-		if err != nil {
-			return nil, err
-		}
-
-		return internal.NewFD(uint32(fd)), nil
+	fd, err := internal.BPF(internal.BPF_PROG_LOAD, unsafe.Pointer(attr), unsafe.Sizeof(*attr))
+	if err != nil {
+		return nil, err
 	}
+
+	return internal.NewFD(uint32(fd)), nil
 }
 
 func bpfProgTestRun(attr *bpfProgTestRunAttr) error {
@@ -249,7 +246,22 @@ var haveMapMutabilityModifiers = internal.FeatureTest("read- and write-only maps
 	return nil
 })
 
-func bpfMapLookupElem(m *internal.FD, key, valueOut internal.Pointer) error {
+var haveMmapableMaps = internal.FeatureTest("mmapable maps", "5.5", func() error {
+	m, err := bpfMapCreate(&bpfMapCreateAttr{
+		mapType:    Array,
+		keySize:    4,
+		valueSize:  4,
+		maxEntries: 1,
+		flags:      MapMmapable,
+	})
+	if err != nil {
+		return internal.ErrNotSupported
+	}
+	_ = m.Close()
+	return nil
+})
+
+func bpfMapLookupElem(m *internal.FD, key, valueOut internal.Pointer, flags uint64) error {
 	fd, err := m.Value()
 	if err != nil {
 		return err
@@ -259,6 +271,7 @@ func bpfMapLookupElem(m *internal.FD, key, valueOut internal.Pointer) error {
 		mapFd: fd,
 		key:   key,
 		value: valueOut,
+		flags: flags,
 	}
 	_, err = internal.BPF(internal.BPF_MAP_LOOKUP_ELEM, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
 	return wrapMapError(err)
@@ -360,27 +373,31 @@ func wrapObjError(err error) error {
 		return nil
 	}
 	if errors.Is(err, unix.ENOENT) {
-		return fmt.Errorf("%w", ErrNotExist)
+		return internal.SyscallError(ErrNotExist, err)
 	}
 
 	return errors.New(err.Error())
 }
 
+// wrapMapError turns errnos returned by map syscalls into sentinel errors.
+//
+// The errno is retained, so errors.Is matches both the sentinel and the
+// errno.
 func wrapMapError(err error) error {
 	if err == nil {
 		return nil
 	}
 
 	if errors.Is(err, unix.ENOENT) {
-		return ErrKeyNotExist
+		return internal.SyscallError(ErrKeyNotExist, err)
 	}
 
 	if errors.Is(err, unix.EEXIST) {
-		return ErrKeyExist
+		return internal.SyscallError(ErrKeyExist, err)
 	}
 
 	if errors.Is(err, unix.ENOTSUPP) {
-		return ErrNotSupported
+		return internal.SyscallError(ErrNotSupported, err)
 	}
 
 	return err
@@ -1,9 +1,12 @@
 package ebpf
 
 import (
+	"errors"
 	"strings"
 	"testing"
+	"unsafe"
 
+	"github.com/cilium/ebpf/internal"
 	"github.com/cilium/ebpf/internal/testutils"
 	"github.com/cilium/ebpf/internal/unix"
 )
@@ -53,3 +56,66 @@ func TestHaveNestedMaps(t *testing.T) {
 func TestHaveMapMutabilityModifiers(t *testing.T) {
 	testutils.CheckFeatureTest(t, haveMapMutabilityModifiers)
 }
+
+func TestRecordSyscalls(t *testing.T) {
+	m, err := NewMap(&MapSpec{
+		Type:       Hash,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	sr := testutils.RecordSyscalls(t)
+	sr.Fail(internal.BPF_MAP_UPDATE_ELEM, unix.EPERM)
+
+	if err := m.Put(uint32(0), uint32(1)); !errors.Is(err, unix.EPERM) {
+		t.Fatal("Expected scripted EPERM, got", err)
+	}
+
+	if err := m.Put(uint32(0), uint32(1)); err != nil {
+		t.Fatal("Unscripted syscall isn't passed to the kernel:", err)
+	}
+
+	calls := sr.CallsTo(internal.BPF_MAP_UPDATE_ELEM)
+	if len(calls) != 2 {
+		t.Fatalf("Expected two calls, got %d", len(calls))
+	}
+
+	var attr bpfMapOpAttr
+	if uintptr(len(calls[0].Attr)) != unsafe.Sizeof(attr) {
+		t.Fatal("Recorded attr has wrong size")
+	}
+	if fd := internal.NativeEndian.Uint32(calls[0].Attr); int(fd) != m.FD() {
+		t.Errorf("Expected map fd %d in attr, got %d", m.FD(), fd)
+	}
+}
+
+func TestWrapMapError(t *testing.T) {
+	for errno, sentinel := range map[error]error{
+		unix.ENOENT:   ErrKeyNotExist,
+		unix.EEXIST:   ErrKeyExist,
+		unix.ENOTSUPP: ErrNotSupported,
+	} {
+		err := wrapMapError(errno)
+
+		if !errors.Is(err, sentinel) {
+			t.Errorf("Error wrapping %s doesn't match %s", errno, sentinel)
+		}
+
+		if !errors.Is(err, errno) {
+			t.Errorf("Error wrapping %s doesn't match the errno", errno)
+		}
+
+		if err.Error() != sentinel.Error() {
+			t.Errorf("Error message %q doesn't match %q", err, sentinel)
+		}
+	}
+
+	if err := wrapMapError(unix.EINVAL); err != unix.EINVAL {
+		t.Error("Unknown errno is modified:", err)
+	}
+}
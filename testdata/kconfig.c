@@ -0,0 +1,17 @@
+#include "common.h"
+
+char __license[] __section("license") = "MIT";
+
+#define __kconfig __attribute__((section(".kconfig")))
+#define __weak __attribute__((weak))
+
+extern unsigned int LINUX_KERNEL_VERSION __kconfig;
+extern _Bool CONFIG_BPF_SYSCALL __kconfig;
+extern int CONFIG_DOES_NOT_EXIST __kconfig __weak;
+
+__section("socket") int kconfig() {
+	if (!CONFIG_BPF_SYSCALL)
+		return 0;
+
+	return LINUX_KERNEL_VERSION != 0 && CONFIG_DOES_NOT_EXIST == 0;
+}
@@ -0,0 +1,89 @@
+// Package testrun builds inputs for Program.Run.
+//
+// Packets are built from layers, and contexts mirror the structs programs
+// receive from the kernel:
+//
+//	pkt, _ := testrun.Packet(&testrun.Ethernet{}, &testrun.IPv4{...}, &testrun.UDP{...})
+//	ret, out, err := prog.Run(&ebpf.RunOptions{
+//		Data:    pkt,
+//		Context: &testrun.SKBuff{Mark: 42},
+//	})
+package testrun
+
+// SKBuff is the context of SocketFilter, SchedCLS, SchedACT and similar
+// programs, struct __sk_buff.
+//
+// The kernel only accepts Mark, Priority, IngressIfindex, Ifindex, CB,
+// Tstamp, WireLen, GSOSegs, GSOSize and HWTstamp as input, depending on
+// the version. Other fields must be zero. Packet related fields are
+// derived from RunOptions.Data.
+type SKBuff struct {
+	Len            uint32
+	PktType        uint32
+	Mark           uint32
+	QueueMapping   uint32
+	Protocol       uint32
+	VLANPresent    uint32
+	VLANTCI        uint32
+	VLANProto      uint32
+	Priority       uint32
+	IngressIfindex uint32
+	Ifindex        uint32
+	TCIndex        uint32
+	CB             [5]uint32
+	Hash           uint32
+	TCClassid      uint32
+	Data           uint32
+	DataEnd        uint32
+	NAPIID         uint32
+	Family         uint32
+	RemoteIP4      uint32
+	LocalIP4       uint32
+	RemoteIP6      [4]uint32
+	LocalIP6       [4]uint32
+	RemotePort     uint32
+	LocalPort      uint32
+	DataMeta       uint32
+	_              uint64 // flow_keys
+	Tstamp         uint64
+	WireLen        uint32
+	GSOSegs        uint32
+	_              uint64 // sk
+	GSOSize        uint32
+	TstampType     uint8
+	_              [3]uint8
+	HWTstamp       uint64
+}
+
+// XDPMD is the context of XDP programs, struct xdp_md.
+//
+// Data, DataEnd and DataMeta are offsets into RunOptions.Data rather than
+// pointers, see XDPInput.
+type XDPMD struct {
+	Data           uint32
+	DataEnd        uint32
+	DataMeta       uint32
+	IngressIfindex uint32
+	RxQueueIndex   uint32
+	EgressIfindex  uint32
+}
+
+// XDPInput returns data and context to run an XDP program on pkt, with
+// meta in front of it as the packet's metadata.
+//
+// The kernel requires the length of meta to be a multiple of four bytes,
+// and at most 32 bytes. IngressIfindex and RxQueueIndex of the context may
+// be set to the ifindex and queue of an existing device.
+//
+// The output of Program.Run also starts with the metadata, which may have
+// been modified by the program.
+func XDPInput(meta, pkt []byte) ([]byte, *XDPMD) {
+	data := make([]byte, 0, len(meta)+len(pkt))
+	data = append(data, meta...)
+	data = append(data, pkt...)
+
+	return data, &XDPMD{
+		Data:    uint32(len(meta)),
+		DataEnd: uint32(len(data)),
+	}
+}
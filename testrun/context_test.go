@@ -0,0 +1,117 @@
+package testrun
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/testutils"
+)
+
+func TestContextSizes(t *testing.T) {
+	if size := binary.Size(SKBuff{}); size != 192 {
+		t.Error("SKBuff has size", size)
+	}
+	if size := binary.Size(XDPMD{}); size != 24 {
+		t.Error("XDPMD has size", size)
+	}
+}
+
+func TestSKBuff(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.2", "context for BPF_PROG_TEST_RUN")
+
+	// Return skb->mark + skb->cb[0] and set skb->cb[1].
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Type: ebpf.SchedCLS,
+		Instructions: asm.Instructions{
+			asm.LoadMem(asm.R0, asm.R1, 8, asm.Word),
+			asm.LoadMem(asm.R2, asm.R1, 48, asm.Word),
+			asm.Add.Reg(asm.R0, asm.R2),
+			asm.StoreImm(asm.R1, 52, 23, asm.Word),
+			asm.Return(),
+		},
+		License: "MIT",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer prog.Close()
+
+	pkt, err := Packet(
+		&Ethernet{},
+		&IPv4{Src: net.IPv4(10, 0, 0, 1), Dst: net.IPv4(10, 0, 0, 2)},
+		&UDP{SrcPort: 1, DstPort: 2},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out SKBuff
+	ret, _, err := prog.Run(&ebpf.RunOptions{
+		Data:       pkt,
+		Context:    &SKBuff{Mark: 40, CB: [5]uint32{2}},
+		ContextOut: &out,
+	})
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ret != 42 {
+		t.Error("Expected return value to be 42, got", ret)
+	}
+	if out.CB[1] != 23 {
+		t.Error("Expected cb[1] to be 23, got", out.CB[1])
+	}
+}
+
+func TestXDPInput(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.14", "xdp_md for BPF_PROG_TEST_RUN")
+
+	// Return the first word of metadata, or zero if there is none.
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Type: ebpf.XDP,
+		Instructions: asm.Instructions{
+			asm.Mov.Imm(asm.R0, 0),
+			asm.LoadMem(asm.R2, asm.R1, 0, asm.Word),
+			asm.LoadMem(asm.R3, asm.R1, 8, asm.Word),
+			asm.Mov.Reg(asm.R4, asm.R3),
+			asm.Add.Imm(asm.R4, 4),
+			asm.JGT.Reg(asm.R4, asm.R2, "exit"),
+			asm.LoadMem(asm.R0, asm.R3, 0, asm.Word),
+			asm.Return().Sym("exit"),
+		},
+		License: "MIT",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer prog.Close()
+
+	meta := make([]byte, 8)
+	internal.NativeEndian.PutUint32(meta, 42)
+	data, ctx := XDPInput(meta, make([]byte, 14))
+
+	if ctx.Data != 8 || ctx.DataEnd != 22 {
+		t.Fatalf("Invalid context %+v", ctx)
+	}
+
+	ret, out, err := prog.Run(&ebpf.RunOptions{
+		Data:    data,
+		Context: ctx,
+	})
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ret != 42 {
+		t.Error("Expected return value to be 42, got", ret)
+	}
+	if len(out) != len(data) {
+		t.Error("Output doesn't include metadata:", len(out))
+	}
+}
@@ -0,0 +1,10 @@
+module github.com/cilium/ebpf/testrun/gopackettest
+
+go 1.15
+
+require (
+	github.com/cilium/ebpf v0.5.0
+	github.com/google/gopacket v1.1.19
+)
+
+replace github.com/cilium/ebpf => ../..
@@ -0,0 +1,79 @@
+// Package gopackettest runs eBPF programs on packets built with gopacket.
+//
+// It is a separate module, so that the ebpf module doesn't depend on
+// gopacket.
+package gopackettest
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cilium/ebpf"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Serialize encodes layers into a packet, outermost first.
+//
+// Lengths and checksums are computed. TCP and UDP checksums use the
+// closest preceding IPv4 or IPv6 layer.
+func Serialize(ls ...gopacket.SerializableLayer) ([]byte, error) {
+	if len(ls) == 0 {
+		return nil, errors.New("no layers")
+	}
+
+	var network gopacket.NetworkLayer
+	for _, l := range ls {
+		switch l := l.(type) {
+		case *layers.IPv4:
+			network = l
+		case *layers.IPv6:
+			network = l
+		case *layers.TCP:
+			if network != nil {
+				if err := l.SetNetworkLayerForChecksum(network); err != nil {
+					return nil, fmt.Errorf("TCP: %w", err)
+				}
+			}
+		case *layers.UDP:
+			if network != nil {
+				if err := l.SetNetworkLayerForChecksum(network); err != nil {
+					return nil, fmt.Errorf("UDP: %w", err)
+				}
+			}
+		}
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ls...); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decode parses a packet, starting with a layer of the given type.
+func Decode(data []byte, first gopacket.LayerType) gopacket.Packet {
+	return gopacket.NewPacket(data, first, gopacket.Default)
+}
+
+// Run serializes layers, runs prog on the result using Program.Test and
+// decodes the output packet.
+//
+// The output is decoded starting with the type of the first layer, and
+// the caller should check the ErrorLayer of the result if the program is
+// expected to produce a valid packet.
+func Run(prog *ebpf.Program, ls ...gopacket.SerializableLayer) (uint32, gopacket.Packet, error) {
+	in, err := Serialize(ls...)
+	if err != nil {
+		return 0, nil, fmt.Errorf("serialize: %w", err)
+	}
+
+	ret, out, err := prog.Test(in)
+	if err != nil {
+		return ret, nil, err
+	}
+
+	return ret, Decode(out, ls[0].LayerType()), nil
+}
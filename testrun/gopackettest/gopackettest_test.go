@@ -0,0 +1,120 @@
+package gopackettest
+
+import (
+	"net"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal/testutils"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func tcpLayers() []gopacket.SerializableLayer {
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolTCP,
+		SrcIP:    net.IPv4(10, 0, 0, 1),
+		DstIP:    net.IPv4(10, 0, 0, 2),
+	}
+	return []gopacket.SerializableLayer{
+		&layers.Ethernet{
+			SrcMAC:       net.HardwareAddr{2, 0, 0, 0, 0, 1},
+			DstMAC:       net.HardwareAddr{2, 0, 0, 0, 0, 2},
+			EthernetType: layers.EthernetTypeIPv4,
+		},
+		ip,
+		&layers.TCP{SrcPort: 12345, DstPort: 80, SYN: true, Window: 1024},
+		gopacket.Payload("hello"),
+	}
+}
+
+func TestSerialize(t *testing.T) {
+	data, err := Serialize(tcpLayers()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkt := Decode(data, layers.LayerTypeEthernet)
+	if err := pkt.ErrorLayer(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ip, _ := pkt.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+	if ip == nil {
+		t.Fatal("Missing IPv4 layer")
+	}
+	// Ethernet pads the frame, so compute the length from the headers.
+	if want := uint16(20 + 20 + len("hello")); ip.Length != want {
+		t.Errorf("Expected IPv4 length %d, got %d", want, ip.Length)
+	}
+
+	tcp, _ := pkt.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	if tcp == nil {
+		t.Fatal("Missing TCP layer")
+	}
+	if tcp.Checksum == 0 {
+		t.Error("TCP checksum isn't computed")
+	}
+	if string(tcp.Payload) != "hello" {
+		t.Errorf("Expected payload hello, got %q", tcp.Payload)
+	}
+
+	if _, err := Serialize(); err == nil {
+		t.Error("Serialize accepts no layers")
+	}
+}
+
+func TestRun(t *testing.T) {
+	// Set the TTL of an IPv4 packet to one and return XDP_PASS.
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Type: ebpf.XDP,
+		Instructions: asm.Instructions{
+			asm.LoadMem(asm.R2, asm.R1, 4, asm.Word),
+			asm.LoadMem(asm.R1, asm.R1, 0, asm.Word),
+			asm.Mov.Reg(asm.R3, asm.R1),
+			asm.Add.Imm(asm.R3, 14+9),
+			asm.JGT.Reg(asm.R3, asm.R2, "out"),
+			asm.StoreImm(asm.R1, 14+8, 1, asm.Byte),
+			asm.Mov.Imm(asm.R0, 2).Sym("out"),
+			asm.Return(),
+		},
+		License: "MIT",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer prog.Close()
+
+	ret, pkt, err := Run(prog, tcpLayers()...)
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ret != 2 {
+		t.Error("Expected return value 2, got", ret)
+	}
+
+	if err := pkt.ErrorLayer(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ip, _ := pkt.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+	if ip == nil {
+		t.Fatal("Missing IPv4 layer")
+	}
+	if ip.TTL != 1 {
+		t.Error("Expected TTL 1, got", ip.TTL)
+	}
+
+	tcp, _ := pkt.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	if tcp == nil {
+		t.Fatal("Missing TCP layer")
+	}
+	if tcp.DstPort != 80 {
+		t.Error("Expected destination port 80, got", tcp.DstPort)
+	}
+}
@@ -0,0 +1,332 @@
+package testrun
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Layer is a protocol header, see Packet.
+type Layer interface {
+	// serialize returns the header followed by payload. prev and next
+	// are the surrounding layers, and may be nil.
+	serialize(prev, next Layer, payload []byte) ([]byte, error)
+}
+
+// Packet serializes layers, outermost first.
+//
+// Fields which depend on other layers, like lengths, checksums and
+// protocol numbers, are filled in unless they are set explicitly:
+//
+//	pkt, err := testrun.Packet(
+//		&testrun.Ethernet{},
+//		&testrun.IPv4{Src: net.IPv4(10, 0, 0, 1), Dst: net.IPv4(10, 0, 0, 2)},
+//		&testrun.TCP{SrcPort: 12345, DstPort: 80, Flags: testrun.TCPSyn},
+//	)
+func Packet(layers ...Layer) ([]byte, error) {
+	var payload []byte
+	for i := len(layers) - 1; i >= 0; i-- {
+		var prev, next Layer
+		if i > 0 {
+			prev = layers[i-1]
+		}
+		if i < len(layers)-1 {
+			next = layers[i+1]
+		}
+
+		var err error
+		payload, err = layers[i].serialize(prev, next, payload)
+		if err != nil {
+			return nil, fmt.Errorf("layer %d: %w", i, err)
+		}
+	}
+	return payload, nil
+}
+
+// Payload is the data of the innermost layer.
+type Payload []byte
+
+func (p Payload) serialize(_, _ Layer, payload []byte) ([]byte, error) {
+	return append(append([]byte(nil), p...), payload...), nil
+}
+
+// Ethernet is an Ethernet II header.
+type Ethernet struct {
+	// Dst and Src default to locally administered addresses.
+	Dst, Src net.HardwareAddr
+	// Type defaults to the EtherType of the next layer.
+	Type uint16
+}
+
+// Default addresses of Ethernet.
+var (
+	DefaultEthernetDst = net.HardwareAddr{0x02, 0, 0, 0, 0, 0x02}
+	DefaultEthernetSrc = net.HardwareAddr{0x02, 0, 0, 0, 0, 0x01}
+)
+
+func (eth *Ethernet) serialize(_, next Layer, payload []byte) ([]byte, error) {
+	dst, src := eth.Dst, eth.Src
+	if dst == nil {
+		dst = DefaultEthernetDst
+	}
+	if src == nil {
+		src = DefaultEthernetSrc
+	}
+	if len(dst) != 6 || len(src) != 6 {
+		return nil, errors.New("ethernet: invalid address")
+	}
+
+	typ := eth.Type
+	if typ == 0 {
+		switch next.(type) {
+		case *IPv4:
+			typ = 0x0800
+		case *IPv6:
+			typ = 0x86dd
+		default:
+			return nil, fmt.Errorf("ethernet: can't determine type of %T", next)
+		}
+	}
+
+	buf := make([]byte, 14, 14+len(payload))
+	copy(buf[0:], dst)
+	copy(buf[6:], src)
+	binary.BigEndian.PutUint16(buf[12:], typ)
+	return append(buf, payload...), nil
+}
+
+// IPv4 is an IPv4 header.
+type IPv4 struct {
+	TOS uint8
+	// TTL defaults to 64.
+	TTL uint8
+	// Protocol defaults to the protocol of the next layer.
+	Protocol uint8
+	Src, Dst net.IP
+	// Options are appended to the header, and must be a multiple of four
+	// bytes long.
+	Options []byte
+}
+
+func (ip *IPv4) serialize(_, next Layer, payload []byte) ([]byte, error) {
+	src, dst := ip.Src.To4(), ip.Dst.To4()
+	if src == nil || dst == nil {
+		return nil, errors.New("ipv4: invalid address")
+	}
+
+	hdrLen := 20 + len(ip.Options)
+	if len(ip.Options)%4 != 0 || hdrLen > 60 {
+		return nil, errors.New("ipv4: invalid options")
+	}
+
+	if hdrLen+len(payload) > 0xffff {
+		return nil, errors.New("ipv4: payload too large")
+	}
+
+	ttl := ip.TTL
+	if ttl == 0 {
+		ttl = 64
+	}
+
+	proto := ip.Protocol
+	if proto == 0 {
+		var err error
+		if proto, err = protocolOf(next); err != nil {
+			return nil, fmt.Errorf("ipv4: %w", err)
+		}
+	}
+
+	buf := make([]byte, hdrLen, hdrLen+len(payload))
+	buf[0] = 0x40 | uint8(hdrLen/4)
+	buf[1] = ip.TOS
+	binary.BigEndian.PutUint16(buf[2:], uint16(hdrLen+len(payload)))
+	buf[8] = ttl
+	buf[9] = proto
+	copy(buf[12:], src)
+	copy(buf[16:], dst)
+	copy(buf[20:], ip.Options)
+	binary.BigEndian.PutUint16(buf[10:], checksum(0, buf))
+	return append(buf, payload...), nil
+}
+
+func (ip *IPv4) pseudoHeaderSum(proto uint8, length int) uint32 {
+	var hdr [12]byte
+	copy(hdr[0:], ip.Src.To4())
+	copy(hdr[4:], ip.Dst.To4())
+	hdr[9] = proto
+	binary.BigEndian.PutUint16(hdr[10:], uint16(length))
+	return sum(0, hdr[:])
+}
+
+// IPv6 is an IPv6 header without extension headers.
+type IPv6 struct {
+	TrafficClass uint8
+	FlowLabel    uint32
+	// NextHeader defaults to the protocol of the next layer.
+	NextHeader uint8
+	// HopLimit defaults to 64.
+	HopLimit uint8
+	Src, Dst net.IP
+}
+
+func (ip *IPv6) serialize(_, next Layer, payload []byte) ([]byte, error) {
+	src, dst := ip.Src.To16(), ip.Dst.To16()
+	if src == nil || dst == nil || ip.Src.To4() != nil || ip.Dst.To4() != nil {
+		return nil, errors.New("ipv6: invalid address")
+	}
+
+	if len(payload) > 0xffff {
+		return nil, errors.New("ipv6: payload too large")
+	}
+
+	hopLimit := ip.HopLimit
+	if hopLimit == 0 {
+		hopLimit = 64
+	}
+
+	nextHeader := ip.NextHeader
+	if nextHeader == 0 {
+		var err error
+		if nextHeader, err = protocolOf(next); err != nil {
+			return nil, fmt.Errorf("ipv6: %w", err)
+		}
+	}
+
+	buf := make([]byte, 40, 40+len(payload))
+	binary.BigEndian.PutUint32(buf[0:], 6<<28|uint32(ip.TrafficClass)<<20|ip.FlowLabel&0xfffff)
+	binary.BigEndian.PutUint16(buf[4:], uint16(len(payload)))
+	buf[6] = nextHeader
+	buf[7] = hopLimit
+	copy(buf[8:], src)
+	copy(buf[24:], dst)
+	return append(buf, payload...), nil
+}
+
+func (ip *IPv6) pseudoHeaderSum(proto uint8, length int) uint32 {
+	var hdr [40]byte
+	copy(hdr[0:], ip.Src.To16())
+	copy(hdr[16:], ip.Dst.To16())
+	binary.BigEndian.PutUint32(hdr[32:], uint32(length))
+	hdr[39] = proto
+	return sum(0, hdr[:])
+}
+
+// TCPFlags are the control bits of a TCP header.
+type TCPFlags uint8
+
+// Valid TCPFlags.
+const (
+	TCPFin TCPFlags = 1 << iota
+	TCPSyn
+	TCPRst
+	TCPPsh
+	TCPAck
+	TCPUrg
+)
+
+// TCP is a TCP header without options.
+type TCP struct {
+	SrcPort, DstPort uint16
+	Seq, Ack         uint32
+	Flags            TCPFlags
+	// Window defaults to 65535.
+	Window uint16
+}
+
+func (tcp *TCP) serialize(prev, _ Layer, payload []byte) ([]byte, error) {
+	window := tcp.Window
+	if window == 0 {
+		window = 0xffff
+	}
+
+	buf := make([]byte, 20, 20+len(payload))
+	binary.BigEndian.PutUint16(buf[0:], tcp.SrcPort)
+	binary.BigEndian.PutUint16(buf[2:], tcp.DstPort)
+	binary.BigEndian.PutUint32(buf[4:], tcp.Seq)
+	binary.BigEndian.PutUint32(buf[8:], tcp.Ack)
+	buf[12] = 5 << 4
+	buf[13] = uint8(tcp.Flags)
+	binary.BigEndian.PutUint16(buf[14:], window)
+	buf = append(buf, payload...)
+
+	if err := putTransportChecksum(prev, 6, buf, buf[16:]); err != nil {
+		return nil, fmt.Errorf("tcp: %w", err)
+	}
+	return buf, nil
+}
+
+// UDP is a UDP header.
+type UDP struct {
+	SrcPort, DstPort uint16
+}
+
+func (udp *UDP) serialize(prev, _ Layer, payload []byte) ([]byte, error) {
+	if 8+len(payload) > 0xffff {
+		return nil, errors.New("udp: payload too large")
+	}
+
+	buf := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint16(buf[0:], udp.SrcPort)
+	binary.BigEndian.PutUint16(buf[2:], udp.DstPort)
+	binary.BigEndian.PutUint16(buf[4:], uint16(8+len(payload)))
+	buf = append(buf, payload...)
+
+	if err := putTransportChecksum(prev, 17, buf, buf[6:]); err != nil {
+		return nil, fmt.Errorf("udp: %w", err)
+	}
+	if binary.BigEndian.Uint16(buf[6:]) == 0 {
+		// Zero means that there is no checksum.
+		binary.BigEndian.PutUint16(buf[6:], 0xffff)
+	}
+	return buf, nil
+}
+
+func protocolOf(l Layer) (uint8, error) {
+	switch l.(type) {
+	case *TCP:
+		return 6, nil
+	case *UDP:
+		return 17, nil
+	default:
+		return 0, fmt.Errorf("can't determine protocol of %T", l)
+	}
+}
+
+// putTransportChecksum writes the checksum of a TCP or UDP segment,
+// which includes a pseudo header of the enclosing IP layer.
+func putTransportChecksum(ip Layer, proto uint8, segment, field []byte) error {
+	var initial uint32
+	switch ip := ip.(type) {
+	case *IPv4:
+		initial = ip.pseudoHeaderSum(proto, len(segment))
+	case *IPv6:
+		initial = ip.pseudoHeaderSum(proto, len(segment))
+	default:
+		return fmt.Errorf("can't compute checksum inside %T", ip)
+	}
+
+	binary.BigEndian.PutUint16(field, checksum(initial, segment))
+	return nil
+}
+
+// sum adds data to a ones' complement sum.
+func sum(initial uint32, data []byte) uint32 {
+	s := initial
+	for i := 0; i+1 < len(data); i += 2 {
+		s += uint32(binary.BigEndian.Uint16(data[i:]))
+	}
+	if len(data)%2 == 1 {
+		s += uint32(data[len(data)-1]) << 8
+	}
+	return s
+}
+
+// checksum returns the Internet checksum of data, see RFC 1071.
+func checksum(initial uint32, data []byte) uint16 {
+	s := sum(initial, data)
+	for s > 0xffff {
+		s = s>>16 + s&0xffff
+	}
+	return ^uint16(s)
+}
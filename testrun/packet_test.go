@@ -0,0 +1,105 @@
+package testrun
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func TestPacketIPv4(t *testing.T) {
+	pkt, err := Packet(
+		&Ethernet{},
+		&IPv4{Src: net.IPv4(10, 0, 0, 1), Dst: net.IPv4(10, 0, 0, 2), Options: make([]byte, 4)},
+		&TCP{SrcPort: 12345, DstPort: 80, Flags: TCPSyn | TCPAck},
+		Payload("hello"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pkt) != 14+24+20+5 {
+		t.Fatal("Unexpected length", len(pkt))
+	}
+	if typ := binary.BigEndian.Uint16(pkt[12:]); typ != 0x0800 {
+		t.Errorf("Unexpected EtherType %#x", typ)
+	}
+
+	ip := pkt[14:]
+	if ip[0] != 0x46 {
+		t.Errorf("Unexpected version and header length %#x", ip[0])
+	}
+	if length := binary.BigEndian.Uint16(ip[2:]); length != 24+20+5 {
+		t.Error("Unexpected total length", length)
+	}
+	if ip[9] != 6 {
+		t.Error("Unexpected protocol", ip[9])
+	}
+	if checksum(0, ip[:24]) != 0 {
+		t.Error("Invalid header checksum")
+	}
+
+	tcp := ip[24:]
+	if port := binary.BigEndian.Uint16(tcp[2:]); port != 80 {
+		t.Error("Unexpected destination port", port)
+	}
+	if tcp[13] != 0x12 {
+		t.Errorf("Unexpected flags %#x", tcp[13])
+	}
+
+	pseudo := (&IPv4{Src: net.IPv4(10, 0, 0, 1), Dst: net.IPv4(10, 0, 0, 2)}).pseudoHeaderSum(6, len(tcp))
+	if checksum(pseudo, tcp) != 0 {
+		t.Error("Invalid TCP checksum")
+	}
+	if string(tcp[20:]) != "hello" {
+		t.Errorf("Unexpected payload %q", tcp[20:])
+	}
+}
+
+func TestPacketIPv6(t *testing.T) {
+	src, dst := net.ParseIP("fd00::1"), net.ParseIP("fd00::2")
+	pkt, err := Packet(
+		&Ethernet{},
+		&IPv6{Src: src, Dst: dst},
+		&UDP{SrcPort: 53, DstPort: 12345},
+		Payload{1, 2, 3},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if typ := binary.BigEndian.Uint16(pkt[12:]); typ != 0x86dd {
+		t.Errorf("Unexpected EtherType %#x", typ)
+	}
+
+	ip := pkt[14:]
+	if length := binary.BigEndian.Uint16(ip[4:]); length != 8+3 {
+		t.Error("Unexpected payload length", length)
+	}
+	if ip[6] != 17 {
+		t.Error("Unexpected next header", ip[6])
+	}
+
+	udp := ip[40:]
+	if length := binary.BigEndian.Uint16(udp[4:]); length != 8+3 {
+		t.Error("Unexpected UDP length", length)
+	}
+
+	pseudo := (&IPv6{Src: src, Dst: dst}).pseudoHeaderSum(17, len(udp))
+	if checksum(pseudo, udp) != 0 {
+		t.Error("Invalid UDP checksum")
+	}
+}
+
+func TestPacketInvalid(t *testing.T) {
+	for name, layers := range map[string][]Layer{
+		"no ethertype":   {&Ethernet{}, Payload{1}},
+		"ipv4 address":   {&IPv4{Src: net.ParseIP("fd00::1"), Dst: net.IPv4(10, 0, 0, 1)}, &UDP{}},
+		"ipv4 options":   {&IPv4{Src: net.IPv4(10, 0, 0, 1), Dst: net.IPv4(10, 0, 0, 1), Options: []byte{1}}, &UDP{}},
+		"ipv6 address":   {&IPv6{Src: net.IPv4(10, 0, 0, 1), Dst: net.ParseIP("fd00::1")}, &UDP{}},
+		"tcp without ip": {&Ethernet{Type: 0x0800}, &TCP{}},
+	} {
+		if _, err := Packet(layers...); err == nil {
+			t.Errorf("%s: Packet doesn't return an error", name)
+		}
+	}
+}
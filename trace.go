@@ -0,0 +1,310 @@
+package ebpf
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+// SyscallEvent describes a bpf syscall made by this package.
+type SyscallEvent struct {
+	// Command is the name of the bpf command, for example "BPF_MAP_CREATE".
+	Command string
+	// Attr is a copy of union bpf_attr after the syscall returned, which
+	// includes fields written by the kernel. Pointers contained in it
+	// refer to memory owned by this package and mustn't be dereferenced.
+	Attr []byte
+	// Result is the value returned by the kernel, usually a new fd.
+	Result int
+	// Err is usually a syscall.Errno if the syscall failed.
+	Err      error
+	Duration time.Duration
+}
+
+// TraceSyscalls invokes hook after every bpf syscall made by this package
+// and its subpackages, for example to debug or audit the interaction with
+// the kernel. Pass nil to stop tracing.
+//
+// hook is called from the goroutine making the syscall, so it must be safe
+// for concurrent use and should return quickly. The event mustn't be
+// retained after hook returns.
+func TraceSyscalls(hook func(*SyscallEvent)) {
+	if hook == nil {
+		internal.SetSyscallHook(nil)
+		return
+	}
+
+	internal.SetSyscallHook(func(cmd internal.BPFCmd, attr []byte, ret uintptr, err error, duration time.Duration) {
+		hook(&SyscallEvent{
+			Command:  cmd.String(),
+			Attr:     attr,
+			Result:   int(ret),
+			Err:      err,
+			Duration: duration,
+		})
+	})
+}
+
+// String formats the event similar to strace, for example
+//
+//	MAP_CREATE{type:Hash key:4 value:8 max:1024 flags:NO_PREALLOC} => EINVAL
+//
+// Only the fields of union bpf_attr relevant to the command are included,
+// optional fields are omitted if they are zero. Pointers are never
+// dereferenced.
+func (ev *SyscallEvent) String() string {
+	var b strings.Builder
+	b.WriteString(strings.TrimPrefix(ev.Command, "BPF_"))
+
+	if fields := attrFields[ev.Command]; len(fields) > 0 {
+		b.WriteByte('{')
+		sep := ""
+		for _, field := range fields {
+			value, ok := field.format(ev.Attr)
+			if !ok {
+				continue
+			}
+			fmt.Fprintf(&b, "%s%s:%s", sep, field.name, value)
+			sep = " "
+		}
+		b.WriteByte('}')
+	}
+
+	b.WriteString(" => ")
+	var errno syscall.Errno
+	switch {
+	case ev.Err == nil:
+		b.WriteString(strconv.Itoa(ev.Result))
+	case errors.As(ev.Err, &errno) && unix.ErrnoName(errno) != "":
+		b.WriteString(unix.ErrnoName(errno))
+	default:
+		b.WriteString(ev.Err.Error())
+	}
+	return b.String()
+}
+
+type attrKind int
+
+const (
+	attrUint32 attrKind = iota
+	attrUint64
+	attrHex32
+	attrHex64
+	attrName
+	attrMapType
+	attrMapFlags
+	attrProgType
+	attrAttachType
+)
+
+// attrField is a member of union bpf_attr, see <linux/bpf.h>.
+type attrField struct {
+	name     string
+	offset   int
+	kind     attrKind
+	optional bool
+}
+
+func (f attrField) format(attr []byte) (string, bool) {
+	size := 4
+	switch f.kind {
+	case attrUint64, attrHex64:
+		size = 8
+	case attrName:
+		size = unix.BPF_OBJ_NAME_LEN
+	}
+	if f.offset+size > len(attr) {
+		return "", false
+	}
+
+	var value uint64
+	switch size {
+	case 4:
+		value = uint64(internal.NativeEndian.Uint32(attr[f.offset:]))
+	case 8:
+		value = internal.NativeEndian.Uint64(attr[f.offset:])
+	default:
+		// Names are empty if they start with a NUL byte.
+		value = uint64(attr[f.offset])
+	}
+
+	if f.optional && value == 0 {
+		return "", false
+	}
+
+	switch f.kind {
+	case attrHex32, attrHex64:
+		return fmt.Sprintf("%#x", value), true
+	case attrName:
+		return strconv.Quote(internal.CString(attr[f.offset : f.offset+size])), true
+	case attrMapType:
+		return MapType(value).String(), true
+	case attrMapFlags:
+		return formatMapFlags(uint32(value)), true
+	case attrProgType:
+		return ProgramType(value).String(), true
+	case attrAttachType:
+		return strings.TrimPrefix(AttachType(value).String(), "Attach"), true
+	default:
+		return strconv.FormatUint(value, 10), true
+	}
+}
+
+// mapFlagNames are the BPF_F_* flags accepted by BPF_MAP_CREATE, by bit.
+var mapFlagNames = []string{
+	"NO_PREALLOC",
+	"NO_COMMON_LRU",
+	"NUMA_NODE",
+	"RDONLY",
+	"WRONLY",
+	"STACK_BUILD_ID",
+	"ZERO_SEED",
+	"RDONLY_PROG",
+	"WRONLY_PROG",
+	"CLONE",
+	"MMAPABLE",
+	"PRESERVE_ELEMS",
+	"INNER_MAP",
+}
+
+func formatMapFlags(flags uint32) string {
+	var names []string
+	for bit, name := range mapFlagNames {
+		if flags&(1<<bit) != 0 {
+			names = append(names, name)
+			flags &^= 1 << bit
+		}
+	}
+	if flags != 0 || len(names) == 0 {
+		names = append(names, fmt.Sprintf("%#x", flags))
+	}
+	return strings.Join(names, "|")
+}
+
+var (
+	elemFields = []attrField{
+		{"map", 0, attrUint32, false},
+		{"flags", 24, attrHex64, true},
+	}
+	batchFields = []attrField{
+		{"map", 36, attrUint32, false},
+		{"count", 32, attrUint32, false},
+		{"flags", 48, attrHex64, true},
+	}
+	nextIDFields = []attrField{
+		{"start", 0, attrUint32, false},
+		{"next", 4, attrUint32, true},
+	}
+	fdByIDFields = []attrField{
+		{"id", 0, attrUint32, false},
+		{"flags", 8, attrHex32, true},
+	}
+	attachFields = []attrField{
+		{"target", 0, attrUint32, false},
+		{"prog", 4, attrUint32, true},
+		{"attach", 8, attrAttachType, false},
+		{"flags", 12, attrHex32, true},
+		{"replace", 16, attrUint32, true},
+	}
+)
+
+// attrFields lists the decoded fields of each command.
+var attrFields = map[string][]attrField{
+	"BPF_MAP_CREATE": {
+		{"type", 0, attrMapType, false},
+		{"key", 4, attrUint32, false},
+		{"value", 8, attrUint32, false},
+		{"max", 12, attrUint32, false},
+		{"flags", 16, attrMapFlags, true},
+		{"inner", 20, attrUint32, true},
+		{"name", 28, attrName, true},
+		{"btf", 48, attrUint32, true},
+	},
+	"BPF_MAP_LOOKUP_ELEM":             elemFields,
+	"BPF_MAP_UPDATE_ELEM":             elemFields,
+	"BPF_MAP_DELETE_ELEM":             elemFields,
+	"BPF_MAP_GET_NEXT_KEY":            elemFields,
+	"BPF_MAP_LOOKUP_AND_DELETE_ELEM":  elemFields,
+	"BPF_MAP_LOOKUP_BATCH":            batchFields,
+	"BPF_MAP_LOOKUP_AND_DELETE_BATCH": batchFields,
+	"BPF_MAP_UPDATE_BATCH":            batchFields,
+	"BPF_MAP_DELETE_BATCH":            batchFields,
+	"BPF_MAP_FREEZE": {
+		{"map", 0, attrUint32, false},
+	},
+	"BPF_PROG_LOAD": {
+		{"type", 0, attrProgType, false},
+		{"insns", 4, attrUint32, false},
+		{"flags", 44, attrHex32, true},
+		{"name", 48, attrName, true},
+		{"attach", 68, attrAttachType, true},
+		{"btf", 72, attrUint32, true},
+		{"attach_btf_id", 108, attrUint32, true},
+		{"attach_prog", 112, attrUint32, true},
+	},
+	"BPF_OBJ_PIN": {
+		{"fd", 8, attrUint32, false},
+		{"flags", 12, attrHex32, true},
+	},
+	"BPF_OBJ_GET": {
+		{"flags", 12, attrHex32, true},
+	},
+	"BPF_PROG_ATTACH": attachFields,
+	"BPF_PROG_DETACH": attachFields,
+	"BPF_PROG_TEST_RUN": {
+		{"prog", 0, attrUint32, false},
+		{"repeat", 32, attrUint32, true},
+		{"retval", 4, attrUint32, false},
+		{"duration", 36, attrUint32, true},
+	},
+	"BPF_PROG_GET_NEXT_ID":  nextIDFields,
+	"BPF_MAP_GET_NEXT_ID":   nextIDFields,
+	"BPF_BTF_GET_NEXT_ID":   nextIDFields,
+	"BPF_LINK_GET_NEXT_ID":  nextIDFields,
+	"BPF_PROG_GET_FD_BY_ID": fdByIDFields,
+	"BPF_MAP_GET_FD_BY_ID":  fdByIDFields,
+	"BPF_BTF_GET_FD_BY_ID":  fdByIDFields,
+	"BPF_LINK_GET_FD_BY_ID": fdByIDFields,
+	"BPF_OBJ_GET_INFO_BY_FD": {
+		{"fd", 0, attrUint32, false},
+		{"len", 4, attrUint32, false},
+	},
+	"BPF_PROG_QUERY": {
+		{"target", 0, attrUint32, false},
+		{"attach", 4, attrAttachType, false},
+		{"flags", 8, attrHex32, true},
+		{"count", 24, attrUint32, false},
+	},
+	"BPF_RAW_TRACEPOINT_OPEN": {
+		{"prog", 8, attrUint32, false},
+	},
+	"BPF_BTF_LOAD": {
+		{"size", 16, attrUint32, false},
+		{"log_level", 24, attrUint32, true},
+	},
+	"BPF_LINK_CREATE": {
+		{"prog", 0, attrUint32, false},
+		{"target", 4, attrUint32, false},
+		{"attach", 8, attrAttachType, false},
+		{"flags", 12, attrHex32, true},
+	},
+	"BPF_LINK_UPDATE": {
+		{"link", 0, attrUint32, false},
+		{"prog", 4, attrUint32, false},
+		{"flags", 8, attrHex32, true},
+		{"old", 12, attrUint32, true},
+	},
+	"BPF_ENABLE_STATS": {
+		{"type", 0, attrUint32, false},
+	},
+	"BPF_ITER_CREATE": {
+		{"link", 0, attrUint32, false},
+		{"flags", 4, attrHex32, true},
+	},
+}
@@ -0,0 +1,148 @@
+package ebpf
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+func TestTraceSyscalls(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []SyscallEvent
+	)
+	TraceSyscalls(func(ev *SyscallEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, *ev)
+	})
+	defer TraceSyscalls(nil)
+
+	m, err := NewMap(&MapSpec{
+		Type:       Array,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if err := m.Lookup(uint32(1), new(uint32)); !errors.Is(err, ErrKeyNotExist) {
+		t.Fatal("Lookup of missing key doesn't return ErrKeyNotExist:", err)
+	}
+
+	TraceSyscalls(nil)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	var create, lookup *SyscallEvent
+	for i := range events {
+		switch events[i].Command {
+		case "BPF_MAP_CREATE":
+			create = &events[i]
+		case "BPF_MAP_LOOKUP_ELEM":
+			lookup = &events[i]
+		}
+	}
+
+	if create == nil {
+		t.Fatal("No event for BPF_MAP_CREATE")
+	}
+	if create.Err != nil || create.Result != m.FD() {
+		t.Errorf("Expected BPF_MAP_CREATE to return %d, got %d (%v)", m.FD(), create.Result, create.Err)
+	}
+	if len(create.Attr) < 4 || MapType(create.Attr[0]) != Array {
+		t.Errorf("BPF_MAP_CREATE attributes don't contain the map type: %v", create.Attr)
+	}
+	if create.Duration <= 0 {
+		t.Error("BPF_MAP_CREATE has no duration")
+	}
+
+	if lookup == nil {
+		t.Fatal("No event for BPF_MAP_LOOKUP_ELEM")
+	}
+	if !errors.Is(lookup.Err, unix.ENOENT) {
+		t.Error("Expected BPF_MAP_LOOKUP_ELEM to fail with ENOENT, got", lookup.Err)
+	}
+
+	n := len(events)
+	if err := m.Put(uint32(0), uint32(1)); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != n {
+		t.Error("Syscalls are traced after passing nil")
+	}
+}
+
+func TestSyscallEventString(t *testing.T) {
+	attr := make([]byte, 64)
+	internal.NativeEndian.PutUint32(attr[0:], uint32(Hash))
+	internal.NativeEndian.PutUint32(attr[4:], 4)
+	internal.NativeEndian.PutUint32(attr[8:], 8)
+	internal.NativeEndian.PutUint32(attr[12:], 1024)
+	internal.NativeEndian.PutUint32(attr[16:], unix.BPF_F_NO_PREALLOC)
+
+	for _, test := range []struct {
+		event SyscallEvent
+		want  string
+	}{
+		{
+			SyscallEvent{Command: "BPF_MAP_CREATE", Attr: attr, Err: unix.EINVAL},
+			"MAP_CREATE{type:Hash key:4 value:8 max:1024 flags:NO_PREALLOC} => EINVAL",
+		},
+		{
+			SyscallEvent{Command: "BPF_MAP_CREATE", Attr: attr[:12], Result: 3},
+			"MAP_CREATE{type:Hash key:4 value:8} => 3",
+		},
+		{
+			SyscallEvent{Command: "BPF_MAP_FREEZE", Attr: make([]byte, 4), Err: fmt.Errorf("wrapped: %w", unix.EPERM)},
+			"MAP_FREEZE{map:0} => EPERM",
+		},
+		{
+			SyscallEvent{Command: "BPFCmd(1000)", Err: errors.New("foo")},
+			"BPFCmd(1000) => foo",
+		},
+	} {
+		if have := test.event.String(); have != test.want {
+			t.Errorf("Expected %q, got %q", test.want, have)
+		}
+	}
+
+	// Feature probes may create other maps first, keep the last one.
+	var create *SyscallEvent
+	TraceSyscalls(func(ev *SyscallEvent) {
+		if ev.Command == "BPF_MAP_CREATE" {
+			create = &SyscallEvent{ev.Command, append([]byte(nil), ev.Attr...), ev.Result, ev.Err, ev.Duration}
+		}
+	})
+	defer TraceSyscalls(nil)
+
+	m, err := NewMap(&MapSpec{
+		Name:       "test",
+		Type:       Array,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	TraceSyscalls(nil)
+
+	if create == nil {
+		t.Fatal("No event for BPF_MAP_CREATE")
+	}
+
+	want := fmt.Sprintf(`MAP_CREATE{type:Array key:4 value:4 max:2 name:"test"} => %d`, m.FD())
+	if have := create.String(); have != want {
+		t.Errorf("Expected %q, got %q", want, have)
+	}
+}
@@ -0,0 +1,6 @@
+// Package tracepipe allows reading the output of bpf_trace_printk.
+//
+// BPF programs can write debug messages to the kernel's trace buffer using
+// the TracePrintk helper. The messages are available from the trace_pipe
+// file in tracefs, which this package parses into structured records.
+package tracepipe
@@ -0,0 +1,162 @@
+package tracepipe
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const tracefsPath = "/sys/kernel/debug/tracing"
+
+// Matches lines like
+//
+//	<...>-1234    [003] d..31  1234.567890: bpf_trace_printk: message
+//
+// Older kernels print the instruction pointer instead of the name of the
+// trace event, and the task group ID and flags depend on trace options.
+var lineRe = regexp.MustCompile(`^\s*(.*)-(\d+)\s+(?:\(\s*[-\d]+\)\s+)?\[(\d+)\]\s+(?:\S+\s+)?(\d+)\.(\d+):\s+(?:bpf_trace_printk|0|0x[0-9a-fA-F]+):\s?(.*)$`)
+
+// Record is a message written by bpf_trace_printk.
+type Record struct {
+	// The task which was running when the message was written.
+	Comm string
+	PID  int
+	// The CPU on which the message was written.
+	CPU int
+	// The time since boot at which the message was written.
+	Timestamp time.Duration
+	// The formatted message, without a trailing newline.
+	Message string
+}
+
+// ReaderOptions control the behaviour of a Reader.
+type ReaderOptions struct {
+	// Filter is called for each record. Records for which it returns
+	// false are skipped.
+	//
+	// The trace buffer doesn't identify the program which wrote a message,
+	// so prefixing messages with the name of the program is a common way
+	// to tell them apart.
+	Filter func(*Record) bool
+}
+
+// Reader reads bpf_trace_printk messages from trace_pipe.
+//
+// Reading consumes messages, so multiple readers will each see a subset
+// of them.
+type Reader struct {
+	file    *os.File
+	rd      *bufio.Reader
+	partial string
+	opts    ReaderOptions
+}
+
+// NewReader opens the trace_pipe of the global trace buffer.
+//
+// opts may be nil.
+func NewReader(opts *ReaderOptions) (*Reader, error) {
+	file, err := os.Open(filepath.Join(tracefsPath, "trace_pipe"))
+	if err != nil {
+		return nil, fmt.Errorf("open trace_pipe: %w", err)
+	}
+
+	r := &Reader{
+		file: file,
+		rd:   bufio.NewReader(file),
+	}
+	if opts != nil {
+		r.opts = *opts
+	}
+	return r, nil
+}
+
+// Close frees resources used by the reader.
+//
+// It interrupts calls to Read, which return an error wrapping os.ErrClosed.
+func (r *Reader) Close() error {
+	return r.file.Close()
+}
+
+// SetDeadline controls how long Read blocks waiting for a message.
+//
+// Read returns an error wrapping os.ErrDeadlineExceeded once the deadline
+// passes. Pass a zero time to remove the deadline.
+func (r *Reader) SetDeadline(t time.Time) error {
+	return r.file.SetDeadline(t)
+}
+
+// Read the next message written by bpf_trace_printk.
+//
+// Lines which weren't written by bpf_trace_printk, for example notices
+// about lost events, are skipped.
+func (r *Reader) Read() (Record, error) {
+	for {
+		line, err := r.rd.ReadString('\n')
+		r.partial += line
+		if err != nil {
+			// Keep the partial line around in case the deadline expired.
+			return Record{}, fmt.Errorf("read trace_pipe: %w", err)
+		}
+
+		line, r.partial = r.partial, ""
+		record, ok := parseLine(strings.TrimSuffix(line, "\n"))
+		if !ok {
+			continue
+		}
+
+		if r.opts.Filter != nil && !r.opts.Filter(&record) {
+			continue
+		}
+
+		return record, nil
+	}
+}
+
+// parseLine parses a line of trace_pipe output.
+//
+// Returns false if the line wasn't written by bpf_trace_printk.
+func parseLine(line string) (Record, bool) {
+	match := lineRe.FindStringSubmatch(line)
+	if match == nil {
+		return Record{}, false
+	}
+
+	pid, err := strconv.Atoi(match[2])
+	if err != nil {
+		return Record{}, false
+	}
+
+	cpu, err := strconv.Atoi(match[3])
+	if err != nil {
+		return Record{}, false
+	}
+
+	secs, err := strconv.ParseInt(match[4], 10, 64)
+	if err != nil {
+		return Record{}, false
+	}
+
+	// The fractional part has microsecond or nanosecond precision
+	// depending on the trace clock.
+	frac := match[5]
+	if len(frac) > 9 {
+		frac = frac[:9]
+	}
+	nsecs, err := strconv.ParseInt(frac+strings.Repeat("0", 9-len(frac)), 10, 64)
+	if err != nil {
+		return Record{}, false
+	}
+
+	return Record{
+		Comm:      match[1],
+		PID:       pid,
+		CPU:       cpu,
+		Timestamp: time.Duration(secs)*time.Second + time.Duration(nsecs),
+		Message:   match[6],
+	}, true
+}
@@ -0,0 +1,178 @@
+package tracepipe
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/testutils"
+	"github.com/cilium/ebpf/internal/unix"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMain(m *testing.M) {
+	err := unix.Setrlimit(unix.RLIMIT_MEMLOCK, &unix.Rlimit{
+		Cur: unix.RLIM_INFINITY,
+		Max: unix.RLIM_INFINITY,
+	})
+	if err != nil {
+		fmt.Println("WARNING: Failed to adjust rlimit, tests may fail")
+	}
+	os.Exit(m.Run())
+}
+
+func TestParseLine(t *testing.T) {
+	testcases := []struct {
+		line string
+		want *Record
+	}{
+		{
+			"           <...>-1234    [003] d..31  1234.567890: bpf_trace_printk: hello world",
+			&Record{"<...>", 1234, 3, 1234*time.Second + 567890*time.Microsecond, "hello world"},
+		},
+		{
+			"  kworker/u8:1-12 (   12) [000] .... 12.000000001: bpf_trace_printk: a: b",
+			&Record{"kworker/u8:1", 12, 0, 12*time.Second + 1, "a: b"},
+		},
+		{
+			"      my-comm 2-99    [001] ..s1   5.100000: 0: old",
+			&Record{"my-comm 2", 99, 1, 5*time.Second + 100*time.Millisecond, "old"},
+		},
+		{
+			"          <idle>-0       [002] d.h.  10.000000: 0x00000001: ip",
+			&Record{"<idle>", 0, 2, 10 * time.Second, "ip"},
+		},
+		{"CPU:3 [LOST 12 EVENTS]", nil},
+		{"           <...>-1234    [003] d..31  1234.567890: sched_switch: prev_comm=foo", nil},
+	}
+
+	for _, tc := range testcases {
+		have, ok := parseLine(tc.line)
+		if tc.want == nil {
+			if ok {
+				t.Errorf("Line %q should be skipped", tc.line)
+			}
+			continue
+		}
+
+		if !ok {
+			t.Errorf("Can't parse line %q", tc.line)
+			continue
+		}
+
+		if diff := cmp.Diff(*tc.want, have); diff != "" {
+			t.Errorf("Line %q doesn't match (-want +got):\n%s", tc.line, diff)
+		}
+	}
+}
+
+func TestReader(t *testing.T) {
+	const message = "tracepipe test"
+
+	rd, err := NewReader(&ReaderOptions{
+		Filter: func(r *Record) bool { return r.Message == message },
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		t.Skip("tracefs is not mounted")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+
+	prog := mustTracePrintkProg(t, message)
+	defer prog.Close()
+
+	ret, _, err := prog.Test(make([]byte, 14))
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret != 0 {
+		t.Fatal("Expected 0 as return value, got", ret)
+	}
+
+	if err := rd.SetDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatal("Can't set deadline:", err)
+	}
+
+	record, err := rd.Read()
+	if err != nil {
+		t.Fatal("Can't read message:", err)
+	}
+
+	if record.Comm == "" {
+		t.Error("Record doesn't contain the command:", record)
+	}
+
+	// The deadline still applies.
+	if _, err := rd.Read(); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatal("Expected os.ErrDeadlineExceeded, got", err)
+	}
+
+	if err := rd.SetDeadline(time.Time{}); err != nil {
+		t.Fatal("Can't clear deadline:", err)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := rd.Read()
+		errs <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	if err := rd.Close(); err != nil {
+		t.Fatal("Can't close reader:", err)
+	}
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, os.ErrClosed) {
+			t.Error("Expected os.ErrClosed, got", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close doesn't interrupt Read")
+	}
+}
+
+func mustTracePrintkProg(tb testing.TB, message string) *ebpf.Program {
+	tb.Helper()
+
+	// The format string is copied onto the stack in chunks of 8 bytes,
+	// including the terminating NUL.
+	buf := make([]byte, (len(message)+8)&^7)
+	copy(buf, message)
+
+	var insns asm.Instructions
+	for off := 0; off < len(buf); off += 8 {
+		insns = append(insns,
+			asm.LoadImm(asm.R1, int64(internal.NativeEndian.Uint64(buf[off:])), asm.DWord),
+			asm.StoreMem(asm.RFP, int16(off-len(buf)), asm.R1, asm.DWord),
+		)
+	}
+
+	insns = append(insns,
+		asm.Mov.Reg(asm.R1, asm.RFP),
+		asm.Add.Imm(asm.R1, int32(-len(buf))),
+		asm.Mov.Imm(asm.R2, int32(len(buf))),
+		asm.FnTracePrintk.Call(),
+		asm.Mov.Imm(asm.R0, 0),
+		asm.Return(),
+	)
+
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Type:         ebpf.XDP,
+		License:      "GPL",
+		Instructions: insns,
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return prog
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/cilium/ebpf/internal/unix"
 )
 
+//go:generate go run github.com/cilium/ebpf/internal/cmd/genuapi types.go MapType ProgramType AttachType
 //go:generate stringer -output types_string.go -type=MapType,ProgramType,AttachType,PinType
 
 // MapType indicates the type map structure
@@ -85,6 +86,18 @@ const (
 	SkStorage
 	// DevMapHash - Hash-based indexing scheme for references to network devices.
 	DevMapHash
+	// StructOpsMap - Stores kernel structs which contain function pointers implemented by BPF programs.
+	StructOpsMap
+	// RingBuf - Multi-producer, single-consumer ring buffer shared with user space.
+	RingBuf
+	// InodeStorage - Specialized map for local storage at inodes for BPF programs.
+	InodeStorage
+	// TaskStorage - Specialized map for local storage at tasks for BPF programs.
+	TaskStorage
+	// BloomFilter - Probabilistic set which may return false positives for lookups.
+	BloomFilter
+	// UserRingBuf - Ring buffer which user space writes to and BPF programs consume.
+	UserRingBuf
 )
 
 // hasPerCPUValue returns true if the Map stores a value per CPU.
@@ -140,6 +153,7 @@ const (
 	Extension
 	LSM
 	SkLookup
+	Syscall
 )
 
 // AttachType of the eBPF program, needed to differentiate allowed context accesses in
@@ -189,6 +203,16 @@ const (
 	AttachXDPCPUMap
 	AttachSkLookup
 	AttachXDP
+	AttachSkSKBVerdict
+	AttachSkReuseportSelect
+	AttachSkReuseportSelectOrMigrate
+	AttachPerfEvent
+	AttachTraceKprobeMulti
+	AttachLSMCGroup
+	AttachStructOps
+	AttachNetfilter
+	AttachTCXIngress
+	AttachTCXEgress
 )
 
 // AttachFlags of the eBPF program used in BPF_PROG_ATTACH command
@@ -0,0 +1,304 @@
+package ebpf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+// ProgramVariant is an implementation of a program which is only loaded
+// if the kernel meets its requirements, see CollectionSpec.Variants.
+//
+// Variants allow shipping a single object which uses newer kernel features
+// where available, for example a ring buffer instead of a perf event array,
+// while still working on older kernels.
+type ProgramVariant struct {
+	// Requires are evaluated in order. The variant is skipped as soon as
+	// one of them returns an error wrapping ErrNotSupported.
+	Requires []Requirement
+	Spec     *ProgramSpec
+}
+
+// Copy returns a copy of the variant.
+func (pv ProgramVariant) Copy() ProgramVariant {
+	cpy := pv
+	cpy.Requires = append([]Requirement(nil), pv.Requires...)
+	cpy.Spec = pv.Spec.Copy()
+	return cpy
+}
+
+// supported evaluates the requirements of the variant.
+func (pv ProgramVariant) supported() (bool, error) {
+	for _, req := range pv.Requires {
+		err := req()
+		if errors.Is(err, ErrNotSupported) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Requirement checks whether the kernel supports a feature.
+//
+// It returns nil if the feature is available, and an error wrapping
+// ErrNotSupported if it isn't. Other errors mean that the check couldn't
+// be executed.
+type Requirement func() error
+
+// RequireKernelVersion is met if the kernel is at least version, which must
+// be in the form Major.Minor[.Patch]. Panics if version is malformed.
+//
+// Distributions often backport features to older kernels, prefer probing
+// for the feature itself if possible.
+func RequireKernelVersion(version string) Requirement {
+	want, err := internal.NewVersion(version)
+	if err != nil {
+		panic(err)
+	}
+
+	return func() error {
+		have, err := internal.KernelVersion()
+		if err != nil {
+			return fmt.Errorf("get kernel version: %w", err)
+		}
+
+		if have.Less(want) {
+			return &internal.UnsupportedFeatureError{
+				MinimumVersion: want,
+				Name:           fmt.Sprintf("kernel %s", have),
+			}
+		}
+		return nil
+	}
+}
+
+// RequireProgramType is met if the kernel can load programs of the
+// given type.
+//
+// Types which require BTF to load, like Tracing, LSM, Extension and
+// StructOps, can't be probed and return an error.
+func RequireProgramType(pt ProgramType) Requirement {
+	return func() error {
+		return probes.run(pt, func() error {
+			return probeProgramType(pt)
+		})
+	}
+}
+
+// RequireMapType is met if the kernel can create maps of the given type.
+//
+// Types which require BTF to create, like SkStorage, InodeStorage,
+// TaskStorage and StructOpsMap, can't be probed and return an error.
+func RequireMapType(mt MapType) Requirement {
+	return func() error {
+		return probes.run(mt, func() error {
+			return probeMapType(mt)
+		})
+	}
+}
+
+// RequireHelper is met if programs of the given type may call a helper.
+//
+// This also requires the program type itself, see RequireProgramType.
+func RequireHelper(pt ProgramType, fn asm.BuiltinFunc) Requirement {
+	type key struct {
+		ProgramType
+		asm.BuiltinFunc
+	}
+
+	return func() error {
+		if err := RequireProgramType(pt)(); err != nil {
+			return err
+		}
+
+		return probes.run(key{pt, fn}, func() error {
+			return probeHelper(pt, fn)
+		})
+	}
+}
+
+// probeCache remembers the outcome of feature probes, like
+// internal.FeatureTest.
+type probeCache struct {
+	sync.Mutex
+	results map[interface{}]error
+}
+
+var probes = probeCache{results: make(map[interface{}]error)}
+
+func (pc *probeCache) run(key interface{}, fn func() error) error {
+	pc.Lock()
+	defer pc.Unlock()
+
+	if err, ok := pc.results[key]; ok {
+		return err
+	}
+
+	err := fn()
+	if err != nil && !errors.Is(err, ErrNotSupported) {
+		// The probe couldn't be executed, try again next time.
+		return err
+	}
+
+	pc.results[key] = err
+	return err
+}
+
+// probeProgramAttr returns the attributes to load a trivial program
+// of the given type.
+func probeProgramAttr(pt ProgramType, insns asm.Instructions) (*bpfProgLoadAttr, error) {
+	bytecode, err := insns.AppendMarshal(nil, internal.NativeEndian)
+	if err != nil {
+		return nil, err
+	}
+
+	attr := &bpfProgLoadAttr{
+		progType:     pt,
+		insCount:     uint32(len(bytecode) / asm.InstructionSize),
+		instructions: internal.NewSlicePointer(bytecode),
+		license:      internal.NewStringPointer("GPL"),
+	}
+
+	switch pt {
+	case Kprobe:
+		v, err := internal.KernelVersion()
+		if err != nil {
+			return nil, fmt.Errorf("detecting kernel version: %w", err)
+		}
+		attr.kernelVersion = v.Kernel()
+
+	case CGroupSockAddr:
+		attr.expectedAttachType = AttachCGroupInet4Connect
+
+	case CGroupSockopt:
+		attr.expectedAttachType = AttachCGroupGetsockopt
+
+	case SkLookup:
+		attr.expectedAttachType = AttachSkLookup
+
+	case Syscall:
+		attr.progFlags = unix.BPF_F_SLEEPABLE
+
+	case Tracing, StructOps, Extension, LSM:
+		return nil, fmt.Errorf("can't probe program type %s", pt)
+	}
+
+	return attr, nil
+}
+
+func probeProgramType(pt ProgramType) error {
+	attr, err := probeProgramAttr(pt, asm.Instructions{
+		asm.Mov.Imm(asm.R0, 0),
+		asm.Return(),
+	})
+	if err != nil {
+		return err
+	}
+
+	fd, err := bpfProgLoad(attr)
+	if errors.Is(err, unix.EINVAL) || errors.Is(err, unix.E2BIG) {
+		return &internal.UnsupportedFeatureError{Name: fmt.Sprintf("program type %s", pt)}
+	}
+	if err != nil {
+		return fmt.Errorf("probe program type %s: %w", pt, err)
+	}
+
+	return fd.Close()
+}
+
+func probeHelper(pt ProgramType, fn asm.BuiltinFunc) error {
+	attr, err := probeProgramAttr(pt, asm.Instructions{
+		fn.Call(),
+		asm.Mov.Imm(asm.R0, 0),
+		asm.Return(),
+	})
+	if err != nil {
+		return err
+	}
+
+	logBuf := make([]byte, 4096)
+	attr.logLevel = 1
+	attr.logSize = uint32(len(logBuf))
+	attr.logBuf = internal.NewSlicePointer(logBuf)
+
+	fd, err := bpfProgLoad(attr)
+	if err == nil {
+		return fd.Close()
+	}
+
+	// The program is rejected if the helper's arguments aren't valid,
+	// which means that the helper itself is supported. An unknown helper
+	// is reported before the arguments are checked.
+	log := internal.CString(logBuf)
+	if strings.Contains(log, "invalid func ") ||
+		strings.Contains(log, "unknown func ") ||
+		strings.Contains(log, "program of this type cannot use helper ") {
+		return &internal.UnsupportedFeatureError{Name: fmt.Sprintf("helper %s for program type %s", fn, pt)}
+	}
+
+	if errors.Is(err, unix.EINVAL) || errors.Is(err, unix.EACCES) {
+		return nil
+	}
+
+	return fmt.Errorf("probe helper %s: %w", fn, err)
+}
+
+func probeMapType(mt MapType) error {
+	attr := bpfMapCreateAttr{
+		mapType:    mt,
+		keySize:    4,
+		valueSize:  4,
+		maxEntries: 1,
+	}
+
+	switch mt {
+	case ArrayOfMaps, HashOfMaps:
+		// Invalid file descriptor, see haveNestedMaps.
+		attr.innerMapFd = ^uint32(0)
+
+	case StackTrace:
+		attr.valueSize = 8
+
+	case LPMTrie:
+		attr.keySize = 8
+		attr.flags = unix.BPF_F_NO_PREALLOC
+
+	case CGroupStorage, PerCPUCGroupStorage:
+		// struct bpf_cgroup_storage_key
+		attr.keySize = 16
+		attr.maxEntries = 0
+
+	case Queue, Stack, BloomFilter:
+		attr.keySize = 0
+
+	case RingBuf, UserRingBuf:
+		attr.keySize = 0
+		attr.valueSize = 0
+		attr.maxEntries = uint32(os.Getpagesize())
+
+	case SkStorage, InodeStorage, TaskStorage, StructOpsMap:
+		return fmt.Errorf("can't probe map type %s", mt)
+	}
+
+	fd, err := bpfMapCreate(&attr)
+	if (mt == ArrayOfMaps || mt == HashOfMaps) && errors.Is(err, unix.EBADF) {
+		return nil
+	}
+	if errors.Is(err, unix.EINVAL) {
+		return &internal.UnsupportedFeatureError{Name: fmt.Sprintf("map type %s", mt)}
+	}
+	if err != nil {
+		return fmt.Errorf("probe map type %s: %w", mt, err)
+	}
+
+	return fd.Close()
+}
@@ -0,0 +1,169 @@
+package ebpf
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal/testutils"
+)
+
+func TestRequirements(t *testing.T) {
+	for name, test := range map[string]struct {
+		req       Requirement
+		supported bool
+	}{
+		"old kernel":         {RequireKernelVersion("3.0"), true},
+		"future kernel":      {RequireKernelVersion("999.0"), false},
+		"program type":       {RequireProgramType(SocketFilter), true},
+		"bogus prog type":    {RequireProgramType(ProgramType(1000)), false},
+		"map type":           {RequireMapType(Array), true},
+		"bogus map type":     {RequireMapType(MapType(1000)), false},
+		"helper":             {RequireHelper(SocketFilter, asm.FnMapLookupElem), true},
+		"invalid helper":     {RequireHelper(SocketFilter, asm.FnXdpAdjustHead), false},
+		"bogus helper":       {RequireHelper(SocketFilter, asm.BuiltinFunc(100000)), false},
+		"helper, bogus type": {RequireHelper(ProgramType(1000), asm.FnMapLookupElem), false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := test.req()
+			if test.supported && err != nil {
+				t.Fatal("Requirement isn't met:", err)
+			}
+			if !test.supported && !errors.Is(err, ErrNotSupported) {
+				t.Fatal("Expected ErrNotSupported, got", err)
+			}
+		})
+	}
+}
+
+func TestRequireKernelVersionInvalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Invalid version doesn't panic")
+		}
+	}()
+
+	RequireKernelVersion("foo")
+}
+
+func TestRequireUnprobeable(t *testing.T) {
+	if err := RequireProgramType(Tracing)(); err == nil || errors.Is(err, ErrNotSupported) {
+		t.Error("Expected an error other than ErrNotSupported, got", err)
+	}
+
+	if err := RequireMapType(SkStorage)(); err == nil || errors.Is(err, ErrNotSupported) {
+		t.Error("Expected an error other than ErrNotSupported, got", err)
+	}
+}
+
+func TestRequireMapTypes(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.8", "ring buffer")
+
+	for _, mt := range []MapType{
+		Hash, ProgramArray, PerfEventArray, StackTrace, LPMTrie,
+		ArrayOfMaps, HashOfMaps, CGroupStorage, Queue, RingBuf,
+	} {
+		if err := RequireMapType(mt)(); err != nil {
+			t.Errorf("%s: %s", mt, err)
+		}
+	}
+}
+
+func TestCollectionVariants(t *testing.T) {
+	returns := func(value int32, mapName string) *ProgramSpec {
+		t.Helper()
+
+		insns := asm.Instructions{
+			asm.LoadMapPtr(asm.R1, 0),
+			asm.Mov.Imm(asm.R0, value),
+			asm.Return(),
+		}
+		insns[0].Reference = mapName
+		if err := insns[0].RewriteMapPtr(-1); err != nil {
+			t.Fatal(err)
+		}
+
+		return &ProgramSpec{
+			Type:         SocketFilter,
+			Instructions: insns,
+			License:      "MIT",
+		}
+	}
+
+	spec := &CollectionSpec{
+		Maps: map[string]*MapSpec{
+			"bogus": {
+				Type:       MapType(1000),
+				KeySize:    4,
+				ValueSize:  4,
+				MaxEntries: 1,
+			},
+			"array": {
+				Type:       Array,
+				KeySize:    4,
+				ValueSize:  4,
+				MaxEntries: 1,
+			},
+			"unused": {
+				Type:       Array,
+				KeySize:    4,
+				ValueSize:  4,
+				MaxEntries: 1,
+			},
+		},
+		Programs: map[string]*ProgramSpec{
+			"prog": returns(3, "array"),
+		},
+		Variants: map[string][]ProgramVariant{
+			"prog": {
+				{
+					Requires: []Requirement{RequireMapType(MapType(1000))},
+					Spec:     returns(1, "bogus"),
+				},
+				{
+					Requires: []Requirement{RequireKernelVersion("3.0"), RequireMapType(Array)},
+					Spec:     returns(2, "array"),
+				},
+			},
+		},
+	}
+
+	run := func(t *testing.T, spec *CollectionSpec) uint32 {
+		t.Helper()
+
+		coll, err := NewCollection(spec)
+		if err != nil {
+			t.Fatal("Can't load collection:", err)
+		}
+		defer coll.Close()
+
+		if coll.Maps["bogus"] != nil {
+			t.Error("Map of unsupported variant was created")
+		}
+		if coll.Maps["unused"] == nil {
+			t.Error("Unreferenced map wasn't created")
+		}
+
+		ret, _, err := coll.Programs["prog"].Test(make([]byte, 14))
+		testutils.SkipIfNotSupported(t, err)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ret
+	}
+
+	if ret := run(t, spec.Copy()); ret != 2 {
+		t.Error("Expected the second variant, got return value", ret)
+	}
+
+	fallback := spec.Copy()
+	fallback.Variants["prog"] = fallback.Variants["prog"][:1]
+	if ret := run(t, fallback); ret != 3 {
+		t.Error("Expected the fallback, got return value", ret)
+	}
+
+	delete(fallback.Programs, "prog")
+	if _, err := NewCollection(fallback); !errors.Is(err, ErrNotSupported) {
+		t.Error("Expected ErrNotSupported without fallback, got", err)
+	}
+}
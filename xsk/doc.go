@@ -0,0 +1,12 @@
+// Package xsk allows sending and receiving packets via AF_XDP sockets.
+//
+// An AF_XDP socket shares a region of memory called UMEM with the kernel,
+// which is divided into equally sized frames. Ownership of frames is
+// passed back and forth using four rings: frames on the fill ring are
+// used by the kernel to receive packets, which then show up on the RX
+// ring. Frames on the TX ring are transmitted and returned via the
+// completion ring.
+//
+// An XDP program redirects packets to a Socket via an XSKMap, see
+// Socket.Attach.
+package xsk
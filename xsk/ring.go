@@ -0,0 +1,162 @@
+package xsk
+
+import (
+	"fmt"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+// ring is a single producer, single consumer queue shared with the kernel.
+//
+// Entries are either frame addresses (fill and completion rings) or
+// descriptors (RX and TX rings).
+type ring struct {
+	mem      []byte
+	producer *uint32
+	consumer *uint32
+	flags    *uint32
+	entries  unsafe.Pointer
+	mask     uint32
+	size     uint32
+
+	// Local copies of the indices, which avoid reading memory shared
+	// with the kernel for every entry.
+	cachedProducer uint32
+	cachedConsumer uint32
+}
+
+// mmapRing maps a ring of size entries of elemSize bytes.
+func mmapRing(fd int, pgoff int64, offsets unix.XDPRingOffset, size int, elemSize uintptr) (*ring, error) {
+	length := int(offsets.Desc) + size*int(elemSize)
+	mem, err := unix.Mmap(fd, pgoff, length, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		return nil, fmt.Errorf("can't mmap ring: %w", err)
+	}
+
+	return newRing(mem, offsets, size), nil
+}
+
+func newRing(mem []byte, offsets unix.XDPRingOffset, size int) *ring {
+	r := &ring{
+		mem:      mem,
+		producer: (*uint32)(unsafe.Pointer(&mem[offsets.Producer])),
+		consumer: (*uint32)(unsafe.Pointer(&mem[offsets.Consumer])),
+		flags:    (*uint32)(unsafe.Pointer(&mem[offsets.Flags])),
+		entries:  unsafe.Pointer(&mem[offsets.Desc]),
+		mask:     uint32(size - 1),
+		size:     uint32(size),
+	}
+	r.cachedProducer = atomic.LoadUint32(r.producer)
+	r.cachedConsumer = atomic.LoadUint32(r.consumer)
+	return r
+}
+
+func (r *ring) close() error {
+	if r == nil || r.mem == nil {
+		return nil
+	}
+
+	err := unix.Munmap(r.mem)
+	r.mem = nil
+	return err
+}
+
+// free returns the number of entries which can be produced.
+func (r *ring) free() uint32 {
+	r.cachedConsumer = atomic.LoadUint32(r.consumer)
+	return r.size - (r.cachedProducer - r.cachedConsumer)
+}
+
+// produce makes n entries following the last produced one visible to the
+// consumer.
+func (r *ring) produce(n uint32) {
+	r.cachedProducer += n
+	atomic.StoreUint32(r.producer, r.cachedProducer)
+}
+
+// available returns the number of entries which can be consumed.
+func (r *ring) available() uint32 {
+	r.cachedProducer = atomic.LoadUint32(r.producer)
+	return r.cachedProducer - r.cachedConsumer
+}
+
+// consume releases n entries following the last consumed one back to the
+// producer.
+func (r *ring) consume(n uint32) {
+	r.cachedConsumer += n
+	atomic.StoreUint32(r.consumer, r.cachedConsumer)
+}
+
+// needWakeup returns true if the kernel has to be woken up to process
+// the ring. Only valid if the socket was bound with UseNeedWakeup.
+func (r *ring) needWakeup() bool {
+	return atomic.LoadUint32(r.flags)&unix.XDP_RING_NEED_WAKEUP != 0
+}
+
+// addr returns the frame address at index i.
+func (r *ring) addr(i uint32) *uint64 {
+	return (*uint64)(unsafe.Pointer(uintptr(r.entries) + uintptr(i&r.mask)*unsafe.Sizeof(uint64(0))))
+}
+
+// desc returns the descriptor at index i.
+func (r *ring) desc(i uint32) *Desc {
+	return (*Desc)(unsafe.Pointer(uintptr(r.entries) + uintptr(i&r.mask)*unsafe.Sizeof(Desc{})))
+}
+
+// produceAddrs enqueues as many addresses as possible.
+func (r *ring) produceAddrs(addrs []uint64) int {
+	n := r.free()
+	if uint32(len(addrs)) < n {
+		n = uint32(len(addrs))
+	}
+
+	for i := uint32(0); i < n; i++ {
+		*r.addr(r.cachedProducer + i) = addrs[i]
+	}
+	r.produce(n)
+	return int(n)
+}
+
+// consumeAddrs dequeues as many addresses as possible.
+func (r *ring) consumeAddrs(addrs []uint64) int {
+	n := r.available()
+	if uint32(len(addrs)) < n {
+		n = uint32(len(addrs))
+	}
+
+	for i := uint32(0); i < n; i++ {
+		addrs[i] = *r.addr(r.cachedConsumer + i)
+	}
+	r.consume(n)
+	return int(n)
+}
+
+// produceDescs enqueues as many descriptors as possible.
+func (r *ring) produceDescs(descs []Desc) int {
+	n := r.free()
+	if uint32(len(descs)) < n {
+		n = uint32(len(descs))
+	}
+
+	for i := uint32(0); i < n; i++ {
+		*r.desc(r.cachedProducer + i) = descs[i]
+	}
+	r.produce(n)
+	return int(n)
+}
+
+// consumeDescs dequeues as many descriptors as possible.
+func (r *ring) consumeDescs(descs []Desc) int {
+	n := r.available()
+	if uint32(len(descs)) < n {
+		n = uint32(len(descs))
+	}
+
+	for i := uint32(0); i < n; i++ {
+		descs[i] = *r.desc(r.cachedConsumer + i)
+	}
+	r.consume(n)
+	return int(n)
+}
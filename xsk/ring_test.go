@@ -0,0 +1,65 @@
+package xsk
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+func TestRing(t *testing.T) {
+	const size = 4
+	offsets := unix.XDPRingOffset{
+		Producer: 0,
+		Consumer: 4,
+		Flags:    8,
+		Desc:     16,
+	}
+
+	// Use a []uint64 to get correct alignment.
+	mem := make([]uint64, 2+size)
+	buf := (*[(2 + size) * 8]byte)(unsafe.Pointer(&mem[0]))[:]
+
+	producer := newRing(buf, offsets, size)
+	consumer := newRing(buf, offsets, size)
+
+	if n := producer.produceAddrs([]uint64{1, 2, 3}); n != 3 {
+		t.Fatal("Expected to produce 3 entries, got", n)
+	}
+	if n := producer.produceAddrs([]uint64{4, 5}); n != 1 {
+		t.Fatal("Expected to produce 1 entry into a full ring, got", n)
+	}
+
+	addrs := make([]uint64, 3)
+	if n := consumer.consumeAddrs(addrs); n != 3 || addrs[0] != 1 || addrs[2] != 3 {
+		t.Fatal("Expected to consume [1 2 3], got", addrs[:n])
+	}
+
+	// Wrap around.
+	if n := producer.produceAddrs([]uint64{6, 7, 8}); n != 3 {
+		t.Fatal("Expected to produce 3 entries after consuming, got", n)
+	}
+
+	addrs = make([]uint64, 8)
+	n := consumer.consumeAddrs(addrs)
+	if n != 4 {
+		t.Fatal("Expected to consume 4 entries, got", n)
+	}
+	for i, want := range []uint64{4, 6, 7, 8} {
+		if addrs[i] != want {
+			t.Errorf("Entry %d is %d instead of %d", i, addrs[i], want)
+		}
+	}
+
+	if n := consumer.consumeAddrs(addrs); n != 0 {
+		t.Error("Consumed entries from an empty ring:", n)
+	}
+
+	if consumer.needWakeup() {
+		t.Error("needWakeup returns true without the flag")
+	}
+	*producer.flags = unix.XDP_RING_NEED_WAKEUP
+	if !consumer.needWakeup() {
+		t.Error("needWakeup returns false with the flag")
+	}
+}
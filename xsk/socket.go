@@ -0,0 +1,388 @@
+package xsk
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"time"
+	"unsafe"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+// Defaults used for zero fields of Config.
+const (
+	DefaultNumFrames = 4096
+	DefaultFrameSize = 4096
+	DefaultRingSize  = 2048
+)
+
+// BindFlags control how a Socket is bound to a queue.
+type BindFlags uint16
+
+// Valid BindFlags.
+const (
+	// CopyMode forces copying packets between the driver and UMEM.
+	CopyMode BindFlags = unix.XDP_COPY
+	// ZeroCopyMode fails binding if the driver doesn't support zero-copy.
+	ZeroCopyMode BindFlags = unix.XDP_ZEROCOPY
+	// UseNeedWakeup lets the kernel indicate when it has to be woken up
+	// to process the fill and TX rings, instead of busy polling them.
+	UseNeedWakeup BindFlags = unix.XDP_USE_NEED_WAKEUP
+)
+
+// Config describes the UMEM and rings of a Socket.
+//
+// The zero value is valid.
+type Config struct {
+	// The number of frames in the UMEM. Defaults to DefaultNumFrames.
+	NumFrames int
+	// The size of a frame in bytes. Must be a power of two between 2048 and
+	// the page size. Defaults to DefaultFrameSize.
+	FrameSize int
+	// The number of bytes the kernel reserves in front of received packets.
+	FrameHeadroom int
+	// The number of entries in each ring. Must be a power of two.
+	// Default to DefaultRingSize.
+	FillRingSize       int
+	CompletionRingSize int
+	RxRingSize         int
+	TxRingSize         int
+	// Flags passed when binding the socket.
+	BindFlags BindFlags
+}
+
+func (cfg *Config) withDefaults() Config {
+	var c Config
+	if cfg != nil {
+		c = *cfg
+	}
+
+	setDefault := func(value *int, def int) {
+		if *value == 0 {
+			*value = def
+		}
+	}
+	setDefault(&c.NumFrames, DefaultNumFrames)
+	setDefault(&c.FrameSize, DefaultFrameSize)
+	setDefault(&c.FillRingSize, DefaultRingSize)
+	setDefault(&c.CompletionRingSize, DefaultRingSize)
+	setDefault(&c.RxRingSize, DefaultRingSize)
+	setDefault(&c.TxRingSize, DefaultRingSize)
+	return c
+}
+
+func (cfg *Config) check() error {
+	if cfg.NumFrames < 0 || cfg.FrameHeadroom < 0 {
+		return errors.New("NumFrames and FrameHeadroom mustn't be negative")
+	}
+
+	if !isPowerOfTwo(cfg.FrameSize) || cfg.FrameSize < 2048 || cfg.FrameSize > os.Getpagesize() {
+		return fmt.Errorf("invalid frame size %d", cfg.FrameSize)
+	}
+
+	if cfg.FrameHeadroom >= cfg.FrameSize {
+		return fmt.Errorf("headroom %d doesn't fit into frame size %d", cfg.FrameHeadroom, cfg.FrameSize)
+	}
+
+	if uint64(cfg.NumFrames)*uint64(cfg.FrameSize) > math.MaxInt32 {
+		return errors.New("UMEM is too large")
+	}
+
+	for _, size := range []int{cfg.FillRingSize, cfg.CompletionRingSize, cfg.RxRingSize, cfg.TxRingSize} {
+		if !isPowerOfTwo(size) {
+			return fmt.Errorf("ring size %d is not a power of two", size)
+		}
+	}
+
+	return nil
+}
+
+func isPowerOfTwo(n int) bool {
+	return n > 0 && n&(n-1) == 0
+}
+
+// Desc describes a packet in the UMEM.
+//
+// It must match struct xdp_desc in <linux/if_xdp.h>.
+type Desc struct {
+	// The offset of the packet in the UMEM.
+	Addr uint64
+	// The length of the packet.
+	Len     uint32
+	Options uint32
+}
+
+// Stats are statistics of a Socket.
+type Stats struct {
+	RxDropped       uint64
+	RxInvalidDescs  uint64
+	TxInvalidDescs  uint64
+	RxRingFull      uint64
+	RxFillRingEmpty uint64
+	TxRingEmpty     uint64
+}
+
+// Socket is an AF_XDP socket bound to a single queue of a network
+// interface.
+//
+// Methods which access a ring must not be called concurrently with other
+// methods accessing the same ring.
+type Socket struct {
+	fd        int
+	queueID   int
+	flags     BindFlags
+	umem      []byte
+	numFrames int
+	frameSize int
+
+	fill       *ring
+	completion *ring
+	rx         *ring
+	tx         *ring
+}
+
+// NewSocket creates an AF_XDP socket with its own UMEM, and binds it to a
+// queue of a network interface.
+//
+// cfg may be nil. Requires at least Linux 4.18.
+func NewSocket(ifindex, queueID int, cfg *Config) (_ *Socket, err error) {
+	c := cfg.withDefaults()
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+
+	fd, err := unix.Socket(unix.AF_XDP, unix.SOCK_RAW|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("can't create AF_XDP socket: %w", err)
+	}
+
+	s := &Socket{
+		fd:        fd,
+		queueID:   queueID,
+		flags:     c.BindFlags,
+		numFrames: c.NumFrames,
+		frameSize: c.FrameSize,
+	}
+	defer func() {
+		if err != nil {
+			s.Close()
+		}
+	}()
+
+	s.umem, err = unix.Mmap(-1, 0, c.NumFrames*c.FrameSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS|unix.MAP_POPULATE)
+	if err != nil {
+		return nil, fmt.Errorf("can't allocate UMEM: %w", err)
+	}
+
+	reg := unix.XDPUmemReg{
+		Addr:     uint64(uintptr(unsafe.Pointer(&s.umem[0]))),
+		Len:      uint64(len(s.umem)),
+		Size:     uint32(c.FrameSize),
+		Headroom: uint32(c.FrameHeadroom),
+	}
+	if err := unix.SetsockoptXDPUmemReg(fd, &reg); err != nil {
+		return nil, fmt.Errorf("can't register UMEM: %w", err)
+	}
+
+	for _, opt := range []struct {
+		name  string
+		opt   int
+		value int
+	}{
+		{"fill", unix.XDP_UMEM_FILL_RING, c.FillRingSize},
+		{"completion", unix.XDP_UMEM_COMPLETION_RING, c.CompletionRingSize},
+		{"RX", unix.XDP_RX_RING, c.RxRingSize},
+		{"TX", unix.XDP_TX_RING, c.TxRingSize},
+	} {
+		if err := unix.SetsockoptInt(fd, unix.SOL_XDP, opt.opt, opt.value); err != nil {
+			return nil, fmt.Errorf("can't set %s ring size: %w", opt.name, err)
+		}
+	}
+
+	offsets, err := unix.GetsockoptXDPMmapOffsets(fd)
+	if err != nil {
+		return nil, fmt.Errorf("can't get ring offsets: %w", err)
+	}
+
+	addrSize, descSize := unsafe.Sizeof(uint64(0)), unsafe.Sizeof(Desc{})
+	if s.fill, err = mmapRing(fd, unix.XDP_UMEM_PGOFF_FILL_RING, offsets.Fr, c.FillRingSize, addrSize); err != nil {
+		return nil, fmt.Errorf("fill ring: %w", err)
+	}
+	if s.completion, err = mmapRing(fd, unix.XDP_UMEM_PGOFF_COMPLETION_RING, offsets.Cr, c.CompletionRingSize, addrSize); err != nil {
+		return nil, fmt.Errorf("completion ring: %w", err)
+	}
+	if s.rx, err = mmapRing(fd, unix.XDP_PGOFF_RX_RING, offsets.Rx, c.RxRingSize, descSize); err != nil {
+		return nil, fmt.Errorf("RX ring: %w", err)
+	}
+	if s.tx, err = mmapRing(fd, unix.XDP_PGOFF_TX_RING, offsets.Tx, c.TxRingSize, descSize); err != nil {
+		return nil, fmt.Errorf("TX ring: %w", err)
+	}
+
+	sa := &unix.SockaddrXDP{
+		Flags:   uint16(c.BindFlags),
+		Ifindex: uint32(ifindex),
+		QueueID: uint32(queueID),
+	}
+	if err := unix.Bind(fd, sa); err != nil {
+		return nil, fmt.Errorf("can't bind to interface %d queue %d: %w", ifindex, queueID, err)
+	}
+
+	return s, nil
+}
+
+// FD returns the file descriptor of the socket.
+func (s *Socket) FD() int {
+	return s.fd
+}
+
+// Close releases the socket and its UMEM.
+func (s *Socket) Close() error {
+	if s.fd == -1 {
+		return nil
+	}
+
+	for _, r := range []*ring{s.fill, s.completion, s.rx, s.tx} {
+		_ = r.close()
+	}
+	if s.umem != nil {
+		_ = unix.Munmap(s.umem)
+		s.umem = nil
+	}
+
+	err := unix.Close(s.fd)
+	s.fd = -1
+	if err != nil {
+		return fmt.Errorf("close AF_XDP socket: %w", err)
+	}
+	return nil
+}
+
+// NumFrames returns the number of frames in the UMEM.
+func (s *Socket) NumFrames() int {
+	return s.numFrames
+}
+
+// FrameAddr returns the address of the i-th frame in the UMEM.
+func (s *Socket) FrameAddr(i int) uint64 {
+	return uint64(i) * uint64(s.frameSize)
+}
+
+// Frame returns the packet described by desc.
+//
+// The returned slice aliases the UMEM. It must not be accessed after the
+// frame has been handed back to the kernel.
+func (s *Socket) Frame(desc Desc) []byte {
+	return s.umem[desc.Addr : desc.Addr+uint64(desc.Len)]
+}
+
+// Fill hands frames to the kernel for receiving packets.
+//
+// Returns the number of frames which fit into the fill ring.
+func (s *Socket) Fill(addrs []uint64) int {
+	return s.fill.produceAddrs(addrs)
+}
+
+// Receive dequeues received packets from the RX ring.
+//
+// Returns the number of valid elements in descs. The frames are owned
+// by the caller until they are passed to Fill or Transmit.
+func (s *Socket) Receive(descs []Desc) int {
+	return s.rx.consumeDescs(descs)
+}
+
+// Transmit enqueues packets on the TX ring and notifies the kernel.
+//
+// Returns the number of packets which fit into the TX ring. The frames are
+// owned by the kernel until they are returned by Complete.
+func (s *Socket) Transmit(descs []Desc) (int, error) {
+	n := s.tx.produceDescs(descs)
+	if n == 0 {
+		return 0, nil
+	}
+
+	// Without UseNeedWakeup the flag is never set, and the kernel
+	// must always be woken up.
+	if s.flags&UseNeedWakeup != 0 && !s.tx.needWakeup() {
+		return n, nil
+	}
+
+	_, err := unix.SendmsgN(s.fd, nil, nil, nil, unix.MSG_DONTWAIT)
+	if err != nil && !errors.Is(err, unix.EAGAIN) && !errors.Is(err, unix.EBUSY) && !errors.Is(err, unix.ENOBUFS) {
+		return n, fmt.Errorf("can't wake up kernel: %w", err)
+	}
+	return n, nil
+}
+
+// Complete dequeues frames which the kernel has finished transmitting.
+//
+// Returns the number of valid elements in addrs.
+func (s *Socket) Complete(addrs []uint64) int {
+	return s.completion.consumeAddrs(addrs)
+}
+
+// Wait blocks until the RX ring contains packets.
+//
+// Returns an error wrapping os.ErrDeadlineExceeded if timeout passes.
+// A negative timeout blocks indefinitely.
+func (s *Socket) Wait(timeout time.Duration) error {
+	msecs := -1
+	if timeout >= 0 {
+		msecs = int((timeout + time.Millisecond - 1) / time.Millisecond)
+	}
+
+	for {
+		fds := []unix.PollFd{{Fd: int32(s.fd), Events: unix.POLLIN}}
+		n, err := unix.Poll(fds, msecs)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("poll AF_XDP socket: %w", err)
+		}
+		if n == 0 {
+			return fmt.Errorf("poll AF_XDP socket: %w", os.ErrDeadlineExceeded)
+		}
+		return nil
+	}
+}
+
+// Stats returns statistics maintained by the kernel.
+func (s *Socket) Stats() (Stats, error) {
+	stats, err := unix.GetsockoptXDPStatistics(s.fd)
+	if err != nil {
+		return Stats{}, fmt.Errorf("can't get statistics: %w", err)
+	}
+
+	return Stats{
+		RxDropped:       stats.Rx_dropped,
+		RxInvalidDescs:  stats.Rx_invalid_descs,
+		TxInvalidDescs:  stats.Tx_invalid_descs,
+		RxRingFull:      stats.Rx_ring_full,
+		RxFillRingEmpty: stats.Rx_fill_ring_empty_descs,
+		TxRingEmpty:     stats.Tx_ring_empty_descs,
+	}, nil
+}
+
+// Attach inserts the socket into an XSKMap at the index of its queue,
+// which allows XDP programs to redirect packets to it.
+func (s *Socket) Attach(xsks *ebpf.Map) error {
+	if xsks.Type() != ebpf.XSKMap {
+		return fmt.Errorf("%s is not an XSKMap", xsks.Type())
+	}
+
+	if err := xsks.Put(uint32(s.queueID), uint32(s.fd)); err != nil {
+		return fmt.Errorf("can't insert socket into XSKMap: %w", err)
+	}
+	return nil
+}
+
+// Detach removes the socket from an XSKMap.
+func (s *Socket) Detach(xsks *ebpf.Map) error {
+	if err := xsks.Delete(uint32(s.queueID)); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+		return fmt.Errorf("can't remove socket from XSKMap: %w", err)
+	}
+	return nil
+}
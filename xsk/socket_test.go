@@ -0,0 +1,133 @@
+package xsk
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal/testutils"
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+func TestConfig(t *testing.T) {
+	var nilConfig *Config
+	defaults := nilConfig.withDefaults()
+	if err := defaults.check(); err != nil {
+		t.Fatal("Default config is invalid:", err)
+	}
+
+	for _, cfg := range []Config{
+		{FrameSize: 1000},
+		{FrameSize: 1024},
+		{FrameSize: 2048, FrameHeadroom: 2048},
+		{NumFrames: -1},
+		{RxRingSize: 100},
+	} {
+		c := cfg.withDefaults()
+		if err := c.check(); err == nil {
+			t.Errorf("Config %+v is accepted", cfg)
+		}
+	}
+}
+
+func TestSocket(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.4", "AF_XDP with need_wakeup")
+
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skip("No loopback interface:", err)
+	}
+
+	sock, err := NewSocket(lo.Index, 0, &Config{
+		NumFrames: 64,
+		FrameSize: 2048,
+		BindFlags: CopyMode | UseNeedWakeup,
+	})
+	if errors.Is(err, unix.EPERM) {
+		t.Skip("Insufficient permissions to create AF_XDP socket")
+	}
+	if err != nil {
+		t.Fatal("Can't create socket:", err)
+	}
+	defer sock.Close()
+
+	xsks, err := ebpf.NewMap(&ebpf.MapSpec{
+		Type:       ebpf.XSKMap,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer xsks.Close()
+
+	if err := sock.Attach(xsks); err != nil {
+		t.Fatal("Can't attach socket:", err)
+	}
+	if err := sock.Detach(xsks); err != nil {
+		t.Fatal("Can't detach socket:", err)
+	}
+
+	array, err := ebpf.NewMap(&ebpf.MapSpec{
+		Type:       ebpf.Array,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer array.Close()
+
+	if err := sock.Attach(array); err == nil {
+		t.Error("Attaching to a map which isn't an XSKMap doesn't fail")
+	}
+
+	var fill []uint64
+	for i := 0; i < 32; i++ {
+		fill = append(fill, sock.FrameAddr(i))
+	}
+	if n := sock.Fill(fill); n != len(fill) {
+		t.Fatalf("Filled %d instead of %d frames", n, len(fill))
+	}
+
+	tx := Desc{Addr: sock.FrameAddr(32), Len: 60}
+	frame := sock.Frame(tx)
+	for i := range frame {
+		frame[i] = 0xff
+	}
+
+	if n, err := sock.Transmit([]Desc{tx}); err != nil || n != 1 {
+		t.Fatal("Can't transmit frame:", n, err)
+	}
+
+	completed := make([]uint64, 1)
+	for start := time.Now(); sock.Complete(completed) == 0; {
+		if time.Since(start) > time.Second {
+			t.Fatal("Transmitted frame isn't completed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if completed[0] != tx.Addr {
+		t.Errorf("Completed frame %d instead of %d", completed[0], tx.Addr)
+	}
+
+	if err := sock.Wait(0); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Error("Wait on an empty RX ring doesn't time out:", err)
+	}
+
+	if _, err := sock.Stats(); err != nil {
+		t.Error("Can't get statistics:", err)
+	}
+
+	if err := sock.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sock.Close(); err != nil {
+		t.Error("Closing twice returns an error:", err)
+	}
+}